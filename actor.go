@@ -0,0 +1,30 @@
+package crdt
+
+import (
+	"context"
+)
+
+// actorKey is the context key of the actor identity
+type actorKey struct{}
+
+// WithActor returns a copy of the context carrying the identity of the actor (e.g. an end user)
+// who makes the changes, so servers sharing one replica between many users can attribute operations.
+func WithActor(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, actorKey{}, id)
+}
+
+// ActorFromContext returns the actor identity set by `WithActor`.
+// Returns false if the context does not carry an actor.
+func ActorFromContext(ctx context.Context) (id string, ok bool) {
+	id, ok = ctx.Value(actorKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Actor returns the actor taken from the context or the replica ID if the context does not carry one.
+func (r Replica) Actor(ctx context.Context) string {
+	id, ok := ActorFromContext(ctx)
+	if !ok {
+		return r.ID
+	}
+	return id
+}
@@ -0,0 +1,28 @@
+package crdt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestActor(t *testing.T) {
+	r := NewReplica("server")
+
+	t.Run("takes the actor from the context", func(t *testing.T) {
+		ctx := WithActor(context.Background(), "alice")
+
+		id, ok := ActorFromContext(ctx)
+		require.True(t, ok)
+		require.Equal(t, "alice", id)
+		require.Equal(t, "alice", r.Actor(ctx))
+	})
+
+	t.Run("falls back to the replica ID", func(t *testing.T) {
+		_, ok := ActorFromContext(context.Background())
+		require.False(t, ok)
+		require.Equal(t, "server", r.Actor(context.Background()))
+		require.Equal(t, "server", r.Actor(WithActor(context.Background(), "")))
+	})
+}
@@ -0,0 +1,27 @@
+// Package clock contains clocks used by the CRDTs in this module for ordering operations.
+package clock
+
+import (
+	"time"
+)
+
+// Clock produces timestamps for operations.
+// It's pluggable so the CRDTs can use a hybrid logical clock,
+// a synchronized clock or a fake clock in tests.
+type Clock interface {
+	// Now returns the current timestamp
+	Now() time.Time
+}
+
+// Func is an adapter to use an ordinary function as a `Clock`
+type Func func() time.Time
+
+// Now implements the `Clock` interface
+func (f Func) Now() time.Time {
+	return f()
+}
+
+// System returns a clock that uses the local system time
+func System() Clock {
+	return Func(time.Now)
+}
@@ -0,0 +1,96 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrBackwards occurs when the clock shows a time before the last timestamp it issued, e.g. after an NTP step
+	ErrBackwards = errors.New("clock went backwards")
+)
+
+// MonotonicMode defines how a `Monotonic` clock handles the time going backwards
+type MonotonicMode int
+
+const (
+	// MonotonicBump issues the next timestamp after the last one while the clock is behind
+	MonotonicBump MonotonicMode = iota
+	// MonotonicReject makes `Check` fail with `ErrBackwards` while the clock is behind,
+	// so operations that can fail are rejected, the others get the bumped timestamps like with `MonotonicBump`
+	MonotonicReject
+)
+
+// Checker is implemented by clocks that can tell whether they are fit for issuing timestamps
+type Checker interface {
+	// Check returns an error if the clock should not be used for new operations
+	Check() error
+}
+
+// Check returns the error of the clock if it implements `Checker`, nil otherwise
+func Check(c Clock) error {
+	if checker, ok := c.(Checker); ok {
+		return checker.Check()
+	}
+	return nil
+}
+
+// NewMonotonic returns a clock guarding the timestamps of the given clock, so they never go backwards
+func NewMonotonic(c Clock, mode MonotonicMode) Monotonic {
+	return Monotonic{
+		mutex: &sync.Mutex{},
+		clock: c,
+		mode:  mode,
+		last:  &time.Time{},
+	}
+}
+
+// Monotonic is a clock issuing every timestamp after the previous one even if the wrapped clock goes backwards
+// (e.g. the wall clock is stepped back by NTP), so later local operations always win over earlier ones.
+// While the wrapped clock is behind, timestamps are bumped by a nanosecond after the last one.
+// The same clock should be used by all the CRDTs of a replica (see `crdt.Replica.Clock`).
+// Use `NewMonotonic` in order to initialize it before use. Copies of the value share the last timestamp,
+// it's safe for concurrent use.
+type Monotonic struct {
+	mutex *sync.Mutex
+	clock Clock
+	mode  MonotonicMode
+	// last is the last issued timestamp
+	last *time.Time
+}
+
+// Now implements the `Clock` interface
+func (m Monotonic) Now() time.Time {
+	// the wall clock is compared, not the monotonic reading, since only the wall clock is replicated
+	now := m.clock.Now().Round(0)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !now.After(*m.last) {
+		now = m.last.Add(time.Nanosecond)
+	}
+	*m.last = now
+	return now
+}
+
+// Check implements the `Checker` interface.
+// Returns an error with `ErrBackwards` cause if the mode is `MonotonicReject` and the wrapped clock
+// shows a time before the last issued timestamp.
+func (m Monotonic) Check() error {
+	if m.mode != MonotonicReject {
+		return nil
+	}
+	now := m.clock.Now().Round(0)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if now.Before(*m.last) {
+		return errors.Wrapf(ErrBackwards, "the clock is %s behind the last timestamp %s",
+			m.last.Sub(now), m.last.Format(time.RFC3339Nano))
+	}
+	return nil
+}
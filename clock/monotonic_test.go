@@ -0,0 +1,73 @@
+package clock
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonotonic(t *testing.T) {
+	start := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("bumps the timestamps while the clock is behind", func(t *testing.T) {
+		now := start
+		m := NewMonotonic(Func(func() time.Time { return now }), MonotonicBump)
+
+		require.Equal(t, start, m.Now())
+		require.Equal(t, start.Add(time.Nanosecond), m.Now(), "the same time is bumped too")
+
+		now = start.Add(-time.Hour)
+		require.Equal(t, start.Add(2*time.Nanosecond), m.Now())
+		require.NoError(t, m.Check())
+		require.NoError(t, Check(m))
+
+		now = start.Add(time.Second)
+		require.Equal(t, start.Add(time.Second), m.Now())
+	})
+
+	t.Run("rejects operations while the clock is behind", func(t *testing.T) {
+		now := start
+		m := NewMonotonic(Func(func() time.Time { return now }), MonotonicReject)
+		require.Equal(t, start, m.Now())
+		require.NoError(t, Check(m))
+
+		now = start.Add(-time.Minute)
+		err := Check(m)
+		require.ErrorIs(t, err, ErrBackwards)
+		require.Contains(t, err.Error(), "the clock is 1m0s behind the last timestamp 2021-09-01T10:00:00Z")
+		require.Equal(t, start.Add(time.Nanosecond), m.Now(), "operations that cannot fail get bumped timestamps")
+
+		now = start.Add(time.Minute)
+		require.NoError(t, Check(m))
+	})
+
+	t.Run("copies share the last timestamp", func(t *testing.T) {
+		m := NewMonotonic(NewVirtual(start), MonotonicBump)
+		copied := m
+
+		var wg sync.WaitGroup
+		timestamps := make(chan time.Time, 100)
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(c Clock) {
+				defer wg.Done()
+				timestamps <- c.Now()
+			}([]Clock{m, copied}[i%2])
+		}
+		wg.Wait()
+		close(timestamps)
+
+		seen := make(map[time.Time]bool)
+		for ts := range timestamps {
+			require.False(t, seen[ts], "timestamp %s issued twice", ts)
+			seen[ts] = true
+		}
+		require.Len(t, seen, 100)
+	})
+
+	t.Run("checks only checkers", func(t *testing.T) {
+		require.NoError(t, Check(System()))
+	})
+}
@@ -0,0 +1,77 @@
+package clock
+
+// Ordering is a result of comparing two version vectors
+type Ordering int
+
+const (
+	// Equal means both version vectors are identical
+	Equal Ordering = iota
+	// Before means the version vector causally precedes the other one
+	Before
+	// After means the version vector causally follows the other one
+	After
+	// Concurrent means none of the version vectors precedes the other one
+	Concurrent
+)
+
+// VersionVector tracks the number of operations observed from each replica.
+// It's used for detecting concurrent operations, which is not possible with timestamps.
+type VersionVector map[string]uint64
+
+// Increment returns a copy of the version vector with the counter of `replicaID` incremented.
+func (vv VersionVector) Increment(replicaID string) VersionVector {
+	result := vv.Copy()
+	result[replicaID]++
+	return result
+}
+
+// Merge returns a new version vector with the maximum counter of each replica
+// from both version vectors.
+func (vv VersionVector) Merge(other VersionVector) VersionVector {
+	result := vv.Copy()
+	for replicaID, counter := range other {
+		if counter > result[replicaID] {
+			result[replicaID] = counter
+		}
+	}
+	return result
+}
+
+// Compare returns the causal ordering of the version vector relative to the `other` one.
+func (vv VersionVector) Compare(other VersionVector) Ordering {
+	before, after := false, false
+
+	for replicaID, counter := range vv {
+		switch {
+		case counter < other[replicaID]:
+			before = true
+		case counter > other[replicaID]:
+			after = true
+		}
+	}
+	for replicaID, counter := range other {
+		if _, exists := vv[replicaID]; !exists && counter > 0 {
+			before = true
+		}
+	}
+
+	switch {
+	case before && after:
+		return Concurrent
+	case before:
+		return Before
+	case after:
+		return After
+	default:
+		return Equal
+	}
+}
+
+// Copy returns a copy of the version vector, it's never nil
+func (vv VersionVector) Copy() VersionVector {
+	result := make(VersionVector, len(vv))
+	for replicaID, counter := range vv {
+		result[replicaID] = counter
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package clock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionVector(t *testing.T) {
+	t.Run("Compare", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			a        VersionVector
+			b        VersionVector
+			expected Ordering
+		}{
+			{
+				name:     "empty vectors are equal",
+				a:        VersionVector{},
+				b:        nil,
+				expected: Equal,
+			},
+			{
+				name:     "zero counters are equal to missing ones",
+				a:        VersionVector{"A": 0},
+				b:        VersionVector{},
+				expected: Equal,
+			},
+			{
+				name:     "smaller counter is before",
+				a:        VersionVector{"A": 1},
+				b:        VersionVector{"A": 2},
+				expected: Before,
+			},
+			{
+				name:     "missing replica is before",
+				a:        VersionVector{"A": 1},
+				b:        VersionVector{"A": 1, "B": 1},
+				expected: Before,
+			},
+			{
+				name:     "greater counter is after",
+				a:        VersionVector{"A": 2, "B": 1},
+				b:        VersionVector{"A": 1},
+				expected: After,
+			},
+			{
+				name:     "diverged counters are concurrent",
+				a:        VersionVector{"A": 2, "B": 1},
+				b:        VersionVector{"A": 1, "B": 2},
+				expected: Concurrent,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				require.Equal(t, tc.expected, tc.a.Compare(tc.b))
+			})
+		}
+	})
+
+	t.Run("Increment and Merge do not modify the original vector", func(t *testing.T) {
+		vv := VersionVector{"A": 1}
+
+		incremented := vv.Increment("A")
+		require.Equal(t, VersionVector{"A": 2}, incremented)
+
+		merged := vv.Merge(VersionVector{"A": 0, "B": 3})
+		require.Equal(t, VersionVector{"A": 1, "B": 3}, merged)
+
+		require.Equal(t, VersionVector{"A": 1}, vv)
+	})
+}
@@ -0,0 +1,47 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Virtual is a clock which time moves only when it's advanced explicitly,
+// so scenarios with several replicas replay with exactly the same timestamps.
+// Copies of the value share the same time, it's safe for concurrent use.
+type Virtual struct {
+	mutex *sync.Mutex
+	now   *time.Time
+}
+
+// NewVirtual returns a virtual clock set to the given time
+func NewVirtual(start time.Time) Virtual {
+	return Virtual{
+		mutex: &sync.Mutex{},
+		now:   &start,
+	}
+}
+
+// Now implements the `Clock` interface
+func (v Virtual) Now() time.Time {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return *v.now
+}
+
+// Advance moves the time of the clock forward by `d`, negative durations are ignored
+func (v Virtual) Advance(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	*v.now = v.now.Add(d)
+}
+
+// Skewed returns a clock showing the time of the virtual clock shifted by `skew`,
+// it simulates a replica with an unsynchronized system clock.
+func (v Virtual) Skewed(skew time.Duration) Clock {
+	return Func(func() time.Time {
+		return v.Now().Add(skew)
+	})
+}
@@ -0,0 +1,34 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtual(t *testing.T) {
+	start := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("moves only when advanced", func(t *testing.T) {
+		v := NewVirtual(start)
+		require.Equal(t, start, v.Now())
+		require.Equal(t, start, v.Now())
+
+		v.Advance(time.Second)
+		require.Equal(t, start.Add(time.Second), v.Now())
+
+		v.Advance(-time.Minute)
+		require.Equal(t, start.Add(time.Second), v.Now(), "the time never goes back")
+	})
+
+	t.Run("copies and skewed clocks share the time", func(t *testing.T) {
+		v := NewVirtual(start)
+		copied := v
+		skewed := v.Skewed(-time.Minute)
+
+		copied.Advance(time.Hour)
+		require.Equal(t, start.Add(time.Hour), v.Now())
+		require.Equal(t, start.Add(59*time.Minute), skewed.Now())
+	})
+}
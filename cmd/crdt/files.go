@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+// fileRegistry returns the registry deserializing the state files
+func fileRegistry() (crdt.Registry, error) {
+	registry := crdt.NewRegistry()
+	err := lww.Register(registry, crdt.NewReplica("crdt-cli"))
+	return registry, err
+}
+
+// runPrint prints the contents of a set or a graph state file:
+// the vertices with their values and adjacent keys or the element keys, sorted by key
+func runPrint(out io.Writer, args []string) error {
+	flags := flag.NewFlagSet("print", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: print FILE")
+	}
+
+	registry, err := fileRegistry()
+	if err != nil {
+		return err
+	}
+	c, err := readCRDT(flags.Arg(0), registry)
+	if err != nil {
+		return err
+	}
+
+	switch c := c.(type) {
+	case lww.Graph:
+		list, err := c.List()
+		if err != nil {
+			return err
+		}
+		for _, v := range list {
+			if len(v.AdjacentKeys) == 0 {
+				fmt.Fprintf(out, "%s = %q\n", v.Key, v.Value)
+				continue
+			}
+			fmt.Fprintf(out, "%s = %q -> %s\n", v.Key, v.Value, strings.Join(v.AdjacentKeys, " "))
+		}
+		fmt.Fprintf(out, "%d vertices\n", len(list))
+	case lww.Set:
+		keys := setKeys(c)
+		for _, key := range keys {
+			fmt.Fprintln(out, key)
+		}
+		fmt.Fprintf(out, "%d elements\n", len(keys))
+	default:
+		return errors.Errorf("printing %q is not supported", c.Kind())
+	}
+	return nil
+}
+
+// runDiff prints the differences between two set or graph state files
+func runDiff(out io.Writer, args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("usage: diff FILE1 FILE2")
+	}
+	aPath, bPath := flags.Arg(0), flags.Arg(1)
+
+	registry, err := fileRegistry()
+	if err != nil {
+		return err
+	}
+	a, err := readCRDT(aPath, registry)
+	if err != nil {
+		return err
+	}
+	b, err := readCRDT(bPath, registry)
+	if err != nil {
+		return err
+	}
+	if a.Kind() != b.Kind() {
+		return errors.Wrapf(crdt.ErrKindMismatch, "%s contains %q, %s contains %q", aPath, a.Kind(), bPath, b.Kind())
+	}
+
+	switch a := a.(type) {
+	case lww.Graph:
+		return diff(out, a, b.(lww.Graph), aPath, bPath)
+	case lww.Set:
+		diffSets(out, a, b.(lww.Set), aPath, bPath)
+		return nil
+	default:
+		return errors.Errorf("comparing %q is not supported", a.Kind())
+	}
+}
+
+// runMerge merges the state files in order and writes the merged state to the output file
+// or to `out` if the output file is not set
+func runMerge(out io.Writer, args []string) error {
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	output := flags.String("o", "", "file to write the merged state to instead of the standard output")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		return errors.New("usage: merge [-o OUTPUT] FILE1 FILE2 [FILE...]")
+	}
+
+	registry, err := fileRegistry()
+	if err != nil {
+		return err
+	}
+	merged, err := readCRDT(flags.Arg(0), registry)
+	if err != nil {
+		return err
+	}
+	for _, path := range flags.Args()[1:] {
+		remote, err := readCRDT(path, registry)
+		if err != nil {
+			return err
+		}
+		err = merged.MergeCRDT(remote)
+		if err != nil {
+			return errors.Wrapf(err, "failed to merge %s", path)
+		}
+	}
+
+	data, err := crdt.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	}
+	err = ioutil.WriteFile(*output, data, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s", *output)
+	}
+	return nil
+}
+
+// runDOT writes a graph state file in the Graphviz DOT format
+func runDOT(out io.Writer, args []string) error {
+	flags := flag.NewFlagSet("dot", flag.ContinueOnError)
+	config := lww.DOTConfig{}
+	flags.StringVar(&config.Name, "name", lww.DefaultDOTName, "name of the digraph")
+	flags.BoolVar(&config.Values, "values", false, "add the vertex values to the labels")
+	flags.BoolVar(&config.Tombstones, "tombstones", false, "draw the removed vertices and edges dashed")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: dot [-name NAME] [-values] [-tombstones] FILE")
+	}
+
+	registry, err := fileRegistry()
+	if err != nil {
+		return err
+	}
+	g, err := readGraph(flags.Arg(0), registry)
+	if err != nil {
+		return err
+	}
+	return g.ExportDOT(out, config)
+}
+
+// diffSets prints the elements that only one of the sets has, the names describe the sets in the output
+func diffSets(out io.Writer, a, b lww.Set, aName, bName string) {
+	aKeys, bKeys := setKeys(a), setKeys(b)
+	inB := make(map[string]bool, len(bKeys))
+	for _, key := range bKeys {
+		inB[key] = true
+	}
+
+	differences := 0
+	for _, key := range aKeys {
+		if inB[key] {
+			delete(inB, key)
+			continue
+		}
+		fmt.Fprintf(out, "- %s (only in %s)\n", key, aName)
+		differences++
+	}
+	for _, key := range bKeys {
+		if inB[key] {
+			fmt.Fprintf(out, "+ %s (only in %s)\n", key, bName)
+			differences++
+		}
+	}
+
+	if differences == 0 {
+		fmt.Fprintln(out, "no differences")
+	}
+}
+
+// setKeys returns the sorted keys of the set elements
+func setKeys(s lww.Set) []string {
+	elements := s.List()
+	keys := make([]string, 0, len(elements))
+	for _, element := range elements {
+		keys = append(keys, element.GetKey())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFiles(t *testing.T) {
+	now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	tick := clock.Func(func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	})
+	dir := t.TempDir()
+
+	write := func(t *testing.T, name string, c crdt.CRDT) string {
+		data, err := crdt.Marshal(c)
+		require.NoError(t, err)
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, data, 0600))
+		return path
+	}
+
+	a := lww.NewGraph(crdt.Replica{ID: "A", Clock: tick})
+	require.NoError(t, a.AddVertex(lww.Vertex{Key: "v1", Value: "a"}))
+	require.NoError(t, a.AddVertex(lww.Vertex{Key: "v2", Value: "b"}))
+	require.NoError(t, a.AddEdge("v1", "v2"))
+	b := lww.NewGraph(crdt.Replica{ID: "B", Clock: tick})
+	b.Merge(a)
+	require.NoError(t, b.UpdateVertex(lww.Vertex{Key: "v2", Value: "changed"}))
+	require.NoError(t, b.AddVertex(lww.Vertex{Key: "v3", Value: "c"}))
+	require.NoError(t, b.RemoveEdge("v1", "v2"))
+	aPath, bPath := write(t, "a.json", a), write(t, "b.json", b)
+
+	s := lww.NewSet(crdt.Replica{ID: "A", Clock: tick})
+	s.Add(lww.IDElement("e1"))
+	s.Add(lww.IDElement("e2"))
+	otherSet := lww.NewSet(crdt.Replica{ID: "B", Clock: tick})
+	otherSet.Add(lww.IDElement("e2"))
+	otherSet.Add(lww.IDElement("e3"))
+	setPath, otherSetPath := write(t, "s.json", s), write(t, "s2.json", otherSet)
+
+	run := func(t *testing.T, command func(io.Writer, []string) error, args ...string) string {
+		out := &bytes.Buffer{}
+		require.NoError(t, command(out, args))
+		return out.String()
+	}
+
+	t.Run("prints a graph", func(t *testing.T) {
+		require.Equal(t, `v1 = "a" -> v2
+v2 = "b"
+2 vertices
+`, run(t, runPrint, aPath))
+	})
+
+	t.Run("prints a set", func(t *testing.T) {
+		require.Equal(t, "e1\ne2\n2 elements\n", run(t, runPrint, setPath))
+	})
+
+	t.Run("compares graphs", func(t *testing.T) {
+		require.Equal(t, `~ v1 -> [v2] ([] in `+bPath+`)
+~ v2 = "b" ("changed" in `+bPath+`)
++ v3 = "c" (only in `+bPath+`)
+`, run(t, runDiff, aPath, bPath))
+		require.Equal(t, "no differences\n", run(t, runDiff, aPath, aPath))
+	})
+
+	t.Run("compares sets", func(t *testing.T) {
+		require.Equal(t, `- e1 (only in `+setPath+`)
++ e3 (only in `+otherSetPath+`)
+`, run(t, runDiff, setPath, otherSetPath))
+	})
+
+	t.Run("merges files", func(t *testing.T) {
+		mergedPath := filepath.Join(dir, "merged.json")
+		require.Empty(t, run(t, runMerge, "-o", mergedPath, aPath, bPath))
+		require.Equal(t, `v1 = "a"
+v2 = "changed"
+v3 = "c"
+3 vertices
+`, run(t, runPrint, mergedPath))
+
+		merged := run(t, runMerge, setPath, otherSetPath)
+		mergedPath = filepath.Join(dir, "merged-set.json")
+		require.NoError(t, ioutil.WriteFile(mergedPath, []byte(merged), 0600))
+		require.Equal(t, "e1\ne2\ne3\n3 elements\n", run(t, runPrint, mergedPath))
+	})
+
+	t.Run("exports DOT", func(t *testing.T) {
+		require.Equal(t, `digraph "replica A" {
+  "v1" [label="v1\na"];
+  "v2" [label="v2\nb"];
+  "v1" -> "v2";
+}
+`, run(t, runDOT, "-name", "replica A", "-values", aPath))
+	})
+
+	t.Run("fails on invalid arguments", func(t *testing.T) {
+		require.Error(t, runPrint(&bytes.Buffer{}, nil))
+		require.Error(t, runPrint(&bytes.Buffer{}, []string{filepath.Join(dir, "missing.json")}))
+		require.ErrorIs(t, runDiff(&bytes.Buffer{}, []string{aPath, setPath}), crdt.ErrKindMismatch)
+		require.ErrorIs(t, runMerge(&bytes.Buffer{}, []string{aPath, setPath}), crdt.ErrKindMismatch)
+		require.Error(t, runMerge(&bytes.Buffer{}, []string{aPath}))
+		require.Error(t, runDOT(&bytes.Buffer{}, []string{setPath}))
+	})
+}
@@ -0,0 +1,113 @@
+// Command crdt inspects the state of live replicas and serialized state files without writing Go.
+//
+// Usage:
+//
+//	crdt repl [-addr host:port] [-name graph] [-timeout 10s]
+//	crdt print FILE
+//	crdt diff FILE1 FILE2
+//	crdt merge [-o OUTPUT] FILE1 FILE2 [FILE...]
+//	crdt dot [-name NAME] [-values] [-tombstones] FILE
+//
+// The `repl` command starts an interactive session attached to a replica serving a graph
+// over the gRPC sync service (see the `replication/grpc` package).
+// The state is pulled when the session starts and on `refresh`, the replica is never modified.
+// Type `help` in the session for the list of commands.
+//
+// The other commands work offline with `lww.Set` and `lww.Graph` states serialized by `crdt.Marshal`,
+// e.g. for debugging convergence issues: `print` prints the elements or the vertices with their edges,
+// `diff` prints the differences between two replicas, `merge` merges the replicas in order and writes
+// the merged state and `dot` renders a graph for Graphviz (see `lww.Graph.ExportDOT`).
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	crdtgrpc "github.com/rdner/crdt/replication/grpc"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "repl":
+		err = runREPL(os.Args[2:])
+	case "print":
+		err = runPrint(os.Stdout, os.Args[2:])
+	case "diff":
+		err = runDiff(os.Stdout, os.Args[2:])
+	case "merge":
+		err = runMerge(os.Stdout, os.Args[2:])
+	case "dot":
+		err = runDOT(os.Stdout, os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// usage prints the list of commands
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s COMMAND [OPTIONS]\n\nCommands:\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "  repl    interactive queries against a live replica")
+	fmt.Fprintln(os.Stderr, "  print   print the contents of a state file")
+	fmt.Fprintln(os.Stderr, "  diff    compare two state files")
+	fmt.Fprintln(os.Stderr, "  merge   merge state files")
+	fmt.Fprintln(os.Stderr, "  dot     export a graph state file in the Graphviz DOT format")
+}
+
+// runREPL parses the flags of the `repl` command and runs the session on the standard input and output
+func runREPL(args []string) error {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:9000", "address of the gRPC sync service of the replica")
+	name := flags.String("name", "graph", "name of the graph served by the replica")
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of pulling the state")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	replica := crdt.NewReplica("crdt-cli")
+	registry := crdt.NewRegistry()
+	err = lww.Register(registry, replica)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	// nolint:staticcheck // the transport security is configured by the network the replicas run in
+	conn, err := grpc.DialContext(ctx, *addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %s", *addr)
+	}
+	defer conn.Close()
+
+	client := crdtgrpc.NewClient(conn, registry)
+	pull := func() (lww.Graph, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		g := lww.NewGraph(replica)
+		err := client.Pull(ctx, *name, g)
+		return g, err
+	}
+
+	return repl(os.Stdin, os.Stdout, pull, registry)
+}
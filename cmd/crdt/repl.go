@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+// replHelp is printed by the `help` command
+const replHelp = `Commands:
+  lookup KEY        print the vertex
+  path FROM TO      print the shortest path between the vertices
+  connected KEY     print the keys of all the vertices connected to the vertex
+  explain KEY [TO]  print which replica last wrote the vertex or the edge and when
+  diff FILE         compare the graph with a graph serialized by crdt.Marshal in the file
+  refresh           pull the current state of the replica
+  help              print this help
+  quit              end the session
+`
+
+// puller returns the current state of the live replica
+type puller func() (lww.Graph, error)
+
+// repl runs the interactive session reading commands from `in` and writing results to `out`
+// until `in` ends or the `quit` command. `registry` is used for deserializing graphs in `diff`.
+// Errors of single commands are printed, only errors of the session itself are returned.
+func repl(in io.Reader, out io.Writer, pull puller, registry crdt.Registry) error {
+	g, err := pull()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "connected, type \"help\" for the list of commands")
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "quit", "exit":
+			return nil
+		case "refresh":
+			refreshed, err := pull()
+			if err != nil {
+				fmt.Fprintf(out, "error: %s\n", err)
+				continue
+			}
+			g = refreshed
+			fmt.Fprintln(out, "refreshed")
+		default:
+			err = execute(out, g, registry, args)
+			if err != nil {
+				fmt.Fprintf(out, "error: %s\n", err)
+			}
+		}
+	}
+}
+
+// execute runs a single query command against the graph
+func execute(out io.Writer, g lww.Graph, registry crdt.Registry, args []string) error {
+	command, args := args[0], args[1:]
+	expect := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return errors.Errorf("wrong number of arguments for %q, type \"help\" for usage", command)
+		}
+		return nil
+	}
+
+	switch command {
+	case "help":
+		fmt.Fprint(out, replHelp)
+		return nil
+
+	case "lookup":
+		if err := expect(1, 1); err != nil {
+			return err
+		}
+		v, err := g.Lookup(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s = %q\n", v.Key, v.Value)
+		return nil
+
+	case "path":
+		if err := expect(2, 2); err != nil {
+			return err
+		}
+		path, err := g.FindShortestPath(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(path))
+		for _, v := range path {
+			keys = append(keys, v.Key)
+		}
+		fmt.Fprintln(out, strings.Join(keys, " -> "))
+		return nil
+
+	case "connected":
+		if err := expect(1, 1); err != nil {
+			return err
+		}
+		connected, err := g.FindConnected(args[0])
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(connected))
+		for _, v := range connected {
+			keys = append(keys, v.Key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(out, "%d connected: %s\n", len(keys), strings.Join(keys, " "))
+		return nil
+
+	case "explain":
+		if err := expect(1, 2); err != nil {
+			return err
+		}
+		var (
+			write lww.Write
+			err   error
+			what  string
+		)
+		if len(args) == 1 {
+			what = fmt.Sprintf("vertex %s", args[0])
+			write, err = g.LastVertexWrite(args[0])
+		} else {
+			what = fmt.Sprintf("edge %s -> %s", args[0], args[1])
+			write, err = g.LastEdgeWrite(args[0], args[1])
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, explain(what, write))
+		return nil
+
+	case "diff":
+		if err := expect(1, 1); err != nil {
+			return err
+		}
+		other, err := readGraph(args[0], registry)
+		if err != nil {
+			return err
+		}
+		return diff(out, g, other, "the replica", "the file")
+
+	default:
+		return errors.Errorf("unknown command %q, type \"help\" for the list of commands", command)
+	}
+}
+
+// explain returns a human-readable description of the write that decided the state of an element
+func explain(what string, write lww.Write) string {
+	op := "added"
+	if write.Removal {
+		op = "removed"
+	}
+	replica := write.Replica
+	if replica == "" {
+		replica = "an unknown replica"
+	} else {
+		replica = fmt.Sprintf("replica %q", replica)
+	}
+	return fmt.Sprintf("%s was %s by %s at %s", what, op, replica, write.Timestamp.Format(time.RFC3339Nano))
+}
+
+// readGraph reads a graph serialized by `crdt.Marshal` from the file
+func readGraph(path string, registry crdt.Registry) (lww.Graph, error) {
+	c, err := readCRDT(path, registry)
+	if err != nil {
+		return lww.Graph{}, err
+	}
+
+	g, isGraph := c.(lww.Graph)
+	if !isGraph {
+		return lww.Graph{}, errors.Errorf("%s does not contain a graph", path)
+	}
+	return g, nil
+}
+
+// readCRDT reads a CRDT of any registered kind serialized by `crdt.Marshal` from the file
+func readCRDT(path string, registry crdt.Registry) (crdt.CRDT, error) {
+	// nolint:gosec // the path is given by the user of the command
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	c, err := registry.Unmarshal(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+	return c, nil
+}
+
+// diff prints the differences between the vertices and edges of the graph `a` and the graph `b`,
+// the names describe the graphs in the output
+func diff(out io.Writer, a, b lww.Graph, aName, bName string) error {
+	aList, err := a.List()
+	if err != nil {
+		return err
+	}
+	bList, err := b.List()
+	if err != nil {
+		return err
+	}
+
+	bVertices := make(map[string]lww.VertexWithEdges, len(bList))
+	for _, v := range bList {
+		bVertices[v.Key] = v
+	}
+
+	differences := 0
+	for _, v := range aList {
+		o, exists := bVertices[v.Key]
+		delete(bVertices, v.Key)
+
+		switch {
+		case !exists:
+			fmt.Fprintf(out, "- %s = %q (only in %s)\n", v.Key, v.Value, aName)
+			differences++
+			continue
+		case v.Value != o.Value:
+			fmt.Fprintf(out, "~ %s = %q (%q in %s)\n", v.Key, v.Value, o.Value, bName)
+			differences++
+		}
+
+		if strings.Join(v.AdjacentKeys, " ") != strings.Join(o.AdjacentKeys, " ") {
+			fmt.Fprintf(out, "~ %s -> [%s] ([%s] in %s)\n",
+				v.Key, strings.Join(v.AdjacentKeys, " "), strings.Join(o.AdjacentKeys, " "), bName)
+			differences++
+		}
+	}
+
+	// the rest is sorted as well since the list is
+	for _, o := range bList {
+		if _, onlyInB := bVertices[o.Key]; onlyInB {
+			fmt.Fprintf(out, "+ %s = %q (only in %s)\n", o.Key, o.Value, bName)
+			differences++
+		}
+	}
+
+	if differences == 0 {
+		fmt.Fprintln(out, "no differences")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestREPL(t *testing.T) {
+	now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	replica := crdt.Replica{ID: "server", Clock: clock.Func(func() time.Time { return now })}
+	registry := crdt.NewRegistry()
+	require.NoError(t, lww.Register(registry, replica))
+
+	live := lww.NewGraph(replica)
+	require.NoError(t, live.AddVertex(lww.Vertex{Key: "v1", Value: "a"}))
+	require.NoError(t, live.AddVertex(lww.Vertex{Key: "v2", Value: "b"}))
+	require.NoError(t, live.AddVertex(lww.Vertex{Key: "v3", Value: "c"}))
+	require.NoError(t, live.AddEdge("v1", "v2"))
+	require.NoError(t, live.AddEdge("v2", "v3"))
+
+	pulls := 0
+	pull := func() (lww.Graph, error) {
+		pulls++
+		g := lww.NewGraph(crdt.NewReplica("client"))
+		g.Merge(live)
+		return g, nil
+	}
+
+	session := func(t *testing.T, commands ...string) string {
+		out := &bytes.Buffer{}
+		err := repl(strings.NewReader(strings.Join(commands, "\n")), out, pull, registry)
+		require.NoError(t, err)
+		return out.String()
+	}
+
+	t.Run("answers queries", func(t *testing.T) {
+		out := session(t,
+			"lookup v1",
+			"path v1 v3",
+			"connected v1",
+			"explain v2",
+			"explain v1 v2",
+			"lookup v4",
+			"path v1",
+			"unknown",
+			"quit",
+			"lookup v1",
+		)
+		require.Equal(t, `connected, type "help" for the list of commands
+> v1 = "a"
+> v1 -> v2 -> v3
+> 2 connected: v2 v3
+> vertex v2 was added by replica "server" at 2021-09-01T10:00:00Z
+> edge v1 -> v2 was added by replica "server" at 2021-09-01T10:00:00Z
+> error: failed to find vertex [key = "v4"]: vertex not found
+> error: wrong number of arguments for "path", type "help" for usage
+> error: unknown command "unknown", type "help" for the list of commands
+> `, out)
+	})
+
+	t.Run("pulls the current state on refresh", func(t *testing.T) {
+		before := pulls
+		out := session(t, "refresh")
+		require.Contains(t, out, "> refreshed\n")
+		require.Equal(t, before+2, pulls)
+	})
+
+	t.Run("compares with a graph in a file", func(t *testing.T) {
+		other := lww.NewGraph(replica)
+		require.NoError(t, other.AddVertex(lww.Vertex{Key: "v1", Value: "a"}))
+		require.NoError(t, other.AddVertex(lww.Vertex{Key: "v2", Value: "changed"}))
+		require.NoError(t, other.AddVertex(lww.Vertex{Key: "v4", Value: "d"}))
+		require.NoError(t, other.AddEdge("v1", "v4"))
+
+		data, err := crdt.Marshal(other)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "graph.json")
+		require.NoError(t, ioutil.WriteFile(path, data, 0600))
+
+		out := session(t, "diff "+path)
+		require.Equal(t, `connected, type "help" for the list of commands
+> ~ v1 -> [v2] ([v4] in the file)
+~ v2 = "b" ("changed" in the file)
+~ v2 -> [v3] ([] in the file)
+- v3 = "c" (only in the replica)
++ v4 = "d" (only in the file)
+`+"> \n", out)
+
+		data, err = crdt.Marshal(live)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(path, data, 0600))
+		require.Contains(t, session(t, "diff "+path), "> no differences\n")
+	})
+
+	t.Run("fails when the replica cannot be reached", func(t *testing.T) {
+		failing := func() (lww.Graph, error) {
+			return lww.Graph{}, errors.New("connection refused")
+		}
+		err := repl(strings.NewReader(""), &bytes.Buffer{}, failing, registry)
+		require.Error(t, err)
+	})
+}
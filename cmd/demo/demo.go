@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/replication/gossip"
+)
+
+// graphName is the name the replicas gossip the graph under
+const graphName = "graph"
+
+// demoConfig contains the settings of the demo
+type demoConfig struct {
+	// Replicas is the number of replicas
+	Replicas int
+	// Interval is the interval between gossip rounds of every replica
+	Interval time.Duration
+	// Seed initializes the network and the peer selection
+	Seed int64
+	// Network contains the initial settings of the network
+	Network networkConfig
+}
+
+// newDemo creates the replicas (`r1`, `r2`, etc.) connected through the simulated network
+func newDemo(cfg demoConfig) (demo, error) {
+	if cfg.Replicas < 2 {
+		return demo{}, errors.Errorf("at least 2 replicas are required, got %d", cfg.Replicas)
+	}
+
+	registry := crdt.NewRegistry()
+	err := lww.Register(registry, crdt.NewReplica("wire"))
+	if err != nil {
+		return demo{}, err
+	}
+
+	d := demo{
+		network: newNetwork(cfg.Network, cfg.Seed, registry),
+		graphs:  make(map[string]lww.Graph, cfg.Replicas),
+	}
+	for i := 1; i <= cfg.Replicas; i++ {
+		d.ids = append(d.ids, fmt.Sprintf("r%d", i))
+	}
+
+	for i, id := range d.ids {
+		r := crdt.NewReplica(id)
+		g := lww.NewGraph(r)
+		d.graphs[id] = g
+		d.network.add(id, g)
+
+		peers := make([]string, 0, len(d.ids)-1)
+		for _, peer := range d.ids {
+			if peer != id {
+				peers = append(peers, peer)
+			}
+		}
+		gossiper := gossip.NewGossiper(r, link{network: d.network, from: id}, gossip.Config{
+			Peers:    peers,
+			Interval: cfg.Interval,
+			Seed:     cfg.Seed + int64(i) + 1,
+		})
+		gossiper.Replicate(graphName, g)
+		d.gossipers = append(d.gossipers, gossiper)
+	}
+	return d, nil
+}
+
+// demo is a set of in-process graph replicas gossiping through a simulated lossy network with a delay
+type demo struct {
+	// ids are the replica IDs in order
+	ids []string
+	// graphs maps a replica ID to its graph
+	graphs map[string]lww.Graph
+	// gossipers replicate the graphs, in the order of `ids`
+	gossipers []gossip.Gossiper
+	// network connects the replicas
+	network *network
+}
+
+// run runs the gossip of all the replicas until the context is done
+func (d demo) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, gossiper := range d.gossipers {
+		wg.Add(1)
+		go func(gossiper gossip.Gossiper) {
+			defer wg.Done()
+			_ = gossiper.Run(ctx)
+		}(gossiper)
+	}
+	wg.Wait()
+}
+
+// graph returns the graph of the replica with the given ID
+func (d demo) graph(id string) (lww.Graph, error) {
+	g, exists := d.graphs[id]
+	if !exists {
+		return lww.Graph{}, errors.Wrapf(errUnknownReplica, "replica %q, the replicas are %v", id, d.ids)
+	}
+	return g, nil
+}
+
+// converged returns `true` if all the replicas have the same vertices and edges
+func (d demo) converged() (bool, error) {
+	first := d.graphs[d.ids[0]]
+	for _, id := range d.ids[1:] {
+		equal, err := first.Equals(d.graphs[id])
+		if err != nil || !equal {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// waitConverged polls the replicas until they converge or the timeout is reached,
+// returns the time it took to converge
+func (d demo) waitConverged(timeout time.Duration) (time.Duration, error) {
+	started := time.Now()
+	for {
+		converged, err := d.converged()
+		if err != nil {
+			return 0, err
+		}
+		if converged {
+			return time.Since(started), nil
+		}
+		if time.Since(started) > timeout {
+			return 0, errors.Errorf("replicas have not converged in %s", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
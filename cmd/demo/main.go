@@ -0,0 +1,65 @@
+// Command demo runs several graph replicas in a single process, connected through a simulated network
+// that drops and delays messages, and lets you change them in an interactive session and watch them converge.
+// It's a quick way to evaluate the library without deploying anything.
+//
+// Usage:
+//
+//	demo [-replicas 2] [-interval 500ms] [-loss 0.2] [-delay 100ms] [-jitter 200ms] [-seed 1]
+//
+// The replicas (`r1`, `r2`, etc.) replicate an `lww.Graph` with the gossip of the `replication/gossip` package,
+// every replica gossips with a random peer every interval. Every request and response can be dropped
+// with the configured probability and is delivered after the delay plus a random jitter.
+// Type `help` in the session for the list of commands, e.g.:
+//
+//	> add r1 alice
+//	> add r2 bob
+//	> partition r2
+//	> edge r2 bob alice
+//	> status
+//	> heal r2
+//	> wait
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	cfg := demoConfig{}
+	flag.IntVar(&cfg.Replicas, "replicas", 2, "number of replicas")
+	flag.DurationVar(&cfg.Interval, "interval", 500*time.Millisecond, "interval between gossip rounds of every replica")
+	flag.Float64Var(&cfg.Network.Loss, "loss", 0.2, "probability of a message to be dropped")
+	flag.DurationVar(&cfg.Network.Delay, "delay", 100*time.Millisecond, "minimum delivery time of a message")
+	flag.DurationVar(&cfg.Network.Jitter, "jitter", 200*time.Millisecond, "maximum random delivery time added to the delay")
+	flag.Int64Var(&cfg.Seed, "seed", time.Now().UnixNano(), "seed of the simulated network")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [OPTIONS]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	d, err := newDemo(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.run(ctx)
+	}()
+
+	err = repl(os.Stdin, os.Stdout, d)
+	cancel()
+	<-done
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/replication/gossip"
+)
+
+var (
+	// errDropped occurs when the network drops a message
+	errDropped = errors.New("message dropped")
+	// errUnknownReplica occurs when a message is sent to a replica which is not in the network
+	errUnknownReplica = errors.New("unknown replica")
+)
+
+// networkConfig contains the settings of the simulated network, they can be changed while it runs
+type networkConfig struct {
+	// Loss is the probability of a message to be dropped
+	Loss float64
+	// Delay is the minimum delivery time of a message
+	Delay time.Duration
+	// Jitter is the maximum random delivery time added to `Delay`
+	Jitter time.Duration
+}
+
+// networkStats counts the messages sent through the network
+type networkStats struct {
+	// Sent is the number of messages sent
+	Sent int
+	// Dropped is the number of messages dropped by the loss or by partitions
+	Dropped int
+}
+
+// newNetwork returns an in-process network of the replicas, `registry` deserializes the exchanged states
+func newNetwork(cfg networkConfig, seed int64, registry crdt.Registry) *network {
+	return &network{
+		// nolint:gosec // the simulated loss does not need to be cryptographically secure
+		random:      rand.New(rand.NewSource(seed)),
+		cfg:         cfg,
+		registry:    registry,
+		replicas:    make(map[string]lww.Graph),
+		partitioned: make(map[string]bool),
+	}
+}
+
+// network connects in-process replicas through a lossy link with a delay,
+// every replica sends its messages through its own `link`.
+// The network is thread-safe and can be used from several go routines.
+type network struct {
+	// mutex is used for the thread-safety
+	mutex sync.Mutex
+	// random decides which messages are dropped and their delays
+	random *rand.Rand
+	// cfg contains the current settings
+	cfg networkConfig
+	// registry deserializes the exchanged states
+	registry crdt.Registry
+	// replicas maps a replica ID to its graph
+	replicas map[string]lww.Graph
+	// partitioned contains the IDs of the replicas cut off the network
+	partitioned map[string]bool
+	// stats counts the messages
+	stats networkStats
+}
+
+// add connects the replica to the network
+func (n *network) add(id string, g lww.Graph) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.replicas[id] = g
+}
+
+// configure replaces the settings of the network
+func (n *network) configure(cfg networkConfig) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.cfg = cfg
+}
+
+// config returns the current settings of the network
+func (n *network) config() networkConfig {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.cfg
+}
+
+// partition cuts the replica off the network or connects it back
+func (n *network) partition(id string, partitioned bool) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if _, exists := n.replicas[id]; !exists {
+		return errors.Wrapf(errUnknownReplica, "replica %q", id)
+	}
+	n.partitioned[id] = partitioned
+	return nil
+}
+
+// isPartitioned returns `true` if the replica is cut off the network
+func (n *network) isPartitioned(id string) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.partitioned[id]
+}
+
+// statistics returns the message counters
+func (n *network) statistics() networkStats {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.stats
+}
+
+// send delivers a message from one replica to another one: waits for the delay and returns the receiving graph
+// or an error if the message is dropped
+func (n *network) send(ctx context.Context, from, to string) (lww.Graph, error) {
+	n.mutex.Lock()
+	g, exists := n.replicas[to]
+	n.stats.Sent++
+	dropped := n.partitioned[from] || n.partitioned[to] || n.random.Float64() < n.cfg.Loss
+	if dropped {
+		n.stats.Dropped++
+	}
+	delay := n.cfg.Delay
+	if n.cfg.Jitter > 0 {
+		delay += time.Duration(n.random.Int63n(int64(n.cfg.Jitter) + 1))
+	}
+	n.mutex.Unlock()
+
+	if !exists {
+		return lww.Graph{}, errors.Wrapf(errUnknownReplica, "replica %q", to)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return lww.Graph{}, ctx.Err()
+	case <-timer.C:
+	}
+
+	if dropped {
+		return lww.Graph{}, errors.Wrapf(errDropped, "%s -> %s", from, to)
+	}
+	return g, nil
+}
+
+// copy returns a copy of the state as the receiving side deserializes it
+func (n *network) copy(c crdt.CRDT) (crdt.CRDT, error) {
+	data, err := crdt.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return n.registry.Unmarshal(data)
+}
+
+// link is the end of the network a replica sends its gossip through, it implements `gossip.Transport`
+type link struct {
+	// network is the shared network
+	network *network
+	// from is the ID of the sending replica
+	from string
+}
+
+// Digest implements the `gossip.Transport` interface
+func (l link) Digest(ctx context.Context, peer, name string) (string, error) {
+	g, err := l.network.send(ctx, l.from, peer)
+	if err != nil {
+		return "", err
+	}
+	// the response travels back
+	_, err = l.network.send(ctx, peer, l.from)
+	if err != nil {
+		return "", err
+	}
+	return gossip.Digest(g)
+}
+
+// Exchange implements the `gossip.Transport` interface.
+// The peer merges the state even if its response is dropped later, like a real peer would.
+func (l link) Exchange(ctx context.Context, peer, name string, local crdt.CRDT) error {
+	sent, err := l.network.copy(local)
+	if err != nil {
+		return err
+	}
+	g, err := l.network.send(ctx, l.from, peer)
+	if err != nil {
+		return err
+	}
+	err = g.MergeCRDT(sent)
+	if err != nil {
+		return err
+	}
+
+	response, err := l.network.copy(g)
+	if err != nil {
+		return err
+	}
+	_, err = l.network.send(ctx, peer, l.from)
+	if err != nil {
+		return err
+	}
+	return local.MergeCRDT(response)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/lww"
+)
+
+// replHelp is printed by the `help` command
+const replHelp = `Commands:
+  add R KEY [VALUE]      add or update the vertex on the replica R
+  rm R KEY               remove the vertex on the replica R
+  edge R FROM TO         add the edge on the replica R
+  unedge R FROM TO       remove the edge on the replica R
+  show [R]               print the vertices and edges of the replica R or of all the replicas
+  status                 print whether the replicas converged and the network statistics
+  wait [TIMEOUT]         wait until the replicas converge, 10s by default
+  partition R            cut the replica R off the network
+  heal R                 connect the replica R back
+  loss P                 drop messages with the probability P (0..1)
+  delay D [JITTER]       deliver messages after the duration D plus up to JITTER
+  help                   print this help
+  quit                   end the session
+`
+
+// repl runs the interactive session reading commands from `in` and writing results to `out`
+// until `in` ends or the `quit` command. Errors of single commands are printed.
+func repl(in io.Reader, out io.Writer, d demo) error {
+	fmt.Fprintf(out, "replicas %s are gossiping, type \"help\" for the list of commands\n", strings.Join(d.ids, ", "))
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "exit" {
+			return nil
+		}
+
+		err := execute(out, d, args)
+		if err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+		}
+	}
+}
+
+// execute runs a single command
+func execute(out io.Writer, d demo, args []string) error {
+	command, args := args[0], args[1:]
+	expect := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return errors.Errorf("wrong number of arguments for %q, type \"help\" for usage", command)
+		}
+		return nil
+	}
+	// replica returns the graph of the replica in the first argument
+	replica := func() (lww.Graph, error) {
+		return d.graph(args[0])
+	}
+
+	switch command {
+	case "help":
+		fmt.Fprint(out, replHelp)
+		return nil
+
+	case "add":
+		if err := expect(2, 3); err != nil {
+			return err
+		}
+		g, err := replica()
+		if err != nil {
+			return err
+		}
+		v := lww.Vertex{Key: args[1]}
+		if len(args) == 3 {
+			v.Value = args[2]
+		}
+		return g.UpsertVertex(v)
+
+	case "rm":
+		if err := expect(2, 2); err != nil {
+			return err
+		}
+		g, err := replica()
+		if err != nil {
+			return err
+		}
+		return g.RemoveVertex(args[1])
+
+	case "edge", "unedge":
+		if err := expect(3, 3); err != nil {
+			return err
+		}
+		g, err := replica()
+		if err != nil {
+			return err
+		}
+		if command == "edge" {
+			return g.AddEdge(args[1], args[2])
+		}
+		return g.RemoveEdge(args[1], args[2])
+
+	case "show":
+		if err := expect(0, 1); err != nil {
+			return err
+		}
+		ids := d.ids
+		if len(args) == 1 {
+			if _, err := replica(); err != nil {
+				return err
+			}
+			ids = args
+		}
+		for _, id := range ids {
+			err := show(out, id, d.graphs[id])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "status":
+		if err := expect(0, 0); err != nil {
+			return err
+		}
+		converged, err := d.converged()
+		if err != nil {
+			return err
+		}
+		state := "diverged"
+		if converged {
+			state = "converged"
+		}
+		cfg, stats := d.network.config(), d.network.statistics()
+		partitioned := []string{}
+		for _, id := range d.ids {
+			if d.network.isPartitioned(id) {
+				partitioned = append(partitioned, id)
+			}
+		}
+		fmt.Fprintf(out, "replicas %s, loss %g, delay %s, jitter %s, partitioned [%s], %d messages sent, %d dropped\n",
+			state, cfg.Loss, cfg.Delay, cfg.Jitter, strings.Join(partitioned, " "), stats.Sent, stats.Dropped)
+		return nil
+
+	case "wait":
+		if err := expect(0, 1); err != nil {
+			return err
+		}
+		timeout := 10 * time.Second
+		if len(args) == 1 {
+			var err error
+			timeout, err = time.ParseDuration(args[0])
+			if err != nil {
+				return errors.Wrapf(err, "invalid timeout %q", args[0])
+			}
+		}
+		took, err := d.waitConverged(timeout)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "converged in %s\n", took.Round(time.Millisecond))
+		return nil
+
+	case "partition", "heal":
+		if err := expect(1, 1); err != nil {
+			return err
+		}
+		return d.network.partition(args[0], command == "partition")
+
+	case "loss":
+		if err := expect(1, 1); err != nil {
+			return err
+		}
+		loss, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || loss < 0 || loss > 1 {
+			return errors.Errorf("invalid probability %q, expected a number between 0 and 1", args[0])
+		}
+		cfg := d.network.config()
+		cfg.Loss = loss
+		d.network.configure(cfg)
+		return nil
+
+	case "delay":
+		if err := expect(1, 2); err != nil {
+			return err
+		}
+		cfg := d.network.config()
+		var err error
+		cfg.Delay, err = time.ParseDuration(args[0])
+		if err != nil {
+			return errors.Wrapf(err, "invalid delay %q", args[0])
+		}
+		if len(args) == 2 {
+			cfg.Jitter, err = time.ParseDuration(args[1])
+			if err != nil {
+				return errors.Wrapf(err, "invalid jitter %q", args[1])
+			}
+		}
+		d.network.configure(cfg)
+		return nil
+
+	default:
+		return errors.Errorf("unknown command %q, type \"help\" for the list of commands", command)
+	}
+}
+
+// show prints the vertices and the edges of the replica
+func show(out io.Writer, id string, g lww.Graph) error {
+	list, err := g.List()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: %d vertices\n", id, len(list))
+	for _, v := range list {
+		if len(v.AdjacentKeys) == 0 {
+			fmt.Fprintf(out, "  %s = %q\n", v.Key, v.Value)
+			continue
+		}
+		fmt.Fprintf(out, "  %s = %q -> %s\n", v.Key, v.Value, strings.Join(v.AdjacentKeys, " "))
+	}
+	return nil
+}
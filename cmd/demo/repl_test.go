@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemo(t *testing.T) {
+	newRunningDemo := func(t *testing.T, network networkConfig) demo {
+		d, err := newDemo(demoConfig{Replicas: 3, Interval: 5 * time.Millisecond, Seed: 1, Network: network})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			d.run(ctx)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+		return d
+	}
+
+	session := func(t *testing.T, d demo, commands ...string) string {
+		out := &bytes.Buffer{}
+		require.NoError(t, repl(strings.NewReader(strings.Join(commands, "\n")), out, d))
+		return out.String()
+	}
+
+	t.Run("replicas converge after a partition heals", func(t *testing.T) {
+		d := newRunningDemo(t, networkConfig{Delay: time.Millisecond, Jitter: time.Millisecond})
+
+		out := session(t, d,
+			"partition r3",
+			"add r1 alice a",
+			"add r3 bob b",
+			"edge r3 bob bob",
+			"status",
+			"heal r3",
+			"wait 10s",
+			"show r2",
+		)
+		require.Contains(t, out, "> replicas diverged, loss 0, delay 1ms, jitter 1ms, partitioned [r3]")
+		require.Contains(t, out, "> converged in ")
+		require.Contains(t, out, `> r2: 2 vertices
+  alice = "a"
+  bob = "b" -> bob
+`)
+
+		converged, err := d.converged()
+		require.NoError(t, err)
+		require.True(t, converged)
+	})
+
+	t.Run("drops messages", func(t *testing.T) {
+		d := newRunningDemo(t, networkConfig{})
+		out := session(t, d,
+			"loss 1",
+			"add r1 alice",
+			"wait 100ms",
+			"loss 2",
+			"delay soon",
+		)
+		require.Contains(t, out, "> error: replicas have not converged in 100ms")
+		require.Contains(t, out, `> error: invalid probability "2", expected a number between 0 and 1`)
+		require.Contains(t, out, `> error: invalid delay "soon"`)
+
+		stats := d.network.statistics()
+		require.NotZero(t, stats.Sent)
+		require.Equal(t, stats.Sent, stats.Dropped)
+	})
+
+	t.Run("reports invalid commands", func(t *testing.T) {
+		d, err := newDemo(demoConfig{Replicas: 2})
+		require.NoError(t, err)
+
+		out := session(t, d,
+			"add r9 alice",
+			"rm r1 alice",
+			"edge r1",
+			"unknown",
+			"quit",
+			"status",
+		)
+		require.Equal(t, `replicas r1, r2 are gossiping, type "help" for the list of commands
+> error: replica "r9", the replicas are [r1 r2]: unknown replica
+> error: failed to find vertex [key = "alice"]: vertex not found
+> error: wrong number of arguments for "edge", type "help" for usage
+> error: unknown command "unknown", type "help" for the list of commands
+> `, out)
+
+		_, err = newDemo(demoConfig{Replicas: 1})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,126 @@
+// Command replay replays operation logs recorded by several replicas into fresh replicas
+// and finds the earliest operation after which their states stop converging.
+//
+// Usage:
+//
+//	replay [-v] replicaA.jsonl replicaB.jsonl ...
+//
+// Every file contains the log of one or several replicas in the format described in the `oplog` package.
+// The command exits with the status 1 when the replicas diverge and 2 when the logs cannot be replayed.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/oplog"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "print every replayed operation")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-v] LOG...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	diverged, err := run(os.Stdout, flag.Args(), *verbose)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if diverged {
+		os.Exit(1)
+	}
+}
+
+// run replays the logs from the given files and writes the report to `out`.
+// Returns `true` if the replicas diverge.
+func run(out io.Writer, paths []string, verbose bool) (diverged bool, err error) {
+	logs := make([][]oplog.Op, 0, len(paths))
+	for _, path := range paths {
+		log, err := readLog(path)
+		if err != nil {
+			return false, err
+		}
+		logs = append(logs, log)
+	}
+
+	schedule, err := oplog.Schedule(logs...)
+	if err != nil {
+		return false, err
+	}
+
+	if verbose {
+		for i, op := range schedule {
+			fmt.Fprintf(out, "%6d %s\n", i, formatOp(op))
+		}
+	}
+
+	index, err := oplog.Bisect(schedule)
+	if err != nil {
+		return false, err
+	}
+
+	if index == -1 {
+		fmt.Fprintf(out, "replayed %d operations: replicas converge\n", len(schedule))
+		return false, nil
+	}
+
+	fmt.Fprintf(out, "replayed %d operations: replicas diverge after operation %d:\n", len(schedule), index)
+	fmt.Fprintf(out, "  %s\n", formatOp(schedule[index]))
+
+	replicas, err := oplog.Replay(schedule[:index+1])
+	if err != nil {
+		return false, err
+	}
+	_, ids, states, err := oplog.Converges(replicas)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprintln(out, "states after merging with each other:")
+	for i, id := range ids {
+		state, err := json.Marshal(states[i])
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(out, "  %s: %s\n", id, state)
+	}
+
+	return true, nil
+}
+
+// readLog reads the operation log from the file
+func readLog(path string) ([]oplog.Op, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	log, err := oplog.Read(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	return log, nil
+}
+
+// formatOp returns a single-line representation of the operation
+func formatOp(op oplog.Op) string {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return fmt.Sprintf("%+v", op)
+	}
+	return string(data)
+}
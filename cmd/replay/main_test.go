@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/rdner/crdt/oplog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	write := func(t *testing.T, name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	logA := write(t, "a.jsonl", `{"replica":"A","seq":1,"time":"2021-09-01T10:00:00Z","op":"addVertex","key":"v1","value":"a"}
+{"replica":"A","seq":2,"time":"2021-09-01T10:00:02Z","op":"merge","source":"B","sourceSeq":1}
+`)
+	convergingB := write(t, "b1.jsonl", `{"replica":"B","seq":1,"time":"2021-09-01T10:00:01Z","op":"addVertex","key":"v2","value":"b"}
+`)
+	// A's clock goes back, so A re-adds v1 with the timestamp of the first addition B has already merged
+	divergingA := write(t, "a2.jsonl", `{"replica":"A","seq":1,"time":"2021-09-01T10:00:00Z","op":"addVertex","key":"v1","value":"a"}
+{"replica":"A","seq":2,"time":"2021-09-01T10:00:02Z","op":"removeVertex","key":"v1"}
+{"replica":"A","seq":3,"time":"2021-09-01T10:00:00Z","op":"addVertex","key":"v1","value":"c"}
+`)
+	divergingB := write(t, "b2.jsonl", `{"replica":"B","seq":1,"time":"2021-09-01T10:00:01Z","op":"merge","source":"A","sourceSeq":1}
+`)
+
+	t.Run("reports converging replicas", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		diverged, err := run(out, []string{logA, convergingB}, false)
+		require.NoError(t, err)
+		require.False(t, diverged)
+		require.Equal(t, "replayed 3 operations: replicas converge\n", out.String())
+	})
+
+	t.Run("reports the operation introducing divergence", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		diverged, err := run(out, []string{divergingA, divergingB}, false)
+		require.NoError(t, err)
+		require.True(t, diverged)
+		// the re-added vertex is hidden by the later removal, only the CRDT metadata diverges
+		require.Equal(t, `replayed 4 operations: replicas diverge after operation 3:
+  {"replica":"A","seq":3,"time":"2021-09-01T10:00:00Z","op":"addVertex","key":"v1","value":"c"}
+states after merging with each other:
+  A: []
+  B: []
+`, out.String())
+	})
+
+	t.Run("returns errors for invalid logs", func(t *testing.T) {
+		_, err := run(&bytes.Buffer{}, []string{write(t, "invalid.jsonl", "{")}, false)
+		require.ErrorIs(t, err, oplog.ErrInvalidLog)
+
+		_, err = run(&bytes.Buffer{}, []string{filepath.Join(dir, "missing.jsonl")}, false)
+		require.Error(t, err)
+	})
+}
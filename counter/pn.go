@@ -0,0 +1,193 @@
+// Package counter implements counter CRDTs.
+package counter
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+const (
+	// PNKind is the CRDT kind of the PN-Counter
+	PNKind crdt.Kind = "counter.pn"
+)
+
+// NewPN initializes the PN-Counter and makes it ready for use.
+// The replica ID must be unique across all the replicas, every replica
+// contributes to the counter under its own ID.
+func NewPN(r crdt.Replica) PN {
+	return PN{
+		mutex:      &sync.Mutex{},
+		replica:    r.WithDefaults(),
+		increments: make(map[string]uint64),
+		decrements: make(map[string]uint64),
+	}
+}
+
+// PN is a state-based Positive-Negative counter implementation.
+// Every replica tracks its own increments and decrements, so concurrent updates
+// on different replicas add up instead of overwriting each other.
+// Use `NewPN` in order to initialize it before use.
+// The counter is thread-safe and can be used from several go routines.
+type PN struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is the identity of the replica the counter belongs to
+	replica crdt.Replica
+
+	// increments maps a replica ID to the sum of all its increments
+	increments map[string]uint64
+	// decrements maps a replica ID to the sum of all its decrements
+	decrements map[string]uint64
+}
+
+// Add adds `delta` to the counter, negative values decrement it.
+// Adding zero does not change the state.
+func (c PN) Add(delta int64) {
+	if delta == 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if delta >= 0 {
+		c.increments[c.replica.ID] += uint64(delta)
+		return
+	}
+	c.decrements[c.replica.ID] += uint64(-delta)
+}
+
+// Value returns the current value of the counter
+func (c PN) Value() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var value int64
+	for _, increment := range c.increments {
+		value += int64(increment)
+	}
+	for _, decrement := range c.decrements {
+		value -= int64(decrement)
+	}
+
+	return value
+}
+
+// Contributions returns the contribution of each replica to the counter value,
+// replicas contributing zero are left out
+func (c PN) Contributions() map[string]int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	contributions := make(map[string]int64, len(c.increments))
+	for replicaID, increment := range c.increments {
+		contributions[replicaID] += int64(increment)
+	}
+	for replicaID, decrement := range c.decrements {
+		contributions[replicaID] -= int64(decrement)
+	}
+	for replicaID, contribution := range contributions {
+		if contribution == 0 {
+			delete(contributions, replicaID)
+		}
+	}
+
+	return contributions
+}
+
+// Merge takes another PN-Counter as a `remote` and merges its state into itself.
+// Merging two replicas takes the maximum of increments and decrements of each replica.
+func (c PN) Merge(remote PN) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	mergeMax(c.increments, remote.increments)
+	mergeMax(c.decrements, remote.decrements)
+}
+
+// pnState is the serialized format of the PN-Counter
+type pnState struct {
+	// Increments maps a replica ID to the sum of all its increments
+	Increments map[string]uint64 `json:"increments"`
+	// Decrements maps a replica ID to the sum of all its decrements
+	Decrements map[string]uint64 `json:"decrements"`
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (c PN) Kind() crdt.Kind {
+	return PNKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (c PN) MergeCRDT(remote crdt.CRDT) error {
+	remoteCounter, isCounter := remote.(PN)
+	if !isCounter {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", c.Kind(), remote.Kind())
+	}
+	c.Merge(remoteCounter)
+	return nil
+}
+
+// Marshal implements the `crdt.CRDT` interface.
+// Zero entries are left out, they're never merged, so converged replicas have the same state.
+func (c PN) Marshal() ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return json.Marshal(pnState{
+		Increments: nonZero(c.increments),
+		Decrements: nonZero(c.decrements),
+	})
+}
+
+// Unmarshal implements the `crdt.CRDT` interface
+func (c PN) Unmarshal(data []byte) error {
+	var state pnState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal PN-Counter")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, m := range []map[string]uint64{c.increments, c.decrements} {
+		for replicaID := range m {
+			delete(m, replicaID)
+		}
+	}
+	mergeMax(c.increments, state.Increments)
+	mergeMax(c.decrements, state.Decrements)
+
+	return nil
+}
+
+// Register registers all the CRDT kinds of this package in the given registry.
+// All the CRDTs created by the registry belong to the given replica.
+func Register(r crdt.Registry, replica crdt.Replica) error {
+	return r.Register(PNKind, func() crdt.CRDT { return NewPN(replica) })
+}
+
+// nonZero returns a copy of the map without zero values
+func nonZero(m map[string]uint64) map[string]uint64 {
+	result := make(map[string]uint64, len(m))
+	for replicaID, value := range m {
+		if value != 0 {
+			result[replicaID] = value
+		}
+	}
+	return result
+}
+
+// mergeMax sets every value in `to` to the maximum of its value and the value in `from`
+func mergeMax(to, from map[string]uint64) {
+	for replicaID, value := range from {
+		if value > to[replicaID] {
+			to[replicaID] = value
+		}
+	}
+}
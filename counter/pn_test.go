@@ -0,0 +1,88 @@
+package counter
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPN(t *testing.T) {
+	t.Run("concurrent updates add up", func(t *testing.T) {
+		// Time ->
+		// A--Add(5)--Add(-2)--\---|
+		// B--Add(10)-----------\--|=> A,B = 13
+		A := NewPN(crdt.NewReplica("A"))
+		B := NewPN(crdt.NewReplica("B"))
+
+		A.Add(5)
+		A.Add(-2)
+		B.Add(10)
+
+		A.Merge(B)
+		B.Merge(A)
+
+		require.Equal(t, int64(13), A.Value())
+		require.Equal(t, int64(13), B.Value())
+		require.Equal(t, map[string]int64{"A": 3, "B": 10}, A.Contributions())
+	})
+
+	t.Run("merging is idempotent", func(t *testing.T) {
+		A := NewPN(crdt.NewReplica("A"))
+		B := NewPN(crdt.NewReplica("B"))
+
+		B.Add(1)
+		A.Merge(B)
+		A.Merge(B)
+		A.Merge(A)
+
+		require.Equal(t, int64(1), A.Value())
+	})
+
+	t.Run("survives a marshal/unmarshal round trip", func(t *testing.T) {
+		registry := crdt.NewRegistry()
+		require.NoError(t, Register(registry, crdt.NewReplica("B")))
+
+		A := NewPN(crdt.NewReplica("A"))
+		A.Add(7)
+		A.Add(-1)
+
+		data, err := crdt.Marshal(A)
+		require.NoError(t, err)
+
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+		require.Equal(t, int64(6), restored.(PN).Value())
+
+		// the restored counter contributes as its own replica
+		restored.(PN).Add(1)
+		require.Equal(t, map[string]int64{"A": 6, "B": 1}, restored.(PN).Contributions())
+	})
+
+	t.Run("zero updates do not make converged states differ", func(t *testing.T) {
+		A := NewPN(crdt.NewReplica("A"))
+		B := NewPN(crdt.NewReplica("B"))
+		C := NewPN(crdt.NewReplica("C"))
+
+		A.Add(3)
+		C.Add(0)
+		for _, pair := range [][2]PN{{B, A}, {B, C}, {A, B}, {C, B}} {
+			pair[0].Merge(pair[1])
+		}
+
+		expected, err := A.Marshal()
+		require.NoError(t, err)
+		for _, c := range []PN{B, C} {
+			actual, err := c.Marshal()
+			require.NoError(t, err)
+			require.JSONEq(t, string(expected), string(actual))
+		}
+		require.Equal(t, map[string]int64{"A": 3}, C.Contributions())
+
+		restored := NewPN(crdt.NewReplica("D"))
+		require.NoError(t, restored.Unmarshal([]byte(`{"increments":{"C":0,"A":3},"decrements":{"B":0}}`)))
+		actual, err := restored.Marshal()
+		require.NoError(t, err)
+		require.JSONEq(t, string(expected), string(actual))
+	})
+}
@@ -0,0 +1,162 @@
+// Package crdt contains the common interface of all the CRDTs in this module
+// and a registry of their kinds, so generic replication and persistence layers
+// can handle any CRDT uniformly.
+package crdt
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnknownKind occurs when a kind is not registered in the registry
+	ErrUnknownKind = errors.New("unknown CRDT kind")
+	// ErrKindAlreadyRegistered occurs when registering the same kind twice
+	ErrKindAlreadyRegistered = errors.New("CRDT kind already registered")
+	// ErrKindMismatch occurs when merging CRDTs of different kinds
+	ErrKindMismatch = errors.New("CRDT kind mismatch")
+)
+
+// Kind is a unique name of a CRDT type, e.g. `lww.set`
+type Kind string
+
+// CRDT contains the operations shared by all the CRDTs regardless of their semantics
+type CRDT interface {
+	// Kind returns the kind of the CRDT, it must be the same for all the instances of a type
+	Kind() Kind
+	// MergeCRDT takes another CRDT of the same kind as a `remote` and merges its state into itself.
+	// Returns an error with `ErrKindMismatch` cause if the `remote` has a different kind.
+	MergeCRDT(remote CRDT) error
+	// Marshal serializes the full state of the CRDT including all the metadata required for merging
+	Marshal() ([]byte, error)
+	// Unmarshal replaces the state of the CRDT with the state serialized by `Marshal`
+	Unmarshal(data []byte) error
+}
+
+// DeltaCRDT is a CRDT that can extract the part of its state with the given keys, e.g. `lww.Set` and `lww.Graph`,
+// so replication can send only the changed records instead of the full state.
+// The changed keys can be collected with `Replica.Observer`.
+type DeltaCRDT interface {
+	CRDT
+	// DeltaCRDT returns a CRDT of the same kind with only the records of the given keys including removed ones.
+	// Merging it into another replica has the same effect on these keys as merging the full state.
+	DeltaCRDT(keys []string) CRDT
+}
+
+// Factory creates a new empty CRDT of a certain kind
+type Factory func() CRDT
+
+// envelope is the serialized format of a CRDT with its kind
+type envelope struct {
+	// Kind is the kind of the serialized CRDT
+	Kind Kind `json:"kind"`
+	// State is the state produced by the CRDT's `Marshal`
+	State json.RawMessage `json:"state"`
+}
+
+// Marshal serializes the given CRDT along with its kind,
+// so it can be deserialized by `Registry.Unmarshal` without knowing the kind in advance.
+func Marshal(c CRDT) ([]byte, error) {
+	state, err := c.Marshal()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal CRDT of kind %q", c.Kind())
+	}
+
+	data, err := json.Marshal(envelope{
+		Kind:  c.Kind(),
+		State: state,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal CRDT of kind %q", c.Kind())
+	}
+
+	return data, nil
+}
+
+// NewRegistry initializes an empty CRDT registry and makes it ready for use.
+func NewRegistry() Registry {
+	return Registry{
+		mutex:     &sync.RWMutex{},
+		factories: make(map[Kind]Factory),
+	}
+}
+
+// Registry maps CRDT kinds to factories creating them.
+// Use `NewRegistry` in order to initialize it before use.
+// The registry is thread-safe and can be used from several go routines.
+type Registry struct {
+	// mutex is used for the thread-safety
+	mutex *sync.RWMutex
+
+	// factories maps a kind to the factory of this kind
+	factories map[Kind]Factory
+}
+
+// Register registers the factory for the given kind.
+// Returns `ErrKindAlreadyRegistered` if the kind has been registered before.
+func (r Registry) Register(kind Kind, factory Factory) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, registered := r.factories[kind]; registered {
+		return errors.Wrapf(ErrKindAlreadyRegistered, "failed to register kind %q", kind)
+	}
+	r.factories[kind] = factory
+
+	return nil
+}
+
+// New creates a new empty CRDT of the given kind.
+// Returns an error with `ErrUnknownKind` cause if the kind is not registered.
+func (r Registry) New(kind Kind) (CRDT, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	factory, registered := r.factories[kind]
+	if !registered {
+		return nil, errors.Wrapf(ErrUnknownKind, "failed to create CRDT of kind %q", kind)
+	}
+
+	return factory(), nil
+}
+
+// Unmarshal deserializes a CRDT serialized by `Marshal` creating it using the registered factory.
+// Returns an error with `ErrUnknownKind` cause if the serialized kind is not registered.
+func (r Registry) Unmarshal(data []byte) (CRDT, error) {
+	var e envelope
+	err := json.Unmarshal(data, &e)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal CRDT envelope")
+	}
+
+	c, err := r.New(e.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Unmarshal(e.State)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal CRDT of kind %q", e.Kind)
+	}
+
+	return c, nil
+}
+
+// Kinds returns the sorted list of all the registered kinds
+func (r Registry) Kinds() []Kind {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	kinds := make([]Kind, 0, len(r.factories))
+	for kind := range r.factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i] < kinds[j]
+	})
+
+	return kinds
+}
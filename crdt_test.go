@@ -0,0 +1,90 @@
+package crdt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const counterKind Kind = "test.counter"
+
+// counter is a trivial grow-only counter of a single replica used for testing the registry
+type counter struct {
+	value *int
+}
+
+func newCounter() CRDT {
+	return counter{value: new(int)}
+}
+
+func (c counter) Kind() Kind {
+	return counterKind
+}
+
+func (c counter) MergeCRDT(remote CRDT) error {
+	r, isCounter := remote.(counter)
+	if !isCounter {
+		return errors.Wrapf(ErrKindMismatch, "expected %q, got %q", c.Kind(), remote.Kind())
+	}
+	if *r.value > *c.value {
+		*c.value = *r.value
+	}
+	return nil
+}
+
+func (c counter) Marshal() ([]byte, error) {
+	return json.Marshal(*c.value)
+}
+
+func (c counter) Unmarshal(data []byte) error {
+	return json.Unmarshal(data, c.value)
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("creates registered kinds", func(t *testing.T) {
+		r := NewRegistry()
+		require.NoError(t, r.Register(counterKind, newCounter))
+
+		c, err := r.New(counterKind)
+		require.NoError(t, err)
+		require.Equal(t, counterKind, c.Kind())
+		require.Equal(t, []Kind{counterKind}, r.Kinds())
+	})
+
+	t.Run("returns ErrKindAlreadyRegistered when registering the same kind twice", func(t *testing.T) {
+		r := NewRegistry()
+		require.NoError(t, r.Register(counterKind, newCounter))
+
+		err := r.Register(counterKind, newCounter)
+		require.ErrorIs(t, err, ErrKindAlreadyRegistered)
+	})
+
+	t.Run("returns ErrUnknownKind for not registered kinds", func(t *testing.T) {
+		r := NewRegistry()
+
+		_, err := r.New(counterKind)
+		require.ErrorIs(t, err, ErrUnknownKind)
+
+		data, err := Marshal(newCounter())
+		require.NoError(t, err)
+		_, err = r.Unmarshal(data)
+		require.ErrorIs(t, err, ErrUnknownKind)
+	})
+
+	t.Run("unmarshals CRDTs serialized with their kind", func(t *testing.T) {
+		r := NewRegistry()
+		require.NoError(t, r.Register(counterKind, newCounter))
+
+		original := newCounter().(counter)
+		*original.value = 42
+
+		data, err := Marshal(original)
+		require.NoError(t, err)
+
+		restored, err := r.Unmarshal(data)
+		require.NoError(t, err)
+		require.Equal(t, 42, *restored.(counter).value)
+	})
+}
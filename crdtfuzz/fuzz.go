@@ -0,0 +1,363 @@
+// Package crdtfuzz provides fuzzing entry points for the deserialization and merging of the CRDT states
+// and builders of their seed corpora, so malformed and adversarial states coming from other replicas
+// can be fuzzed with go-fuzz (`go-fuzz-build -func Unmarshal`) or the native fuzzing of Go 1.18+
+// (`go test -fuzz FuzzMerge ./crdtfuzz`).
+//
+// The entry points follow the go-fuzz convention: they return 1 if the input is interesting
+// (a valid state), 0 otherwise, and panic if the input reveals a bug, e.g. a state that is accepted
+// but cannot be serialized again.
+package crdtfuzz
+
+import (
+	"bytes"
+	"crypto/sha1" // nolint:gosec // only names the corpus files like go-fuzz does
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/counter"
+	"github.com/rdner/crdt/flags"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/orset"
+	"github.com/rdner/crdt/register"
+	"github.com/rdner/crdt/sequence"
+	"github.com/rdner/crdt/sets"
+)
+
+// MergeSeparator separates the two states of a `Merge` input, see `MergeInput`.
+// Serialized states never contain it, new lines in values are escaped.
+const MergeSeparator = '\n'
+
+// NewRegistry returns a registry of all the CRDT kinds of this module, the CRDTs it creates
+// belong to the given replica. `ormap.Map` is not registered, its values are defined by an application schema.
+func NewRegistry(r crdt.Replica) (crdt.Registry, error) {
+	registry := crdt.NewRegistry()
+	err := lww.Register(registry, r)
+	if err != nil {
+		return crdt.Registry{}, err
+	}
+	for _, registerKinds := range []func(crdt.Registry, crdt.Replica) error{
+		counter.Register,
+		orset.Register,
+		sets.Register,
+		register.Register,
+		sequence.Register,
+		flags.Register,
+	} {
+		err = registerKinds(registry, r)
+		if err != nil {
+			return crdt.Registry{}, err
+		}
+	}
+	return registry, nil
+}
+
+// Unmarshal deserializes a CRDT state serialized by `crdt.Marshal`.
+// It panics if the state is accepted but cannot be serialized and deserialized again.
+func Unmarshal(data []byte) int {
+	registry := newRegistry()
+	c, err := registry.Unmarshal(data)
+	if err != nil {
+		return 0
+	}
+	roundTrip(registry, c)
+	return 1
+}
+
+// Merge deserializes the two CRDT states of the input (see `MergeInput`) and merges them in both directions.
+// It panics if merging CRDTs of different kinds does not fail with `crdt.ErrKindMismatch`
+// or a merged state cannot be serialized and deserialized again.
+func Merge(data []byte) int {
+	i := bytes.IndexByte(data, MergeSeparator)
+	if i == -1 {
+		return 0
+	}
+
+	registry := newRegistry()
+	states := [][]byte{data[:i], data[i+1:]}
+	crdts := make([]crdt.CRDT, 0, len(states))
+	for _, state := range states {
+		c, err := registry.Unmarshal(state)
+		if err != nil {
+			return 0
+		}
+		crdts = append(crdts, c)
+	}
+
+	for _, order := range [][2]int{{0, 1}, {1, 0}} {
+		local, err := registry.Unmarshal(states[order[0]])
+		if err != nil {
+			panic(fmt.Sprintf("the state was accepted once and rejected then: %s", err))
+		}
+		remote := crdts[order[1]]
+		err = local.MergeCRDT(remote)
+		if local.Kind() != remote.Kind() {
+			if !errors.Is(err, crdt.ErrKindMismatch) {
+				panic(fmt.Sprintf("merging %q into %q did not fail with the kind mismatch: %v", remote.Kind(), local.Kind(), err))
+			}
+			return 0
+		}
+		if err != nil {
+			return 0
+		}
+		roundTrip(registry, local)
+	}
+	return 1
+}
+
+// MergeInput joins two serialized states into an input of `Merge`
+func MergeInput(local, remote []byte) []byte {
+	input := make([]byte, 0, len(local)+len(remote)+1)
+	input = append(input, local...)
+	input = append(input, MergeSeparator)
+	return append(input, remote...)
+}
+
+// roundTrip panics if the CRDT cannot be serialized and deserialized again
+func roundTrip(registry crdt.Registry, c crdt.CRDT) {
+	data, err := crdt.Marshal(c)
+	if err != nil {
+		panic(fmt.Sprintf("accepted state of %q cannot be serialized: %s", c.Kind(), err))
+	}
+	_, err = registry.Unmarshal(data)
+	if err != nil {
+		panic(fmt.Sprintf("serialized state of %q cannot be deserialized: %s\n%s", c.Kind(), err, data))
+	}
+}
+
+// newRegistry returns the registry of the fuzzing entry points
+func newRegistry() crdt.Registry {
+	registry, err := NewRegistry(crdt.NewReplica("crdtfuzz"))
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// Corpus returns valid serialized states of all the CRDT kinds of this module in all their formats,
+// a seed corpus for `Unmarshal`
+func Corpus() ([][]byte, error) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	newReplica := func(id string) crdt.Replica {
+		virtual := clock.NewVirtual(start)
+		return crdt.Replica{
+			ID: id,
+			Clock: clock.Func(func() time.Time {
+				virtual.Advance(time.Millisecond)
+				return virtual.Now()
+			}),
+		}
+	}
+
+	var corpus [][]byte
+	seen := make(map[string]bool)
+	add := func(c crdt.CRDT, f crdt.Format) error {
+		data, err := crdt.MarshalFormat(c, f)
+		if err != nil {
+			return err
+		}
+		// formats of small states can be the same
+		if !seen[string(data)] {
+			seen[string(data)] = true
+			corpus = append(corpus, data)
+		}
+		return nil
+	}
+
+	lwwSets := []lww.Set{lww.NewSet(newReplica("A"))}
+	for _, r := range []crdt.Replica{newReplica("A"), withMultiValue(newReplica("B"))} {
+		s := lww.NewSet(r)
+		s.Add(lww.IDElement("e1"))
+		s.Add(lww.IDElement("e2"))
+		s.Add(lww.IDElement("e2"))
+		s.Remove("e1")
+		s.Remove("missing")
+		lwwSets = append(lwwSets, s)
+	}
+	for _, s := range lwwSets {
+		err := add(s, crdt.FormatDefault)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	graphs := []lww.Graph{lww.NewGraph(newReplica("A"))}
+	compressed := newReplica("B")
+	compressed.Compression.Threshold = 16
+	for _, r := range []crdt.Replica{newReplica("A"), compressed, withMultiValue(newReplica("C"))} {
+		g, err := exampleGraph(r)
+		if err != nil {
+			return nil, err
+		}
+		graphs = append(graphs, g)
+	}
+	for _, g := range graphs {
+		for _, f := range []crdt.Format{crdt.FormatV1, crdt.FormatV2, crdt.FormatDual} {
+			err := add(g, f)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, id := range []string{"A", "B"} {
+		c := counter.NewPN(newReplica(id))
+		c.Add(5)
+		c.Add(-2)
+		err := add(c, crdt.FormatDefault)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	others, err := exampleCRDTs(newReplica("A"))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range others {
+		err = add(c, crdt.FormatDefault)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return corpus, nil
+}
+
+// MergeCorpus returns the inputs of `Merge` joining every pair of the `Corpus` states, a seed corpus for `Merge`
+func MergeCorpus() ([][]byte, error) {
+	states, err := Corpus()
+	if err != nil {
+		return nil, err
+	}
+	corpus := make([][]byte, 0, len(states)*len(states))
+	for _, local := range states {
+		for _, remote := range states {
+			corpus = append(corpus, MergeInput(local, remote))
+		}
+	}
+	return corpus, nil
+}
+
+// WriteCorpus writes every input of the corpus into its own file of the directory like go-fuzz does,
+// the directory is created if needed
+func WriteCorpus(dir string, corpus [][]byte) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create corpus directory %q", dir)
+	}
+	for _, input := range corpus {
+		sum := sha1.Sum(input) // nolint:gosec // only names the file
+		path := filepath.Join(dir, hex.EncodeToString(sum[:]))
+		err = ioutil.WriteFile(path, input, 0o600)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write corpus file %q", path)
+		}
+	}
+	return nil
+}
+
+// exampleGraph returns a graph using all the features of the serialized graph state
+func exampleGraph(r crdt.Replica) (lww.Graph, error) {
+	g := lww.NewGraph(r)
+	for _, v := range []lww.Vertex{
+		{Key: "v1", Value: "a value long enough to be compressed"},
+		{Key: "v2", Value: "multi\nline"},
+		{Key: "v3"},
+	} {
+		err := g.AddVertex(v)
+		if err != nil {
+			return lww.Graph{}, err
+		}
+	}
+	err := g.UpdateVertex(lww.Vertex{Key: "v2", Value: "updated"})
+	if err != nil {
+		return lww.Graph{}, err
+	}
+	err = g.AddEdge("v1", "v2")
+	if err != nil {
+		return lww.Graph{}, err
+	}
+	err = g.AddWeightedEdge("v2", lww.Edge{To: "v3", Weight: 3, Label: "next", Attributes: map[string]string{"color": "red"}})
+	if err != nil {
+		return lww.Graph{}, err
+	}
+	err = g.AddEdge("v3", "v1")
+	if err != nil {
+		return lww.Graph{}, err
+	}
+	err = g.UpdateEdgeWeight("v2", "v3", 2)
+	if err != nil {
+		return lww.Graph{}, err
+	}
+	err = g.RemoveEdge("v3", "v1")
+	if err != nil {
+		return lww.Graph{}, err
+	}
+	return g, g.RemoveVertex("v3")
+}
+
+// withMultiValue returns the replica keeping the values overwritten by concurrent writes
+func withMultiValue(r crdt.Replica) crdt.Replica {
+	r.MultiValue = true
+	return r
+}
+
+// exampleCRDTs returns a non-empty state of every CRDT kind of this module outside of `lww` and `counter`
+func exampleCRDTs(r crdt.Replica) ([]crdt.CRDT, error) {
+	set := orset.NewSet(r)
+	set.Add(lww.IDElement("e1"))
+	set.Add(lww.IDElement("e2"))
+	set.Remove("e1")
+
+	gset := sets.NewGSet(r)
+	gset.Add(lww.IDElement("e1"))
+
+	twoPhase := sets.NewTwoPhaseSet(r)
+	err := twoPhase.Add(lww.IDElement("e1"))
+	if err != nil {
+		return nil, err
+	}
+	err = twoPhase.Add(lww.IDElement("e2"))
+	if err != nil {
+		return nil, err
+	}
+	err = twoPhase.Remove("e1")
+	if err != nil {
+		return nil, err
+	}
+
+	lwwRegister := register.NewLWW(r)
+	lwwRegister.Set("value")
+
+	mvRegister := register.NewMV(r)
+	mvRegister.Set(map[string]interface{}{"key": "value"})
+
+	rga := sequence.NewRGA(r)
+	for i, v := range []string{"a", "b", "c"} {
+		_, err = rga.InsertAt(i, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = rga.Remove(1)
+	if err != nil {
+		return nil, err
+	}
+
+	ew := flags.NewEW(r)
+	ew.Enable()
+	ew.Disable()
+	ew.Enable()
+
+	dw := flags.NewDW(r)
+	dw.Enable()
+
+	return []crdt.CRDT{set, gset, twoPhase, lwwRegister, mvRegister, rga, ew, dw}, nil
+}
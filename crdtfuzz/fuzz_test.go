@@ -0,0 +1,80 @@
+package crdtfuzz
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshal(t *testing.T) {
+	corpus, err := Corpus()
+	require.NoError(t, err)
+	require.Len(t, corpus, 24)
+
+	for _, input := range corpus {
+		require.Equal(t, 1, Unmarshal(input), string(input))
+	}
+	for _, input := range []string{``, `{`, `null`, `{"kind":"unknown","state":{}}`, `{"kind":"lww.graph","state":[]}`} {
+		require.Equal(t, 0, Unmarshal([]byte(input)), input)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	corpus, err := Corpus()
+	require.NoError(t, err)
+	registry := newRegistry()
+
+	for _, local := range corpus {
+		for _, remote := range corpus {
+			l, err := registry.Unmarshal(local)
+			require.NoError(t, err)
+			r, err := registry.Unmarshal(remote)
+			require.NoError(t, err)
+
+			expected := 1
+			if l.Kind() != r.Kind() {
+				expected = 0
+			}
+			require.Equal(t, expected, Merge(MergeInput(local, remote)))
+		}
+	}
+	require.Equal(t, 0, Merge(corpus[0]))
+	require.Equal(t, 0, Merge(MergeInput(corpus[0], []byte("{"))))
+}
+
+func TestMergeCorpus(t *testing.T) {
+	corpus, err := MergeCorpus()
+	require.NoError(t, err)
+	require.Len(t, corpus, 24*24)
+	for _, input := range corpus {
+		require.Equal(t, 1, strings.Count(string(input), string(MergeSeparator)))
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, WriteCorpus(dir, corpus))
+	require.NoError(t, WriteCorpus(dir, corpus))
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, len(corpus))
+}
+
+func TestNewRegistry(t *testing.T) {
+	registry, err := NewRegistry(crdt.NewReplica("A"))
+	require.NoError(t, err)
+	require.Equal(t, []crdt.Kind{
+		"counter.pn",
+		"flags.dw",
+		"flags.ew",
+		"lww.graph",
+		"lww.set",
+		"orset.set",
+		"register.lww",
+		"register.mv",
+		"sequence.rga",
+		"sets.gset",
+		"sets.twophase",
+	}, registry.Kinds())
+}
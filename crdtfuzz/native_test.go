@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package crdtfuzz
+
+import (
+	"testing"
+)
+
+func FuzzUnmarshal(f *testing.F) {
+	corpus, err := Corpus()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, input := range corpus {
+		f.Add(input)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Unmarshal(data)
+	})
+}
+
+func FuzzMerge(f *testing.F) {
+	corpus, err := MergeCorpus()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, input := range corpus {
+		f.Add(input)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Merge(data)
+	})
+}
@@ -0,0 +1,77 @@
+// Package crdttest provides helpers for testing applications built on the CRDTs of this module.
+package crdttest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+// PollInterval is how often `WaitConverged` syncs and compares the replicas
+const PollInterval = 10 * time.Millisecond
+
+// WaitConverged merges all the given graphs with each other and compares the hashes of their canonical forms
+// (see `lww.Graph.CanonicalJSON`) until they are equal, so tests with concurrent writers or background
+// replication can wait for the replicas to converge. The graphs can be changed concurrently.
+//
+// If the graphs have not converged within `timeout`, the test fails with a diff of the canonical forms
+// of the first graph and the first graph that differs from it.
+func WaitConverged(t testing.TB, timeout time.Duration, graphs ...lww.Graph) {
+	t.Helper()
+	require.True(t, len(graphs) > 1, "2 and more graphs can be compared")
+
+	deadline := time.Now().Add(timeout)
+	for {
+		// merging snapshots, so the graphs can be changed concurrently
+		snapshots := make([]lww.Graph, 0, len(graphs))
+		for _, g := range graphs {
+			buf := bytes.NewBuffer(nil)
+			require.NoError(t, g.Snapshot(buf))
+			snapshot, err := lww.RestoreGraph(crdt.NewReplica("crdttest"), buf)
+			require.NoError(t, err)
+			snapshots = append(snapshots, snapshot)
+		}
+		for i, to := range graphs {
+			for j, from := range snapshots {
+				if i != j {
+					to.Merge(from)
+				}
+			}
+		}
+
+		states := make([][]byte, 0, len(graphs))
+		for _, g := range graphs {
+			state, err := g.CanonicalJSON()
+			require.NoError(t, err)
+			states = append(states, state)
+		}
+
+		diverged := divergedState(states)
+		if diverged == -1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			require.Equal(t, string(states[0]), string(states[diverged]),
+				"graphs #0 and #%d have not converged within %s", diverged, timeout)
+			return
+		}
+		time.Sleep(PollInterval)
+	}
+}
+
+// divergedState returns the index of the first state which hash differs from the hash of the first state,
+// -1 if all the states are equal
+func divergedState(states [][]byte) int {
+	first := sha256.Sum256(states[0])
+	for i, state := range states[1:] {
+		if sha256.Sum256(state) != first {
+			return i + 1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,100 @@
+package crdttest
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a `testing.TB` recording the failures instead of failing the test
+type recorder struct {
+	testing.TB
+	mutex  sync.Mutex
+	errors []string
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) FailNow() {
+	r.mutex.Lock()
+	r.failed = true
+	r.mutex.Unlock()
+	runtime.Goexit()
+}
+
+// run calls `f` with the recorder in its own goroutine, so `FailNow` can stop it
+func (r *recorder) run(f func(t testing.TB)) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(r)
+	}()
+	<-done
+}
+
+func TestWaitConverged(t *testing.T) {
+	t.Run("syncs the graphs until they converge", func(t *testing.T) {
+		a := lww.NewGraph(crdt.NewReplica("A"))
+		b := lww.NewGraph(crdt.NewReplica("B"))
+		c := lww.NewGraph(crdt.NewReplica("C"))
+		require.NoError(t, a.AddVertex(lww.Vertex{Key: "v1"}))
+		require.NoError(t, b.AddVertex(lww.Vertex{Key: "v2"}))
+		require.NoError(t, c.AddVertex(lww.Vertex{Key: "v3"}))
+
+		// a concurrent writer keeps changing one of the graphs for a while
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 5; i++ {
+				_ = c.AddVertex(lww.Vertex{Key: fmt.Sprintf("w%d", i)})
+				time.Sleep(PollInterval)
+			}
+		}()
+		WaitConverged(t, time.Second, a, b, c)
+		<-done
+
+		WaitConverged(t, time.Second, a, b, c)
+		list, err := a.List()
+		require.NoError(t, err)
+		require.Len(t, list, 8)
+	})
+
+	t.Run("fails with a diff if the graphs do not converge", func(t *testing.T) {
+		// replicas normalizing keys differently never converge
+		lower := crdt.NewReplica("A")
+		lower.KeyNormalizer = crdt.LowerCase
+		a := lww.NewGraph(lower)
+		b := lww.NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, b.AddVertex(lww.Vertex{Key: "Vertex"}))
+
+		r := &recorder{TB: t}
+		r.run(func(t testing.TB) {
+			WaitConverged(t, 50*time.Millisecond, a, b)
+		})
+		require.True(t, r.failed)
+		require.Len(t, r.errors, 1)
+		require.Contains(t, r.errors[0], "graphs #0 and #1 have not converged within 50ms")
+		require.Contains(t, r.errors[0], "Diff:")
+	})
+
+	t.Run("requires at least 2 graphs", func(t *testing.T) {
+		r := &recorder{TB: t}
+		r.run(func(t testing.TB) {
+			WaitConverged(t, time.Second, lww.NewGraph(crdt.NewReplica("A")))
+		})
+		require.True(t, r.failed)
+	})
+}
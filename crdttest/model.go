@@ -0,0 +1,236 @@
+package crdttest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+// ModelAction is the type of a step of the model trace
+type ModelAction string
+
+const (
+	// AddVertex adds or updates a vertex
+	AddVertex ModelAction = "AddVertex"
+	// RemoveVertex removes a vertex
+	RemoveVertex ModelAction = "RemoveVertex"
+	// AddEdge adds or updates an edge
+	AddEdge ModelAction = "AddEdge"
+	// RemoveEdge removes an edge
+	RemoveEdge ModelAction = "RemoveEdge"
+	// Merge merges the state of one replica into another one
+	Merge ModelAction = "Merge"
+)
+
+// ModelStep is a step of a simulation reduced to the last-writer-wins semantics: the written key
+// with the timestamp and the replica, or a merge. Values are not modeled.
+type ModelStep struct {
+	// Action is the type of the step
+	Action ModelAction
+	// Replica is the index of the replica the step changed
+	Replica int
+	// From is the index of the merged replica for `Merge`, -1 otherwise
+	From int
+	// Key is the vertex key or the key of the vertex the edge starts from, empty for `Merge`
+	Key string
+	// To is the key of the vertex the edge points to, empty for vertex steps and `Merge`
+	To string
+	// Time is the timestamp of the write in nanoseconds since the start of the simulation,
+	// it's negative when a skewed clock is behind the start
+	Time int64
+	// Rank is the position of the writing replica ID among the sorted replica IDs,
+	// it breaks the ties of colliding timestamps like the replica ID does
+	Rank int
+	// Check is `true` if the state below is the state of the replica after the step.
+	// It's `false` for all but the last write of an operation writing several keys.
+	Check bool
+	// Vertices are the keys of the vertices of the replica after the step
+	Vertices []string
+	// Edges are the edges of the vertices of the replica after the step as `[from, to]` pairs
+	Edges [][2]string
+}
+
+// modelTrace collects the model steps of a simulation
+type modelTrace struct {
+	// start is the start of the simulation the timestamps are relative to
+	start time.Time
+	// ranks maps a replica ID to its rank
+	ranks map[string]int
+	// pending are the local mutations of the current event
+	pending []crdt.Mutation
+	// steps are the recorded steps
+	steps []ModelStep
+}
+
+// newModelTrace returns a trace of the replicas with the given IDs
+func newModelTrace(start time.Time, ids []string) *modelTrace {
+	sorted := make([]string, len(ids))
+	copy(sorted, ids)
+	sort.Strings(sorted)
+
+	ranks := make(map[string]int, len(sorted))
+	for i, id := range sorted {
+		ranks[id] = i
+	}
+	return &modelTrace{start: start, ranks: ranks}
+}
+
+// begin starts collecting the mutations of an event, the changes made between the events are not modeled
+func (m *modelTrace) begin() {
+	m.pending = nil
+}
+
+// observe collects the local mutations of the current event
+func (m *modelTrace) observe(mutation crdt.Mutation) {
+	if mutation.Source == crdt.SourceLocal {
+		m.pending = append(m.pending, mutation)
+	}
+}
+
+// operation records the steps of the local mutations of an operation of the replica
+func (m *modelTrace) operation(replica int, g lww.Graph) {
+	pending := m.pending
+	m.pending = nil
+	if len(pending) == 0 {
+		return
+	}
+
+	vertices, edges := modelState(g)
+	for i, mutation := range pending {
+		step := ModelStep{
+			Replica: replica,
+			From:    -1,
+			Key:     mutation.Key,
+			To:      mutation.AdjacentKey,
+			Time:    mutation.Timestamp.Sub(m.start).Nanoseconds(),
+			Rank:    m.ranks[mutation.Replica],
+		}
+		switch {
+		case mutation.AdjacentKey != "" && mutation.Removal:
+			step.Action = RemoveEdge
+		case mutation.AdjacentKey != "":
+			step.Action = AddEdge
+		case mutation.Removal:
+			step.Action = RemoveVertex
+		default:
+			step.Action = AddVertex
+		}
+		if i == len(pending)-1 {
+			step.Check, step.Vertices, step.Edges = true, vertices, edges
+		}
+		m.steps = append(m.steps, step)
+	}
+}
+
+// merge records the merge of the replica `from` into the replica `to`
+func (m *modelTrace) merge(to, from int, g lww.Graph) {
+	// the merged mutations are part of the merge step
+	m.pending = nil
+	vertices, edges := modelState(g)
+	m.steps = append(m.steps, ModelStep{
+		Action:   Merge,
+		Replica:  to,
+		From:     from,
+		Check:    true,
+		Vertices: vertices,
+		Edges:    edges,
+	})
+}
+
+// modelState returns the sorted vertex keys and edges of the graph
+func modelState(g lww.Graph) (vertices []string, edges [][2]string) {
+	list, err := g.List()
+	if err != nil {
+		// the simulated values are never compressed, so the list cannot fail
+		panic(err)
+	}
+
+	vertices = make([]string, 0, len(list))
+	edges = [][2]string{}
+	for _, v := range list {
+		vertices = append(vertices, v.Key)
+		for _, toKey := range v.AdjacentKeys {
+			edges = append(edges, [2]string{v.Key, toKey})
+		}
+	}
+	sort.Strings(vertices)
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+	return vertices, edges
+}
+
+// ModelSteps returns the steps of the simulation reduced to the last-writer-wins semantics in order
+func (s Simulation) ModelSteps() []ModelStep {
+	steps := make([]ModelStep, len(s.model.steps))
+	copy(steps, s.model.steps)
+	return steps
+}
+
+// WriteTLA writes the model steps as a TLA+ module with the given name for the trace validation
+// of the `LWWGraphTrace` specification (see `crdttest/tla`): the module instantiates the specification
+// with the trace, TLC checks it with `INIT Init`, `NEXT Next` and `INVARIANT Consistent`.
+// A violated invariant means a replica state differs from the state the specification computes.
+func (s Simulation) WriteTLA(w io.Writer, module string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "---- MODULE %s ----\n", module)
+	fmt.Fprintf(bw, "\\* simulation trace with seed %d, generated by crdttest\n", s.cfg.Seed)
+	fmt.Fprintf(bw, "EXTENDS Integers, Sequences\n\n")
+	fmt.Fprintf(bw, "VARIABLES i, state\n\n")
+	fmt.Fprintf(bw, "TraceData == <<\n")
+	for i, step := range s.model.steps {
+		separator := ","
+		if i == len(s.model.steps)-1 {
+			separator = ""
+		}
+		fmt.Fprintf(bw, "  %s%s\n", tlaStep(step), separator)
+	}
+	fmt.Fprintf(bw, ">>\n\n")
+	fmt.Fprintf(bw, "INSTANCE LWWGraphTrace WITH Trace <- TraceData, Replicas <- %d, BiasRemove <- %s\n",
+		len(s.graphs), tlaBool(s.cfg.Replica.Bias == crdt.BiasRemove))
+	fmt.Fprintf(bw, "====\n")
+
+	err := bw.Flush()
+	if err != nil {
+		return errors.Wrap(err, "failed to write the TLA+ trace")
+	}
+	return nil
+}
+
+// tlaStep returns the TLA+ record of the step
+func tlaStep(step ModelStep) string {
+	vertices := make([]string, 0, len(step.Vertices))
+	for _, key := range step.Vertices {
+		vertices = append(vertices, strconv.Quote(key))
+	}
+	edges := make([]string, 0, len(step.Edges))
+	for _, edge := range step.Edges {
+		edges = append(edges, "<<"+strconv.Quote(edge[0])+", "+strconv.Quote(edge[1])+">>")
+	}
+
+	return fmt.Sprintf(
+		"[action |-> %q, replica |-> %d, from |-> %d, key |-> %s, to |-> %s, time |-> %d, rank |-> %d, "+
+			"check |-> %s, vertices |-> {%s}, edges |-> {%s}]",
+		step.Action, step.Replica, step.From, strconv.Quote(step.Key), strconv.Quote(step.To), step.Time, step.Rank,
+		tlaBool(step.Check), strings.Join(vertices, ", "), strings.Join(edges, ", "),
+	)
+}
+
+// tlaBool returns the TLA+ boolean
+func tlaBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
@@ -0,0 +1,165 @@
+package crdttest
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+// write is the timestamp and the rank of a modeled write
+type write struct {
+	time int64
+	rank int
+}
+
+// newer returns `true` if the write wins over the other one
+func (w write) newer(other write) bool {
+	return w.time > other.time || (w.time == other.time && w.rank > other.rank)
+}
+
+// modelReplica is the state of a replica in the `LWWGraphTrace` specification
+type modelReplica struct {
+	vadd, vrem map[string]write
+	eadd, erem map[[2]string]write
+}
+
+func newModelReplica() *modelReplica {
+	return &modelReplica{
+		vadd: make(map[string]write),
+		vrem: make(map[string]write),
+		eadd: make(map[[2]string]write),
+		erem: make(map[[2]string]write),
+	}
+}
+
+// state returns the sorted vertices and edges of the replica like the specification computes them
+func (r *modelReplica) state(biasRemove bool) (vertices []string, edges [][2]string) {
+	removed := func(add, rem write, isRemoved bool) bool {
+		if !isRemoved {
+			return false
+		}
+		if biasRemove {
+			return rem.time >= add.time
+		}
+		return rem.time > add.time
+	}
+
+	live := make(map[string]bool)
+	vertices = []string{}
+	for key, add := range r.vadd {
+		rem, isRemoved := r.vrem[key]
+		if !removed(add, rem, isRemoved) {
+			live[key] = true
+			vertices = append(vertices, key)
+		}
+	}
+	edges = [][2]string{}
+	for edge, add := range r.eadd {
+		rem, isRemoved := r.erem[edge]
+		if live[edge[0]] && !removed(add, rem, isRemoved) {
+			edges = append(edges, edge)
+		}
+	}
+
+	sort.Strings(vertices)
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i][0] < edges[j][0] || (edges[i][0] == edges[j][0] && edges[i][1] < edges[j][1])
+	})
+	return vertices, edges
+}
+
+// replay applies the steps to the model replicas checking every recorded state like the specification does
+func replay(t *testing.T, steps []ModelStep, replicas int, biasRemove bool) {
+	t.Helper()
+	state := make([]*modelReplica, replicas)
+	for i := range state {
+		state[i] = newModelReplica()
+	}
+	mergeVertices := func(local, remote map[string]write) {
+		for key, w := range remote {
+			if current, exists := local[key]; !exists || w.newer(current) {
+				local[key] = w
+			}
+		}
+	}
+	mergeEdges := func(local, remote map[[2]string]write) {
+		for edge, w := range remote {
+			if current, exists := local[edge]; !exists || w.newer(current) {
+				local[edge] = w
+			}
+		}
+	}
+
+	for i, step := range steps {
+		r := state[step.Replica]
+		w := write{time: step.Time, rank: step.Rank}
+		switch step.Action {
+		case AddVertex:
+			r.vadd[step.Key] = w
+		case RemoveVertex:
+			r.vrem[step.Key] = w
+		case AddEdge:
+			r.eadd[[2]string{step.Key, step.To}] = w
+		case RemoveEdge:
+			r.erem[[2]string{step.Key, step.To}] = w
+		case Merge:
+			remote := state[step.From]
+			mergeVertices(r.vadd, remote.vadd)
+			mergeVertices(r.vrem, remote.vrem)
+			mergeEdges(r.eadd, remote.eadd)
+			mergeEdges(r.erem, remote.erem)
+		}
+
+		if !step.Check {
+			continue
+		}
+		vertices, edges := r.state(biasRemove)
+		require.Equal(t, step.Vertices, vertices, "vertices after step %d", i)
+		require.Equal(t, step.Edges, edges, "edges after step %d", i)
+	}
+}
+
+func TestModelTrace(t *testing.T) {
+	for name, bias := range map[string]crdt.Bias{"add": crdt.BiasAdd, "remove": crdt.BiasRemove} {
+		cfg := SimulationConfig{
+			Seed:    7,
+			MaxStep: time.Millisecond,
+			MaxSkew: time.Millisecond,
+			Replica: crdt.Replica{Bias: bias},
+		}
+
+		t.Run("the recorded states follow the specified semantics with the "+name+" bias", func(t *testing.T) {
+			s := NewSimulation(cfg)
+			s.Run(1000, GraphOperations(5)...)
+			s.Sync()
+
+			steps := s.ModelSteps()
+			require.NotEmpty(t, steps)
+			require.Equal(t, Merge, steps[len(steps)-1].Action)
+			replay(t, steps, DefaultReplicas, bias == crdt.BiasRemove)
+		})
+	}
+
+	t.Run("writes a TLA+ module with the trace", func(t *testing.T) {
+		s := NewSimulation(SimulationConfig{Seed: 1, Replicas: 2, SyncRate: -1})
+		s.Run(2, GraphOperations(1)[:1]...)
+		s.Sync()
+
+		var buf bytes.Buffer
+		require.NoError(t, s.WriteTLA(&buf, "SimTrace"))
+		module := buf.String()
+		require.True(t, strings.HasPrefix(module, "---- MODULE SimTrace ----\n"))
+		require.Contains(t, module,
+			`[action |-> "AddVertex", replica |-> `)
+		require.Contains(t, module,
+			`[action |-> "Merge", replica |-> 0, from |-> 1, key |-> "", to |-> "", time |-> 0, rank |-> 0, `+
+				`check |-> TRUE, vertices |-> {"v0"}, edges |-> {}]`)
+		require.Contains(t, module, "INSTANCE LWWGraphTrace WITH Trace <- TraceData, Replicas <- 2, BiasRemove <- FALSE\n")
+		require.True(t, strings.HasSuffix(module, "====\n"))
+	})
+}
@@ -0,0 +1,378 @@
+package crdttest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// ErrPropertyViolated occurs when merging the replicas of a CRDT is not commutative, associative or idempotent,
+	// or the replicas do not converge regardless of the merge order
+	ErrPropertyViolated = errors.New("CRDT property violated")
+)
+
+const (
+	// DefaultPropertyEvents is the number of events generating the replica states if not configured
+	DefaultPropertyEvents = 200
+	// DefaultPropertyChecks is the number of random combinations of replicas every property is checked on if not configured
+	DefaultPropertyChecks = 20
+)
+
+// StateOperation is a named change the property checks apply to a random replica
+type StateOperation struct {
+	// Name identifies the operation in the trace
+	Name string
+	// Apply changes the replica, it must use only `random` as a source of randomness,
+	// so the checks can be replayed from the seed. Returned errors are recorded in the trace.
+	Apply func(c crdt.CRDT, random *rand.Rand) error
+}
+
+// Subject describes the CRDT (or a composition of CRDTs) the properties are checked on
+type Subject struct {
+	// New creates an empty replica, the ID and the clock of the replica are set by the checks
+	New func(r crdt.Replica) crdt.CRDT
+	// Operations are the changes applied to random replicas
+	Operations []StateOperation
+	// Equal returns `true` if both replicas have the same state, merging one into the other must change nothing
+	Equal func(a, b crdt.CRDT) (bool, error)
+}
+
+// PropertyConfig contains the settings of `VerifyProperties`
+type PropertyConfig struct {
+	// Seed initializes the generator of operations and merge orders,
+	// checks with the same seed, settings and subject replay identically, so a failing seed reproduces the failure
+	Seed int64
+	// Replicas is the number of replicas, `DefaultReplicas` if zero
+	Replicas int
+	// Events is the number of operations and syncs generating the replica states, `DefaultPropertyEvents` if zero
+	Events int
+	// Checks is the number of random combinations of replicas every property is checked on,
+	// `DefaultPropertyChecks` if zero
+	Checks int
+	// MaxStep is the maximum virtual time between two events, `DefaultMaxStep` if zero.
+	// Events can happen at the same virtual time, so colliding timestamps are generated too.
+	MaxStep time.Duration
+	// SyncRate is the share of events that merge the state of one replica into another one,
+	// so the replicas share a part of their history. `DefaultSyncRate` if zero, a negative rate disables syncing.
+	SyncRate float64
+	// Replica is the template of the replica policies, the ID and the clock are set by the checks
+	Replica crdt.Replica
+}
+
+// CheckProperties fails the test if `VerifyProperties` finds a violated property
+func CheckProperties(t testing.TB, subject Subject, cfg PropertyConfig) {
+	t.Helper()
+	require.NoError(t, VerifyProperties(subject, cfg))
+}
+
+// VerifyProperties generates replicas of the subject with random operations and syncs between them
+// and checks that merging their states is
+//   - commutative: `a ⊔ b = b ⊔ a`,
+//   - associative: `(a ⊔ b) ⊔ c = a ⊔ (b ⊔ c)`,
+//   - idempotent: `a ⊔ a = a`,
+//
+// and that all the replicas converge to the same state when merged in any order.
+// The replicas are merged through their serialized state (`Marshal` and `Unmarshal`), like real replicas are.
+//
+// Returns an error with `ErrPropertyViolated` cause containing the seed and the trace of the events
+// if a property does not hold.
+func VerifyProperties(subject Subject, cfg PropertyConfig) error {
+	if cfg.Replicas <= 0 {
+		cfg.Replicas = DefaultReplicas
+	}
+	if cfg.Events <= 0 {
+		cfg.Events = DefaultPropertyEvents
+	}
+	if cfg.Checks <= 0 {
+		cfg.Checks = DefaultPropertyChecks
+	}
+	if cfg.MaxStep <= 0 {
+		cfg.MaxStep = DefaultMaxStep
+	}
+	if cfg.SyncRate == 0 {
+		cfg.SyncRate = DefaultSyncRate
+	}
+
+	p := &properties{
+		subject: subject,
+		cfg:     cfg,
+		// nolint:gosec // the checks must be reproducible, not cryptographically secure
+		random: rand.New(rand.NewSource(cfg.Seed)),
+		clock:  clock.NewVirtual(DefaultStart),
+	}
+	for i := 0; i < cfg.Replicas; i++ {
+		p.replicas = append(p.replicas, p.newReplica(fmt.Sprintf("replica-%d", i)))
+	}
+
+	err := p.generate()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < cfg.Checks; i++ {
+		for _, check := range []func() error{p.idempotent, p.commutative, p.associative, p.convergent} {
+			err := check()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Replicate merges the state of every given CRDT into every other one, so they converge
+func Replicate(crdts ...crdt.CRDT) error {
+	for i, to := range crdts {
+		for j, from := range crdts {
+			if i == j {
+				continue
+			}
+			err := to.MergeCRDT(from)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// properties is a single run of `VerifyProperties`
+type properties struct {
+	subject Subject
+	cfg     PropertyConfig
+	// random is the only source of randomness
+	random *rand.Rand
+	// clock is the virtual time of all the replicas
+	clock clock.Virtual
+	// replicas are the generated replicas
+	replicas []crdt.CRDT
+	// trace records every event
+	trace []string
+}
+
+// newReplica returns an empty replica of the subject with the given ID running on the virtual time
+func (p *properties) newReplica(id string) crdt.CRDT {
+	r := p.cfg.Replica
+	r.ID = id
+	r.Clock = p.clock
+	return p.subject.New(r)
+}
+
+// generate applies random operations and syncs to the replicas
+func (p *properties) generate() error {
+	for i := 0; i < p.cfg.Events; i++ {
+		p.clock.Advance(time.Duration(p.random.Int63n(int64(p.cfg.MaxStep) + 1)))
+
+		if len(p.replicas) > 1 && (len(p.subject.Operations) == 0 || p.random.Float64() < p.cfg.SyncRate) {
+			from := p.random.Intn(len(p.replicas))
+			to := (from + 1 + p.random.Intn(len(p.replicas)-1)) % len(p.replicas)
+			merged, err := p.merge(p.replicas[to], p.replicas[from])
+			if err != nil {
+				return err
+			}
+			p.replicas[to] = merged
+			p.record("replica-%d <- replica-%d: sync", to, from)
+			continue
+		}
+		if len(p.subject.Operations) == 0 {
+			continue
+		}
+
+		replica := p.random.Intn(len(p.replicas))
+		op := p.subject.Operations[p.random.Intn(len(p.subject.Operations))]
+		err := op.Apply(p.replicas[replica], p.random)
+		if err != nil {
+			p.record("replica-%d: %s: %s", replica, op.Name, err)
+		} else {
+			p.record("replica-%d: %s", replica, op.Name)
+		}
+	}
+	return nil
+}
+
+// copy returns a copy of the replica restored from its serialized state
+func (p *properties) copy(c crdt.CRDT) (crdt.CRDT, error) {
+	data, err := c.Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal replica")
+	}
+	restored := p.newReplica("crdttest")
+	err = restored.Unmarshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal replica")
+	}
+	return restored, nil
+}
+
+// merge returns a copy of `to` with a copy of `from` merged into it, the arguments are not changed
+func (p *properties) merge(to, from crdt.CRDT) (crdt.CRDT, error) {
+	merged, err := p.copy(to)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := p.copy(from)
+	if err != nil {
+		return nil, err
+	}
+	err = merged.MergeCRDT(remote)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to merge replica")
+	}
+	return merged, nil
+}
+
+// pick returns the index of a random replica
+func (p *properties) pick() int {
+	return p.random.Intn(len(p.replicas))
+}
+
+// idempotent checks that `a ⊔ a = a`
+func (p *properties) idempotent() error {
+	i := p.pick()
+	a := p.replicas[i]
+	merged, err := p.merge(a, a)
+	if err != nil {
+		return err
+	}
+	return p.requireEqual(a, merged, "idempotence: replica-%d ⊔ replica-%d != replica-%d", i, i, i)
+}
+
+// commutative checks that `a ⊔ b = b ⊔ a`
+func (p *properties) commutative() error {
+	i, j := p.pick(), p.pick()
+	ab, err := p.merge(p.replicas[i], p.replicas[j])
+	if err != nil {
+		return err
+	}
+	ba, err := p.merge(p.replicas[j], p.replicas[i])
+	if err != nil {
+		return err
+	}
+	return p.requireEqual(ab, ba, "commutativity: replica-%d ⊔ replica-%d != replica-%d ⊔ replica-%d", i, j, j, i)
+}
+
+// associative checks that `(a ⊔ b) ⊔ c = a ⊔ (b ⊔ c)`
+func (p *properties) associative() error {
+	i, j, k := p.pick(), p.pick(), p.pick()
+	a, b, c := p.replicas[i], p.replicas[j], p.replicas[k]
+	ab, err := p.merge(a, b)
+	if err != nil {
+		return err
+	}
+	left, err := p.merge(ab, c)
+	if err != nil {
+		return err
+	}
+	bc, err := p.merge(b, c)
+	if err != nil {
+		return err
+	}
+	right, err := p.merge(a, bc)
+	if err != nil {
+		return err
+	}
+	return p.requireEqual(left, right,
+		"associativity: (replica-%d ⊔ replica-%d) ⊔ replica-%d != replica-%d ⊔ (replica-%d ⊔ replica-%d)", i, j, k, i, j, k)
+}
+
+// convergent checks that merging all the replicas into an empty one in two random orders gives the same state
+func (p *properties) convergent() error {
+	merge := func(order []int) (crdt.CRDT, error) {
+		merged := p.newReplica("crdttest")
+		for _, i := range order {
+			next, err := p.merge(merged, p.replicas[i])
+			if err != nil {
+				return nil, err
+			}
+			merged = next
+		}
+		return merged, nil
+	}
+
+	first, second := p.random.Perm(len(p.replicas)), p.random.Perm(len(p.replicas))
+	a, err := merge(first)
+	if err != nil {
+		return err
+	}
+	b, err := merge(second)
+	if err != nil {
+		return err
+	}
+	return p.requireEqual(a, b, "convergence: merging in the order %v != merging in the order %v", first, second)
+}
+
+// requireEqual returns an error with `ErrPropertyViolated` cause if the states are not equal
+func (p *properties) requireEqual(a, b crdt.CRDT, format string, args ...interface{}) error {
+	equal, err := p.subject.Equal(a, b)
+	if err != nil {
+		return errors.Wrap(err, "failed to compare replicas")
+	}
+	if equal {
+		return nil
+	}
+	return errors.Wrapf(ErrPropertyViolated, "%s (seed %d), events:\n%s",
+		fmt.Sprintf(format, args...), p.cfg.Seed, strings.Join(p.trace, "\n"))
+}
+
+// record appends an event at the current virtual time to the trace
+func (p *properties) record(format string, args ...interface{}) {
+	event := p.clock.Now().Format(time.RFC3339Nano) + " " + fmt.Sprintf(format, args...)
+	p.trace = append(p.trace, event)
+}
+
+// GraphSubject returns the subject of `lww.Graph` replicas changed by `GraphOperations(keys)`,
+// the replicas are compared including the tombstones and the timestamps (see `lww.Graph.StateEquals`)
+func GraphSubject(keys int) Subject {
+	operations := make([]StateOperation, 0, len(GraphOperations(keys)))
+	for _, op := range GraphOperations(keys) {
+		apply := op.Apply
+		operations = append(operations, StateOperation{Name: op.Name, Apply: func(c crdt.CRDT, random *rand.Rand) error {
+			return apply(c.(lww.Graph), random)
+		}})
+	}
+
+	return Subject{
+		New: func(r crdt.Replica) crdt.CRDT {
+			return lww.NewGraph(r)
+		},
+		Operations: operations,
+		Equal: func(a, b crdt.CRDT) (bool, error) {
+			return a.(lww.Graph).StateEquals(b.(lww.Graph))
+		},
+	}
+}
+
+// SetSubject returns the subject of `lww.Set` replicas adding and removing elements
+// with keys picked at random out of `keys` keys (`e0`, `e1`, etc.), the replicas are compared
+// including the tombstones and the timestamps (see `lww.Set.StateEquals`)
+func SetSubject(keys int) Subject {
+	key := func(random *rand.Rand) string {
+		return fmt.Sprintf("e%d", random.Intn(keys))
+	}
+	return Subject{
+		New: func(r crdt.Replica) crdt.CRDT {
+			return lww.NewSet(r)
+		},
+		Operations: []StateOperation{
+			{Name: "add", Apply: func(c crdt.CRDT, random *rand.Rand) error {
+				c.(lww.Set).Add(lww.IDElement(key(random)))
+				return nil
+			}},
+			{Name: "remove", Apply: func(c crdt.CRDT, random *rand.Rand) error {
+				c.(lww.Set).Remove(key(random))
+				return nil
+			}},
+		},
+		Equal: func(a, b crdt.CRDT) (bool, error) {
+			return a.(lww.Set).StateEquals(b.(lww.Set))
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package crdttest
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+// overwrite is a broken CRDT: merging overwrites the local value with the remote one,
+// so the result depends on the merge order
+type overwrite struct {
+	value *string
+}
+
+func (o overwrite) Kind() crdt.Kind {
+	return "crdttest.overwrite"
+}
+
+func (o overwrite) MergeCRDT(remote crdt.CRDT) error {
+	*o.value = *remote.(overwrite).value
+	return nil
+}
+
+func (o overwrite) Marshal() ([]byte, error) {
+	return json.Marshal(*o.value)
+}
+
+func (o overwrite) Unmarshal(data []byte) error {
+	return json.Unmarshal(data, o.value)
+}
+
+func TestVerifyProperties(t *testing.T) {
+	t.Run("holds for the lww CRDTs", func(t *testing.T) {
+		for seed := int64(1); seed <= 5; seed++ {
+			CheckProperties(t, GraphSubject(5), PropertyConfig{Seed: seed})
+			CheckProperties(t, SetSubject(5), PropertyConfig{Seed: seed, Replicas: 5})
+			CheckProperties(t, GraphSubject(5), PropertyConfig{
+				Seed:    seed,
+				Replica: crdt.Replica{Bias: crdt.BiasRemove, MultiValue: true},
+			})
+		}
+	})
+
+	t.Run("reports a violated property with the seed and the trace", func(t *testing.T) {
+		subject := Subject{
+			New: func(r crdt.Replica) crdt.CRDT {
+				value := ""
+				return overwrite{value: &value}
+			},
+			Operations: []StateOperation{{Name: "write", Apply: func(c crdt.CRDT, random *rand.Rand) error {
+				*c.(overwrite).value = string(rune('a' + random.Intn(26)))
+				return nil
+			}}},
+			Equal: func(a, b crdt.CRDT) (bool, error) {
+				return *a.(overwrite).value == *b.(overwrite).value, nil
+			},
+		}
+
+		err := VerifyProperties(subject, PropertyConfig{Seed: 7, SyncRate: -1})
+		require.ErrorIs(t, err, ErrPropertyViolated)
+		require.Contains(t, err.Error(), "(seed 7)")
+		require.Contains(t, err.Error(), "replica-0: write")
+		require.Equal(t, err.Error(), VerifyProperties(subject, PropertyConfig{Seed: 7, SyncRate: -1}).Error())
+
+		r := &recorder{TB: t}
+		r.run(func(t testing.TB) {
+			CheckProperties(t, subject, PropertyConfig{Seed: 7})
+		})
+		require.True(t, r.failed)
+	})
+}
+
+func TestReplicate(t *testing.T) {
+	a := lww.NewGraph(crdt.NewReplica("A"))
+	b := lww.NewGraph(crdt.NewReplica("B"))
+	c := lww.NewGraph(crdt.NewReplica("C"))
+	require.NoError(t, a.AddVertex(lww.Vertex{Key: "v1"}))
+	require.NoError(t, b.AddVertex(lww.Vertex{Key: "v2"}))
+	require.NoError(t, c.AddVertex(lww.Vertex{Key: "v3"}))
+
+	require.NoError(t, Replicate(a, b, c))
+	for _, g := range []lww.Graph{a, b, c} {
+		equal, err := g.Equals(a)
+		require.NoError(t, err)
+		require.True(t, equal)
+		list, err := g.List()
+		require.NoError(t, err)
+		require.Len(t, list, 3)
+	}
+
+	require.ErrorIs(t, Replicate(a, lww.NewSet(crdt.NewReplica("D"))), crdt.ErrKindMismatch)
+}
@@ -0,0 +1,222 @@
+package crdttest
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/lww"
+)
+
+const (
+	// DefaultReplicas is the number of simulated replicas if not configured
+	DefaultReplicas = 3
+	// DefaultMaxStep is the maximum virtual time between two simulated events if not configured
+	DefaultMaxStep = 10 * time.Millisecond
+	// DefaultSyncRate is the share of simulated events that sync replicas if not configured
+	DefaultSyncRate = 0.2
+)
+
+// DefaultStart is the virtual time a simulation starts at if not configured
+var DefaultStart = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SimulationConfig contains the settings of a simulation
+type SimulationConfig struct {
+	// Seed initializes the scheduler, simulations with the same seed, settings and operations
+	// replay identically, so a failing seed reproduces the failure
+	Seed int64
+	// Replicas is the number of simulated graph replicas, `DefaultReplicas` if zero
+	Replicas int
+	// Start is the virtual time the simulation starts at, `DefaultStart` if zero
+	Start time.Time
+	// MaxStep is the maximum virtual time between two events, `DefaultMaxStep` if zero.
+	// Events can happen at the same virtual time, so colliding timestamps are simulated too.
+	MaxStep time.Duration
+	// MaxSkew is the maximum offset of the clock of a replica from the virtual time, no offset if zero
+	MaxSkew time.Duration
+	// SyncRate is the share of events that merge the state of one replica into another one, the other
+	// events apply operations. `DefaultSyncRate` if zero, a negative rate disables syncing.
+	SyncRate float64
+	// Replica is the template of the replica policies (e.g. limits, key normalizer or multi-value).
+	// The ID and the clock are set by the simulation, `crdt.OrderSorted` is used if no order is set,
+	// so operations reading the graph are deterministic too.
+	Replica crdt.Replica
+}
+
+// Operation is a named change a simulation applies to a random replica
+type Operation struct {
+	// Name identifies the operation in the trace
+	Name string
+	// Apply changes the graph, it must use only `random` as a source of randomness and must not
+	// depend on the wall-clock time, so the simulation can be replayed. Returned errors are recorded in the trace.
+	Apply func(g lww.Graph, random *rand.Rand) error
+}
+
+// NewSimulation creates replicas of a graph running on a virtual clock with a deterministic scheduler.
+func NewSimulation(cfg SimulationConfig) Simulation {
+	if cfg.Replicas <= 0 {
+		cfg.Replicas = DefaultReplicas
+	}
+	if cfg.Start.IsZero() {
+		cfg.Start = DefaultStart
+	}
+	if cfg.MaxStep <= 0 {
+		cfg.MaxStep = DefaultMaxStep
+	}
+	if cfg.SyncRate == 0 {
+		cfg.SyncRate = DefaultSyncRate
+	}
+	if cfg.Replica.Order == crdt.OrderNone {
+		cfg.Replica.Order = crdt.OrderSorted
+	}
+
+	// nolint:gosec // the scheduler must be reproducible, not cryptographically secure
+	random := rand.New(rand.NewSource(cfg.Seed))
+	virtual := clock.NewVirtual(cfg.Start)
+
+	ids := make([]string, 0, cfg.Replicas)
+	for i := 0; i < cfg.Replicas; i++ {
+		ids = append(ids, fmt.Sprintf("replica-%d", i))
+	}
+	model := newModelTrace(cfg.Start, ids)
+	observer := crdt.Observer(crdt.ObserverFunc(model.observe))
+	if cfg.Replica.Observer != nil {
+		observer = crdt.Observers(cfg.Replica.Observer, observer)
+	}
+
+	graphs := make([]lww.Graph, 0, cfg.Replicas)
+	for i := 0; i < cfg.Replicas; i++ {
+		var skew time.Duration
+		if cfg.MaxSkew > 0 {
+			skew = time.Duration(random.Int63n(2*int64(cfg.MaxSkew)+1)) - cfg.MaxSkew
+		}
+		r := cfg.Replica
+		r.ID = ids[i]
+		r.Clock = virtual.Skewed(skew)
+		r.Observer = observer
+		graphs = append(graphs, lww.NewGraph(r))
+	}
+
+	return Simulation{
+		cfg:    cfg,
+		clock:  virtual,
+		random: random,
+		graphs: graphs,
+		trace:  &[]string{},
+		model:  model,
+	}
+}
+
+// Simulation runs scenarios on several graph replicas in a single go routine: every event
+// (an operation or a sync between two replicas) is picked by a seeded random scheduler
+// and happens at a virtual time, so entire multi-replica scenarios replay identically from the seed.
+// Use `NewSimulation` in order to initialize it before use. It's not thread-safe.
+type Simulation struct {
+	// cfg contains the simulation settings
+	cfg SimulationConfig
+	// clock is the virtual time of all the replicas
+	clock clock.Virtual
+	// random is the only source of randomness of the simulation
+	random *rand.Rand
+	// graphs are the simulated replicas
+	graphs []lww.Graph
+	// trace records every event
+	trace *[]string
+	// model records every event reduced to the last-writer-wins semantics (see `ModelSteps`)
+	model *modelTrace
+}
+
+// Graphs returns the simulated replicas, they can be inspected or changed between runs
+func (s Simulation) Graphs() []lww.Graph {
+	return s.graphs
+}
+
+// Now returns the current virtual time
+func (s Simulation) Now() time.Time {
+	return s.clock.Now()
+}
+
+// Run simulates the given number of events picking a random replica and a random operation for every
+// operation event and a random pair of replicas for every sync event.
+func (s Simulation) Run(events int, operations ...Operation) {
+	for i := 0; i < events; i++ {
+		s.clock.Advance(time.Duration(s.random.Int63n(int64(s.cfg.MaxStep) + 1)))
+
+		if len(s.graphs) > 1 && (len(operations) == 0 || s.random.Float64() < s.cfg.SyncRate) {
+			from := s.random.Intn(len(s.graphs))
+			to := (from + 1 + s.random.Intn(len(s.graphs)-1)) % len(s.graphs)
+			s.graphs[to].Merge(s.graphs[from])
+			s.model.merge(to, from, s.graphs[to])
+			s.record("replica-%d <- replica-%d: sync", to, from)
+			continue
+		}
+		if len(operations) == 0 {
+			continue
+		}
+
+		replica := s.random.Intn(len(s.graphs))
+		op := operations[s.random.Intn(len(operations))]
+		s.model.begin()
+		err := op.Apply(s.graphs[replica], s.random)
+		s.model.operation(replica, s.graphs[replica])
+		if err != nil {
+			s.record("replica-%d: %s: %s", replica, op.Name, err)
+		} else {
+			s.record("replica-%d: %s", replica, op.Name)
+		}
+	}
+}
+
+// Sync merges every replica into every other one, so all the replicas converge
+func (s Simulation) Sync() {
+	for i, to := range s.graphs {
+		for j, from := range s.graphs {
+			if i != j {
+				to.Merge(from)
+				s.model.merge(i, j, to)
+			}
+		}
+	}
+	s.record("full sync")
+}
+
+// Trace returns every event of the simulation with its virtual time in order,
+// two simulations replaying the same scenario have equal traces.
+func (s Simulation) Trace() []string {
+	trace := make([]string, len(*s.trace))
+	copy(trace, *s.trace)
+	return trace
+}
+
+// record appends an event at the current virtual time to the trace
+func (s Simulation) record(format string, args ...interface{}) {
+	event := s.clock.Now().Format(time.RFC3339Nano) + " " + fmt.Sprintf(format, args...)
+	*s.trace = append(*s.trace, event)
+}
+
+// GraphOperations returns operations adding, updating and removing vertices and edges
+// with keys picked at random out of `keys` keys (`v0`, `v1`, etc.), so replicas often conflict.
+func GraphOperations(keys int) []Operation {
+	key := func(random *rand.Rand) string {
+		return fmt.Sprintf("v%d", random.Intn(keys))
+	}
+	return []Operation{
+		{Name: "add vertex", Apply: func(g lww.Graph, random *rand.Rand) error {
+			return g.AddVertex(lww.Vertex{Key: key(random)})
+		}},
+		{Name: "upsert vertex", Apply: func(g lww.Graph, random *rand.Rand) error {
+			return g.UpsertVertex(lww.Vertex{Key: key(random), Value: fmt.Sprintf("%d", random.Int63())})
+		}},
+		{Name: "remove vertex", Apply: func(g lww.Graph, random *rand.Rand) error {
+			return g.RemoveVertex(key(random))
+		}},
+		{Name: "add edge", Apply: func(g lww.Graph, random *rand.Rand) error {
+			return g.AddEdge(key(random), key(random))
+		}},
+		{Name: "remove edge", Apply: func(g lww.Graph, random *rand.Rand) error {
+			return g.RemoveEdge(key(random), key(random))
+		}},
+	}
+}
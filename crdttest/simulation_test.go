@@ -0,0 +1,74 @@
+package crdttest
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulation(t *testing.T) {
+	// run returns the trace and the canonical states of all the replicas of a simulated scenario
+	run := func(t *testing.T, cfg SimulationConfig) (trace []string, states []string) {
+		s := NewSimulation(cfg)
+		s.Run(500, GraphOperations(10)...)
+		for _, g := range s.Graphs() {
+			state, err := g.CanonicalJSON()
+			require.NoError(t, err)
+			states = append(states, string(state))
+		}
+		return s.Trace(), states
+	}
+	cfg := SimulationConfig{Seed: 42, MaxSkew: 5 * time.Millisecond}
+
+	t.Run("replays identically from the same seed", func(t *testing.T) {
+		trace, states := run(t, cfg)
+		replayedTrace, replayedStates := run(t, cfg)
+		require.Len(t, trace, 500)
+		require.Equal(t, trace, replayedTrace)
+		require.Equal(t, states, replayedStates)
+
+		cfg := cfg
+		cfg.Seed = 43
+		otherTrace, _ := run(t, cfg)
+		require.NotEqual(t, trace, otherTrace)
+	})
+
+	t.Run("replicas converge after a full sync", func(t *testing.T) {
+		s := NewSimulation(cfg)
+		s.Run(300, GraphOperations(10)...)
+		s.Sync()
+
+		graphs := s.Graphs()
+		require.Len(t, graphs, DefaultReplicas)
+		expected, err := graphs[0].CanonicalJSON()
+		require.NoError(t, err)
+		for _, g := range graphs[1:] {
+			actual, err := g.CanonicalJSON()
+			require.NoError(t, err)
+			require.Equal(t, string(expected), string(actual))
+		}
+	})
+
+	t.Run("runs on the virtual time", func(t *testing.T) {
+		s := NewSimulation(SimulationConfig{Seed: 1, Replicas: 1, SyncRate: -1})
+		require.Equal(t, DefaultStart, s.Now())
+
+		s.Run(10, Operation{Name: "add", Apply: func(g lww.Graph, random *rand.Rand) error {
+			return g.AddVertex(lww.Vertex{Key: "v1"})
+		}})
+		require.True(t, s.Now().Before(DefaultStart.Add(10*DefaultMaxStep+1)))
+
+		trace := s.Trace()
+		require.Len(t, trace, 10)
+		require.Contains(t, trace[0], "replica-0: add")
+		require.Contains(t, trace[1], "replica-0: add: vertex already exists")
+
+		record, err := s.Graphs()[0].LastVertexWrite("v1")
+		require.NoError(t, err)
+		require.False(t, record.Timestamp.Before(DefaultStart))
+		require.False(t, record.Timestamp.After(s.Now()))
+	})
+}
@@ -0,0 +1,89 @@
+--------------------------- MODULE LWWGraphTrace ---------------------------
+(***************************************************************************)
+(* Last-writer-wins semantics of lww.Graph for the trace validation of     *)
+(* simulations exported by crdttest.Simulation.WriteTLA.                   *)
+(*                                                                         *)
+(* Every replica keeps the latest addition and the latest removal of every *)
+(* vertex key and every edge. A write is a pair <<time, rank>>, the later  *)
+(* time wins and the greater rank of the replica ID breaks the ties.       *)
+(* A vertex or an edge exists if it was added and not removed later,       *)
+(* the bias decides when both happened at the same time.                   *)
+(* The state of a replica is its vertices and the edges of these vertices. *)
+(*                                                                         *)
+(* The next state of the specification is determined by the trace, so TLC *)
+(* checks a single behavior: `Consistent` holds if every replica state     *)
+(* recorded in the trace is the state the specification computes.         *)
+(* Change the definitions below to check a proposed semantic change        *)
+(* against the traces of the current implementation.                       *)
+(***************************************************************************)
+EXTENDS Integers, Sequences, TLC
+
+CONSTANTS
+    Trace,      \* the sequence of steps, see crdttest.ModelStep
+    Replicas,   \* the number of replicas
+    BiasRemove  \* TRUE if removals win over additions with the same timestamp
+
+VARIABLES
+    i,      \* the index of the next step in the trace
+    state   \* maps a replica to its records
+
+ReplicaIDs == 0..(Replicas - 1)
+
+\* records of an empty replica, functions map a vertex key or an edge <<from, to>> to the latest write
+Empty == [vadd |-> <<>>, vrem |-> <<>>, eadd |-> <<>>, erem |-> <<>>]
+
+Newer(a, b) == a[1] > b[1] \/ (a[1] = b[1] /\ a[2] > b[2])
+
+Put(f, k, v) == (k :> v) @@ f
+
+MergeRecords(local, remote) ==
+    [k \in DOMAIN local \cup DOMAIN remote |->
+        IF k \notin DOMAIN local THEN remote[k]
+        ELSE IF k \notin DOMAIN remote THEN local[k]
+        ELSE IF Newer(remote[k], local[k]) THEN remote[k]
+        ELSE local[k]]
+
+Removed(add, rem, k) ==
+    /\ k \in DOMAIN rem
+    /\ IF BiasRemove THEN rem[k][1] >= add[k][1] ELSE rem[k][1] > add[k][1]
+
+Live(add, rem) == {k \in DOMAIN add : ~Removed(add, rem, k)}
+
+Vertices(s) == Live(s.vadd, s.vrem)
+
+Edges(s) == {e \in Live(s.eadd, s.erem) : e[1] \in Vertices(s)}
+
+Apply(s, step) ==
+    LET write == <<step.time, step.rank>>
+        edge == <<step.key, step.to>>
+    IN CASE step.action = "AddVertex" -> [s EXCEPT !.vadd = Put(@, step.key, write)]
+         [] step.action = "RemoveVertex" -> [s EXCEPT !.vrem = Put(@, step.key, write)]
+         [] step.action = "AddEdge" -> [s EXCEPT !.eadd = Put(@, edge, write)]
+         [] step.action = "RemoveEdge" -> [s EXCEPT !.erem = Put(@, edge, write)]
+         [] step.action = "Merge" ->
+                LET remote == state[step.from]
+                IN [vadd |-> MergeRecords(s.vadd, remote.vadd),
+                    vrem |-> MergeRecords(s.vrem, remote.vrem),
+                    eadd |-> MergeRecords(s.eadd, remote.eadd),
+                    erem |-> MergeRecords(s.erem, remote.erem)]
+
+Init ==
+    /\ i = 1
+    /\ state = [r \in ReplicaIDs |-> Empty]
+
+Next ==
+    /\ i <= Len(Trace)
+    /\ state' = [state EXCEPT ![Trace[i].replica] = Apply(@, Trace[i])]
+    /\ i' = i + 1
+
+\* the state of the replica changed by the last step is the recorded one
+Consistent ==
+    i > 1 /\ Trace[i - 1].check =>
+        LET step == Trace[i - 1]
+        IN /\ Vertices(state[step.replica]) = step.vertices
+           /\ Edges(state[step.replica]) = step.edges
+
+\* the whole trace is replayed
+Done == <>(i > Len(Trace))
+
+=============================================================================
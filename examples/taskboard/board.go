@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+// Task is a task on the board, it's stored as the JSON value of a graph vertex
+type Task struct {
+	// ID is the key of the task vertex
+	ID string `json:"-"`
+	// Title is a short description of the task
+	Title string `json:"title"`
+	// Done is `true` when the task is completed
+	Done bool `json:"done"`
+}
+
+// NewBoard creates an empty task board replicated by the given replica
+func NewBoard(r crdt.Replica) Board {
+	return Board{graph: lww.NewGraph(r)}
+}
+
+// Board is a replicated board of tasks with dependencies.
+// Every task is a vertex of the graph, an edge points from a task to the tasks depending on it,
+// so the topological order of the graph is the order the tasks can be done in.
+type Board struct {
+	graph lww.Graph
+}
+
+// Graph returns the graph of the board for replication
+func (b Board) Graph() lww.Graph {
+	return b.graph
+}
+
+// Add adds a new task to the board
+func (b Board) Add(t Task) error {
+	value, err := json.Marshal(t)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode task %q", t.ID)
+	}
+	return b.graph.AddVertex(lww.Vertex{Key: t.ID, Value: string(value)})
+}
+
+// Complete marks the task with the given ID as done
+func (b Board) Complete(id string) error {
+	t, err := b.Task(id)
+	if err != nil {
+		return err
+	}
+	t.Done = true
+	value, err := json.Marshal(t)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode task %q", t.ID)
+	}
+	return b.graph.UpdateVertex(lww.Vertex{Key: t.ID, Value: string(value)})
+}
+
+// DependOn makes the task with the given ID depend on the `dependency` task.
+// Returns an error with `lww.ErrCycleDetected` cause if the dependency already depends on the task.
+func (b Board) DependOn(id, dependency string) error {
+	return b.graph.AddEdgeAcyclic(dependency, id)
+}
+
+// Task returns the task with the given ID
+func (b Board) Task(id string) (Task, error) {
+	v, err := b.graph.Lookup(id)
+	if err != nil {
+		return Task{}, err
+	}
+	return decodeTask(v)
+}
+
+// Tasks returns all the tasks of the board in the order they can be done in.
+// Returns an error with `lww.ErrCycleDetected` cause if dependencies added concurrently
+// on different replicas formed a cycle, it's resolved by removing one of the dependencies.
+func (b Board) Tasks() ([]Task, error) {
+	sorted, err := b.graph.TopologicalSort()
+	if err != nil {
+		return nil, err
+	}
+	return decodeTasks(sorted)
+}
+
+// Ready returns the tasks which are not done and whose dependencies are all done, sorted by ID
+func (b Board) Ready() ([]Task, error) {
+	list, err := b.graph.List()
+	if err != nil {
+		return nil, err
+	}
+
+	ready := []Task{}
+	for _, vwe := range list {
+		t, err := decodeTask(vwe.Vertex)
+		if err != nil {
+			return nil, err
+		}
+		if t.Done {
+			continue
+		}
+
+		dependencies, err := b.graph.FindPredecessors(t.ID)
+		if err != nil {
+			return nil, err
+		}
+		blocked, err := decodeTasks(dependencies)
+		if err != nil {
+			return nil, err
+		}
+		if allDone(blocked) {
+			ready = append(ready, t)
+		}
+	}
+
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].ID < ready[j].ID
+	})
+	return ready, nil
+}
+
+// Watch subscribes to the changes of the board made locally and by other replicas,
+// close the subscription when it's no longer needed
+func (b Board) Watch() crdt.Subscription {
+	return b.graph.Subscribe(crdt.SubscriptionConfig{Overflow: crdt.OverflowCoalesce})
+}
+
+// decodeTask decodes the task stored in the vertex
+func decodeTask(v lww.Vertex) (t Task, err error) {
+	err = json.Unmarshal([]byte(v.Value), &t)
+	if err != nil {
+		return t, errors.Wrapf(err, "failed to decode task %q", v.Key)
+	}
+	t.ID = v.Key
+	return t, nil
+}
+
+// decodeTasks decodes the tasks stored in the vertices
+func decodeTasks(vertices []lww.Vertex) ([]Task, error) {
+	tasks := make([]Task, 0, len(vertices))
+	for _, v := range vertices {
+		t, err := decodeTask(v)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+// allDone returns `true` if all the tasks are done
+func allDone(tasks []Task) bool {
+	for _, t := range tasks {
+		if !t.Done {
+			return false
+		}
+	}
+	return true
+}
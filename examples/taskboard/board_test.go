@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoard(t *testing.T) {
+	ids := func(tasks []Task) []string {
+		list := []string{}
+		for _, task := range tasks {
+			list = append(list, task.ID)
+		}
+		return list
+	}
+
+	t.Run("orders tasks by dependencies", func(t *testing.T) {
+		b := NewBoard(crdt.NewReplica("A"))
+		require.NoError(t, plan(b))
+
+		tasks, err := b.Tasks()
+		require.NoError(t, err)
+		require.Equal(t, []string{"design", "implement", "release"}, ids(tasks))
+
+		ready, err := b.Ready()
+		require.NoError(t, err)
+		require.Equal(t, []string{"design"}, ids(ready))
+
+		require.NoError(t, b.Complete("design"))
+		ready, err = b.Ready()
+		require.NoError(t, err)
+		require.Equal(t, []string{"implement"}, ids(ready))
+
+		require.ErrorIs(t, b.DependOn("design", "release"), lww.ErrCycleDetected)
+	})
+
+	t.Run("converges offline edits over HTTP sync", func(t *testing.T) {
+		server := NewBoard(crdt.NewReplica("server"))
+		client := NewBoard(crdt.NewReplica("client"))
+		httpServer := httptest.NewServer(Serve(server))
+		defer httpServer.Close()
+		ctx := context.Background()
+
+		require.NoError(t, plan(server))
+		require.NoError(t, Sync(ctx, client, httpServer.URL))
+
+		changes := client.Watch()
+		defer changes.Close()
+
+		require.NoError(t, client.Complete("design"))
+		require.NoError(t, server.Add(Task{ID: "review", Title: "Review"}))
+		require.NoError(t, server.DependOn("release", "review"))
+		require.NoError(t, Sync(ctx, client, httpServer.URL))
+
+		var merged []string
+		for len(merged) < 2 {
+			select {
+			case e := <-changes.Events():
+				if event := e.(lww.GraphEvent); event.Merged {
+					merged = append(merged, event.Type.String()+" "+event.EventKey())
+				}
+			case <-time.After(time.Second):
+				require.FailNow(t, "timed out waiting for merged changes", "%v", merged)
+			}
+		}
+		require.ElementsMatch(t, []string{"VertexAdded review", "EdgeAdded review->release"}, merged)
+
+		for _, b := range []Board{server, client} {
+			tasks, err := b.Tasks()
+			require.NoError(t, err)
+			require.Equal(t, []string{"design", "implement", "review", "release"}, ids(tasks))
+			ready, err := b.Ready()
+			require.NoError(t, err)
+			require.Equal(t, []string{"implement", "review"}, ids(ready))
+		}
+	})
+
+	t.Run("concurrent dependencies can form a cycle", func(t *testing.T) {
+		a := NewBoard(crdt.NewReplica("A"))
+		b := NewBoard(crdt.NewReplica("B"))
+		require.NoError(t, a.Add(Task{ID: "t1"}))
+		require.NoError(t, a.Add(Task{ID: "t2"}))
+		b.Graph().Merge(a.Graph())
+
+		require.NoError(t, a.DependOn("t2", "t1"))
+		require.NoError(t, b.DependOn("t1", "t2"))
+		a.Graph().Merge(b.Graph())
+
+		_, err := a.Tasks()
+		require.ErrorIs(t, err, lww.ErrCycleDetected)
+	})
+
+	t.Run("runs the demo", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, run(&out))
+		require.Contains(t, out.String(), "VertexAdded review by server")
+		require.Contains(t, out.String(), "ready: implement review\nclient board:")
+	})
+}
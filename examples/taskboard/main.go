@@ -0,0 +1,183 @@
+// Command taskboard is an example application: a task board with dependencies replicated between
+// a server and a client which edits the board offline and synchronizes it over HTTP.
+//
+// Usage:
+//
+//	go run ./examples/taskboard
+//
+// The server serves the board with `httpsync`, the client makes its changes on its own replica
+// while the server changes the board concurrently, then both sides converge with a single exchange
+// and every change made by the other side is printed from the board subscription.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/replication/httpsync"
+)
+
+// boardName is the name the board is served under
+const boardName = "board"
+
+func main() {
+	err := run(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run runs the demo printing the boards to `w`
+func run(w io.Writer) error {
+	server := NewBoard(crdt.NewReplica("server"))
+	client := NewBoard(crdt.NewReplica("client"))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.Wrap(err, "failed to listen")
+	}
+	httpServer := &http.Server{Handler: Serve(server)}
+	go func() { _ = httpServer.Serve(listener) }()
+	defer httpServer.Close()
+
+	// both sides start from the same plan
+	err = plan(server)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = Sync(ctx, client, "http://"+listener.Addr().String())
+	if err != nil {
+		return err
+	}
+
+	changes := client.Watch()
+	defer changes.Close()
+
+	// the client is offline while both sides work on the board
+	err = client.Complete("design")
+	if err != nil {
+		return err
+	}
+	err = client.Add(Task{ID: "docs", Title: "Write the docs"})
+	if err != nil {
+		return err
+	}
+	err = client.DependOn("docs", "implement")
+	if err != nil {
+		return err
+	}
+	err = server.Add(Task{ID: "review", Title: "Review the change"})
+	if err != nil {
+		return err
+	}
+	err = server.DependOn("release", "review")
+	if err != nil {
+		return err
+	}
+
+	err = Sync(ctx, client, "http://"+listener.Addr().String())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "changes received by the client:")
+	for received := true; received; {
+		select {
+		case e := <-changes.Events():
+			event := e.(lww.GraphEvent)
+			if event.Merged && event.Origin != "client" {
+				fmt.Fprintf(w, "  %s %s by %s\n", event.Type, event.EventKey(), event.Origin)
+			}
+		case <-time.After(100 * time.Millisecond):
+			received = false
+		}
+	}
+
+	for _, b := range []struct {
+		name  string
+		board Board
+	}{{"server", server}, {"client", client}} {
+		err = printBoard(w, b.name, b.board)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Serve returns an HTTP handler serving the board for replication
+func Serve(b Board) http.Handler {
+	registry := crdt.NewRegistry()
+	// registering never fails on a new registry
+	_ = lww.Register(registry, crdt.NewReplica("taskboard"))
+	handler := httpsync.NewHandler(registry)
+	handler.Serve(boardName, b.Graph())
+	return handler
+}
+
+// Sync exchanges the state of the board with the board served at the given URL
+func Sync(ctx context.Context, b Board, url string) error {
+	registry := crdt.NewRegistry()
+	// registering never fails on a new registry
+	_ = lww.Register(registry, crdt.NewReplica("taskboard"))
+	client := httpsync.NewClient(url+"/", http.DefaultClient, registry)
+	return errors.Wrap(client.Exchange(ctx, boardName, b.Graph()), "failed to sync the board")
+}
+
+// plan adds the initial tasks to the board
+func plan(b Board) error {
+	tasks := []Task{
+		{ID: "design", Title: "Design the feature"},
+		{ID: "implement", Title: "Implement the feature"},
+		{ID: "release", Title: "Release the feature"},
+	}
+	for _, t := range tasks {
+		err := b.Add(t)
+		if err != nil {
+			return err
+		}
+	}
+	err := b.DependOn("implement", "design")
+	if err != nil {
+		return err
+	}
+	return b.DependOn("release", "implement")
+}
+
+// printBoard prints the tasks of the board in the order they can be done in and the tasks ready to be done
+func printBoard(w io.Writer, name string, b Board) error {
+	tasks, err := b.Tasks()
+	if err != nil {
+		return err
+	}
+	ready, err := b.Ready()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s board:\n", name)
+	for _, t := range tasks {
+		status := " "
+		if t.Done {
+			status = "x"
+		}
+		fmt.Fprintf(w, "  [%s] %s - %s\n", status, t.ID, t.Title)
+	}
+	fmt.Fprint(w, "  ready:")
+	for _, t := range ready {
+		fmt.Fprintf(w, " %s", t.ID)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
@@ -0,0 +1,292 @@
+package crdt
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrSlowSubscriber occurs when a subscription with the `OverflowDisconnect` policy
+	// is closed because its consumer could not keep up with the events
+	ErrSlowSubscriber = errors.New("subscriber is too slow")
+)
+
+// DefaultSubscriptionBuffer is the number of pending events a subscription keeps if the buffer is not set
+const DefaultSubscriptionBuffer = 64
+
+// Event is a change notification delivered to subscribers
+type Event interface {
+	// EventKey identifies what changed (e.g. the key of an element),
+	// subscriptions with the `OverflowCoalesce` policy keep only the latest pending event per key
+	EventKey() string
+}
+
+// OverflowPolicy defines what happens when a subscriber does not receive events as fast as they are published
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest drops the oldest pending event to make room for the new one
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowCoalesce replaces the pending event with the same key by the new one,
+	// the oldest pending event is dropped if there is no event with the same key
+	OverflowCoalesce
+	// OverflowDisconnect drops all the pending events and closes the subscription with `ErrSlowSubscriber`
+	OverflowDisconnect
+)
+
+// SubscriptionConfig contains the buffering settings of a subscription
+type SubscriptionConfig struct {
+	// Buffer is the maximum number of pending events, `DefaultSubscriptionBuffer` if it's not positive
+	Buffer int
+	// Overflow is applied when the buffer is full
+	Overflow OverflowPolicy
+}
+
+// NewFeed creates a feed without subscribers.
+// `r` receives the metrics of dropped events and disconnected subscribers.
+func NewFeed(r Replica) Feed {
+	return Feed{
+		mutex:         &sync.Mutex{},
+		replica:       r.WithDefaults(),
+		subscriptions: make(map[chan struct{}]Subscription),
+	}
+}
+
+// Feed delivers published events to all its subscribers without ever blocking the publisher:
+// every subscriber has its own buffer and overflow policy, so a slow consumer affects only itself.
+// Use `NewFeed` in order to initialize it before use.
+// The feed is thread-safe and can be used from several go routines.
+type Feed struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica receives the metrics
+	replica Replica
+	// subscriptions maps the done channel of a subscription to the subscription
+	subscriptions map[chan struct{}]Subscription
+}
+
+// Subscribe creates a subscription receiving all the events published after this call
+func (f Feed) Subscribe(cfg SubscriptionConfig) Subscription {
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = DefaultSubscriptionBuffer
+	}
+
+	s := Subscription{
+		mutex:   &sync.Mutex{},
+		replica: f.replica,
+		cfg:     cfg,
+		state:   &subscriptionState{},
+		signal:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		events:  make(chan Event),
+	}
+	go s.deliver()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.subscriptions[s.done] = s
+
+	return s
+}
+
+// Publish delivers the event to all the subscribers, it never blocks
+func (f Feed) Publish(e Event) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for done, s := range f.subscriptions {
+		if !s.push(e) {
+			delete(f.subscriptions, done)
+		}
+	}
+}
+
+// Subscribers returns the number of open subscriptions
+func (f Feed) Subscribers() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for done, s := range f.subscriptions {
+		if s.closed() {
+			delete(f.subscriptions, done)
+		}
+	}
+	return len(f.subscriptions)
+}
+
+// Subscription is a buffered stream of events of a feed.
+// Use `Feed.Subscribe` in order to create it.
+// The subscription is thread-safe and can be used from several go routines.
+type Subscription struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica receives the metrics
+	replica Replica
+	// cfg contains the buffering settings
+	cfg SubscriptionConfig
+	// state contains the pending events and counters
+	state *subscriptionState
+	// signal notifies the delivering go routine about new pending events
+	signal chan struct{}
+	// done is closed when the subscription is closed
+	done chan struct{}
+	// events is the channel the consumer receives events from
+	events chan Event
+}
+
+// subscriptionState contains the mutable state of a subscription
+type subscriptionState struct {
+	// pending are the events waiting for the consumer, oldest first
+	pending []Event
+	// dropped is the number of events that were never delivered because of the overflow policy
+	dropped int64
+	// err is the reason the subscription was closed by the feed
+	err error
+	// isClosed is `true` when the subscription is closed
+	isClosed bool
+}
+
+// Events returns the channel of events, it's closed when the subscription is closed
+func (s Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events that were never delivered because of the overflow policy
+func (s Subscription) Dropped() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state.dropped
+}
+
+// Err returns an error with `ErrSlowSubscriber` cause if the subscription was disconnected by the feed,
+// `nil` if it's open or closed by `Close`
+func (s Subscription) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state.err
+}
+
+// Close stops the delivery, the pending events are discarded and the events channel is closed
+func (s Subscription) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.close()
+}
+
+// push adds the event to the pending events applying the overflow policy.
+// Returns `false` if the subscription is closed.
+func (s Subscription) push(e Event) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state.isClosed {
+		return false
+	}
+
+	if len(s.state.pending) >= s.cfg.Buffer {
+		switch s.cfg.Overflow {
+		case OverflowDisconnect:
+			s.drop(int64(len(s.state.pending)) + 1)
+			s.state.err = errors.Wrapf(ErrSlowSubscriber, "more than %d pending events", s.cfg.Buffer)
+			s.close()
+			s.replica.Metrics.Count("feed.disconnected", 1)
+			s.replica.Logger.Printf("replica %q disconnected a slow subscriber", s.replica.ID)
+			return false
+		case OverflowCoalesce:
+			s.state.pending = s.withoutKey(e.EventKey())
+		}
+		if len(s.state.pending) >= s.cfg.Buffer {
+			s.state.pending = s.state.pending[1:]
+		}
+		s.drop(1)
+	}
+
+	s.state.pending = append(s.state.pending, e)
+
+	// the delivering go routine might be already notified
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// withoutKey returns the pending events without the first event with the given key, must be called under the lock
+func (s Subscription) withoutKey(key string) []Event {
+	for i, pending := range s.state.pending {
+		if pending.EventKey() == key {
+			return append(s.state.pending[:i:i], s.state.pending[i+1:]...)
+		}
+	}
+	return s.state.pending
+}
+
+// drop counts dropped events, must be called under the lock
+func (s Subscription) drop(count int64) {
+	s.state.dropped += count
+	s.replica.Metrics.Count("feed.dropped", count)
+}
+
+// close closes the subscription, must be called under the lock
+func (s Subscription) close() {
+	if s.state.isClosed {
+		return
+	}
+	s.state.isClosed = true
+	s.state.pending = nil
+	close(s.done)
+}
+
+// closed returns `true` if the subscription is closed
+func (s Subscription) closed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state.isClosed
+}
+
+// next waits for the oldest pending event and removes it from the pending events.
+// Returns `false` if the subscription is closed.
+func (s Subscription) next() (Event, bool) {
+	for {
+		s.mutex.Lock()
+		if len(s.state.pending) != 0 {
+			e := s.state.pending[0]
+			s.state.pending = s.state.pending[1:]
+			s.mutex.Unlock()
+			return e, true
+		}
+		s.mutex.Unlock()
+
+		select {
+		case <-s.signal:
+		case <-s.done:
+			return nil, false
+		}
+	}
+}
+
+// deliver sends the pending events to the consumer until the subscription is closed
+func (s Subscription) deliver() {
+	defer close(s.events)
+
+	for {
+		e, ok := s.next()
+		if !ok {
+			return
+		}
+
+		select {
+		case s.events <- e:
+		case <-s.done:
+			return
+		}
+	}
+}
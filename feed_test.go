@@ -0,0 +1,171 @@
+package crdt
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testEvent is an event with a key and a version
+type testEvent struct {
+	key     string
+	version int
+}
+
+func (e testEvent) EventKey() string {
+	return e.key
+}
+
+// testMetrics records all the counters
+type testMetrics struct {
+	mutex    sync.Mutex
+	counters map[string]int64
+}
+
+func (m *testMetrics) Count(name string, delta int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.counters == nil {
+		m.counters = make(map[string]int64)
+	}
+	m.counters[name] += delta
+}
+
+func (m *testMetrics) get(name string) int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.counters[name]
+}
+
+func TestFeed(t *testing.T) {
+	// receive reads all the events until the channel is closed
+	receive := func(t *testing.T, s Subscription) (events []Event) {
+		for {
+			select {
+			case e, ok := <-s.Events():
+				if !ok {
+					return events
+				}
+				events = append(events, e)
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "the subscription was not closed")
+			}
+		}
+	}
+	// inFlight publishes the event and waits until it's taken for delivery,
+	// so the buffer is empty for the next events
+	inFlight := func(t *testing.T, f Feed, s Subscription, e Event) {
+		f.Publish(e)
+		require.Eventually(t, func() bool {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return len(s.state.pending) == 0
+		}, 5*time.Second, time.Millisecond)
+	}
+
+	t.Run("delivers events to all the subscribers in order", func(t *testing.T) {
+		f := NewFeed(NewReplica("test"))
+		s1 := f.Subscribe(SubscriptionConfig{})
+		s2 := f.Subscribe(SubscriptionConfig{})
+		require.Equal(t, 2, f.Subscribers())
+
+		f.Publish(testEvent{key: "k1"})
+		f.Publish(testEvent{key: "k2"})
+
+		for _, s := range []Subscription{s1, s2} {
+			require.Equal(t, testEvent{key: "k1"}, <-s.Events())
+			require.Equal(t, testEvent{key: "k2"}, <-s.Events())
+		}
+
+		s1.Close()
+		require.Empty(t, receive(t, s1))
+		require.NoError(t, s1.Err())
+		require.Equal(t, 1, f.Subscribers())
+
+		f.Publish(testEvent{key: "k3"})
+		require.Equal(t, testEvent{key: "k3"}, <-s2.Events())
+		s2.Close()
+	})
+
+	t.Run("drops the oldest events of a slow subscriber", func(t *testing.T) {
+		metrics := &testMetrics{}
+		f := NewFeed(Replica{ID: "test", Metrics: metrics})
+		s := f.Subscribe(SubscriptionConfig{Buffer: 2, Overflow: OverflowDropOldest})
+
+		inFlight(t, f, s, testEvent{key: "k1"})
+		f.Publish(testEvent{key: "k2"})
+		f.Publish(testEvent{key: "k3"})
+		f.Publish(testEvent{key: "k4"})
+
+		require.Equal(t, testEvent{key: "k1"}, <-s.Events())
+		require.Equal(t, testEvent{key: "k3"}, <-s.Events())
+		require.Equal(t, testEvent{key: "k4"}, <-s.Events())
+		require.Equal(t, int64(1), s.Dropped())
+		require.Equal(t, int64(1), metrics.get("feed.dropped"))
+		s.Close()
+	})
+
+	t.Run("coalesces pending events with the same key", func(t *testing.T) {
+		f := NewFeed(NewReplica("test"))
+		s := f.Subscribe(SubscriptionConfig{Buffer: 2, Overflow: OverflowCoalesce})
+
+		inFlight(t, f, s, testEvent{key: "k1"})
+		f.Publish(testEvent{key: "k2", version: 1})
+		f.Publish(testEvent{key: "k3", version: 1})
+		f.Publish(testEvent{key: "k2", version: 2})
+		// no pending event with the same key, the oldest is dropped
+		f.Publish(testEvent{key: "k4", version: 1})
+
+		require.Equal(t, testEvent{key: "k1"}, <-s.Events())
+		require.Equal(t, testEvent{key: "k2", version: 2}, <-s.Events())
+		require.Equal(t, testEvent{key: "k4", version: 1}, <-s.Events())
+		require.Equal(t, int64(2), s.Dropped())
+		s.Close()
+	})
+
+	t.Run("disconnects a slow subscriber", func(t *testing.T) {
+		metrics := &testMetrics{}
+		f := NewFeed(Replica{ID: "test", Metrics: metrics})
+		slow := f.Subscribe(SubscriptionConfig{Buffer: 1, Overflow: OverflowDisconnect})
+		fast := f.Subscribe(SubscriptionConfig{Buffer: 1, Overflow: OverflowDisconnect})
+
+		inFlight(t, f, slow, testEvent{key: "k1"})
+		require.Equal(t, testEvent{key: "k1"}, <-fast.Events())
+		f.Publish(testEvent{key: "k2"})
+		require.Equal(t, testEvent{key: "k2"}, <-fast.Events())
+		f.Publish(testEvent{key: "k3"})
+
+		require.LessOrEqual(t, len(receive(t, slow)), 1, "only the event in flight can be delivered")
+		require.ErrorIs(t, slow.Err(), ErrSlowSubscriber)
+		require.Equal(t, int64(2), slow.Dropped())
+		require.Equal(t, int64(1), metrics.get("feed.disconnected"))
+		require.Equal(t, 1, f.Subscribers())
+
+		require.Equal(t, testEvent{key: "k3"}, <-fast.Events())
+		fast.Close()
+	})
+
+	t.Run("publishing never blocks", func(t *testing.T) {
+		f := NewFeed(NewReplica("test"))
+		s := f.Subscribe(SubscriptionConfig{Buffer: 1})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				f.Publish(testEvent{key: "key", version: i})
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "publishing was blocked by the subscriber")
+		}
+		s.Close()
+	})
+}
@@ -0,0 +1,139 @@
+package flags
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+const (
+	// EWKind is the CRDT kind of the Enable-Wins flag
+	EWKind crdt.Kind = "flags.ew"
+	// DWKind is the CRDT kind of the Disable-Wins flag
+	DWKind crdt.Kind = "flags.dw"
+)
+
+// Register registers all the CRDT kinds of this package in the given registry.
+// All the CRDTs created by the registry belong to the given replica.
+func Register(r crdt.Registry, replica crdt.Replica) error {
+	err := r.Register(EWKind, func() crdt.CRDT { return NewEW(replica) })
+	if err != nil {
+		return err
+	}
+
+	return r.Register(DWKind, func() crdt.CRDT { return NewDW(replica) })
+}
+
+// flagState is the serialized format of both flag types
+type flagState struct {
+	// Enables are the tags of the enable operations which have not been cancelled
+	Enables []string `json:"enables"`
+	// Disables are the tags of the disable operations which have not been cancelled
+	Disables []string `json:"disables"`
+	// Cancelled are the tags of all the cancelled operations
+	Cancelled []string `json:"cancelled"`
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (f EW) Kind() crdt.Kind {
+	return EWKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (f EW) MergeCRDT(remote crdt.CRDT) error {
+	remoteFlag, isFlag := remote.(EW)
+	if !isFlag {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", f.Kind(), remote.Kind())
+	}
+	f.Merge(remoteFlag)
+	return nil
+}
+
+// Marshal implements the `crdt.CRDT` interface
+func (f EW) Marshal() ([]byte, error) {
+	return f.state.marshal()
+}
+
+// Unmarshal implements the `crdt.CRDT` interface
+func (f EW) Unmarshal(data []byte) error {
+	return errors.Wrap(f.state.unmarshal(data), "failed to unmarshal Enable-Wins flag")
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (f DW) Kind() crdt.Kind {
+	return DWKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (f DW) MergeCRDT(remote crdt.CRDT) error {
+	remoteFlag, isFlag := remote.(DW)
+	if !isFlag {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", f.Kind(), remote.Kind())
+	}
+	f.Merge(remoteFlag)
+	return nil
+}
+
+// Marshal implements the `crdt.CRDT` interface
+func (f DW) Marshal() ([]byte, error) {
+	return f.state.marshal()
+}
+
+// Unmarshal implements the `crdt.CRDT` interface
+func (f DW) Unmarshal(data []byte) error {
+	return errors.Wrap(f.state.unmarshal(data), "failed to unmarshal Disable-Wins flag")
+}
+
+// marshal serializes the state
+func (s state) marshal() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return json.Marshal(flagState{
+		Enables:   sortedTags(s.enables),
+		Disables:  sortedTags(s.disables),
+		Cancelled: sortedTags(s.cancelled),
+	})
+}
+
+// unmarshal replaces the state with the serialized one
+func (s state) unmarshal(data []byte) error {
+	var serialized flagState
+	err := json.Unmarshal(data, &serialized)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, pair := range []struct {
+		tags     map[string]nothing
+		restored []string
+	}{
+		{tags: s.enables, restored: serialized.Enables},
+		{tags: s.disables, restored: serialized.Disables},
+		{tags: s.cancelled, restored: serialized.Cancelled},
+	} {
+		for tag := range pair.tags {
+			delete(pair.tags, tag)
+		}
+		for _, tag := range pair.restored {
+			pair.tags[tag] = nothing{}
+		}
+	}
+
+	return nil
+}
+
+// sortedTags returns the given tags in the ascending order
+func sortedTags(tags map[string]nothing) []string {
+	sorted := make([]string, 0, len(tags))
+	for tag := range tags {
+		sorted = append(sorted, tag)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
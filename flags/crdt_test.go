@@ -0,0 +1,57 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRDT(t *testing.T) {
+	registry := crdt.NewRegistry()
+	require.NoError(t, Register(registry, crdt.NewReplica("C")))
+	require.Equal(t, []crdt.Kind{DWKind, EWKind}, registry.Kinds())
+
+	t.Run("enable-wins flag survives a marshal/unmarshal round trip", func(t *testing.T) {
+		A := NewEW(crdt.NewReplica("A"))
+		B := NewEW(crdt.NewReplica("B"))
+		A.Enable()
+		B.Merge(A)
+		A.Disable()
+
+		data, err := crdt.Marshal(A)
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+		require.False(t, restored.(EW).Value())
+
+		// the restored disable cancels the enable observed by the other replica
+		require.NoError(t, B.MergeCRDT(restored))
+		require.False(t, B.Value())
+	})
+
+	t.Run("disable-wins flag survives a marshal/unmarshal round trip", func(t *testing.T) {
+		A := NewDW(crdt.NewReplica("A"))
+		B := NewDW(crdt.NewReplica("B"))
+		A.Disable()
+		B.Merge(A)
+		A.Enable()
+
+		data, err := crdt.Marshal(A)
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+		require.True(t, restored.(DW).Value())
+
+		require.NoError(t, B.MergeCRDT(restored))
+		require.True(t, B.Value())
+	})
+
+	t.Run("returns ErrKindMismatch when merging CRDTs of different kinds", func(t *testing.T) {
+		err := NewEW(crdt.NewReplica("A")).MergeCRDT(NewDW(crdt.NewReplica("A")))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+
+		err = NewDW(crdt.NewReplica("A")).MergeCRDT(NewEW(crdt.NewReplica("A")))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+	})
+}
@@ -0,0 +1,41 @@
+package flags
+
+import (
+	"github.com/rdner/crdt"
+)
+
+// NewDW initializes the Disable-Wins flag and makes it ready for use.
+// The flag is disabled initially.
+// The flag does not depend on the replica clock, `r` provides the metrics of the flag operations.
+func NewDW(r crdt.Replica) DW {
+	return DW{state: newState(r, "flags.dw")}
+}
+
+// DW is a Disable-Wins state-based flag implementation.
+// When the flag is concurrently enabled and disabled on different replicas, it's disabled after merging.
+// Use `NewDW` in order to initialize it before use.
+// The flag is thread-safe and can be used from several go routines.
+type DW struct {
+	state state
+}
+
+// Enable enables the flag, a concurrent `Disable` on another replica wins over it
+func (f DW) Enable() {
+	f.state.enable()
+}
+
+// Disable disables the flag
+func (f DW) Disable() {
+	f.state.disable()
+}
+
+// Value returns `true` if the flag is enabled
+func (f DW) Value() bool {
+	enabled, disabled := f.state.values()
+	return enabled && !disabled
+}
+
+// Merge takes another Disable-Wins flag as a `remote` and merges its state into itself.
+func (f DW) Merge(remote DW) {
+	f.state.merge(remote.state)
+}
@@ -0,0 +1,41 @@
+package flags
+
+import (
+	"github.com/rdner/crdt"
+)
+
+// NewEW initializes the Enable-Wins flag and makes it ready for use.
+// The flag is disabled initially.
+// The flag does not depend on the replica clock, `r` provides the metrics of the flag operations.
+func NewEW(r crdt.Replica) EW {
+	return EW{state: newState(r, "flags.ew")}
+}
+
+// EW is an Enable-Wins state-based flag implementation.
+// When the flag is concurrently enabled and disabled on different replicas, it's enabled after merging.
+// Use `NewEW` in order to initialize it before use.
+// The flag is thread-safe and can be used from several go routines.
+type EW struct {
+	state state
+}
+
+// Enable enables the flag
+func (f EW) Enable() {
+	f.state.enable()
+}
+
+// Disable disables the flag, a concurrent `Enable` on another replica wins over it
+func (f EW) Disable() {
+	f.state.disable()
+}
+
+// Value returns `true` if the flag is enabled
+func (f EW) Value() bool {
+	enabled, _ := f.state.values()
+	return enabled
+}
+
+// Merge takes another Enable-Wins flag as a `remote` and merges its state into itself.
+func (f EW) Merge(remote EW) {
+	f.state.merge(remote.state)
+}
@@ -0,0 +1,128 @@
+// Package flags implements boolean flag CRDTs:
+// * `EW` - Enable-Wins flag, a concurrent enable wins over a disable
+// * `DW` - Disable-Wins flag, a concurrent disable wins over an enable
+//
+// Both flags are disabled initially and use the observed-remove semantics:
+// an operation cancels only the opposite operations observed by the replica.
+package flags
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+// tagSize is the amount of random bytes in a single operation tag
+const tagSize = 16
+
+// nothing is a type with zero memory allocation.
+// It's used for building sets of tags in a efficient way.
+type nothing struct{}
+
+// state is the state shared by both flag types
+type state struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is the identity and the policies of the replica the flag belongs to
+	replica crdt.Replica
+	// name is the prefix of the metrics of the flag operations, e.g. `flags.ew`
+	name string
+
+	// enables contains tags of the enable operations which have not been cancelled
+	enables map[string]nothing
+	// disables contains tags of the disable operations which have not been cancelled
+	disables map[string]nothing
+	// cancelled contains tags of all the cancelled operations
+	cancelled map[string]nothing
+}
+
+// newState initializes a new flag state reporting the metrics of its operations with the given name prefix
+func newState(r crdt.Replica, name string) state {
+	return state{
+		mutex:     &sync.Mutex{},
+		replica:   r.WithDefaults(),
+		name:      name,
+		enables:   make(map[string]nothing),
+		disables:  make(map[string]nothing),
+		cancelled: make(map[string]nothing),
+	}
+}
+
+// enable records an enable operation cancelling all the observed operations
+func (s state) enable() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cancel(s.enables)
+	s.cancel(s.disables)
+	s.enables[newTag()] = nothing{}
+	s.replica.Metrics.Count(s.name+".enable", 1)
+}
+
+// disable records a disable operation cancelling all the observed operations
+func (s state) disable() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cancel(s.enables)
+	s.cancel(s.disables)
+	s.disables[newTag()] = nothing{}
+	s.replica.Metrics.Count(s.name+".disable", 1)
+}
+
+// cancel moves all the given tags to the cancelled ones
+func (s state) cancel(tags map[string]nothing) {
+	for tag := range tags {
+		s.cancelled[tag] = nothing{}
+		delete(tags, tag)
+	}
+}
+
+// values returns whether there are active enable and disable operations
+func (s state) values() (enabled, disabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.enables) != 0, len(s.disables) != 0
+}
+
+// merge takes the union of the operations and the cancelled tags
+func (s state) merge(remote state) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for tag := range remote.cancelled {
+		s.cancelled[tag] = nothing{}
+	}
+
+	for _, pair := range []struct{ local, remote map[string]nothing }{
+		{local: s.enables, remote: remote.enables},
+		{local: s.disables, remote: remote.disables},
+	} {
+		for tag := range pair.remote {
+			pair.local[tag] = nothing{}
+		}
+		for tag := range pair.local {
+			if _, cancelled := s.cancelled[tag]; cancelled {
+				delete(pair.local, tag)
+			}
+		}
+	}
+	s.replica.Metrics.Count(s.name+".merge", 1)
+}
+
+// newTag generates a new universally unique operation tag
+func newTag() string {
+	tag := make([]byte, tagSize)
+	_, err := rand.Read(tag)
+	if err != nil {
+		// should never happen, the system's random source is broken
+		panic(errors.Wrap(err, "failed to generate a unique tag"))
+	}
+
+	return hex.EncodeToString(tag)
+}
@@ -0,0 +1,100 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+// flag is the common shape of both flags used for running the same tests
+type flag interface {
+	Enable()
+	Disable()
+	Value() bool
+}
+
+func TestFlags(t *testing.T) {
+	testCases := []struct {
+		name string
+		// create returns two replicas of the flag and a function to replicate them
+		create func() (a, b flag, replicate func())
+		// concurrentValue is the expected value after concurrent enable and disable
+		concurrentValue bool
+	}{
+		{
+			name: "EW",
+			create: func() (flag, flag, func()) {
+				a, b := NewEW(crdt.NewReplica("A")), NewEW(crdt.NewReplica("B"))
+				return a, b, func() {
+					a.Merge(b)
+					b.Merge(a)
+				}
+			},
+			concurrentValue: true,
+		},
+		{
+			name: "DW",
+			create: func() (flag, flag, func()) {
+				a, b := NewDW(crdt.NewReplica("A")), NewDW(crdt.NewReplica("B"))
+				return a, b, func() {
+					a.Merge(b)
+					b.Merge(a)
+				}
+			},
+			concurrentValue: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Run("is disabled initially", func(t *testing.T) {
+				a, _, _ := tc.create()
+				require.False(t, a.Value())
+			})
+
+			t.Run("enables and disables locally", func(t *testing.T) {
+				a, _, _ := tc.create()
+				a.Enable()
+				require.True(t, a.Value())
+				a.Disable()
+				require.False(t, a.Value())
+				a.Enable()
+				require.True(t, a.Value())
+			})
+
+			t.Run("sequential operations get replicated", func(t *testing.T) {
+				// Time ->
+				// A--Enable-\------------\---|
+				// B----------\--Disable---\--|=> A,B = false
+				a, b, replicate := tc.create()
+
+				a.Enable()
+				replicate()
+				require.True(t, b.Value())
+
+				b.Disable()
+				replicate()
+				require.False(t, a.Value())
+				require.False(t, b.Value())
+			})
+
+			t.Run("concurrent operations are resolved by the bias", func(t *testing.T) {
+				// Time ->
+				// A--Enable-\--Enable---\---|
+				// B----------\--Disable--\--|
+				a, b, replicate := tc.create()
+
+				a.Enable()
+				replicate()
+
+				a.Enable()
+				b.Disable()
+				replicate()
+
+				require.Equal(t, tc.concurrentValue, a.Value())
+				require.Equal(t, tc.concurrentValue, b.Value())
+			})
+		})
+	}
+}
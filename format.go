@@ -0,0 +1,102 @@
+package crdt
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnknownFormat occurs when a CRDT is serialized in a format it does not support
+	ErrUnknownFormat = errors.New("unknown state format")
+)
+
+// Format is a version of the serialized state format of the CRDTs.
+//
+// When the format changes, fleets of replicas are upgraded without downtime in three steps:
+// 1. every replica is upgraded to a binary that reads the new format and `Replica.DualFormat` is enabled,
+// so the state serialized without negotiation (snapshots, broadcasts) is readable by both versions
+// and the peers negotiating the format (e.g. the gRPC sync service) exchange the newest format both read
+// 2. once every replica is upgraded the new format is enabled (e.g. `Replica.CompactEdges`)
+// 3. `Replica.DualFormat` is disabled.
+type Format int
+
+const (
+	// FormatDefault is the format chosen by the replica settings
+	// (see `Replica.DualFormat` and `Replica.CompactEdges`)
+	FormatDefault Format = iota
+	// FormatV1 is the original format
+	FormatV1
+	// FormatV2 serializes the edges of `lww.Graph` compactly, see `Replica.CompactEdges`
+	FormatV2
+	// FormatDual writes `FormatV1` and `FormatV2` together in a state readable by both versions,
+	// it's used during upgrades for the state that is not negotiated with a particular peer
+	FormatDual
+)
+
+// SupportedFormats are the formats this version reads and writes ordered from the oldest to the newest,
+// peers advertise them during the format negotiation (see `NegotiateFormat`)
+var SupportedFormats = []Format{FormatV1, FormatV2}
+
+// String returns the name of the format
+func (f Format) String() string {
+	switch f {
+	case FormatDefault:
+		return "default"
+	case FormatV1:
+		return "v1"
+	case FormatV2:
+		return "v2"
+	case FormatDual:
+		return "dual"
+	default:
+		return "unknown"
+	}
+}
+
+// FormatMarshaler is implemented by the CRDTs having several serialized formats
+type FormatMarshaler interface {
+	// MarshalFormat serializes the full state of the CRDT in the given format like `CRDT.Marshal`,
+	// `FormatDefault` produces the same result as `CRDT.Marshal`
+	MarshalFormat(f Format) ([]byte, error)
+}
+
+// NegotiateFormat returns the newest format from `remote` the `local` formats contain,
+// e.g. `NegotiateFormat(SupportedFormats, peerFormats)`.
+// Returns `FormatDefault` if the formats of the remote peer are unknown (e.g. a peer of an older version
+// that does not advertise them) or there is no common format.
+func NegotiateFormat(local, remote []Format) Format {
+	best := FormatDefault
+	for _, r := range remote {
+		for _, l := range local {
+			if r == l && r > best {
+				best = r
+			}
+		}
+	}
+	return best
+}
+
+// MarshalFormat serializes the given CRDT along with its kind like `Marshal` but in the given format.
+// CRDTs that have only one format (don't implement `FormatMarshaler`) are serialized with `CRDT.Marshal`.
+func MarshalFormat(c CRDT, f Format) ([]byte, error) {
+	fm, isFormatMarshaler := c.(FormatMarshaler)
+	if !isFormatMarshaler || f == FormatDefault {
+		return Marshal(c)
+	}
+
+	state, err := fm.MarshalFormat(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal CRDT of kind %q in format %s", c.Kind(), f)
+	}
+
+	data, err := json.Marshal(envelope{
+		Kind:  c.Kind(),
+		State: state,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal CRDT of kind %q", c.Kind())
+	}
+
+	return data, nil
+}
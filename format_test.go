@@ -0,0 +1,44 @@
+package crdt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// versionedCounter is a counter serialized in a format-specific way
+type versionedCounter struct {
+	counter
+}
+
+func (c versionedCounter) MarshalFormat(f Format) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"format": f.String(), "value": *c.value})
+}
+
+func TestFormats(t *testing.T) {
+	t.Run("NegotiateFormat picks the newest common format", func(t *testing.T) {
+		require.Equal(t, FormatV2, NegotiateFormat(SupportedFormats, []Format{FormatV1, FormatV2, Format(42)}))
+		require.Equal(t, FormatV1, NegotiateFormat(SupportedFormats, []Format{FormatV1}))
+		require.Equal(t, FormatDefault, NegotiateFormat(SupportedFormats, nil), "unknown peer formats")
+		require.Equal(t, FormatDefault, NegotiateFormat(SupportedFormats, []Format{Format(42)}), "no common format")
+	})
+
+	t.Run("MarshalFormat", func(t *testing.T) {
+		c := newCounter().(counter)
+		*c.value = 5
+
+		data, err := MarshalFormat(c, FormatV2)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"kind":"test.counter","state":5}`, string(data), "CRDTs with a single format")
+
+		vc := versionedCounter{counter: c}
+		data, err = MarshalFormat(vc, FormatV2)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"kind":"test.counter","state":{"format":"v2","value":5}}`, string(data))
+
+		data, err = MarshalFormat(vc, FormatDefault)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"kind":"test.counter","state":5}`, string(data), "the default format is Marshal")
+	})
+}
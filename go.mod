@@ -5,4 +5,7 @@ go 1.16
 require (
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.7.0
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/net v0.0.0-20200822124328-c89045814202
+	google.golang.org/grpc v1.40.0
 )
@@ -0,0 +1,7 @@
+//go:build !crdtdebug
+// +build !crdtdebug
+
+package sentinel
+
+// Enabled is true when the module is built with the `crdtdebug` build tag
+const Enabled = false
@@ -0,0 +1,82 @@
+// Package sentinel detects misuse of the CRDTs at runtime when the module is built
+// with the `crdtdebug` build tag, e.g. `go test -tags crdtdebug ./...`.
+//
+// Misuse like merging a CRDT into itself, using a CRDT that was not initialized by its constructor
+// or a broken clock does not fail on its own, it silently makes replicas diverge.
+// In the sentinel mode such misuse panics with an actionable message instead.
+//
+// Without the build tag `Enabled` is a false constant, so all the checks guarded by it
+// are removed by the compiler and have no runtime cost.
+package sentinel
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ownership is a record of a resource owned by an owner
+type ownership struct {
+	// resource is kept referenced, so its address is never reused by another resource
+	resource interface{}
+	// owner is the pointer of the owner, kept referenced for the same reason
+	owner interface{}
+}
+
+// owners maps a pointer of a shared resource (e.g. a map) to the record of its owner
+var owners = struct {
+	sync.Mutex
+	m map[uintptr]ownership
+}{m: make(map[uintptr]ownership)}
+
+// Fail panics with the message about the detected misuse
+func Fail(format string, args ...interface{}) {
+	panic(fmt.Sprintf("crdt: misuse detected: "+format, args...))
+}
+
+// Assert panics with the message about the detected misuse if the condition is false
+func Assert(condition bool, format string, args ...interface{}) {
+	if !condition {
+		Fail(format, args...)
+	}
+}
+
+// IsNil returns `true` if the value is nil or an interface holding a nil pointer, map or function
+func IsNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Func, reflect.Chan, reflect.Slice, reflect.Interface:
+		return value.IsNil()
+	default:
+		return false
+	}
+}
+
+// CheckOwner records the `owner` of the `resource` on the first call and panics
+// if the resource is later used by a different owner. Both must be pointers or maps.
+// It detects structs sharing internal state by accident, e.g. a copy of a struct
+// with the shared maps but a different mutex.
+//
+// The records are never removed and keep the resources referenced, so an address
+// of a collected resource is never reused by another one and mistaken for sharing.
+// It must be used only in the sentinel mode.
+func CheckOwner(resource, owner interface{}, what string) {
+	r := reflect.ValueOf(resource).Pointer()
+	o := reflect.ValueOf(owner).Pointer()
+
+	owners.Lock()
+	defer owners.Unlock()
+
+	known, exists := owners.m[r]
+	if !exists {
+		owners.m[r] = ownership{resource: resource, owner: owner}
+		return
+	}
+	if reflect.ValueOf(known.owner).Pointer() != o {
+		Fail("%s shares its state with another instance, create every instance with its constructor instead of copying", what)
+	}
+}
@@ -0,0 +1,39 @@
+package sentinel
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSentinel(t *testing.T) {
+	t.Run("IsNil", func(t *testing.T) {
+		var nilFunc func() time.Time
+		var nilMap map[string]int
+
+		require.True(t, IsNil(nil))
+		require.True(t, IsNil(nilFunc))
+		require.True(t, IsNil(nilMap))
+		require.True(t, IsNil((*sync.Mutex)(nil)))
+		require.False(t, IsNil(time.Now))
+		require.False(t, IsNil(42))
+	})
+
+	t.Run("Assert panics only if the condition is false", func(t *testing.T) {
+		require.NotPanics(t, func() { Assert(true, "message") })
+		require.PanicsWithValue(t, "crdt: misuse detected: message 42", func() { Assert(false, "message %d", 42) })
+	})
+
+	t.Run("CheckOwner panics when the resource is used by another owner", func(t *testing.T) {
+		resource := make(map[string]int)
+		owner, other := &sync.Mutex{}, &sync.Mutex{}
+
+		require.NotPanics(t, func() {
+			CheckOwner(resource, owner, "resource")
+			CheckOwner(resource, owner, "resource")
+		})
+		require.Panics(t, func() { CheckOwner(resource, other, "resource") })
+	})
+}
@@ -0,0 +1,171 @@
+package crdt
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/clock"
+)
+
+// ConflictOp is an operation taking part in a last-writer-wins decision
+type ConflictOp struct {
+	// Replica is the ID of the replica that performed the operation
+	Replica string `json:"replica"`
+	// Timestamp is when the operation happened
+	Timestamp time.Time `json:"timestamp"`
+	// Removal is `true` if the operation is a removal, `false` if it's an addition
+	Removal bool `json:"removal,omitempty"`
+}
+
+// Conflict is a last-writer-wins decision made while merging: the local `Loser` operation
+// was overwritten by the remote `Winner` operation on the same key.
+type Conflict struct {
+	// Kind is the kind of the merged CRDT
+	Kind Kind `json:"kind"`
+	// Key is the key of the element, for graph edges it's the key of the vertex the edge starts from
+	Key string `json:"key"`
+	// AdjacentKey is the key of the vertex the edge points to, empty for anything but graph edges
+	AdjacentKey string `json:"adjacentKey,omitempty"`
+	// Winner is the operation that was kept
+	Winner ConflictOp `json:"winner"`
+	// Loser is the operation that was overwritten
+	Loser ConflictOp `json:"loser"`
+	// MergedAt is when the decision was made according to the replica clock
+	MergedAt time.Time `json:"mergedAt"`
+}
+
+// ConflictJournal receives the last-writer-wins decisions of merges
+type ConflictJournal interface {
+	// Record records the decision, it's called under the lock of the merged CRDT and must not block
+	Record(c Conflict)
+}
+
+// nopJournal is a `ConflictJournal` that discards all the decisions
+type nopJournal struct{}
+
+// Record implements the `ConflictJournal` interface
+func (nopJournal) Record(c Conflict) {}
+
+// JournalConfig contains the bounds of a journal, zero values mean no bound
+type JournalConfig struct {
+	// MaxEntries is the number of the latest decisions the journal keeps
+	MaxEntries int
+	// MaxAge is how long the journal keeps decisions after they were made
+	MaxAge time.Duration
+	// Clock is used for expiring decisions, the system clock if nil
+	Clock clock.Clock
+}
+
+// NewJournal creates an empty bounded conflict journal
+func NewJournal(cfg JournalConfig) Journal {
+	if cfg.Clock == nil {
+		cfg.Clock = clock.System()
+	}
+	return Journal{
+		mutex:     &sync.Mutex{},
+		cfg:       cfg,
+		conflicts: &[]Conflict{},
+	}
+}
+
+// Journal is an in-memory `ConflictJournal` bounded by the number of decisions and their age,
+// so post-incident analysis can find out which writes were overwritten during a specific partition.
+// It can be serialized with `Marshal` and persisted alongside snapshots (see the `storage` package).
+// Use `NewJournal` in order to initialize it before use.
+// The journal is thread-safe and can be used from several go routines.
+type Journal struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// cfg contains the bounds
+	cfg JournalConfig
+	// conflicts are the recorded decisions ordered by the time they were recorded
+	conflicts *[]Conflict
+}
+
+// Record implements the `ConflictJournal` interface
+func (j Journal) Record(c Conflict) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	*j.conflicts = append(*j.conflicts, c)
+	j.trim()
+}
+
+// Conflicts returns the recorded decisions in which the overwritten operation happened
+// within the given time range (inclusive), e.g. during a network partition.
+// Zero `from` or `to` make the range unbounded on the respective side.
+func (j Journal) Conflicts(from, to time.Time) []Conflict {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.trim()
+
+	// it's always at least an empty list
+	conflicts := []Conflict{}
+	for _, c := range *j.conflicts {
+		if !from.IsZero() && c.Loser.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && c.Loser.Timestamp.After(to) {
+			continue
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts
+}
+
+// Marshal serializes the recorded decisions
+func (j Journal) Marshal() ([]byte, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.trim()
+
+	data, err := json.Marshal(*j.conflicts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal the conflict journal")
+	}
+	return data, nil
+}
+
+// Unmarshal replaces the recorded decisions with the ones serialized by `Marshal`,
+// the bounds of the journal are applied
+func (j Journal) Unmarshal(data []byte) error {
+	var conflicts []Conflict
+	err := json.Unmarshal(data, &conflicts)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal the conflict journal")
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	*j.conflicts = conflicts
+	j.trim()
+
+	return nil
+}
+
+// trim drops the decisions exceeding the bounds, must be called under the lock
+func (j Journal) trim() {
+	conflicts := *j.conflicts
+	if j.cfg.MaxAge > 0 {
+		expired := j.cfg.Clock.Now().Add(-j.cfg.MaxAge)
+		i := 0
+		for i < len(conflicts) && conflicts[i].MergedAt.Before(expired) {
+			i++
+		}
+		conflicts = conflicts[i:]
+	}
+	if j.cfg.MaxEntries > 0 && len(conflicts) > j.cfg.MaxEntries {
+		conflicts = conflicts[len(conflicts)-j.cfg.MaxEntries:]
+	}
+	// copying, so the dropped decisions are not retained by the underlying array
+	if len(conflicts) != len(*j.conflicts) {
+		conflicts = append([]Conflict{}, conflicts...)
+	}
+	*j.conflicts = conflicts
+}
@@ -0,0 +1,67 @@
+package crdt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return base.Add(time.Duration(seconds) * time.Second)
+	}
+	conflict := func(key string, lostAt, mergedAt int) Conflict {
+		return Conflict{
+			Kind:     "test",
+			Key:      key,
+			Winner:   ConflictOp{Replica: "B", Timestamp: at(lostAt + 1)},
+			Loser:    ConflictOp{Replica: "A", Timestamp: at(lostAt)},
+			MergedAt: at(mergedAt),
+		}
+	}
+
+	t.Run("returns the conflicts overwritten within a time range", func(t *testing.T) {
+		j := NewJournal(JournalConfig{})
+		j.Record(conflict("k1", 0, 10))
+		j.Record(conflict("k2", 5, 10))
+		j.Record(conflict("k3", 8, 10))
+
+		require.Equal(t, []Conflict{conflict("k2", 5, 10), conflict("k3", 8, 10)}, j.Conflicts(at(5), time.Time{}))
+		require.Equal(t, []Conflict{conflict("k1", 0, 10), conflict("k2", 5, 10)}, j.Conflicts(time.Time{}, at(5)))
+		require.Equal(t, []Conflict{}, j.Conflicts(at(1), at(4)))
+	})
+
+	t.Run("is bounded by the number of entries and their age", func(t *testing.T) {
+		now := at(100)
+		j := NewJournal(JournalConfig{
+			MaxEntries: 2,
+			MaxAge:     time.Minute,
+			Clock:      clock.Func(func() time.Time { return now }),
+		})
+		j.Record(conflict("k1", 0, 30))
+		j.Record(conflict("k2", 0, 50))
+		j.Record(conflict("k3", 0, 60))
+		require.Equal(t, []Conflict{conflict("k2", 0, 50), conflict("k3", 0, 60)}, j.Conflicts(time.Time{}, time.Time{}))
+
+		now = at(115)
+		require.Equal(t, []Conflict{conflict("k3", 0, 60)}, j.Conflicts(time.Time{}, time.Time{}))
+	})
+
+	t.Run("survives serialization", func(t *testing.T) {
+		j := NewJournal(JournalConfig{})
+		j.Record(conflict("k1", 0, 10))
+		j.Record(conflict("k2", 5, 10))
+
+		data, err := j.Marshal()
+		require.NoError(t, err)
+
+		restored := NewJournal(JournalConfig{MaxEntries: 1})
+		require.NoError(t, restored.Unmarshal(data))
+		require.Equal(t, []Conflict{conflict("k2", 5, 10)}, restored.Conflicts(time.Time{}, time.Time{}))
+
+		require.Error(t, restored.Unmarshal([]byte("{")))
+	})
+}
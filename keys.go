@@ -0,0 +1,62 @@
+package crdt
+
+import (
+	"strings"
+)
+
+// KeyNormalizer returns the canonical form of a key, so replicas fed keys from different
+// client platforms (e.g. uppercase and lowercase UUIDs) converge instead of accumulating
+// near-duplicates. It must be deterministic and idempotent.
+type KeyNormalizer func(key string) string
+
+// LowerCase folds the key to the lower case
+func LowerCase(key string) string {
+	return strings.ToLower(key)
+}
+
+// TrimSpace removes the leading and trailing white space of the key
+func TrimSpace(key string) string {
+	return strings.TrimSpace(key)
+}
+
+// NormalizeUUID converts UUID keys to the canonical lowercase hyphenated form,
+// e.g. `{6BA7B810-9DAD-11D1-80B4-00C04FD430C8}`, `urn:uuid:6ba7b8109dad11d180b400c04fd430c8`
+// become `6ba7b810-9dad-11d1-80b4-00c04fd430c8`. Keys that are not UUIDs are returned as is.
+func NormalizeUUID(key string) string {
+	candidate := key
+	if len(candidate) > 9 && strings.EqualFold(candidate[:9], "urn:uuid:") {
+		candidate = candidate[9:]
+	}
+	if len(candidate) > 2 && candidate[0] == '{' && candidate[len(candidate)-1] == '}' {
+		candidate = candidate[1 : len(candidate)-1]
+	}
+
+	var hexDigits strings.Builder
+	for i, r := range candidate {
+		switch {
+		case r == '-' && len(candidate) == 36 && (i == 8 || i == 13 || i == 18 || i == 23):
+			continue
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'f', r >= 'A' && r <= 'F':
+			hexDigits.WriteRune(r)
+		default:
+			return key
+		}
+	}
+
+	digits := strings.ToLower(hexDigits.String())
+	if len(digits) != 32 || (len(candidate) != 32 && len(candidate) != 36) {
+		return key
+	}
+
+	return digits[:8] + "-" + digits[8:12] + "-" + digits[12:16] + "-" + digits[16:20] + "-" + digits[20:]
+}
+
+// ChainKeyNormalizers returns a normalizer applying the given normalizers in order
+func ChainKeyNormalizers(normalizers ...KeyNormalizer) KeyNormalizer {
+	return func(key string) string {
+		for _, normalize := range normalizers {
+			key = normalize(key)
+		}
+		return key
+	}
+}
@@ -0,0 +1,47 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyNormalizers(t *testing.T) {
+	t.Run("NormalizeUUID", func(t *testing.T) {
+		canonical := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+		testCases := []struct {
+			key      string
+			expected string
+		}{
+			{key: canonical, expected: canonical},
+			{key: "6BA7B810-9DAD-11D1-80B4-00C04FD430C8", expected: canonical},
+			{key: "6ba7b8109dad11d180b400c04fd430c8", expected: canonical},
+			{key: "{6BA7B810-9DAD-11D1-80B4-00C04FD430C8}", expected: canonical},
+			{key: "urn:uuid:6ba7b810-9dad-11d1-80b4-00c04fd430c8", expected: canonical},
+			{key: "not-a-uuid", expected: "not-a-uuid"},
+			{key: "6ba7b810-9dad-11d1-80b4-00c04fd430cX", expected: "6ba7b810-9dad-11d1-80b4-00c04fd430cX"},
+			{key: "6ba7b810-9dad-11d1-80b4-00c04fd430c8a", expected: "6ba7b810-9dad-11d1-80b4-00c04fd430c8a"},
+			{key: "6ba7b810-9dad11d1-80b4-00c04fd430c8", expected: "6ba7b810-9dad11d1-80b4-00c04fd430c8"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.key, func(t *testing.T) {
+				require.Equal(t, tc.expected, NormalizeUUID(tc.key))
+			})
+		}
+	})
+
+	t.Run("ChainKeyNormalizers applies normalizers in order", func(t *testing.T) {
+		normalize := ChainKeyNormalizers(TrimSpace, NormalizeUUID, LowerCase)
+		require.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", normalize("  {6BA7B810-9DAD-11D1-80B4-00C04FD430C8} "))
+		require.Equal(t, "vertex", normalize(" VERTEX\n"))
+	})
+
+	t.Run("Replica.NormalizeKey keeps keys as is without a normalizer", func(t *testing.T) {
+		require.Equal(t, " Key ", NewReplica("A").NormalizeKey(" Key "))
+
+		r := NewReplica("A")
+		r.KeyNormalizer = LowerCase
+		require.Equal(t, "key", r.NormalizeKey("KEY"))
+	})
+}
@@ -0,0 +1,90 @@
+package lww
+
+import (
+	"sort"
+	"time"
+)
+
+// ActorStats is the contribution of a single actor (replica) to the current state of the graph.
+// It's used for finding out which clients or devices generate most of the replicated data.
+type ActorStats struct {
+	// Actor is the ID of the replica that performed the operations,
+	// empty for operations restored from a state serialized before replica IDs were recorded
+	Actor string
+	// Added is the number of vertices and edges whose current addition was performed by the actor,
+	// including the ones removed later
+	Added int
+	// Removed is the number of vertices and edges whose current removal was performed by the actor
+	Removed int
+	// Bytes is the size of the live vertices and edges added by the actor, measured the same way as the quota usage
+	Bytes int64
+	// LastActivity is the timestamp of the latest operation of the actor
+	LastActivity time.Time
+}
+
+// ActorStats returns the contribution of every actor to the current state of the graph
+// sorted by the contributed bytes from the largest, then by the actor ID.
+//
+// The statistics are computed from the LWW metadata of the state, so only the operations that decide
+// the current state of every vertex and edge are counted, overwritten operations are not known anymore.
+func (g Graph) ActorStats() []ActorStats {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	stats := make(map[string]*ActorStats)
+
+	g.vertices.collectActorStats(stats, func(_ string, e Element) int64 {
+		v, _ := toVertex(e)
+		return vertexSize(v)
+	})
+	for fromKey, adjacent := range g.edges {
+		fromKey := fromKey
+		adjacent.collectActorStats(stats, func(toKey string, _ Element) int64 {
+			return edgeSize(fromKey, toKey)
+		})
+	}
+
+	list := make([]ActorStats, 0, len(stats))
+	for _, s := range stats {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Bytes != list[j].Bytes {
+			return list[i].Bytes > list[j].Bytes
+		}
+		return list[i].Actor < list[j].Actor
+	})
+	return list
+}
+
+// collectActorStats adds the operations of the set to the statistics of their actors,
+// `size` returns the size of the live element with the given key
+func (s Set) collectActorStats(stats map[string]*ActorStats, size func(key string, e Element) int64) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	actor := func(id string, at time.Time) *ActorStats {
+		a, exists := stats[id]
+		if !exists {
+			a = &ActorStats{Actor: id}
+			stats[id] = a
+		}
+		if at.After(a.LastActivity) {
+			a.LastActivity = at
+		}
+		return a
+	}
+
+	for key, record := range s.additions {
+		a := actor(record.Replica, record.Timestamp)
+		a.Added++
+		if !s.removed(key, record) {
+			a.Bytes += size(key, record.Element)
+		}
+	}
+
+	for _, record := range s.removals {
+		actor(record.Replica, record.Timestamp).Removed++
+	}
+}
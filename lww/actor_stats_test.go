@@ -0,0 +1,59 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActorStats(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	ticking := func(id string) crdt.Replica {
+		tick := base
+		return crdt.Replica{ID: id, Clock: clock.Func(func() time.Time {
+			tick = tick.Add(time.Second)
+			return tick
+		})}
+	}
+
+	t.Run("breaks the state down by actors", func(t *testing.T) {
+		phone := NewGraph(ticking("phone"))
+		laptop := NewGraph(ticking("laptop"))
+
+		require.NoError(t, phone.AddVertex(Vertex{Key: "v1", Value: "small"}))
+		require.NoError(t, laptop.AddVertex(Vertex{Key: "v2", Value: "a much larger value"}))
+		require.NoError(t, laptop.AddVertex(Vertex{Key: "v3", Value: "removed"}))
+		replicateGraphs(phone, laptop)
+
+		require.NoError(t, phone.AddEdge("v1", "v2"))
+		require.NoError(t, phone.RemoveVertex("v3"))
+		replicateGraphs(phone, laptop)
+
+		expected := []ActorStats{
+			{Actor: "laptop", Added: 2, Bytes: 2 + 19, LastActivity: base.Add(2 * time.Second)},
+			{Actor: "phone", Added: 2, Removed: 1, Bytes: 2 + 5 + 4, LastActivity: base.Add(3 * time.Second)},
+		}
+		require.Equal(t, expected, phone.ActorStats())
+		require.Equal(t, expected, laptop.ActorStats(), "replicas agree on the statistics")
+	})
+
+	t.Run("counts only the operations deciding the current state", func(t *testing.T) {
+		a := NewGraph(ticking("A"))
+		b := NewGraph(ticking("B"))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1"}))
+		b.Merge(a)
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "v1", Value: "updated"}))
+		a.Merge(b)
+
+		require.Equal(t, []ActorStats{
+			{Actor: "B", Added: 1, Bytes: 9, LastActivity: base.Add(time.Second)},
+		}, a.ActorStats())
+	})
+
+	t.Run("returns an empty list for an empty graph", func(t *testing.T) {
+		require.Empty(t, NewGraph(testReplica).ActorStats())
+	})
+}
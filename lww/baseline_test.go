@@ -0,0 +1,325 @@
+package lww
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkedSet contains the operations compared by `BenchmarkSetBaseline`
+type benchmarkedSet interface {
+	Add(e Element)
+	Lookup(key string) (Element, error)
+	Remove(key string)
+	List() []Element
+}
+
+// baselineRecord is an element of the baseline map with optional last-writer-wins metadata
+type baselineRecord struct {
+	element   Element
+	timestamp time.Time
+	nanos     int64
+	replica   string
+}
+
+// baselineOptions turn the features of `Set` on in the baseline map one by one,
+// so the benchmarks show how much each of them contributes to the overhead
+type baselineOptions struct {
+	// exclusive makes reads take the exclusive lock instead of sharing the read lock
+	exclusive bool
+	// timestamps records the `time.Time` and the replica of every write
+	timestamps bool
+	// nanos records the Unix nanoseconds and the replica of every write instead of `time.Time`
+	nanos bool
+	// wrapErrors wraps the error of a missing element with its key
+	wrapErrors bool
+}
+
+// newBaselineMap returns a map guarded by a lock, the naive alternative to `Set` without tombstones and merging
+func newBaselineMap(opts baselineOptions) *baselineMap {
+	return &baselineMap{opts: opts, records: make(map[string]baselineRecord)}
+}
+
+// baselineMap is a map guarded by a lock implementing `benchmarkedSet`
+type baselineMap struct {
+	mutex   sync.RWMutex
+	opts    baselineOptions
+	records map[string]baselineRecord
+}
+
+func (m *baselineMap) rlock() {
+	if m.opts.exclusive {
+		m.mutex.Lock()
+		return
+	}
+	m.mutex.RLock()
+}
+
+func (m *baselineMap) runlock() {
+	if m.opts.exclusive {
+		m.mutex.Unlock()
+		return
+	}
+	m.mutex.RUnlock()
+}
+
+func (m *baselineMap) Add(e Element) {
+	record := baselineRecord{element: e}
+	switch {
+	case m.opts.timestamps:
+		record.timestamp, record.replica = time.Now(), "A"
+	case m.opts.nanos:
+		record.nanos, record.replica = time.Now().UnixNano(), "A"
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.records[e.GetKey()] = record
+}
+
+func (m *baselineMap) Lookup(key string) (Element, error) {
+	m.rlock()
+	defer m.runlock()
+
+	record, exists := m.records[key]
+	if !exists {
+		if m.opts.wrapErrors {
+			return nil, errors.Wrapf(ErrElementNotFound, "failed to find element [key = %q]", key)
+		}
+		return nil, ErrElementNotFound
+	}
+	return record.element, nil
+}
+
+func (m *baselineMap) Remove(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.records, key)
+}
+
+func (m *baselineMap) List() []Element {
+	m.rlock()
+	defer m.runlock()
+
+	list := make([]Element, 0, len(m.records))
+	for _, record := range m.records {
+		list = append(list, record.element)
+	}
+	return list
+}
+
+// merge copies the records of the other map, the last assignment wins
+func (m *baselineMap) merge(other *baselineMap) {
+	other.rlock()
+	defer other.runlock()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, record := range other.records {
+		m.records[key] = record
+	}
+}
+
+// BenchmarkSetBaseline compares the operations of `Set` with a plain map guarded by a lock.
+// The ratio of `set` and `map` timings of the same operation is the overhead factor of the replication,
+// roughly 3.5 for `Add`, 5 for `Remove`, 2.5 for `Lookup`, 2 for `List` and 1.5 for `Merge`:
+// every write reads the clock and keeps a record with the timestamp and the replica,
+// removals keep a tombstone, reads normalize the key and check the tombstone.
+// The other variants isolate what contributes to it:
+//
+//   - `map+time` and `map+nanos` record the metadata of every write as `time.Time` or Unix nanoseconds,
+//     reading the system clock doubles the cost of a small write while the timestamp type makes no difference;
+//   - `set+fixed` uses a clock returning a constant, which removes about a third of the `Add` and `Remove` cost,
+//     so a cheaper clock (e.g. a coarse or a hybrid logical one) narrows the gap the most;
+//   - `map+wrap` wraps the error of a missing element with its key like `Graph.Lookup` does,
+//     which makes misses allocate and about 30 times slower, `Set.Lookup` returns the bare sentinel error;
+//   - `map+mutex` serializes reads with an exclusive lock, compare the `ParallelLookup` results with `-cpu 1,4,8`,
+//     the shared read lock of `Set` scales with the number of CPUs;
+//   - `set+multi` keeps the values overwritten by concurrent writes (`crdt.Replica.MultiValue`),
+//     which makes `Add` about 3 times slower and allocate the observed versions;
+//   - `set+sorted` and `set+insertion` iterate in a deterministic order (`crdt.Replica.Order`),
+//     it affects only `List` which becomes about 5 and 15 times slower than `set` (120µs and 370µs
+//     instead of 25µs for 1000 elements), the insertion order sorts by the timestamp, the replica and the key;
+//   - `Merge/set+chunked` releases the lock every 100 records (`crdt.Replica.MergeChunk`),
+//     which costs nothing measurable (180µs vs 190µs for 1000 records), so it's safe to enable for fairness;
+//   - `graph+compressed` compresses vertex values over 256 bytes (`crdt.Replica.Compression`, only graphs
+//     compress), for 1KB JSON values `AddVertex` takes 80µs instead of 0.2µs and allocates 1MB for the gzip
+//     writer, `LookupVertex` takes 6µs instead of 33ns, so compression trades a lot of CPU for memory
+//     and suits large, rarely written values.
+//
+// Run it with `go test -run ^$ -bench SetBaseline -benchmem ./lww`.
+func BenchmarkSetBaseline(b *testing.B) {
+	const size = 1000
+	keys := make([]string, size)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("element-%04d", i)
+	}
+	fixed := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	variants := []struct {
+		name string
+		new  func() benchmarkedSet
+	}{
+		{name: "map", new: func() benchmarkedSet { return newBaselineMap(baselineOptions{}) }},
+		{name: "map+time", new: func() benchmarkedSet { return newBaselineMap(baselineOptions{timestamps: true}) }},
+		{name: "map+nanos", new: func() benchmarkedSet { return newBaselineMap(baselineOptions{nanos: true}) }},
+		{name: "map+wrap", new: func() benchmarkedSet { return newBaselineMap(baselineOptions{wrapErrors: true}) }},
+		{name: "map+mutex", new: func() benchmarkedSet { return newBaselineMap(baselineOptions{exclusive: true}) }},
+		{name: "set", new: func() benchmarkedSet { return NewSet(crdt.NewReplica("A")) }},
+		{name: "set+fixed", new: func() benchmarkedSet {
+			return NewSet(crdt.Replica{ID: "A", Clock: clock.Func(func() time.Time { return fixed })})
+		}},
+		{name: "set+multi", new: func() benchmarkedSet { return NewSet(crdt.Replica{ID: "A", MultiValue: true}) }},
+		{name: "set+sorted", new: func() benchmarkedSet { return NewSet(crdt.Replica{ID: "A", Order: crdt.OrderSorted}) }},
+		{name: "set+insertion", new: func() benchmarkedSet {
+			return NewSet(crdt.Replica{ID: "A", Order: crdt.OrderInsertion})
+		}},
+	}
+
+	fill := func(s benchmarkedSet) benchmarkedSet {
+		for _, key := range keys {
+			s.Add(IDElement(key))
+		}
+		return s
+	}
+
+	for _, v := range variants {
+		v := v
+		b.Run("Add/"+v.name, func(b *testing.B) {
+			s := v.new()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s.Add(IDElement(keys[i%size]))
+			}
+		})
+		b.Run("Lookup/"+v.name, func(b *testing.B) {
+			s := fill(v.new())
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = s.Lookup(keys[i%size])
+			}
+		})
+		b.Run("LookupMissing/"+v.name, func(b *testing.B) {
+			s := v.new()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = s.Lookup(keys[i%size])
+			}
+		})
+		b.Run("Remove/"+v.name, func(b *testing.B) {
+			s := fill(v.new())
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Remove(keys[i%size])
+			}
+		})
+		b.Run("List/"+v.name, func(b *testing.B) {
+			s := fill(v.new())
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = s.List()
+			}
+		})
+		b.Run("ParallelLookup/"+v.name, func(b *testing.B) {
+			s := fill(v.new())
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					_, _ = s.Lookup(keys[i%size])
+					i++
+				}
+			})
+		})
+	}
+
+	b.Run("Merge/map", func(b *testing.B) {
+		remote := fill(newBaselineMap(baselineOptions{})).(*baselineMap)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			newBaselineMap(baselineOptions{}).merge(remote)
+		}
+	})
+	b.Run("Merge/set", func(b *testing.B) {
+		remote := fill(NewSet(crdt.NewReplica("B"))).(Set)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			NewSet(crdt.NewReplica("A")).Merge(remote)
+		}
+	})
+	b.Run("Merge/set+chunked", func(b *testing.B) {
+		remote := fill(NewSet(crdt.NewReplica("B"))).(Set)
+		chunked := crdt.NewReplica("A")
+		chunked.MergeChunk = 100
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			NewSet(chunked).Merge(remote)
+		}
+	})
+
+	// compression applies to the vertex values of graphs, the values are JSON documents of about 1KB
+	value := strings.Repeat(`{"field":"value"},`, 60)
+	compressed := crdt.NewReplica("A")
+	compressed.Compression.Threshold = 256
+	for _, v := range []struct {
+		name    string
+		replica crdt.Replica
+	}{
+		{name: "graph", replica: crdt.NewReplica("A")},
+		{name: "graph+compressed", replica: compressed},
+	} {
+		v := v
+		b.Run("AddVertex/"+v.name, func(b *testing.B) {
+			g := NewGraph(v.replica)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = g.UpsertVertex(Vertex{Key: keys[i%size], Value: value})
+			}
+		})
+		b.Run("LookupVertex/"+v.name, func(b *testing.B) {
+			g := NewGraph(v.replica)
+			for _, key := range keys {
+				_ = g.AddVertex(Vertex{Key: key, Value: value})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = g.Lookup(keys[i%size])
+			}
+		})
+	}
+}
+
+// TestSetBaseline makes sure the baseline of `BenchmarkSetBaseline` behaves like the set it's compared with
+func TestSetBaseline(t *testing.T) {
+	for _, opts := range []baselineOptions{{}, {timestamps: true}, {nanos: true}, {wrapErrors: true}, {exclusive: true}} {
+		for _, s := range []benchmarkedSet{newBaselineMap(opts), NewSet(crdt.NewReplica("A"))} {
+			s.Add(IDElement("b"))
+			s.Add(IDElement("a"))
+			s.Add(IDElement("c"))
+			s.Remove("c")
+
+			e, err := s.Lookup("a")
+			require.NoError(t, err)
+			require.Equal(t, IDElement("a"), e)
+			_, err = s.Lookup("c")
+			require.ErrorIs(t, err, ErrElementNotFound)
+
+			list := s.List()
+			sort.Slice(list, func(i, j int) bool { return list[i].GetKey() < list[j].GetKey() })
+			require.Equal(t, []Element{IDElement("a"), IDElement("b")}, list)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package lww
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// EdgeSpec is an edge from a vertex with the key `From`, used by `AddEdges`
+type EdgeSpec struct {
+	// From is the key of the vertex the edge starts from
+	From string
+	// Edge is the edge with the key of the vertex it points to, its weight, label and attributes
+	Edge Edge
+}
+
+// AddVertices adds the given vertices to the graph taking the lock once, it's much faster than calling
+// `AddVertex` for every vertex of a large batch. The whole batch is validated before it's applied,
+// so either all the vertices are added or none of them.
+// Returns an error with `ErrVertexAlreadyExists` cause if one of the keys is already in the graph or in the batch.
+// Returns an error with `crdt.ErrLimitExceeded` cause if the batch would exceed the replica limits.
+// Returns an error with `crdt.ErrInvalidValue` cause if the replica validator rejects one of the values.
+func (g Graph) AddVertices(vertices []Vertex) error {
+	return g.Update(addVertices(vertices))
+}
+
+// AddEdges adds the given edges to the graph taking the lock once like `AddVertices`,
+// every edge is added like with `AddWeightedEdge`, so an existing edge is replaced.
+// Either all the edges are added or none of them.
+// Returns an error with `ErrVertexNotfound` cause if one of the vertices does not exist.
+func (g Graph) AddEdges(edges []EdgeSpec) error {
+	return g.Update(addEdges(edges))
+}
+
+// addVertices returns the transaction adding the batch of vertices, so the graph wrappers
+// can run it with their own `Update`
+func addVertices(vertices []Vertex) func(tx Tx) error {
+	return func(tx Tx) error {
+		for i, v := range vertices {
+			err := tx.AddVertex(v)
+			if err != nil {
+				return errors.Wrapf(err, "failed to add vertex %d of the batch", i)
+			}
+		}
+		return nil
+	}
+}
+
+// addEdges returns the transaction adding the batch of edges, see `addVertices`
+func addEdges(edges []EdgeSpec) func(tx Tx) error {
+	return func(tx Tx) error {
+		for i, spec := range edges {
+			err := tx.AddWeightedEdge(spec.From, spec.Edge)
+			if err != nil {
+				return errors.Wrapf(err, "failed to add edge %d of the batch", i)
+			}
+		}
+		return nil
+	}
+}
+
+// MergeAll merges the states of all the `remotes` taking the lock once, the result is the same as merging
+// them one by one with `Merge` but readers never observe a partially merged batch.
+func (g Graph) MergeAll(remotes ...Graph) {
+	for _, remote := range remotes {
+		g.checkMerge(remote)
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, remote := range remotes {
+		// merging without a tracker cannot fail
+		_ = g.mergeState(remote, nil, nil)
+	}
+}
+
+// Update runs `fn` with a transaction holding the write lock of the graph and applies the changes
+// made in the transaction atomically: if `fn` returns an error nothing is changed and the error is returned.
+//
+// Operations of the transaction see the changes made earlier in the same transaction and fail
+// with the same errors as the graph methods. Only the net effect of the transaction is applied,
+// e.g. a vertex added and removed in the same transaction is never written.
+// All the changes are timestamped when they are applied, other replicas see them as ordinary operations.
+//
+// `fn` must not call the methods of the graph, use the transaction methods instead.
+func (g Graph) Update(fn func(tx Tx) error) error {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	tx := Tx{
+		graph: g,
+		state: &txState{
+			vertices: make(map[string]*Vertex),
+			edges:    make(map[string]map[string]*Edge),
+		},
+	}
+	if g.replica.Limits.MaxElements > 0 {
+		tx.state.count = len(g.vertices.List())
+	}
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	tx.apply()
+	return nil
+}
+
+// Tx is a transaction of the graph, see `Graph.Update`.
+// It's valid only until `fn` passed to `Graph.Update` returns and must not be used from other go routines.
+type Tx struct {
+	// graph is the graph the transaction changes
+	graph Graph
+	// state contains the staged changes
+	state *txState
+}
+
+// txState contains the changes staged in a transaction
+type txState struct {
+	// vertices maps a normalized vertex key to the staged vertex, nil if the vertex is removed
+	vertices map[string]*Vertex
+	// edges maps normalized keys of the vertices an edge connects to the staged edge, nil if the edge is removed
+	edges map[string]map[string]*Edge
+	// count is the number of vertices with the staged changes, it's maintained only if the replica
+	// limits the number of elements
+	count int
+}
+
+// Lookup returns the vertex with the given key including the changes staged in the transaction,
+// see `Graph.Lookup`.
+func (tx Tx) Lookup(key string) (Vertex, error) {
+	staged, isStaged := tx.state.vertices[tx.graph.replica.NormalizeKey(key)]
+	if !isStaged {
+		return tx.graph.Lookup(key)
+	}
+	if staged == nil {
+		return Vertex{}, errors.Wrapf(ErrVertexNotFound, "failed to find vertex [key = %q]", key)
+	}
+	return *staged, nil
+}
+
+// AddVertex stages the addition of the given vertex, see `Graph.AddVertex`
+func (tx Tx) AddVertex(v Vertex) error {
+	_, err := tx.Lookup(v.Key)
+	if err == nil {
+		return errors.Wrapf(ErrVertexAlreadyExists, "vertex [key = %q]", v.Key)
+	}
+	if !errors.Is(err, ErrVertexNotFound) {
+		return err
+	}
+
+	replica := tx.graph.replica
+	if replica.Limits.MaxElements > 0 {
+		err = replica.CheckLimit(tx.state.count)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = replica.ValidateValue(v.Key, v.Value)
+	if err != nil {
+		return err
+	}
+
+	tx.stageVertex(v.Key, &v)
+	tx.state.count++
+	return nil
+}
+
+// UpdateVertex stages the update of the existing vertex with the key `v.Key`, see `Graph.UpdateVertex`
+func (tx Tx) UpdateVertex(v Vertex) error {
+	_, err := tx.Lookup(v.Key)
+	if err != nil {
+		return err
+	}
+
+	err = tx.graph.replica.ValidateValue(v.Key, v.Value)
+	if err != nil {
+		return err
+	}
+
+	tx.stageVertex(v.Key, &v)
+	return nil
+}
+
+// RemoveVertex stages the removal of the vertex with the given key, see `Graph.RemoveVertex`
+func (tx Tx) RemoveVertex(key string) error {
+	_, err := tx.Lookup(key)
+	if err != nil {
+		return err
+	}
+
+	tx.stageVertex(key, nil)
+	tx.state.count--
+	return nil
+}
+
+// AddEdge stages the addition of the edge from a vertex with `fromKey` to a vertex with `toKey`,
+// see `Graph.AddEdge`.
+func (tx Tx) AddEdge(fromKey, toKey string) error {
+	err := tx.checkVertices(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+
+	edge, exists := tx.edge(fromKey, toKey)
+	if !exists {
+		edge = Edge{To: toKey}
+	}
+	tx.stageEdge(fromKey, toKey, &edge)
+	return nil
+}
+
+// AddWeightedEdge stages the addition of the edge from a vertex with `fromKey` to a vertex with `edge.To`,
+// see `Graph.AddWeightedEdge`.
+func (tx Tx) AddWeightedEdge(fromKey string, edge Edge) error {
+	err := tx.checkVertices(fromKey, edge.To)
+	if err != nil {
+		return err
+	}
+
+	edge = edge.clone()
+	tx.stageEdge(fromKey, edge.To, &edge)
+	return nil
+}
+
+// RemoveEdge stages the removal of the edge from a vertex with `fromKey` to a vertex with `toKey`,
+// see `Graph.RemoveEdge`.
+func (tx Tx) RemoveEdge(fromKey, toKey string) error {
+	err := tx.checkVertices(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+
+	tx.stageEdge(fromKey, toKey, nil)
+	return nil
+}
+
+// checkVertices returns an error with `ErrVertexNotFound` cause if one of the vertices does not exist
+func (tx Tx) checkVertices(fromKey, toKey string) error {
+	_, err := tx.Lookup(fromKey)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Lookup(toKey)
+	return err
+}
+
+// edge returns the current edge including the staged changes
+func (tx Tx) edge(fromKey, toKey string) (Edge, bool) {
+	normalize := tx.graph.replica.NormalizeKey
+	staged, isStaged := tx.state.edges[normalize(fromKey)][normalize(toKey)]
+	if isStaged {
+		if staged == nil {
+			return Edge{}, false
+		}
+		return *staged, true
+	}
+
+	adjacent, exists := tx.graph.edges[normalize(fromKey)]
+	if !exists {
+		return Edge{}, false
+	}
+	element, err := adjacent.Lookup(toKey)
+	if err != nil {
+		return Edge{}, false
+	}
+	return toEdge(element).clone(), true
+}
+
+// stageVertex stages the vertex with the given key, nil stages the removal
+func (tx Tx) stageVertex(key string, v *Vertex) {
+	tx.state.vertices[tx.graph.replica.NormalizeKey(key)] = v
+}
+
+// stageEdge stages the edge between the vertices with the given keys, nil stages the removal
+func (tx Tx) stageEdge(fromKey, toKey string, edge *Edge) {
+	fromKey = tx.graph.replica.NormalizeKey(fromKey)
+	if tx.state.edges[fromKey] == nil {
+		tx.state.edges[fromKey] = make(map[string]*Edge)
+	}
+	tx.state.edges[fromKey][tx.graph.replica.NormalizeKey(toKey)] = edge
+}
+
+// apply applies the net effect of the staged changes to the graph in the key order
+func (tx Tx) apply() {
+	g := tx.graph
+	changes := g.trackChanges(false)
+	defer changes.publish()
+
+	keys := make([]string, 0, len(tx.state.vertices))
+	for key := range tx.state.vertices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		changes.vertex(key)
+		v := tx.state.vertices[key]
+		if v != nil {
+			g.vertices.Add(g.compressVertex(*v))
+			continue
+		}
+		// vertices added and removed in the same transaction are never written
+		if _, err := g.Lookup(key); err == nil {
+			g.vertices.Remove(key)
+		}
+	}
+
+	fromKeys := make([]string, 0, len(tx.state.edges))
+	for fromKey := range tx.state.edges {
+		fromKeys = append(fromKeys, fromKey)
+	}
+	sort.Strings(fromKeys)
+
+	for _, fromKey := range fromKeys {
+		adjacent := g.getAdjacent(fromKey)
+		staged := tx.state.edges[fromKey]
+		toKeys := make([]string, 0, len(staged))
+		for toKey := range staged {
+			toKeys = append(toKeys, toKey)
+		}
+		sort.Strings(toKeys)
+
+		for _, toKey := range toKeys {
+			changes.edge(fromKey, toKey)
+			edge := staged[toKey]
+			if edge != nil {
+				adjacent.Add(*edge)
+			} else if _, err := adjacent.Lookup(toKey); err == nil {
+				adjacent.Remove(toKey)
+			}
+			g.indexEdge(fromKey, toKey)
+		}
+	}
+}
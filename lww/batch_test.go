@@ -0,0 +1,136 @@
+package lww
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	sorted := crdt.Replica{ID: "A", Order: crdt.OrderSorted}
+
+	t.Run("AddVertices adds all the vertices or none", func(t *testing.T) {
+		g := NewGraph(sorted)
+		var vertices []Vertex
+		for i := 1; i <= 100; i++ {
+			vertices = append(vertices, Vertex{Key: fmt.Sprintf("v%03d", i)})
+		}
+		require.NoError(t, g.AddVertices(vertices))
+		list, err := g.List()
+		require.NoError(t, err)
+		require.Len(t, list, 100)
+
+		err = g.AddVertices([]Vertex{{Key: "w1"}, {Key: "w2"}, {Key: "w1"}})
+		require.ErrorIs(t, err, ErrVertexAlreadyExists, "duplicates in the batch")
+		err = g.AddVertices([]Vertex{{Key: "w1"}, {Key: "v001"}})
+		require.ErrorIs(t, err, ErrVertexAlreadyExists)
+		_, err = g.Lookup("w1")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("AddVertices checks limits and values", func(t *testing.T) {
+		r := sorted
+		r.Limits.MaxElements = 3
+		r.Validator = crdt.ValidatorFunc(func(key, value string) error {
+			if value == "invalid" {
+				return crdt.ErrInvalidValue
+			}
+			return nil
+		})
+		g := NewGraph(r)
+		require.NoError(t, g.AddVertex(Vertex{Key: "v1"}))
+
+		err := g.AddVertices([]Vertex{{Key: "v2"}, {Key: "v3"}, {Key: "v4"}})
+		require.ErrorIs(t, err, crdt.ErrLimitExceeded)
+		err = g.AddVertices([]Vertex{{Key: "v2"}, {Key: "v3", Value: "invalid"}})
+		require.ErrorIs(t, err, crdt.ErrInvalidValue)
+		require.NoError(t, g.AddVertices([]Vertex{{Key: "v2"}, {Key: "v3"}}))
+	})
+
+	t.Run("AddEdges adds all the edges or none", func(t *testing.T) {
+		g := NewGraph(sorted)
+		require.NoError(t, g.AddVertices([]Vertex{{Key: "v1"}, {Key: "v2"}, {Key: "v3"}}))
+
+		err := g.AddEdges([]EdgeSpec{{From: "v1", Edge: Edge{To: "v2"}}, {From: "v1", Edge: Edge{To: "v4"}}})
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		_, err = g.GetEdge("v1", "v2")
+		require.ErrorIs(t, err, ErrEdgeNotFound)
+
+		require.NoError(t, g.AddEdges([]EdgeSpec{
+			{From: "v1", Edge: Edge{To: "v2", Label: "knows"}},
+			{From: "v2", Edge: Edge{To: "v3"}},
+		}))
+		edge, err := g.GetEdge("v1", "v2")
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: "v2", Label: "knows"}, edge)
+		path, err := g.FindPath("v1", "v3")
+		require.NoError(t, err)
+		require.Len(t, path, 3)
+		predecessors, err := g.FindPredecessors("v3")
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{{Key: "v2"}}, predecessors)
+	})
+
+	t.Run("Update applies the net effect atomically", func(t *testing.T) {
+		g := NewGraph(sorted)
+		require.NoError(t, g.AddVertices([]Vertex{{Key: "v1"}, {Key: "v2"}}))
+		require.NoError(t, g.AddWeightedEdge("v1", Edge{To: "v2", Label: "knows"}))
+
+		err := g.Update(func(tx Tx) error {
+			require.NoError(t, tx.AddVertex(Vertex{Key: "v3"}))
+			require.NoError(t, tx.AddEdge("v2", "v3"))
+			return fmt.Errorf("rollback")
+		})
+		require.EqualError(t, err, "rollback")
+		_, err = g.Lookup("v3")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+
+		err = g.Update(func(tx Tx) error {
+			require.NoError(t, tx.AddVertex(Vertex{Key: "v3"}))
+			require.NoError(t, tx.UpdateVertex(Vertex{Key: "v3", Value: "updated"}))
+			found, err := tx.Lookup("v3")
+			require.NoError(t, err)
+			require.Equal(t, "updated", found.Value)
+
+			require.NoError(t, tx.AddEdge("v1", "v2"), "keeps the label")
+			require.NoError(t, tx.AddEdge("v2", "v3"))
+			require.NoError(t, tx.RemoveEdge("v2", "v3"))
+
+			require.NoError(t, tx.AddVertex(Vertex{Key: "v4"}))
+			require.NoError(t, tx.RemoveVertex("v4"))
+			_, err = tx.Lookup("v4")
+			require.ErrorIs(t, err, ErrVertexNotFound)
+			require.ErrorIs(t, tx.AddEdge("v1", "v4"), ErrVertexNotFound)
+
+			require.NoError(t, tx.RemoveVertex("v2"))
+			return nil
+		})
+		require.NoError(t, err)
+
+		found, err := g.Lookup("v3")
+		require.NoError(t, err)
+		require.Equal(t, "updated", found.Value)
+		_, err = g.Lookup("v2")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		require.NotContains(t, g.vertices.additions, "v4", "never written")
+		element, err := g.edges["v1"].Lookup("v2")
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: "v2", Label: "knows"}, element)
+	})
+
+	t.Run("MergeAll merges every remote", func(t *testing.T) {
+		g := NewGraph(crdt.NewReplica("A"))
+		var remotes []Graph
+		for _, id := range []string{"B", "C", "D"} {
+			remote := NewGraph(crdt.NewReplica(id))
+			require.NoError(t, remote.AddVertex(Vertex{Key: id}))
+			remotes = append(remotes, remote)
+		}
+		g.MergeAll(remotes...)
+		list, err := g.List()
+		require.NoError(t, err)
+		require.Len(t, list, 3)
+	})
+}
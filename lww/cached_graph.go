@@ -0,0 +1,291 @@
+package lww
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+// DefaultCacheEntries is the default maximum number of cached results of a cached graph
+const DefaultCacheEntries = 10000
+
+// CacheConfig contains the settings of a cached graph
+type CacheConfig struct {
+	// MaxEntries is the maximum number of cached results of each query,
+	// `DefaultCacheEntries` if it's not positive. An arbitrary entry is evicted when the cache is full.
+	MaxEntries int
+	// Buffer is the number of change events waiting for invalidation, see `crdt.SubscriptionConfig`
+	Buffer int
+}
+
+// NewCachedGraph wraps the graph caching the results of `Lookup` and `FindConnected`.
+// Close the cached graph when it's no longer needed.
+func NewCachedGraph(g Graph, config CacheConfig) CachedGraph {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultCacheEntries
+	}
+	c := CachedGraph{
+		Graph:  g,
+		config: config,
+		mutex:  &sync.Mutex{},
+		state: &cacheState{
+			lookups:    make(map[string]cachedLookup),
+			connected:  make(map[string]cachedConnected),
+			dependents: make(map[string]map[string]nothing),
+			done:       make(chan struct{}),
+		},
+	}
+	c.state.subscription = c.subscribe()
+	go c.invalidate(c.state.subscription)
+	return c
+}
+
+// CachedGraph serves `Lookup` and `FindConnected` from cached results, so services with many readers
+// and few writes don't traverse the graph for every request.
+// Use `NewCachedGraph` in order to initialize it before use.
+//
+// The cached results are invalidated precisely by the change events of the graph (see `Graph.Subscribe`):
+// a `FindConnected` result is dropped only when the start vertex, one of the found vertices or their edges change.
+// Events are delivered asynchronously, so the cache is eventually consistent:
+// a read right after a write or a merge may return the previous result.
+// If the invalidation can't keep up with the changes, the whole cache is dropped.
+//
+// Hits and misses are counted in the replica metrics as `lww.cache.hit` and `lww.cache.miss`.
+// All the other methods of the graph are not cached.
+// The cached graph is thread-safe and can be used from several go routines.
+type CachedGraph struct {
+	Graph
+
+	// config contains the cache settings
+	config CacheConfig
+	// mutex is used for the thread-safety of the state
+	mutex *sync.Mutex
+	// state is shared by all the copies of the cached graph
+	state *cacheState
+}
+
+// cacheState contains the cached results
+type cacheState struct {
+	// lookups maps a vertex key to the cached result of `Lookup`
+	lookups map[string]cachedLookup
+	// connected maps a start vertex key to the cached result of `FindConnected`
+	connected map[string]cachedConnected
+	// dependents maps a vertex key to the start keys of the `FindConnected` results depending on it
+	dependents map[string]map[string]nothing
+	// generation is incremented on every invalidation, so results computed before it are not cached
+	generation uint64
+	// subscription receives the change events of the graph
+	subscription crdt.Subscription
+	// done is closed when the cached graph is closed
+	done chan struct{}
+	// closed is `true` when the cached graph is closed
+	closed bool
+}
+
+// cachedLookup is the result of `Lookup`
+type cachedLookup struct {
+	vertex Vertex
+	err    error
+}
+
+// cachedConnected is the result of `FindConnected` and the keys of the vertices it depends on
+type cachedConnected struct {
+	connected []Vertex
+	err       error
+	deps      []string
+}
+
+// Lookup works like `Graph.Lookup` returning the cached result if it's available
+func (c CachedGraph) Lookup(key string) (Vertex, error) {
+	key = c.replica.NormalizeKey(key)
+
+	c.mutex.Lock()
+	cached, hit := c.state.lookups[key]
+	generation := c.state.generation
+	c.mutex.Unlock()
+
+	if hit {
+		c.replica.Metrics.Count("lww.cache.hit", 1)
+		return cached.vertex, cached.err
+	}
+	c.replica.Metrics.Count("lww.cache.miss", 1)
+
+	v, err := c.Graph.Lookup(key)
+	if err != nil && !errors.Is(err, ErrVertexNotFound) {
+		return v, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.state.generation == generation && !c.state.closed {
+		if len(c.state.lookups) >= c.config.MaxEntries {
+			for evicted := range c.state.lookups {
+				delete(c.state.lookups, evicted)
+				break
+			}
+		}
+		c.state.lookups[key] = cachedLookup{vertex: v, err: err}
+	}
+	return v, err
+}
+
+// FindConnected works like `Graph.FindConnected` returning the cached result if it's available.
+// The returned list must not be modified.
+func (c CachedGraph) FindConnected(key string) ([]Vertex, error) {
+	key = c.replica.NormalizeKey(key)
+
+	c.mutex.Lock()
+	cached, hit := c.state.connected[key]
+	generation := c.state.generation
+	c.mutex.Unlock()
+
+	if hit {
+		c.replica.Metrics.Count("lww.cache.hit", 1)
+		return cached.connected, cached.err
+	}
+	c.replica.Metrics.Count("lww.cache.miss", 1)
+
+	cached, err := c.findConnected(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.state.generation == generation && !c.state.closed {
+		if len(c.state.connected) >= c.config.MaxEntries {
+			for evicted := range c.state.connected {
+				c.dropConnected(evicted)
+				break
+			}
+		}
+		c.state.connected[key] = cached
+		for _, dep := range cached.deps {
+			if c.state.dependents[dep] == nil {
+				c.state.dependents[dep] = make(map[string]nothing)
+			}
+			c.state.dependents[dep][key] = nothing{}
+		}
+	}
+	return cached.connected, cached.err
+}
+
+// Close stops the invalidation and drops the cache, the wrapped graph remains usable
+func (c CachedGraph) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.state.closed {
+		return
+	}
+	c.state.closed = true
+	close(c.state.done)
+	c.state.subscription.Close()
+	c.flush()
+}
+
+// findConnected returns the result of `FindConnected` with the keys of the start vertex, the found vertices
+// and the vertices their edges point to including the removed ones, so re-adding them invalidates the result.
+// Returns an error only if the result can't be cached.
+func (c CachedGraph) findConnected(key string) (cachedConnected, error) {
+	c.checkUsage()
+	c.Graph.mutex.RLock()
+	defer c.Graph.mutex.RUnlock()
+
+	connected, err := c.Graph.findConnected(nil, key, EdgeFilter{})
+	if err != nil && !errors.Is(err, ErrVertexNotFound) {
+		return cachedConnected{}, err
+	}
+
+	deps := []string{key}
+	for _, v := range connected {
+		deps = append(deps, v.Key)
+	}
+	found := len(deps)
+	for _, fromKey := range deps[:found] {
+		for _, adjacent := range c.Graph.listAdjacent(fromKey) {
+			deps = append(deps, adjacent.GetKey())
+		}
+	}
+	return cachedConnected{connected: connected, err: err, deps: deps}, nil
+}
+
+// subscribe subscribes to the changes of the graph
+func (c CachedGraph) subscribe() crdt.Subscription {
+	return c.Graph.Subscribe(crdt.SubscriptionConfig{
+		Buffer:   c.config.Buffer,
+		Overflow: crdt.OverflowDisconnect,
+	})
+}
+
+// invalidate drops the cached results affected by the events of the subscription until the cached graph is closed.
+// If the subscription is disconnected, it subscribes again and drops the whole cache.
+func (c CachedGraph) invalidate(subscription crdt.Subscription) {
+	for {
+		select {
+		case <-c.state.done:
+			return
+		case e, ok := <-subscription.Events():
+			c.mutex.Lock()
+			if c.state.closed {
+				c.mutex.Unlock()
+				return
+			}
+			if !ok {
+				// some events are lost, so any result can be stale
+				c.replica.Metrics.Count("lww.cache.flush", 1)
+				subscription = c.subscribe()
+				c.state.subscription = subscription
+				c.flush()
+				c.mutex.Unlock()
+				continue
+			}
+			c.apply(e.(GraphEvent))
+			c.mutex.Unlock()
+		}
+	}
+}
+
+// apply drops the cached results affected by the event, must be called under the lock
+func (c CachedGraph) apply(e GraphEvent) {
+	if e.Type == ValidationRejected {
+		// rejected values do not change the graph
+		return
+	}
+	c.state.generation++
+
+	key := e.Vertex.Key
+	if e.Type.edge() {
+		key = e.From
+	} else {
+		delete(c.state.lookups, c.replica.NormalizeKey(key))
+	}
+
+	for start := range c.state.dependents[c.replica.NormalizeKey(key)] {
+		c.dropConnected(start)
+	}
+}
+
+// dropConnected drops the cached `FindConnected` result of the start key, must be called under the lock
+func (c CachedGraph) dropConnected(start string) {
+	cached, exists := c.state.connected[start]
+	if !exists {
+		return
+	}
+	delete(c.state.connected, start)
+	for _, dep := range cached.deps {
+		delete(c.state.dependents[dep], start)
+		if len(c.state.dependents[dep]) == 0 {
+			delete(c.state.dependents, dep)
+		}
+	}
+}
+
+// flush drops all the cached results, must be called under the lock
+func (c CachedGraph) flush() {
+	c.state.generation++
+	c.state.lookups = make(map[string]cachedLookup)
+	c.state.connected = make(map[string]cachedConnected)
+	c.state.dependents = make(map[string]map[string]nothing)
+}
@@ -0,0 +1,136 @@
+package lww
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+// cacheMetrics records the cache counters
+type cacheMetrics struct {
+	mutex    sync.Mutex
+	counters map[string]int64
+}
+
+func (m *cacheMetrics) Count(name string, delta int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.counters[name] += delta
+}
+
+func (m *cacheMetrics) get(name string) int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.counters[name]
+}
+
+func TestCachedGraph(t *testing.T) {
+	newCachedGraph := func(t *testing.T) (CachedGraph, *cacheMetrics) {
+		metrics := &cacheMetrics{counters: make(map[string]int64)}
+		r := crdt.NewReplica("A")
+		r.Metrics = metrics
+		g := NewGraph(r)
+		for _, key := range []string{"v1", "v2", "v3", "v4"} {
+			require.NoError(t, g.AddVertex(Vertex{Key: key, Value: key}))
+		}
+		require.NoError(t, g.AddEdge("v1", "v2"))
+		require.NoError(t, g.AddEdge("v3", "v4"))
+
+		c := NewCachedGraph(g, CacheConfig{})
+		t.Cleanup(c.Close)
+		return c, metrics
+	}
+	// eventually waits until the cached result of `FindConnected` of the key is as expected
+	eventually := func(t *testing.T, c CachedGraph, key string, expected []string) {
+		require.Eventually(t, func() bool {
+			connected, _ := c.FindConnected(key)
+			keys := []string{}
+			for _, v := range connected {
+				keys = append(keys, v.Key+"="+v.Value)
+			}
+			return reflect.DeepEqual(expected, keys)
+		}, time.Second, time.Millisecond)
+	}
+
+	t.Run("serves repeated reads from the cache", func(t *testing.T) {
+		c, metrics := newCachedGraph(t)
+
+		for i := 0; i < 3; i++ {
+			v, err := c.Lookup("v1")
+			require.NoError(t, err)
+			require.Equal(t, "v1", v.Value)
+			_, err = c.Lookup("missing")
+			require.ErrorIs(t, err, ErrVertexNotFound)
+
+			connected, err := c.FindConnected("v1")
+			require.NoError(t, err)
+			require.Equal(t, []Vertex{{Key: "v2", Value: "v2"}}, connected)
+		}
+		require.Equal(t, int64(3), metrics.get("lww.cache.miss"))
+		require.Equal(t, int64(6), metrics.get("lww.cache.hit"))
+	})
+
+	t.Run("invalidates only the affected results", func(t *testing.T) {
+		c, metrics := newCachedGraph(t)
+		eventually(t, c, "v1", []string{"v2=v2"})
+		eventually(t, c, "v3", []string{"v4=v4"})
+
+		require.NoError(t, c.UpdateVertex(Vertex{Key: "v2", Value: "updated"}))
+		eventually(t, c, "v1", []string{"v2=updated"})
+
+		misses := metrics.get("lww.cache.miss")
+		eventually(t, c, "v3", []string{"v4=v4"})
+		require.Equal(t, misses, metrics.get("lww.cache.miss"), "unrelated results stay cached")
+
+		require.NoError(t, c.AddEdge("v2", "v3"))
+		eventually(t, c, "v1", []string{"v2=updated", "v3=v3", "v4=v4"})
+
+		_, err := c.Lookup("v5")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		require.NoError(t, c.AddVertex(Vertex{Key: "v5"}))
+		require.Eventually(t, func() bool {
+			_, err := c.Lookup("v5")
+			return err == nil
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("invalidates results restored by re-adding a vertex and by merges", func(t *testing.T) {
+		c, _ := newCachedGraph(t)
+		require.NoError(t, c.RemoveVertex("v2"))
+		eventually(t, c, "v1", []string{})
+
+		require.NoError(t, c.AddVertex(Vertex{Key: "v2", Value: "again"}))
+		eventually(t, c, "v1", []string{"v2=again"})
+
+		remote := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v2", Value: "merged"}))
+		c.Merge(remote)
+		eventually(t, c, "v1", []string{"v2=merged"})
+	})
+
+	t.Run("drops the cache when the invalidation can't keep up", func(t *testing.T) {
+		metrics := &cacheMetrics{counters: make(map[string]int64)}
+		r := crdt.NewReplica("A")
+		r.Metrics = metrics
+		g := NewGraph(r)
+		require.NoError(t, g.AddVertex(Vertex{Key: "v1"}))
+		c := NewCachedGraph(g, CacheConfig{Buffer: 1})
+		defer c.Close()
+
+		c.mutex.Lock()
+		for i := 0; i < 10; i++ {
+			require.NoError(t, g.UpdateVertex(Vertex{Key: "v1", Value: time.Now().String()}))
+		}
+		c.mutex.Unlock()
+
+		require.Eventually(t, func() bool {
+			return metrics.get("lww.cache.flush") > 0
+		}, time.Second, time.Millisecond)
+	})
+}
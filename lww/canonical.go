@@ -0,0 +1,126 @@
+package lww
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CanonicalTimeFormat is the format of the timestamps in the canonical form of the graph,
+// timestamps are always converted to UTC before formatting
+const CanonicalTimeFormat = time.RFC3339Nano
+
+// CanonicalVertex is a vertex of the canonical form of the graph with its LWW metadata and outgoing edges
+type CanonicalVertex struct {
+	// Key is the key of the vertex
+	Key string `json:"key"`
+	// Value is the value of the vertex
+	Value string `json:"value"`
+	// AddedAt is when the vertex was added in `CanonicalTimeFormat`
+	AddedAt string `json:"addedAt"`
+	// AddedBy is the ID of the replica that added the vertex
+	AddedBy string `json:"addedBy,omitempty"`
+	// Edges contains the outgoing edges sorted by the keys of the vertices they point to
+	Edges []CanonicalEdge `json:"edges"`
+}
+
+// CanonicalEdge is an edge of the canonical form of the graph with its LWW metadata
+type CanonicalEdge struct {
+	// To is the key of the vertex the edge points to
+	To string `json:"to"`
+	// Weight is the total weight of the edge including the counter weight changed by `AddEdgeWeight`
+	Weight int64 `json:"weight,omitempty"`
+	// Label is the label of the edge
+	Label string `json:"label,omitempty"`
+	// Attributes are the attributes of the edge, they're serialized with sorted keys
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// AddedAt is when the edge was added in `CanonicalTimeFormat`
+	AddedAt string `json:"addedAt"`
+	// AddedBy is the ID of the replica that added the edge
+	AddedBy string `json:"addedBy,omitempty"`
+}
+
+// CanonicalList returns the current state of the graph in the canonical form:
+// vertices sorted by their keys, each with its edges sorted by their keys and timestamps in UTC.
+// Unlike `List`, it includes the edge data and who added each vertex and edge and when.
+// The result is the same for the same graph state regardless of the history of operations and merges
+// that produced it.
+func (g Graph) CanonicalList() (list []CanonicalVertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	list = []CanonicalVertex{}
+
+	vertices := g.vertices.List()
+	sort.Slice(vertices, func(i, j int) bool {
+		return vertices[i].GetKey() < vertices[j].GetKey()
+	})
+
+	for _, element := range vertices {
+		vertex, err := g.Lookup(element.GetKey())
+		if err != nil {
+			return nil, err
+		}
+		write, err := g.vertices.LastWrite(vertex.Key)
+		if err != nil {
+			return nil, errors.Wrapf(ErrVertexNotFound, "no operations for vertex [key = %q]", vertex.Key)
+		}
+
+		fromKey := g.replica.NormalizeKey(vertex.Key)
+		adjacent := g.listAdjacent(fromKey)
+		cv := CanonicalVertex{
+			Key:     vertex.Key,
+			Value:   vertex.Value,
+			AddedAt: canonicalTime(write.Timestamp),
+			AddedBy: write.Replica,
+			Edges:   make([]CanonicalEdge, 0, len(adjacent)),
+		}
+
+		for _, element := range adjacent {
+			edge := toEdge(element).clone()
+			write, err := g.edges[fromKey].LastWrite(edge.To)
+			if err != nil {
+				return nil, errors.Wrapf(ErrEdgeNotFound, "no operations for edge [from = %q, to = %q]", vertex.Key, edge.To)
+			}
+			cv.Edges = append(cv.Edges, CanonicalEdge{
+				To:         edge.To,
+				Weight:     g.edgeWeight(fromKey, edge.To),
+				Label:      edge.Label,
+				Attributes: edge.Attributes,
+				AddedAt:    canonicalTime(write.Timestamp),
+				AddedBy:    write.Replica,
+			})
+		}
+		sort.Slice(cv.Edges, func(i, j int) bool {
+			return cv.Edges[i].To < cv.Edges[j].To
+		})
+
+		list = append(list, cv)
+	}
+
+	return list, nil
+}
+
+// CanonicalJSON returns `CanonicalList` serialized as indented JSON ending with a new line.
+// The output is byte-stable across runs and platforms for the same graph state,
+// so it can be stored in golden files and compared in tests.
+func (g Graph) CanonicalJSON() ([]byte, error) {
+	list, err := g.CanonicalList()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal canonical list")
+	}
+	return append(data, '\n'), nil
+}
+
+// canonicalTime formats the timestamp in `CanonicalTimeFormat` in UTC
+func canonicalTime(t time.Time) string {
+	return t.UTC().Format(CanonicalTimeFormat)
+}
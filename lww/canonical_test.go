@@ -0,0 +1,110 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonical(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	ticking := func(id string, offset time.Duration) crdt.Replica {
+		tick := base.Add(offset)
+		return crdt.Replica{ID: id, Clock: clock.Func(func() time.Time {
+			tick = tick.Add(time.Second)
+			return tick
+		})}
+	}
+
+	t.Run("produces the golden output", func(t *testing.T) {
+		g := NewGraph(ticking("A", 0))
+		require.NoError(t, g.AddVertex(Vertex{Key: "v2", Value: "b"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "v1", Value: "a"}))
+		require.NoError(t, g.AddWeightedEdge("v1", Edge{
+			To:         "v2",
+			Weight:     3,
+			Label:      "road",
+			Attributes: map[string]string{"z": "last", "a": "first"},
+		}))
+		require.NoError(t, g.AddEdgeWeight("v1", "v2", 2))
+		require.NoError(t, g.AddEdge("v2", "v1"))
+
+		data, err := g.CanonicalJSON()
+		require.NoError(t, err)
+		require.Equal(t, `[
+  {
+    "key": "v1",
+    "value": "a",
+    "addedAt": "2021-09-01T08:00:02Z",
+    "addedBy": "A",
+    "edges": [
+      {
+        "to": "v2",
+        "weight": 5,
+        "label": "road",
+        "attributes": {
+          "a": "first",
+          "z": "last"
+        },
+        "addedAt": "2021-09-01T08:00:03Z",
+        "addedBy": "A"
+      }
+    ]
+  },
+  {
+    "key": "v2",
+    "value": "b",
+    "addedAt": "2021-09-01T08:00:01Z",
+    "addedBy": "A",
+    "edges": [
+      {
+        "to": "v1",
+        "addedAt": "2021-09-01T08:00:04Z",
+        "addedBy": "A"
+      }
+    ]
+  }
+]
+`, string(data))
+	})
+
+	t.Run("does not depend on the merge order", func(t *testing.T) {
+		a := NewGraph(ticking("A", 0))
+		b := NewGraph(ticking("B", 0))
+		for i, key := range []string{"v3", "v1", "v2"} {
+			require.NoError(t, a.AddVertex(Vertex{Key: key, Value: "from A"}))
+			require.NoError(t, b.AddVertex(Vertex{Key: key, Value: "from B"}))
+			if i > 0 {
+				require.NoError(t, a.AddEdge(key, "v3"))
+			}
+		}
+		require.NoError(t, b.AddEdge("v3", "v1"))
+
+		ab := NewGraph(testReplica)
+		ab.Merge(a)
+		ab.Merge(b)
+		ba := NewGraph(testReplica)
+		ba.Merge(b)
+		ba.Merge(a)
+
+		expected, err := ab.CanonicalJSON()
+		require.NoError(t, err)
+		actual, err := ba.CanonicalJSON()
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(actual))
+
+		list, err := ab.CanonicalList()
+		require.NoError(t, err)
+		require.Len(t, list, 3)
+		require.Equal(t, "from B", list[0].Value, "the greater replica ID wins on equal timestamps")
+	})
+
+	t.Run("exports an empty graph as an empty list", func(t *testing.T) {
+		data, err := NewGraph(testReplica).CanonicalJSON()
+		require.NoError(t, err)
+		require.Equal(t, "[]\n", string(data))
+	})
+}
@@ -0,0 +1,154 @@
+package lww
+
+import (
+	"sort"
+)
+
+// StronglyConnectedComponents returns the keys of the vertices grouped by strongly connected components:
+// every vertex of a component is connected to every other vertex of the same component by a directed path.
+// A vertex which is not on a cycle is a component of its own.
+//
+// Keys in every component are sorted and the components are sorted by their first key,
+// so the result is deterministic. Edges pointing to removed vertices are ignored.
+func (g Graph) StronglyConnectedComponents() (components [][]string, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	vertices, err := g.sortedVertices()
+	if err != nil {
+		return nil, err
+	}
+
+	// Tarjan's algorithm
+	index := make(map[string]int, len(vertices))
+	lowLink := make(map[string]int, len(vertices))
+	onStack := make(map[string]nothing)
+	stack := []string{}
+	components = [][]string{}
+
+	var visit func(key string) error
+	visit = func(key string) error {
+		index[key] = len(index)
+		lowLink[key] = index[key]
+		stack = append(stack, key)
+		onStack[key] = nothing{}
+
+		adjacent, err := g.sortedAdjacent(key)
+		if err != nil {
+			return err
+		}
+		for _, to := range adjacent {
+			if _, visited := index[to.Key]; !visited {
+				err = visit(to.Key)
+				if err != nil {
+					return err
+				}
+				if lowLink[to.Key] < lowLink[key] {
+					lowLink[key] = lowLink[to.Key]
+				}
+				continue
+			}
+			if _, isOnStack := onStack[to.Key]; isOnStack && index[to.Key] < lowLink[key] {
+				lowLink[key] = index[to.Key]
+			}
+		}
+
+		// not the root of a component
+		if lowLink[key] != index[key] {
+			return nil
+		}
+
+		component := []string{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			delete(onStack, top)
+			component = append(component, top)
+			if top == key {
+				break
+			}
+		}
+		components = append(components, component)
+		return nil
+	}
+
+	for _, vertex := range vertices {
+		if _, visited := index[vertex.Key]; visited {
+			continue
+		}
+		err = visit(vertex.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sortComponents(components)
+	return components, nil
+}
+
+// WeaklyConnectedComponents returns the keys of the vertices grouped by weakly connected components:
+// every vertex of a component is connected to every other vertex of the same component
+// when the direction of the edges is ignored. A vertex without edges is a component of its own.
+//
+// Keys in every component are sorted and the components are sorted by their first key,
+// so the result is deterministic. Edges pointing to removed vertices are ignored.
+func (g Graph) WeaklyConnectedComponents() (components [][]string, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	vertices, err := g.sortedVertices()
+	if err != nil {
+		return nil, err
+	}
+
+	// union-find with path halving, maps a key to its parent key
+	parent := make(map[string]string, len(vertices))
+	for _, vertex := range vertices {
+		parent[vertex.Key] = vertex.Key
+	}
+	find := func(key string) string {
+		for parent[key] != key {
+			parent[key] = parent[parent[key]]
+			key = parent[key]
+		}
+		return key
+	}
+
+	for _, vertex := range vertices {
+		adjacent, err := g.sortedAdjacent(vertex.Key)
+		if err != nil {
+			return nil, err
+		}
+		for _, to := range adjacent {
+			fromRoot, toRoot := find(vertex.Key), find(to.Key)
+			if fromRoot != toRoot {
+				parent[toRoot] = fromRoot
+			}
+		}
+	}
+
+	byRoot := make(map[string][]string)
+	for _, vertex := range vertices {
+		root := find(vertex.Key)
+		byRoot[root] = append(byRoot[root], vertex.Key)
+	}
+
+	components = make([][]string, 0, len(byRoot))
+	for _, component := range byRoot {
+		components = append(components, component)
+	}
+	sortComponents(components)
+	return components, nil
+}
+
+// sortComponents sorts the keys in every component and then the components by their first key
+func sortComponents(components [][]string) {
+	for _, component := range components {
+		sort.Strings(component)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0] < components[j][0]
+	})
+}
@@ -0,0 +1,75 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponents(t *testing.T) {
+	newGraph := func(t *testing.T, keys []string, edges [][2]string) Graph {
+		g := NewGraph(testReplica)
+		for _, key := range keys {
+			require.NoError(t, g.AddVertex(Vertex{Key: key}))
+		}
+		for _, edge := range edges {
+			require.NoError(t, g.AddEdge(edge[0], edge[1]))
+		}
+		return g
+	}
+
+	t.Run("groups vertices by strongly connected components", func(t *testing.T) {
+		g := newGraph(t, []string{"a", "b", "c", "d", "e", "f", "g"}, [][2]string{
+			{"a", "b"},
+			{"b", "c"},
+			{"c", "a"},
+			{"c", "d"},
+			{"d", "e"},
+			{"e", "d"},
+			{"f", "f"},
+		})
+
+		components, err := g.StronglyConnectedComponents()
+		require.NoError(t, err)
+		require.Equal(t, [][]string{{"a", "b", "c"}, {"d", "e"}, {"f"}, {"g"}}, components)
+	})
+
+	t.Run("groups vertices by weakly connected components", func(t *testing.T) {
+		g := newGraph(t, []string{"a", "b", "c", "d", "e", "f"}, [][2]string{
+			{"a", "b"},
+			{"c", "b"},
+			{"e", "d"},
+		})
+
+		components, err := g.WeaklyConnectedComponents()
+		require.NoError(t, err)
+		require.Equal(t, [][]string{{"a", "b", "c"}, {"d", "e"}, {"f"}}, components)
+	})
+
+	t.Run("ignores removed vertices", func(t *testing.T) {
+		g := newGraph(t, []string{"a", "b", "c"}, [][2]string{
+			{"a", "b"},
+			{"b", "c"},
+			{"c", "a"},
+		})
+		require.NoError(t, g.RemoveVertex("b"))
+
+		components, err := g.StronglyConnectedComponents()
+		require.NoError(t, err)
+		require.Equal(t, [][]string{{"a"}, {"c"}}, components)
+
+		components, err = g.WeaklyConnectedComponents()
+		require.NoError(t, err)
+		require.Equal(t, [][]string{{"a", "c"}}, components)
+	})
+
+	t.Run("returns empty lists for an empty graph", func(t *testing.T) {
+		g := NewGraph(testReplica)
+		components, err := g.StronglyConnectedComponents()
+		require.NoError(t, err)
+		require.Empty(t, components)
+		components, err = g.WeaklyConnectedComponents()
+		require.NoError(t, err)
+		require.Empty(t, components)
+	})
+}
@@ -0,0 +1,37 @@
+package lww
+
+// MergeableElement is an `Element` carrying a nested CRDT payload (e.g. a counter or a set of tags)
+// that merges concurrent versions of itself instead of being overwritten by the last writer.
+//
+// When both replicas have an addition record for the same key, `Set.Merge` calls `Merge`
+// on the element of the newer record with the element of the older one and keeps the result
+// with the timestamp of the newer record. Records are merged whether they are removed or not,
+// so the merged record depends only on the additions and replicas converge regardless of the merge order.
+// Removals keep the last-writer-wins semantics: the element is live if the merged record is newer
+// than the removal, in which case it carries the payloads of the removed additions too.
+//
+// `Merge` must be commutative, associative and idempotent, must keep the key
+// and must not modify the receiver or `other`, otherwise replicas do not converge.
+// Elements of a different type can be passed as `other` if the set contains mixed element types.
+type MergeableElement interface {
+	Element
+	// Merge returns the element combining the state of the element and `other`
+	Merge(other Element) Element
+}
+
+// mergeElements merges the elements of two addition records of the same key if the element of the newer record
+// implements `MergeableElement`. Returns `false` if the elements are not mergeable.
+func mergeElements(local, remote addRecord) (merged addRecord, ok bool) {
+	winner, loser := local, remote
+	if newer(remote.Timestamp, remote.Replica, local.Timestamp, local.Replica) {
+		winner, loser = remote, local
+	}
+
+	mergeable, ok := winner.Element.(MergeableElement)
+	if !ok {
+		return addRecord{}, false
+	}
+
+	winner.Element = mergeable.Merge(loser.Element)
+	return winner, true
+}
@@ -0,0 +1,161 @@
+package lww
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// taggedElement is a composite element with a grow-only set of tags
+type taggedElement struct {
+	Key  string   `json:"key"`
+	Tags []string `json:"tags"`
+}
+
+func (e taggedElement) GetKey() string {
+	return e.Key
+}
+
+func (e taggedElement) Merge(other Element) Element {
+	o, isTagged := other.(taggedElement)
+	if !isTagged {
+		return e
+	}
+
+	unique := make(map[string]nothing)
+	for _, tag := range append(append([]string{}, e.Tags...), o.Tags...) {
+		unique[tag] = nothing{}
+	}
+	merged := taggedElement{Key: e.Key, Tags: make([]string, 0, len(unique))}
+	for tag := range unique {
+		merged.Tags = append(merged.Tags, tag)
+	}
+	sort.Strings(merged.Tags)
+	return merged
+}
+
+func decodeTaggedElement(data []byte) (Element, error) {
+	var e taggedElement
+	err := json.Unmarshal(data, &e)
+	return e, err
+}
+
+func TestMergeableElement(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	replica := func(id string, offset time.Duration) crdt.Replica {
+		return crdt.Replica{ID: id, Clock: clock.Func(func() time.Time { return base.Add(offset) })}
+	}
+
+	t.Run("live records of the same key are merged on both replicas", func(t *testing.T) {
+		a := NewSetWithDecoder(replica("A", 0), decodeTaggedElement)
+		b := NewSetWithDecoder(replica("B", time.Second), decodeTaggedElement)
+		a.Add(taggedElement{Key: "key", Tags: []string{"red"}})
+		b.Add(taggedElement{Key: "key", Tags: []string{"blue"}})
+
+		replicateSets(a, b)
+
+		for _, s := range []Set{a, b} {
+			found, err := s.Lookup("key")
+			require.NoError(t, err)
+			require.Equal(t, taggedElement{Key: "key", Tags: []string{"blue", "red"}}, found)
+
+			write, err := s.LastWrite("key")
+			require.NoError(t, err)
+			require.Equal(t, Write{Replica: "B", Timestamp: base.Add(time.Second)}, write,
+				"the newer record must be kept")
+		}
+	})
+
+	t.Run("merged elements survive serialization", func(t *testing.T) {
+		a := NewSetWithDecoder(replica("A", 0), decodeTaggedElement)
+		b := NewSetWithDecoder(replica("B", 0), decodeTaggedElement)
+		a.Add(taggedElement{Key: "key", Tags: []string{"red"}})
+		b.Add(taggedElement{Key: "key", Tags: []string{"blue"}})
+
+		data, err := b.Marshal()
+		require.NoError(t, err)
+		remote := NewSetWithDecoder(replica("C", 0), decodeTaggedElement)
+		require.NoError(t, remote.Unmarshal(data))
+		a.Merge(remote)
+
+		found, err := a.Lookup("key")
+		require.NoError(t, err)
+		require.Equal(t, taggedElement{Key: "key", Tags: []string{"blue", "red"}}, found)
+	})
+
+	t.Run("removals keep the last-writer-wins semantics", func(t *testing.T) {
+		a := NewSetWithDecoder(replica("A", 0), decodeTaggedElement)
+		b := NewSetWithDecoder(replica("B", time.Second), decodeTaggedElement)
+		a.Add(taggedElement{Key: "key", Tags: []string{"red"}})
+		b.Add(taggedElement{Key: "key", Tags: []string{"blue"}})
+		c := NewSetWithDecoder(replica("C", 2*time.Second), decodeTaggedElement)
+		c.Remove("key")
+		b.Merge(c)
+
+		a.Merge(b)
+
+		_, err := a.Lookup("key")
+		require.ErrorIs(t, err, ErrElementNotFound)
+	})
+
+	t.Run("replicas converge regardless of the merge order", func(t *testing.T) {
+		a := NewSetWithDecoder(replica("A", 0), decodeTaggedElement)
+		a.Add(taggedElement{Key: "key", Tags: []string{"red"}})
+		c := NewSetWithDecoder(replica("C", time.Second), decodeTaggedElement)
+		c.Remove("key")
+		b := NewSetWithDecoder(replica("B", 2*time.Second), decodeTaggedElement)
+		b.Add(taggedElement{Key: "key", Tags: []string{"blue"}})
+
+		orders := [][]Set{
+			{a, b, c},
+			{a, c, b},
+			{b, a, c},
+			{b, c, a},
+			{c, a, b},
+			{c, b, a},
+		}
+		for _, order := range orders {
+			merged := NewSetWithDecoder(replica("D", 0), decodeTaggedElement)
+			for _, s := range order {
+				merged.Merge(s)
+			}
+
+			found, err := merged.Lookup("key")
+			require.NoError(t, err)
+			require.Equal(t, taggedElement{Key: "key", Tags: []string{"blue", "red"}}, found)
+		}
+	})
+
+	t.Run("merges are not recorded as conflicts", func(t *testing.T) {
+		journal := crdt.NewJournal(crdt.JournalConfig{})
+		r := replica("A", 0)
+		r.Journal = journal
+		a := NewSetWithDecoder(r, decodeTaggedElement)
+		b := NewSetWithDecoder(replica("B", time.Second), decodeTaggedElement)
+		a.Add(taggedElement{Key: "key", Tags: []string{"red"}})
+		b.Add(taggedElement{Key: "key", Tags: []string{"blue"}})
+
+		a.Merge(b)
+		require.Empty(t, journal.Conflicts(time.Time{}, time.Time{}))
+	})
+
+	t.Run("other elements are overwritten by the last writer", func(t *testing.T) {
+		a := NewSetWithDecoder(replica("A", 0), DecodeVertex)
+		b := NewSetWithDecoder(replica("B", time.Second), DecodeVertex)
+		a.Add(Vertex{Key: "key", Value: "a"})
+		b.Add(Vertex{Key: "key", Value: "b"})
+
+		replicateSets(a, b)
+
+		for _, s := range []Set{a, b} {
+			found, err := s.Lookup("key")
+			require.NoError(t, err)
+			require.Equal(t, Vertex{Key: "key", Value: "b"}, found)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package lww
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// vertexState is the serialized form of a vertex,
+// it has either a plain value or a compressed one.
+type vertexState struct {
+	Key        string `json:"key"`
+	Value      string `json:"value,omitempty"`
+	Compressed []byte `json:"compressed,omitempty"`
+}
+
+// compressedVertex is a vertex with a gzip-compressed value,
+// it's stored instead of `Vertex` when the value exceeds the compression threshold of the replica.
+type compressedVertex struct {
+	key  string
+	data []byte
+}
+
+// GetKey implements the `Element` interface
+func (v compressedVertex) GetKey() string {
+	return v.key
+}
+
+// MarshalJSON implements the `json.Marshaler` interface, the value stays compressed
+func (v compressedVertex) MarshalJSON() ([]byte, error) {
+	return json.Marshal(vertexState{Key: v.key, Compressed: v.data})
+}
+
+// vertex returns the decompressed vertex
+func (v compressedVertex) vertex() (Vertex, error) {
+	value, err := decompress(v.data)
+	if err != nil {
+		return Vertex{}, errors.Wrapf(err, "failed to decompress vertex [key = %q]", v.key)
+	}
+	return Vertex{Key: v.key, Value: value}, nil
+}
+
+// UnmarshalJSON implements the `json.Unmarshaler` interface,
+// it reads both plain and compressed values, so any replica can decode the state.
+func (v *Vertex) UnmarshalJSON(data []byte) error {
+	var state vertexState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+	v.Key, v.Value = state.Key, state.Value
+	if state.Compressed == nil {
+		return nil
+	}
+	v.Value, err = decompress(state.Compressed)
+	return err
+}
+
+// compressVertex returns the element to store for the vertex according to the compression settings of the replica
+func (g Graph) compressVertex(v Vertex) Element {
+	threshold := g.replica.Compression.Threshold
+	if threshold <= 0 || len(v.Value) <= threshold {
+		return v
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w := gzip.NewWriter(buf)
+	// writing to a buffer does not fail
+	_, _ = w.Write([]byte(v.Value))
+	_ = w.Close()
+	if buf.Len() >= len(v.Value) {
+		return v
+	}
+
+	return compressedVertex{key: v.Key, data: buf.Bytes()}
+}
+
+// toVertex returns the vertex stored in the element, decompressing it if needed
+func toVertex(e Element) (Vertex, bool) {
+	switch v := e.(type) {
+	case Vertex:
+		return v, true
+	case compressedVertex:
+		vertex, err := v.vertex()
+		return vertex, err == nil
+	case evictedVertex:
+		vertex, err := v.vertex()
+		return vertex, err == nil
+	default:
+		return Vertex{}, false
+	}
+}
+
+func decompress(data []byte) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read compressed value")
+	}
+	value, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read compressed value")
+	}
+	return string(value), nil
+}
@@ -0,0 +1,106 @@
+package lww
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	large := Vertex{Key: "large", Value: strings.Repeat(`{"field":"value"},`, 100)}
+	small := Vertex{Key: "small", Value: "value"}
+	compressing := func(id string) crdt.Replica {
+		r := crdt.NewReplica(id)
+		r.Compression.Threshold = 64
+		return r
+	}
+
+	t.Run("compresses only large values and reads them transparently", func(t *testing.T) {
+		g := NewGraph(compressing("A"))
+		require.NoError(t, g.AddVertex(large))
+		require.NoError(t, g.AddVertex(small))
+
+		element, err := g.vertices.Lookup(large.Key)
+		require.NoError(t, err)
+		require.IsType(t, compressedVertex{}, element)
+		element, err = g.vertices.Lookup(small.Key)
+		require.NoError(t, err)
+		require.IsType(t, Vertex{}, element)
+
+		found, err := g.Lookup(large.Key)
+		require.NoError(t, err)
+		require.Equal(t, large, found)
+
+		updated := Vertex{Key: large.Key, Value: strings.Repeat("updated", 100)}
+		require.NoError(t, g.UpdateVertex(updated))
+		found, err = g.Lookup(updated.Key)
+		require.NoError(t, err)
+		require.Equal(t, updated, found)
+	})
+
+	t.Run("keeps values that do not get smaller", func(t *testing.T) {
+		g := NewGraph(compressing("A"))
+		random := Vertex{Key: "random", Value: "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ!@#$%^&*()"}
+		require.NoError(t, g.AddVertex(random))
+		element, err := g.vertices.Lookup(random.Key)
+		require.NoError(t, err)
+		require.Equal(t, random, element)
+	})
+
+	t.Run("the serialized state is smaller and readable by any replica", func(t *testing.T) {
+		plain := NewGraph(crdt.NewReplica("A"))
+		compressed := NewGraph(compressing("B"))
+		require.NoError(t, plain.AddVertex(large))
+		require.NoError(t, compressed.AddVertex(large))
+
+		plainData, err := plain.Marshal()
+		require.NoError(t, err)
+		compressedData, err := compressed.Marshal()
+		require.NoError(t, err)
+		require.Less(t, len(compressedData)*4, len(plainData))
+
+		restored := NewGraph(crdt.NewReplica("C"))
+		require.NoError(t, restored.Unmarshal(compressedData))
+		found, err := restored.Lookup(large.Key)
+		require.NoError(t, err)
+		require.Equal(t, large, found)
+		element, err := restored.vertices.Lookup(large.Key)
+		require.NoError(t, err)
+		require.IsType(t, compressedVertex{}, element, "values stay compressed in memory")
+
+		var v Vertex
+		data, err := json.Marshal(element)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &v))
+		require.Equal(t, large, v)
+	})
+
+	t.Run("replicas with different settings converge", func(t *testing.T) {
+		a := NewGraph(compressing("A"))
+		b := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, a.AddVertex(large))
+		require.NoError(t, b.AddVertex(Vertex{Key: "other", Value: large.Value}))
+		require.NoError(t, a.AddEdge(large.Key, large.Key))
+		replicateGraphs(a, b)
+
+		requireEqualGraphs(t, a, b)
+		digestA, err := a.Digest()
+		require.NoError(t, err)
+		digestB, err := b.Digest()
+		require.NoError(t, err)
+		require.Equal(t, digestA, digestB)
+		predecessors, err := b.FindPredecessors(large.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{large}, predecessors)
+	})
+
+	t.Run("fails to decode corrupted values", func(t *testing.T) {
+		_, err := DecodeVertex([]byte(`{"key":"v","compressed":"bm90IGd6aXA="}`))
+		require.Error(t, err)
+		var v Vertex
+		require.Error(t, json.Unmarshal([]byte(`{"key":"v","compressed":"bm90IGd6aXA="}`), &v))
+	})
+}
@@ -0,0 +1,195 @@
+package lww
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+var (
+	// ErrVersionConflict occurs when a conditional operation is applied with an outdated observed version
+	ErrVersionConflict = errors.New("observed version is not current")
+)
+
+// Version is the version of a key: the timestamps of its last known addition and removal.
+// Every operation and every merge bringing a newer operation of the key changes its version,
+// so comparing an observed version with the current one detects concurrent changes.
+// The zero value is the version of a key that was never added or removed.
+type Version struct {
+	// AddedAt is the timestamp of the last addition, zero if the key was never added
+	AddedAt time.Time
+	// RemovedAt is the timestamp of the last removal, zero if the key was never removed
+	RemovedAt time.Time
+}
+
+// Equal returns `true` if both versions are the same
+func (v Version) Equal(other Version) bool {
+	return v.AddedAt.Equal(other.AddedAt) && v.RemovedAt.Equal(other.RemovedAt)
+}
+
+// Record is an element with its version
+type Record struct {
+	// Element is the current element, nil if the key is not in the set
+	Element Element
+	// Version is the current version of the key
+	Version Version
+}
+
+// Observe returns the current element with the given key along with its version,
+// the version can be passed to `CompareAndAdd` or `CompareAndRemove` later.
+func (s Set) Observe(key string) Record {
+	s.checkUsage()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.record(s.replica.NormalizeKey(key))
+}
+
+// CompareAndAdd adds the element only if the `observed` version of its key is still current,
+// e.g. the element was not changed by another user or a merge since it was observed.
+// Returns the new record if the element is added.
+// Returns the current (newer) record and an error with `ErrVersionConflict` cause otherwise.
+//
+// The condition is checked only locally, the operation is an ordinary addition for the other replicas,
+// so it's a building block for optimistic UI flows that does not affect convergence.
+func (s Set) CompareAndAdd(e Element, observed Version) (Record, error) {
+	s.checkUsage()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key, e := s.normalize(e)
+	err := s.compare(key, observed)
+	if err != nil {
+		return s.record(key), err
+	}
+
+	s.additions[key] = s.write(key, e)
+	s.observeAddition(key, crdt.SourceLocal)
+	s.replica.Metrics.Count("lww.set.add", 1)
+
+	return s.record(key), nil
+}
+
+// CompareAndRemove removes the element with the given key only if the `observed` version
+// of the key is still current. See `CompareAndAdd` for details.
+func (s Set) CompareAndRemove(key string, observed Version) (Record, error) {
+	s.checkUsage()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key = s.replica.NormalizeKey(key)
+	err := s.compare(key, observed)
+	if err != nil {
+		return s.record(key), err
+	}
+
+	s.removals[key] = removeRecord{
+		Timestamp: s.replica.Clock.Now(),
+		Replica:   s.replica.ID,
+	}
+	s.observeRemoval(key, crdt.SourceLocal)
+	s.replica.Metrics.Count("lww.set.remove", 1)
+
+	return s.record(key), nil
+}
+
+// compare returns an error with `ErrVersionConflict` cause if the current version of the key differs
+func (s Set) compare(key string, observed Version) error {
+	current := s.record(key).Version
+	if !current.Equal(observed) {
+		s.replica.Metrics.Count("lww.set.conflict", 1)
+		return errors.Wrapf(ErrVersionConflict, "key %q was changed since it was observed", key)
+	}
+	return nil
+}
+
+// record returns the current record of the normalized key, must be called under the lock
+func (s Set) record(key string) (record Record) {
+	added, isAdded := s.additions[key]
+	if isAdded {
+		record.Version.AddedAt = added.Timestamp
+		if !s.removed(key, added) {
+			record.Element = added.Element
+		}
+	}
+	record.Version.RemovedAt = s.removals[key].Timestamp
+	return record
+}
+
+// ObserveVertex returns the current vertex with the given key along with its version.
+// `Record.Element` is a `Vertex` or nil if the vertex does not exist or its evicted value cannot be read.
+func (g Graph) ObserveVertex(key string) Record {
+	g.checkUsage()
+	return toVertexRecord(g.vertices.Observe(key))
+}
+
+// CompareAndAddVertex adds or replaces the vertex only if the `observed` version of its key is still current.
+// Unlike `AddVertex` it replaces an existing vertex, since the caller has observed it.
+// Returns an error with `crdt.ErrLimitExceeded` cause if a new vertex would exceed the replica limits.
+// Returns an error with `crdt.ErrInvalidValue` cause if the replica validator rejects the value.
+// See `Set.CompareAndAdd` for details.
+func (g Graph) CompareAndAddVertex(v Vertex, observed Version) (Record, error) {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return toVertexRecord(g.vertices.Observe(v.Key)), err
+	}
+
+	err = g.replica.ValidateValue(v.Key, v.Value)
+	if err != nil {
+		return toVertexRecord(g.vertices.Observe(v.Key)), err
+	}
+
+	if g.replica.Limits.MaxElements > 0 && g.vertices.Observe(v.Key).Element == nil {
+		err := g.replica.CheckLimit(len(g.vertices.List()))
+		if err != nil {
+			return toVertexRecord(g.vertices.Observe(v.Key)), err
+		}
+	}
+
+	changes := g.trackChanges(false)
+	changes.vertex(v.Key)
+	record, err := g.vertices.CompareAndAdd(g.compressVertex(v), observed)
+	changes.publish()
+
+	return toVertexRecord(record), err
+}
+
+// CompareAndRemoveVertex removes the vertex only if the `observed` version of its key is still current.
+// See `Set.CompareAndRemove` for details.
+func (g Graph) CompareAndRemoveVertex(key string, observed Version) (Record, error) {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return toVertexRecord(g.vertices.Observe(key)), err
+	}
+
+	changes := g.trackChanges(false)
+	changes.vertex(key)
+	record, err := g.vertices.CompareAndRemove(key, observed)
+	changes.publish()
+
+	return toVertexRecord(record), err
+}
+
+// toVertexRecord returns the record with the stored element converted to `Vertex`,
+// so compressed and evicted vertices are never exposed to the caller
+func toVertexRecord(record Record) Record {
+	if record.Element == nil {
+		return record
+	}
+	vertex, isVertex := toVertex(record.Element)
+	if !isVertex {
+		record.Element = nil
+		return record
+	}
+	record.Element = vertex
+	return record
+}
@@ -0,0 +1,121 @@
+package lww
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditional(t *testing.T) {
+	t.Run("CompareAndAdd applies only with the current version", func(t *testing.T) {
+		s := NewSet(testReplica)
+
+		record := s.Observe("key")
+		require.Nil(t, record.Element)
+		require.Equal(t, Version{}, record.Version)
+
+		added, err := s.CompareAndAdd(IDElement("key"), record.Version)
+		require.NoError(t, err)
+		require.Equal(t, IDElement("key"), added.Element)
+		require.False(t, added.Version.AddedAt.IsZero())
+
+		current, err := s.CompareAndAdd(IDElement("key"), record.Version)
+		require.ErrorIs(t, err, ErrVersionConflict)
+		require.Equal(t, added, current, "the newer record must be returned")
+	})
+
+	t.Run("CompareAndRemove applies only with the current version", func(t *testing.T) {
+		s := NewSet(testReplica)
+		s.Add(IDElement("key"))
+		observed := s.Observe("key").Version
+
+		s.Add(IDElement("key"))
+		_, err := s.CompareAndRemove("key", observed)
+		require.ErrorIs(t, err, ErrVersionConflict)
+		_, err = s.Lookup("key")
+		require.NoError(t, err)
+
+		removed, err := s.CompareAndRemove("key", s.Observe("key").Version)
+		require.NoError(t, err)
+		require.Nil(t, removed.Element)
+		require.False(t, removed.Version.RemovedAt.IsZero())
+		_, err = s.Lookup("key")
+		require.ErrorIs(t, err, ErrElementNotFound)
+	})
+
+	t.Run("a merge bringing a newer change makes the observed version outdated", func(t *testing.T) {
+		local := NewSet(testReplica)
+		local.Add(IDElement("key"))
+		observed := local.Observe("key").Version
+
+		remote := NewSet(crdt.NewReplica("remote"))
+		remote.Merge(local)
+		remote.Remove("key")
+		local.Merge(remote)
+
+		current, err := local.CompareAndAdd(IDElement("key"), observed)
+		require.ErrorIs(t, err, ErrVersionConflict)
+		require.Nil(t, current.Element)
+		require.Equal(t, observed.AddedAt, current.Version.AddedAt)
+	})
+
+	t.Run("conditional vertex operations", func(t *testing.T) {
+		g := NewGraph(testReplica)
+		v := Vertex{Key: "vertex", Value: "value1"}
+		require.NoError(t, g.AddVertex(v))
+
+		observed := g.ObserveVertex(v.Key)
+		require.Equal(t, v, observed.Element)
+
+		updated := Vertex{Key: "vertex", Value: "value2"}
+		_, err := g.CompareAndAddVertex(updated, observed.Version)
+		require.NoError(t, err)
+		found, err := g.Lookup(v.Key)
+		require.NoError(t, err)
+		require.Equal(t, updated, found)
+
+		_, err = g.CompareAndRemoveVertex(v.Key, observed.Version)
+		require.ErrorIs(t, err, ErrVersionConflict)
+	})
+
+	t.Run("conditional vertex operations return compressed and evicted vertices decoded", func(t *testing.T) {
+		r := crdt.NewReplica("compressed")
+		r.Compression.Threshold = 16
+		g := NewGraph(r)
+		v := Vertex{Key: "vertex", Value: strings.Repeat("value", 100)}
+		require.NoError(t, g.AddVertex(v))
+
+		observed := g.ObserveVertex(v.Key)
+		require.Equal(t, v, observed.Element)
+
+		updated := Vertex{Key: "vertex", Value: strings.Repeat("updated", 100)}
+		added, err := g.CompareAndAddVertex(updated, observed.Version)
+		require.NoError(t, err)
+		require.Equal(t, updated, added.Element)
+
+		current, err := g.CompareAndAddVertex(v, observed.Version)
+		require.ErrorIs(t, err, ErrVersionConflict)
+		require.Equal(t, updated, current.Element)
+
+		spill, err := NewDirSpill(t.TempDir())
+		require.NoError(t, err)
+		result, err := g.Evict(MemoryBudget{MaxBytes: 1, Spill: spill})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Spilled)
+		current, err = g.CompareAndRemoveVertex(v.Key, observed.Version)
+		require.ErrorIs(t, err, ErrVersionConflict)
+		require.Equal(t, updated, current.Element)
+	})
+
+	t.Run("CompareAndAddVertex respects the replica limits", func(t *testing.T) {
+		r := crdt.NewReplica("limited")
+		r.Limits.MaxElements = 1
+		g := NewGraph(r)
+		require.NoError(t, g.AddVertex(Vertex{Key: "vertex1"}))
+
+		_, err := g.CompareAndAddVertex(Vertex{Key: "vertex2"}, Version{})
+		require.ErrorIs(t, err, crdt.ErrLimitExceeded)
+	})
+}
@@ -0,0 +1,458 @@
+package lww
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
+)
+
+const (
+	// SetKind is the CRDT kind of the Last-Writer-Wins element set
+	SetKind crdt.Kind = "lww.set"
+	// GraphKind is the CRDT kind of the Last-Writer-Wins graph
+	GraphKind crdt.Kind = "lww.graph"
+)
+
+// ElementDecoder deserializes an element from its JSON representation
+type ElementDecoder func(data []byte) (Element, error)
+
+// DecodeIDElement is an `ElementDecoder` of `IDElement`
+func DecodeIDElement(data []byte) (Element, error) {
+	var e IDElement
+	err := json.Unmarshal(data, &e)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode ID element")
+	}
+	return e, nil
+}
+
+// DecodeVertex is an `ElementDecoder` of `Vertex`.
+// Compressed vertex values stay compressed in memory.
+func DecodeVertex(data []byte) (Element, error) {
+	var state vertexState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode vertex")
+	}
+	if state.Compressed == nil {
+		return Vertex{Key: state.Key, Value: state.Value}, nil
+	}
+	_, err = decompress(state.Compressed)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode vertex [key = %q]", state.Key)
+	}
+	return compressedVertex{key: state.Key, data: state.Compressed}, nil
+}
+
+// Register registers all the CRDT kinds of this package in the given registry.
+// All the CRDTs created by the registry belong to the given replica.
+// Sets created by the registry can unmarshal only `IDElement` elements.
+func Register(r crdt.Registry, replica crdt.Replica) error {
+	err := r.Register(SetKind, func() crdt.CRDT { return NewSet(replica) })
+	if err != nil {
+		return err
+	}
+
+	return r.Register(GraphKind, func() crdt.CRDT { return NewGraph(replica) })
+}
+
+// setState is the serialized format of the element set
+type setState struct {
+	// Additions maps an element key to its addition record
+	Additions map[string]addState `json:"additions"`
+	// Removals maps an element key to the time it was removed
+	Removals map[string]time.Time `json:"removals"`
+	// RemovedBy maps an element key to the ID of the replica that removed it
+	RemovedBy map[string]string `json:"removedBy,omitempty"`
+	// Siblings maps an element key to the additions concurrent with its addition record
+	Siblings map[string][]addState `json:"siblings,omitempty"`
+}
+
+// addState is the serialized format of an addition record
+type addState struct {
+	// Element is the JSON representation of the element
+	Element json.RawMessage `json:"element"`
+	// Timestamp is when the element was added
+	Timestamp time.Time `json:"timestamp"`
+	// Replica is the ID of the replica that added the element
+	Replica string `json:"replica,omitempty"`
+	// Observed maps a replica ID to the timestamp of the latest addition by the replica the writer had seen
+	Observed map[string]time.Time `json:"observed,omitempty"`
+}
+
+// graphState is the serialized format of the graph
+type graphState struct {
+	// Vertices is the state of the set of vertices
+	Vertices setState `json:"vertices"`
+	// Edges maps a vertex key to the state of the set of its adjacent keys
+	Edges map[string]setState `json:"edges"`
+	// EdgeGroups is the compact encoding of `Edges` (see `crdt.Replica.CompactEdges`)
+	EdgeGroups []edgeGroupState `json:"edgeGroups,omitempty"`
+	// Weights maps a vertex key and an adjacent key to the state of the edge weight counter
+	Weights map[string]map[string]json.RawMessage `json:"weights,omitempty"`
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (s Set) Kind() crdt.Kind {
+	return SetKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (s Set) MergeCRDT(remote crdt.CRDT) error {
+	remoteSet, isSet := remote.(Set)
+	if !isSet {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", s.Kind(), remote.Kind())
+	}
+	s.Merge(remoteSet)
+	return nil
+}
+
+// DeltaCRDT implements the `crdt.DeltaCRDT` interface
+func (s Set) DeltaCRDT(keys []string) crdt.CRDT {
+	return s.Delta(keys)
+}
+
+// Marshal implements the `crdt.CRDT` interface
+func (s Set) Marshal() ([]byte, error) {
+	state, err := s.state()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(state)
+}
+
+// Unmarshal implements the `crdt.CRDT` interface.
+// The elements are deserialized using the decoder the set was initialized with.
+func (s Set) Unmarshal(data []byte) error {
+	var state setState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal set")
+	}
+	return s.restoreState(state)
+}
+
+// state returns the serializable state of the set
+func (s Set) state() (state setState, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	state = setState{
+		Additions: make(map[string]addState, len(s.additions)),
+		Removals:  make(map[string]time.Time, len(s.removals)),
+	}
+
+	for key, record := range s.additions {
+		state.Additions[key], err = marshalAddRecord(key, record)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	for key, siblings := range s.siblings {
+		if state.Siblings == nil {
+			state.Siblings = make(map[string][]addState, len(s.siblings))
+		}
+		for _, record := range siblings {
+			added, err := marshalAddRecord(key, record)
+			if err != nil {
+				return state, err
+			}
+			state.Siblings[key] = append(state.Siblings[key], added)
+		}
+	}
+
+	for key, record := range s.removals {
+		state.Removals[key] = record.Timestamp
+		if record.Replica == "" {
+			continue
+		}
+		if state.RemovedBy == nil {
+			state.RemovedBy = make(map[string]string)
+		}
+		state.RemovedBy[key] = record.Replica
+	}
+
+	return state, nil
+}
+
+// restoreState replaces the state of the set with the given one.
+// The set remains unchanged if any of the elements cannot be decoded.
+func (s Set) restoreState(state setState) error {
+	var err error
+	additions := make(map[string]addRecord, len(state.Additions))
+	for key, added := range state.Additions {
+		additions[key], err = s.unmarshalAddRecord(key, added)
+		if err != nil {
+			return err
+		}
+	}
+
+	siblings := make(map[string][]addRecord, len(state.Siblings))
+	for key, states := range state.Siblings {
+		for _, added := range states {
+			record, err := s.unmarshalAddRecord(key, added)
+			if err != nil {
+				return err
+			}
+			siblings[key] = append(siblings[key], record)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key := range s.additions {
+		delete(s.additions, key)
+	}
+	for key, record := range additions {
+		s.additions[key] = record
+	}
+
+	for key := range s.removals {
+		delete(s.removals, key)
+	}
+	for key, removedAt := range state.Removals {
+		s.removals[key] = removeRecord{
+			Timestamp: removedAt,
+			Replica:   state.RemovedBy[key],
+		}
+	}
+
+	for key := range s.siblings {
+		delete(s.siblings, key)
+	}
+	for key, records := range siblings {
+		s.siblings[key] = records
+	}
+
+	return nil
+}
+
+// marshalAddRecord returns the serializable state of the addition record of the key
+func marshalAddRecord(key string, record addRecord) (addState, error) {
+	element, err := json.Marshal(record.Element)
+	if err != nil {
+		return addState{}, errors.Wrapf(err, "failed to marshal element [key = %q]", key)
+	}
+	return addState{
+		Element:   element,
+		Timestamp: record.Timestamp,
+		Replica:   record.Replica,
+		Observed:  record.Observed,
+	}, nil
+}
+
+// unmarshalAddRecord restores the addition record of the key from its serialized state
+func (s Set) unmarshalAddRecord(key string, added addState) (addRecord, error) {
+	element, err := s.decode(added.Element)
+	if err != nil {
+		return addRecord{}, errors.Wrapf(err, "failed to unmarshal element [key = %q]", key)
+	}
+	return addRecord{
+		Element:   element,
+		Timestamp: added.Timestamp,
+		Replica:   added.Replica,
+		Observed:  added.Observed,
+	}, nil
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (g Graph) Kind() crdt.Kind {
+	return GraphKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (g Graph) MergeCRDT(remote crdt.CRDT) error {
+	remoteGraph, isGraph := remote.(Graph)
+	if !isGraph {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", g.Kind(), remote.Kind())
+	}
+	g.Merge(remoteGraph)
+	return nil
+}
+
+// DeltaCRDT implements the `crdt.DeltaCRDT` interface
+func (g Graph) DeltaCRDT(keys []string) crdt.CRDT {
+	return g.Delta(keys)
+}
+
+// Marshal implements the `crdt.CRDT` interface
+func (g Graph) Marshal() ([]byte, error) {
+	return g.MarshalFormat(crdt.FormatDefault)
+}
+
+// MarshalFormat implements the `crdt.FormatMarshaler` interface, the formats differ only in the edge encoding:
+// `crdt.FormatV2` is the compact encoding of `crdt.Replica.CompactEdges`, `crdt.FormatDual` contains both.
+// Returns an error with `crdt.ErrUnknownFormat` cause if the format is not supported.
+func (g Graph) MarshalFormat(f crdt.Format) ([]byte, error) {
+	state, err := g.stateFormat(f)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(state)
+}
+
+// state returns the serializable state of the graph in the format chosen by the replica settings
+func (g Graph) state() (state graphState, err error) {
+	return g.stateFormat(crdt.FormatDefault)
+}
+
+// stateFormat returns the serializable state of the graph in the given format
+func (g Graph) stateFormat(f crdt.Format) (state graphState, err error) {
+	if f == crdt.FormatDefault {
+		switch {
+		case g.replica.DualFormat:
+			f = crdt.FormatDual
+		case g.replica.CompactEdges:
+			f = crdt.FormatV2
+		default:
+			f = crdt.FormatV1
+		}
+	}
+	if f < crdt.FormatV1 || f > crdt.FormatDual {
+		return state, errors.Wrapf(crdt.ErrUnknownFormat, "failed to marshal graph in format %d", f)
+	}
+
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	vertices, err := g.vertices.state()
+	if err != nil {
+		return state, errors.Wrap(err, "failed to marshal vertices")
+	}
+
+	state = graphState{
+		Vertices: vertices,
+		Edges:    make(map[string]setState, len(g.edges)),
+	}
+
+	for key, adjacent := range g.edges {
+		state.Edges[key], err = adjacent.state()
+		if err != nil {
+			return state, errors.Wrapf(err, "failed to marshal edges of vertex [key = %q]", key)
+		}
+	}
+
+	if f != crdt.FormatV1 {
+		state.EdgeGroups = compactEdges(state.Edges)
+	}
+	if f == crdt.FormatV2 {
+		state.Edges = nil
+	}
+
+	if len(g.weights) != 0 {
+		state.Weights = make(map[string]map[string]json.RawMessage, len(g.weights))
+	}
+	for fromKey, weights := range g.weights {
+		state.Weights[fromKey] = make(map[string]json.RawMessage, len(weights))
+		for toKey, weight := range weights {
+			state.Weights[fromKey][toKey], err = weight.Marshal()
+			if err != nil {
+				return state, errors.Wrapf(err, "failed to marshal weight of edge [from = %q, to = %q]", fromKey, toKey)
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// Unmarshal implements the `crdt.CRDT` interface
+func (g Graph) Unmarshal(data []byte) error {
+	var state graphState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal graph")
+	}
+	return g.restoreState(state)
+}
+
+// restoreState replaces the state of the graph with the given one.
+// The graph remains unchanged if any part of the state cannot be decoded.
+func (g Graph) restoreState(state graphState) error {
+	return g.restore(state, true)
+}
+
+// expandEdgeGroups merges the edges of the compact format (`EdgeGroups`) into `Edges`
+func (state *graphState) expandEdgeGroups() error {
+	if state.EdgeGroups == nil {
+		return nil
+	}
+	expanded, err := expandEdges(state.EdgeGroups)
+	if err != nil {
+		return err
+	}
+	if state.Edges == nil {
+		state.Edges = make(map[string]setState, len(expanded))
+	}
+	for key, adjacentState := range expanded {
+		state.Edges[key] = adjacentState
+	}
+	state.EdgeGroups = nil
+	return nil
+}
+
+// restore replaces the state of the graph with the given one like `restoreState`,
+// the index of incoming edges is rebuilt only if `index` is `true`, otherwise it's left to `UnmarshalLive`.
+func (g Graph) restore(state graphState, index bool) error {
+	err := state.expandEdgeGroups()
+	if err != nil {
+		return err
+	}
+
+	// decoding edges first, so the graph remains unchanged on failure
+	edges := make(map[string]Set, len(state.Edges))
+	for key, adjacentState := range state.Edges {
+		adjacent := g.newAdjacent(key)
+		err := adjacent.restoreState(adjacentState)
+		if err != nil {
+			return errors.Wrapf(err, "failed to unmarshal edges of vertex [key = %q]", key)
+		}
+		edges[key] = adjacent
+	}
+
+	weights := make(map[string]map[string]counter.PN, len(state.Weights))
+	for fromKey, weightStates := range state.Weights {
+		weights[fromKey] = make(map[string]counter.PN, len(weightStates))
+		for toKey, weightState := range weightStates {
+			weight := counter.NewPN(g.replica)
+			err := weight.Unmarshal(weightState)
+			if err != nil {
+				return errors.Wrapf(err, "failed to unmarshal weight of edge [from = %q, to = %q]", fromKey, toKey)
+			}
+			weights[fromKey][toKey] = weight
+		}
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err = g.vertices.restoreState(state.Vertices)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal vertices")
+	}
+
+	for key := range g.edges {
+		delete(g.edges, key)
+	}
+	for key, adjacent := range edges {
+		g.edges[key] = adjacent
+	}
+
+	for key := range g.weights {
+		delete(g.weights, key)
+	}
+	for key, w := range weights {
+		g.weights[key] = w
+	}
+
+	*g.unindexed = !index
+	if index {
+		g.reindex()
+	}
+
+	return nil
+}
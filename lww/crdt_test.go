@@ -0,0 +1,88 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRDT(t *testing.T) {
+	registry := crdt.NewRegistry()
+	require.NoError(t, Register(registry, testReplica))
+	require.Equal(t, []crdt.Kind{GraphKind, SetKind}, registry.Kinds())
+
+	t.Run("set survives a marshal/unmarshal round trip", func(t *testing.T) {
+		s := NewSet(testReplica)
+		s.Add(IDElement("element1"))
+		s.Add(IDElement("element2"))
+		s.Remove("element2")
+		s.Remove("element3")
+
+		data, err := crdt.Marshal(s)
+		require.NoError(t, err)
+
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+		require.Equal(t, SetKind, restored.Kind())
+
+		restoredData, err := crdt.Marshal(restored)
+		require.NoError(t, err)
+		require.JSONEq(t, string(data), string(restoredData))
+		require.Equal(t, s.List(), restored.(Set).List())
+	})
+
+	t.Run("graph survives a marshal/unmarshal round trip", func(t *testing.T) {
+		v1 := Vertex{Key: "vertex1", Value: "value1"}
+		v2 := Vertex{Key: "vertex2", Value: "value2"}
+		v3 := Vertex{Key: "vertex3", Value: "value3"}
+
+		g := NewGraph(testReplica)
+		require.NoError(t, g.AddVertex(v1))
+		require.NoError(t, g.AddVertex(v2))
+		require.NoError(t, g.AddVertex(v3))
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		require.NoError(t, g.AddEdge(v3.Key, v1.Key))
+		require.NoError(t, g.RemoveVertex(v3.Key))
+
+		data, err := crdt.Marshal(g)
+		require.NoError(t, err)
+
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+		equalGraphs(t, g, restored.(Graph))
+
+		// the removed vertex keeps its edge for future merges
+		restoredGraph := restored.(Graph)
+		require.Equal(t, []Element{Edge{To: v1.Key}}, restoredGraph.getAdjacent(v3.Key).List())
+	})
+
+	t.Run("unmarshal replaces the existing state", func(t *testing.T) {
+		source := NewSet(testReplica)
+		source.Add(IDElement("element1"))
+		data, err := source.Marshal()
+		require.NoError(t, err)
+
+		target := NewSet(testReplica)
+		target.Add(IDElement("element2"))
+		require.NoError(t, target.Unmarshal(data))
+		require.Equal(t, []Element{IDElement("element1")}, target.List())
+	})
+
+	t.Run("merges CRDTs of the same kind", func(t *testing.T) {
+		A := NewSet(testReplica)
+		B := NewSet(testReplica)
+		B.Add(IDElement("element1"))
+
+		require.NoError(t, A.MergeCRDT(B))
+		require.Equal(t, B.List(), A.List())
+	})
+
+	t.Run("returns ErrKindMismatch when merging CRDTs of different kinds", func(t *testing.T) {
+		err := NewSet(testReplica).MergeCRDT(NewGraph(testReplica))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+
+		err = NewGraph(testReplica).MergeCRDT(NewSet(testReplica))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+	})
+}
@@ -0,0 +1,70 @@
+package lww
+
+// Delta returns a new set containing only the records of the elements with the given keys including removed ones,
+// so only the changed part of the state can be sent to another replica and merged there.
+// The changed keys can be collected with `crdt.Replica.Observer`, unknown keys are ignored.
+func (s Set) Delta(keys []string) Set {
+	delta := NewSetWithDecoder(s.replica, s.decode)
+	delta.mutation = s.mutation
+	for key, record := range s.recordsOf(keys) {
+		delta.restoreRecord(key, record)
+	}
+
+	return delta
+}
+
+// Delta returns a new graph containing only the records of the vertices with the given keys including removed ones,
+// the edges starting from these vertices and their weights, so only the changed part of the state can be sent
+// to another replica and merged there. The changed keys can be collected with `crdt.Replica.Observer`,
+// the key of an edge mutation is the key of the vertex the edge starts from. Unknown keys are ignored.
+func (g Graph) Delta(keys []string) Graph {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	delta := NewGraph(g.replica)
+	for key, record := range g.vertices.recordsOf(keys) {
+		delta.vertices.restoreRecord(key, record)
+	}
+
+	for _, key := range keys {
+		fromKey := g.replica.NormalizeKey(key)
+		if edges, exist := g.edges[fromKey]; exist {
+			for toKey, record := range edges.records("") {
+				delta.getAdjacent(fromKey).restoreRecord(toKey, record)
+			}
+		}
+		for toKey, weight := range g.weights[fromKey] {
+			delta.getWeight(fromKey, toKey).Merge(weight)
+		}
+	}
+	delta.reindex()
+
+	return delta
+}
+
+// recordsOf returns the state of the given keys in the set including removed ones, unknown keys are skipped
+func (s Set) recordsOf(keys []string) map[string]elementRecord {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	records := make(map[string]elementRecord, len(keys))
+	for _, key := range keys {
+		key = s.replica.NormalizeKey(key)
+		record := elementRecord{siblings: s.siblings[key]}
+		added, isAdded := s.additions[key]
+		if isAdded {
+			addedAt := added.Timestamp
+			record.element, record.addedAt, record.addedBy, record.observed = added.Element, &addedAt, added.Replica, added.Observed
+		}
+		removal, isRemoved := s.removals[key]
+		if isRemoved {
+			removedAt := removal.Timestamp
+			record.removedAt, record.removedBy = &removedAt, removal.Replica
+		}
+		if isAdded || isRemoved {
+			records[key] = record
+		}
+	}
+
+	return records
+}
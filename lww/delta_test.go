@@ -0,0 +1,68 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelta(t *testing.T) {
+	t.Run("set delta contains only the records of the given keys", func(t *testing.T) {
+		A := NewSet(crdt.NewReplica("A"))
+		A.Add(IDElement("element1"))
+		A.Add(IDElement("element2"))
+		B := NewSet(crdt.NewReplica("B"))
+		B.Merge(A)
+
+		A.Add(IDElement("element3"))
+		A.Remove("element1")
+
+		delta := A.Delta([]string{"element1", "element3", "unknown"})
+		require.Len(t, delta.records(""), 2)
+
+		B.Merge(delta)
+		require.ElementsMatch(t, A.List(), B.List())
+		equal, err := A.StateEquals(B)
+		require.NoError(t, err)
+		require.True(t, equal)
+	})
+
+	t.Run("graph delta contains the vertices, their edges and weights", func(t *testing.T) {
+		v1 := Vertex{Key: "v1", Value: "value1"}
+		v2 := Vertex{Key: "v2", Value: "value2"}
+		v3 := Vertex{Key: "v3", Value: "value3"}
+
+		A := NewGraph(crdt.NewReplica("A"))
+		for _, v := range []Vertex{v1, v2, v3} {
+			require.NoError(t, A.AddVertex(v))
+		}
+		B := NewGraph(crdt.NewReplica("B"))
+		B.Merge(A)
+
+		require.NoError(t, A.AddEdge(v1.Key, v2.Key))
+		require.NoError(t, A.AddEdgeWeight(v1.Key, v2.Key, 5))
+		require.NoError(t, A.UpdateVertex(Vertex{Key: v3.Key, Value: "updated"}))
+
+		delta := A.Delta([]string{v1.Key, v3.Key})
+		require.Len(t, delta.vertices.records(""), 2)
+
+		B.Merge(delta)
+		requireEqualGraphs(t, A, B)
+		weight, err := B.EdgeWeight(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), weight)
+	})
+
+	t.Run("implements crdt.DeltaCRDT", func(t *testing.T) {
+		var c crdt.CRDT = NewGraph(crdt.NewReplica("A"))
+		delta, isDelta := c.(crdt.DeltaCRDT)
+		require.True(t, isDelta)
+		require.Equal(t, GraphKind, delta.DeltaCRDT(nil).Kind())
+
+		c = NewSet(crdt.NewReplica("A"))
+		delta, isDelta = c.(crdt.DeltaCRDT)
+		require.True(t, isDelta)
+		require.Equal(t, SetKind, delta.DeltaCRDT(nil).Kind())
+	})
+}
@@ -0,0 +1,44 @@
+package lww
+
+// Diff returns the changes merging the `remote` graph would make without changing the graph:
+// the same events `Merge` would publish to the subscribers (see `Subscribe`), vertices first, in the key order.
+// Use it for previewing a merge, reconciliation dashboards and tests.
+//
+// The merge is applied to a copy of the graph, so it takes as much memory as the graph itself.
+// The replica journal, logger, metrics and observer are not notified.
+func (g Graph) Diff(remote Graph) []GraphEvent {
+	g.checkMerge(remote)
+	dry := g.dryRun()
+
+	changes := &changes{
+		graph:    dry,
+		merged:   true,
+		vertices: make(map[string]*Vertex),
+		edges:    make(map[string]map[string]*Edge),
+	}
+	dry.mutex.Lock()
+	defer dry.mutex.Unlock()
+
+	changes.merge(remote)
+	// merging without cancellation cannot fail
+	_ = dry.mergeState(remote, nil, nil)
+	return changes.events()
+}
+
+// dryRun returns a copy of the graph with a replica that has no side effects:
+// the journal, the logger, the metrics and the observer discard everything
+func (g Graph) dryRun() Graph {
+	dry := g.clone()
+
+	r := g.replica
+	r.Journal, r.Logger, r.Metrics, r.Observer = nil, nil, nil, nil
+	r = r.WithDefaults()
+
+	dry.replica = r
+	dry.vertices.replica = r
+	for key, adjacent := range dry.edges {
+		adjacent.replica = r
+		dry.edges[key] = adjacent
+	}
+	return dry
+}
@@ -0,0 +1,65 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	replica := func(id string, offset time.Duration) crdt.Replica {
+		return crdt.Replica{
+			ID:    id,
+			Clock: clock.Func(func() time.Time { return base.Add(offset) }),
+		}
+	}
+
+	t.Run("returns the changes a merge would make without making them", func(t *testing.T) {
+		var observed []crdt.Mutation
+		r := replica("local", 0)
+		r.Observer = crdt.ObserverFunc(func(m crdt.Mutation) { observed = append(observed, m) })
+		local := NewGraph(r)
+		remote := NewGraph(replica("remote", time.Second))
+
+		require.NoError(t, local.AddVertex(Vertex{Key: "same", Value: "v"}))
+		require.NoError(t, local.AddVertex(Vertex{Key: "updated", Value: "old"}))
+		require.NoError(t, local.AddVertex(Vertex{Key: "removed"}))
+		require.NoError(t, local.AddEdge("updated", "removed"))
+		remote.Merge(local)
+		require.NoError(t, remote.UpdateVertex(Vertex{Key: "updated", Value: "new"}))
+		require.NoError(t, remote.RemoveVertex("removed"))
+		require.NoError(t, remote.AddVertex(Vertex{Key: "added"}))
+		require.NoError(t, remote.AddEdge("added", "same"))
+
+		before, err := local.List()
+		require.NoError(t, err)
+		observed = nil
+
+		at := base.Add(time.Second)
+		require.Equal(t, []GraphEvent{
+			{Type: VertexAdded, Vertex: Vertex{Key: "added"}, Origin: "remote", Timestamp: at, Merged: true},
+			{Type: VertexRemoved, Vertex: Vertex{Key: "removed"}, Origin: "remote", Timestamp: at, Merged: true},
+			{Type: VertexUpdated, Vertex: Vertex{Key: "updated", Value: "new"}, Origin: "remote", Timestamp: at, Merged: true},
+			{Type: EdgeAdded, From: "added", Edge: Edge{To: "same"}, Origin: "remote", Timestamp: at, Merged: true},
+		}, local.Diff(remote))
+
+		after, err := local.List()
+		require.NoError(t, err)
+		require.Equal(t, before, after)
+		require.Empty(t, observed)
+	})
+
+	t.Run("returns no changes for merged replicas", func(t *testing.T) {
+		local := NewGraph(replica("local", 0))
+		remote := NewGraph(replica("remote", time.Second))
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v1"}))
+		require.Len(t, local.Diff(remote), 1)
+
+		local.Merge(remote)
+		require.Empty(t, local.Diff(remote))
+	})
+}
@@ -0,0 +1,130 @@
+package lww
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDOTName is the name of the exported digraph if `DOTConfig.Name` is not set
+const DefaultDOTName = "graph"
+
+// DOTConfig configures the Graphviz export of a graph
+type DOTConfig struct {
+	// Name is the name of the digraph, `DefaultDOTName` if it's empty
+	Name string
+	// Values adds the vertex values to the vertex labels
+	Values bool
+	// Tombstones adds the removed vertices, the removed edges and the hanging edges (edges of removed vertices
+	// and edges pointing to removed vertices) drawn dashed in gray, so divergent replicas can be compared visually
+	Tombstones bool
+}
+
+// ExportDOT writes the graph in the Graphviz DOT format, e.g. for rendering it with `dot -Tsvg`.
+// Vertices and edges are written in the order of their keys, so equal graphs produce equal output.
+// Edge labels are written as edge labels, the edge weights are not exported.
+func (g Graph) ExportDOT(w io.Writer, config DOTConfig) error {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	if config.Name == "" {
+		config.Name = DefaultDOTName
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %s {\n", dotID(config.Name))
+
+	vertices := g.vertices.records("")
+	live := make(map[string]bool, len(vertices))
+	for _, key := range sortedRecordKeys(vertices) {
+		vertex, err := g.Lookup(key)
+		if err != nil && !errors.Is(err, ErrVertexNotFound) {
+			return err
+		}
+		live[key] = err == nil
+		if !live[key] && !config.Tombstones {
+			continue
+		}
+
+		label := key
+		if live[key] && config.Values && vertex.Value != "" {
+			label += "\n" + vertex.Value
+		}
+		fmt.Fprintf(bw, "  %s [label=%s%s];\n", dotID(key), dotID(label), dotTombstone(!live[key]))
+	}
+
+	fromKeys := make([]string, 0, len(g.edges))
+	for fromKey := range g.edges {
+		fromKeys = append(fromKeys, fromKey)
+	}
+	sort.Strings(fromKeys)
+
+	// targets of hanging edges the graph has no records of
+	missing := []string{}
+	for _, fromKey := range fromKeys {
+		edges := g.edges[fromKey].records("")
+		for _, toKey := range sortedRecordKeys(edges) {
+			record := edges[toKey]
+			_, err := g.edges[fromKey].Lookup(toKey)
+			removed := err != nil
+			hanging := !live[fromKey] || !live[toKey]
+			if (removed || hanging) && !config.Tombstones {
+				continue
+			}
+			if _, known := vertices[toKey]; !known {
+				missing = append(missing, toKey)
+			}
+
+			attributes := ""
+			if record.element != nil {
+				if label := toEdge(record.element).Label; label != "" {
+					attributes = "label=" + dotID(label)
+				}
+			}
+			if tombstone := dotTombstone(removed || hanging); tombstone != "" {
+				attributes = strings.TrimPrefix(attributes+tombstone, ", ")
+			}
+			if attributes != "" {
+				attributes = " [" + attributes + "]"
+			}
+			fmt.Fprintf(bw, "  %s -> %s%s;\n", dotID(fromKey), dotID(toKey), attributes)
+		}
+	}
+
+	sort.Strings(missing)
+	for i, key := range missing {
+		if i > 0 && missing[i-1] == key {
+			continue
+		}
+		fmt.Fprintf(bw, "  %s [label=%s%s];\n", dotID(key), dotID(key), dotTombstone(true))
+	}
+
+	fmt.Fprintf(bw, "}\n")
+	err := bw.Flush()
+	if err != nil {
+		return errors.Wrap(err, "failed to write the DOT graph")
+	}
+	return nil
+}
+
+// dotTombstone returns the attributes of removed vertices and edges prefixed with a comma,
+// an empty string if `tombstone` is `false`
+func dotTombstone(tombstone bool) string {
+	if !tombstone {
+		return ""
+	}
+	return ", style=dashed, color=gray, fontcolor=gray"
+}
+
+// dotID returns the quoted DOT identifier of the string
+func dotID(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,59 @@
+package lww
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportDOT(t *testing.T) {
+	newGraph := func(t *testing.T) Graph {
+		g := NewGraph(crdt.NewReplica("A"))
+		require.NoError(t, g.AddVertex(Vertex{Key: "v1", Value: "first"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "v2", Value: `say "hi"`}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "v3"}))
+		require.NoError(t, g.AddWeightedEdge("v1", Edge{To: "v2", Label: "knows"}))
+		require.NoError(t, g.AddEdge("v2", "v3"))
+		require.NoError(t, g.AddEdge("v1", "v3"))
+		require.NoError(t, g.RemoveEdge("v1", "v3"))
+		require.NoError(t, g.RemoveVertex("v3"))
+		return g
+	}
+
+	t.Run("exports the vertices and edges", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, newGraph(t).ExportDOT(&buf, DOTConfig{}))
+		require.Equal(t, `digraph "graph" {
+  "v1" [label="v1"];
+  "v2" [label="v2"];
+  "v1" -> "v2" [label="knows"];
+}
+`, buf.String())
+	})
+
+	t.Run("exports the values and the tombstones", func(t *testing.T) {
+		g := newGraph(t)
+		// an edge to a vertex the replica has no records of
+		remote := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v1"}))
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v4"}))
+		require.NoError(t, remote.AddEdge("v1", "v4"))
+		g.getAdjacent("v1").Merge(remote.getAdjacent("v1"))
+
+		var buf bytes.Buffer
+		require.NoError(t, g.ExportDOT(&buf, DOTConfig{Name: "replica A", Values: true, Tombstones: true}))
+		require.Equal(t, `digraph "replica A" {
+  "v1" [label="v1\nfirst"];
+  "v2" [label="v2\nsay \"hi\""];
+  "v3" [label="v3", style=dashed, color=gray, fontcolor=gray];
+  "v1" -> "v2" [label="knows"];
+  "v1" -> "v3" [style=dashed, color=gray, fontcolor=gray];
+  "v1" -> "v4" [style=dashed, color=gray, fontcolor=gray];
+  "v2" -> "v3" [style=dashed, color=gray, fontcolor=gray];
+  "v4" [label="v4", style=dashed, color=gray, fontcolor=gray];
+}
+`, buf.String())
+	})
+}
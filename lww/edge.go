@@ -0,0 +1,247 @@
+package lww
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Edge is an element of the set of adjacent vertices, it points to the vertex with the key `To`
+// and carries a weight, a label and arbitrary attributes. The edge is updated as a whole,
+// so concurrent updates of the same edge (including updates of different attributes) are resolved by the last writer,
+// unlike the counter weight changed by `AddEdgeWeight` where concurrent updates add up.
+//
+// `Weight` is the base weight of the edge, the counter is added on top of it:
+// `Graph.EdgeWeight` returns their sum, `Graph.GetEdge` returns the base weight alone.
+//
+// An edge without a weight, a label and attributes is serialized as its key alone, the same way `IDElement` is,
+// so states serialized before edges carried data remain readable and vice versa.
+type Edge struct {
+	// To is the key of the vertex the edge points to
+	To string `json:"to"`
+	// Weight is an arbitrary base weight of the edge, e.g. a distance or a cost,
+	// the total weight is this base plus the counter changed by `Graph.AddEdgeWeight`
+	Weight int64 `json:"weight,omitempty"`
+	// Label is an arbitrary label of the edge, e.g. a relationship type
+	Label string `json:"label,omitempty"`
+	// Attributes is arbitrary metadata of the edge, it must not be modified after the edge is added
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// GetKey implements the `Element` interface
+func (e Edge) GetKey() string {
+	return e.To
+}
+
+// plain returns `true` if the edge carries nothing but its key
+func (e Edge) plain() bool {
+	return e.Weight == 0 && e.Label == "" && len(e.Attributes) == 0
+}
+
+// clone returns a copy of the edge which does not share the attributes with the edge
+func (e Edge) clone() Edge {
+	if e.Attributes == nil {
+		return e
+	}
+	attributes := make(map[string]string, len(e.Attributes))
+	for k, v := range e.Attributes {
+		attributes[k] = v
+	}
+	e.Attributes = attributes
+	return e
+}
+
+// equal returns `true` if both edges have the same target, weight, label and attributes
+func (e Edge) equal(other Edge) bool {
+	if e.To != other.To || e.Weight != other.Weight || e.Label != other.Label ||
+		len(e.Attributes) != len(other.Attributes) {
+		return false
+	}
+	for name, value := range e.Attributes {
+		otherValue, exists := other.Attributes[name]
+		if !exists || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON implements the `json.Marshaler` interface
+func (e Edge) MarshalJSON() ([]byte, error) {
+	if e.plain() {
+		return json.Marshal(e.To)
+	}
+	// the alias does not have the method, so it's not called recursively
+	type edge Edge
+	return json.Marshal(edge(e))
+}
+
+// UnmarshalJSON implements the `json.Unmarshaler` interface
+func (e *Edge) UnmarshalJSON(data []byte) error {
+	if len(data) != 0 && data[0] == '"' {
+		*e = Edge{}
+		return json.Unmarshal(data, &e.To)
+	}
+	type edge Edge
+	return json.Unmarshal(data, (*edge)(e))
+}
+
+// DecodeEdge is an `ElementDecoder` of `Edge`, it decodes serialized `IDElement` elements too
+func DecodeEdge(data []byte) (Element, error) {
+	var e Edge
+	err := json.Unmarshal(data, &e)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode edge")
+	}
+	return e, nil
+}
+
+// AddWeightedEdge adds a directional edge from a vertex with `fromKey` to a vertex with `edge.To`
+// carrying the weight, the label and the attributes of `edge`, an existing edge is replaced.
+// Returns an error with `ErrVertexNotfound` cause if one of the vertices with the given key does not exist
+func (g Graph) AddWeightedEdge(fromKey string, edge Edge) error {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	_, err = g.Lookup(fromKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = g.Lookup(edge.To)
+	if err != nil {
+		return err
+	}
+
+	changes := g.trackChanges(false)
+	changes.edge(fromKey, edge.To)
+	g.getAdjacent(fromKey).Add(edge.clone())
+	g.indexEdge(g.replica.NormalizeKey(fromKey), g.replica.NormalizeKey(edge.To))
+	changes.publish()
+
+	return nil
+}
+
+// GetEdge returns the edge from a vertex with `fromKey` to a vertex with `toKey`
+// with its base weight, label and attributes, use `EdgeWeight` for the total weight.
+//
+// Returns an error with `ErrVertexNotfound` cause if one of the vertices does not exist.
+// Returns an error with `ErrEdgeNotFound` cause if the edge does not exist.
+func (g Graph) GetEdge(fromKey, toKey string) (Edge, error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	edge, err := g.edge(fromKey, toKey)
+	if err != nil {
+		return Edge{}, err
+	}
+	return edge.clone(), nil
+}
+
+// UpdateEdgeAttributes replaces the attributes of the edge from a vertex with `fromKey` to a vertex with `toKey`
+// keeping its weight and label. Concurrent updates on different replicas are resolved by the last writer,
+// a later update re-adds the edge if it was removed concurrently on another replica.
+//
+// Returns an error with `ErrVertexNotfound` cause if one of the vertices does not exist.
+// Returns an error with `ErrEdgeNotFound` cause if the edge does not exist.
+func (g Graph) UpdateEdgeAttributes(fromKey, toKey string, attributes map[string]string) error {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	edge, err := g.edge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+
+	edge.Attributes = attributes
+	changes := g.trackChanges(false)
+	changes.edge(fromKey, edge.To)
+	g.getAdjacent(fromKey).Add(edge.clone())
+	g.indexEdge(g.replica.NormalizeKey(fromKey), g.replica.NormalizeKey(edge.To))
+	changes.publish()
+
+	return nil
+}
+
+// UpdateEdgeWeight sets the base weight of the edge from a vertex with `fromKey` to a vertex with `toKey`
+// keeping its label and attributes, the counter changed by `AddEdgeWeight` is kept too. Concurrent updates on different replicas are resolved by the last writer,
+// a later update re-adds the edge if it was removed concurrently on another replica.
+//
+// Returns an error with `ErrVertexNotfound` cause if one of the vertices does not exist.
+// Returns an error with `ErrEdgeNotFound` cause if the edge does not exist.
+func (g Graph) UpdateEdgeWeight(fromKey, toKey string, weight int64) error {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	edge, err := g.edge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+
+	edge.Weight = weight
+	changes := g.trackChanges(false)
+	changes.edge(fromKey, edge.To)
+	g.getAdjacent(fromKey).Add(edge.clone())
+	g.indexEdge(g.replica.NormalizeKey(fromKey), g.replica.NormalizeKey(edge.To))
+	changes.publish()
+
+	return nil
+}
+
+// edge returns the existing edge, must be called under the graph lock.
+// Returns an error with `ErrVertexNotfound` cause if one of the vertices does not exist.
+// Returns an error with `ErrEdgeNotFound` cause if the edge does not exist.
+func (g Graph) edge(fromKey, toKey string) (Edge, error) {
+	err := g.lookupEdge(fromKey, toKey)
+	if err != nil {
+		return Edge{}, err
+	}
+
+	element, err := g.edges[g.replica.NormalizeKey(fromKey)].Lookup(toKey)
+	if err != nil {
+		return Edge{}, errors.Wrapf(ErrEdgeNotFound, "failed to find edge [from = %q, to = %q]", fromKey, toKey)
+	}
+	return toEdge(element), nil
+}
+
+// edgeWeight returns the sum of the weight of the existing edge and its counter weight
+// without initializing anything, must be called under the graph lock with normalized keys.
+func (g Graph) edgeWeight(fromKey, toKey string) (weight int64) {
+	if adjacent, exists := g.edges[fromKey]; exists {
+		element, err := adjacent.Lookup(toKey)
+		if err == nil {
+			weight = toEdge(element).Weight
+		}
+	}
+	if counter, exists := g.weights[fromKey][toKey]; exists {
+		weight += counter.Value()
+	}
+	return weight
+}
+
+// toEdge converts an element of the set of adjacent vertices to an edge
+func toEdge(element Element) Edge {
+	if edge, isEdge := element.(Edge); isEdge {
+		return edge
+	}
+	return Edge{To: element.GetKey()}
+}
@@ -0,0 +1,216 @@
+package lww
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// edgeGroupState is the compact serialized format of the edges starting from one vertex.
+//
+// Keys are front-coded: the groups and the records in every group are sorted by the key
+// and every key is stored as the length of the prefix it shares with the previous key plus the rest of the key.
+// Adjacency keys of dense graphs tend to share long prefixes (namespaces, tenants), so most of them are elided.
+type edgeGroupState struct {
+	// Shared is the length of the prefix the source key shares with the source key of the previous group
+	Shared int `json:"p,omitempty"`
+	// Suffix is the rest of the source key
+	Suffix string `json:"k"`
+	// Additions are the addition records of the edges sorted by the target key
+	Additions []edgeAddState `json:"a,omitempty"`
+	// Removals are the removal records of the edges sorted by the target key
+	Removals []edgeRemoveState `json:"r,omitempty"`
+	// Siblings maps a target key to the additions concurrent with its addition record
+	Siblings map[string][]addState `json:"s,omitempty"`
+}
+
+// edgeAddState is the compact serialized format of an edge addition record
+type edgeAddState struct {
+	// Shared is the length of the prefix the target key shares with the target key of the previous record
+	Shared int `json:"p,omitempty"`
+	// Suffix is the rest of the target key
+	Suffix string `json:"k"`
+	// Element is the JSON representation of the edge, omitted if the edge carries nothing but its key
+	Element json.RawMessage `json:"e,omitempty"`
+	// Timestamp is when the edge was added in nanoseconds since the Unix epoch
+	Timestamp int64 `json:"t"`
+	// Replica is the ID of the replica that added the edge
+	Replica string `json:"r,omitempty"`
+	// Observed maps a replica ID to the timestamp of the latest addition by the replica the writer had seen
+	Observed map[string]time.Time `json:"o,omitempty"`
+}
+
+// edgeRemoveState is the compact serialized format of an edge removal record
+type edgeRemoveState struct {
+	// Shared is the length of the prefix the target key shares with the target key of the previous record
+	Shared int `json:"p,omitempty"`
+	// Suffix is the rest of the target key
+	Suffix string `json:"k"`
+	// Timestamp is when the edge was removed in nanoseconds since the Unix epoch
+	Timestamp int64 `json:"t"`
+	// Replica is the ID of the replica that removed the edge
+	Replica string `json:"r,omitempty"`
+}
+
+// compactEdges returns the compact encoding of the edge sets of the graph
+func compactEdges(edges map[string]setState) []edgeGroupState {
+	groups := make([]edgeGroupState, 0, len(edges))
+	previousFrom := ""
+	for _, fromKey := range sortedStateKeys(edges) {
+		adjacent := edges[fromKey]
+		group := edgeGroupState{Siblings: adjacent.Siblings}
+		group.Shared, group.Suffix = frontCode(previousFrom, fromKey)
+		previousFrom = fromKey
+
+		previous := ""
+		for _, toKey := range sortedAddKeys(adjacent.Additions) {
+			added := adjacent.Additions[toKey]
+			record := edgeAddState{
+				Timestamp: added.Timestamp.UnixNano(),
+				Replica:   added.Replica,
+				Observed:  added.Observed,
+			}
+			record.Shared, record.Suffix = frontCode(previous, toKey)
+			previous = toKey
+			if !isPlainEdge(toKey, added.Element) {
+				record.Element = added.Element
+			}
+			group.Additions = append(group.Additions, record)
+		}
+
+		previous = ""
+		for _, toKey := range sortedTimeKeys(adjacent.Removals) {
+			record := edgeRemoveState{
+				Timestamp: adjacent.Removals[toKey].UnixNano(),
+				Replica:   adjacent.RemovedBy[toKey],
+			}
+			record.Shared, record.Suffix = frontCode(previous, toKey)
+			previous = toKey
+			group.Removals = append(group.Removals, record)
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// expandEdges restores the edge sets of the graph from their compact encoding
+func expandEdges(groups []edgeGroupState) (map[string]setState, error) {
+	edges := make(map[string]setState, len(groups))
+	previousFrom := ""
+	for _, group := range groups {
+		fromKey, err := frontDecode(previousFrom, group.Shared, group.Suffix)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal edges")
+		}
+		previousFrom = fromKey
+
+		adjacent := setState{
+			Additions: make(map[string]addState, len(group.Additions)),
+			Removals:  make(map[string]time.Time, len(group.Removals)),
+			Siblings:  group.Siblings,
+		}
+
+		previous := ""
+		for _, record := range group.Additions {
+			toKey, err := frontDecode(previous, record.Shared, record.Suffix)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to unmarshal edges of vertex [key = %q]", fromKey)
+			}
+			previous = toKey
+
+			element := record.Element
+			if element == nil {
+				// encoding a string does not fail
+				element, _ = json.Marshal(toKey)
+			}
+			adjacent.Additions[toKey] = addState{
+				Element:   element,
+				Timestamp: time.Unix(0, record.Timestamp).UTC(),
+				Replica:   record.Replica,
+				Observed:  record.Observed,
+			}
+		}
+
+		previous = ""
+		for _, record := range group.Removals {
+			toKey, err := frontDecode(previous, record.Shared, record.Suffix)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to unmarshal edges of vertex [key = %q]", fromKey)
+			}
+			previous = toKey
+
+			adjacent.Removals[toKey] = time.Unix(0, record.Timestamp).UTC()
+			if record.Replica == "" {
+				continue
+			}
+			if adjacent.RemovedBy == nil {
+				adjacent.RemovedBy = make(map[string]string)
+			}
+			adjacent.RemovedBy[toKey] = record.Replica
+		}
+
+		edges[fromKey] = adjacent
+	}
+
+	return edges, nil
+}
+
+// isPlainEdge returns `true` if the serialized edge element carries nothing but the given key
+func isPlainEdge(key string, element json.RawMessage) bool {
+	// encoding a string does not fail
+	plain, _ := json.Marshal(key)
+	return bytes.Equal(plain, element)
+}
+
+// frontCode returns the length of the prefix `key` shares with `previous` and the rest of `key`,
+// the prefix never ends in the middle of a UTF-8 character, so the rest remains a valid string.
+func frontCode(previous, key string) (shared int, suffix string) {
+	for shared < len(previous) && shared < len(key) && previous[shared] == key[shared] {
+		shared++
+	}
+	for shared > 0 && shared < len(key) && !utf8.RuneStart(key[shared]) {
+		shared--
+	}
+	return shared, key[shared:]
+}
+
+// frontDecode restores the key from the length of the prefix it shares with `previous` and the rest of it
+func frontDecode(previous string, shared int, suffix string) (string, error) {
+	if shared < 0 || shared > len(previous) {
+		return "", errors.Errorf("invalid shared key prefix length %d after key %q", shared, previous)
+	}
+	return previous[:shared] + suffix, nil
+}
+
+func sortedStateKeys(m map[string]setState) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedAddKeys(m map[string]addState) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedTimeKeys(m map[string]time.Time) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
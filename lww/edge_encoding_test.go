@@ -0,0 +1,222 @@
+package lww
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactEdges(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	replica := func(id string, compact bool) crdt.Replica {
+		tick := base
+		return crdt.Replica{ID: id, CompactEdges: compact, Clock: clock.Func(func() time.Time {
+			tick = tick.Add(time.Millisecond)
+			return tick
+		})}
+	}
+	// denseGraph returns a graph where every vertex has an edge to every other vertex of the same tenant
+	denseGraph := func(t testing.TB, r crdt.Replica, tenants, size int) Graph {
+		g := NewGraph(r)
+		for tenant := 0; tenant < tenants; tenant++ {
+			for i := 0; i < size; i++ {
+				require.NoError(t, g.AddVertex(Vertex{Key: fmt.Sprintf("tenant-%d/users/%04d", tenant, i)}))
+			}
+			for i := 0; i < size; i++ {
+				for j := 0; j < size; j++ {
+					if i == j {
+						continue
+					}
+					from := fmt.Sprintf("tenant-%d/users/%04d", tenant, i)
+					to := fmt.Sprintf("tenant-%d/users/%04d", tenant, j)
+					require.NoError(t, g.AddEdge(from, to))
+				}
+			}
+		}
+		return g
+	}
+
+	t.Run("restores the same state", func(t *testing.T) {
+		a := NewGraph(replica("A", true))
+		b := NewGraph(replica("B", true))
+		for _, key := range []string{"v1", "v2", "v3", "ключ1", "ключ2"} {
+			require.NoError(t, a.AddVertex(Vertex{Key: key}))
+		}
+		require.NoError(t, a.AddEdge("v1", "v2"))
+		require.NoError(t, a.AddEdge("v1", "ключ1"))
+		require.NoError(t, a.AddEdge("v1", "ключ2"))
+		weighted := Edge{To: "v3", Weight: 5, Label: "knows", Attributes: map[string]string{"since": "2021"}}
+		require.NoError(t, a.AddWeightedEdge("v2", weighted))
+		require.NoError(t, a.AddEdge("v3", "v1"))
+		require.NoError(t, a.RemoveEdge("v3", "v1"))
+		require.NoError(t, a.AddEdgeWeight("v1", "v2", 3))
+		b.Merge(a)
+		require.NoError(t, b.RemoveEdge("v1", "ключ2"))
+		a.Merge(b)
+
+		data, err := a.Marshal()
+		require.NoError(t, err)
+		var state graphState
+		require.NoError(t, json.Unmarshal(data, &state))
+		require.Nil(t, state.Edges)
+		require.Len(t, state.EdgeGroups, 3)
+
+		restored := NewGraph(replica("C", false))
+		require.NoError(t, restored.Unmarshal(data))
+		requireEqualGraphs(t, a, restored)
+
+		for _, edge := range [][2]string{{"v1", "v2"}, {"v3", "v1"}, {"v1", "ключ2"}} {
+			expected, err := a.LastEdgeWrite(edge[0], edge[1])
+			require.NoError(t, err)
+			actual, err := restored.LastEdgeWrite(edge[0], edge[1])
+			require.NoError(t, err)
+			require.True(t, expected.Timestamp.Equal(actual.Timestamp))
+			expected.Timestamp, actual.Timestamp = time.Time{}, time.Time{}
+			require.Equal(t, expected, actual)
+		}
+
+		found, err := restored.GetEdge("v2", "v3")
+		require.NoError(t, err)
+		require.Equal(t, weighted, found)
+		weight, err := restored.EdgeWeight("v1", "v2")
+		require.NoError(t, err)
+		require.Equal(t, int64(3), weight)
+
+		predecessors, err := restored.FindPredecessors("v2")
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{{Key: "v1"}}, predecessors)
+	})
+
+	t.Run("replicas with different encodings converge", func(t *testing.T) {
+		compact := denseGraph(t, replica("A", true), 2, 5)
+		plain := NewGraph(replica("B", false))
+
+		data, err := compact.Marshal()
+		require.NoError(t, err)
+		remote := NewGraph(replica("A", false))
+		require.NoError(t, remote.Unmarshal(data))
+		plain.Merge(remote)
+		require.NoError(t, plain.RemoveEdge("tenant-0/users/0000", "tenant-0/users/0001"))
+
+		data, err = plain.Marshal()
+		require.NoError(t, err)
+		remote = NewGraph(replica("B", true))
+		require.NoError(t, remote.Unmarshal(data))
+		compact.Merge(remote)
+
+		requireEqualGraphs(t, plain, compact)
+	})
+
+	t.Run("makes the state of dense graphs smaller", func(t *testing.T) {
+		plain, err := denseGraph(t, replica("A", false), 2, 20).Marshal()
+		require.NoError(t, err)
+		compact, err := denseGraph(t, replica("A", true), 2, 20).Marshal()
+		require.NoError(t, err)
+		require.Less(t, len(compact)*2, len(plain))
+	})
+
+	t.Run("formats", func(t *testing.T) {
+		g := denseGraph(t, replica("A", false), 1, 3)
+		for _, tc := range []struct {
+			format            crdt.Format
+			edges, edgeGroups bool
+		}{
+			{format: crdt.FormatV1, edges: true},
+			{format: crdt.FormatV2, edgeGroups: true},
+			{format: crdt.FormatDual, edges: true, edgeGroups: true},
+		} {
+			data, err := g.MarshalFormat(tc.format)
+			require.NoError(t, err)
+			var state graphState
+			require.NoError(t, json.Unmarshal(data, &state))
+			require.Equal(t, tc.edges, state.Edges != nil, tc.format.String())
+			require.Equal(t, tc.edgeGroups, state.EdgeGroups != nil, tc.format.String())
+
+			restored := NewGraph(replica("B", false))
+			require.NoError(t, restored.Unmarshal(data))
+			requireEqualGraphs(t, g, restored)
+		}
+
+		_, err := g.MarshalFormat(crdt.Format(42))
+		require.ErrorIs(t, err, crdt.ErrUnknownFormat)
+	})
+
+	t.Run("dual format is readable by replicas ignoring the compact encoding", func(t *testing.T) {
+		r := replica("A", true)
+		r.DualFormat = true
+		g := denseGraph(t, r, 1, 3)
+		data, err := g.Marshal()
+		require.NoError(t, err)
+
+		// replicas of the previous version don't know the edge groups
+		var state graphState
+		require.NoError(t, json.Unmarshal(data, &state))
+		state.EdgeGroups = nil
+		old := NewGraph(replica("B", false))
+		require.NoError(t, old.restoreState(state))
+		requireEqualGraphs(t, g, old)
+	})
+
+	t.Run("front coding keeps UTF-8 characters whole", func(t *testing.T) {
+		shared, suffix := frontCode("ключ", "клад")
+		require.Equal(t, len("кл"), shared)
+		require.Equal(t, "ад", suffix)
+
+		shared, suffix = frontCode("Ā", "ā")
+		require.Equal(t, 0, shared)
+		require.Equal(t, "ā", suffix)
+	})
+
+	t.Run("fails on an invalid prefix length", func(t *testing.T) {
+		g := NewGraph(replica("A", true))
+		err := g.Unmarshal([]byte(`{"vertices":{},"edges":null,"edgeGroups":[{"p":5,"k":"v1"}]}`))
+		require.Error(t, err)
+	})
+}
+
+// BenchmarkEdgeEncoding compares the size and the speed of the plain and the compact encoding of edges
+// on a dense graph, the size of the state is reported as `bytes/state`.
+func BenchmarkEdgeEncoding(b *testing.B) {
+	for _, compact := range []bool{false, true} {
+		name := "plain"
+		if compact {
+			name = "compact"
+		}
+
+		g := NewGraph(crdt.Replica{ID: "A", CompactEdges: compact})
+		for i := 0; i < 50; i++ {
+			if err := g.AddVertex(Vertex{Key: fmt.Sprintf("tenant/users/%04d", i)}); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for i := 0; i < 50; i++ {
+			for j := 0; j < 50; j++ {
+				if err := g.AddEdge(fmt.Sprintf("tenant/users/%04d", i), fmt.Sprintf("tenant/users/%04d", j)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		data, err := g.Marshal()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name+"/Marshal", func(b *testing.B) {
+			b.ReportMetric(float64(len(data)), "bytes/state")
+			for i := 0; i < b.N; i++ {
+				_, _ = g.Marshal()
+			}
+		})
+		b.Run(name+"/Unmarshal", func(b *testing.B) {
+			restored := NewGraph(crdt.NewReplica("B"))
+			for i := 0; i < b.N; i++ {
+				_ = restored.Unmarshal(data)
+			}
+		})
+	}
+}
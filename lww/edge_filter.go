@@ -0,0 +1,507 @@
+package lww
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidFilter occurs when an edge filter expression cannot be compiled
+	ErrInvalidFilter = errors.New("invalid edge filter expression")
+)
+
+// EdgeFilter decides whether a traversal should follow an edge.
+// Use `CompileEdgeFilter` in order to create it from an expression.
+//
+// The expression language supports:
+// * fields of the edge vertices: `from.key`, `from.value`, `to.key`, `to.value`
+// * fields of the edge itself (see `Edge`): `edge.label`, `edge.weight` and `edge.attributes.<name>`,
+// a missing attribute is an empty string
+// * string literals in double quotes with Go escape sequences: `"value"`
+// * integer literals: `42`, `-1`
+// * comparison operators: `==`, `!=`, `<`, `<=`, `>`, `>=`, they compare integers
+// if one of the operands is `edge.weight` or an integer literal and strings otherwise
+// * string operators: `contains`, `startsWith`, `endsWith`
+// * logical operators: `&&`, `||`, `!` and parentheses
+// * boolean literals: `true`, `false`
+//
+// For example:
+//
+//	to.value != "archived" && (startsWith(to.key, "task/") || from.key == to.key)
+//
+// could be also written with infix string operators:
+//
+//	to.value != "archived" && (to.key startsWith "task/" || from.key == to.key)
+//
+// and edges can be filtered by their data:
+//
+//	edge.label == "depends-on" && edge.weight >= 10 && edge.attributes.color != "red"
+type EdgeFilter struct {
+	// expr is the source expression
+	expr string
+	// root is the compiled expression tree
+	root boolNode
+}
+
+// CompileEdgeFilter parses the given expression and returns a filter ready for use.
+// Returns an error with `ErrInvalidFilter` cause if the expression is invalid.
+func CompileEdgeFilter(expr string) (filter EdgeFilter, err error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return filter, errors.Wrapf(ErrInvalidFilter, "%q: %s", expr, err)
+	}
+
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return filter, errors.Wrapf(ErrInvalidFilter, "%q: %s", expr, err)
+	}
+	if !p.done() {
+		return filter, errors.Wrapf(ErrInvalidFilter, "%q: unexpected %q", expr, p.peek().text)
+	}
+
+	return EdgeFilter{expr: expr, root: root}, nil
+}
+
+// Match returns `true` if the edge from the vertex `from` to the vertex `to` should be followed.
+// The edge is considered to have no weight, label and attributes, use `MatchEdge` for edges with data.
+// A zero `EdgeFilter` matches every edge.
+func (f EdgeFilter) Match(from, to Vertex) bool {
+	return f.MatchEdge(from, to, Edge{To: to.Key})
+}
+
+// MatchEdge returns `true` if the given edge from the vertex `from` to the vertex `to` should be followed.
+// A zero `EdgeFilter` matches every edge.
+func (f EdgeFilter) MatchEdge(from, to Vertex, edge Edge) bool {
+	if f.root == nil {
+		return true
+	}
+	return f.root.eval(filterInput{from: from, to: to, edge: edge})
+}
+
+// String returns the source expression of the filter
+func (f EdgeFilter) String() string {
+	return f.expr
+}
+
+// filterInput is the edge an expression is evaluated for
+type filterInput struct {
+	// from is the vertex the edge starts from
+	from Vertex
+	// to is the vertex the edge points to
+	to Vertex
+	// edge is the edge itself
+	edge Edge
+}
+
+// boolNode is a node of the expression tree that evaluates to a boolean
+type boolNode interface {
+	eval(in filterInput) bool
+}
+
+// stringNode is a node of the expression tree that evaluates to a string
+type stringNode interface {
+	value(in filterInput) string
+}
+
+// literalBool is a boolean literal
+type literalBool bool
+
+func (b literalBool) eval(in filterInput) bool {
+	return bool(b)
+}
+
+// literalString is a string literal
+type literalString string
+
+func (s literalString) value(in filterInput) string {
+	return string(s)
+}
+
+// literalInt is an integer literal, it's evaluated to its decimal representation
+type literalInt string
+
+func (i literalInt) value(in filterInput) string {
+	return string(i)
+}
+
+// fieldNode is a reference to a field of the edge or one of its vertices
+type fieldNode func(in filterInput) string
+
+func (f fieldNode) value(in filterInput) string {
+	return f(in)
+}
+
+// intFieldNode is a reference to an integer field of the edge, it's evaluated to its decimal representation
+type intFieldNode func(in filterInput) string
+
+func (f intFieldNode) value(in filterInput) string {
+	return f(in)
+}
+
+// attributesPrefix is the prefix of the fields referencing edge attributes
+const attributesPrefix = "edge.attributes."
+
+// filterFields are all the fields supported in expressions except the edge attributes
+var filterFields = map[string]stringNode{
+	"from.key":    fieldNode(func(in filterInput) string { return in.from.Key }),
+	"from.value":  fieldNode(func(in filterInput) string { return in.from.Value }),
+	"to.key":      fieldNode(func(in filterInput) string { return in.to.Key }),
+	"to.value":    fieldNode(func(in filterInput) string { return in.to.Value }),
+	"edge.label":  fieldNode(func(in filterInput) string { return in.edge.Label }),
+	"edge.weight": intFieldNode(func(in filterInput) string { return strconv.FormatInt(in.edge.Weight, 10) }),
+}
+
+// isInt returns `true` if the operand evaluates to an integer
+func isInt(n stringNode) bool {
+	switch n.(type) {
+	case literalInt, intFieldNode:
+		return true
+	default:
+		return false
+	}
+}
+
+// filterOperators are all the supported binary string operators
+var filterOperators = map[string]func(a, b string) bool{
+	"==":         func(a, b string) bool { return a == b },
+	"!=":         func(a, b string) bool { return a != b },
+	"<":          func(a, b string) bool { return a < b },
+	"<=":         func(a, b string) bool { return a <= b },
+	">":          func(a, b string) bool { return a > b },
+	">=":         func(a, b string) bool { return a >= b },
+	"contains":   strings.Contains,
+	"startsWith": strings.HasPrefix,
+	"endsWith":   strings.HasSuffix,
+}
+
+// intOperators are the comparison operators applied to integers
+var intOperators = map[string]func(a, b int64) bool{
+	"==": func(a, b int64) bool { return a == b },
+	"!=": func(a, b int64) bool { return a != b },
+	"<":  func(a, b int64) bool { return a < b },
+	"<=": func(a, b int64) bool { return a <= b },
+	">":  func(a, b int64) bool { return a > b },
+	">=": func(a, b int64) bool { return a >= b },
+}
+
+// newComparison returns a node applying the operator with the given name to two operands,
+// comparison operators compare integers if one of the operands is an integer
+func newComparison(name string, left, right stringNode) boolNode {
+	intOp, isComparison := intOperators[name]
+	if isComparison && (isInt(left) || isInt(right)) {
+		return intComparisonNode{op: intOp, left: left, right: right}
+	}
+	return comparisonNode{op: filterOperators[name], left: left, right: right}
+}
+
+// comparisonNode applies a binary string operator to two operands
+type comparisonNode struct {
+	op          func(a, b string) bool
+	left, right stringNode
+}
+
+func (c comparisonNode) eval(in filterInput) bool {
+	return c.op(c.left.value(in), c.right.value(in))
+}
+
+// intComparisonNode applies a binary integer operator to two operands,
+// it's `false` if one of the operands is not an integer
+type intComparisonNode struct {
+	op          func(a, b int64) bool
+	left, right stringNode
+}
+
+func (c intComparisonNode) eval(in filterInput) bool {
+	a, err := strconv.ParseInt(c.left.value(in), 10, 64)
+	if err != nil {
+		return false
+	}
+	b, err := strconv.ParseInt(c.right.value(in), 10, 64)
+	if err != nil {
+		return false
+	}
+	return c.op(a, b)
+}
+
+// notNode negates its operand
+type notNode struct {
+	operand boolNode
+}
+
+func (n notNode) eval(in filterInput) bool {
+	return !n.operand.eval(in)
+}
+
+// andNode is a conjunction of its operands
+type andNode struct {
+	left, right boolNode
+}
+
+func (n andNode) eval(in filterInput) bool {
+	return n.left.eval(in) && n.right.eval(in)
+}
+
+// orNode is a disjunction of its operands
+type orNode struct {
+	left, right boolNode
+}
+
+func (n orNode) eval(in filterInput) bool {
+	return n.left.eval(in) || n.right.eval(in)
+}
+
+// tokenKind is a kind of a lexical token of the expression
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenInt
+	tokenOperator
+	tokenPunct
+)
+
+// filterToken is a lexical token of the expression
+type filterToken struct {
+	kind tokenKind
+	text string
+}
+
+// tokenizeFilter splits the expression into tokens
+func tokenizeFilter(expr string) (tokens []filterToken, err error) {
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '"':
+			end := i + 1
+			for ; end < len(runes) && runes[end] != '"'; end++ {
+				if runes[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(runes) {
+				return nil, errors.New("unterminated string literal")
+			}
+			unquoted, err := strconv.Unquote(string(runes[i : end+1]))
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid string literal")
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: unquoted})
+			i = end + 1
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i + 1
+			for end < len(runes) && unicode.IsDigit(runes[end]) {
+				end++
+			}
+			text := string(runes[i:end])
+			if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+				return nil, errors.Wrap(err, "invalid integer literal")
+			}
+			tokens = append(tokens, filterToken{kind: tokenInt, text: text})
+			i = end
+
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) ||
+				runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: tokenIdent, text: string(runes[i:end])})
+			i = end
+
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, filterToken{kind: tokenPunct, text: string(r)})
+			i++
+
+		default:
+			matched := false
+			for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!"} {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, filterToken{kind: tokenOperator, text: op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, errors.Errorf("unexpected character %q", r)
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser of the expression
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.done() {
+		return filterToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+// accept consumes the next token if it has the given text
+func (p *filterParser) accept(text string) bool {
+	if p.done() || p.tokens[p.pos].kind == tokenString || p.tokens[p.pos].kind == tokenInt ||
+		p.tokens[p.pos].text != text {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// expect consumes the next token and fails if it does not have the given text
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		return errors.Errorf("expected %q", text)
+	}
+	return nil
+}
+
+// parseOr parses `and ('||' and)*`
+func (p *filterParser) parseOr() (boolNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses `unary ('&&' unary)*`
+func (p *filterParser) parseAnd() (boolNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses `'!' unary | '(' or ')' | 'true' | 'false' | function call | comparison`
+func (p *filterParser) parseUnary() (boolNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+
+	if p.accept("true") {
+		return literalBool(true), nil
+	}
+	if p.accept("false") {
+		return literalBool(false), nil
+	}
+
+	// function call syntax for string operators: `contains(to.key, "x")`
+	next := p.peek()
+	if next.kind == tokenIdent && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "(" {
+		_, isOperator := filterOperators[next.text]
+		if !isOperator {
+			return nil, errors.Errorf("unknown function %q", next.text)
+		}
+		p.pos += 2
+		left, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(","); err != nil {
+			return nil, err
+		}
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return newComparison(next.text, left, right), p.expect(")")
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	opToken := p.peek()
+	_, isOperator := filterOperators[opToken.text]
+	if p.done() || opToken.kind == tokenString || opToken.kind == tokenInt || !isOperator {
+		return nil, errors.Errorf("expected an operator after operand, got %q", opToken.text)
+	}
+	p.pos++
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return newComparison(opToken.text, left, right), nil
+}
+
+// parseOperand parses a string literal, an integer literal or a field reference
+func (p *filterParser) parseOperand() (stringNode, error) {
+	if p.done() {
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	token := p.tokens[p.pos]
+	switch token.kind {
+	case tokenString:
+		p.pos++
+		return literalString(token.text), nil
+	case tokenInt:
+		p.pos++
+		return literalInt(token.text), nil
+	case tokenIdent:
+		if strings.HasPrefix(token.text, attributesPrefix) && len(token.text) > len(attributesPrefix) {
+			name := strings.TrimPrefix(token.text, attributesPrefix)
+			p.pos++
+			return fieldNode(func(in filterInput) string { return in.edge.Attributes[name] }), nil
+		}
+		field, exists := filterFields[token.text]
+		if !exists {
+			return nil, errors.Errorf("unknown field %q", token.text)
+		}
+		p.pos++
+		return field, nil
+	default:
+		return nil, errors.Errorf("expected a field or a string, got %q", token.text)
+	}
+}
@@ -0,0 +1,167 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEdgeFilter(t *testing.T) {
+	from := Vertex{Key: "task/1", Value: "open"}
+	to := Vertex{Key: "task/2", Value: "archived"}
+
+	t.Run("Match", func(t *testing.T) {
+		testCases := []struct {
+			expr     string
+			expected bool
+		}{
+			{expr: `true`, expected: true},
+			{expr: `false`, expected: false},
+			{expr: `to.value == "archived"`, expected: true},
+			{expr: `to.value != "archived"`, expected: false},
+			{expr: `from.key < to.key`, expected: true},
+			{expr: `from.key >= to.key`, expected: false},
+			{expr: `to.key startsWith "task/"`, expected: true},
+			{expr: `endsWith(to.key, "/2")`, expected: true},
+			{expr: `contains(from.value, "pen") && !(to.value == "archived")`, expected: false},
+			{expr: `from.value == "closed" || to.key contains "2"`, expected: true},
+			{expr: `"a\"b" == "a\"b"`, expected: true},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.expr, func(t *testing.T) {
+				filter, err := CompileEdgeFilter(tc.expr)
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, filter.Match(from, to))
+				require.Equal(t, tc.expr, filter.String())
+			})
+		}
+	})
+
+	t.Run("MatchEdge", func(t *testing.T) {
+		edge := Edge{To: to.Key, Weight: 12, Label: "depends-on", Attributes: map[string]string{"color": "red"}}
+		testCases := []struct {
+			expr     string
+			expected bool
+		}{
+			{expr: `edge.label == "depends-on"`, expected: true},
+			{expr: `edge.label startsWith "blocks"`, expected: false},
+			{expr: `edge.weight == 12`, expected: true},
+			// integers, not strings, are compared
+			{expr: `edge.weight > 9`, expected: true},
+			{expr: `edge.weight <= -1`, expected: false},
+			{expr: `edge.weight >= "10"`, expected: true},
+			{expr: `edge.weight contains "2"`, expected: true},
+			{expr: `edge.attributes.color == "red"`, expected: true},
+			{expr: `edge.attributes.size == ""`, expected: true},
+			{expr: `edge.attributes.color != "red" || to.value == "archived"`, expected: true},
+			{expr: `edge.attributes.color > 1`, expected: false},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.expr, func(t *testing.T) {
+				filter, err := CompileEdgeFilter(tc.expr)
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, filter.MatchEdge(from, to, edge))
+			})
+		}
+
+		filter, err := CompileEdgeFilter(`edge.label == "depends-on"`)
+		require.NoError(t, err)
+		require.False(t, filter.Match(from, to), "the edge has no data in Match")
+	})
+
+	t.Run("zero filter matches every edge", func(t *testing.T) {
+		require.True(t, EdgeFilter{}.Match(from, to))
+	})
+
+	t.Run("returns ErrInvalidFilter for invalid expressions", func(t *testing.T) {
+		invalid := []string{
+			``,
+			`to.value`,
+			`to.value ==`,
+			`to.unknown == "a"`,
+			`unknown(to.key, "a")`,
+			`(to.key == "a"`,
+			`to.key == "a")`,
+			`to.key == "a`,
+			`to.key = "a"`,
+			`to.key == "a" &&`,
+			`edge.attributes. == "a"`,
+			`edge.unknown == "a"`,
+			`edge.weight == 99999999999999999999`,
+			`edge.weight 1`,
+		}
+
+		for _, expr := range invalid {
+			t.Run(expr, func(t *testing.T) {
+				_, err := CompileEdgeFilter(expr)
+				require.ErrorIs(t, err, ErrInvalidFilter)
+			})
+		}
+	})
+
+	t.Run("traversals follow only matching edges", func(t *testing.T) {
+		v1 := Vertex{Key: "vertex1", Value: "active"}
+		v2 := Vertex{Key: "vertex2", Value: "archived"}
+		v3 := Vertex{Key: "vertex3", Value: "active"}
+		v4 := Vertex{Key: "vertex4", Value: "active"}
+
+		// v1---->v2---->v3
+		//  |             ^
+		//  v             |
+		// v4-------------+
+		g := NewGraph(testReplica)
+		for _, v := range []Vertex{v1, v2, v3, v4} {
+			require.NoError(t, g.AddVertex(v))
+		}
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		require.NoError(t, g.AddEdge(v2.Key, v3.Key))
+		require.NoError(t, g.AddEdge(v1.Key, v4.Key))
+		require.NoError(t, g.AddEdge(v4.Key, v3.Key))
+
+		filter, err := CompileEdgeFilter(`to.value != "archived"`)
+		require.NoError(t, err)
+
+		connected, err := g.FindConnectedFiltered(v1.Key, filter)
+		require.NoError(t, err)
+		sortVertices(connected)
+		require.Equal(t, []Vertex{v3, v4}, connected)
+
+		path, err := g.FindPathFiltered(v1.Key, v3.Key, filter)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v1, v4, v3}, path)
+
+		_, err = g.FindPathFiltered(v1.Key, v2.Key, filter)
+		require.ErrorIs(t, err, ErrPathNotFound)
+	})
+
+	t.Run("traversals follow only edges with matching data", func(t *testing.T) {
+		v1 := Vertex{Key: "vertex1"}
+		v2 := Vertex{Key: "vertex2"}
+		v3 := Vertex{Key: "vertex3"}
+
+		// v1--blocks-->v2--depends-on-->v3
+		//  |                            ^
+		//  +---------depends-on---------+
+		g := NewGraph(testReplica)
+		for _, v := range []Vertex{v1, v2, v3} {
+			require.NoError(t, g.AddVertex(v))
+		}
+		require.NoError(t, g.AddWeightedEdge(v1.Key, Edge{To: v2.Key, Label: "blocks"}))
+		require.NoError(t, g.AddWeightedEdge(v2.Key, Edge{To: v3.Key, Label: "depends-on"}))
+		require.NoError(t, g.AddWeightedEdge(v1.Key, Edge{To: v3.Key, Label: "depends-on", Weight: 5}))
+
+		filter, err := CompileEdgeFilter(`edge.label == "depends-on"`)
+		require.NoError(t, err)
+		connected, err := g.FindConnectedFiltered(v1.Key, filter)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v3}, connected)
+
+		filter, err = CompileEdgeFilter(`edge.weight < 5`)
+		require.NoError(t, err)
+		path, err := g.FindPathFiltered(v1.Key, v3.Key, filter)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v1, v2, v3}, path)
+	})
+}
@@ -0,0 +1,215 @@
+package lww
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEdge(t *testing.T) {
+	v1 := Vertex{Key: "vertex1", Value: "value1"}
+	v2 := Vertex{Key: "vertex2", Value: "value2"}
+	v3 := Vertex{Key: "vertex3", Value: "value3"}
+
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	ticking := func(id string, offset time.Duration) crdt.Replica {
+		tick := base.Add(offset)
+		return crdt.Replica{ID: id, Clock: clock.Func(func() time.Time {
+			tick = tick.Add(time.Second)
+			return tick
+		})}
+	}
+	newGraph := func(t *testing.T, r crdt.Replica) Graph {
+		g := NewGraph(r)
+		for _, v := range []Vertex{v1, v2, v3} {
+			require.NoError(t, g.AddVertex(v))
+		}
+		return g
+	}
+
+	t.Run("serializes plain edges as keys", func(t *testing.T) {
+		data, err := json.Marshal(Edge{To: "key"})
+		require.NoError(t, err)
+		require.Equal(t, `"key"`, string(data))
+
+		data, err = json.Marshal(Edge{To: "key", Weight: 2, Label: "label"})
+		require.NoError(t, err)
+		require.Equal(t, `{"to":"key","weight":2,"label":"label"}`, string(data))
+
+		for _, serialized := range []string{`"key"`, `{"to":"key","weight":2,"label":"label"}`} {
+			decoded, err := DecodeEdge([]byte(serialized))
+			require.NoError(t, err)
+			data, err := json.Marshal(decoded)
+			require.NoError(t, err)
+			require.Equal(t, serialized, string(data))
+		}
+
+		_, err = DecodeEdge([]byte(`[]`))
+		require.Error(t, err)
+	})
+
+	t.Run("AddWeightedEdge adds or replaces the edge", func(t *testing.T) {
+		g := newGraph(t, ticking("A", 0))
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		require.NoError(t, g.AddWeightedEdge(v1.Key, Edge{To: v2.Key, Weight: 5, Label: "road"}))
+
+		edge, err := g.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: v2.Key, Weight: 5, Label: "road"}, edge)
+
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		edge, err = g.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: v2.Key, Weight: 5, Label: "road"}, edge, "re-adding must keep the weight")
+
+		err = g.AddWeightedEdge(v1.Key, Edge{To: "non-existing"})
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("UpdateEdgeWeight keeps the label", func(t *testing.T) {
+		g := newGraph(t, ticking("A", 0))
+		require.NoError(t, g.AddWeightedEdge(v1.Key, Edge{To: v2.Key, Weight: 5, Label: "road"}))
+		require.NoError(t, g.UpdateEdgeWeight(v1.Key, v2.Key, 7))
+
+		edge, err := g.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: v2.Key, Weight: 7, Label: "road"}, edge)
+
+		err = g.UpdateEdgeWeight(v2.Key, v1.Key, 1)
+		require.ErrorIs(t, err, ErrEdgeNotFound)
+		err = g.UpdateEdgeWeight(v1.Key, "non-existing", 1)
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("concurrent weight updates are resolved by the last writer", func(t *testing.T) {
+		a := newGraph(t, ticking("A", 0))
+		b := NewGraph(ticking("B", time.Minute))
+		require.NoError(t, a.AddEdge(v1.Key, v2.Key))
+		b.Merge(a)
+
+		require.NoError(t, b.UpdateEdgeWeight(v1.Key, v2.Key, 2))
+		require.NoError(t, a.UpdateEdgeWeight(v1.Key, v2.Key, 1))
+		replicateGraphs(a, b)
+
+		for _, g := range []Graph{a, b} {
+			edge, err := g.GetEdge(v1.Key, v2.Key)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), edge.Weight)
+		}
+	})
+
+	t.Run("weights survive serialization and namespace export", func(t *testing.T) {
+		g := newGraph(t, ticking("A", 0))
+		require.NoError(t, g.AddWeightedEdge(v1.Key, Edge{To: v2.Key, Weight: 3, Label: "road"}))
+
+		data, err := g.Marshal()
+		require.NoError(t, err)
+		restored := NewGraph(testReplica)
+		require.NoError(t, restored.Unmarshal(data))
+		edge, err := restored.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: v2.Key, Weight: 3, Label: "road"}, edge)
+
+		data, err = g.ExportNamespace("vertex")
+		require.NoError(t, err)
+		imported := NewGraph(testReplica)
+		require.NoError(t, imported.ImportNamespace("vertex", data, nil))
+		edge, err = imported.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: v2.Key, Weight: 3, Label: "road"}, edge)
+	})
+
+	t.Run("weighted path queries use edge weights", func(t *testing.T) {
+		g := newGraph(t, ticking("A", 0))
+		require.NoError(t, g.AddWeightedEdge(v1.Key, Edge{To: v3.Key, Weight: 10}))
+		require.NoError(t, g.AddWeightedEdge(v1.Key, Edge{To: v2.Key, Weight: 2}))
+		require.NoError(t, g.AddWeightedEdge(v2.Key, Edge{To: v3.Key, Weight: 3}))
+
+		path, weight, err := g.FindWeightedShortestPath(v1.Key, v3.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v1, v2, v3}, path)
+		require.Equal(t, int64(5), weight)
+
+		// counter weights add up with edge weights
+		require.NoError(t, g.AddEdgeWeight(v2.Key, v3.Key, 6))
+		path, weight, err = g.FindWeightedShortestPath(v1.Key, v3.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v1, v3}, path)
+		require.Equal(t, int64(10), weight)
+	})
+
+	t.Run("GetEdge returns the edge with its attributes", func(t *testing.T) {
+		g := newGraph(t, ticking("A", 0))
+		attributes := map[string]string{"type": "depends-on"}
+		require.NoError(t, g.AddWeightedEdge(v1.Key, Edge{To: v2.Key, Attributes: attributes}))
+		attributes["type"] = "modified by the caller"
+
+		edge, err := g.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: v2.Key, Attributes: map[string]string{"type": "depends-on"}}, edge)
+		edge.Attributes["type"] = "modified by the caller"
+
+		edge, err = g.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, "depends-on", edge.Attributes["type"], "the stored edge must not be shared")
+
+		require.NoError(t, g.AddEdge(v2.Key, v3.Key))
+		edge, err = g.GetEdge(v2.Key, v3.Key)
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: v3.Key}, edge)
+
+		_, err = g.GetEdge(v3.Key, v1.Key)
+		require.ErrorIs(t, err, ErrEdgeNotFound)
+		_, err = g.GetEdge(v1.Key, "non-existing")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		require.NoError(t, g.RemoveEdge(v2.Key, v3.Key))
+		_, err = g.GetEdge(v2.Key, v3.Key)
+		require.ErrorIs(t, err, ErrEdgeNotFound)
+	})
+
+	t.Run("concurrent attribute updates are resolved by the last writer", func(t *testing.T) {
+		a := newGraph(t, ticking("A", 0))
+		b := NewGraph(ticking("B", time.Minute))
+		require.NoError(t, a.AddWeightedEdge(v1.Key, Edge{To: v2.Key, Weight: 1, Label: "road"}))
+		b.Merge(a)
+
+		require.NoError(t, b.UpdateEdgeAttributes(v1.Key, v2.Key, map[string]string{"lanes": "2"}))
+		require.NoError(t, a.UpdateEdgeAttributes(v1.Key, v2.Key, map[string]string{"lanes": "1"}))
+		replicateGraphs(a, b)
+
+		for _, g := range []Graph{a, b} {
+			edge, err := g.GetEdge(v1.Key, v2.Key)
+			require.NoError(t, err)
+			require.Equal(t, Edge{To: v2.Key, Weight: 1, Label: "road", Attributes: map[string]string{"lanes": "2"}}, edge)
+		}
+
+		err := a.UpdateEdgeAttributes(v2.Key, v1.Key, nil)
+		require.ErrorIs(t, err, ErrEdgeNotFound)
+	})
+
+	t.Run("attributes survive serialization and namespace export", func(t *testing.T) {
+		g := newGraph(t, ticking("A", 0))
+		expected := Edge{To: v2.Key, Attributes: map[string]string{"type": "depends-on"}}
+		require.NoError(t, g.AddWeightedEdge(v1.Key, expected))
+
+		data, err := g.Marshal()
+		require.NoError(t, err)
+		restored := NewGraph(testReplica)
+		require.NoError(t, restored.Unmarshal(data))
+		edge, err := restored.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, expected, edge)
+
+		data, err = g.ExportNamespace("vertex")
+		require.NoError(t, err)
+		imported := NewGraph(testReplica)
+		require.NoError(t, imported.ImportNamespace("vertex", data, nil))
+		edge, err = imported.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, expected, edge)
+	})
+}
@@ -0,0 +1,103 @@
+package lww
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/counter"
+)
+
+// AddEdgeWeight adds `delta` to the weight of the edge from a vertex with `fromKey` to a vertex with `toKey`,
+// negative values decrease the weight.
+//
+// The weight is a PN-Counter where every replica contributes under its own ID,
+// so concurrent weight updates on different replicas add up instead of overwriting each other.
+// It's useful for counting traffic or interactions between vertices.
+// The total weight of the edge is the sum of `Edge.Weight` and the counter (see `EdgeWeight`).
+//
+// Returns an error with `ErrVertexNotfound` cause if one of the vertices does not exist.
+// Returns an error with `ErrEdgeNotFound` cause if the edge does not exist.
+func (g Graph) AddEdgeWeight(fromKey, toKey string, delta int64) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	err = g.lookupEdge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+	if delta == 0 {
+		// an empty counter would make the state differ from the replicas that never had it
+		return nil
+	}
+
+	g.getWeight(fromKey, toKey).Add(delta)
+
+	return nil
+}
+
+// EdgeWeight returns the total weight of the edge from a vertex with `fromKey` to a vertex with `toKey`:
+// the last-writer-wins `Edge.Weight` set by `AddWeightedEdge` and `UpdateEdgeWeight` plus the counter
+// changed by `AddEdgeWeight`. It's the weight used by `FindWeightedShortestPath` and `Canonical`.
+// The counter is kept when the edge is removed and restored when the edge is added again.
+//
+// Returns an error with `ErrVertexNotfound` cause if one of the vertices does not exist.
+// Returns an error with `ErrEdgeNotFound` cause if the edge does not exist.
+func (g Graph) EdgeWeight(fromKey, toKey string) (int64, error) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	err := g.lookupEdge(fromKey, toKey)
+	if err != nil {
+		return 0, err
+	}
+
+	// nothing is initialized here, so it's safe under the read lock
+	return g.edgeWeight(g.replica.NormalizeKey(fromKey), g.replica.NormalizeKey(toKey)), nil
+}
+
+// lookupEdge returns an error if the edge or any of its vertices does not exist
+func (g Graph) lookupEdge(fromKey, toKey string) error {
+	_, err := g.Lookup(fromKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = g.Lookup(toKey)
+	if err != nil {
+		return err
+	}
+
+	// the set of adjacent keys is not initialized here, so it's safe under the read lock
+	adjacent, exists := g.edges[g.replica.NormalizeKey(fromKey)]
+	if !exists {
+		return errors.Wrapf(ErrEdgeNotFound, "failed to find edge [from = %q, to = %q]", fromKey, toKey)
+	}
+	_, err = adjacent.Lookup(toKey)
+	if errors.Is(err, ErrElementNotFound) {
+		return errors.Wrapf(ErrEdgeNotFound, "failed to find edge [from = %q, to = %q]", fromKey, toKey)
+	}
+
+	return err
+}
+
+// getWeight returns the PN-Counter of the edge weight.
+// This function also initializes the counter if needed.
+func (g Graph) getWeight(fromKey, toKey string) counter.PN {
+	fromKey, toKey = g.replica.NormalizeKey(fromKey), g.replica.NormalizeKey(toKey)
+	weights, exist := g.weights[fromKey]
+	if !exist {
+		weights = make(map[string]counter.PN)
+		g.weights[fromKey] = weights
+	}
+
+	weight, exists := weights[toKey]
+	if !exists {
+		weight = counter.NewPN(g.replica)
+		weights[toKey] = weight
+	}
+
+	return weight
+}
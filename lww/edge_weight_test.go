@@ -0,0 +1,129 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEdgeWeight(t *testing.T) {
+	v1 := Vertex{Key: "vertex1", Value: "value1"}
+	v2 := Vertex{Key: "vertex2", Value: "value2"}
+
+	newGraph := func(t *testing.T, replicaID string) Graph {
+		g := NewGraph(crdt.NewReplica(replicaID))
+		require.NoError(t, g.AddVertex(v1))
+		require.NoError(t, g.AddVertex(v2))
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		return g
+	}
+
+	t.Run("concurrent weight updates add up after replication", func(t *testing.T) {
+		// Time ->
+		// A--AddEdgeWeight(v1, v2, 3)-------------------\---|
+		// B--AddEdgeWeight(v1, v2, 5),(v1, v2, -1)-------\--|=> A,B = 7
+		A := newGraph(t, "A")
+		B := newGraph(t, "B")
+
+		require.NoError(t, A.AddEdgeWeight(v1.Key, v2.Key, 3))
+		require.NoError(t, B.AddEdgeWeight(v1.Key, v2.Key, 5))
+		require.NoError(t, B.AddEdgeWeight(v1.Key, v2.Key, -1))
+
+		replicateGraphs(A, B)
+
+		for _, g := range []Graph{A, B} {
+			weight, err := g.EdgeWeight(v1.Key, v2.Key)
+			require.NoError(t, err)
+			require.Equal(t, int64(7), weight)
+		}
+	})
+
+	t.Run("zero weight updates do not make converged states differ", func(t *testing.T) {
+		A := newGraph(t, "A")
+		B := newGraph(t, "B")
+		require.NoError(t, A.AddEdgeWeight(v1.Key, v2.Key, 2))
+		require.NoError(t, B.AddEdgeWeight(v1.Key, v2.Key, 0))
+
+		replicateGraphs(A, B)
+
+		stateA, err := A.Marshal()
+		require.NoError(t, err)
+		stateB, err := B.Marshal()
+		require.NoError(t, err)
+		require.JSONEq(t, string(stateA), string(stateB))
+	})
+
+	t.Run("weight is zero by default", func(t *testing.T) {
+		g := newGraph(t, "A")
+
+		weight, err := g.EdgeWeight(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(0), weight)
+	})
+
+	t.Run("weight is restored when the edge is re-added", func(t *testing.T) {
+		g := newGraph(t, "A")
+		require.NoError(t, g.AddEdgeWeight(v1.Key, v2.Key, 2))
+		require.NoError(t, g.RemoveEdge(v1.Key, v2.Key))
+
+		_, err := g.EdgeWeight(v1.Key, v2.Key)
+		require.ErrorIs(t, err, ErrEdgeNotFound)
+
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		weight, err := g.EdgeWeight(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), weight)
+	})
+
+	t.Run("total weight is the base weight of the edge plus the counter", func(t *testing.T) {
+		g := newGraph(t, "A")
+		require.NoError(t, g.AddWeightedEdge(v1.Key, Edge{To: v2.Key, Weight: 10}))
+		require.NoError(t, g.AddEdgeWeight(v1.Key, v2.Key, 3))
+
+		weight, err := g.EdgeWeight(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(13), weight)
+
+		require.NoError(t, g.UpdateEdgeWeight(v1.Key, v2.Key, 20))
+		weight, err = g.EdgeWeight(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(23), weight, "the counter is kept")
+
+		edge, err := g.GetEdge(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(20), edge.Weight, "the edge has the base weight")
+
+		_, distance, err := g.FindWeightedShortestPath(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, weight, distance)
+	})
+
+	t.Run("returns errors for non-existing edges and vertices", func(t *testing.T) {
+		g := newGraph(t, "A")
+
+		err := g.AddEdgeWeight(v2.Key, v1.Key, 1)
+		require.ErrorIs(t, err, ErrEdgeNotFound)
+
+		err = g.AddEdgeWeight(v1.Key, "non-existing", 1)
+		require.ErrorIs(t, err, ErrVertexNotFound)
+
+		_, err = g.EdgeWeight("non-existing", v2.Key)
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("weights survive a marshal/unmarshal round trip", func(t *testing.T) {
+		g := newGraph(t, "A")
+		require.NoError(t, g.AddEdgeWeight(v1.Key, v2.Key, 4))
+
+		data, err := g.Marshal()
+		require.NoError(t, err)
+
+		restored := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, restored.Unmarshal(data))
+
+		weight, err := restored.EdgeWeight(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(4), weight)
+	})
+}
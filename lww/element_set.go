@@ -1,10 +1,12 @@
 package lww
 
 import (
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
 )
 
 var (
@@ -34,115 +36,337 @@ type addRecord struct {
 	Element Element
 	// Timestamp is when the element was added.
 	// Standard Go `time.Time` type is used, which is quite precise but it's not a strong
-	// timestamp that can be used across nodes. Here it's used just for simplicity and exercise purposes.
-	// It could be improved using a node ID (e.g. MAC) as an additional value for being
-	// more deterministic when timestamps collide.
+	// timestamp that can be used across nodes, colliding timestamps are resolved using `Replica`.
 	Timestamp time.Time
+	// Replica is the ID of the replica that added the element
+	Replica string
+	// Observed maps a replica ID to the timestamp of the latest addition of the key by the replica
+	// the writer had seen, it's recorded only with `crdt.Replica.MultiValue`
+	Observed map[string]time.Time
+}
+
+// removeRecord contains the timestamp when an element was removed and who removed it.
+type removeRecord struct {
+	// Timestamp is when the element was removed
+	Timestamp time.Time
+	// Replica is the ID of the replica that removed the element
+	Replica string
+}
+
+// newer returns `true` if the operation at `t` by `replica` wins over the operation at `other` by `otherReplica`.
+// The later timestamp wins, the greater replica ID wins when timestamps collide,
+// so all the replicas pick the same operation regardless of the merge order.
+func newer(t time.Time, replica string, other time.Time, otherReplica string) bool {
+	if t.Equal(other) {
+		return replica > otherReplica
+	}
+	return t.After(other)
+}
+
+// sameOp returns `true` if both timestamps and replicas identify the same operation
+func sameOp(t time.Time, replica string, other time.Time, otherReplica string) bool {
+	return t.Equal(other) && replica == otherReplica
 }
 
 // NewSet initializes the Last-Writer-Wins state-based element set and makes it ready for use.
-func NewSet() Set {
+// The set can unmarshal only `IDElement` elements, use `NewSetWithDecoder` for other element types.
+// `r` defines the clock used for timestamping operations and the bias for resolving colliding timestamps.
+func NewSet(r crdt.Replica) Set {
+	return NewSetWithDecoder(r, DecodeIDElement)
+}
+
+// NewSetWithDecoder initializes the Last-Writer-Wins state-based element set and makes it ready for use.
+// `decode` is used for deserializing elements in `Unmarshal`.
+func NewSetWithDecoder(r crdt.Replica, decode ElementDecoder) Set {
 	return Set{
-		mutex:     &sync.Mutex{},
+		mutex:     &sync.RWMutex{},
+		replica:   r.WithDefaults(),
+		decode:    decode,
+		mutation:  setMutation,
 		additions: make(map[string]addRecord),
-		removals:  make(map[string]time.Time),
+		removals:  make(map[string]removeRecord),
+		siblings:  make(map[string][]addRecord),
 	}
 }
 
 // Set is a Last-Writer-Wins state-based element set implementation.
 // Use `NewSet` in order to initialize it before use.
-// The set is thread-safe and can be used from several go routines.
+// The set is thread-safe and can be used from several go routines,
+// reads share the lock and run concurrently, only writes and merges take it exclusively.
 type Set struct {
 	// mutex is used for the thread-safety
-	mutex *sync.Mutex
+	mutex *sync.RWMutex
+
+	// replica is the identity and the policies of the replica the set belongs to
+	replica crdt.Replica
+	// decode is used for deserializing elements
+	decode ElementDecoder
+
+	// mutation returns the mutation of the given key with the fields identifying the element,
+	// it's reported to the replica observer
+	mutation func(key string) crdt.Mutation
 
 	// additions is a set of all known additions to the set
 	additions map[string]addRecord
 	// removals is a set of all known removals from the set
-	removals map[string]time.Time
+	removals map[string]removeRecord
+	// siblings maps a key to the additions concurrent with the one in `additions`,
+	// it's used only with `crdt.Replica.MultiValue`
+	siblings map[string][]addRecord
 }
 
 // Add adds the given element to the set.
 // It replaces an existing element if the element key collides.
 func (s Set) Add(e Element) {
+	s.checkUsage()
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	key, e := s.normalize(e)
+
 	// log the addition operation with the current timestamp
-	s.additions[e.GetKey()] = addRecord{
-		Element:   e,
-		Timestamp: time.Now(),
-	}
+	s.additions[key] = s.write(key, e)
+	s.observeAddition(key, crdt.SourceLocal)
+	s.replica.Metrics.Count("lww.set.add", 1)
 }
 
 // Remove removes an element with the given key from the set.
 // This operation succeeds even if the element does not exist in the set.
 func (s Set) Remove(key string) {
+	s.checkUsage()
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	// log the removal operation with the current timestamp
-	s.removals[key] = time.Now()
+	key = s.replica.NormalizeKey(key)
+	s.removals[key] = removeRecord{
+		Timestamp: s.replica.Clock.Now(),
+		Replica:   s.replica.ID,
+	}
+	s.observeRemoval(key, crdt.SourceLocal)
+	s.replica.Metrics.Count("lww.set.remove", 1)
 }
 
 // Merge takes another LWW Element Set as a `remote` and merges its state into itself.
-// Merging two replicas takes the union of their add-sets and remove-sets.
+// Merging two replicas takes the union of their add-sets and remove-sets,
+// operations with colliding timestamps are resolved in favor of the greater replica ID.
+// Live records of the same key are combined if their elements implement `MergeableElement`.
+// Every overwritten local operation is recorded in the replica journal.
 func (s Set) Merge(remote Set) {
+	// merging without cancellation cannot fail
+	_ = s.merge(remote, setConflict, chunkedMergeTracker(s.replica), nil, nil)
+}
+
+// setConflict returns the conflict of the set element with the given key
+func setConflict(key string) crdt.Conflict {
+	return crdt.Conflict{Kind: SetKind, Key: key}
+}
+
+// setMutation returns the mutation of the set element with the given key
+func setMutation(key string) crdt.Mutation {
+	return crdt.Mutation{Kind: SetKind, Key: key}
+}
+
+// observeAddition reports the current addition of the key to the replica observer, must be called under the lock
+func (s Set) observeAddition(key string, source crdt.Source) {
+	m := s.mutation(key)
+	m.Replica, m.Timestamp, m.Source = s.additions[key].Replica, s.additions[key].Timestamp, source
+	s.replica.Observer.Observe(m)
+}
+
+// observeRemoval reports the current removal of the key to the replica observer, must be called under the lock
+func (s Set) observeRemoval(key string, source crdt.Source) {
+	m := s.mutation(key)
+	m.Removal = true
+	m.Replica, m.Timestamp, m.Source = s.removals[key].Replica, s.removals[key].Timestamp, source
+	s.replica.Observer.Observe(m)
+}
+
+// merge merges the `remote` state recording every overwritten local operation in the replica journal,
+// `conflict` returns the conflict of the given key with the fields identifying the element.
+// Every processed record is reported to `tracker` which can be `nil`,
+// the merge stops with the tracker error leaving the records processed so far merged.
+// The merge is counted in `summary`, if it's `nil` the summary of this merge alone is logged (see `crdt.MergeLogger`).
+// Every last-writer-wins decision is added to `report` which can be `nil`.
+func (s Set) merge(
+	remote Set,
+	conflict func(key string) crdt.Conflict,
+	tracker *mergeTracker,
+	summary *crdt.MergeSummary,
+	report *MergeReport,
+) (err error) {
+	s.checkMerge(remote)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	tracker.hold(s.mutex)
+	defer tracker.release()
+
+	started := time.Now()
+	if summary == nil {
+		summary = &crdt.MergeSummary{Kind: SetKind, Replica: s.replica.ID}
+		defer func() {
+			summary.Duration, summary.Err = time.Since(started), err
+			crdt.LogMerge(s.replica.Logger, *summary)
+		}()
+	}
+
+	var mergedAt time.Time
+	// record records the last-writer-wins decision, only the overwritten local operations are journaled
+	record := func(key string, winner, loser crdt.ConflictOp, remoteWon bool) {
+		if mergedAt.IsZero() {
+			mergedAt = s.replica.Clock.Now()
+		}
+		c := conflict(key)
+		c.Winner = winner
+		c.Loser = loser
+		c.MergedAt = mergedAt
+		if remoteWon {
+			summary.RemoteWins++
+			s.replica.Journal.Record(c)
+		} else {
+			summary.LocalWins++
+		}
+		crdt.LogConflict(s.replica.Logger, c, remoteWon)
+		report.add(c, remoteWon)
+	}
 
 	// computing the union of add-sets
-	for key, remoteRecord := range remote.additions {
+	for remoteKey, remoteRecord := range remote.additions {
+		if err := tracker.step(); err != nil {
+			return err
+		}
+		summary.Records++
+
+		key, element := s.normalize(remoteRecord.Element)
+		remoteRecord.Element = element
+
 		localRecord, added := s.additions[key]
-		if !added || remoteRecord.Timestamp.After(localRecord.Timestamp) {
+		if added {
+			// composite elements merge instead of overwriting each other, regardless of removals,
+			// so the merged record depends only on the additions and not on the merge order
+			merged, isMerged := mergeElements(localRecord, remoteRecord)
+			if isMerged {
+				_, merged.Element = s.normalize(merged.Element)
+				s.additions[key] = merged
+				s.observeAddition(key, crdt.SourceMerge)
+				summary.Applied++
+				continue
+			}
+		}
+
+		switch {
+		case !added:
 			s.additions[key] = remoteRecord
+			s.observeAddition(key, crdt.SourceMerge)
+			summary.Applied++
+		case newer(remoteRecord.Timestamp, remoteRecord.Replica, localRecord.Timestamp, localRecord.Replica):
+			s.additions[key] = remoteRecord
+			s.observeAddition(key, crdt.SourceMerge)
+			summary.Applied++
+			record(key,
+				crdt.ConflictOp{Replica: remoteRecord.Replica, Timestamp: remoteRecord.Timestamp},
+				crdt.ConflictOp{Replica: localRecord.Replica, Timestamp: localRecord.Timestamp},
+				true,
+			)
+		case !sameOp(remoteRecord.Timestamp, remoteRecord.Replica, localRecord.Timestamp, localRecord.Replica):
+			record(key,
+				crdt.ConflictOp{Replica: localRecord.Replica, Timestamp: localRecord.Timestamp},
+				crdt.ConflictOp{Replica: remoteRecord.Replica, Timestamp: remoteRecord.Timestamp},
+				false,
+			)
+		}
+
+		if s.replica.MultiValue {
+			candidates := append([]addRecord{remoteRecord}, remote.siblings[remoteKey]...)
+			if added {
+				candidates = append(candidates, localRecord)
+			}
+			s.mergeSiblings(key, candidates)
 		}
 	}
 
 	// computing the union of remove-sets
-	for key, remoteRemovedAt := range remote.removals {
-		localRemovedAt, removed := s.removals[key]
-		if !removed || remoteRemovedAt.After(localRemovedAt) {
-			s.removals[key] = remoteRemovedAt
+	for key, remoteRecord := range remote.removals {
+		if err := tracker.step(); err != nil {
+			return err
+		}
+		summary.Records++
+
+		key = s.replica.NormalizeKey(key)
+		localRecord, removed := s.removals[key]
+		switch {
+		case !removed:
+			s.removals[key] = remoteRecord
+			s.observeRemoval(key, crdt.SourceMerge)
+			summary.Applied++
+		case newer(remoteRecord.Timestamp, remoteRecord.Replica, localRecord.Timestamp, localRecord.Replica):
+			s.removals[key] = remoteRecord
+			s.observeRemoval(key, crdt.SourceMerge)
+			summary.Applied++
+			record(key,
+				crdt.ConflictOp{Replica: remoteRecord.Replica, Timestamp: remoteRecord.Timestamp, Removal: true},
+				crdt.ConflictOp{Replica: localRecord.Replica, Timestamp: localRecord.Timestamp, Removal: true},
+				true,
+			)
+		case !sameOp(remoteRecord.Timestamp, remoteRecord.Replica, localRecord.Timestamp, localRecord.Replica):
+			record(key,
+				crdt.ConflictOp{Replica: localRecord.Replica, Timestamp: localRecord.Timestamp, Removal: true},
+				crdt.ConflictOp{Replica: remoteRecord.Replica, Timestamp: remoteRecord.Timestamp, Removal: true},
+				false,
+			)
 		}
 	}
+
+	s.replica.Metrics.Count("lww.set.merge", 1)
+	crdt.ObserveDuration(s.replica.Metrics, "lww.set.merge.duration", time.Since(started))
+	return nil
 }
 
 // Lookup checks if an element with the given key exists in the set.
 // Returns the found element and no error if the element exists.
 // Returns nil and `ErrNotFound` if it does not exist.
 func (s Set) Lookup(key string) (Element, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	s.checkUsage()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
 	// Each `Element` is in the set if its `key` is in `additions`,
 	// and it is not in `removals` with a higher timestamp.
 
+	key = s.replica.NormalizeKey(key)
 	addRecord, added := s.additions[key]
 	if !added {
 		return nil, ErrElementNotFound
 	}
 
-	if s.removed(addRecord) {
+	if s.removed(key, addRecord) {
 		return nil, ErrElementNotFound
 	}
 
 	return addRecord.Element, nil
 }
 
-// List returns a list of the actual elements of the set.
-// Because of the internally used map the result order is not deterministic.
+// List returns a list of the actual elements of the set in the order of `crdt.Replica.Order`.
+// By default the order is not deterministic because of the internally used map.
 func (s Set) List() (list []Element) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	s.checkUsage()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
 	// it's always at list an empty list, not nil
 	list = []Element{}
 
+	if s.replica.Order != crdt.OrderNone {
+		for _, key := range s.orderedKeys() {
+			list = append(list, s.additions[key].Element)
+		}
+		return list
+	}
+
 	// Each `Element` is in the set if its `key` is in `additions`,
 	// and it is not in `removals` with a higher timestamp.
-	for _, record := range s.additions {
-		if s.removed(record) {
+	for key, record := range s.additions {
+		if s.removed(key, record) {
 			continue
 		}
 
@@ -152,8 +376,69 @@ func (s Set) List() (list []Element) {
 	return list
 }
 
-// removed returns `true` if the given record is marked as removed
-func (s Set) removed(record addRecord) bool {
-	removedAt, removed := s.removals[record.Element.GetKey()]
-	return removed && removedAt.After(record.Timestamp)
+// orderedKeys returns the keys of the actual elements of the set in the order of `crdt.Replica.Order`,
+// must be called under the lock.
+func (s Set) orderedKeys() []string {
+	keys := make([]string, 0, len(s.additions))
+	for key, record := range s.additions {
+		if s.removed(key, record) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	switch s.replica.Order {
+	case crdt.OrderSorted:
+		sort.Strings(keys)
+	case crdt.OrderInsertion:
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := s.additions[keys[i]], s.additions[keys[j]]
+			if !a.Timestamp.Equal(b.Timestamp) || a.Replica != b.Replica {
+				return !newer(a.Timestamp, a.Replica, b.Timestamp, b.Replica)
+			}
+			return keys[i] < keys[j]
+		})
+	}
+	return keys
+}
+
+// removed returns `true` if the given record with the given key is marked as removed.
+// When the removal and the addition have the same timestamp, the replica bias decides.
+func (s Set) removed(key string, record addRecord) bool {
+	removal, removed := s.removals[key]
+	if !removed {
+		return false
+	}
+	if s.replica.Bias == crdt.BiasRemove {
+		return !removal.Timestamp.Before(record.Timestamp)
+	}
+	return removal.Timestamp.After(record.Timestamp)
+}
+
+// normalize returns the canonical key of the element using the replica key normalizer.
+// The key of the element itself is replaced too if it's one of the elements of this package.
+func (s Set) normalize(e Element) (string, Element) {
+	key := s.replica.NormalizeKey(e.GetKey())
+	if key == e.GetKey() {
+		return key, e
+	}
+
+	switch element := e.(type) {
+	case Vertex:
+		element.Key = key
+		return key, element
+	case compressedVertex:
+		element.key = key
+		return key, element
+	case evictedVertex:
+		element.key = key
+		return key, element
+	case IDElement:
+		return key, IDElement(key)
+	case Edge:
+		element.To = key
+		return key, element
+	default:
+		return key, e
+	}
 }
@@ -2,7 +2,10 @@ package lww
 
 import (
 	"testing"
+	"time"
 
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -22,9 +25,9 @@ func TestSet(t *testing.T) {
 				// B------Add(e2)----------------\--|=> A,B,C = {e1,e2,e3}
 				// C-----------Add(e1), Add(e3)---\-|
 
-				A := NewSet()
-				B := NewSet()
-				C := NewSet()
+				A := NewSet(testReplica)
+				B := NewSet(testReplica)
+				C := NewSet(testReplica)
 
 				A.Add(e1)
 
@@ -57,8 +60,8 @@ func TestSet(t *testing.T) {
 				// A--Add(e1)---------Remove(e1)--\---|
 				// B----------Add(e1)--------------\--|=> A,B = {}
 
-				A := NewSet()
-				B := NewSet()
+				A := NewSet(testReplica)
+				B := NewSet(testReplica)
 
 				A.Add(e1)
 				B.Add(e1)
@@ -89,8 +92,8 @@ func TestSet(t *testing.T) {
 				// A--Add(e1)--Remove(e1)---\---|
 				// B---------------Add(e1)---\--|=> A,B = {e1}
 
-				A := NewSet()
-				B := NewSet()
+				A := NewSet(testReplica)
+				B := NewSet(testReplica)
 
 				A.Add(e1)
 				A.Remove(e1.GetKey())
@@ -119,7 +122,7 @@ func TestSet(t *testing.T) {
 
 		t.Run("Add/Lookup", func(t *testing.T) {
 			t.Run("added element can be retrieved", func(t *testing.T) {
-				s := NewSet()
+				s := NewSet(testReplica)
 				s.Add(element)
 
 				retreived, err := s.Lookup(key)
@@ -128,7 +131,7 @@ func TestSet(t *testing.T) {
 			})
 
 			t.Run("adding the same element twice does not panic", func(t *testing.T) {
-				s := NewSet()
+				s := NewSet(testReplica)
 
 				require.NotPanics(t, func() {
 					s.Add(element)
@@ -137,7 +140,7 @@ func TestSet(t *testing.T) {
 			})
 
 			t.Run("retrieving a non-existing element returns ErrElementNotFound", func(t *testing.T) {
-				s := NewSet()
+				s := NewSet(testReplica)
 
 				element, err := s.Lookup("non-existing")
 				require.ErrorIs(t, err, ErrElementNotFound)
@@ -147,7 +150,7 @@ func TestSet(t *testing.T) {
 
 		t.Run("Remove", func(t *testing.T) {
 			t.Run("removes an existing element", func(t *testing.T) {
-				s := NewSet()
+				s := NewSet(testReplica)
 				s.Add(element)
 				s.Remove(key)
 
@@ -157,11 +160,73 @@ func TestSet(t *testing.T) {
 			})
 
 			t.Run("does not panic for non-existing element", func(t *testing.T) {
-				s := NewSet()
+				s := NewSet(testReplica)
 				require.NotPanics(t, func() {
 					s.Remove("non-existing")
 				})
 			})
 		})
+
+		t.Run("Bias", func(t *testing.T) {
+			now := time.Now()
+			fixed := clock.Func(func() time.Time { return now })
+
+			t.Run("addition wins over removal with the same timestamp by default", func(t *testing.T) {
+				s := NewSet(crdt.Replica{Clock: fixed})
+				s.Add(element)
+				s.Remove(key)
+
+				found, err := s.Lookup(key)
+				require.NoError(t, err)
+				require.Equal(t, element, found)
+			})
+
+			t.Run("removal wins over addition with the same timestamp with BiasRemove", func(t *testing.T) {
+				s := NewSet(crdt.Replica{Clock: fixed, Bias: crdt.BiasRemove})
+				s.Add(element)
+				s.Remove(key)
+
+				_, err := s.Lookup(key)
+				require.ErrorIs(t, err, ErrElementNotFound)
+			})
+		})
+
+		t.Run("Order", func(t *testing.T) {
+			tick := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+			ticking := clock.Func(func() time.Time {
+				tick = tick.Add(time.Millisecond)
+				return tick
+			})
+			keys := func(list []Element) (keys []string) {
+				for _, e := range list {
+					keys = append(keys, e.GetKey())
+				}
+				return keys
+			}
+
+			t.Run("lists elements sorted by key with OrderSorted", func(t *testing.T) {
+				s := NewSet(crdt.Replica{Clock: ticking, Order: crdt.OrderSorted})
+				for _, key := range []string{"c", "a", "d", "b"} {
+					s.Add(IDElement(key))
+				}
+				s.Remove("d")
+				require.Equal(t, []string{"a", "b", "c"}, keys(s.List()))
+			})
+
+			t.Run("lists elements in order of the last addition with OrderInsertion", func(t *testing.T) {
+				a := NewSet(crdt.Replica{ID: "A", Clock: ticking, Order: crdt.OrderInsertion})
+				b := NewSet(crdt.Replica{ID: "B", Clock: ticking, Order: crdt.OrderInsertion})
+				for _, key := range []string{"c", "a", "b"} {
+					a.Add(IDElement(key))
+				}
+				b.Add(IDElement("d"))
+				a.Add(IDElement("c"))
+				a.Merge(b)
+				b.Merge(a)
+
+				require.Equal(t, []string{"a", "b", "d", "c"}, keys(a.List()))
+				require.Equal(t, keys(a.List()), keys(b.List()), "replicas with the same state list the same order")
+			})
+		})
 	})
 }
@@ -0,0 +1,155 @@
+package lww
+
+import (
+	"reflect"
+)
+
+// Equals returns `true` if both sets have the same elements, the removed elements and the timestamps are ignored.
+// Use `StateEquals` for comparing the whole state including the removals.
+func (s Set) Equals(other Set) bool {
+	mine, theirs := s.elements(), other.elements()
+	if len(mine) != len(theirs) {
+		return false
+	}
+	for key, element := range mine {
+		otherElement, exists := theirs[key]
+		if !exists || !reflect.DeepEqual(element, otherElement) {
+			return false
+		}
+	}
+	return true
+}
+
+// StateEquals returns `true` if both sets have the same records including the removed elements and the timestamps,
+// so merging any of them into the other one changes nothing. It compares the Merkle tree roots (see `Digest`).
+func (s Set) StateEquals(other Set) (bool, error) {
+	return digestsEqual(s.Digest, other.Digest)
+}
+
+// Equals returns `true` if both graphs have the same vertices with the same values, the same edges
+// of these vertices (including the edges to removed vertices like `List` has) and the same edge weights.
+// The removed vertices, edges and the timestamps are ignored, use `StateEquals` for comparing them too.
+//
+// It's a cheaper convergence check than comparing sorted results of `List`.
+func (g Graph) Equals(other Graph) (bool, error) {
+	mine, err := g.view()
+	if err != nil {
+		return false, err
+	}
+	theirs, err := other.view()
+	if err != nil {
+		return false, err
+	}
+	return mine.equal(theirs), nil
+}
+
+// StateEquals returns `true` if both graphs have the same records including the removed vertices and edges
+// and the timestamps, so merging any of them into the other one changes nothing.
+// It compares the Merkle tree roots (see `Digest`).
+func (g Graph) StateEquals(other Graph) (bool, error) {
+	return digestsEqual(g.Digest, other.Digest)
+}
+
+// digestsEqual returns `true` if the roots of both Merkle trees are equal
+func digestsEqual(digest, otherDigest func() (MerkleTree, error)) (bool, error) {
+	tree, err := digest()
+	if err != nil {
+		return false, err
+	}
+	otherTree, err := otherDigest()
+	if err != nil {
+		return false, err
+	}
+	return tree.Root() == otherTree.Root(), nil
+}
+
+// elements returns the actual elements of the set by key
+func (s Set) elements() map[string]Element {
+	s.checkUsage()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	elements := make(map[string]Element, len(s.additions))
+	for key, record := range s.additions {
+		if s.removed(key, record) {
+			continue
+		}
+		elements[key] = record.Element
+	}
+	return elements
+}
+
+// graphView is the observable state of a graph
+type graphView struct {
+	// vertices maps the key of a vertex to its value
+	vertices map[string]string
+	// edges maps the key of a vertex to the edges it has
+	edges map[string]map[string]Edge
+	// weights maps the keys of the vertices an edge connects to the non-zero weight of the edge
+	weights map[string]map[string]int64
+}
+
+// view returns the observable state of the graph
+func (g Graph) view() (graphView, error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	elements := g.vertices.elements()
+	v := graphView{
+		vertices: make(map[string]string, len(elements)),
+		edges:    make(map[string]map[string]Edge),
+		weights:  make(map[string]map[string]int64),
+	}
+	for key := range elements {
+		vertex, err := g.Lookup(key)
+		if err != nil {
+			return graphView{}, err
+		}
+		v.vertices[key] = vertex.Value
+
+		adjacent := g.listAdjacent(key)
+		if len(adjacent) == 0 {
+			continue
+		}
+		v.edges[key] = make(map[string]Edge, len(adjacent))
+		for _, element := range adjacent {
+			edge := toEdge(element)
+			v.edges[key][edge.To] = edge
+			if weight, exists := g.weights[key][edge.To]; exists && weight.Value() != 0 {
+				if v.weights[key] == nil {
+					v.weights[key] = make(map[string]int64)
+				}
+				v.weights[key][edge.To] = weight.Value()
+			}
+		}
+	}
+	return v, nil
+}
+
+// equal returns `true` if both views are the same
+func (v graphView) equal(other graphView) bool {
+	if len(v.vertices) != len(other.vertices) || len(v.edges) != len(other.edges) ||
+		!reflect.DeepEqual(v.weights, other.weights) {
+		return false
+	}
+	for key, value := range v.vertices {
+		otherValue, exists := other.vertices[key]
+		if !exists || otherValue != value {
+			return false
+		}
+	}
+	for fromKey, edges := range v.edges {
+		otherEdges := other.edges[fromKey]
+		if len(edges) != len(otherEdges) {
+			return false
+		}
+		for toKey, edge := range edges {
+			otherEdge, exists := otherEdges[toKey]
+			if !exists || !edge.equal(otherEdge) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEquals(t *testing.T) {
+	t.Run("compares the elements of sets", func(t *testing.T) {
+		a := NewSet(crdt.NewReplica("A"))
+		b := NewSet(crdt.NewReplica("B"))
+		a.Add(IDElement("1"))
+		b.Add(IDElement("1"))
+		b.Add(IDElement("2"))
+		require.False(t, a.Equals(b))
+
+		b.Remove("2")
+		require.True(t, a.Equals(b))
+		equal, err := a.StateEquals(b)
+		require.NoError(t, err)
+		require.False(t, equal, "the records have different timestamps")
+
+		a.Merge(b)
+		b.Merge(a)
+		equal, err = a.StateEquals(b)
+		require.NoError(t, err)
+		require.True(t, equal)
+	})
+
+	t.Run("compares the vertices, edges and weights of graphs", func(t *testing.T) {
+		a := NewGraph(crdt.NewReplica("A"))
+		b := NewGraph(crdt.Replica{ID: "B", Compression: crdt.Compression{Threshold: 1}})
+		for _, g := range []Graph{a, b} {
+			require.NoError(t, g.AddVertex(Vertex{Key: "v1", Value: "value"}))
+			require.NoError(t, g.AddVertex(Vertex{Key: "v2"}))
+			require.NoError(t, g.AddEdge("v1", "v2"))
+		}
+		requireEquals(t, true, a, b)
+
+		require.NoError(t, b.AddEdgeWeight("v1", "v2", 1))
+		requireEquals(t, false, a, b)
+		require.NoError(t, b.AddEdgeWeight("v1", "v2", -1))
+		requireEquals(t, true, a, b)
+
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "v1", Value: "changed"}))
+		requireEquals(t, false, a, b)
+		a.Merge(b)
+		requireEquals(t, true, a, b)
+
+		require.NoError(t, b.AddWeightedEdge("v1", Edge{To: "v2", Label: "label"}))
+		requireEquals(t, false, a, b)
+		a.Merge(b)
+		requireEquals(t, true, a, b)
+
+		// the edges to removed vertices are still observable
+		require.NoError(t, a.RemoveVertex("v2"))
+		require.NoError(t, b.RemoveVertex("v2"))
+		requireEquals(t, true, a, b)
+		require.NoError(t, b.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, b.RemoveEdge("v1", "v2"))
+		require.NoError(t, b.RemoveVertex("v2"))
+		requireEquals(t, false, a, b)
+
+		equal, err := a.StateEquals(b)
+		require.NoError(t, err)
+		require.False(t, equal)
+		a.Merge(b)
+		b.Merge(a)
+		equal, err = a.StateEquals(b)
+		require.NoError(t, err)
+		require.True(t, equal)
+	})
+
+	t.Run("zero weight updates do not make graph states differ", func(t *testing.T) {
+		a := NewGraph(crdt.NewReplica("A"))
+		b := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1"}))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, a.AddEdge("v1", "v2"))
+		b.Merge(a)
+
+		require.NoError(t, b.AddEdgeWeight("v1", "v2", 0))
+		a.Merge(b)
+		b.Merge(a)
+
+		equal, err := a.StateEquals(b)
+		require.NoError(t, err)
+		require.True(t, equal)
+		equal, err = b.StateEquals(a)
+		require.NoError(t, err)
+		require.True(t, equal)
+	})
+}
+
+// requireEquals asserts the result of comparing the graphs in both directions
+func requireEquals(t *testing.T, expected bool, a, b Graph) {
+	t.Helper()
+	equal, err := a.Equals(b)
+	require.NoError(t, err)
+	require.Equal(t, expected, equal)
+	equal, err = b.Equals(a)
+	require.NoError(t, err)
+	require.Equal(t, expected, equal)
+}
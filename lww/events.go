@@ -0,0 +1,302 @@
+package lww
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rdner/crdt"
+)
+
+// ChangeType is the type of a graph change
+type ChangeType int
+
+const (
+	// VertexAdded means a vertex appeared in the graph
+	VertexAdded ChangeType = iota + 1
+	// VertexUpdated means the value of an existing vertex changed
+	VertexUpdated
+	// VertexRemoved means a vertex disappeared from the graph
+	VertexRemoved
+	// EdgeAdded means an edge appeared in the graph
+	EdgeAdded
+	// EdgeUpdated means the weight, the label or the attributes of an existing edge changed
+	EdgeUpdated
+	// EdgeRemoved means an edge disappeared from the graph
+	EdgeRemoved
+	// ValidationRejected means a vertex value from another replica was rejected by the replica validator
+	// and quarantined (see `Graph.Quarantined`), the graph state did not change
+	ValidationRejected
+)
+
+// String returns the name of the change type
+func (t ChangeType) String() string {
+	switch t {
+	case VertexAdded:
+		return "VertexAdded"
+	case VertexUpdated:
+		return "VertexUpdated"
+	case VertexRemoved:
+		return "VertexRemoved"
+	case EdgeAdded:
+		return "EdgeAdded"
+	case EdgeUpdated:
+		return "EdgeUpdated"
+	case EdgeRemoved:
+		return "EdgeRemoved"
+	case ValidationRejected:
+		return "ValidationRejected"
+	default:
+		return "Unknown"
+	}
+}
+
+// edge returns `true` if the change type is a change of an edge
+func (t ChangeType) edge() bool {
+	return t == EdgeAdded || t == EdgeUpdated || t == EdgeRemoved
+}
+
+// GraphEvent describes a change of the graph state, see `Graph.Subscribe`
+type GraphEvent struct {
+	// Type is the type of the change
+	Type ChangeType
+	// Vertex is the vertex after the change, the removed vertex for `VertexRemoved`,
+	// the rejected vertex for `ValidationRejected`. It's empty for edge changes.
+	Vertex Vertex
+	// From is the key of the vertex the edge starts from, empty for vertex changes
+	From string
+	// Edge is the edge after the change, the removed edge for `EdgeRemoved`. It's empty for vertex changes.
+	Edge Edge
+	// Origin is the ID of the replica that made the change
+	Origin string
+	// Timestamp is when the change was made by the origin replica
+	Timestamp time.Time
+	// Merged is `true` if the change came from another replica state (e.g. `Merge`),
+	// `false` if it was made by a local operation
+	Merged bool
+	// Reason is why the value was rejected, it's set only for `ValidationRejected`
+	Reason string
+}
+
+// EventKey implements the `crdt.Event` interface, it's the vertex key, `<from>-><to>` for edges
+// or `rejected:<key>` for `ValidationRejected`, so coalescing events per key never replaces
+// a change of the state with a rejection
+func (e GraphEvent) EventKey() string {
+	switch {
+	case e.Type.edge():
+		return e.From + "->" + e.Edge.To
+	case e.Type == ValidationRejected:
+		return "rejected:" + e.Vertex.Key
+	default:
+		return e.Vertex.Key
+	}
+}
+
+// Subscribe creates a subscription receiving a `GraphEvent` for every change of the graph state
+// made after this call, both by local operations and by merging the state of other replicas,
+// so applications can react to replication instead of polling `List`.
+//
+// Only the visible changes are published: an operation or a merge that loses to a newer write does not
+// produce any events. Removing a vertex produces only `VertexRemoved`, the edges of the vertex
+// are hidden without events. Changes of `AddEdgeWeight` counters and restoring the state
+// with `Unmarshal` are not published.
+//
+// Every vertex value of another replica rejected by the replica validator (see `crdt.Replica.Validator`)
+// produces `ValidationRejected` with the key, the reason and the origin replica after the changes of the merge,
+// so monitoring catches schema drift between application versions.
+//
+// Events are delivered in the order of the changes without blocking the writers, see `crdt.Feed`
+// for how a slow subscriber is handled. Close the subscription when it's no longer needed.
+func (g Graph) Subscribe(cfg crdt.SubscriptionConfig) crdt.Subscription {
+	g.checkUsage()
+	return g.feed.Subscribe(cfg)
+}
+
+// changes records the state of the keys a write or a merge touches in order to publish the events after it.
+// All its methods can be called on nil which means there are no subscribers to notify.
+type changes struct {
+	// graph is the changed graph
+	graph Graph
+	// merged is `true` if the changes come from the state of another replica
+	merged bool
+	// vertices maps a normalized vertex key to the vertex before the change, nil if it did not exist
+	vertices map[string]*Vertex
+	// edges maps normalized keys of the vertices an edge connects to the edge before the change,
+	// nil if it did not exist
+	edges map[string]map[string]*Edge
+	// rejected contains the `ValidationRejected` events of the vertices rejected by the replica validator
+	rejected []GraphEvent
+}
+
+// trackChanges starts tracking the changes of the graph, returns nil if there are no subscribers.
+// Must be called under the write lock.
+func (g Graph) trackChanges(merged bool) *changes {
+	if g.feed.Subscribers() == 0 {
+		return nil
+	}
+	return &changes{
+		graph:    g,
+		merged:   merged,
+		vertices: make(map[string]*Vertex),
+		edges:    make(map[string]map[string]*Edge),
+	}
+}
+
+// vertex records the state of the vertex with the given key before it's changed
+func (c *changes) vertex(key string) {
+	if c == nil {
+		return
+	}
+	key = c.graph.replica.NormalizeKey(key)
+	if _, isTracked := c.vertices[key]; isTracked {
+		return
+	}
+	c.vertices[key] = c.currentVertex(key)
+}
+
+// edge records the state of the edge between the vertices with the given keys before it's changed
+func (c *changes) edge(fromKey, toKey string) {
+	if c == nil {
+		return
+	}
+	fromKey, toKey = c.graph.replica.NormalizeKey(fromKey), c.graph.replica.NormalizeKey(toKey)
+	if c.edges[fromKey] == nil {
+		c.edges[fromKey] = make(map[string]*Edge)
+	}
+	if _, isTracked := c.edges[fromKey][toKey]; isTracked {
+		return
+	}
+	c.edges[fromKey][toKey] = c.currentEdge(fromKey, toKey)
+}
+
+// reject records the vertex addition from another replica rejected by the replica validator
+func (c *changes) reject(vertex Vertex, record addRecord, reason string) {
+	if c == nil {
+		return
+	}
+	c.rejected = append(c.rejected, GraphEvent{
+		Type:      ValidationRejected,
+		Vertex:    vertex,
+		Origin:    record.Replica,
+		Timestamp: record.Timestamp,
+		Merged:    true,
+		Reason:    reason,
+	})
+}
+
+// merge records the states of all the vertices and edges the `remote` graph has records of
+func (c *changes) merge(remote Graph) {
+	if c == nil {
+		return
+	}
+	for key := range remote.vertices.records("") {
+		c.vertex(key)
+	}
+	for fromKey, remoteAdjacent := range remote.edges {
+		for toKey := range remoteAdjacent.records("") {
+			c.edge(fromKey, toKey)
+		}
+	}
+}
+
+// publish compares the recorded states with the current ones and publishes an event for every change
+// in the key order, vertices first, rejections last
+func (c *changes) publish() {
+	if c == nil {
+		return
+	}
+	for _, e := range c.events() {
+		c.graph.feed.Publish(e)
+	}
+}
+
+// events compares the recorded states with the current ones and returns an event for every change
+// in the key order, vertices first, rejections last
+func (c *changes) events() []GraphEvent {
+	g := c.graph
+	events := []GraphEvent{}
+
+	keys := make([]string, 0, len(c.vertices))
+	for key := range c.vertices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		before, after := c.vertices[key], c.currentVertex(key)
+		e := GraphEvent{Merged: c.merged}
+		switch {
+		case before == nil && after != nil:
+			e.Type, e.Vertex = VertexAdded, *after
+		case before != nil && after == nil:
+			e.Type, e.Vertex = VertexRemoved, *before
+		case before != nil && after != nil && before.Value != after.Value:
+			e.Type, e.Vertex = VertexUpdated, *after
+		default:
+			continue
+		}
+		write, _ := g.vertices.LastWrite(key)
+		e.Origin, e.Timestamp = write.Replica, write.Timestamp
+		events = append(events, e)
+	}
+
+	edges := make([][2]string, 0, len(c.edges))
+	for fromKey, tracked := range c.edges {
+		for toKey := range tracked {
+			edges = append(edges, [2]string{fromKey, toKey})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+
+	for _, edge := range edges {
+		fromKey, toKey := edge[0], edge[1]
+		before, after := c.edges[fromKey][toKey], c.currentEdge(fromKey, toKey)
+		e := GraphEvent{From: fromKey, Merged: c.merged}
+		switch {
+		case before == nil && after != nil:
+			e.Type, e.Edge = EdgeAdded, *after
+		case before != nil && after == nil:
+			e.Type, e.Edge = EdgeRemoved, *before
+		case before != nil && after != nil && !before.equal(*after):
+			e.Type, e.Edge = EdgeUpdated, *after
+		default:
+			continue
+		}
+		write, _ := g.edges[fromKey].LastWrite(toKey)
+		e.Origin, e.Timestamp = write.Replica, write.Timestamp
+		events = append(events, e)
+	}
+
+	sort.SliceStable(c.rejected, func(i, j int) bool {
+		return c.rejected[i].Vertex.Key < c.rejected[j].Vertex.Key
+	})
+	return append(events, c.rejected...)
+}
+
+// currentVertex returns the current vertex with the given key, nil if it does not exist
+func (c *changes) currentVertex(key string) *Vertex {
+	v, err := c.graph.Lookup(key)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// currentEdge returns the current edge between the vertices with the given keys, nil if it does not exist.
+// Unlike `Graph.GetEdge` it does not check if the vertices exist.
+func (c *changes) currentEdge(fromKey, toKey string) *Edge {
+	adjacent, exists := c.graph.edges[fromKey]
+	if !exists {
+		return nil
+	}
+	element, err := adjacent.Lookup(toKey)
+	if err != nil {
+		return nil
+	}
+	edge := toEdge(element).clone()
+	return &edge
+}
@@ -0,0 +1,151 @@
+package lww
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	// receive returns the given number of events of the subscription
+	receive := func(t *testing.T, s crdt.Subscription, count int) []GraphEvent {
+		var events []GraphEvent
+		for len(events) < count {
+			select {
+			case e := <-s.Events():
+				events = append(events, e.(GraphEvent))
+			case <-time.After(time.Second):
+				require.FailNow(t, "timed out waiting for events", "received %d of %d", len(events), count)
+			}
+		}
+		select {
+		case e := <-s.Events():
+			require.FailNow(t, "unexpected event", "%+v", e)
+		case <-time.After(10 * time.Millisecond):
+		}
+		return events
+	}
+	// kinds returns the types and the keys of the events
+	kinds := func(events []GraphEvent) (list []string) {
+		for _, e := range events {
+			list = append(list, e.Type.String()+" "+e.EventKey())
+		}
+		return list
+	}
+
+	t.Run("local changes", func(t *testing.T) {
+		g := NewGraph(crdt.NewReplica("A"))
+		s := g.Subscribe(crdt.SubscriptionConfig{})
+		defer s.Close()
+
+		require.NoError(t, g.AddVertex(Vertex{Key: "v1", Value: "value1"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, g.UpdateVertex(Vertex{Key: "v1", Value: "updated"}))
+		require.NoError(t, g.UpdateVertex(Vertex{Key: "v1", Value: "updated"}), "does not change the value")
+		require.NoError(t, g.AddEdge("v1", "v2"))
+		require.NoError(t, g.UpdateEdgeAttributes("v1", "v2", map[string]string{"color": "red"}))
+		require.NoError(t, g.RemoveEdge("v1", "v2"))
+		require.NoError(t, g.RemoveVertex("v2"))
+
+		events := receive(t, s, 7)
+		require.Equal(t, []string{
+			"VertexAdded v1",
+			"VertexAdded v2",
+			"VertexUpdated v1",
+			"EdgeAdded v1->v2",
+			"EdgeUpdated v1->v2",
+			"EdgeRemoved v1->v2",
+			"VertexRemoved v2",
+		}, kinds(events))
+		require.Equal(t, Vertex{Key: "v1", Value: "updated"}, events[2].Vertex)
+		require.Equal(t, Edge{To: "v2", Attributes: map[string]string{"color": "red"}}, events[4].Edge)
+		for _, e := range events {
+			require.Equal(t, "A", e.Origin)
+			require.False(t, e.Merged)
+			require.False(t, e.Timestamp.IsZero())
+		}
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		g := NewGraph(crdt.NewReplica("A"))
+		s := g.Subscribe(crdt.SubscriptionConfig{})
+		defer s.Close()
+
+		require.NoError(t, g.AddVertices([]Vertex{{Key: "v2"}, {Key: "v1"}}))
+		require.NoError(t, g.AddEdges([]EdgeSpec{{From: "v1", Edge: Edge{To: "v2"}}}))
+		require.Equal(t, []string{
+			"VertexAdded v1",
+			"VertexAdded v2",
+			"EdgeAdded v1->v2",
+		}, kinds(receive(t, s, 3)))
+	})
+
+	t.Run("merged changes", func(t *testing.T) {
+		local := NewGraph(crdt.NewReplica("A"))
+		remote := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, local.AddVertex(Vertex{Key: "v1"}))
+		remote.Merge(local)
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, remote.AddEdge("v2", "v1"))
+		require.NoError(t, remote.RemoveVertex("v1"))
+
+		s := local.Subscribe(crdt.SubscriptionConfig{})
+		defer s.Close()
+		local.Merge(remote)
+		local.Merge(remote)
+
+		events := receive(t, s, 3)
+		require.Equal(t, []string{
+			"VertexRemoved v1",
+			"VertexAdded v2",
+			"EdgeAdded v2->v1",
+		}, kinds(events), "merging the same state again changes nothing")
+		for _, e := range events {
+			require.Equal(t, "B", e.Origin)
+			require.True(t, e.Merged)
+		}
+	})
+
+	t.Run("rejected values", func(t *testing.T) {
+		noDigits := crdt.ValidatorFunc(func(key, value string) error {
+			if strings.ContainsAny(value, "0123456789") {
+				return errors.New("digits are not allowed")
+			}
+			return nil
+		})
+		local := NewGraph(crdt.Replica{ID: "A", Validator: noDigits})
+		remote := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v2", Value: "2"}))
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v1", Value: "one"}))
+
+		s := local.Subscribe(crdt.SubscriptionConfig{})
+		defer s.Close()
+		local.Merge(remote)
+
+		events := receive(t, s, 2)
+		require.Equal(t, []string{
+			"VertexAdded v1",
+			"ValidationRejected rejected:v2",
+		}, kinds(events))
+		rejected := events[1]
+		require.Equal(t, Vertex{Key: "v2", Value: "2"}, rejected.Vertex)
+		require.Equal(t, "B", rejected.Origin)
+		require.True(t, rejected.Merged)
+		require.False(t, rejected.Timestamp.IsZero())
+		require.Contains(t, rejected.Reason, "digits are not allowed")
+		require.Len(t, local.Quarantined(), 1)
+	})
+
+	t.Run("no events after closing", func(t *testing.T) {
+		g := NewGraph(crdt.NewReplica("A"))
+		s := g.Subscribe(crdt.SubscriptionConfig{})
+		s.Close()
+		require.NoError(t, g.AddVertex(Vertex{Key: "v1"}))
+		_, open := <-s.Events()
+		require.False(t, open)
+	})
+}
@@ -0,0 +1,302 @@
+package lww
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrEvicted occurs when the value of an evicted vertex cannot be read back from the spill
+	ErrEvicted = errors.New("evicted value is unavailable")
+)
+
+// EvictionPolicy defines what happens to the values of the vertices evicted from memory
+type EvictionPolicy int
+
+const (
+	// EvictSpill moves the values of cold vertices to `MemoryBudget.Spill`,
+	// they're read back transparently by lookups, traversals and serialization.
+	EvictSpill EvictionPolicy = iota
+	// EvictDrop deletes the additions of cold removed vertices keeping only their removal records,
+	// which is enough for convergence: a merged addition older than the removal stays removed.
+	// Live vertices are never dropped, so the graph can stay above the budget.
+	EvictDrop
+)
+
+// Spill stores the evicted vertex values outside of memory, e.g. on disk (see `NewDirSpill`).
+// Every stored value is immutable, the IDs are unique for every write of a vertex.
+type Spill interface {
+	// Put stores the data under the given ID
+	Put(id string, data []byte) error
+	// Get returns the data stored under the given ID
+	Get(id string) ([]byte, error)
+}
+
+// MemoryBudget caps the size of the vertex values a graph keeps in memory, see `Graph.Evict`.
+type MemoryBudget struct {
+	// MaxBytes is the maximum size of the keys and values of the vertices kept in memory, zero disables eviction
+	MaxBytes int64
+	// StableAfter is how long after it was last written a vertex becomes causally stable,
+	// only stable vertices are evicted. It must be longer than the time it takes all the replicas
+	// to exchange their states, so concurrent writes to evicted vertices are unlikely.
+	StableAfter time.Duration
+	// Policy defines what happens to the evicted values
+	Policy EvictionPolicy
+	// Spill stores the evicted values with `EvictSpill`
+	Spill Spill
+	// Priority returns the priority of keeping the vertex in memory, vertices with the lowest priority
+	// are evicted first, the least recently written ones among the same priority.
+	// Nil gives all the vertices the same priority.
+	Priority func(key string) int
+}
+
+// EvictionResult is the outcome of `Graph.Evict`
+type EvictionResult struct {
+	// Spilled is the number of vertex values moved to the spill
+	Spilled int
+	// Dropped is the number of removed vertices dropped from the state
+	Dropped int
+	// Bytes is the size of the keys and values of the vertices kept in memory after the eviction
+	Bytes int64
+}
+
+// Evict evicts cold, causally stable vertices until the size of the vertex values in memory
+// fits into the budget, so replicas on devices with little memory can still participate.
+// It's meant to be called periodically or after large merges, like `ApplyRetention`.
+//
+// Removed vertices are evicted first, then the live ones with the lowest priority and the oldest write.
+// The timestamps and replicas of evicted vertices stay in memory, so merges resolve conflicts
+// with them as before. A newer write of an evicted vertex brings its value back to memory.
+//
+// Spilled values are stored in the same form as they're serialized, so `Marshal` and `Digest`
+// of the graph do not change and the other replicas see no difference. The spill keeps the values
+// of overwritten writes, since copies of the state (e.g. by `Subset` or `Merge`) can still refer to them.
+// Returns an error with `ErrEvicted` cause if a value cannot be spilled, the values spilled before stay evicted.
+func (g Graph) Evict(budget MemoryBudget) (result EvictionResult, err error) {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	s := g.vertices
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, record := range s.additions {
+		result.Bytes += elementSize(record.Element)
+	}
+	defer func() {
+		g.replica.Metrics.Count("lww.eviction.spilled", int64(result.Spilled))
+		g.replica.Metrics.Count("lww.eviction.dropped", int64(result.Dropped))
+	}()
+	if budget.MaxBytes <= 0 || result.Bytes <= budget.MaxBytes {
+		return result, nil
+	}
+	if budget.Policy == EvictSpill && budget.Spill == nil {
+		return result, errors.Wrap(ErrEvicted, "the spill is not configured")
+	}
+
+	for _, candidate := range g.evictionCandidates(budget) {
+		if result.Bytes <= budget.MaxBytes {
+			break
+		}
+		record := s.additions[candidate.key]
+
+		if budget.Policy == EvictDrop {
+			delete(s.additions, candidate.key)
+			delete(s.siblings, candidate.key)
+			result.Bytes -= candidate.size
+			result.Dropped++
+			continue
+		}
+
+		data, err := json.Marshal(record.Element)
+		if err != nil {
+			return result, errors.Wrapf(ErrEvicted, "failed to serialize vertex [key = %q]: %s", candidate.key, err)
+		}
+		evicted := evictedVertex{
+			key:   candidate.key,
+			id:    spillID(candidate.key, record),
+			spill: budget.Spill,
+		}
+		err = budget.Spill.Put(evicted.id, data)
+		if err != nil {
+			return result, errors.Wrapf(ErrEvicted, "failed to spill vertex [key = %q]: %s", candidate.key, err)
+		}
+		record.Element = evicted
+		s.additions[candidate.key] = record
+		result.Bytes -= candidate.size - elementSize(evicted)
+		result.Spilled++
+	}
+
+	return result, nil
+}
+
+// evictionCandidate is a vertex that can be evicted
+type evictionCandidate struct {
+	key      string
+	removed  bool
+	priority int
+	written  time.Time
+	size     int64
+}
+
+// evictionCandidates returns the stable vertices in the order of eviction. Must be called under the lock.
+func (g Graph) evictionCandidates(budget MemoryBudget) []evictionCandidate {
+	s := g.vertices
+	now := g.replica.Clock.Now()
+	stable := func(t time.Time) bool {
+		return !t.Add(budget.StableAfter).After(now)
+	}
+
+	var candidates []evictionCandidate
+	for key, record := range s.additions {
+		if _, evicted := record.Element.(evictedVertex); evicted {
+			continue
+		}
+		removed := s.removed(key, record)
+		if removed && !stable(s.removals[key].Timestamp) {
+			continue
+		}
+		if !removed && (budget.Policy == EvictDrop || !stable(record.Timestamp)) {
+			continue
+		}
+		candidate := evictionCandidate{
+			key:     key,
+			removed: removed,
+			written: record.Timestamp,
+			size:    elementSize(record.Element),
+		}
+		if budget.Priority != nil {
+			candidate.priority = budget.Priority(key)
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch {
+		case a.removed != b.removed:
+			return a.removed
+		case a.priority != b.priority:
+			return a.priority < b.priority
+		case !a.written.Equal(b.written):
+			return a.written.Before(b.written)
+		default:
+			return a.key < b.key
+		}
+	})
+	return candidates
+}
+
+// elementSize returns the size of the key and the value of the vertex element kept in memory
+func elementSize(e Element) int64 {
+	switch v := e.(type) {
+	case Vertex:
+		return vertexSize(v)
+	case compressedVertex:
+		return int64(len(v.key) + len(v.data))
+	default:
+		return int64(len(e.GetKey()))
+	}
+}
+
+// spillID returns the ID of the spilled value of the given write of the vertex
+func spillID(key string, record addRecord) string {
+	return key + "@" + strconv.FormatInt(record.Timestamp.UnixNano(), 10) + "@" + record.Replica
+}
+
+// evictedVertex is a vertex with its value moved to a spill,
+// it's stored instead of `Vertex` by `Graph.Evict`.
+type evictedVertex struct {
+	key   string
+	id    string
+	spill Spill
+}
+
+// GetKey implements the `Element` interface
+func (v evictedVertex) GetKey() string {
+	return v.key
+}
+
+// MarshalJSON implements the `json.Marshaler` interface, it returns the vertex as it was serialized before eviction
+func (v evictedVertex) MarshalJSON() ([]byte, error) {
+	data, err := v.spill.Get(v.id)
+	if err != nil {
+		return nil, errors.Wrapf(ErrEvicted, "failed to read vertex [key = %q]: %s", v.key, err)
+	}
+	return data, nil
+}
+
+// vertex returns the vertex read back from the spill
+func (v evictedVertex) vertex() (Vertex, error) {
+	data, err := v.MarshalJSON()
+	if err != nil {
+		return Vertex{}, err
+	}
+	element, err := DecodeVertex(data)
+	if err != nil {
+		return Vertex{}, errors.Wrapf(ErrEvicted, "failed to decode vertex [key = %q]: %s", v.key, err)
+	}
+	vertex, _ := toVertex(element)
+	vertex.Key = v.key
+	return vertex, nil
+}
+
+// NewDirSpill returns a spill storing every value in a file of the given directory, the directory is created if needed
+func NewDirSpill(dir string) (DirSpill, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return DirSpill{}, errors.Wrapf(err, "failed to create spill directory %q", dir)
+	}
+	return DirSpill{dir: dir}, nil
+}
+
+// DirSpill is a `Spill` storing every value in a file of a directory.
+// Use `NewDirSpill` in order to initialize it before use.
+type DirSpill struct {
+	dir string
+}
+
+// Put implements the `Spill` interface, the file is replaced atomically
+func (s DirSpill) Put(id string, data []byte) error {
+	f, err := ioutil.TempFile(s.dir, ".spill-*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create spill file")
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(id))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.Wrapf(err, "failed to write spill file of %q", id)
+	}
+	return nil
+}
+
+// Get implements the `Spill` interface
+func (s DirSpill) Get(id string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read spill file of %q", id)
+	}
+	return data, nil
+}
+
+// path returns the file of the value, IDs are hashed since keys can contain any characters
+func (s DirSpill) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
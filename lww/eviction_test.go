@@ -0,0 +1,192 @@
+package lww
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// failingSpill is a `Spill` that fails all the operations
+type failingSpill struct{}
+
+func (failingSpill) Put(id string, data []byte) error { return errors.New("disk full") }
+func (failingSpill) Get(id string) ([]byte, error)    { return nil, errors.New("disk gone") }
+
+func TestEvict(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	newReplica := func(id string, now *time.Time) crdt.Replica {
+		return crdt.Replica{
+			ID:    id,
+			Clock: clock.Func(func() time.Time { return *now }),
+			Order: crdt.OrderSorted,
+		}
+	}
+	value := strings.Repeat("v", 100)
+
+	t.Run("spills cold stable vertices and reads them back", func(t *testing.T) {
+		now := base
+		g := NewGraph(newReplica("A", &now))
+		require.NoError(t, g.AddVertex(Vertex{Key: "a", Value: value}))
+		now = base.Add(time.Minute)
+		require.NoError(t, g.AddVertex(Vertex{Key: "b", Value: value}))
+		now = base.Add(2 * time.Minute)
+		require.NoError(t, g.AddVertex(Vertex{Key: "c", Value: value}))
+		require.NoError(t, g.AddEdge("a", "b"))
+
+		data, err := g.Marshal()
+		require.NoError(t, err)
+		digest, err := g.Digest()
+		require.NoError(t, err)
+
+		spill, err := NewDirSpill(t.TempDir())
+		require.NoError(t, err)
+		budget := MemoryBudget{MaxBytes: 150, StableAfter: time.Minute, Spill: spill}
+
+		result, err := g.Evict(budget)
+		require.NoError(t, err)
+		// only "a" and "b" are stable, "c" stays in memory above the budget
+		require.Equal(t, EvictionResult{Spilled: 2, Bytes: 103}, result)
+
+		result, err = g.Evict(budget)
+		require.NoError(t, err)
+		require.Equal(t, EvictionResult{Bytes: 103}, result)
+
+		v, err := g.Lookup("a")
+		require.NoError(t, err)
+		require.Equal(t, Vertex{Key: "a", Value: value}, v)
+		list, err := g.List()
+		require.NoError(t, err)
+		require.Len(t, list, 3)
+		require.Equal(t, Vertex{Key: "b", Value: value}, list[1].Vertex)
+
+		evictedData, err := g.Marshal()
+		require.NoError(t, err)
+		require.JSONEq(t, string(data), string(evictedData))
+		evictedDigest, err := g.Digest()
+		require.NoError(t, err)
+		require.Equal(t, digest.Root(), evictedDigest.Root())
+
+		// a newer write brings the value back to memory
+		require.NoError(t, g.UpdateVertex(Vertex{Key: "a", Value: "new"}))
+		result, err = g.Evict(MemoryBudget{MaxBytes: 1000, Spill: spill})
+		require.NoError(t, err)
+		require.Equal(t, EvictionResult{Bytes: 106}, result)
+	})
+
+	t.Run("merges with evicted vertices like with the ones in memory", func(t *testing.T) {
+		now := base
+		a := NewGraph(newReplica("A", &now))
+		require.NoError(t, a.AddVertex(Vertex{Key: "a", Value: value}))
+		require.NoError(t, a.AddVertex(Vertex{Key: "b", Value: value}))
+		b := NewGraph(newReplica("B", &now))
+		b.Merge(a)
+
+		now = base.Add(time.Hour)
+		spill, err := NewDirSpill(t.TempDir())
+		require.NoError(t, err)
+		result, err := a.Evict(MemoryBudget{MaxBytes: 1, Spill: spill})
+		require.NoError(t, err)
+		require.Equal(t, 2, result.Spilled)
+
+		// an older concurrent write loses to the evicted one
+		staleAt := base.Add(-time.Second)
+		stale := NewGraph(newReplica("C", &staleAt))
+		require.NoError(t, stale.AddVertex(Vertex{Key: "a", Value: "stale"}))
+		a.Merge(stale)
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "b", Value: "updated"}))
+		a.Merge(b)
+
+		v, err := a.Lookup("a")
+		require.NoError(t, err)
+		require.Equal(t, value, v.Value)
+		v, err = a.Lookup("b")
+		require.NoError(t, err)
+		require.Equal(t, "updated", v.Value)
+
+		c := NewGraph(newReplica("C", &now))
+		c.Merge(a)
+		b.Merge(stale)
+		equal, err := c.StateEquals(b)
+		require.NoError(t, err)
+		require.True(t, equal)
+	})
+
+	t.Run("evicts removed vertices and low priorities first", func(t *testing.T) {
+		now := base
+		g := NewGraph(newReplica("A", &now))
+		require.NoError(t, g.AddVertex(Vertex{Key: "pinned", Value: value}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "removed", Value: value}))
+		now = base.Add(time.Second)
+		require.NoError(t, g.AddVertex(Vertex{Key: "newer", Value: value}))
+		require.NoError(t, g.RemoveVertex("removed"))
+
+		spill, err := NewDirSpill(t.TempDir())
+		require.NoError(t, err)
+		now = base.Add(time.Hour)
+		result, err := g.Evict(MemoryBudget{
+			MaxBytes: 150,
+			Spill:    spill,
+			Priority: func(key string) int {
+				if key == "pinned" {
+					return 1
+				}
+				return 0
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, EvictionResult{Spilled: 2, Bytes: 118}, result)
+		require.IsType(t, Vertex{}, g.vertices.additions["pinned"].Element)
+		require.IsType(t, evictedVertex{}, g.vertices.additions["newer"].Element)
+	})
+
+	t.Run("drops removed vertices keeping the removals", func(t *testing.T) {
+		now := base
+		g := NewGraph(newReplica("A", &now))
+		require.NoError(t, g.AddVertex(Vertex{Key: "a", Value: value}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "b", Value: value}))
+		old := NewGraph(newReplica("A", &now))
+		old.Merge(g)
+		now = base.Add(time.Second)
+		require.NoError(t, g.RemoveVertex("a"))
+
+		budget := MemoryBudget{MaxBytes: 1, StableAfter: time.Minute, Policy: EvictDrop}
+		result, err := g.Evict(budget)
+		require.NoError(t, err)
+		require.Equal(t, EvictionResult{Bytes: 202}, result)
+
+		now = base.Add(time.Hour)
+		result, err = g.Evict(budget)
+		require.NoError(t, err)
+		require.Equal(t, EvictionResult{Dropped: 1, Bytes: 101}, result)
+
+		g.Merge(old)
+		_, err = g.Lookup("a")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		_, err = g.Lookup("b")
+		require.NoError(t, err)
+	})
+
+	t.Run("fails when values cannot be spilled or read", func(t *testing.T) {
+		now := base
+		g := NewGraph(newReplica("A", &now))
+		require.NoError(t, g.AddVertex(Vertex{Key: "a", Value: value}))
+
+		_, err := g.Evict(MemoryBudget{MaxBytes: 1})
+		require.ErrorIs(t, err, ErrEvicted)
+		_, err = g.Evict(MemoryBudget{MaxBytes: 1, Spill: failingSpill{}})
+		require.ErrorIs(t, err, ErrEvicted)
+
+		record := g.vertices.additions["a"]
+		record.Element = evictedVertex{key: "a", id: "a", spill: failingSpill{}}
+		g.vertices.additions["a"] = record
+		_, err = g.Lookup("a")
+		require.ErrorIs(t, err, ErrEvicted)
+		_, err = g.Marshal()
+		require.ErrorIs(t, err, ErrEvicted)
+	})
+}
@@ -3,8 +3,11 @@ package lww
 import (
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
 )
 
 var (
@@ -17,6 +20,8 @@ var (
 	ErrVertexNotFound = errors.New("vertex not found")
 	// ErrPathNotFound occurs when there is no path between the given vertices
 	ErrPathNotFound = errors.New("path not found")
+	// ErrEdgeNotFound occurs when trying to access a non existing edge
+	ErrEdgeNotFound = errors.New("edge not found")
 )
 
 // nothing is a type with zero memory allocation.
@@ -26,9 +31,9 @@ type nothing struct{}
 // Vertex is a graph vertex that holds a unique key and a value
 type Vertex struct {
 	// Key is a universally unique identifier (e.g. UUID v4) of the vertex
-	Key string
+	Key string `json:"key"`
 	// Value is an arbitrary value stored in the vertex
-	Value string
+	Value string `json:"value"`
 }
 
 // GetKey implements the `Element` interface
@@ -46,17 +51,31 @@ type VertexWithEdges struct {
 }
 
 // NewGraph initializes the Last-Writer-Wins state-based graph and makes it ready for use.
-func NewGraph() Graph {
+// `r` is shared with all the internal sets of vertices and edges.
+func NewGraph(r crdt.Replica) Graph {
+	r = r.WithDefaults()
+	vertices := NewSetWithDecoder(r, DecodeVertex)
+	vertices.mutation = func(key string) crdt.Mutation {
+		return crdt.Mutation{Kind: GraphKind, Key: key}
+	}
 	return Graph{
-		mutex:    &sync.Mutex{},
-		vertices: NewSet(),
-		edges:    make(map[string]Set),
+		mutex:      &sync.RWMutex{},
+		replica:    r,
+		vertices:   vertices,
+		edges:      make(map[string]Set),
+		weights:    make(map[string]map[string]counter.PN),
+		incoming:   make(map[string]map[string]nothing),
+		unindexed:  new(bool),
+		quarantine: make(map[string]QuarantinedVertex),
+		feed:       crdt.NewFeed(r),
 	}
 }
 
 // Graph is a Last-Writer-Wins state-based directional graph.
 // Use `NewGraph` in order to initialize it before use.
-// The graph is thread-safe and can be used from several go routines.
+// The graph is thread-safe and can be used from several go routines,
+// reads (e.g. `Lookup`, `List`, `FindPath`, `FindConnected`) share the lock and run concurrently,
+// only writes and merges take it exclusively.
 //
 // The implementation is basically composing two dimensions of LWW sets into a graph data structure:
 // * 1st dimension is a set of vertices
@@ -87,7 +106,10 @@ func NewGraph() Graph {
 // C---------------------------AddVertex(V1)-------------\--|
 type Graph struct {
 	// mutex is used for the thread-safety
-	mutex *sync.Mutex
+	mutex *sync.RWMutex
+
+	// replica is the identity and the policies of the replica the graph belongs to
+	replica crdt.Replica
 
 	// vertices is a Last-Writer-Wins state-based element set of all the graph vertices
 	vertices Set
@@ -95,15 +117,40 @@ type Graph struct {
 	// edges is a map from a vertex key to a Last-Writer-Wins state-based
 	// element set of all keys of adjacent vertices
 	edges map[string]Set
+
+	// weights is a map from a vertex key to a map from an adjacent vertex key
+	// to the PN-Counter of the edge weight
+	weights map[string]map[string]counter.PN
+
+	// incoming is an index of the edges by the vertex they point to: a map from a vertex key
+	// to the set of keys of vertices with an edge to it. It's derived from `edges` on every change,
+	// so it's never serialized and it's merged along with the edges.
+	incoming map[string]map[string]nothing
+	// unindexed is `true` while `incoming` is not built yet (see `UnmarshalLive`),
+	// the edges are scanned instead of using the index
+	unindexed *bool
+
+	// quarantine maps a vertex key to the latest value from another replica rejected by the replica validator
+	quarantine map[string]QuarantinedVertex
+
+	// feed publishes the changes of the graph to the subscribers, see `Subscribe`
+	feed crdt.Feed
 }
 
 // AddVertex adds the given vertex `v` to the graph.
 // Returns `ErrVertexAlreadyExists` if a vertex with the same key already exists in the graph.
+// Returns an error with `crdt.ErrInvalidValue` cause if the replica validator rejects the value.
 func (g Graph) AddVertex(v Vertex) error {
+	g.checkUsage()
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
-	_, err := g.Lookup(v.Key)
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	_, err = g.Lookup(v.Key)
 	if err == nil {
 		return ErrVertexAlreadyExists
 	}
@@ -111,7 +158,94 @@ func (g Graph) AddVertex(v Vertex) error {
 		return err
 	}
 
-	g.vertices.Add(v)
+	if g.replica.Limits.MaxElements > 0 {
+		err = g.replica.CheckLimit(len(g.vertices.List()))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = g.replica.ValidateValue(v.Key, v.Value)
+	if err != nil {
+		return err
+	}
+
+	changes := g.trackChanges(false)
+	changes.vertex(v.Key)
+	g.vertices.Add(g.compressVertex(v))
+	changes.publish()
+
+	return nil
+}
+
+// UpdateVertex replaces the value of the existing vertex with the key `v.Key`, the edges of the vertex are kept.
+// The update is timestamped like any other write, so concurrent updates on different replicas
+// converge to the latest one and the greater replica ID wins when timestamps collide.
+// Returns an error with `ErrVertexNotfound` cause if the vertex with the given key does not exist.
+// Returns an error with `crdt.ErrInvalidValue` cause if the replica validator rejects the value.
+func (g Graph) UpdateVertex(v Vertex) error {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	_, err = g.Lookup(v.Key)
+	if err != nil {
+		return err
+	}
+
+	err = g.replica.ValidateValue(v.Key, v.Value)
+	if err != nil {
+		return err
+	}
+
+	changes := g.trackChanges(false)
+	changes.vertex(v.Key)
+	g.vertices.Add(g.compressVertex(v))
+	changes.publish()
+
+	return nil
+}
+
+// UpsertVertex adds the vertex `v` or replaces the value of the existing vertex with the same key,
+// see `UpdateVertex` for how concurrent updates are resolved.
+// Returns an error with `crdt.ErrLimitExceeded` cause if a new vertex would exceed the replica limits.
+// Returns an error with `crdt.ErrInvalidValue` cause if the replica validator rejects the value.
+func (g Graph) UpsertVertex(v Vertex) error {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	_, err = g.Lookup(v.Key)
+	if err != nil && !errors.Is(err, ErrVertexNotFound) {
+		return err
+	}
+
+	if err != nil && g.replica.Limits.MaxElements > 0 {
+		err = g.replica.CheckLimit(len(g.vertices.List()))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = g.replica.ValidateValue(v.Key, v.Value)
+	if err != nil {
+		return err
+	}
+
+	changes := g.trackChanges(false)
+	changes.vertex(v.Key)
+	g.vertices.Add(g.compressVertex(v))
+	changes.publish()
 
 	return nil
 }
@@ -120,15 +254,24 @@ func (g Graph) AddVertex(v Vertex) error {
 // Returns an error with `ErrVertexNotfound` cause if
 // the vertex with the given key does not exist
 func (g Graph) RemoveVertex(key string) (err error) {
+	g.checkUsage()
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
+	err = g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
 	_, err = g.Lookup(key)
 	if err != nil {
 		return err
 	}
 
+	changes := g.trackChanges(false)
+	changes.vertex(key)
 	g.vertices.Remove(key)
+	changes.publish()
 
 	return nil
 }
@@ -137,9 +280,20 @@ func (g Graph) RemoveVertex(key string) (err error) {
 // Returns an error with `ErrVertexNotfound` cause if
 // one of the vertices with the given key does not exist
 func (g Graph) AddEdge(fromKey, toKey string) error {
+	g.checkUsage()
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	return g.addEdge(fromKey, toKey)
+}
+
+// addEdge adds the edge like `AddEdge`, must be called under the write lock
+func (g Graph) addEdge(fromKey, toKey string) error {
 	_, err := g.Lookup(fromKey)
 	if err != nil {
 		return err
@@ -150,8 +304,18 @@ func (g Graph) AddEdge(fromKey, toKey string) error {
 		return err
 	}
 
+	changes := g.trackChanges(false)
+	changes.edge(fromKey, toKey)
 	adjacent := g.getAdjacent(fromKey)
-	adjacent.Add(IDElement(toKey))
+	// re-adding an existing edge keeps its weight and label
+	existing, err := adjacent.Lookup(toKey)
+	if err == nil {
+		adjacent.Add(existing)
+	} else {
+		adjacent.Add(Edge{To: toKey})
+	}
+	g.indexEdge(g.replica.NormalizeKey(fromKey), g.replica.NormalizeKey(toKey))
+	changes.publish()
 
 	return nil
 }
@@ -160,10 +324,16 @@ func (g Graph) AddEdge(fromKey, toKey string) error {
 // Returns an error with `ErrVertexNotfound` cause if
 // one of the vertices with the given key does not exist
 func (g Graph) RemoveEdge(fromKey, toKey string) error {
+	g.checkUsage()
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
-	_, err := g.Lookup(fromKey)
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	_, err = g.Lookup(fromKey)
 	if err != nil {
 		return err
 	}
@@ -173,8 +343,12 @@ func (g Graph) RemoveEdge(fromKey, toKey string) error {
 		return err
 	}
 
+	changes := g.trackChanges(false)
+	changes.edge(fromKey, toKey)
 	adjacent := g.getAdjacent(fromKey)
 	adjacent.Remove(toKey)
+	g.indexEdge(g.replica.NormalizeKey(fromKey), g.replica.NormalizeKey(toKey))
+	changes.publish()
 
 	return nil
 }
@@ -196,6 +370,10 @@ func (g Graph) Lookup(key string) (found Vertex, err error) {
 	switch v := foundElement.(type) {
 	case Vertex:
 		return v, nil
+	case compressedVertex:
+		return v.vertex()
+	case evictedVertex:
+		return v.vertex()
 	default:
 		return found, errors.Wrapf(ErrInvalidVertexType, "vertex [key = %q] is of invalid type", key)
 	}
@@ -209,11 +387,24 @@ func (g Graph) Lookup(key string) (found Vertex, err error) {
 //
 // The resulting list order is breadth-first, however,
 // because of the internally used map the order in the result list is
-// not deterministic within a single adjacent vertex set.
+// not deterministic within a single adjacent vertex set
+// unless the graph replica has an iteration order (see `crdt.Replica.Order`).
 func (g Graph) FindConnected(key string) (connected []Vertex, err error) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	return g.FindConnectedFiltered(key, EdgeFilter{})
+}
+
+// FindConnectedFiltered works like `FindConnected` but follows only the edges matching the given filter.
+func (g Graph) FindConnectedFiltered(key string, filter EdgeFilter) (connected []Vertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.findConnected(nil, key, filter)
+}
 
+// findConnected performs the breadth-first traversal of `FindConnected`, must be called under the read lock.
+// `t` can be `nil` if the traversal can't be canceled or limited.
+func (g Graph) findConnected(t *traversal, key string, filter EdgeFilter) (connected []Vertex, err error) {
 	start, err := g.Lookup(key)
 	if err != nil {
 		return nil, err
@@ -228,20 +419,31 @@ func (g Graph) FindConnected(key string) (connected []Vertex, err error) {
 	visited := make(map[string]nothing)
 	// the traversal queue for BFS
 	queue := []Vertex{start}
+	// the number of hops from the start vertex to each queued vertex
+	hops := []int{0}
 
-	var current Vertex
+	var (
+		current Vertex
+		hop     int
+	)
 
 	for {
 		if len(queue) == 0 {
-			return connected, nil
+			return connected, t.complete()
+		}
+		if err = t.step(); err != nil {
+			// limited traversals return what they found so far
+			if errors.Is(err, ErrLimitReached) {
+				return connected, err
+			}
+			return nil, err
 		}
 
 		// dequeue
-		current = queue[0]
-		queue = queue[1:]
+		current, hop = queue[0], hops[0]
+		queue, hops = queue[1:], hops[1:]
 
-		adjacent := g.getAdjacent(current.Key)
-		for _, v := range adjacent.List() {
+		for _, v := range g.listAdjacent(current.Key) {
 			// some edges exist even for removed vertices
 			vertex, err := g.Lookup(v.GetKey())
 			if errors.Is(err, ErrVertexNotFound) {
@@ -250,15 +452,25 @@ func (g Graph) FindConnected(key string) (connected []Vertex, err error) {
 			if err != nil {
 				return nil, err
 			}
+			if !filter.MatchEdge(current, vertex, toEdge(v)) {
+				continue
+			}
 
 			_, toSkip := visited[vertex.Key]
 			if toSkip {
 				continue
 			}
+			if t.beyondDepth(hop + 1) {
+				continue
+			}
+			if err = t.add(len(connected)); err != nil {
+				return connected, err
+			}
 			visited[vertex.Key] = nothing{}
 
 			connected = append(connected, vertex)
 			queue = append(queue, vertex)
+			hops = append(hops, hop+1)
 		}
 	}
 }
@@ -273,17 +485,30 @@ func (g Graph) FindConnected(key string) (connected []Vertex, err error) {
 // The resulted path always starts with the "from" vertex and ends with the "to" vertex.
 // The path can also start and end with the same vertex if there is a loop on the way.
 //
-// Because of the data internals the result is not guarantied to be deterministic.
+// Because of the data internals the result is not guarantied to be deterministic
+// unless the graph replica has an iteration order (see `crdt.Replica.Order`).
 func (g Graph) FindPath(fromKey, toKey string) (path []Vertex, err error) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	return g.FindPathFiltered(fromKey, toKey, EdgeFilter{})
+}
+
+// FindPathFiltered works like `FindPath` but follows only the edges matching the given filter.
+func (g Graph) FindPathFiltered(fromKey, toKey string, filter EdgeFilter) (path []Vertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
 
+	return g.findPathFrom(nil, fromKey, toKey, filter)
+}
+
+// findPathFrom performs the depth-first traversal of `FindPath`, must be called under the read lock.
+// `t` can be `nil` if the traversal can't be canceled or limited.
+func (g Graph) findPathFrom(t *traversal, fromKey, toKey string, filter EdgeFilter) (path []Vertex, err error) {
 	start, err := g.Lookup(fromKey)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = g.Lookup(toKey)
+	end, err := g.Lookup(toKey)
 	if err != nil {
 		return nil, err
 	}
@@ -294,18 +519,35 @@ func (g Graph) FindPath(fromKey, toKey string) (path []Vertex, err error) {
 	visited := make(map[string]nothing)
 	path = []Vertex{start}
 
-	return g.findPath(start, toKey, path, visited)
+	path, err = g.findPath(t, start, end.Key, path, visited, filter)
+	if errors.Is(err, ErrPathNotFound) {
+		// the path might exist beyond the limits
+		if limitErr := t.complete(); limitErr != nil {
+			return nil, limitErr
+		}
+	}
+	return path, err
 }
 
 // findPath performs a single recursive iteration of DFS in the `FindPath` function.
-func (g Graph) findPath(start Vertex, searchKey string, currentPath []Vertex, visited map[string]nothing) (path []Vertex, err error) {
+func (g Graph) findPath(
+	t *traversal,
+	start Vertex,
+	searchKey string,
+	currentPath []Vertex,
+	visited map[string]nothing,
+	filter EdgeFilter,
+) (path []Vertex, err error) {
 	_, toSkip := visited[start.Key]
 	if toSkip {
 		return nil, ErrPathNotFound
 	}
 	visited[start.Key] = nothing{}
+	if err = t.step(); err != nil {
+		return nil, err
+	}
 
-	adjacent := g.getAdjacent(start.Key).List()
+	adjacent := g.listAdjacent(start.Key)
 	for _, v := range adjacent {
 		// some edges exist even for removed vertices
 		vertex, err := g.Lookup(v.GetKey())
@@ -315,11 +557,17 @@ func (g Graph) findPath(start Vertex, searchKey string, currentPath []Vertex, vi
 		if err != nil {
 			return nil, err
 		}
+		if !filter.MatchEdge(start, vertex, toEdge(v)) {
+			continue
+		}
+		if t.beyondDepth(len(currentPath)) {
+			continue
+		}
 		if vertex.Key == searchKey {
 			return append(currentPath, vertex), nil
 		}
 
-		path, err = g.findPath(vertex, searchKey, append(currentPath, vertex), visited)
+		path, err = g.findPath(t, vertex, searchKey, append(currentPath, vertex), visited, filter)
 		if errors.Is(err, ErrPathNotFound) {
 			continue
 		}
@@ -332,8 +580,9 @@ func (g Graph) findPath(start Vertex, searchKey string, currentPath []Vertex, vi
 // List returns a comparable graph representation.
 // This function produces deterministic results.
 func (g Graph) List() (list []VertexWithEdges, err error) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
 
 	list = []VertexWithEdges{}
 
@@ -347,7 +596,7 @@ func (g Graph) List() (list []VertexWithEdges, err error) {
 		if err != nil {
 			return nil, err
 		}
-		adjacent := g.getAdjacent(vertex.Key).List()
+		adjacent := g.listAdjacent(vertex.Key)
 		vwe := VertexWithEdges{
 			Vertex:       vertex,
 			AdjacentKeys: make([]string, 0, len(adjacent)),
@@ -366,29 +615,112 @@ func (g Graph) List() (list []VertexWithEdges, err error) {
 
 // Merge takes another LWW Graph as a `remote` and merges its state into itself.
 // Merging two replicas takes the union of the respective vertices and edges.
+// Every overwritten local operation on a vertex or an edge is recorded in the replica journal.
 func (g Graph) Merge(remote Graph) {
+	// merging without cancellation cannot fail
+	_ = g.merge(remote, chunkedMergeTracker(g.replica), nil)
+}
+
+// merge merges the `remote` state reporting every processed record to `tracker` which can be `nil`,
+// the merge stops with the tracker error leaving the records processed so far merged.
+// Every last-writer-wins decision is added to `report` which can be `nil`.
+func (g Graph) merge(remote Graph, tracker *mergeTracker, report *MergeReport) error {
+	g.checkMerge(remote)
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
+	tracker.hold(g.mutex)
+	defer tracker.release()
 
-	// replicating vertices
-	g.vertices.Merge(remote.vertices)
+	started := time.Now()
+	err := g.mergeState(remote, tracker, report)
+	if err != nil {
+		return err
+	}
+
+	g.replica.Metrics.Count("lww.graph.merge", 1)
+	crdt.ObserveDuration(g.replica.Metrics, "lww.graph.merge.duration", time.Since(started))
+	return nil
+}
+
+// mergeState merges the `remote` state like `merge`, must be called under the write lock.
+// The summary of the vertices and edges merge is logged (see `crdt.MergeLogger`).
+func (g Graph) mergeState(remote Graph, tracker *mergeTracker, report *MergeReport) (err error) {
+	changes := g.trackChanges(true)
+	changes.merge(remote)
+	// a canceled merge publishes the changes merged so far
+	defer changes.publish()
+
+	started := time.Now()
+	summary := &crdt.MergeSummary{Kind: GraphKind, Replica: g.replica.ID}
+	defer func() {
+		summary.Duration, summary.Err = time.Since(started), err
+		crdt.LogMerge(g.replica.Logger, *summary)
+	}()
+
+	// replicating vertices, the values rejected by the replica validator are quarantined
+	err = g.vertices.merge(g.quarantineInvalid(remote.vertices, changes), func(key string) crdt.Conflict {
+		return crdt.Conflict{Kind: GraphKind, Key: key}
+	}, tracker, summary, report)
+	if err != nil {
+		return err
+	}
 
 	// replicating edges
 	for vertexKey, remoteAdjacent := range remote.edges {
 		localAdjacent := g.getAdjacent(vertexKey)
-		localAdjacent.Merge(remoteAdjacent)
+		fromKey := g.replica.NormalizeKey(vertexKey)
+		err = localAdjacent.merge(remoteAdjacent, func(toKey string) crdt.Conflict {
+			return crdt.Conflict{Kind: GraphKind, Key: fromKey, AdjacentKey: toKey}
+		}, tracker, summary, report)
+		// a canceled merge changes only some of the edges, the changed ones are indexed anyway
+		g.indexAdjacent(fromKey, remoteAdjacent)
+		if err != nil {
+			return err
+		}
+	}
+
+	// replicating edge weights
+	for fromKey, remoteWeights := range remote.weights {
+		for toKey, remoteWeight := range remoteWeights {
+			if err = tracker.step(); err != nil {
+				return err
+			}
+			g.getWeight(fromKey, toKey).Merge(remoteWeight)
+		}
 	}
+
+	return nil
 }
 
 // getAdjacent returns an LWW Element Set of keys of adjacent vertices.
 // This function also initializes the set of adjacent keys if needed.
 func (g Graph) getAdjacent(vertexKey string) Set {
+	vertexKey = g.replica.NormalizeKey(vertexKey)
 	// if these vertex edges are being requested for the first time,
 	// we need to initialize the set
 	edges, edgesExist := g.edges[vertexKey]
 	if !edgesExist {
-		edges = NewSet()
+		edges = g.newAdjacent(vertexKey)
 		g.edges[vertexKey] = edges
 	}
 	return edges
 }
+
+// newAdjacent returns a new LWW Element Set of keys of vertices adjacent to the given vertex
+func (g Graph) newAdjacent(vertexKey string) Set {
+	edges := NewSetWithDecoder(g.replica, DecodeEdge)
+	edges.mutation = func(toKey string) crdt.Mutation {
+		return crdt.Mutation{Kind: GraphKind, Key: vertexKey, AdjacentKey: toKey}
+	}
+	return edges
+}
+
+// listAdjacent returns the elements of the set of adjacent vertex keys without initializing the set,
+// so it's safe to call while holding only the read lock.
+func (g Graph) listAdjacent(vertexKey string) []Element {
+	edges, edgesExist := g.edges[g.replica.NormalizeKey(vertexKey)]
+	if !edgesExist {
+		return []Element{}
+	}
+	return edges.List()
+}
@@ -0,0 +1,253 @@
+package lww
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TopologyStats contains topology metrics of the graph computed over a single snapshot.
+// It's used for monitoring how the replicated graph evolves over time.
+type TopologyStats struct {
+	// Vertices is the number of vertices in the graph
+	Vertices int
+	// Edges is the number of edges between existing vertices in the graph.
+	// Hanging edges pointing to removed vertices are not counted.
+	Edges int
+	// OutDegrees maps an out-degree to the number of vertices with this out-degree
+	OutDegrees map[int]int
+	// InDegrees maps an in-degree to the number of vertices with this in-degree
+	InDegrees map[int]int
+	// AveragePathLength is the average length of the shortest directed paths
+	// between the sampled vertices and all the vertices reachable from them.
+	AveragePathLength float64
+	// PathSamples is the number of vertices used as a source for computing `AveragePathLength`
+	PathSamples int
+	// ClusteringCoefficient is the average local clustering coefficient of all the vertices.
+	// Edge directions are ignored for computing the coefficient.
+	ClusteringCoefficient float64
+	// Components is the number of weakly connected components in the graph
+	Components int
+	// IsolatedVertices is the number of vertices that have no edges at all
+	IsolatedVertices int
+}
+
+// TopologyStats computes topology metrics of the graph.
+//
+// The metrics are computed over a snapshot of the graph, so the graph lock is held
+// only while the snapshot is taken and the graph can be modified during the computation.
+//
+// Computing the average path length requires a traversal from every vertex, which is expensive
+// on large graphs. `pathSamples` limits the number of randomly chosen source vertices for this metric,
+// if it's zero or greater than the number of vertices, all the vertices are used.
+//
+// The computation stops and returns the context error if the given context is done.
+func (g Graph) TopologyStats(ctx context.Context, pathSamples int) (stats TopologyStats, err error) {
+	g.mutex.RLock()
+	adjacency := g.adjacencySnapshot()
+	g.mutex.RUnlock()
+
+	keys := make([]string, 0, len(adjacency))
+	for key := range adjacency {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// undirected neighbors are used for the clustering coefficient and components
+	neighbors := make(map[string]map[string]nothing, len(keys))
+	for _, key := range keys {
+		neighbors[key] = make(map[string]nothing)
+	}
+
+	stats.Vertices = len(keys)
+	stats.OutDegrees = make(map[int]int)
+	stats.InDegrees = make(map[int]int)
+
+	inDegrees := make(map[string]int, len(keys))
+	for _, key := range keys {
+		stats.Edges += len(adjacency[key])
+		stats.OutDegrees[len(adjacency[key])]++
+		for _, adjacentKey := range adjacency[key] {
+			inDegrees[adjacentKey]++
+			// loops don't make a vertex a neighbor of itself
+			if adjacentKey == key {
+				continue
+			}
+			neighbors[key][adjacentKey] = nothing{}
+			neighbors[adjacentKey][key] = nothing{}
+		}
+	}
+
+	for _, key := range keys {
+		stats.InDegrees[inDegrees[key]]++
+		if len(adjacency[key]) == 0 && inDegrees[key] == 0 {
+			stats.IsolatedVertices++
+		}
+	}
+
+	if err = ctx.Err(); err != nil {
+		return stats, errors.Wrap(err, "failed to compute degrees")
+	}
+
+	stats.ClusteringCoefficient, err = clusteringCoefficient(ctx, keys, neighbors)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Components, err = countComponents(ctx, keys, neighbors)
+	if err != nil {
+		return stats, err
+	}
+
+	sources := keys
+	if pathSamples > 0 && pathSamples < len(keys) {
+		// nolint:gosec // the sampling does not need to be cryptographically secure
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		sources = make([]string, 0, pathSamples)
+		for _, i := range random.Perm(len(keys))[:pathSamples] {
+			sources = append(sources, keys[i])
+		}
+	}
+	stats.PathSamples = len(sources)
+
+	stats.AveragePathLength, err = averagePathLength(ctx, sources, adjacency)
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// adjacencySnapshot returns a copy of the graph structure as a map from
+// every existing vertex key to a sorted list of its adjacent vertex keys.
+// Hanging edges pointing to removed vertices are omitted.
+// The caller must hold the graph lock.
+func (g Graph) adjacencySnapshot() map[string][]string {
+	vertices := g.vertices.List()
+	adjacency := make(map[string][]string, len(vertices))
+	for _, v := range vertices {
+		adjacency[v.GetKey()] = []string{}
+	}
+
+	for key := range adjacency {
+		for _, adjacent := range g.listAdjacent(key) {
+			adjacentKey := adjacent.GetKey()
+			// some edges exist even for removed vertices
+			if _, exists := adjacency[adjacentKey]; !exists {
+				continue
+			}
+			adjacency[key] = append(adjacency[key], adjacentKey)
+		}
+		sort.Strings(adjacency[key])
+	}
+
+	return adjacency
+}
+
+// clusteringCoefficient computes the average local clustering coefficient
+// of the given vertices using the undirected `neighbors` sets.
+func clusteringCoefficient(ctx context.Context, keys []string, neighbors map[string]map[string]nothing) (float64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	var total float64
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return 0, errors.Wrap(err, "failed to compute clustering coefficient")
+		}
+
+		k := len(neighbors[key])
+		if k < 2 {
+			continue
+		}
+
+		links := 0
+		for n1 := range neighbors[key] {
+			for n2 := range neighbors[key] {
+				if n1 < n2 {
+					if _, linked := neighbors[n1][n2]; linked {
+						links++
+					}
+				}
+			}
+		}
+
+		total += float64(2*links) / float64(k*(k-1))
+	}
+
+	return total / float64(len(keys)), nil
+}
+
+// countComponents counts weakly connected components of the given vertices
+// using the undirected `neighbors` sets.
+func countComponents(ctx context.Context, keys []string, neighbors map[string]map[string]nothing) (int, error) {
+	visited := make(map[string]nothing, len(keys))
+	components := 0
+
+	for _, key := range keys {
+		if _, toSkip := visited[key]; toSkip {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, errors.Wrap(err, "failed to count components")
+		}
+
+		components++
+		visited[key] = nothing{}
+		queue := []string{key}
+		for len(queue) != 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for n := range neighbors[current] {
+				if _, toSkip := visited[n]; toSkip {
+					continue
+				}
+				visited[n] = nothing{}
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	return components, nil
+}
+
+// averagePathLength computes the average length of the shortest directed paths
+// from each of the `sources` to all vertices reachable from it.
+func averagePathLength(ctx context.Context, sources []string, adjacency map[string][]string) (float64, error) {
+	var (
+		total int
+		paths int
+	)
+
+	for _, source := range sources {
+		if err := ctx.Err(); err != nil {
+			return 0, errors.Wrap(err, "failed to compute average path length")
+		}
+
+		distances := map[string]int{source: 0}
+		queue := []string{source}
+		for len(queue) != 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, adjacentKey := range adjacency[current] {
+				if _, toSkip := distances[adjacentKey]; toSkip {
+					continue
+				}
+				distances[adjacentKey] = distances[current] + 1
+				total += distances[adjacentKey]
+				paths++
+				queue = append(queue, adjacentKey)
+			}
+		}
+	}
+
+	if paths == 0 {
+		return 0, nil
+	}
+
+	return float64(total) / float64(paths), nil
+}
@@ -0,0 +1,72 @@
+package lww
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyStats(t *testing.T) {
+	v1 := Vertex{Key: "vertex1", Value: "value1"}
+	v2 := Vertex{Key: "vertex2", Value: "value2"}
+	v3 := Vertex{Key: "vertex3", Value: "value3"}
+	v4 := Vertex{Key: "vertex4", Value: "value4"}
+	v5 := Vertex{Key: "vertex5", Value: "value5"}
+
+	// v1---->v2
+	//  ^     |
+	//  |     v
+	//  +-----v3---->v5 (removed)
+	//
+	// v4 (isolated)
+	g := NewGraph(testReplica)
+	for _, v := range []Vertex{v1, v2, v3, v4, v5} {
+		require.NoError(t, g.AddVertex(v))
+	}
+	require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+	require.NoError(t, g.AddEdge(v2.Key, v3.Key))
+	require.NoError(t, g.AddEdge(v3.Key, v1.Key))
+	require.NoError(t, g.AddEdge(v3.Key, v5.Key))
+	require.NoError(t, g.RemoveVertex(v5.Key))
+
+	t.Run("computes metrics of the whole graph", func(t *testing.T) {
+		stats, err := g.TopologyStats(context.Background(), 0)
+		require.NoError(t, err)
+
+		require.Equal(t, 4, stats.Vertices)
+		require.Equal(t, 3, stats.Edges, "hanging edges must not be counted")
+		require.Equal(t, map[int]int{0: 1, 1: 3}, stats.OutDegrees)
+		require.Equal(t, map[int]int{0: 1, 1: 3}, stats.InDegrees)
+		require.Equal(t, 2, stats.Components)
+		require.Equal(t, 1, stats.IsolatedVertices)
+		require.Equal(t, 4, stats.PathSamples)
+		// every vertex in the cycle reaches 2 others with distances 1 and 2
+		require.InDelta(t, 1.5, stats.AveragePathLength, 0.0001)
+		// 3 vertices in a triangle have the coefficient of 1, the isolated one has 0
+		require.InDelta(t, 0.75, stats.ClusteringCoefficient, 0.0001)
+	})
+
+	t.Run("limits the number of path samples", func(t *testing.T) {
+		stats, err := g.TopologyStats(context.Background(), 2)
+		require.NoError(t, err)
+		require.Equal(t, 2, stats.PathSamples)
+	})
+
+	t.Run("returns zero metrics for an empty graph", func(t *testing.T) {
+		stats, err := NewGraph(testReplica).TopologyStats(context.Background(), 0)
+		require.NoError(t, err)
+		require.Equal(t, 0, stats.Vertices)
+		require.Equal(t, 0, stats.Components)
+		require.Equal(t, float64(0), stats.AveragePathLength)
+		require.Equal(t, float64(0), stats.ClusteringCoefficient)
+	})
+
+	t.Run("returns the context error when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := g.TopologyStats(ctx, 0)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
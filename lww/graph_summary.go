@@ -0,0 +1,287 @@
+package lww
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidMaxNodes occurs when the requested number of summary nodes is less than 1
+	ErrInvalidMaxNodes = errors.New("max nodes must be at least 1")
+)
+
+// Summary is a contracted overview of the graph where groups of vertices are replaced by cluster supernodes.
+// It's used for rendering huge graphs in a UI without exporting all the vertices.
+type Summary struct {
+	// Clusters contains all the clusters sorted by their keys
+	Clusters []Cluster `json:"clusters"`
+	// Edges contains the edges between different clusters sorted by their keys
+	Edges []ClusterEdge `json:"edges"`
+}
+
+// Cluster is a supernode of the summary representing a group of vertices
+type Cluster struct {
+	// Key is the smallest key of the vertices in the cluster, it identifies the cluster
+	Key string `json:"key"`
+	// Size is the number of vertices in the cluster
+	Size int `json:"size"`
+	// InternalEdges is the number of edges between the vertices within the cluster
+	InternalEdges int `json:"internalEdges"`
+}
+
+// ClusterEdge is an edge between two clusters of the summary
+type ClusterEdge struct {
+	// From is the key of the cluster the edges start from
+	From string `json:"from"`
+	// To is the key of the cluster the edges point to
+	To string `json:"to"`
+	// Count is the number of the graph edges between the vertices of these clusters
+	Count int `json:"count"`
+}
+
+// Summarize contracts the graph into at most `maxNodes` clusters of vertices.
+//
+// Connected vertices are grouped together first, so clusters follow the graph structure
+// and have roughly the same size. When the graph has more weakly connected components than `maxNodes`,
+// the smallest clusters are combined regardless of the connectivity.
+// The result is deterministic for the same graph state.
+//
+// Returns an error with `ErrInvalidMaxNodes` cause if `maxNodes` is less than 1.
+func (g Graph) Summarize(maxNodes int) (summary Summary, err error) {
+	if maxNodes < 1 {
+		return summary, errors.Wrapf(ErrInvalidMaxNodes, "got %d", maxNodes)
+	}
+
+	g.mutex.RLock()
+	adjacency := g.adjacencySnapshot()
+	g.mutex.RUnlock()
+
+	keys := make([]string, 0, len(adjacency))
+	for key := range adjacency {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	clusters := newUnionFind(keys)
+
+	// growing clusters along the edges, the size cap makes them balanced
+	// and it's doubled until the number of clusters fits
+	edges := rankEdges(keys, adjacency)
+	for limit := ceilDiv(len(keys), maxNodes); clusters.count > maxNodes && limit <= 2*len(keys); limit *= 2 {
+		for _, edge := range edges {
+			if clusters.count <= maxNodes {
+				break
+			}
+			clusters.union(edge[0], edge[1], limit)
+		}
+	}
+
+	// combining disconnected clusters, the smallest first
+	if clusters.count > maxNodes {
+		smallest := &clusterHeap{uf: clusters, roots: clusters.roots()}
+		heap.Init(smallest)
+		for clusters.count > maxNodes {
+			a, b := smallest.popRoot(), smallest.popRoot()
+			clusters.union(a, b, len(keys))
+			heap.Push(smallest, clusters.find(a))
+		}
+	}
+
+	byRoot := make(map[string]*Cluster)
+	clusterEdges := make(map[[2]string]int)
+	for _, key := range keys {
+		root := clusters.find(key)
+		cluster, exists := byRoot[root]
+		if !exists {
+			// keys are sorted, so the first one is the smallest
+			cluster = &Cluster{Key: key}
+			byRoot[root] = cluster
+		}
+		cluster.Size++
+	}
+
+	for _, from := range keys {
+		fromCluster := byRoot[clusters.find(from)]
+		for _, to := range adjacency[from] {
+			toCluster := byRoot[clusters.find(to)]
+			if fromCluster == toCluster {
+				fromCluster.InternalEdges++
+				continue
+			}
+			clusterEdges[[2]string{fromCluster.Key, toCluster.Key}]++
+		}
+	}
+
+	summary.Clusters = make([]Cluster, 0, len(byRoot))
+	for _, cluster := range byRoot {
+		summary.Clusters = append(summary.Clusters, *cluster)
+	}
+	sort.Slice(summary.Clusters, func(i, j int) bool {
+		return summary.Clusters[i].Key < summary.Clusters[j].Key
+	})
+
+	summary.Edges = make([]ClusterEdge, 0, len(clusterEdges))
+	for edge, count := range clusterEdges {
+		summary.Edges = append(summary.Edges, ClusterEdge{From: edge[0], To: edge[1], Count: count})
+	}
+	sort.Slice(summary.Edges, func(i, j int) bool {
+		if summary.Edges[i].From != summary.Edges[j].From {
+			return summary.Edges[i].From < summary.Edges[j].From
+		}
+		return summary.Edges[i].To < summary.Edges[j].To
+	})
+
+	return summary, nil
+}
+
+// rankEdges returns all the edges ignoring their directions ordered by the number of common neighbors
+// of their vertices, so vertices in densely connected regions are clustered first and bridges last.
+func rankEdges(keys []string, adjacency map[string][]string) [][2]string {
+	neighbors := make(map[string]map[string]nothing, len(keys))
+	for _, key := range keys {
+		neighbors[key] = make(map[string]nothing)
+	}
+	for _, from := range keys {
+		for _, to := range adjacency[from] {
+			if from == to {
+				continue
+			}
+			neighbors[from][to] = nothing{}
+			neighbors[to][from] = nothing{}
+		}
+	}
+
+	edges := make([][2]string, 0, len(keys))
+	common := make(map[[2]string]int)
+	for _, from := range keys {
+		for to := range neighbors[from] {
+			if from > to {
+				continue
+			}
+			edge := [2]string{from, to}
+			a, b := neighbors[from], neighbors[to]
+			if len(a) > len(b) {
+				a, b = b, a
+			}
+			for n := range a {
+				if _, shared := b[n]; shared {
+					common[edge]++
+				}
+			}
+			edges = append(edges, edge)
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if common[edges[i]] != common[edges[j]] {
+			return common[edges[i]] > common[edges[j]]
+		}
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+
+	return edges
+}
+
+// unionFind is a disjoint-set of vertex keys used for clustering
+type unionFind struct {
+	parent map[string]string
+	size   map[string]int
+	count  int
+}
+
+func newUnionFind(keys []string) *unionFind {
+	uf := &unionFind{
+		parent: make(map[string]string, len(keys)),
+		size:   make(map[string]int, len(keys)),
+		count:  len(keys),
+	}
+	for _, key := range keys {
+		uf.parent[key] = key
+		uf.size[key] = 1
+	}
+	return uf
+}
+
+// find returns the root key of the set the key belongs to
+func (uf *unionFind) find(key string) string {
+	for uf.parent[key] != key {
+		// path halving
+		uf.parent[key] = uf.parent[uf.parent[key]]
+		key = uf.parent[key]
+	}
+	return key
+}
+
+// union joins the sets of both keys unless the joined set would be larger than `limit`
+func (uf *unionFind) union(a, b string, limit int) {
+	a, b = uf.find(a), uf.find(b)
+	if a == b || uf.size[a]+uf.size[b] > limit {
+		return
+	}
+	if uf.size[a] < uf.size[b] || (uf.size[a] == uf.size[b] && b < a) {
+		a, b = b, a
+	}
+	uf.parent[b] = a
+	uf.size[a] += uf.size[b]
+	uf.count--
+}
+
+// roots returns the root keys of all the sets
+func (uf *unionFind) roots() []string {
+	roots := make([]string, 0, uf.count)
+	for key, parent := range uf.parent {
+		if key == parent {
+			roots = append(roots, key)
+		}
+	}
+	return roots
+}
+
+// clusterHeap is a min-heap of cluster roots ordered by the cluster size and the root key
+type clusterHeap struct {
+	uf    *unionFind
+	roots []string
+}
+
+func (h clusterHeap) Len() int {
+	return len(h.roots)
+}
+
+func (h clusterHeap) Less(i, j int) bool {
+	a, b := h.roots[i], h.roots[j]
+	if h.uf.size[a] != h.uf.size[b] {
+		return h.uf.size[a] < h.uf.size[b]
+	}
+	return a < b
+}
+
+func (h clusterHeap) Swap(i, j int) {
+	h.roots[i], h.roots[j] = h.roots[j], h.roots[i]
+}
+
+func (h *clusterHeap) Push(x interface{}) {
+	root, _ := x.(string)
+	h.roots = append(h.roots, root)
+}
+
+func (h *clusterHeap) Pop() interface{} {
+	last := h.roots[len(h.roots)-1]
+	h.roots = h.roots[:len(h.roots)-1]
+	return last
+}
+
+// popRoot removes the root of the smallest cluster from the heap and returns it
+func (h *clusterHeap) popRoot() string {
+	root, _ := heap.Pop(h).(string)
+	return root
+}
+
+// ceilDiv returns `a / b` rounded up
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
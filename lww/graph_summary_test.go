@@ -0,0 +1,97 @@
+package lww
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	// two triangles connected by a single edge, an isolated vertex and a removed one
+	//
+	// a1-->a2-->a3-->a1---->b1-->b2-->b3-->b1   c1   d1 (removed)
+	g := NewGraph(testReplica)
+	for _, key := range []string{"a1", "a2", "a3", "b1", "b2", "b3", "c1", "d1"} {
+		require.NoError(t, g.AddVertex(Vertex{Key: key, Value: key}))
+	}
+	for _, edge := range [][2]string{
+		{"a1", "a2"}, {"a2", "a3"}, {"a3", "a1"},
+		{"b1", "b2"}, {"b2", "b3"}, {"b3", "b1"},
+		{"a1", "b1"}, {"c1", "d1"},
+	} {
+		require.NoError(t, g.AddEdge(edge[0], edge[1]))
+	}
+	require.NoError(t, g.RemoveVertex("d1"))
+
+	t.Run("keeps every vertex when it fits", func(t *testing.T) {
+		summary, err := g.Summarize(10)
+		require.NoError(t, err)
+		require.Len(t, summary.Clusters, 7)
+		require.Len(t, summary.Edges, 7, "hanging edges must be omitted")
+		require.Contains(t, summary.Edges, ClusterEdge{From: "a1", To: "b1", Count: 1})
+	})
+
+	t.Run("groups connected vertices into clusters", func(t *testing.T) {
+		summary, err := g.Summarize(3)
+		require.NoError(t, err)
+		require.Equal(t, Summary{
+			Clusters: []Cluster{
+				{Key: "a1", Size: 3, InternalEdges: 3},
+				{Key: "b1", Size: 3, InternalEdges: 3},
+				{Key: "c1", Size: 1},
+			},
+			Edges: []ClusterEdge{
+				{From: "a1", To: "b1", Count: 1},
+			},
+		}, summary)
+	})
+
+	t.Run("combines disconnected clusters when needed", func(t *testing.T) {
+		summary, err := g.Summarize(1)
+		require.NoError(t, err)
+		require.Equal(t, Summary{
+			Clusters: []Cluster{{Key: "a1", Size: 7, InternalEdges: 7}},
+			Edges:    []ClusterEdge{},
+		}, summary)
+
+		summary, err = g.Summarize(2)
+		require.NoError(t, err)
+		require.Len(t, summary.Clusters, 2)
+		total := 0
+		for _, c := range summary.Clusters {
+			total += c.Size
+		}
+		require.Equal(t, 7, total)
+	})
+
+	t.Run("summarizes large graphs into the requested number of nodes", func(t *testing.T) {
+		large := NewGraph(testReplica)
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, large.AddVertex(Vertex{Key: fmt.Sprintf("vertex%04d", i)}))
+			if i > 0 && i%10 != 0 {
+				require.NoError(t, large.AddEdge(fmt.Sprintf("vertex%04d", i-1), fmt.Sprintf("vertex%04d", i)))
+			}
+		}
+
+		summary, err := large.Summarize(50)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(summary.Clusters), 50)
+
+		vertices, edges := 0, 0
+		for _, c := range summary.Clusters {
+			vertices += c.Size
+			edges += c.InternalEdges
+		}
+		for _, e := range summary.Edges {
+			edges += e.Count
+		}
+		require.Equal(t, 1000, vertices)
+		require.Equal(t, 900, edges)
+	})
+
+	t.Run("returns ErrInvalidMaxNodes for less than 1 node", func(t *testing.T) {
+		_, err := g.Summarize(0)
+		require.ErrorIs(t, err, ErrInvalidMaxNodes)
+	})
+}
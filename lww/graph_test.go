@@ -1,8 +1,13 @@
 package lww
 
 import (
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -23,9 +28,9 @@ func TestGraph(t *testing.T) {
 				// B------AddVertex(v2),AddVertex(v3),AddEdge(v2, v3)-\--|=> A,B,C = {v1, v2->v3, v4}
 				// C------------------------------------AddVertex(v4)--\-|
 
-				A := NewGraph()
-				B := NewGraph()
-				C := NewGraph()
+				A := NewGraph(testReplica)
+				B := NewGraph(testReplica)
+				C := NewGraph(testReplica)
 
 				err := A.AddVertex(v1)
 				require.NoError(t, err)
@@ -68,9 +73,9 @@ func TestGraph(t *testing.T) {
 				// B-----------------\-AddVertex(v2),AddEdge(v1, v2)--\-\--\|=> A,B,C = {v1->v2}
 				// C---------------------------AddVertex(v1)-------------\--|
 
-				A := NewGraph()
-				B := NewGraph()
-				C := NewGraph()
+				A := NewGraph(testReplica)
+				B := NewGraph(testReplica)
+				C := NewGraph(testReplica)
 
 				err := A.AddVertex(v1)
 				require.NoError(t, err)
@@ -123,8 +128,8 @@ func TestGraph(t *testing.T) {
 				// Time ->
 				// A--AddVertex(v1)--------------------RemoveVertex(v1)--------\---|
 				// B------AddVertex(v1),AddVertex(v2)----------AddEdge(v1, v2)--\--|=> A,B = {v2}
-				A := NewGraph()
-				B := NewGraph()
+				A := NewGraph(testReplica)
+				B := NewGraph(testReplica)
 
 				err := A.AddVertex(v1)
 				require.NoError(t, err)
@@ -169,7 +174,7 @@ func TestGraph(t *testing.T) {
 			}
 
 			t.Run("retreives an added vertex", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				err := g.AddVertex(vertex)
 				require.NoError(t, err)
@@ -180,7 +185,7 @@ func TestGraph(t *testing.T) {
 			})
 
 			t.Run("returns ErrVertexAlreadyExists when adding the same vertex twice", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				err := g.AddVertex(vertex)
 				require.NoError(t, err)
@@ -189,7 +194,7 @@ func TestGraph(t *testing.T) {
 			})
 
 			t.Run("returns ErrVertexNotFound when retreiving a non-existing vertex", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				vertex, err := g.Lookup("non-existing")
 				require.ErrorIs(t, err, ErrVertexNotFound)
@@ -197,7 +202,7 @@ func TestGraph(t *testing.T) {
 			})
 
 			t.Run("returns ErrVertexNotFound on lookup after removing a vertex", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				err := g.AddVertex(vertex)
 				require.NoError(t, err)
@@ -211,11 +216,29 @@ func TestGraph(t *testing.T) {
 			})
 
 			t.Run("returns ErrVertexNotFound when removing a non-existing vertex", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				err := g.RemoveVertex("non-existing")
 				require.ErrorIs(t, err, ErrVertexNotFound)
 			})
+
+			t.Run("returns ErrLimitExceeded when adding more vertices than allowed", func(t *testing.T) {
+				r := crdt.NewReplica("limited")
+				r.Limits.MaxElements = 1
+				g := NewGraph(r)
+
+				err := g.AddVertex(vertex)
+				require.NoError(t, err)
+
+				other := Vertex{Key: "other"}
+				err = g.AddVertex(other)
+				require.ErrorIs(t, err, crdt.ErrLimitExceeded)
+
+				err = g.RemoveVertex(vertex.Key)
+				require.NoError(t, err)
+				err = g.AddVertex(other)
+				require.NoError(t, err, "removed vertices are not counted")
+			})
 		})
 
 		t.Run("Edges", func(t *testing.T) {
@@ -236,7 +259,7 @@ func TestGraph(t *testing.T) {
 				// v3 is connected to v5
 				// v4 is connected to v3, v5
 				// v5 is not connected
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				t.Run("adding vertices", func(t *testing.T) {
 					err := g.AddVertex(v1)
@@ -491,7 +514,7 @@ func TestGraph(t *testing.T) {
 			})
 
 			t.Run("returns a vertex which is connected to itself", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				err := g.AddVertex(v1)
 				require.NoError(t, err)
@@ -518,7 +541,7 @@ func TestGraph(t *testing.T) {
 				// * v1<->v2
 				// * v1->v2->v3->v4->v1
 				// * v3<->v3
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				t.Run("adding vertices", func(t *testing.T) {
 					err := g.AddVertex(v1)
@@ -691,7 +714,7 @@ func TestGraph(t *testing.T) {
 			})
 
 			t.Run("returns ErrVertexNotFound creating an edge for non-existing vertices", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 				err := g.AddVertex(v1)
 				require.NoError(t, err)
 
@@ -703,14 +726,14 @@ func TestGraph(t *testing.T) {
 			})
 
 			t.Run("returns ErrVertexNotFound when searching connections of a non-existing vertex", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 				connected, err := g.FindConnected("non-existing")
 				require.ErrorIs(t, err, ErrVertexNotFound)
 				require.Nil(t, connected)
 			})
 
 			t.Run("returns ErrVertexNotFound finding a path for non-existing vertices", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 				err := g.AddVertex(v1)
 				require.NoError(t, err)
 
@@ -743,7 +766,7 @@ func TestGraph(t *testing.T) {
 				// v3 returns ErrVertexNotFound
 				// v4 is not connected
 				// v5 is not connected
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				t.Run("adding vertices", func(t *testing.T) {
 					err := g.AddVertex(v1)
@@ -877,7 +900,7 @@ func TestGraph(t *testing.T) {
 				// v3 is connected to v5
 				// v4 is connected to v3 and v5
 				// v5 is not connected
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				// vertices
 				err := g.AddVertex(v1)
@@ -934,7 +957,7 @@ func TestGraph(t *testing.T) {
 			})
 
 			t.Run("returns ErrVertexNotFound when removing an edge of non-existing vertices", func(t *testing.T) {
-				g := NewGraph()
+				g := NewGraph(testReplica)
 
 				err := g.AddVertex(v1)
 				require.NoError(t, err)
@@ -960,3 +983,324 @@ func TestGraph(t *testing.T) {
 		})
 	})
 }
+
+func TestUpdateVertex(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	ticking := func(id string, offset time.Duration) crdt.Replica {
+		tick := base.Add(offset)
+		return crdt.Replica{ID: id, Clock: clock.Func(func() time.Time {
+			tick = tick.Add(time.Second)
+			return tick
+		})}
+	}
+
+	t.Run("replaces the value and keeps the edges", func(t *testing.T) {
+		g := NewGraph(ticking("A", 0))
+		require.NoError(t, g.AddVertex(Vertex{Key: "v1", Value: "old"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, g.AddEdge("v1", "v2"))
+
+		require.NoError(t, g.UpdateVertex(Vertex{Key: "v1", Value: "new"}))
+		list, err := g.List()
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: Vertex{Key: "v1", Value: "new"}, AdjacentKeys: []string{"v2"}},
+			{Vertex: Vertex{Key: "v2"}, AdjacentKeys: []string{}},
+		}, list)
+
+		err = g.UpdateVertex(Vertex{Key: "v3"})
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("upserts new and existing vertices", func(t *testing.T) {
+		g := NewGraph(ticking("A", 0))
+		require.NoError(t, g.UpsertVertex(Vertex{Key: "v1", Value: "first"}))
+		require.NoError(t, g.UpsertVertex(Vertex{Key: "v1", Value: "second"}))
+		v, err := g.Lookup("v1")
+		require.NoError(t, err)
+		require.Equal(t, "second", v.Value)
+
+		limited := NewGraph(crdt.Replica{ID: "A", Limits: crdt.Limits{MaxElements: 1}})
+		require.NoError(t, limited.UpsertVertex(Vertex{Key: "v1"}))
+		require.NoError(t, limited.UpsertVertex(Vertex{Key: "v1", Value: "updated"}), "updates are not limited")
+		err = limited.UpsertVertex(Vertex{Key: "v2"})
+		require.ErrorIs(t, err, crdt.ErrLimitExceeded)
+	})
+
+	t.Run("concurrent updates converge to the latest write", func(t *testing.T) {
+		a := NewGraph(ticking("A", 0))
+		b := NewGraph(ticking("B", time.Minute))
+		c := NewGraph(ticking("C", 0))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "initial"}))
+		replicateGraphs(a, b, c)
+
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "v1", Value: "from B"}))
+		require.NoError(t, a.UpdateVertex(Vertex{Key: "v1", Value: "from A"}))
+		require.NoError(t, c.UpdateVertex(Vertex{Key: "v1", Value: "from C"}))
+		replicateGraphs(a, b, c)
+
+		for _, g := range []Graph{a, b, c} {
+			v, err := g.Lookup("v1")
+			require.NoError(t, err)
+			require.Equal(t, "from B", v.Value)
+		}
+	})
+
+	t.Run("writes in the same clock tick converge in any merge order", func(t *testing.T) {
+		// the wall clock does not move between the writes, like with a coarse system clock
+		stuck := clock.NewMonotonic(clock.Func(func() time.Time { return base }), clock.MonotonicBump)
+		a := NewGraph(crdt.Replica{ID: "A", Clock: stuck})
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "first"}))
+		added := NewGraph(crdt.NewReplica("snapshot"))
+		added.Merge(a)
+		require.NoError(t, a.UpdateVertex(Vertex{Key: "v1", Value: "second"}))
+
+		b := NewGraph(crdt.NewReplica("B"))
+		b.Merge(added)
+		b.Merge(a)
+		c := NewGraph(crdt.NewReplica("C"))
+		c.Merge(a)
+		c.Merge(added)
+
+		for _, g := range []Graph{b, c} {
+			v, err := g.Lookup("v1")
+			require.NoError(t, err)
+			require.Equal(t, "second", v.Value)
+		}
+		equal, err := b.StateEquals(c)
+		require.NoError(t, err)
+		require.True(t, equal)
+	})
+}
+
+func TestGraphOrder(t *testing.T) {
+	// star returns a graph where the root is connected to every leaf and every leaf is connected to the target
+	star := func(t *testing.T, r crdt.Replica, leaves []string) Graph {
+		g := NewGraph(r)
+		require.NoError(t, g.AddVertex(Vertex{Key: "root"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "target"}))
+		for _, leaf := range leaves {
+			require.NoError(t, g.AddVertex(Vertex{Key: leaf}))
+			require.NoError(t, g.AddEdge("root", leaf))
+			require.NoError(t, g.AddEdge(leaf, "target"))
+		}
+		return g
+	}
+	leaves := []string{"l5", "l3", "l1", "l4", "l2", "l6", "l8", "l7"}
+
+	t.Run("traversals are reproducible with OrderSorted", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			g := star(t, crdt.Replica{ID: "A", Order: crdt.OrderSorted}, leaves)
+
+			connected, err := g.FindConnected("root")
+			require.NoError(t, err)
+			require.Equal(t, []Vertex{
+				{Key: "l1"}, {Key: "l2"}, {Key: "l3"}, {Key: "l4"},
+				{Key: "l5"}, {Key: "l6"}, {Key: "l7"}, {Key: "l8"}, {Key: "target"},
+			}, connected)
+
+			path, err := g.FindPath("root", "target")
+			require.NoError(t, err)
+			require.Equal(t, []Vertex{{Key: "root"}, {Key: "l1"}, {Key: "target"}}, path)
+		}
+	})
+
+	t.Run("traversals follow the insertion order with OrderInsertion", func(t *testing.T) {
+		tick := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+		r := crdt.Replica{ID: "A", Order: crdt.OrderInsertion, Clock: clock.Func(func() time.Time {
+			tick = tick.Add(time.Millisecond)
+			return tick
+		})}
+
+		for i := 0; i < 10; i++ {
+			g := star(t, r, leaves)
+			path, err := g.FindPath("root", "target")
+			require.NoError(t, err)
+			require.Equal(t, []Vertex{{Key: "root"}, {Key: "l5"}, {Key: "target"}}, path)
+		}
+	})
+}
+
+func TestGraphConcurrentReads(t *testing.T) {
+	g := NewGraph(crdt.Replica{ID: "test"})
+	require.NoError(t, g.AddVertex(Vertex{Key: "v1"}))
+	require.NoError(t, g.AddVertex(Vertex{Key: "v2"}))
+	require.NoError(t, g.AddEdge("v1", "v2"))
+
+	t.Run("reads do not wait for each other", func(t *testing.T) {
+		// simulating a long reader
+		g.mutex.RLock()
+		defer g.mutex.RUnlock()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = g.Lookup("v1")
+			_, _ = g.List()
+			_, _ = g.FindPath("v1", "v2")
+			_, _ = g.FindConnected("v1")
+			_, _ = g.EdgeWeight("v1", "v2")
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "reads were blocked by another reader")
+		}
+	})
+
+	t.Run("reads of edges never added do not change the graph", func(t *testing.T) {
+		_, err := g.FindConnected("v2")
+		require.NoError(t, err)
+		_, err = g.EdgeWeight("v2", "v1")
+		require.ErrorIs(t, err, ErrEdgeNotFound)
+
+		require.Len(t, g.edges, 1)
+		require.Empty(t, g.weights)
+	})
+}
+
+func TestGraphMonotonicClock(t *testing.T) {
+	now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	r := crdt.Replica{
+		ID:    "test",
+		Clock: clock.NewMonotonic(clock.Func(func() time.Time { return now }), clock.MonotonicReject),
+	}
+	g := NewGraph(r)
+	s := NewSet(r)
+
+	require.NoError(t, g.AddVertex(Vertex{Key: "v1", Value: "before"}))
+	require.NoError(t, g.AddVertex(Vertex{Key: "v2"}))
+	now = now.Add(time.Second)
+	require.NoError(t, g.AddEdge("v2", "v1"))
+	observed := g.ObserveVertex("v1").Version
+
+	// NTP steps the wall clock back
+	now = now.Add(-time.Minute)
+
+	t.Run("rejects graph writes while the clock is behind", func(t *testing.T) {
+		for name, write := range map[string]func() error{
+			"AddVertex":    func() error { return g.AddVertex(Vertex{Key: "v3"}) },
+			"UpdateVertex": func() error { return g.UpdateVertex(Vertex{Key: "v1", Value: "after"}) },
+			"UpsertVertex": func() error { return g.UpsertVertex(Vertex{Key: "v1", Value: "after"}) },
+			"RemoveVertex": func() error { return g.RemoveVertex("v2") },
+			"AddEdge":      func() error { return g.AddEdge("v1", "v2") },
+			"RemoveEdge":   func() error { return g.RemoveEdge("v1", "v2") },
+			"Update":       func() error { return g.Update(func(tx Tx) error { return nil }) },
+			"UpdateEdgeAttributes": func() error {
+				return g.UpdateEdgeAttributes("v2", "v1", map[string]string{"color": "red"})
+			},
+			"UpdateEdgeWeight": func() error { return g.UpdateEdgeWeight("v2", "v1", 5) },
+			"AddEdgeWeight":    func() error { return g.AddEdgeWeight("v2", "v1", 5) },
+			"AddEdgeAcyclic":   func() error { return g.AddEdgeAcyclic("v1", "v3") },
+			"CompareAndAddVertex": func() error {
+				_, err := g.CompareAndAddVertex(Vertex{Key: "v1", Value: "after"}, observed)
+				return err
+			},
+			"CompareAndRemoveVertex": func() error {
+				_, err := g.CompareAndRemoveVertex("v1", observed)
+				return err
+			},
+		} {
+			require.ErrorIs(t, write(), clock.ErrBackwards, name)
+		}
+
+		v, err := g.Lookup("v1")
+		require.NoError(t, err)
+		require.Equal(t, "before", v.Value)
+		_, err = g.Lookup("v3")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		edge, err := g.GetEdge("v2", "v1")
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: "v1"}, edge)
+		weight, err := g.EdgeWeight("v2", "v1")
+		require.NoError(t, err)
+		require.Zero(t, weight)
+	})
+
+	t.Run("set writes get bumped timestamps", func(t *testing.T) {
+		s.Add(IDElement("e1"))
+		s.Remove("e1")
+		_, err := s.Lookup("e1")
+		require.ErrorIs(t, err, ErrElementNotFound, "the removal wins over the addition")
+	})
+
+	t.Run("accepts writes once the clock catches up", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		require.NoError(t, g.UpdateVertex(Vertex{Key: "v1", Value: "after"}))
+		v, err := g.Lookup("v1")
+		require.NoError(t, err)
+		require.Equal(t, "after", v.Value)
+	})
+}
+
+// benchmarkGraph returns a graph of `size` vertices where every vertex has an edge to the next one
+func benchmarkGraph(b *testing.B, size int) Graph {
+	g := NewGraph(crdt.Replica{ID: "bench"})
+	for i := 0; i < size; i++ {
+		require.NoError(b, g.AddVertex(Vertex{Key: fmt.Sprintf("v%d", i)}))
+	}
+	for i := 1; i < size; i++ {
+		require.NoError(b, g.AddEdge(fmt.Sprintf("v%d", i-1), fmt.Sprintf("v%d", i)))
+	}
+	return g
+}
+
+// BenchmarkGraphReads compares concurrent reads with reads serialized by an exclusive lock,
+// the way they were before the graph used a read-write lock.
+// The difference grows with the number of CPUs (see `-cpu`).
+func BenchmarkGraphReads(b *testing.B) {
+	const size = 64
+	g := benchmarkGraph(b, size)
+	last := fmt.Sprintf("v%d", size-1)
+
+	reads := []struct {
+		name string
+		read func()
+	}{
+		{name: "Lookup", read: func() { _, _ = g.Lookup(last) }},
+		{name: "List", read: func() { _, _ = g.List() }},
+		{name: "FindPath", read: func() { _, _ = g.FindPath("v0", last) }},
+		{name: "FindConnected", read: func() { _, _ = g.FindConnected("v0") }},
+	}
+
+	for _, r := range reads {
+		read := r.read
+		b.Run(r.name+"/shared", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					read()
+				}
+			})
+		})
+		b.Run(r.name+"/exclusive", func(b *testing.B) {
+			exclusive := &sync.Mutex{}
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					exclusive.Lock()
+					read()
+					exclusive.Unlock()
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkGraphMixed measures a read-heavy workload with one write per 100 operations
+func BenchmarkGraphMixed(b *testing.B) {
+	const size = 64
+	g := benchmarkGraph(b, size)
+	last := fmt.Sprintf("v%d", size-1)
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			if i%100 == 0 {
+				_ = g.AddEdgeWeight("v0", "v1", 1)
+				continue
+			}
+			_, _ = g.FindPath("v0", last)
+		}
+	})
+}
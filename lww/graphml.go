@@ -0,0 +1,242 @@
+package lww
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// graphMLNamespace is the XML namespace of GraphML documents
+	graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+	// graphMLValue is the name of the node data containing the vertex value
+	graphMLValue = "value"
+	// graphMLWeight is the name of the edge data containing the edge weight
+	graphMLWeight = "weight"
+	// graphMLLabel is the name of the edge data containing the edge label
+	graphMLLabel = "label"
+)
+
+// graphMLDocument is the subset of GraphML the graph can be exported to and imported from
+type graphMLDocument struct {
+	XMLName xml.Name       `xml:"graphml"`
+	Xmlns   string         `xml:"xmlns,attr,omitempty"`
+	Keys    []graphMLKey   `xml:"key"`
+	Graphs  []graphMLGraph `xml:"graph"`
+}
+
+// graphMLKey declares a data attribute of nodes or edges
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr,omitempty"`
+	Type string `xml:"attr.type,attr,omitempty"`
+}
+
+// graphMLGraph contains the nodes and the edges
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr,omitempty"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+// graphMLNode is a vertex
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+// graphMLEdge is an edge
+type graphMLEdge struct {
+	Source   string        `xml:"source,attr"`
+	Target   string        `xml:"target,attr"`
+	Directed string        `xml:"directed,attr,omitempty"`
+	Data     []graphMLData `xml:"data"`
+}
+
+// graphMLData is a value of a declared data attribute
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ExportGraphML writes the vertices and the edges of the graph as a directed GraphML document
+// for standard graph tooling (e.g. Gephi, yEd, NetworkX). Vertex values are written as the `value` node data,
+// edge weights, labels and attributes as the `weight`, `label` and the attribute-named edge data.
+// Attributes named `weight` and `label` are left out, they would be imported as the weight and the label.
+// Vertices and edges are written in the order of their keys, edges pointing to removed vertices are left out.
+func (g Graph) ExportGraphML(w io.Writer) error {
+	exported, err := g.export()
+	if err != nil {
+		return err
+	}
+
+	doc := graphMLDocument{
+		Xmlns: graphMLNamespace,
+		Keys: []graphMLKey{
+			{ID: graphMLValue, For: "node", Name: graphMLValue, Type: "string"},
+			{ID: graphMLWeight, For: "edge", Name: graphMLWeight, Type: "long"},
+			{ID: graphMLLabel, For: "edge", Name: graphMLLabel, Type: "string"},
+		},
+	}
+
+	// attribute names are declared as keys with generated IDs, so they can't clash with the reserved ones
+	attributeKeys := make(map[string]string)
+	for _, spec := range exported.edges {
+		for name := range spec.Edge.Attributes {
+			if name == graphMLWeight || name == graphMLLabel {
+				continue
+			}
+			attributeKeys[name] = ""
+		}
+	}
+	names := make([]string, 0, len(attributeKeys))
+	for name := range attributeKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		attributeKeys[name] = fmt.Sprintf("a%d", i)
+		doc.Keys = append(doc.Keys, graphMLKey{ID: attributeKeys[name], For: "edge", Name: name, Type: "string"})
+	}
+
+	graph := graphMLGraph{ID: "G", EdgeDefault: "directed"}
+	for _, v := range exported.vertices {
+		node := graphMLNode{ID: v.Key}
+		if v.Value != "" {
+			node.Data = []graphMLData{{Key: graphMLValue, Value: v.Value}}
+		}
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	for _, spec := range exported.edges {
+		edge := graphMLEdge{Source: spec.From, Target: spec.Edge.To}
+		if spec.Edge.Weight != 0 {
+			edge.Data = append(edge.Data, graphMLData{Key: graphMLWeight, Value: strconv.FormatInt(spec.Edge.Weight, 10)})
+		}
+		if spec.Edge.Label != "" {
+			edge.Data = append(edge.Data, graphMLData{Key: graphMLLabel, Value: spec.Edge.Label})
+		}
+		for _, name := range names {
+			if value, exists := spec.Edge.Attributes[name]; exists {
+				edge.Data = append(edge.Data, graphMLData{Key: attributeKeys[name], Value: value})
+			}
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+	doc.Graphs = []graphMLGraph{graph}
+
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString(xml.Header)
+	encoder := xml.NewEncoder(bw)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(doc)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the GraphML document")
+	}
+	_ = bw.WriteByte('\n')
+	err = bw.Flush()
+	if err != nil {
+		return errors.Wrap(err, "failed to write the GraphML document")
+	}
+	return nil
+}
+
+// ImportGraphML adds the nodes and the edges of a GraphML document with a single graph to the graph
+// as local operations in a single transaction, so either the whole document is imported or nothing.
+// Existing vertices are updated and existing edges are replaced.
+//
+// The node data named `value` becomes the vertex value, the edge data named `weight` and `label` become
+// the edge weight and label, any other edge data (including non-integer weights) becomes an edge attribute. Other node data, nested graphs,
+// hyperedges and ports are not supported and ignored. Undirected edges are imported as two directed edges.
+// Returns an error with `ErrInvalidGraphFile` cause if the document can't be parsed or represented by the graph
+// and an error with `ErrVertexNotFound` cause if an edge connects an unknown vertex.
+func (g Graph) ImportGraphML(r io.Reader) error {
+	var doc graphMLDocument
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidGraphFile, "failed to parse the GraphML document: %s", err)
+	}
+	if len(doc.Graphs) != 1 {
+		return errors.Wrapf(ErrInvalidGraphFile, "expected a single graph in the GraphML document, got %d", len(doc.Graphs))
+	}
+	graph := doc.Graphs[0]
+
+	// maps key IDs to the attribute names, the names default to the IDs
+	nodeKeys, edgeKeys := make(map[string]string), make(map[string]string)
+	for _, key := range doc.Keys {
+		name := key.Name
+		if name == "" {
+			name = key.ID
+		}
+		switch key.For {
+		case "node":
+			nodeKeys[key.ID] = name
+		case "edge":
+			edgeKeys[key.ID] = name
+		case "all", "":
+			nodeKeys[key.ID], edgeKeys[key.ID] = name, name
+		}
+	}
+
+	vertices := make([]Vertex, 0, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		if node.ID == "" {
+			return errors.Wrap(ErrInvalidGraphFile, "GraphML node without an ID")
+		}
+		v := Vertex{Key: node.ID}
+		for _, data := range node.Data {
+			if nodeKeys[data.Key] == graphMLValue {
+				v.Value = data.Value
+			}
+		}
+		vertices = append(vertices, v)
+	}
+
+	edges := make([]EdgeSpec, 0, len(graph.Edges))
+	for _, e := range graph.Edges {
+		edge := Edge{To: e.Target}
+		for _, data := range e.Data {
+			name, declared := edgeKeys[data.Key]
+			if !declared {
+				return errors.Wrapf(ErrInvalidGraphFile, "undeclared GraphML key %q", data.Key)
+			}
+			if name == graphMLWeight {
+				weight, err := strconv.ParseInt(strings.TrimSpace(data.Value), 10, 64)
+				if err == nil {
+					edge.Weight = weight
+					continue
+				}
+			}
+			switch name {
+			case graphMLLabel:
+				edge.Label = data.Value
+			default:
+				if edge.Attributes == nil {
+					edge.Attributes = make(map[string]string)
+				}
+				edge.Attributes[name] = data.Value
+			}
+		}
+		edges = append(edges, EdgeSpec{From: e.Source, Edge: edge})
+
+		directed := graph.EdgeDefault != "undirected"
+		if e.Directed != "" {
+			directed = e.Directed == "true"
+		}
+		if !directed && e.Source != e.Target {
+			reverse := edge.clone()
+			reverse.To = e.Source
+			edges = append(edges, EdgeSpec{From: e.Target, Edge: reverse})
+		}
+	}
+
+	return g.load(vertices, edges)
+}
@@ -0,0 +1,160 @@
+package lww
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+// newInterchangeGraph returns a graph with values, edge weights, labels, attributes and a hanging edge
+func newInterchangeGraph(t *testing.T) Graph {
+	g := NewGraph(crdt.NewReplica("A"))
+	require.NoError(t, g.AddVertex(Vertex{Key: "v1", Value: "first"}))
+	require.NoError(t, g.AddVertex(Vertex{Key: "v2", Value: "<second>"}))
+	require.NoError(t, g.AddVertex(Vertex{Key: "v3"}))
+	require.NoError(t, g.AddWeightedEdge("v1", Edge{To: "v2", Weight: 5, Label: "knows", Attributes: map[string]string{"since": "2020"}}))
+	require.NoError(t, g.AddEdge("v2", "v3"))
+	require.NoError(t, g.AddEdge("v1", "v3"))
+	require.NoError(t, g.AddVertex(Vertex{Key: "v4"}))
+	require.NoError(t, g.AddEdge("v3", "v4"))
+	require.NoError(t, g.RemoveVertex("v4"))
+	return g
+}
+
+// requireImported checks that the graph has the exported state of `newInterchangeGraph`
+func requireImported(t *testing.T, g Graph) {
+	list, err := g.List()
+	require.NoError(t, err)
+	require.Equal(t, []VertexWithEdges{
+		{Vertex: Vertex{Key: "v1", Value: "first"}, AdjacentKeys: []string{"v2", "v3"}},
+		{Vertex: Vertex{Key: "v2", Value: "<second>"}, AdjacentKeys: []string{"v3"}},
+		// the hanging edge is not exported
+		{Vertex: Vertex{Key: "v3"}, AdjacentKeys: []string{}},
+	}, list)
+
+	edge, err := g.GetEdge("v1", "v2")
+	require.NoError(t, err)
+	require.Equal(t, Edge{To: "v2", Weight: 5, Label: "knows", Attributes: map[string]string{"since": "2020"}}, edge)
+}
+
+func TestGraphML(t *testing.T) {
+	t.Run("exports the graph", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, newInterchangeGraph(t).ExportGraphML(&buf))
+		require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="value" for="node" attr.name="value" attr.type="string"></key>
+  <key id="weight" for="edge" attr.name="weight" attr.type="long"></key>
+  <key id="label" for="edge" attr.name="label" attr.type="string"></key>
+  <key id="a0" for="edge" attr.name="since" attr.type="string"></key>
+  <graph id="G" edgedefault="directed">
+    <node id="v1">
+      <data key="value">first</data>
+    </node>
+    <node id="v2">
+      <data key="value">&lt;second&gt;</data>
+    </node>
+    <node id="v3"></node>
+    <edge source="v1" target="v2">
+      <data key="weight">5</data>
+      <data key="label">knows</data>
+      <data key="a0">2020</data>
+    </edge>
+    <edge source="v1" target="v3"></edge>
+    <edge source="v2" target="v3"></edge>
+  </graph>
+</graphml>
+`, buf.String())
+	})
+
+	t.Run("imports an exported graph", func(t *testing.T) {
+		source := newInterchangeGraph(t)
+		var buf bytes.Buffer
+		require.NoError(t, source.ExportGraphML(&buf))
+
+		g := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, g.ImportGraphML(&buf))
+
+		requireImported(t, g)
+	})
+
+	t.Run("imports a GraphML document of other tools", func(t *testing.T) {
+		g := NewGraph(crdt.NewReplica("A"))
+		require.NoError(t, g.AddVertex(Vertex{Key: "n0", Value: "existing"}))
+
+		err := g.ImportGraphML(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="d0" for="node" attr.name="value" attr.type="string"/>
+  <key id="d1" for="node" attr.name="color" attr.type="string"/>
+  <key id="d2" for="edge" attr.name="weight" attr.type="double"/>
+  <key id="d3" for="edge" attr.name="kind" attr.type="string"/>
+  <graph id="G" edgedefault="undirected">
+    <node id="n0"><data key="d0">updated</data><data key="d1">red</data></node>
+    <node id="n1"/>
+    <node id="n2"/>
+    <edge source="n0" target="n1"><data key="d2">2</data></edge>
+    <edge source="n1" target="n2" directed="true"><data key="d2">1.5</data><data key="d3">road</data></edge>
+  </graph>
+</graphml>`))
+		require.NoError(t, err)
+
+		list, err := g.List()
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: Vertex{Key: "n0", Value: "updated"}, AdjacentKeys: []string{"n1"}},
+			{Vertex: Vertex{Key: "n1"}, AdjacentKeys: []string{"n0", "n2"}},
+			{Vertex: Vertex{Key: "n2"}, AdjacentKeys: []string{}},
+		}, list)
+
+		edge, err := g.GetEdge("n1", "n0")
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: "n0", Weight: 2}, edge)
+		edge, err = g.GetEdge("n1", "n2")
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: "n2", Attributes: map[string]string{"weight": "1.5", "kind": "road"}}, edge)
+	})
+
+	t.Run("fails on invalid documents", func(t *testing.T) {
+		cases := []struct {
+			name string
+			doc  string
+			err  error
+		}{
+			{
+				name: "not XML",
+				doc:  "{}",
+				err:  ErrInvalidGraphFile,
+			},
+			{
+				name: "no graph",
+				doc:  `<graphml></graphml>`,
+				err:  ErrInvalidGraphFile,
+			},
+			{
+				name: "undeclared key",
+				doc:  `<graphml><graph><node id="a"/><edge source="a" target="a"><data key="x">1</data></edge></graph></graphml>`,
+				err:  ErrInvalidGraphFile,
+			},
+			{
+				name: "unknown vertex",
+				doc:  `<graphml><graph><node id="a"/><edge source="a" target="b"/></graph></graphml>`,
+				err:  ErrVertexNotFound,
+			},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewGraph(crdt.NewReplica("A"))
+				err := g.ImportGraphML(strings.NewReader(tc.doc))
+				require.ErrorIs(t, err, tc.err)
+
+				list, err := g.List()
+				require.NoError(t, err)
+				require.Empty(t, list, "nothing is imported")
+			})
+		}
+	})
+}
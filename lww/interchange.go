@@ -0,0 +1,84 @@
+package lww
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidGraphFile occurs when an imported GraphML or JSON Graph Format document can't be loaded into the graph
+	ErrInvalidGraphFile = errors.New("invalid graph file")
+)
+
+// exportedGraph is the observable state of a graph written by the exporters
+type exportedGraph struct {
+	// vertices are sorted by key
+	vertices []Vertex
+	// edges are sorted by the keys of the vertices they connect, hanging edges are left out
+	edges []EdgeSpec
+}
+
+// export returns the live vertices and the edges between them.
+// Standard graph formats require both ends of an edge to exist, so hanging edges are not exported.
+func (g Graph) export() (exportedGraph, error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	elements := g.vertices.List()
+	sort.Slice(elements, func(i, j int) bool {
+		return elements[i].GetKey() < elements[j].GetKey()
+	})
+
+	exported := exportedGraph{vertices: make([]Vertex, 0, len(elements))}
+	live := make(map[string]bool, len(elements))
+	for _, element := range elements {
+		vertex, err := g.Lookup(element.GetKey())
+		if err != nil {
+			return exportedGraph{}, err
+		}
+		exported.vertices = append(exported.vertices, vertex)
+		live[vertex.Key] = true
+	}
+
+	for _, vertex := range exported.vertices {
+		adjacent := g.listAdjacent(vertex.Key)
+		sort.Slice(adjacent, func(i, j int) bool {
+			return adjacent[i].GetKey() < adjacent[j].GetKey()
+		})
+		for _, element := range adjacent {
+			if !live[element.GetKey()] {
+				continue
+			}
+			exported.edges = append(exported.edges, EdgeSpec{From: vertex.Key, Edge: toEdge(element).clone()})
+		}
+	}
+	return exported, nil
+}
+
+// load adds the imported vertices and edges to the graph in a single transaction, so either the whole
+// document is imported or nothing. Existing vertices are updated and existing edges are replaced.
+func (g Graph) load(vertices []Vertex, edges []EdgeSpec) error {
+	return g.Update(func(tx Tx) error {
+		for _, v := range vertices {
+			_, err := tx.Lookup(v.Key)
+			switch {
+			case err == nil:
+				err = tx.UpdateVertex(v)
+			case errors.Is(err, ErrVertexNotFound):
+				err = tx.AddVertex(v)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to import vertex [key = %q]", v.Key)
+			}
+		}
+		for _, spec := range edges {
+			err := tx.AddWeightedEdge(spec.From, spec.Edge)
+			if err != nil {
+				return errors.Wrapf(err, "failed to import edge [from = %q, to = %q]", spec.From, spec.Edge.To)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,312 @@
+package lww
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+var (
+	// ErrInvariantNotFound occurs when there is no invariant with the given name
+	ErrInvariantNotFound = errors.New("invariant not found")
+)
+
+// Invariant is an assertion about the edges of the vertices with keys starting with a prefix (the vertex type),
+// e.g. "an order has at most one `billed-to` edge". Local writes can be checked by the application before
+// they are made, but merges combine concurrent writes and can create states no single replica would have allowed,
+// so invariants are checked after merging (see `InvariantGraph`).
+type Invariant struct {
+	// Name is the unique name of the invariant, it's the key of the invariant
+	Name string `json:"name"`
+	// Prefix is the key prefix of the vertices the invariant applies to, empty applies to all the vertices
+	Prefix string `json:"prefix,omitempty"`
+	// Label is the label of the counted edges, empty counts all the edges
+	Label string `json:"label,omitempty"`
+	// Incoming counts the edges pointing to the vertex instead of the edges starting from it
+	Incoming bool `json:"incoming,omitempty"`
+	// Max is the maximum number of the counted edges between live vertices, zero forbids them
+	Max int `json:"max"`
+}
+
+// GetKey implements the `Element` interface
+func (i Invariant) GetKey() string {
+	return i.Name
+}
+
+// DecodeInvariant is an `ElementDecoder` of `Invariant`
+func DecodeInvariant(data []byte) (Element, error) {
+	var i Invariant
+	err := json.Unmarshal(data, &i)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode invariant")
+	}
+	return i, nil
+}
+
+// NewInvariants initializes the replicated set of invariants and makes it ready for use
+func NewInvariants(r crdt.Replica) Invariants {
+	r = r.WithDefaults()
+	return Invariants{
+		replica: r,
+		set:     NewSetWithDecoder(r, DecodeInvariant),
+	}
+}
+
+// Invariants is a replicated set of graph invariants by name, so all the replicas check the same assertions.
+// Use `NewInvariants` in order to initialize it before use.
+// The invariants are thread-safe and can be used from several go routines.
+type Invariants struct {
+	// replica is the key normalizer of the prefixes
+	replica crdt.Replica
+	// set stores the invariants by name
+	set Set
+}
+
+// Set adds the invariant or replaces the invariant with the same name
+func (i Invariants) Set(invariant Invariant) {
+	invariant.Prefix = i.replica.NormalizeKey(invariant.Prefix)
+	i.set.Add(invariant)
+}
+
+// Remove removes the invariant with the given name.
+// Returns an error with `ErrInvariantNotFound` cause if there is no such invariant.
+func (i Invariants) Remove(name string) error {
+	if _, err := i.set.Lookup(name); err != nil {
+		return errors.Wrapf(ErrInvariantNotFound, "name %q", name)
+	}
+	i.set.Remove(name)
+	return nil
+}
+
+// Lookup returns the invariant with the given name.
+// Returns an error with `ErrInvariantNotFound` cause if there is no such invariant.
+func (i Invariants) Lookup(name string) (Invariant, error) {
+	element, err := i.set.Lookup(name)
+	if err != nil {
+		return Invariant{}, errors.Wrapf(ErrInvariantNotFound, "name %q", name)
+	}
+	invariant, isInvariant := element.(Invariant)
+	if !isInvariant {
+		return Invariant{}, errors.Wrapf(ErrInvariantNotFound, "name %q", name)
+	}
+	return invariant, nil
+}
+
+// List returns all the invariants sorted by name
+func (i Invariants) List() []Invariant {
+	invariants := []Invariant{}
+	for _, element := range i.set.List() {
+		invariant, isInvariant := element.(Invariant)
+		if !isInvariant {
+			continue
+		}
+		invariants = append(invariants, invariant)
+	}
+
+	sort.Slice(invariants, func(a, b int) bool {
+		return invariants[a].Name < invariants[b].Name
+	})
+	return invariants
+}
+
+// Merge merges the invariants of another replica
+func (i Invariants) Merge(remote Invariants) {
+	i.set.Merge(remote.set)
+}
+
+// Marshal serializes the invariants including the removed ones, which are needed for convergence
+func (i Invariants) Marshal() ([]byte, error) {
+	return i.set.Marshal()
+}
+
+// Unmarshal restores the invariants serialized by `Marshal`
+func (i Invariants) Unmarshal(data []byte) error {
+	return i.set.Unmarshal(data)
+}
+
+// InvariantViolation is a vertex with more counted edges than its invariant allows
+type InvariantViolation struct {
+	// Invariant is the violated invariant
+	Invariant Invariant
+	// Key is the key of the vertex
+	Key string
+	// Edges are the offending edges sorted by the keys of the vertices they connect
+	Edges []ViolatingEdge
+}
+
+// ViolatingEdge is an edge counted by a violated invariant with the write that added it,
+// so the concurrent writes that together broke the invariant can be traced to their replicas
+type ViolatingEdge struct {
+	// From is the key of the vertex the edge starts from
+	From string
+	// Edge is the edge with the key of the vertex it points to
+	Edge Edge
+	// Write is the last write of the edge
+	Write Write
+}
+
+// CheckInvariants returns the violations of the invariants in the current state of the graph
+// sorted by the invariant name and the vertex key. Only the edges between live vertices are counted.
+// It scans all the vertices matching the invariant prefixes.
+func (g Graph) CheckInvariants(invariants Invariants) []InvariantViolation {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	keys := make([]string, 0)
+	for _, element := range g.vertices.List() {
+		keys = append(keys, element.GetKey())
+	}
+	sort.Strings(keys)
+
+	violations := []InvariantViolation{}
+	for _, invariant := range invariants.List() {
+		for _, key := range keys {
+			if !strings.HasPrefix(key, invariant.Prefix) {
+				continue
+			}
+			edges := g.invariantEdges(invariant, key)
+			if len(edges) <= invariant.Max {
+				continue
+			}
+			violations = append(violations, InvariantViolation{Invariant: invariant, Key: key, Edges: edges})
+		}
+	}
+	return violations
+}
+
+// invariantEdges returns the edges of the vertex counted by the invariant, must be called under the read lock
+func (g Graph) invariantEdges(invariant Invariant, key string) []ViolatingEdge {
+	var edges []ViolatingEdge
+	counted := func(fromKey, toKey string) {
+		adjacent, exists := g.edges[fromKey]
+		if !exists {
+			return
+		}
+		element, err := adjacent.Lookup(toKey)
+		if err != nil {
+			return
+		}
+		edge := toEdge(element)
+		if invariant.Label != "" && edge.Label != invariant.Label {
+			return
+		}
+		write, err := adjacent.LastWrite(toKey)
+		if err != nil {
+			return
+		}
+		edges = append(edges, ViolatingEdge{From: fromKey, Edge: edge.clone(), Write: write})
+	}
+
+	if invariant.Incoming {
+		incoming := g.incomingKeys(key)
+		fromKeys := make([]string, 0, len(incoming))
+		for fromKey := range incoming {
+			fromKeys = append(fromKeys, fromKey)
+		}
+		sort.Strings(fromKeys)
+		for _, fromKey := range fromKeys {
+			if _, err := g.vertices.Lookup(fromKey); err == nil {
+				counted(fromKey, key)
+			}
+		}
+		return edges
+	}
+
+	toKeys := []string{}
+	for _, element := range g.listAdjacent(key) {
+		toKeys = append(toKeys, element.GetKey())
+	}
+	sort.Strings(toKeys)
+	for _, toKey := range toKeys {
+		if _, err := g.vertices.Lookup(toKey); err == nil {
+			counted(key, toKey)
+		}
+	}
+	return edges
+}
+
+// InvariantConfig contains the settings of the invariant checks
+type InvariantConfig struct {
+	// OnViolation is called for every violation found after a merge that was not found by the previous check,
+	// nil discards the events. It's called synchronously after the merge, outside of the locks.
+	OnViolation func(InvariantViolation)
+}
+
+// NewInvariantGraph wraps the graph checking the invariants after every merge
+func NewInvariantGraph(g Graph, invariants Invariants, config InvariantConfig) InvariantGraph {
+	return InvariantGraph{
+		Graph:       g,
+		invariants:  invariants,
+		onViolation: config.OnViolation,
+		reportMutex: &sync.Mutex{},
+		reported:    make(map[string]nothing),
+	}
+}
+
+// InvariantGraph is a graph checking the replicated invariants after every merge and emitting
+// violation events with the offending edges, so applications can repair the state (e.g. remove the extra edges
+// deterministically on one replica) or alert operators.
+// Use `NewInvariantGraph` in order to initialize it before use.
+//
+// Merges are never rejected, since that would break convergence, the violations are only reported.
+// A violation is reported once until a check finds it resolved. Other methods changing the state
+// (e.g. `MergeCRDT` or `Unmarshal`) are not checked, call `Check` after them.
+// The graph is thread-safe and can be used from several go routines.
+type InvariantGraph struct {
+	Graph
+
+	// invariants are the checked invariants
+	invariants Invariants
+	// onViolation receives the violation events
+	onViolation func(InvariantViolation)
+	// reportMutex makes checking and reporting atomic
+	reportMutex *sync.Mutex
+	// reported contains the reported violations by invariant name and vertex key
+	reported map[string]nothing
+}
+
+// Merge merges the remote graph like `Graph.Merge` does and checks the invariants
+func (g InvariantGraph) Merge(remote Graph) {
+	g.Graph.Merge(remote)
+	g.Check()
+}
+
+// Check returns all the current violations of the invariants, see `Graph.CheckInvariants`,
+// and emits the violations that were not found by the previous check.
+func (g InvariantGraph) Check() []InvariantViolation {
+	var events []InvariantViolation
+	defer func() {
+		if g.onViolation == nil {
+			return
+		}
+		for _, e := range events {
+			g.onViolation(e)
+		}
+	}()
+
+	g.reportMutex.Lock()
+	defer g.reportMutex.Unlock()
+
+	violations := g.CheckInvariants(g.invariants)
+	current := make(map[string]nothing, len(violations))
+	for _, v := range violations {
+		id := v.Invariant.Name + "\x00" + v.Key
+		current[id] = nothing{}
+		if _, isReported := g.reported[id]; !isReported {
+			events = append(events, v)
+		}
+	}
+
+	for id := range g.reported {
+		delete(g.reported, id)
+	}
+	for id := range current {
+		g.reported[id] = nothing{}
+	}
+	return violations
+}
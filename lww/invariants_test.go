@@ -0,0 +1,110 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvariants(t *testing.T) {
+	t.Run("replicates invariants", func(t *testing.T) {
+		a := NewInvariants(crdt.NewReplica("A"))
+		b := NewInvariants(crdt.NewReplica("B"))
+
+		a.Set(Invariant{Name: "one-customer", Prefix: "order/", Label: "billed-to", Max: 1})
+		b.Set(Invariant{Name: "no-parents", Prefix: "root/", Incoming: true})
+		b.Merge(a)
+
+		require.Equal(t, []Invariant{
+			{Name: "no-parents", Prefix: "root/", Incoming: true},
+			{Name: "one-customer", Prefix: "order/", Label: "billed-to", Max: 1},
+		}, b.List())
+
+		require.NoError(t, b.Remove("no-parents"))
+		require.ErrorIs(t, b.Remove("no-parents"), ErrInvariantNotFound)
+		_, err := b.Lookup("no-parents")
+		require.ErrorIs(t, err, ErrInvariantNotFound)
+
+		data, err := b.Marshal()
+		require.NoError(t, err)
+		restored := NewInvariants(crdt.NewReplica("C"))
+		require.NoError(t, restored.Unmarshal(data))
+		invariant, err := restored.Lookup("one-customer")
+		require.NoError(t, err)
+		require.Equal(t, 1, invariant.Max)
+		require.Len(t, restored.List(), 1)
+	})
+
+	t.Run("reports violations created by merges", func(t *testing.T) {
+		now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+		tick := clock.Func(func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		})
+
+		invariants := NewInvariants(crdt.NewReplica("A"))
+		invariants.Set(Invariant{Name: "one-customer", Prefix: "order/", Label: "billed-to", Max: 1})
+		invariants.Set(Invariant{Name: "no-parents", Prefix: "root", Incoming: true})
+
+		a := NewGraph(crdt.Replica{ID: "A", Clock: tick})
+		for _, key := range []string{"order/1", "customer/1", "customer/2", "root"} {
+			require.NoError(t, a.AddVertex(Vertex{Key: key}))
+		}
+		b := NewGraph(crdt.Replica{ID: "B", Clock: tick})
+		b.Merge(a)
+
+		// each replica allows its own edge
+		require.NoError(t, a.AddWeightedEdge("order/1", Edge{To: "customer/1", Label: "billed-to"}))
+		require.NoError(t, b.AddWeightedEdge("order/1", Edge{To: "customer/2", Label: "billed-to"}))
+		require.NoError(t, b.AddWeightedEdge("order/1", Edge{To: "root", Label: "other"}))
+
+		var events []InvariantViolation
+		g := NewInvariantGraph(a, invariants, InvariantConfig{
+			OnViolation: func(v InvariantViolation) {
+				events = append(events, v)
+			},
+		})
+		require.Empty(t, g.Check())
+
+		g.Merge(b)
+		expected := []InvariantViolation{
+			{
+				Invariant: Invariant{Name: "no-parents", Prefix: "root", Incoming: true},
+				Key:       "root",
+				Edges: []ViolatingEdge{
+					{From: "order/1", Edge: Edge{To: "root", Label: "other"}, Write: Write{Replica: "B", Timestamp: now}},
+				},
+			},
+			{
+				Invariant: Invariant{Name: "one-customer", Prefix: "order/", Label: "billed-to", Max: 1},
+				Key:       "order/1",
+				Edges: []ViolatingEdge{
+					{From: "order/1", Edge: Edge{To: "customer/1", Label: "billed-to"}, Write: Write{Replica: "A", Timestamp: now.Add(-2 * time.Second)}},
+					{From: "order/1", Edge: Edge{To: "customer/2", Label: "billed-to"}, Write: Write{Replica: "B", Timestamp: now.Add(-time.Second)}},
+				},
+			},
+		}
+		require.Equal(t, expected, events)
+		require.Equal(t, expected, g.CheckInvariants(invariants))
+
+		// reported once
+		g.Merge(b)
+		require.Len(t, events, 2)
+
+		// resolved and violated again
+		require.NoError(t, g.RemoveEdge("order/1", "customer/2"))
+		require.Len(t, g.Check(), 1)
+		g.Merge(b)
+		require.Len(t, events, 2, "the removal is newer")
+		require.NoError(t, g.AddWeightedEdge("order/1", Edge{To: "customer/2", Label: "billed-to"}))
+		require.Len(t, g.Check(), 2)
+		require.Len(t, events, 3)
+
+		// edges to removed vertices are not counted
+		require.NoError(t, g.RemoveVertex("customer/2"))
+		require.Len(t, g.Check(), 1)
+	})
+}
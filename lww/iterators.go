@@ -0,0 +1,132 @@
+package lww
+
+import (
+	"github.com/rdner/crdt"
+)
+
+// Iterators stream the elements of the CRDTs without materializing them in slices, so callers can process
+// huge graphs and stop early without large allocations. An iterator is a function calling `yield` for every
+// element until it returns `false`, it has the signature of `iter.Seq` of Go 1.23, so modules using
+// Go 1.23 and later can range over it: `for v := range g.Vertices() {...}`.
+//
+// Iteration holds the read lock, so `yield` must not call the methods of the CRDT, collect what to change
+// and change it after the iteration. Iterators reflect the state at the time they are run, not created.
+
+// Elements returns an iterator over the actual elements of the set in the order of `crdt.Replica.Order`,
+// see `List`.
+func (s Set) Elements() func(yield func(Element) bool) {
+	return func(yield func(Element) bool) {
+		s.checkUsage()
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+
+		if s.replica.Order != crdt.OrderNone {
+			for _, key := range s.orderedKeys() {
+				if !yield(s.additions[key].Element) {
+					return
+				}
+			}
+			return
+		}
+
+		for key, record := range s.additions {
+			if s.removed(key, record) {
+				continue
+			}
+			if !yield(record.Element) {
+				return
+			}
+		}
+	}
+}
+
+// Vertices returns an iterator over the vertices of the graph in the order of `crdt.Replica.Order`
+func (g Graph) Vertices() func(yield func(Vertex) bool) {
+	return func(yield func(Vertex) bool) {
+		g.checkUsage()
+		g.mutex.RLock()
+		defer g.mutex.RUnlock()
+
+		g.vertices.Elements()(func(element Element) bool {
+			vertex, isVertex := toVertex(element)
+			if !isVertex {
+				return true
+			}
+			return yield(vertex)
+		})
+	}
+}
+
+// EdgesFrom returns an iterator over the edges from the vertex with the given key to the existing vertices
+// in the order of `crdt.Replica.Order`. It yields nothing if the vertex does not exist.
+func (g Graph) EdgesFrom(key string) func(yield func(Edge) bool) {
+	return func(yield func(Edge) bool) {
+		g.checkUsage()
+		g.mutex.RLock()
+		defer g.mutex.RUnlock()
+
+		if _, err := g.Lookup(key); err != nil {
+			return
+		}
+		adjacent, exists := g.edges[g.replica.NormalizeKey(key)]
+		if !exists {
+			return
+		}
+
+		adjacent.Elements()(func(element Element) bool {
+			// some edges exist even for removed vertices
+			if _, err := g.Lookup(element.GetKey()); err != nil {
+				return true
+			}
+			return yield(toEdge(element).clone())
+		})
+	}
+}
+
+// Connected returns an iterator over the vertices connected to the vertex with the given key
+// in the breadth-first order, see `FindConnected`. It yields nothing if the vertex does not exist.
+// Unlike `FindConnected` it does not collect the result, stopping early skips the rest of the traversal.
+func (g Graph) Connected(key string) func(yield func(Vertex) bool) {
+	return func(yield func(Vertex) bool) {
+		g.checkUsage()
+		g.mutex.RLock()
+		defer g.mutex.RUnlock()
+
+		start, err := g.Lookup(key)
+		if err != nil {
+			return
+		}
+
+		visited := make(map[string]nothing)
+		queue := []string{start.Key}
+		for len(queue) != 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			adjacent, exists := g.edges[current]
+			if !exists {
+				continue
+			}
+
+			stopped := false
+			adjacent.Elements()(func(element Element) bool {
+				// some edges exist even for removed vertices
+				vertex, err := g.Lookup(element.GetKey())
+				if err != nil {
+					return true
+				}
+				if _, isVisited := visited[vertex.Key]; isVisited {
+					return true
+				}
+				visited[vertex.Key] = nothing{}
+				queue = append(queue, vertex.Key)
+
+				stopped = !yield(vertex)
+				return !stopped
+			})
+			if stopped {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package lww
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterators(t *testing.T) {
+	newGraph := func(t *testing.T, r crdt.Replica) Graph {
+		g := NewGraph(r)
+		for i := 1; i <= 5; i++ {
+			require.NoError(t, g.AddVertex(Vertex{Key: fmt.Sprintf("v%d", i), Value: fmt.Sprintf("value %d", i)}))
+		}
+		require.NoError(t, g.AddEdge("v1", "v2"))
+		require.NoError(t, g.AddWeightedEdge("v1", Edge{To: "v3", Weight: 5, Label: "knows"}))
+		require.NoError(t, g.AddEdge("v1", "v4"))
+		require.NoError(t, g.AddEdge("v3", "v5"))
+		require.NoError(t, g.AddEdge("v5", "v1"))
+		require.NoError(t, g.RemoveVertex("v4"))
+		return g
+	}
+	sorted := crdt.Replica{ID: "A", Order: crdt.OrderSorted}
+
+	t.Run("Vertices", func(t *testing.T) {
+		g := newGraph(t, sorted)
+		var vertices []Vertex
+		g.Vertices()(func(v Vertex) bool {
+			vertices = append(vertices, v)
+			return true
+		})
+		require.Equal(t, []Vertex{
+			{Key: "v1", Value: "value 1"},
+			{Key: "v2", Value: "value 2"},
+			{Key: "v3", Value: "value 3"},
+			{Key: "v5", Value: "value 5"},
+		}, vertices)
+
+		count := 0
+		g.Vertices()(func(v Vertex) bool {
+			count++
+			return count < 2
+		})
+		require.Equal(t, 2, count, "stops early")
+	})
+
+	t.Run("EdgesFrom", func(t *testing.T) {
+		g := newGraph(t, sorted)
+		var edges []Edge
+		g.EdgesFrom("v1")(func(e Edge) bool {
+			edges = append(edges, e)
+			return true
+		})
+		require.Equal(t, []Edge{{To: "v2"}, {To: "v3", Weight: 5, Label: "knows"}}, edges, "skips removed vertices")
+
+		g.EdgesFrom("v0")(func(e Edge) bool {
+			require.Fail(t, "a non-existing vertex has no edges")
+			return true
+		})
+	})
+
+	t.Run("Connected", func(t *testing.T) {
+		g := newGraph(t, crdt.NewReplica("A"))
+		expected, err := g.FindConnected("v1")
+		require.NoError(t, err)
+
+		var connected []Vertex
+		g.Connected("v1")(func(v Vertex) bool {
+			connected = append(connected, v)
+			return true
+		})
+		require.ElementsMatch(t, expected, connected)
+
+		connected = connected[:0]
+		g.Connected("v1")(func(v Vertex) bool {
+			connected = append(connected, v)
+			return v.Key != "v3"
+		})
+		require.Equal(t, "v3", connected[len(connected)-1].Key, "stops early")
+		require.NotContains(t, connected, Vertex{Key: "v5", Value: "value 5"})
+	})
+
+	t.Run("Set.Elements", func(t *testing.T) {
+		s := NewSet(crdt.Replica{ID: "A", Order: crdt.OrderSorted})
+		for _, key := range []string{"c", "a", "b"} {
+			s.Add(IDElement(key))
+		}
+		var elements []Element
+		s.Elements()(func(e Element) bool {
+			elements = append(elements, e)
+			return true
+		})
+		require.Equal(t, s.List(), elements)
+	})
+}
@@ -0,0 +1,188 @@
+package lww
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// jgfDocument is a JSON Graph Format document with a single graph
+type jgfDocument struct {
+	Graph  *jgfGraph  `json:"graph,omitempty"`
+	Graphs []jgfGraph `json:"graphs,omitempty"`
+}
+
+// jgfGraph is a graph of the JSON Graph Format
+type jgfGraph struct {
+	Directed *bool           `json:"directed,omitempty"`
+	Nodes    json.RawMessage `json:"nodes,omitempty"`
+	Edges    []jgfEdge       `json:"edges,omitempty"`
+}
+
+// jgfNode is a node of the JSON Graph Format, `ID` is set only in the version 1 node arrays
+type jgfNode struct {
+	ID    string `json:"id,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// jgfEdge is an edge of the JSON Graph Format
+type jgfEdge struct {
+	Source   string                     `json:"source"`
+	Target   string                     `json:"target"`
+	Relation string                     `json:"relation,omitempty"`
+	Directed *bool                      `json:"directed,omitempty"`
+	Metadata map[string]json.RawMessage `json:"metadata,omitempty"`
+}
+
+// ExportJGF writes the vertices and the edges of the graph as a directed graph of the JSON Graph Format
+// version 2 (https://jsongraphformat.info). Vertex values are written as the node labels, edge labels
+// as the edge relations, edge weights and attributes as the edge metadata (`weight` and the attribute names).
+// An attribute named `weight` is left out, it would be imported as the weight.
+// Vertices and edges are written in the order of their keys, edges pointing to removed vertices are left out.
+func (g Graph) ExportJGF(w io.Writer) error {
+	exported, err := g.export()
+	if err != nil {
+		return err
+	}
+
+	// the keys of the node object are sorted by the encoder
+	nodes := make(map[string]jgfNode, len(exported.vertices))
+	for _, v := range exported.vertices {
+		nodes[v.Key] = jgfNode{Label: v.Value}
+	}
+	encodedNodes, err := json.Marshal(nodes)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the JSON Graph Format nodes")
+	}
+
+	directed := true
+	graph := jgfGraph{Directed: &directed, Nodes: encodedNodes, Edges: make([]jgfEdge, 0, len(exported.edges))}
+	for _, spec := range exported.edges {
+		edge := jgfEdge{Source: spec.From, Target: spec.Edge.To, Relation: spec.Edge.Label}
+		if spec.Edge.Weight != 0 || len(spec.Edge.Attributes) != 0 {
+			edge.Metadata = make(map[string]json.RawMessage, len(spec.Edge.Attributes)+1)
+		}
+		if spec.Edge.Weight != 0 {
+			edge.Metadata[graphMLWeight], _ = json.Marshal(spec.Edge.Weight)
+		}
+		for name, value := range spec.Edge.Attributes {
+			if name == graphMLWeight {
+				continue
+			}
+			edge.Metadata[name], _ = json.Marshal(value)
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(jgfDocument{Graph: &graph})
+	if err != nil {
+		return errors.Wrap(err, "failed to write the JSON Graph Format document")
+	}
+	return nil
+}
+
+// ImportJGF adds the nodes and the edges of a JSON Graph Format document (version 1 or 2) with a single graph
+// to the graph as local operations in a single transaction, so either the whole document is imported or nothing.
+// Existing vertices are updated and existing edges are replaced.
+//
+// Node labels become the vertex values, edge relations become the edge labels, the integer `weight` edge metadata
+// becomes the edge weight and any other edge metadata becomes an edge attribute (non-string values are stored
+// as JSON). Node metadata is ignored. Undirected edges are imported as two directed edges.
+// Returns an error with `ErrInvalidGraphFile` cause if the document can't be parsed or represented by the graph
+// and an error with `ErrVertexNotFound` cause if an edge connects an unknown vertex.
+func (g Graph) ImportJGF(r io.Reader) error {
+	var doc jgfDocument
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidGraphFile, "failed to parse the JSON Graph Format document: %s", err)
+	}
+
+	var graph jgfGraph
+	switch {
+	case doc.Graph != nil && len(doc.Graphs) == 0:
+		graph = *doc.Graph
+	case doc.Graph == nil && len(doc.Graphs) == 1:
+		graph = doc.Graphs[0]
+	default:
+		return errors.Wrap(ErrInvalidGraphFile, "expected a single graph in the JSON Graph Format document")
+	}
+
+	vertices, err := jgfVertices(graph.Nodes)
+	if err != nil {
+		return err
+	}
+
+	edges := make([]EdgeSpec, 0, len(graph.Edges))
+	for _, e := range graph.Edges {
+		edge := Edge{To: e.Target, Label: e.Relation}
+		for name, raw := range e.Metadata {
+			if name == graphMLWeight && json.Unmarshal(raw, &edge.Weight) == nil {
+				continue
+			}
+
+			if edge.Attributes == nil {
+				edge.Attributes = make(map[string]string, len(e.Metadata))
+			}
+			var value string
+			if json.Unmarshal(raw, &value) != nil {
+				value = string(raw)
+			}
+			edge.Attributes[name] = value
+		}
+		edges = append(edges, EdgeSpec{From: e.Source, Edge: edge})
+
+		directed := graph.Directed == nil || *graph.Directed
+		if e.Directed != nil {
+			directed = *e.Directed
+		}
+		if !directed && e.Source != e.Target {
+			reverse := edge.clone()
+			reverse.To = e.Source
+			edges = append(edges, EdgeSpec{From: e.Target, Edge: reverse})
+		}
+	}
+
+	return g.load(vertices, edges)
+}
+
+// jgfVertices returns the vertices of the JSON Graph Format nodes: an object by node ID (version 2)
+// or an array of nodes with IDs (version 1)
+func jgfVertices(raw json.RawMessage) ([]Vertex, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var vertices []Vertex
+	if raw[0] == '[' {
+		var nodes []jgfNode
+		err := json.Unmarshal(raw, &nodes)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidGraphFile, "invalid JSON Graph Format nodes: %s", err)
+		}
+		for _, node := range nodes {
+			if node.ID == "" {
+				return nil, errors.Wrap(ErrInvalidGraphFile, "JSON Graph Format node without an ID")
+			}
+			vertices = append(vertices, Vertex{Key: node.ID, Value: node.Label})
+		}
+		return vertices, nil
+	}
+
+	var nodes map[string]jgfNode
+	err := json.Unmarshal(raw, &nodes)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidGraphFile, "invalid JSON Graph Format nodes: %s", err)
+	}
+	for id, node := range nodes {
+		vertices = append(vertices, Vertex{Key: id, Value: node.Label})
+	}
+	// the transaction is applied in the key order anyway, sorting makes the errors deterministic
+	sort.Slice(vertices, func(i, j int) bool {
+		return vertices[i].Key < vertices[j].Key
+	})
+	return vertices, nil
+}
@@ -0,0 +1,118 @@
+package lww
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJGF(t *testing.T) {
+	t.Run("exports the graph", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, newInterchangeGraph(t).ExportJGF(&buf))
+		require.JSONEq(t, `{
+  "graph": {
+    "directed": true,
+    "nodes": {
+      "v1": {"label": "first"},
+      "v2": {"label": "<second>"},
+      "v3": {}
+    },
+    "edges": [
+      {"source": "v1", "target": "v2", "relation": "knows", "metadata": {"weight": 5, "since": "2020"}},
+      {"source": "v1", "target": "v3"},
+      {"source": "v2", "target": "v3"}
+    ]
+  }
+}`, buf.String())
+	})
+
+	t.Run("imports an exported graph", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, newInterchangeGraph(t).ExportJGF(&buf))
+
+		g := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, g.ImportJGF(&buf))
+
+		requireImported(t, g)
+	})
+
+	t.Run("imports version 1 documents", func(t *testing.T) {
+		g := NewGraph(crdt.NewReplica("A"))
+		err := g.ImportJGF(strings.NewReader(`{
+  "graphs": [{
+    "directed": false,
+    "nodes": [{"id": "n0", "label": "zero", "metadata": {"color": "red"}}, {"id": "n1"}, {"id": "n2"}],
+    "edges": [
+      {"source": "n0", "target": "n1", "metadata": {"weight": 2}},
+      {"source": "n1", "target": "n2", "directed": true, "metadata": {"weight": 1.5, "lanes": 2}}
+    ]
+  }]
+}`))
+		require.NoError(t, err)
+
+		list, err := g.List()
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: Vertex{Key: "n0", Value: "zero"}, AdjacentKeys: []string{"n1"}},
+			{Vertex: Vertex{Key: "n1"}, AdjacentKeys: []string{"n0", "n2"}},
+			{Vertex: Vertex{Key: "n2"}, AdjacentKeys: []string{}},
+		}, list)
+
+		edge, err := g.GetEdge("n1", "n0")
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: "n0", Weight: 2}, edge)
+		edge, err = g.GetEdge("n1", "n2")
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: "n2", Attributes: map[string]string{"weight": "1.5", "lanes": "2"}}, edge)
+	})
+
+	t.Run("fails on invalid documents", func(t *testing.T) {
+		cases := []struct {
+			name string
+			doc  string
+			err  error
+		}{
+			{
+				name: "not JSON",
+				doc:  "<graphml/>",
+				err:  ErrInvalidGraphFile,
+			},
+			{
+				name: "no graph",
+				doc:  `{}`,
+				err:  ErrInvalidGraphFile,
+			},
+			{
+				name: "several graphs",
+				doc:  `{"graphs": [{}, {}]}`,
+				err:  ErrInvalidGraphFile,
+			},
+			{
+				name: "node without an ID",
+				doc:  `{"graph": {"nodes": [{"label": "a"}]}}`,
+				err:  ErrInvalidGraphFile,
+			},
+			{
+				name: "unknown vertex",
+				doc:  `{"graph": {"nodes": {"a": {}}, "edges": [{"source": "a", "target": "b"}]}}`,
+				err:  ErrVertexNotFound,
+			},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewGraph(crdt.NewReplica("A"))
+				err := g.ImportJGF(strings.NewReader(tc.doc))
+				require.ErrorIs(t, err, tc.err)
+
+				list, err := g.List()
+				require.NoError(t, err)
+				require.Empty(t, list, "nothing is imported")
+			})
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyNormalization(t *testing.T) {
+	newReplica := func(id string) crdt.Replica {
+		r := crdt.NewReplica(id)
+		r.KeyNormalizer = crdt.ChainKeyNormalizers(crdt.TrimSpace, crdt.NormalizeUUID)
+		return r
+	}
+
+	upper := "6BA7B810-9DAD-11D1-80B4-00C04FD430C8"
+	lower := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	braced := "{6ba7b810-9dad-11d1-80b4-00c04fd430c8}"
+
+	t.Run("normalizes keys on every graph operation", func(t *testing.T) {
+		g := NewGraph(newReplica("A"))
+		require.NoError(t, g.AddVertex(Vertex{Key: upper, Value: "value"}))
+		require.ErrorIs(t, g.AddVertex(Vertex{Key: braced, Value: "other"}), ErrVertexAlreadyExists)
+		require.NoError(t, g.AddVertex(Vertex{Key: " other ", Value: "other"}))
+
+		found, err := g.Lookup(braced)
+		require.NoError(t, err)
+		require.Equal(t, Vertex{Key: lower, Value: "value"}, found)
+
+		require.NoError(t, g.AddEdge(upper, "other"))
+		require.NoError(t, g.AddEdgeWeight(braced, "other ", 2))
+
+		weight, err := g.EdgeWeight(lower, "other")
+		require.NoError(t, err)
+		require.Equal(t, int64(2), weight)
+
+		path, err := g.FindPath(upper, " other")
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{{Key: lower, Value: "value"}, {Key: "other", Value: "other"}}, path)
+
+		require.NoError(t, g.RemoveEdge(braced, "other"))
+		connected, err := g.FindConnected(lower)
+		require.NoError(t, err)
+		require.Empty(t, connected)
+
+		require.NoError(t, g.RemoveVertex(braced))
+		_, err = g.Lookup(lower)
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("replicas fed keys in different forms converge", func(t *testing.T) {
+		// Time ->
+		// A--AddVertex(UPPER)---------------------\--|
+		// B--------------------AddVertex(lower)--\-\-|=> A,B = {lower}
+		A := NewGraph(newReplica("A"))
+		B := NewGraph(newReplica("B"))
+
+		require.NoError(t, A.AddVertex(Vertex{Key: upper, Value: "from A"}))
+		require.NoError(t, B.AddVertex(Vertex{Key: lower, Value: "from B"}))
+
+		A.Merge(B)
+		B.Merge(A)
+
+		listA, err := A.List()
+		require.NoError(t, err)
+		listB, err := B.List()
+		require.NoError(t, err)
+		require.Equal(t, listA, listB)
+		require.Equal(t, []VertexWithEdges{{Vertex: Vertex{Key: lower, Value: "from B"}, AdjacentKeys: []string{}}}, listA)
+	})
+
+	t.Run("normalizes keys of replicas without a normalizer on merge", func(t *testing.T) {
+		A := NewGraph(newReplica("A"))
+		legacy := NewGraph(crdt.NewReplica("legacy"))
+
+		require.NoError(t, legacy.AddVertex(Vertex{Key: upper, Value: "value"}))
+		require.NoError(t, legacy.AddVertex(Vertex{Key: "other", Value: "other"}))
+		require.NoError(t, legacy.AddEdge("other", upper))
+
+		A.Merge(legacy)
+
+		list, err := A.List()
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: Vertex{Key: lower, Value: "value"}, AdjacentKeys: []string{}},
+			{Vertex: Vertex{Key: "other", Value: "other"}, AdjacentKeys: []string{lower}},
+		}, list)
+	})
+
+	t.Run("normalizes keys of sets", func(t *testing.T) {
+		s := NewSet(newReplica("A"))
+		s.Add(IDElement(upper))
+		require.Equal(t, []Element{IDElement(lower)}, s.List())
+
+		s.Remove(braced)
+		_, err := s.Lookup(lower)
+		require.ErrorIs(t, err, ErrElementNotFound)
+	})
+}
@@ -0,0 +1,201 @@
+package lww
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+var (
+	// ErrLeaseHeld occurs when a region is leased by another actor
+	ErrLeaseHeld = errors.New("lease is held by another actor")
+	// ErrLeaseNotFound occurs when a region has no active lease
+	ErrLeaseNotFound = errors.New("lease not found")
+)
+
+// Lease is an advisory claim of an actor on a region of a graph (a set of vertex keys) until it expires,
+// e.g. a user of a diagram editor editing a group of shapes.
+type Lease struct {
+	// Region is the name of the leased region, it's the key of the lease
+	Region string `json:"region"`
+	// Holder is the actor holding the lease
+	Holder string `json:"holder"`
+	// Keys are the keys of the vertices in the region
+	Keys []string `json:"keys"`
+	// Expires is when the lease stops being active unless it's renewed
+	Expires time.Time `json:"expires"`
+}
+
+// GetKey implements the `Element` interface
+func (l Lease) GetKey() string {
+	return l.Region
+}
+
+// Covers returns `true` if the vertex with the given key is in the leased region
+func (l Lease) Covers(key string) bool {
+	for _, k := range l.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeLease is an `ElementDecoder` of `Lease`
+func DecodeLease(data []byte) (Element, error) {
+	var l Lease
+	err := json.Unmarshal(data, &l)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode lease")
+	}
+	return l, nil
+}
+
+// NewLeases initializes the replicated set of leases and makes it ready for use.
+// The replica clock decides when leases expire.
+func NewLeases(r crdt.Replica) Leases {
+	r = r.WithDefaults()
+	return Leases{
+		mutex:   &sync.Mutex{},
+		replica: r,
+		set:     NewSetWithDecoder(r, DecodeLease),
+	}
+}
+
+// Leases is a replicated set of advisory leases of graph regions, so an actor can softly check out
+// a subgraph and other replicas see it and can defer their edits (see `LeasedGraph`).
+// Use `NewLeases` in order to initialize it before use.
+//
+// Leases are not locks: replicas acquire them without coordination, so two actors can acquire
+// the same region concurrently, after merging the last writer holds the lease on all the replicas.
+// Expiration relies on the clocks of the replicas being roughly synchronized.
+// The leases are thread-safe and can be used from several go routines.
+type Leases struct {
+	// mutex makes checking the current lease and writing a new one atomic
+	mutex *sync.Mutex
+	// replica is the clock and the key normalizer of the leases
+	replica crdt.Replica
+	// set stores the leases by region
+	set Set
+}
+
+// Acquire leases the region with the given vertex keys to the holder for the `ttl` duration.
+// The holder of an active lease can acquire it again in order to renew it or to change its keys.
+// Returns an error with `ErrLeaseHeld` cause if another holder has an active lease of the region.
+func (l Leases) Acquire(region, holder string, keys []string, ttl time.Duration) (Lease, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	region = l.replica.NormalizeKey(region)
+	current, err := l.lookup(region)
+	if err == nil && current.Holder != holder {
+		return current, errors.Wrapf(ErrLeaseHeld, "region %q is leased by %q until %s",
+			region, current.Holder, current.Expires)
+	}
+
+	lease := Lease{
+		Region:  region,
+		Holder:  holder,
+		Keys:    make([]string, 0, len(keys)),
+		Expires: l.replica.Clock.Now().Add(ttl),
+	}
+	for _, key := range keys {
+		lease.Keys = append(lease.Keys, l.replica.NormalizeKey(key))
+	}
+	sort.Strings(lease.Keys)
+
+	l.set.Add(lease)
+	return lease, nil
+}
+
+// Release ends the lease of the region held by the holder before it expires.
+// Returns an error with `ErrLeaseNotFound` cause if the region has no active lease
+// and with `ErrLeaseHeld` cause if the lease is held by another holder.
+func (l Leases) Release(region, holder string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	region = l.replica.NormalizeKey(region)
+	current, err := l.lookup(region)
+	if err != nil {
+		return err
+	}
+	if current.Holder != holder {
+		return errors.Wrapf(ErrLeaseHeld, "region %q is leased by %q", region, current.Holder)
+	}
+
+	l.set.Remove(region)
+	return nil
+}
+
+// Lookup returns the active lease of the region.
+// Returns an error with `ErrLeaseNotFound` cause if the region has no active lease.
+func (l Leases) Lookup(region string) (Lease, error) {
+	return l.lookup(l.replica.NormalizeKey(region))
+}
+
+// Active returns all the active leases sorted by region
+func (l Leases) Active() []Lease {
+	now := l.replica.Clock.Now()
+	active := []Lease{}
+	for _, element := range l.set.List() {
+		lease, isLease := element.(Lease)
+		if !isLease || !now.Before(lease.Expires) {
+			continue
+		}
+		active = append(active, lease)
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Region < active[j].Region
+	})
+	return active
+}
+
+// Covering returns the active leases of the regions containing the vertex with the given key sorted by region
+func (l Leases) Covering(key string) []Lease {
+	key = l.replica.NormalizeKey(key)
+	covering := []Lease{}
+	for _, lease := range l.Active() {
+		if lease.Covers(key) {
+			covering = append(covering, lease)
+		}
+	}
+	return covering
+}
+
+// Merge merges the leases of another replica
+func (l Leases) Merge(remote Leases) {
+	l.set.Merge(remote.set)
+}
+
+// Marshal serializes the leases including the expired ones, which are needed for convergence
+func (l Leases) Marshal() ([]byte, error) {
+	return l.set.Marshal()
+}
+
+// Unmarshal restores the leases serialized by `Marshal`
+func (l Leases) Unmarshal(data []byte) error {
+	return l.set.Unmarshal(data)
+}
+
+// lookup returns the active lease of the region with the normalized key
+func (l Leases) lookup(region string) (Lease, error) {
+	element, err := l.set.Lookup(region)
+	if errors.Is(err, ErrElementNotFound) {
+		return Lease{}, errors.Wrapf(ErrLeaseNotFound, "region %q", region)
+	}
+	if err != nil {
+		return Lease{}, err
+	}
+
+	lease, isLease := element.(Lease)
+	if !isLease || !l.replica.Clock.Now().Before(lease.Expires) {
+		return Lease{}, errors.Wrapf(ErrLeaseNotFound, "region %q", region)
+	}
+	return lease, nil
+}
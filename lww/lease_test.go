@@ -0,0 +1,84 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeases(t *testing.T) {
+	start := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("a region is leased to one holder until it expires", func(t *testing.T) {
+		virtual := clock.NewVirtual(start)
+		leases := NewLeases(crdt.Replica{ID: "A", Clock: virtual})
+
+		lease, err := leases.Acquire("diagram", "alice", []string{"v2", "v1"}, time.Minute)
+		require.NoError(t, err)
+		expected := Lease{Region: "diagram", Holder: "alice", Keys: []string{"v1", "v2"}, Expires: start.Add(time.Minute)}
+		require.Equal(t, expected, lease)
+		require.True(t, lease.Covers("v1"))
+		require.False(t, lease.Covers("v3"))
+
+		_, err = leases.Acquire("diagram", "bob", []string{"v3"}, time.Minute)
+		require.ErrorIs(t, err, ErrLeaseHeld)
+		require.ErrorIs(t, leases.Release("diagram", "bob"), ErrLeaseHeld)
+
+		virtual.Advance(30 * time.Second)
+		renewed, err := leases.Acquire("diagram", "alice", []string{"v1"}, time.Minute)
+		require.NoError(t, err, "the holder renews the lease")
+		require.Equal(t, start.Add(90*time.Second), renewed.Expires)
+
+		virtual.Advance(59 * time.Second)
+		require.Equal(t, []Lease{renewed}, leases.Active())
+		require.Equal(t, []Lease{renewed}, leases.Covering("v1"))
+
+		virtual.Advance(time.Second)
+		require.Empty(t, leases.Active())
+		_, err = leases.Lookup("diagram")
+		require.ErrorIs(t, err, ErrLeaseNotFound)
+		_, err = leases.Acquire("diagram", "bob", []string{"v3"}, time.Minute)
+		require.NoError(t, err, "an expired lease can be acquired by anyone")
+	})
+
+	t.Run("released leases can be acquired", func(t *testing.T) {
+		virtual := clock.NewVirtual(start)
+		leases := NewLeases(crdt.Replica{ID: "A", Clock: virtual})
+		require.ErrorIs(t, leases.Release("diagram", "alice"), ErrLeaseNotFound)
+
+		_, err := leases.Acquire("diagram", "alice", nil, time.Minute)
+		require.NoError(t, err)
+		virtual.Advance(time.Second)
+		require.NoError(t, leases.Release("diagram", "alice"))
+		_, err = leases.Acquire("diagram", "bob", nil, time.Minute)
+		require.NoError(t, err)
+	})
+
+	t.Run("concurrent leases converge to the last writer", func(t *testing.T) {
+		virtual := clock.NewVirtual(start)
+		a := NewLeases(crdt.Replica{ID: "A", Clock: virtual})
+		b := NewLeases(crdt.Replica{ID: "B", Clock: virtual})
+
+		_, err := a.Acquire("diagram", "alice", []string{"v1"}, time.Minute)
+		require.NoError(t, err)
+		virtual.Advance(time.Second)
+		bobs, err := b.Acquire("diagram", "bob", []string{"v2"}, time.Minute)
+		require.NoError(t, err)
+
+		data, err := b.Marshal()
+		require.NoError(t, err)
+		remote := NewLeases(crdt.Replica{ID: "B", Clock: virtual})
+		require.NoError(t, remote.Unmarshal(data))
+		a.Merge(remote)
+		b.Merge(a)
+
+		for _, leases := range []Leases{a, b} {
+			lease, err := leases.Lookup("diagram")
+			require.NoError(t, err)
+			require.Equal(t, bobs, lease)
+		}
+	})
+}
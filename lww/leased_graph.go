@@ -0,0 +1,306 @@
+package lww
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LeaseConfig contains the settings of a leased graph
+type LeaseConfig struct {
+	// Actor is the local actor checking out regions and writing to the graph, the replica ID if empty
+	Actor string
+	// Defer makes local writes to the vertices and edges in regions leased by other actors fail
+	// with `ErrLeaseHeld`, so the actor can defer them until the lease is released or expires.
+	// Otherwise such writes are only reported to the replica logger and metrics.
+	Defer bool
+}
+
+// NewLeasedGraph wraps the graph making its local writes respect the leases of other actors.
+// Several leased graphs can share the same graph and leases, e.g. one per end user of a server.
+func NewLeasedGraph(g Graph, leases Leases, config LeaseConfig) LeasedGraph {
+	if config.Actor == "" {
+		config.Actor = g.replica.ID
+	}
+	return LeasedGraph{
+		Graph:  g,
+		leases: leases,
+		config: config,
+	}
+}
+
+// LeasedGraph is a graph where an actor can softly check out a region (a subgraph) for editing,
+// other replicas merging the leases see it and their actors can defer conflicting edits,
+// which reduces conflicts of workflows like diagram editing proactively.
+// Use `NewLeasedGraph` in order to initialize it before use.
+//
+// Leases are advisory: only local writes of a leased graph are checked, merges are never affected,
+// so the graph converges regardless of the leases. An edge is in a region if any of its vertices is.
+// The graph is thread-safe and can be used from several go routines.
+type LeasedGraph struct {
+	Graph
+
+	// leases are the replicated leases of the graph regions
+	leases Leases
+	// config contains the lease settings
+	config LeaseConfig
+}
+
+// Leases returns the leases of the graph, they must be replicated along with the graph
+func (g LeasedGraph) Leases() Leases {
+	return g.leases
+}
+
+// CheckOut leases the region with the given vertex keys to the actor for the `ttl` duration,
+// checking it out again renews the lease. Returns an error with `ErrLeaseHeld` cause
+// if another actor has an active lease of the region.
+func (g LeasedGraph) CheckOut(region string, keys []string, ttl time.Duration) (Lease, error) {
+	return g.leases.Acquire(region, g.config.Actor, keys, ttl)
+}
+
+// CheckOutNeighborhood leases the region of the vertices reachable from the vertex with the given key
+// within `depth` hops (see `Graph.Neighborhood`) to the actor for the `ttl` duration.
+func (g LeasedGraph) CheckOutNeighborhood(region, key string, depth int, ttl time.Duration) (Lease, error) {
+	neighborhood, err := g.Neighborhood(key, depth)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	keys := make([]string, 0, len(neighborhood))
+	for _, v := range neighborhood {
+		keys = append(keys, v.Key)
+	}
+	return g.CheckOut(region, keys, ttl)
+}
+
+// Release ends the lease of the region held by the actor, see `Leases.Release`
+func (g LeasedGraph) Release(region string) error {
+	return g.leases.Release(region, g.config.Actor)
+}
+
+// CheckWrite returns an error with `ErrLeaseHeld` cause if the vertex with the given key
+// is in a region leased by another actor, so applications can check before starting an edit.
+func (g LeasedGraph) CheckWrite(key string) error {
+	for _, lease := range g.leases.Covering(key) {
+		if lease.Holder != g.config.Actor {
+			return errors.Wrapf(ErrLeaseHeld, "vertex %q is in region %q leased by %q until %s",
+				key, lease.Region, lease.Holder, lease.Expires)
+		}
+	}
+	return nil
+}
+
+// AddVertex adds the vertex like `Graph.AddVertex` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) AddVertex(v Vertex) error {
+	err := g.check(v.Key)
+	if err != nil {
+		return err
+	}
+	return g.Graph.AddVertex(v)
+}
+
+// UpdateVertex replaces the vertex value like `Graph.UpdateVertex` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) UpdateVertex(v Vertex) error {
+	err := g.check(v.Key)
+	if err != nil {
+		return err
+	}
+	return g.Graph.UpdateVertex(v)
+}
+
+// UpsertVertex adds or replaces the vertex like `Graph.UpsertVertex` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) UpsertVertex(v Vertex) error {
+	err := g.check(v.Key)
+	if err != nil {
+		return err
+	}
+	return g.Graph.UpsertVertex(v)
+}
+
+// RemoveVertex removes the vertex like `Graph.RemoveVertex` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) RemoveVertex(key string) error {
+	err := g.check(key)
+	if err != nil {
+		return err
+	}
+	return g.Graph.RemoveVertex(key)
+}
+
+// AddEdge adds the edge like `Graph.AddEdge` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) AddEdge(fromKey, toKey string) error {
+	err := g.checkEdge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+	return g.Graph.AddEdge(fromKey, toKey)
+}
+
+// AddWeightedEdge adds the edge like `Graph.AddWeightedEdge` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) AddWeightedEdge(fromKey string, edge Edge) error {
+	err := g.checkEdge(fromKey, edge.To)
+	if err != nil {
+		return err
+	}
+	return g.Graph.AddWeightedEdge(fromKey, edge)
+}
+
+// RemoveEdge removes the edge like `Graph.RemoveEdge` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) RemoveEdge(fromKey, toKey string) error {
+	err := g.checkEdge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+	return g.Graph.RemoveEdge(fromKey, toKey)
+}
+
+// AddVertices adds the vertices like `Graph.AddVertices` does.
+// Returns an error with `ErrLeaseHeld` cause if the batch is deferred because of a lease of another actor,
+// nothing is added then.
+func (g LeasedGraph) AddVertices(vertices []Vertex) error {
+	return g.Update(addVertices(vertices))
+}
+
+// AddEdges adds the edges like `Graph.AddEdges` does.
+// Returns an error with `ErrLeaseHeld` cause if the batch is deferred because of a lease of another actor,
+// nothing is added then.
+func (g LeasedGraph) AddEdges(edges []EdgeSpec) error {
+	return g.Update(addEdges(edges))
+}
+
+// Update runs the transaction like `Graph.Update` does checking all the vertices and edges it changes.
+// Returns an error with `ErrLeaseHeld` cause if the changes are deferred because of a lease of another actor,
+// nothing is changed then.
+func (g LeasedGraph) Update(fn func(tx Tx) error) error {
+	return g.Graph.Update(func(tx Tx) error {
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+		return g.checkTx(tx)
+	})
+}
+
+// CompareAndAddVertex adds or replaces the vertex like `Graph.CompareAndAddVertex` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) CompareAndAddVertex(v Vertex, observed Version) (Record, error) {
+	err := g.check(v.Key)
+	if err != nil {
+		return g.ObserveVertex(v.Key), err
+	}
+	return g.Graph.CompareAndAddVertex(v, observed)
+}
+
+// CompareAndRemoveVertex removes the vertex like `Graph.CompareAndRemoveVertex` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) CompareAndRemoveVertex(key string, observed Version) (Record, error) {
+	err := g.check(key)
+	if err != nil {
+		return g.ObserveVertex(key), err
+	}
+	return g.Graph.CompareAndRemoveVertex(key, observed)
+}
+
+// AddEdgeAcyclic adds the edge like `Graph.AddEdgeAcyclic` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) AddEdgeAcyclic(fromKey, toKey string) error {
+	err := g.checkEdge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+	return g.Graph.AddEdgeAcyclic(fromKey, toKey)
+}
+
+// UpdateEdgeAttributes sets the attributes of the edge like `Graph.UpdateEdgeAttributes` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) UpdateEdgeAttributes(fromKey, toKey string, attributes map[string]string) error {
+	err := g.checkEdge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+	return g.Graph.UpdateEdgeAttributes(fromKey, toKey, attributes)
+}
+
+// UpdateEdgeWeight sets the weight of the edge like `Graph.UpdateEdgeWeight` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) UpdateEdgeWeight(fromKey, toKey string, weight int64) error {
+	err := g.checkEdge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+	return g.Graph.UpdateEdgeWeight(fromKey, toKey, weight)
+}
+
+// AddEdgeWeight adds to the weight counter of the edge like `Graph.AddEdgeWeight` does.
+// Returns an error with `ErrLeaseHeld` cause if the write is deferred because of a lease of another actor.
+func (g LeasedGraph) AddEdgeWeight(fromKey, toKey string, delta int64) error {
+	err := g.checkEdge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+	return g.Graph.AddEdgeWeight(fromKey, toKey, delta)
+}
+
+// check returns the error of `CheckWrite` if the writes are deferred,
+// otherwise it only reports the conflicting write
+func (g LeasedGraph) check(key string) error {
+	err := g.CheckWrite(key)
+	if err == nil || g.config.Defer {
+		return err
+	}
+
+	g.replica.Logger.Printf("actor %q writes to a leased region: %s", g.config.Actor, err)
+	g.replica.Metrics.Count("lww.graph.lease.conflict", 1)
+	return nil
+}
+
+// checkEdge checks both vertices of an edge
+func (g LeasedGraph) checkEdge(fromKey, toKey string) error {
+	err := g.check(fromKey)
+	if err != nil {
+		return err
+	}
+	return g.check(toKey)
+}
+
+// checkTx checks the vertices and the edges changed by the transaction in the key order
+func (g LeasedGraph) checkTx(tx Tx) error {
+	keys := make([]string, 0, len(tx.state.vertices))
+	for key := range tx.state.vertices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		err := g.check(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	fromKeys := make([]string, 0, len(tx.state.edges))
+	for fromKey := range tx.state.edges {
+		fromKeys = append(fromKeys, fromKey)
+	}
+	sort.Strings(fromKeys)
+	for _, fromKey := range fromKeys {
+		toKeys := make([]string, 0, len(tx.state.edges[fromKey]))
+		for toKey := range tx.state.edges[fromKey] {
+			toKeys = append(toKeys, toKey)
+		}
+		sort.Strings(toKeys)
+		for _, toKey := range toKeys {
+			err := g.checkEdge(fromKey, toKey)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeasedGraph(t *testing.T) {
+	start := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	// newReplicas returns leased graphs of two replicas used by alice and bob
+	newReplicas := func(t *testing.T, virtual clock.Virtual, config LeaseConfig) (alice, bob LeasedGraph) {
+		ra := crdt.Replica{ID: "A", Clock: virtual}
+		rb := crdt.Replica{ID: "B", Clock: virtual}
+		ga, gb := NewGraph(ra), NewGraph(rb)
+		for _, key := range []string{"v1", "v2", "v3", "v4"} {
+			require.NoError(t, ga.AddVertex(Vertex{Key: key}))
+		}
+		require.NoError(t, ga.AddEdge("v1", "v2"))
+		require.NoError(t, ga.AddEdge("v2", "v3"))
+		gb.Merge(ga)
+
+		config.Actor = "alice"
+		alice = NewLeasedGraph(ga, NewLeases(ra), config)
+		config.Actor = "bob"
+		bob = NewLeasedGraph(gb, NewLeases(rb), config)
+		return alice, bob
+	}
+
+	t.Run("other replicas defer edits of checked out regions", func(t *testing.T) {
+		virtual := clock.NewVirtual(start)
+		alice, bob := newReplicas(t, virtual, LeaseConfig{Defer: true})
+
+		lease, err := alice.CheckOutNeighborhood("editing", "v1", 1, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []string{"v1", "v2"}, lease.Keys)
+		bob.Leases().Merge(alice.Leases())
+
+		require.ErrorIs(t, bob.CheckWrite("v2"), ErrLeaseHeld)
+		require.NoError(t, bob.CheckWrite("v3"))
+		require.ErrorIs(t, bob.UpdateVertex(Vertex{Key: "v1", Value: "bob"}), ErrLeaseHeld)
+		require.ErrorIs(t, bob.RemoveVertex("v2"), ErrLeaseHeld)
+		require.ErrorIs(t, bob.AddEdge("v4", "v1"), ErrLeaseHeld, "edges to a region are in the region")
+		require.ErrorIs(t, bob.RemoveEdge("v2", "v3"), ErrLeaseHeld)
+		require.NoError(t, bob.AddEdge("v3", "v4"))
+		_, err = bob.CheckOut("editing", []string{"v3"}, time.Minute)
+		require.ErrorIs(t, err, ErrLeaseHeld)
+
+		require.NoError(t, alice.UpdateVertex(Vertex{Key: "v1", Value: "alice"}), "the holder edits the region")
+		virtual.Advance(time.Second)
+		require.NoError(t, alice.Release("editing"))
+		bob.Leases().Merge(alice.Leases())
+		require.NoError(t, bob.UpdateVertex(Vertex{Key: "v1", Value: "bob"}))
+	})
+
+	t.Run("other replicas defer batches, transactions and edge updates of checked out regions", func(t *testing.T) {
+		virtual := clock.NewVirtual(start)
+		alice, bob := newReplicas(t, virtual, LeaseConfig{Defer: true})
+
+		_, err := alice.CheckOut("editing", []string{"v1", "v5"}, time.Minute)
+		require.NoError(t, err)
+		bob.Leases().Merge(alice.Leases())
+
+		require.ErrorIs(t, bob.AddVertices([]Vertex{{Key: "v6"}, {Key: "v5"}}), ErrLeaseHeld)
+		_, err = bob.Lookup("v6")
+		require.ErrorIs(t, err, ErrVertexNotFound, "nothing of the deferred batch is added")
+		require.ErrorIs(t, bob.AddEdges([]EdgeSpec{{From: "v3", Edge: Edge{To: "v1"}}}), ErrLeaseHeld)
+		require.ErrorIs(t, bob.Update(func(tx Tx) error {
+			return tx.UpdateVertex(Vertex{Key: "v1", Value: "bob"})
+		}), ErrLeaseHeld)
+
+		observed := bob.ObserveVertex("v1")
+		record, err := bob.CompareAndAddVertex(Vertex{Key: "v1", Value: "bob"}, observed.Version)
+		require.ErrorIs(t, err, ErrLeaseHeld)
+		require.Equal(t, observed, record)
+		_, err = bob.CompareAndRemoveVertex("v1", observed.Version)
+		require.ErrorIs(t, err, ErrLeaseHeld)
+
+		require.ErrorIs(t, bob.UpdateEdgeWeight("v1", "v2", 5), ErrLeaseHeld)
+		require.ErrorIs(t, bob.UpdateEdgeAttributes("v1", "v2", map[string]string{"a": "b"}), ErrLeaseHeld)
+		require.ErrorIs(t, bob.AddEdgeWeight("v1", "v2", 5), ErrLeaseHeld)
+		require.ErrorIs(t, bob.AddEdgeAcyclic("v4", "v1"), ErrLeaseHeld)
+
+		found, err := bob.Lookup("v1")
+		require.NoError(t, err)
+		require.Equal(t, Vertex{Key: "v1"}, found)
+		edge, err := bob.GetEdge("v1", "v2")
+		require.NoError(t, err)
+		require.Equal(t, Edge{To: "v2"}, edge)
+
+		require.NoError(t, bob.AddVertices([]Vertex{{Key: "v6"}}))
+		require.NoError(t, bob.AddEdges([]EdgeSpec{{From: "v3", Edge: Edge{To: "v6"}}}))
+	})
+
+	t.Run("leases expire", func(t *testing.T) {
+		virtual := clock.NewVirtual(start)
+		alice, bob := newReplicas(t, virtual, LeaseConfig{Defer: true})
+
+		_, err := alice.CheckOut("editing", []string{"v1"}, time.Minute)
+		require.NoError(t, err)
+		bob.Leases().Merge(alice.Leases())
+		require.ErrorIs(t, bob.RemoveVertex("v1"), ErrLeaseHeld)
+
+		virtual.Advance(time.Minute)
+		require.NoError(t, bob.RemoveVertex("v1"))
+	})
+
+	t.Run("edits are only reported without deferring", func(t *testing.T) {
+		virtual := clock.NewVirtual(start)
+		alice, bob := newReplicas(t, virtual, LeaseConfig{})
+
+		_, err := alice.CheckOut("editing", []string{"v1"}, time.Minute)
+		require.NoError(t, err)
+		bob.Leases().Merge(alice.Leases())
+
+		require.ErrorIs(t, bob.CheckWrite("v1"), ErrLeaseHeld)
+		require.NoError(t, bob.UpdateVertex(Vertex{Key: "v1", Value: "bob"}))
+
+		alice.Merge(bob.Graph)
+		found, err := alice.Lookup("v1")
+		require.NoError(t, err)
+		require.Equal(t, "bob", found.Value, "merges are never affected")
+	})
+}
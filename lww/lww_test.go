@@ -4,9 +4,13 @@ import (
 	"sort"
 	"testing"
 
+	"github.com/rdner/crdt"
 	"github.com/stretchr/testify/require"
 )
 
+// testReplica is the replica used by all the CRDTs in tests
+var testReplica = crdt.NewReplica("test")
+
 func sortElements(list []Element) {
 	sort.Slice(list, func(i, j int) bool {
 		return list[i].GetKey() < list[j].GetKey()
@@ -0,0 +1,180 @@
+package lww
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+// DefaultMergeProgressInterval is the default number of processed records between progress reports
+const DefaultMergeProgressInterval = 10000
+
+// MergeProgress describes how far a merge got
+type MergeProgress struct {
+	// Processed is the number of remote records merged so far
+	Processed int
+	// Total is the number of remote records to merge
+	Total int
+	// Elapsed is the time since the merge started
+	Elapsed time.Duration
+}
+
+// MergeConfig configures monitoring and cancellation of `MergeContext`
+type MergeConfig struct {
+	// Progress is called with the progress of the merge every `Interval` records and when the merge is done.
+	// It's called under the lock of the merged CRDT, so it must not access the CRDT and must return quickly.
+	// Optional.
+	Progress func(MergeProgress)
+	// Interval is the number of processed records between progress reports and context checks,
+	// `DefaultMergeProgressInterval` is used if it's not positive
+	Interval int
+}
+
+// MergeContext merges the `remote` set like `Merge` does, reporting the progress to `config.Progress`.
+//
+// The merge stops when the context is done and returns the context error. Records merged before that stay merged:
+// each record is merged on its own, so the set is a valid state with a part of the remote changes,
+// and merging the same remote again later completes the merge.
+func (s Set) MergeContext(ctx context.Context, remote Set, config MergeConfig) error {
+	tracker := newMergeTracker(ctx, config, len(remote.additions)+len(remote.removals), s.replica.MergeChunk)
+	err := s.merge(remote, setConflict, tracker, nil, nil)
+	if err != nil {
+		return err
+	}
+	tracker.report()
+	return nil
+}
+
+// MergeContext merges the `remote` graph like `Merge` does, reporting the progress to `config.Progress`.
+// Records of vertices, edges and edge weights are all counted.
+//
+// The merge stops when the context is done and returns the context error. Records merged before that stay merged:
+// each record is merged on its own, so the graph is a valid state with a part of the remote changes,
+// and merging the same remote again later completes the merge.
+func (g Graph) MergeContext(ctx context.Context, remote Graph, config MergeConfig) error {
+	total := len(remote.vertices.additions) + len(remote.vertices.removals)
+	for _, adjacent := range remote.edges {
+		total += len(adjacent.additions) + len(adjacent.removals)
+	}
+	for _, weights := range remote.weights {
+		total += len(weights)
+	}
+
+	tracker := newMergeTracker(ctx, config, total, g.replica.MergeChunk)
+	err := g.merge(remote, tracker, nil)
+	if err != nil {
+		return err
+	}
+	tracker.report()
+	return nil
+}
+
+// MergeContext merges the remote graph like `Graph.MergeContext` does and recounts the usage,
+// the usage is recounted even if the merge is canceled
+func (g QuotaGraph) MergeContext(ctx context.Context, remote Graph, config MergeConfig) error {
+	defer g.Recount()
+	return g.Graph.MergeContext(ctx, remote, config)
+}
+
+// mergeTracker reports the progress of a merge, checks the context
+// and releases the held locks every chunk of records (see `crdt.Replica.MergeChunk`)
+type mergeTracker struct {
+	ctx       context.Context
+	config    MergeConfig
+	started   time.Time
+	processed int
+	total     int
+	chunk     int
+	// locks are the locks held by the merge in the order they were taken
+	locks []sync.Locker
+}
+
+// newMergeTracker returns a tracker of a merge of `total` records yielding the held locks every `chunk` records,
+// zero `chunk` never yields
+func newMergeTracker(ctx context.Context, config MergeConfig, total, chunk int) *mergeTracker {
+	if config.Interval <= 0 {
+		config.Interval = DefaultMergeProgressInterval
+	}
+	return &mergeTracker{
+		ctx:     ctx,
+		config:  config,
+		started: time.Now(),
+		total:   total,
+		chunk:   chunk,
+	}
+}
+
+// chunkedMergeTracker returns a tracker of a merge without monitoring and cancellation
+// if the replica merges in chunks, otherwise `nil`
+func chunkedMergeTracker(r crdt.Replica) *mergeTracker {
+	if r.MergeChunk <= 0 {
+		return nil
+	}
+	return newMergeTracker(context.Background(), MergeConfig{}, 0, r.MergeChunk)
+}
+
+// hold must be called right after the merge takes a lock, so the lock is released between chunks,
+// `release` must be called before the lock is unlocked. It's a no-op on a `nil` tracker.
+func (t *mergeTracker) hold(l sync.Locker) {
+	if t == nil {
+		return
+	}
+	t.locks = append(t.locks, l)
+}
+
+// release stops releasing the lastly held lock between chunks. It's a no-op on a `nil` tracker.
+func (t *mergeTracker) release() {
+	if t == nil {
+		return
+	}
+	t.locks = t.locks[:len(t.locks)-1]
+}
+
+// step must be called before merging each record, it returns an error if the merge must stop.
+// It's a no-op on a `nil` tracker.
+func (t *mergeTracker) step() error {
+	if t == nil {
+		return nil
+	}
+
+	if t.chunk > 0 && t.processed != 0 && t.processed%t.chunk == 0 {
+		t.yield()
+	}
+	if t.processed%t.config.Interval == 0 {
+		if err := t.ctx.Err(); err != nil {
+			return errors.Wrapf(err, "merge stopped after %d of %d records", t.processed, t.total)
+		}
+		if t.processed != 0 {
+			t.report()
+		}
+	}
+	t.processed++
+	return nil
+}
+
+// yield releases the held locks in the reverse order, lets other goroutines run and takes the locks again
+func (t *mergeTracker) yield() {
+	for i := len(t.locks) - 1; i >= 0; i-- {
+		t.locks[i].Unlock()
+	}
+	runtime.Gosched()
+	for _, l := range t.locks {
+		l.Lock()
+	}
+}
+
+// report calls the progress callback if it's set
+func (t *mergeTracker) report() {
+	if t.config.Progress == nil {
+		return
+	}
+	t.config.Progress(MergeProgress{
+		Processed: t.processed,
+		Total:     t.total,
+		Elapsed:   time.Since(t.started),
+	})
+}
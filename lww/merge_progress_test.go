@@ -0,0 +1,147 @@
+package lww
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeProgress(t *testing.T) {
+	newRemote := func(t *testing.T, vertices int) Graph {
+		g := NewGraph(crdt.NewReplica("remote"))
+		for i := 0; i < vertices; i++ {
+			require.NoError(t, g.AddVertex(Vertex{Key: fmt.Sprintf("v%d", i)}))
+			if i > 0 {
+				require.NoError(t, g.AddEdge(fmt.Sprintf("v%d", i), "v0"))
+			}
+		}
+		require.NoError(t, g.AddEdgeWeight("v1", "v0", 1))
+		require.NoError(t, g.RemoveVertex("v2"))
+		return g
+	}
+
+	t.Run("reports the progress of the graph merge", func(t *testing.T) {
+		remote := newRemote(t, 10)
+		local := NewGraph(crdt.NewReplica("local"))
+
+		var reports []MergeProgress
+		err := local.MergeContext(context.Background(), remote, MergeConfig{
+			Interval: 5,
+			Progress: func(p MergeProgress) { reports = append(reports, p) },
+		})
+		require.NoError(t, err)
+
+		// 10 vertices, 1 vertex removal, 9 edges, 1 weight
+		total := 21
+		require.Len(t, reports, 5)
+		for i, p := range reports[:4] {
+			require.Equal(t, (i+1)*5, p.Processed)
+		}
+		require.Equal(t, total, reports[4].Processed)
+		for _, p := range reports {
+			require.Equal(t, total, p.Total)
+			require.GreaterOrEqual(t, int64(p.Elapsed), int64(0))
+		}
+
+		expected := NewGraph(crdt.NewReplica("expected"))
+		expected.Merge(remote)
+		requireEqualGraphs(t, expected, local)
+	})
+
+	t.Run("reports the progress of the set merge", func(t *testing.T) {
+		remote := NewSet(crdt.NewReplica("remote"))
+		remote.Add(IDElement("a"))
+		remote.Add(IDElement("b"))
+		remote.Remove("c")
+		local := NewSet(crdt.NewReplica("local"))
+
+		var reports []MergeProgress
+		err := local.MergeContext(context.Background(), remote, MergeConfig{
+			Progress: func(p MergeProgress) { reports = append(reports, p) },
+		})
+		require.NoError(t, err)
+		require.Len(t, reports, 1, "the default interval reports only the end of small merges")
+		require.Equal(t, 3, reports[0].Processed)
+		require.Equal(t, 3, reports[0].Total)
+		require.Len(t, local.List(), 2)
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		remote := newRemote(t, 10)
+		local := NewGraph(crdt.NewReplica("local"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var reports []MergeProgress
+		err := local.MergeContext(ctx, remote, MergeConfig{
+			Interval: 4,
+			Progress: func(p MergeProgress) {
+				reports = append(reports, p)
+				cancel()
+			},
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Len(t, reports, 1)
+		require.Equal(t, 4, reports[0].Processed)
+
+		// the merge is completed by merging the same remote again
+		require.NoError(t, local.MergeContext(context.Background(), remote, MergeConfig{}))
+		expected := NewGraph(crdt.NewReplica("expected"))
+		expected.Merge(remote)
+		requireEqualGraphs(t, expected, local)
+	})
+
+	t.Run("does not merge anything with a done context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		local := NewGraph(crdt.NewReplica("local"))
+		err := local.MergeContext(ctx, newRemote(t, 3), MergeConfig{})
+		require.ErrorIs(t, err, context.Canceled)
+
+		list, err := local.List()
+		require.NoError(t, err)
+		require.Empty(t, list)
+	})
+
+	t.Run("lets local writes in between chunks", func(t *testing.T) {
+		remote := newRemote(t, 5000)
+
+		merging := make(chan struct{})
+		var sources []crdt.Source
+		r := crdt.NewReplica("local")
+		r.MergeChunk = 10
+		r.Observer = crdt.ObserverFunc(func(m crdt.Mutation) {
+			if len(sources) == 0 {
+				close(merging)
+			}
+			sources = append(sources, m.Source)
+		})
+		local := NewGraph(r)
+
+		written := make(chan error)
+		go func() {
+			<-merging
+			written <- local.AddVertex(Vertex{Key: "local"})
+		}()
+		local.Merge(remote)
+		require.NoError(t, <-written)
+
+		// the local write is applied before the rest of the merge
+		require.Equal(t, crdt.SourceMerge, sources[len(sources)-1])
+		_, err := local.Lookup("local")
+		require.NoError(t, err)
+	})
+}
+
+// requireEqualGraphs asserts that both graphs have the same vertices and edges
+func requireEqualGraphs(t *testing.T, expected, actual Graph) {
+	t.Helper()
+	expectedList, err := expected.List()
+	require.NoError(t, err)
+	actualList, err := actual.List()
+	require.NoError(t, err)
+	require.Equal(t, expectedList, actualList)
+}
@@ -0,0 +1,65 @@
+package lww
+
+import (
+	"github.com/rdner/crdt"
+)
+
+// MergeReport lists the last-writer-wins decisions of a merge, so applications can notify users
+// whose changes were overwritten or log data-loss events.
+// Merging the same remote state again reports the same rejected operations but no overwritten ones.
+type MergeReport struct {
+	// Overwritten are the local operations overwritten by the remote ones,
+	// `Winner` is the remote operation and `Loser` is the local one
+	Overwritten []crdt.Conflict
+	// Rejected are the remote operations that lost to the local ones,
+	// `Winner` is the local operation and `Loser` is the remote one
+	Rejected []crdt.Conflict
+}
+
+// Empty returns `true` if the merge had no conflicts
+func (r MergeReport) Empty() bool {
+	return len(r.Overwritten) == 0 && len(r.Rejected) == 0
+}
+
+// add adds the decision to the report. It's a no-op on a `nil` report.
+func (r *MergeReport) add(c crdt.Conflict, remoteWon bool) {
+	if r == nil {
+		return
+	}
+	if remoteWon {
+		r.Overwritten = append(r.Overwritten, c)
+	} else {
+		r.Rejected = append(r.Rejected, c)
+	}
+}
+
+// MergeWithReport merges the `remote` set like `Merge` does and returns the report
+// of every key where one of the replicas overwrote the other one
+func (s Set) MergeWithReport(remote Set) MergeReport {
+	report := MergeReport{
+		Overwritten: []crdt.Conflict{},
+		Rejected:    []crdt.Conflict{},
+	}
+	// merging without cancellation cannot fail
+	_ = s.merge(remote, setConflict, chunkedMergeTracker(s.replica), nil, &report)
+	return report
+}
+
+// MergeWithReport merges the `remote` graph like `Merge` does and returns the report
+// of every vertex and edge where one of the replicas overwrote the other one.
+// Edge conflicts have `AdjacentKey` set, edge weights are counters and never conflict.
+func (g Graph) MergeWithReport(remote Graph) MergeReport {
+	report := MergeReport{
+		Overwritten: []crdt.Conflict{},
+		Rejected:    []crdt.Conflict{},
+	}
+	// merging without cancellation cannot fail
+	_ = g.merge(remote, chunkedMergeTracker(g.replica), &report)
+	return report
+}
+
+// MergeWithReport merges the remote graph like `Graph.MergeWithReport` does and recounts the usage
+func (g QuotaGraph) MergeWithReport(remote Graph) MergeReport {
+	defer g.Recount()
+	return g.Graph.MergeWithReport(remote)
+}
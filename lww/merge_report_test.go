@@ -0,0 +1,85 @@
+package lww
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeWithReport(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	replica := func(id string, offset time.Duration) crdt.Replica {
+		return crdt.Replica{
+			ID:    id,
+			Clock: clock.Func(func() time.Time { return base.Add(offset) }),
+		}
+	}
+	early := func(id string, removal bool) crdt.ConflictOp {
+		return crdt.ConflictOp{Replica: id, Timestamp: base, Removal: removal}
+	}
+	late := func(id string, removal bool) crdt.ConflictOp {
+		return crdt.ConflictOp{Replica: id, Timestamp: base.Add(time.Second), Removal: removal}
+	}
+
+	t.Run("reports set conflicts in both directions", func(t *testing.T) {
+		local := NewSet(replica("local", time.Second))
+		remote := NewSet(replica("remote", 0))
+		local.Add(IDElement("kept"))
+		remote.Add(IDElement("kept"))
+		remote.Add(IDElement("new"))
+		local.Remove("removed")
+		remote.Remove("removed")
+
+		report := local.MergeWithReport(remote)
+		require.Equal(t, MergeReport{
+			Overwritten: []crdt.Conflict{},
+			Rejected: []crdt.Conflict{
+				{Kind: SetKind, Key: "kept", Winner: late("local", false), Loser: early("remote", false), MergedAt: base.Add(time.Second)},
+				{Kind: SetKind, Key: "removed", Winner: late("local", true), Loser: early("remote", true), MergedAt: base.Add(time.Second)},
+			},
+		}, report)
+
+		report = remote.MergeWithReport(local)
+		require.Equal(t, []crdt.Conflict{
+			{Kind: SetKind, Key: "kept", Winner: late("local", false), Loser: early("remote", false), MergedAt: base},
+			{Kind: SetKind, Key: "removed", Winner: late("local", true), Loser: early("remote", true), MergedAt: base},
+		}, report.Overwritten)
+		require.Empty(t, report.Rejected)
+	})
+
+	t.Run("reports vertex and edge conflicts of the graph", func(t *testing.T) {
+		local := NewGraph(replica("local", 0))
+		remote := NewGraph(replica("remote", time.Second))
+		for _, g := range []Graph{local, remote} {
+			require.NoError(t, g.AddVertex(Vertex{Key: "v1", Value: g.replica.ID}))
+			require.NoError(t, g.AddVertex(Vertex{Key: "v2"}))
+			require.NoError(t, g.AddEdge("v1", "v2"))
+			require.NoError(t, g.AddEdgeWeight("v1", "v2", 1))
+		}
+
+		report := local.MergeWithReport(remote)
+		sort.Slice(report.Overwritten, func(i, j int) bool {
+			return report.Overwritten[i].Key+report.Overwritten[i].AdjacentKey <
+				report.Overwritten[j].Key+report.Overwritten[j].AdjacentKey
+		})
+		require.Equal(t, MergeReport{
+			Overwritten: []crdt.Conflict{
+				{Kind: GraphKind, Key: "v1", Winner: late("remote", false), Loser: early("local", false), MergedAt: base},
+				{Kind: GraphKind, Key: "v1", AdjacentKey: "v2", Winner: late("remote", false), Loser: early("local", false), MergedAt: base},
+				{Kind: GraphKind, Key: "v2", Winner: late("remote", false), Loser: early("local", false), MergedAt: base},
+			},
+			Rejected: []crdt.Conflict{},
+		}, report)
+
+		v, err := local.Lookup("v1")
+		require.NoError(t, err)
+		require.Equal(t, "remote", v.Value)
+
+		// the overwritten operations are gone, so merging again reports nothing
+		require.True(t, local.MergeWithReport(remote).Empty())
+	})
+}
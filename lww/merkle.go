@@ -0,0 +1,383 @@
+package lww
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MerkleDepth is the depth of the Merkle tree produced by `Digest`.
+// The key space is split into `2^MerkleDepth` buckets by the hash of the key.
+const MerkleDepth = 8
+
+// merkleLeaves is the number of leaves (buckets) of the Merkle tree
+const merkleLeaves = 1 << MerkleDepth
+
+var (
+	// ErrInvalidMerkleTree occurs when comparing with a Merkle tree of an unexpected shape
+	ErrInvalidMerkleTree = errors.New("invalid Merkle tree")
+)
+
+// MerkleTree is a hash tree over all the keyed records of a set or a graph including removed ones.
+// Every leaf is a hash of the records in a bucket of the key space, every other node is a hash of its children.
+// Replicas with the same state have the same trees, so comparing the root is enough to detect divergence,
+// and comparing the trees top-down finds the divergent buckets without shipping the full state.
+//
+// The tree can be serialized to JSON and sent to other replicas.
+type MerkleTree struct {
+	// Nodes contains the node hashes in the breadth-first order: `Nodes[0]` is the root,
+	// children of `Nodes[i]` are `Nodes[2i+1]` and `Nodes[2i+2]`, the last `2^MerkleDepth` nodes are the leaves.
+	Nodes [][]byte `json:"nodes"`
+}
+
+// Root returns the hex-encoded hash of the tree root, it's equal for replicas with the same state
+func (t MerkleTree) Root() string {
+	if len(t.Nodes) == 0 {
+		return ""
+	}
+	return hex.EncodeToString(t.Nodes[0])
+}
+
+// Diff compares the tree with the tree of a `remote` replica and returns the key ranges
+// where the states diverge. Adjacent divergent buckets are combined into a single range.
+// Returns nil if the states are equal.
+func (t MerkleTree) Diff(remote MerkleTree) ([]KeyRange, error) {
+	if len(t.Nodes) != 2*merkleLeaves-1 || len(remote.Nodes) != len(t.Nodes) {
+		return nil, errors.Wrapf(ErrInvalidMerkleTree, "expected %d nodes, got %d and %d", 2*merkleLeaves-1, len(t.Nodes), len(remote.Nodes))
+	}
+
+	var (
+		ranges []KeyRange
+		walk   func(node int)
+	)
+	walk = func(node int) {
+		if string(t.Nodes[node]) == string(remote.Nodes[node]) {
+			return
+		}
+		if node < merkleLeaves-1 {
+			walk(2*node + 1)
+			walk(2*node + 2)
+			return
+		}
+
+		bucket := uint32(node - (merkleLeaves - 1))
+		if len(ranges) > 0 && ranges[len(ranges)-1].To == bucket {
+			ranges[len(ranges)-1].To++
+			return
+		}
+		ranges = append(ranges, KeyRange{From: bucket, To: bucket + 1})
+	}
+	walk(0)
+
+	return ranges, nil
+}
+
+// KeyRange is a range of buckets `[From, To)` of the key space split by `MerkleDepth`
+type KeyRange struct {
+	// From is the first bucket of the range
+	From uint32 `json:"from"`
+	// To is the bucket right after the last bucket of the range
+	To uint32 `json:"to"`
+}
+
+// Contains returns `true` if the key belongs to the range
+func (r KeyRange) Contains(key string) bool {
+	bucket := keyBucket(key)
+	return bucket >= r.From && bucket < r.To
+}
+
+// inRanges returns `true` if the key belongs to any of the ranges
+func inRanges(ranges []KeyRange, key string) bool {
+	for _, r := range ranges {
+		if r.Contains(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyBucket returns the bucket of the key space the key belongs to
+func keyBucket(key string) uint32 {
+	hash := sha256.Sum256([]byte(key))
+	return uint32(binary.BigEndian.Uint16(hash[:2])) >> (16 - MerkleDepth)
+}
+
+// Digest returns the Merkle tree over all the records of the set.
+// The tree must be compared only with trees produced by `Set.Digest`.
+func (s Set) Digest() (MerkleTree, error) {
+	leaves := newMerkleLeaves()
+
+	records := s.records("")
+	for _, key := range sortedRecordKeys(records) {
+		err := writeRecord(leaves[keyBucket(key)], key, records[key])
+		if err != nil {
+			return MerkleTree{}, err
+		}
+	}
+
+	return buildMerkleTree(leaves), nil
+}
+
+// Subset returns a new set containing only the records with keys in the given ranges,
+// so only the divergent part of the state can be sent to another replica and merged there.
+func (s Set) Subset(ranges []KeyRange) Set {
+	subset := NewSetWithDecoder(s.replica, s.decode)
+	subset.mutation = s.mutation
+	for key, record := range s.records("") {
+		if !inRanges(ranges, key) {
+			continue
+		}
+		subset.restoreRecord(key, record)
+	}
+
+	return subset
+}
+
+// Digest returns the Merkle tree over all the records of the graph:
+// vertices, edges and edge weights. An edge belongs to the bucket of the vertex it starts from.
+// The tree must be compared only with trees produced by `Graph.Digest`.
+func (g Graph) Digest() (MerkleTree, error) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	leaves := newMerkleLeaves()
+
+	vertices := g.vertices.records("")
+	for _, key := range sortedRecordKeys(vertices) {
+		err := writeRecord(leaves[keyBucket(key)], key, vertices[key])
+		if err != nil {
+			return MerkleTree{}, err
+		}
+	}
+
+	fromKeys := make([]string, 0, len(g.edges))
+	for fromKey := range g.edges {
+		fromKeys = append(fromKeys, fromKey)
+	}
+	sort.Strings(fromKeys)
+
+	for _, fromKey := range fromKeys {
+		leaf := leaves[keyBucket(fromKey)]
+		edges := g.edges[fromKey].records("")
+		for _, toKey := range sortedRecordKeys(edges) {
+			writeString(leaf, fromKey)
+			err := writeRecord(leaf, toKey, edges[toKey])
+			if err != nil {
+				return MerkleTree{}, err
+			}
+		}
+	}
+
+	weightKeys := make([]string, 0, len(g.weights))
+	for fromKey := range g.weights {
+		weightKeys = append(weightKeys, fromKey)
+	}
+	sort.Strings(weightKeys)
+
+	for _, fromKey := range weightKeys {
+		leaf := leaves[keyBucket(fromKey)]
+		toKeys := make([]string, 0, len(g.weights[fromKey]))
+		for toKey := range g.weights[fromKey] {
+			toKeys = append(toKeys, toKey)
+		}
+		sort.Strings(toKeys)
+
+		for _, toKey := range toKeys {
+			// zero contributions are left out, so counters that only saw zero updates
+			// hash the same as the counters that don't exist
+			canonical := g.weights[fromKey][toKey].Contributions()
+			if len(canonical) == 0 {
+				continue
+			}
+			contributions, err := json.Marshal(canonical)
+			if err != nil {
+				return MerkleTree{}, errors.Wrapf(err, "failed to hash edge weight [from = %q, to = %q]", fromKey, toKey)
+			}
+			writeString(leaf, fromKey)
+			writeString(leaf, toKey)
+			writeString(leaf, string(contributions))
+		}
+	}
+
+	return buildMerkleTree(leaves), nil
+}
+
+// Subset returns a new graph containing only the vertices, edges and edge weights
+// with keys in the given ranges, so only the divergent part of the state can be sent
+// to another replica and merged there. An edge belongs to the range of the vertex it starts from.
+func (g Graph) Subset(ranges []KeyRange) Graph {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	subset := NewGraph(g.replica)
+
+	for key, record := range g.vertices.records("") {
+		if inRanges(ranges, key) {
+			subset.vertices.restoreRecord(key, record)
+		}
+	}
+
+	for fromKey, edges := range g.edges {
+		if !inRanges(ranges, fromKey) {
+			continue
+		}
+		for toKey, record := range edges.records("") {
+			subset.getAdjacent(fromKey).restoreRecord(toKey, record)
+		}
+	}
+
+	for fromKey, weights := range g.weights {
+		if !inRanges(ranges, fromKey) {
+			continue
+		}
+		for toKey, weight := range weights {
+			subset.getWeight(fromKey, toKey).Merge(weight)
+		}
+	}
+	subset.reindex()
+
+	return subset
+}
+
+// restoreRecord sets the state of the key in the set to the given record
+func (s Set) restoreRecord(key string, record elementRecord) {
+	element := record.element
+	if element == nil {
+		// only removed, the removal is tracked by the key
+		element = IDElement(key)
+	}
+	s.restore(element, record)
+}
+
+// newMerkleLeaves returns the hash functions for every leaf of the tree
+func newMerkleLeaves() []hash.Hash {
+	leaves := make([]hash.Hash, 0, merkleLeaves)
+	for i := 0; i < merkleLeaves; i++ {
+		leaves = append(leaves, sha256.New())
+	}
+	return leaves
+}
+
+// buildMerkleTree computes all the nodes of the tree from its leaves
+func buildMerkleTree(leaves []hash.Hash) MerkleTree {
+	nodes := make([][]byte, 2*merkleLeaves-1)
+	for i, leaf := range leaves {
+		nodes[merkleLeaves-1+i] = leaf.Sum(nil)
+	}
+	for i := merkleLeaves - 2; i >= 0; i-- {
+		h := sha256.New()
+		_, _ = h.Write(nodes[2*i+1])
+		_, _ = h.Write(nodes[2*i+2])
+		nodes[i] = h.Sum(nil)
+	}
+
+	return MerkleTree{Nodes: nodes}
+}
+
+// writeRecord writes the key and the canonical record state to the hash:
+// the uncompressed elements, the timestamps, the observed additions and the siblings,
+// so replicas with different compression and eviction settings have equal digests.
+func writeRecord(h hash.Hash, key string, record elementRecord) error {
+	writeString(h, key)
+
+	err := writeElement(h, record.element)
+	if err != nil {
+		return errors.Wrapf(err, "failed to hash element [key = %q]", key)
+	}
+
+	writeTime(h, record.addedAt)
+	writeString(h, record.addedBy)
+	writeTime(h, record.removedAt)
+	writeString(h, record.removedBy)
+	writeObserved(h, record.observed)
+
+	siblings := make([]addRecord, len(record.siblings))
+	copy(siblings, record.siblings)
+	sort.Slice(siblings, func(i, j int) bool {
+		return newer(siblings[i].Timestamp, siblings[i].Replica, siblings[j].Timestamp, siblings[j].Replica)
+	})
+	writeCount(h, len(siblings))
+	for _, sibling := range siblings {
+		err = writeElement(h, sibling.Element)
+		if err != nil {
+			return errors.Wrapf(err, "failed to hash sibling [key = %q, replica = %q]", key, sibling.Replica)
+		}
+		timestamp := sibling.Timestamp
+		writeTime(h, &timestamp)
+		writeString(h, sibling.Replica)
+		writeObserved(h, sibling.Observed)
+	}
+
+	return nil
+}
+
+// writeElement writes the uncompressed serialized element to the hash, nil is written as an empty string
+func writeElement(h hash.Hash, e Element) error {
+	var err error
+	switch v := e.(type) {
+	case nil:
+		writeString(h, "")
+		return nil
+	case compressedVertex:
+		e, err = v.vertex()
+	case evictedVertex:
+		e, err = v.vertex()
+	}
+	if err != nil {
+		return err
+	}
+
+	element, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	writeString(h, string(element))
+	return nil
+}
+
+// writeObserved writes the observed additions to the hash ordered by the replica ID
+func writeObserved(h hash.Hash, observed map[string]time.Time) {
+	replicas := make([]string, 0, len(observed))
+	for replica := range observed {
+		replicas = append(replicas, replica)
+	}
+	sort.Strings(replicas)
+
+	writeCount(h, len(replicas))
+	for _, replica := range replicas {
+		timestamp := observed[replica]
+		writeString(h, replica)
+		writeTime(h, &timestamp)
+	}
+}
+
+// writeCount writes the number of the following items to the hash
+func writeCount(h hash.Hash, n int) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	_, _ = h.Write(buf[:])
+}
+
+// writeString writes a length-prefixed string to the hash, so concatenations are not ambiguous
+func writeString(h hash.Hash, s string) {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(s)))
+	_, _ = h.Write(length[:])
+	_, _ = h.Write([]byte(s))
+}
+
+// writeTime writes the optional timestamp to the hash
+func writeTime(h hash.Hash, t *time.Time) {
+	var buf [9]byte
+	if t != nil {
+		buf[0] = 1
+		binary.BigEndian.PutUint64(buf[1:], uint64(t.UnixNano()))
+	}
+	_, _ = h.Write(buf[:])
+}
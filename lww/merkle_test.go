@@ -0,0 +1,181 @@
+package lww
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerkle(t *testing.T) {
+	t.Run("sets with the same state have equal digests", func(t *testing.T) {
+		A := NewSet(testReplica)
+		B := NewSet(testReplica)
+		A.Add(IDElement("element1"))
+		A.Remove("element2")
+		B.Merge(A)
+
+		treeA, err := A.Digest()
+		require.NoError(t, err)
+		treeB, err := B.Digest()
+		require.NoError(t, err)
+		require.Equal(t, treeA.Root(), treeB.Root())
+
+		ranges, err := treeA.Diff(treeB)
+		require.NoError(t, err)
+		require.Nil(t, ranges)
+	})
+
+	t.Run("reconciles sets by exchanging only divergent ranges", func(t *testing.T) {
+		A := NewSet(testReplica)
+		B := NewSet(testReplica)
+		for _, key := range []string{"element1", "element2", "element3", "element4"} {
+			A.Add(IDElement(key))
+		}
+		B.Merge(A)
+		B.Remove("element2")
+
+		treeA, err := A.Digest()
+		require.NoError(t, err)
+		treeB, err := B.Digest()
+		require.NoError(t, err)
+		require.NotEqual(t, treeA.Root(), treeB.Root())
+
+		ranges, err := treeB.Diff(treeA)
+		require.NoError(t, err)
+		require.Len(t, ranges, 1)
+		require.True(t, ranges[0].Contains("element2"))
+
+		subset := B.Subset(ranges)
+		for _, key := range []string{"element1", "element3", "element4"} {
+			if !ranges[0].Contains(key) {
+				require.NotContains(t, subset.records(""), key)
+			}
+		}
+
+		A.Merge(subset)
+		treeA, err = A.Digest()
+		require.NoError(t, err)
+		require.Equal(t, treeB.Root(), treeA.Root())
+		require.ElementsMatch(t, B.List(), A.List())
+	})
+
+	t.Run("reconciles graphs including edges and weights", func(t *testing.T) {
+		v1 := Vertex{Key: "vertex1", Value: "value1"}
+		v2 := Vertex{Key: "vertex2", Value: "value2"}
+		v3 := Vertex{Key: "vertex3", Value: "value3"}
+
+		A := NewGraph(crdt.NewReplica("A"))
+		for _, v := range []Vertex{v1, v2, v3} {
+			require.NoError(t, A.AddVertex(v))
+		}
+		require.NoError(t, A.AddEdge(v1.Key, v2.Key))
+
+		B := NewGraph(crdt.NewReplica("B"))
+		B.Merge(A)
+		require.NoError(t, B.AddEdge(v3.Key, v1.Key))
+		require.NoError(t, B.AddEdgeWeight(v1.Key, v2.Key, 5))
+
+		treeA, err := A.Digest()
+		require.NoError(t, err)
+		treeB, err := B.Digest()
+		require.NoError(t, err)
+
+		// the tree survives serialization, so it can be sent to another replica
+		data, err := json.Marshal(treeA)
+		require.NoError(t, err)
+		var received MerkleTree
+		require.NoError(t, json.Unmarshal(data, &received))
+
+		ranges, err := treeB.Diff(received)
+		require.NoError(t, err)
+		require.NotEmpty(t, ranges)
+
+		A.Merge(B.Subset(ranges))
+		treeA, err = A.Digest()
+		require.NoError(t, err)
+		require.Equal(t, treeB.Root(), treeA.Root())
+
+		weight, err := A.EdgeWeight(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), weight)
+
+		listA, err := A.List()
+		require.NoError(t, err)
+		listB, err := B.List()
+		require.NoError(t, err)
+		require.Equal(t, listB, listA)
+	})
+
+	t.Run("zero weight updates do not change the digest", func(t *testing.T) {
+		v1 := Vertex{Key: "vertex1", Value: "value1"}
+		v2 := Vertex{Key: "vertex2", Value: "value2"}
+
+		A := NewGraph(crdt.NewReplica("A"))
+		require.NoError(t, A.AddVertex(v1))
+		require.NoError(t, A.AddVertex(v2))
+		require.NoError(t, A.AddEdge(v1.Key, v2.Key))
+		B := NewGraph(crdt.NewReplica("B"))
+		B.Merge(A)
+
+		require.NoError(t, B.AddEdgeWeight(v1.Key, v2.Key, 0))
+		// states persisted before zero updates were ignored contain empty counters
+		B.getWeight(v2.Key, v1.Key)
+
+		treeA, err := A.Digest()
+		require.NoError(t, err)
+		treeB, err := B.Digest()
+		require.NoError(t, err)
+		require.Equal(t, treeA.Root(), treeB.Root())
+
+		diff, err := treeA.Diff(treeB)
+		require.NoError(t, err)
+		require.Empty(t, diff)
+	})
+
+	t.Run("hashes the canonical records", func(t *testing.T) {
+		now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+		replica := func(threshold int) crdt.Replica {
+			r := crdt.NewReplica("A")
+			r.Clock = clock.Func(func() time.Time { return now })
+			r.Compression.Threshold = threshold
+			return r
+		}
+		large := Vertex{Key: "v1", Value: strings.Repeat("value", 100)}
+
+		plain := NewGraph(replica(0))
+		compressed := NewGraph(replica(64))
+		require.NoError(t, plain.AddVertex(large))
+		require.NoError(t, compressed.AddVertex(large))
+		element, err := compressed.vertices.Lookup(large.Key)
+		require.NoError(t, err)
+		require.IsType(t, compressedVertex{}, element)
+
+		plainTree, err := plain.Digest()
+		require.NoError(t, err)
+		compressedTree, err := compressed.Digest()
+		require.NoError(t, err)
+		require.Equal(t, plainTree.Root(), compressedTree.Root(), "compression does not change the digest")
+
+		compressed.vertices.siblings[large.Key] = []addRecord{{
+			Element:   Vertex{Key: large.Key, Value: "concurrent"},
+			Timestamp: now,
+			Replica:   "B",
+		}}
+		compressedTree, err = compressed.Digest()
+		require.NoError(t, err)
+		require.NotEqual(t, plainTree.Root(), compressedTree.Root(), "siblings change the digest")
+	})
+
+	t.Run("returns ErrInvalidMerkleTree for trees of another shape", func(t *testing.T) {
+		tree, err := NewSet(testReplica).Digest()
+		require.NoError(t, err)
+
+		_, err = tree.Diff(MerkleTree{})
+		require.ErrorIs(t, err, ErrInvalidMerkleTree)
+	})
+}
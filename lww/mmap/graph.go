@@ -0,0 +1,391 @@
+// Package mmap publishes snapshots of `lww.Graph` as files that other processes (e.g. analytics jobs)
+// map into memory read-only and query with the same API as the graph (`Lookup`, `List`, `FindPath`,
+// `FindConnected`), so every consumer of a multi-GB graph shares the page cache instead of holding a copy.
+//
+// The file contains only the observable state: the vertices with their values and the adjacent keys
+// of every vertex, tombstones and timestamps are left out, so it can't be merged back into a replica.
+// All the numbers are little-endian:
+//
+//	header    magic "CRDTGMAP", version uint32, vertex count uint32, edge count uint64,
+//	          offset of the strings uint64
+//	vertices  per vertex sorted by key: key offset uint64, key length uint32, value length uint32
+//	          (the value follows the key), offset of the first edge uint64, edge count uint32, padding uint32
+//	edges     per edge sorted by the target key: target key offset uint64, target key length uint32, padding uint32
+//	strings   keys and values
+package mmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+var (
+	// ErrCorrupted occurs when a file is not a published graph or it's damaged
+	ErrCorrupted = errors.New("corrupted graph file")
+)
+
+const (
+	// magic identifies published graph files
+	magic = "CRDTGMAP"
+	// version is the version of the file format
+	version = 1
+
+	headerSize = 32
+	vertexSize = 32
+	edgeSize   = 16
+)
+
+// nothing is a type with zero memory allocation
+type nothing struct{}
+
+// Publish writes the current state of the graph into a file at `path` for `Open`.
+// The file is written next to the destination and renamed, so processes that have the previous file open
+// keep reading it and processes opening the path afterwards read the new one.
+func Publish(g lww.Graph, path string) (err error) {
+	list, err := g.List()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create a file for publishing %q", path)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(encode(list))
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %q", tmp.Name())
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return errors.Wrapf(err, "failed to sync %q", tmp.Name())
+	}
+	err = tmp.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed to close %q", tmp.Name())
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to publish %q", path)
+	}
+	return nil
+}
+
+// encode returns the file contents of the listed graph
+func encode(list []lww.VertexWithEdges) []byte {
+	edgeCount := 0
+	for _, v := range list {
+		edgeCount += len(v.AdjacentKeys)
+	}
+	stringsOffset := headerSize + vertexSize*len(list) + edgeSize*edgeCount
+
+	le := binary.LittleEndian
+	tables := make([]byte, stringsOffset)
+	copy(tables, magic)
+	le.PutUint32(tables[8:], version)
+	le.PutUint32(tables[12:], uint32(len(list)))
+	le.PutUint64(tables[16:], uint64(edgeCount))
+	le.PutUint64(tables[24:], uint64(stringsOffset))
+
+	var strs bytes.Buffer
+	keyOffsets := make(map[string]uint64, len(list))
+	for i, v := range list {
+		entry := tables[headerSize+i*vertexSize:]
+		keyOffsets[v.Key] = uint64(stringsOffset + strs.Len())
+		le.PutUint64(entry, keyOffsets[v.Key])
+		le.PutUint32(entry[8:], uint32(len(v.Key)))
+		le.PutUint32(entry[12:], uint32(len(v.Value)))
+		strs.WriteString(v.Key)
+		strs.WriteString(v.Value)
+	}
+
+	edge := 0
+	for i, v := range list {
+		entry := tables[headerSize+i*vertexSize:]
+		le.PutUint64(entry[16:], uint64(edge))
+		le.PutUint32(entry[24:], uint32(len(v.AdjacentKeys)))
+		for _, toKey := range v.AdjacentKeys {
+			// edges to removed vertices have their own copy of the key
+			offset, live := keyOffsets[toKey]
+			if !live {
+				offset = uint64(stringsOffset + strs.Len())
+				strs.WriteString(toKey)
+			}
+			edgeEntry := tables[headerSize+len(list)*vertexSize+edge*edgeSize:]
+			le.PutUint64(edgeEntry, offset)
+			le.PutUint32(edgeEntry[8:], uint32(len(toKey)))
+			edge++
+		}
+	}
+
+	return append(tables, strs.Bytes()...)
+}
+
+// Open maps the graph file published by `Publish` into memory read-only.
+// `r` normalizes the keys of the queries, it must have the key normalizer of the published graph.
+// Close the graph when it's no longer needed.
+func Open(r crdt.Replica, path string) (Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Graph{}, errors.Wrapf(err, "failed to open %q", path)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Graph{}, errors.Wrapf(err, "failed to read the size of %q", path)
+	}
+	if info.Size() < headerSize {
+		return Graph{}, errors.Wrapf(ErrCorrupted, "%q is too short", path)
+	}
+
+	data, unmap, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return Graph{}, err
+	}
+
+	g := Graph{replica: r.WithDefaults(), data: data, unmap: unmap}
+	err = g.validate()
+	if err != nil {
+		_ = unmap()
+		return Graph{}, errors.Wrapf(err, "failed to open %q", path)
+	}
+	return g, nil
+}
+
+// Graph is a read-only graph mapped into memory from a file published by `Publish`.
+// Use `Open` in order to initialize it before use, it must not be used after `Close`.
+// The graph is thread-safe and can be used from several go routines.
+type Graph struct {
+	replica crdt.Replica
+	// data is the mapped file
+	data []byte
+	// unmap releases the mapped file
+	unmap func() error
+	// vertices is the number of vertices
+	vertices int
+	// edges is the offset of the edge table
+	edges int
+}
+
+// Close unmaps the file
+func (g Graph) Close() error {
+	err := g.unmap()
+	if err != nil {
+		return errors.Wrap(err, "failed to unmap the graph")
+	}
+	return nil
+}
+
+// Len returns the number of vertices
+func (g Graph) Len() int {
+	return g.vertices
+}
+
+// Lookup returns the vertex with the given key.
+// Returns an error with `lww.ErrVertexNotFound` cause if the vertex does not exist.
+func (g Graph) Lookup(key string) (lww.Vertex, error) {
+	i, found := g.find(g.replica.NormalizeKey(key))
+	if !found {
+		return lww.Vertex{}, errors.Wrapf(lww.ErrVertexNotFound, "failed to find vertex [key = %q]", key)
+	}
+	return g.vertex(i), nil
+}
+
+// List returns all the vertices with their adjacent keys sorted by key like `lww.Graph.List`
+func (g Graph) List() ([]lww.VertexWithEdges, error) {
+	list := make([]lww.VertexWithEdges, 0, g.vertices)
+	for i := 0; i < g.vertices; i++ {
+		adjacent := g.adjacent(i)
+		keys := make([]string, 0, len(adjacent))
+		for _, key := range adjacent {
+			keys = append(keys, string(key))
+		}
+		list = append(list, lww.VertexWithEdges{Vertex: g.vertex(i), AdjacentKeys: keys})
+	}
+	return list, nil
+}
+
+// FindConnected returns the vertices reachable from the vertex with the given key like `lww.Graph.FindConnected`,
+// the adjacent vertices are visited in the order of their keys.
+// Returns an error with `lww.ErrVertexNotFound` cause if the vertex does not exist.
+func (g Graph) FindConnected(key string) ([]lww.Vertex, error) {
+	start, found := g.find(g.replica.NormalizeKey(key))
+	if !found {
+		return nil, errors.Wrapf(lww.ErrVertexNotFound, "failed to find vertex [key = %q]", key)
+	}
+
+	connected := []lww.Vertex{}
+	// the start vertex is listed too if there is a loop back to it
+	visited := make(map[int]nothing)
+	queue := []int{start}
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, toKey := range g.adjacent(current) {
+			// some edges point to removed vertices
+			i, found := g.findBytes(toKey)
+			if !found {
+				continue
+			}
+			if _, isVisited := visited[i]; isVisited {
+				continue
+			}
+			visited[i] = nothing{}
+			connected = append(connected, g.vertex(i))
+			queue = append(queue, i)
+		}
+	}
+	return connected, nil
+}
+
+// FindPath returns a path from the vertex with `fromKey` to the vertex with `toKey` like `lww.Graph.FindPath`,
+// the adjacent vertices are visited in the order of their keys.
+// Returns an error with `lww.ErrVertexNotFound` cause if one of the vertices does not exist
+// and with `lww.ErrPathNotFound` cause if there is no path.
+func (g Graph) FindPath(fromKey, toKey string) ([]lww.Vertex, error) {
+	from, found := g.find(g.replica.NormalizeKey(fromKey))
+	if !found {
+		return nil, errors.Wrapf(lww.ErrVertexNotFound, "failed to find vertex [key = %q]", fromKey)
+	}
+	to, found := g.find(g.replica.NormalizeKey(toKey))
+	if !found {
+		return nil, errors.Wrapf(lww.ErrVertexNotFound, "failed to find vertex [key = %q]", toKey)
+	}
+
+	// depth-first traversal with path tracing
+	visited := make(map[int]nothing)
+	var search func(current int, path []int) []int
+	search = func(current int, path []int) []int {
+		if _, isVisited := visited[current]; isVisited {
+			return nil
+		}
+		visited[current] = nothing{}
+
+		for _, key := range g.adjacent(current) {
+			i, found := g.findBytes(key)
+			if !found {
+				continue
+			}
+			if i == to {
+				return append(path, i)
+			}
+			if found := search(i, append(path, i)); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	indexes := search(from, []int{from})
+	if indexes == nil {
+		return nil, lww.ErrPathNotFound
+	}
+	path := make([]lww.Vertex, 0, len(indexes))
+	for _, i := range indexes {
+		path = append(path, g.vertex(i))
+	}
+	return path, nil
+}
+
+// validate checks that the header and all the entries are within the file
+func (g *Graph) validate() error {
+	le := binary.LittleEndian
+	if string(g.data[:8]) != magic {
+		return errors.Wrap(ErrCorrupted, "not a graph file")
+	}
+	if v := le.Uint32(g.data[8:]); v != version {
+		return errors.Wrapf(ErrCorrupted, "unsupported version %d", v)
+	}
+
+	vertices := uint64(le.Uint32(g.data[12:]))
+	edges := le.Uint64(g.data[16:])
+	stringsOffset := le.Uint64(g.data[24:])
+	size := uint64(len(g.data))
+	if edges > size/edgeSize || stringsOffset != headerSize+vertices*vertexSize+edges*edgeSize || stringsOffset > size {
+		return errors.Wrap(ErrCorrupted, "invalid table sizes")
+	}
+	g.vertices, g.edges = int(vertices), headerSize+int(vertices)*vertexSize
+
+	inStrings := func(offset, length uint64) bool {
+		return offset >= stringsOffset && offset <= size && length <= size-offset
+	}
+	for i := 0; i < g.vertices; i++ {
+		entry := g.data[headerSize+i*vertexSize:]
+		keyOffset := le.Uint64(entry)
+		length := uint64(le.Uint32(entry[8:])) + uint64(le.Uint32(entry[12:]))
+		firstEdge, edgeCount := le.Uint64(entry[16:]), uint64(le.Uint32(entry[24:]))
+		if !inStrings(keyOffset, length) || firstEdge > edges || edgeCount > edges-firstEdge {
+			return errors.Wrapf(ErrCorrupted, "invalid vertex entry %d", i)
+		}
+		if i > 0 && bytes.Compare(g.key(i-1), g.key(i)) >= 0 {
+			return errors.Wrapf(ErrCorrupted, "vertices are not sorted at entry %d", i)
+		}
+	}
+	for i := uint64(0); i < edges; i++ {
+		entry := g.data[uint64(g.edges)+i*edgeSize:]
+		if !inStrings(le.Uint64(entry), uint64(le.Uint32(entry[8:]))) {
+			return errors.Wrapf(ErrCorrupted, "invalid edge entry %d", i)
+		}
+	}
+	return nil
+}
+
+// find returns the index of the vertex with the normalized key
+func (g Graph) find(key string) (int, bool) {
+	return g.findBytes([]byte(key))
+}
+
+// findBytes returns the index of the vertex with the normalized key
+func (g Graph) findBytes(key []byte) (int, bool) {
+	i := sort.Search(g.vertices, func(i int) bool {
+		return bytes.Compare(g.key(i), key) >= 0
+	})
+	return i, i < g.vertices && bytes.Equal(g.key(i), key)
+}
+
+// key returns the key of the i-th vertex without copying it
+func (g Graph) key(i int) []byte {
+	entry := g.data[headerSize+i*vertexSize:]
+	offset := binary.LittleEndian.Uint64(entry)
+	return g.data[offset : offset+uint64(binary.LittleEndian.Uint32(entry[8:]))]
+}
+
+// vertex returns a copy of the i-th vertex
+func (g Graph) vertex(i int) lww.Vertex {
+	entry := g.data[headerSize+i*vertexSize:]
+	le := binary.LittleEndian
+	keyEnd := le.Uint64(entry) + uint64(le.Uint32(entry[8:]))
+	return lww.Vertex{
+		Key:   string(g.key(i)),
+		Value: string(g.data[keyEnd : keyEnd+uint64(le.Uint32(entry[12:]))]),
+	}
+}
+
+// adjacent returns the adjacent keys of the i-th vertex without copying them
+func (g Graph) adjacent(i int) [][]byte {
+	le := binary.LittleEndian
+	entry := g.data[headerSize+i*vertexSize:]
+	first, count := le.Uint64(entry[16:]), uint64(le.Uint32(entry[24:]))
+
+	keys := make([][]byte, 0, count)
+	for e := first; e < first+count; e++ {
+		edgeEntry := g.data[uint64(g.edges)+e*edgeSize:]
+		offset := le.Uint64(edgeEntry)
+		keys = append(keys, g.data[offset:offset+uint64(le.Uint32(edgeEntry[8:]))])
+	}
+	return keys
+}
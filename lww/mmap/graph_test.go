@@ -0,0 +1,193 @@
+package mmap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph(t *testing.T) {
+	r := crdt.NewReplica("A")
+	r.KeyNormalizer = strings.ToLower
+
+	g := lww.NewGraph(r)
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v1", Value: "first"}))
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v2", Value: "second"}))
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v3"}))
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v4", Value: "fourth"}))
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v5", Value: "removed"}))
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v6", Value: "isolated"}))
+	require.NoError(t, g.AddEdge("v1", "v2"))
+	require.NoError(t, g.AddEdge("v2", "v3"))
+	require.NoError(t, g.AddEdge("v3", "v1"))
+	require.NoError(t, g.AddEdge("v3", "v4"))
+	require.NoError(t, g.AddEdge("v1", "v5"))
+	// the edge is left hanging
+	require.NoError(t, g.RemoveVertex("v5"))
+
+	path := filepath.Join(t.TempDir(), "graph")
+	require.NoError(t, Publish(g, path))
+
+	m, err := Open(r, path)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, m.Close())
+	}()
+
+	t.Run("lists the same vertices and edges", func(t *testing.T) {
+		expected, err := g.List()
+		require.NoError(t, err)
+		require.Contains(t, expected[0].AdjacentKeys, "v5")
+
+		list, err := m.List()
+		require.NoError(t, err)
+		require.Equal(t, expected, list)
+		require.Equal(t, len(expected), m.Len())
+	})
+
+	t.Run("looks up vertices", func(t *testing.T) {
+		for _, key := range []string{"v1", "V2", "v3", "v4", "v6"} {
+			expected, err := g.Lookup(key)
+			require.NoError(t, err)
+			vertex, err := m.Lookup(key)
+			require.NoError(t, err)
+			require.Equal(t, expected, vertex)
+		}
+
+		_, err := m.Lookup("v5")
+		require.ErrorIs(t, err, lww.ErrVertexNotFound)
+		_, err = m.Lookup("v0")
+		require.ErrorIs(t, err, lww.ErrVertexNotFound)
+	})
+
+	t.Run("finds connected vertices", func(t *testing.T) {
+		for _, key := range []string{"v1", "v3", "v6"} {
+			expected, err := g.FindConnected(key)
+			require.NoError(t, err)
+			connected, err := m.FindConnected(key)
+			require.NoError(t, err)
+			// the graph visits the adjacent vertices in random order
+			require.ElementsMatch(t, expected, connected)
+		}
+
+		_, err := m.FindConnected("v5")
+		require.ErrorIs(t, err, lww.ErrVertexNotFound)
+	})
+
+	t.Run("finds paths", func(t *testing.T) {
+		expected, err := g.FindPath("v1", "v4")
+		require.NoError(t, err)
+		path, err := m.FindPath("V1", "v4")
+		require.NoError(t, err)
+		require.Equal(t, expected, path)
+
+		_, err = m.FindPath("v1", "v6")
+		require.ErrorIs(t, err, lww.ErrPathNotFound)
+		_, err = m.FindPath("v1", "v5")
+		require.ErrorIs(t, err, lww.ErrVertexNotFound)
+	})
+
+	t.Run("keeps the opened snapshot when republished", func(t *testing.T) {
+		require.NoError(t, g.RemoveVertex("v4"))
+		require.NoError(t, Publish(g, path))
+
+		_, err := m.Lookup("v4")
+		require.NoError(t, err)
+
+		republished, err := Open(r, path)
+		require.NoError(t, err)
+		defer republished.Close()
+		_, err = republished.Lookup("v4")
+		require.ErrorIs(t, err, lww.ErrVertexNotFound)
+	})
+}
+
+func TestPublishEmpty(t *testing.T) {
+	r := crdt.NewReplica("A")
+	path := filepath.Join(t.TempDir(), "graph")
+	require.NoError(t, Publish(lww.NewGraph(r), path))
+
+	m, err := Open(r, path)
+	require.NoError(t, err)
+	defer m.Close()
+
+	list, err := m.List()
+	require.NoError(t, err)
+	require.Empty(t, list)
+	_, err = m.Lookup("v1")
+	require.ErrorIs(t, err, lww.ErrVertexNotFound)
+}
+
+func TestOpenCorrupted(t *testing.T) {
+	r := crdt.NewReplica("A")
+	g := lww.NewGraph(r)
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v1", Value: "first"}))
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v2"}))
+	require.NoError(t, g.AddEdge("v1", "v2"))
+	list, err := g.List()
+	require.NoError(t, err)
+	data := encode(list)
+
+	cases := []struct {
+		name    string
+		corrupt func([]byte) []byte
+	}{
+		{
+			name:    "too short",
+			corrupt: func(b []byte) []byte { return b[:headerSize-1] },
+		},
+		{
+			name:    "wrong magic",
+			corrupt: func(b []byte) []byte { b[0] = 'X'; return b },
+		},
+		{
+			name:    "unsupported version",
+			corrupt: func(b []byte) []byte { b[8] = 2; return b },
+		},
+		{
+			name:    "truncated",
+			corrupt: func(b []byte) []byte { return b[:len(b)-1] },
+		},
+		{
+			name:    "invalid edge count",
+			corrupt: func(b []byte) []byte { b[16] = 100; return b },
+		},
+		{
+			name:    "truncated strings",
+			corrupt: func(b []byte) []byte { return b[:len(b)-len("v1firstv2")] },
+		},
+		{
+			name: "unsorted vertices",
+			corrupt: func(b []byte) []byte {
+				first := headerSize
+				second := headerSize + vertexSize
+				for i := 0; i < 16; i++ {
+					b[first+i], b[second+i] = b[second+i], b[first+i]
+				}
+				return b
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			corrupted := make([]byte, len(data))
+			copy(corrupted, data)
+			path := filepath.Join(t.TempDir(), "graph")
+			require.NoError(t, os.WriteFile(path, tc.corrupt(corrupted), 0600))
+
+			_, err := Open(r, path)
+			require.ErrorIs(t, err, ErrCorrupted)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Open(r, filepath.Join(t.TempDir(), "graph"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package mmap
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// mapFile reads the whole file into memory, memory mapping is not supported on this platform
+func mapFile(f *os.File, size int) (data []byte, unmap func() error, err error) {
+	data = make([]byte, size)
+	_, err = io.ReadFull(f, data)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to read %q", f.Name())
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,189 @@
+package lww
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VersionedElement is one of the concurrent values of a key along with the addition that wrote it
+type VersionedElement struct {
+	// Element is the added element
+	Element Element
+	// Timestamp is when the element was added
+	Timestamp time.Time
+	// Replica is the ID of the replica that added the element
+	Replica string
+}
+
+// VersionedVertex is one of the concurrent values of a vertex along with the addition that wrote it
+type VersionedVertex struct {
+	// Vertex is the added vertex
+	Vertex
+	// Timestamp is when the vertex was added
+	Timestamp time.Time
+	// Replica is the ID of the replica that added the vertex
+	Replica string
+}
+
+// LookupVersions returns all the concurrent values of the element with the given key:
+// the winning value returned by `Lookup` first, then the values it overwrote in merges
+// without their writers seeing each other, from the newest to the oldest.
+//
+// Concurrent values are kept only with `crdt.Replica.MultiValue`, otherwise only the winning value is returned.
+// A local addition of the key supersedes all the values the replica knows of, so applications can resolve
+// a conflict by adding the value they picked or combined. The winning value is still decided by the timestamps,
+// so the resolution wins only if the clock of the replica is not behind.
+// A removal hides all the values added before it.
+//
+// Returns `ErrElementNotFound` if the element is not in the set.
+func (s Set) LookupVersions(key string) ([]VersionedElement, error) {
+	s.checkUsage()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	key = s.replica.NormalizeKey(key)
+	winner, added := s.additions[key]
+	if !added || s.removed(key, winner) {
+		return nil, ErrElementNotFound
+	}
+
+	versions := []VersionedElement{winner.versioned()}
+	for _, sibling := range s.siblings[key] {
+		if s.removed(key, sibling) {
+			continue
+		}
+		versions = append(versions, sibling.versioned())
+	}
+	return versions, nil
+}
+
+// LookupVersions returns all the concurrent values of the vertex with the given key,
+// see `Set.LookupVersions` for details.
+// Returns an error with `ErrVertexNotFound` cause if the vertex does not exist.
+func (g Graph) LookupVersions(key string) ([]VersionedVertex, error) {
+	g.checkUsage()
+
+	// no lock required, we access only `vertices` set and it's thread-safe
+	versions, err := g.vertices.LookupVersions(key)
+	if errors.Is(err, ErrElementNotFound) {
+		return nil, errors.Wrapf(ErrVertexNotFound, "failed to find vertex [key = %q]", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vertices := make([]VersionedVertex, 0, len(versions))
+	for _, version := range versions {
+		v, isVertex := toVertex(version.Element)
+		if !isVertex {
+			return nil, errors.Wrapf(ErrInvalidVertexType, "vertex [key = %q] is of invalid type", key)
+		}
+		vertices = append(vertices, VersionedVertex{Vertex: v, Timestamp: version.Timestamp, Replica: version.Replica})
+	}
+	return vertices, nil
+}
+
+// versioned returns the element of the record along with the addition that wrote it
+func (r addRecord) versioned() VersionedElement {
+	return VersionedElement{Element: r.Element, Timestamp: r.Timestamp, Replica: r.Replica}
+}
+
+// sameWrite returns `true` if both records were written by the same addition
+func (r addRecord) sameWrite(other addRecord) bool {
+	return r.Replica == other.Replica && r.Timestamp.Equal(other.Timestamp)
+}
+
+// seenBy returns `true` if the writer of `other` had seen the addition of the record
+func (r addRecord) seenBy(other addRecord) bool {
+	observed, seen := other.Observed[r.Replica]
+	return seen && !observed.Before(r.Timestamp)
+}
+
+// write returns the record of a local addition of the element with the normalized key.
+// With `crdt.Replica.MultiValue` the addition supersedes all the values of the key the replica knows of.
+// Must be called under the lock.
+func (s Set) write(key string, e Element) addRecord {
+	record := addRecord{
+		Element:   e,
+		Timestamp: s.replica.Clock.Now(),
+		Replica:   s.replica.ID,
+	}
+	if !s.replica.MultiValue {
+		return record
+	}
+
+	observed := make(map[string]time.Time)
+	observe := func(r addRecord) {
+		for replica, t := range r.Observed {
+			if t.After(observed[replica]) {
+				observed[replica] = t
+			}
+		}
+		if r.Timestamp.After(observed[r.Replica]) {
+			observed[r.Replica] = r.Timestamp
+		}
+	}
+
+	if current, added := s.additions[key]; added {
+		observe(current)
+	}
+	for _, sibling := range s.siblings[key] {
+		observe(sibling)
+	}
+	delete(s.siblings, key)
+
+	if len(observed) != 0 {
+		record.Observed = observed
+	}
+	return record
+}
+
+// mergeSiblings keeps the additions of the normalized key concurrent with its current addition
+// out of the given candidates and the known siblings of the key. An addition is concurrent
+// if none of the other additions was written after seeing it. Must be called under the lock.
+func (s Set) mergeSiblings(key string, candidates []addRecord) {
+	winner := s.additions[key]
+	candidates = append(candidates, s.siblings[key]...)
+
+	var siblings []addRecord
+	for i, candidate := range candidates {
+		if candidate.sameWrite(winner) || candidate.seenBy(winner) {
+			continue
+		}
+
+		concurrent := true
+		for j, other := range candidates {
+			if i == j {
+				continue
+			}
+			// duplicates are kept only once
+			if candidate.sameWrite(other) {
+				if j < i {
+					concurrent = false
+					break
+				}
+				continue
+			}
+			if candidate.seenBy(other) {
+				concurrent = false
+				break
+			}
+		}
+		if concurrent {
+			_, candidate.Element = s.normalize(candidate.Element)
+			siblings = append(siblings, candidate)
+		}
+	}
+
+	if len(siblings) == 0 {
+		delete(s.siblings, key)
+		return
+	}
+
+	sort.Slice(siblings, func(i, j int) bool {
+		return newer(siblings[i].Timestamp, siblings[i].Replica, siblings[j].Timestamp, siblings[j].Replica)
+	})
+	s.siblings[key] = siblings
+}
@@ -0,0 +1,165 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupVersions(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	ticking := func(id string, offset time.Duration, multiValue bool) crdt.Replica {
+		tick := base.Add(offset)
+		return crdt.Replica{ID: id, MultiValue: multiValue, Clock: clock.Func(func() time.Time {
+			tick = tick.Add(time.Second)
+			return tick
+		})}
+	}
+	values := func(t *testing.T, g Graph, key string) []string {
+		versions, err := g.LookupVersions(key)
+		require.NoError(t, err)
+		values := make([]string, 0, len(versions))
+		for _, v := range versions {
+			values = append(values, v.Value)
+		}
+		return values
+	}
+
+	t.Run("exposes concurrent updates", func(t *testing.T) {
+		a := NewGraph(ticking("A", 0, true))
+		b := NewGraph(ticking("B", time.Minute, true))
+		c := NewGraph(ticking("C", 0, true))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "initial"}))
+		replicateGraphs(a, b, c)
+
+		require.NoError(t, a.UpdateVertex(Vertex{Key: "v1", Value: "from A"}))
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "v1", Value: "from B"}))
+		require.NoError(t, c.UpdateVertex(Vertex{Key: "v1", Value: "from C"}))
+
+		// different merge orders
+		a.Merge(b)
+		a.Merge(c)
+		c.Merge(b)
+		c.Merge(a)
+		b.Merge(c)
+
+		for _, g := range []Graph{a, b, c} {
+			require.Equal(t, []string{"from B", "from A", "from C"}, values(t, g, "v1"))
+		}
+
+		versions, err := a.LookupVersions("v1")
+		require.NoError(t, err)
+		require.Equal(t, "B", versions[0].Replica)
+		require.Equal(t, base.Add(time.Minute+time.Second), versions[0].Timestamp)
+		v, err := a.Lookup("v1")
+		require.NoError(t, err)
+		require.Equal(t, versions[0].Vertex, v, "the winning value comes first")
+	})
+
+	t.Run("does not expose overwritten values", func(t *testing.T) {
+		a := NewGraph(ticking("A", 0, true))
+		b := NewGraph(ticking("B", 0, true))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "first"}))
+		replicateGraphs(a, b)
+
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "v1", Value: "second"}))
+		replicateGraphs(a, b)
+		require.NoError(t, a.UpdateVertex(Vertex{Key: "v1", Value: "third"}))
+		replicateGraphs(a, b)
+
+		for _, g := range []Graph{a, b} {
+			require.Equal(t, []string{"third"}, values(t, g, "v1"))
+		}
+	})
+
+	t.Run("a local update resolves the conflict on all replicas", func(t *testing.T) {
+		a := NewGraph(ticking("A", 0, true))
+		b := NewGraph(ticking("B", time.Minute, true))
+		c := NewGraph(ticking("C", 2*time.Minute, true))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "initial"}))
+		replicateGraphs(a, b, c)
+
+		require.NoError(t, a.UpdateVertex(Vertex{Key: "v1", Value: "from A"}))
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "v1", Value: "from B"}))
+		a.Merge(b)
+		c.Merge(b)
+		c.Merge(a)
+		require.Equal(t, []string{"from B", "from A"}, values(t, c, "v1"))
+
+		// C resolves the conflict, A still knows both values
+		require.NoError(t, c.UpdateVertex(Vertex{Key: "v1", Value: "resolved"}))
+		require.Equal(t, []string{"resolved"}, values(t, c, "v1"))
+		require.Equal(t, []string{"from B", "from A"}, values(t, a, "v1"))
+
+		replicateGraphs(a, b, c)
+		for _, g := range []Graph{a, b, c} {
+			require.Equal(t, []string{"resolved"}, values(t, g, "v1"))
+		}
+	})
+
+	t.Run("returns only the winning value without the multi-value mode", func(t *testing.T) {
+		a := NewGraph(ticking("A", 0, false))
+		b := NewGraph(ticking("B", time.Minute, false))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "initial"}))
+		replicateGraphs(a, b)
+
+		require.NoError(t, a.UpdateVertex(Vertex{Key: "v1", Value: "from A"}))
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "v1", Value: "from B"}))
+		replicateGraphs(a, b)
+
+		require.Equal(t, []string{"from B"}, values(t, a, "v1"))
+	})
+
+	t.Run("concurrent values survive serialization", func(t *testing.T) {
+		a := NewGraph(ticking("A", 0, true))
+		b := NewGraph(ticking("B", time.Minute, true))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "from A"}))
+		require.NoError(t, b.AddVertex(Vertex{Key: "v1", Value: "from B"}))
+		a.Merge(b)
+
+		data, err := a.Marshal()
+		require.NoError(t, err)
+		restored := NewGraph(ticking("C", 0, true))
+		require.NoError(t, restored.Unmarshal(data))
+		require.Equal(t, []string{"from B", "from A"}, values(t, restored, "v1"))
+
+		snapshot := a.clone()
+		require.Equal(t, []string{"from B", "from A"}, values(t, snapshot, "v1"))
+	})
+
+	t.Run("a removal hides all the values added before it", func(t *testing.T) {
+		a := NewGraph(ticking("A", 0, true))
+		b := NewGraph(ticking("B", time.Minute, true))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "from A"}))
+		require.NoError(t, b.AddVertex(Vertex{Key: "v1", Value: "from B"}))
+		a.Merge(b)
+
+		require.NoError(t, b.RemoveVertex("v1"))
+		replicateGraphs(a, b)
+
+		_, err := a.LookupVersions("v1")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		_, err = a.LookupVersions("non-existing")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("works with plain sets", func(t *testing.T) {
+		a := NewSet(ticking("A", 0, true))
+		b := NewSet(ticking("B", time.Minute, true))
+		a.Add(IDElement("e"))
+		b.Add(IDElement("e"))
+		a.Merge(b)
+
+		versions, err := a.LookupVersions("e")
+		require.NoError(t, err)
+		require.Len(t, versions, 2)
+		require.Equal(t, "B", versions[0].Replica)
+		require.Equal(t, "A", versions[1].Replica)
+
+		_, err = a.LookupVersions("non-existing")
+		require.ErrorIs(t, err, ErrElementNotFound)
+	})
+}
@@ -0,0 +1,380 @@
+package lww
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNamespaceMismatch occurs when importing data that was exported from a different namespace
+	ErrNamespaceMismatch = errors.New("namespace mismatch")
+)
+
+// namespaceExport is the serialized format of a namespace export.
+// It contains the CRDT metadata (timestamps) of every record, so the imported
+// data can be merged with other replicas afterwards.
+type namespaceExport struct {
+	// Namespace is the key prefix the data was exported for
+	Namespace string `json:"namespace"`
+	// Vertices contains additions and removals of vertices
+	Vertices []vertexRecord `json:"vertices"`
+	// Edges contains additions and removals of edges
+	Edges []edgeRecord `json:"edges"`
+}
+
+// vertexRecord is a serialized state of a single vertex key
+type vertexRecord struct {
+	// Key is the vertex key
+	Key string `json:"key"`
+	// Value is the vertex value, set only when the vertex was added
+	Value string `json:"value,omitempty"`
+	// AddedAt is when the vertex was added, nil if it was never added
+	AddedAt *time.Time `json:"addedAt,omitempty"`
+	// AddedBy is the ID of the replica that added the vertex
+	AddedBy string `json:"addedBy,omitempty"`
+	// RemovedAt is when the vertex was removed, nil if it was never removed
+	RemovedAt *time.Time `json:"removedAt,omitempty"`
+	// RemovedBy is the ID of the replica that removed the vertex
+	RemovedBy string `json:"removedBy,omitempty"`
+	// Observed maps a replica ID to the timestamp of the latest addition the writer had seen,
+	// it's recorded only with `crdt.Replica.MultiValue`
+	Observed map[string]time.Time `json:"observed,omitempty"`
+	// Siblings are the additions concurrent with the addition of the vertex (see `crdt.Replica.MultiValue`),
+	// only their values and addition fields are set
+	Siblings []vertexRecord `json:"siblings,omitempty"`
+}
+
+// edgeRecord is a serialized state of a single edge
+type edgeRecord struct {
+	// From is the key of the vertex the edge starts from
+	From string `json:"from"`
+	// To is the key of the vertex the edge points to
+	To string `json:"to"`
+	// Weight is the weight of the edge (see `Edge`)
+	Weight int64 `json:"weight,omitempty"`
+	// Label is the label of the edge (see `Edge`)
+	Label string `json:"label,omitempty"`
+	// Attributes are the attributes of the edge (see `Edge`)
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// AddedAt is when the edge was added, nil if it was never added
+	AddedAt *time.Time `json:"addedAt,omitempty"`
+	// AddedBy is the ID of the replica that added the edge
+	AddedBy string `json:"addedBy,omitempty"`
+	// RemovedAt is when the edge was removed, nil if it was never removed
+	RemovedAt *time.Time `json:"removedAt,omitempty"`
+	// RemovedBy is the ID of the replica that removed the edge
+	RemovedBy string `json:"removedBy,omitempty"`
+	// Observed maps a replica ID to the timestamp of the latest addition the writer had seen,
+	// it's recorded only with `crdt.Replica.MultiValue`
+	Observed map[string]time.Time `json:"observed,omitempty"`
+	// Siblings are the additions concurrent with the addition of the edge (see `crdt.Replica.MultiValue`),
+	// only their attributes and addition fields are set
+	Siblings []edgeRecord `json:"siblings,omitempty"`
+	// Counter is the state of the edge weight counter (see `Graph.AddEdgeWeight`)
+	Counter json.RawMessage `json:"counter,omitempty"`
+}
+
+// ExportNamespace serializes all the vertices and edges with keys starting with the `ns` prefix.
+// An edge belongs to the namespace of the vertex it starts from.
+//
+// The result includes removed vertices and edges along with their timestamps, the concurrent values
+// kept with `crdt.Replica.MultiValue` and the edge weight counters, so the data can be imported
+// into another graph using `ImportNamespace` and still be merged with other replicas afterwards.
+func (g Graph) ExportNamespace(ns string) (data []byte, err error) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	export := namespaceExport{
+		Namespace: ns,
+		Vertices:  []vertexRecord{},
+		Edges:     []edgeRecord{},
+	}
+
+	vertices := g.vertices.records(ns)
+	for _, key := range sortedRecordKeys(vertices) {
+		record := vertices[key]
+		vr := vertexRecord{
+			Key:       key,
+			AddedAt:   record.addedAt,
+			AddedBy:   record.addedBy,
+			RemovedAt: record.removedAt,
+			RemovedBy: record.removedBy,
+			Observed:  record.observed,
+		}
+
+		if record.element != nil {
+			vertex, isVertex := toVertex(record.element)
+			if !isVertex {
+				return nil, errors.Wrapf(ErrInvalidVertexType, "vertex [key = %q] is of invalid type", key)
+			}
+			vr.Value = vertex.Value
+		}
+
+		for _, sibling := range record.siblings {
+			vertex, isVertex := toVertex(sibling.Element)
+			if !isVertex {
+				return nil, errors.Wrapf(ErrInvalidVertexType, "vertex [key = %q] is of invalid type", key)
+			}
+			addedAt := sibling.Timestamp
+			vr.Siblings = append(vr.Siblings, vertexRecord{
+				Key:      key,
+				Value:    vertex.Value,
+				AddedAt:  &addedAt,
+				AddedBy:  sibling.Replica,
+				Observed: sibling.Observed,
+			})
+		}
+
+		export.Vertices = append(export.Vertices, vr)
+	}
+
+	fromKeys := make([]string, 0, len(g.edges))
+	for fromKey := range g.edges {
+		if strings.HasPrefix(fromKey, ns) {
+			fromKeys = append(fromKeys, fromKey)
+		}
+	}
+	sort.Strings(fromKeys)
+
+	for _, fromKey := range fromKeys {
+		edges := g.edges[fromKey].records("")
+		// weight counters can exist without the edge records, e.g. when merged before the edge
+		for toKey := range g.weights[fromKey] {
+			if _, exists := edges[toKey]; !exists {
+				edges[toKey] = elementRecord{}
+			}
+		}
+
+		for _, toKey := range sortedRecordKeys(edges) {
+			record := edges[toKey]
+			er := edgeRecord{
+				From:      fromKey,
+				To:        toKey,
+				AddedAt:   record.addedAt,
+				AddedBy:   record.addedBy,
+				RemovedAt: record.removedAt,
+				RemovedBy: record.removedBy,
+				Observed:  record.observed,
+			}
+			if record.element != nil {
+				edge := toEdge(record.element)
+				er.Weight, er.Label, er.Attributes = edge.Weight, edge.Label, edge.Attributes
+			}
+			for _, sibling := range record.siblings {
+				edge, addedAt := toEdge(sibling.Element), sibling.Timestamp
+				er.Siblings = append(er.Siblings, edgeRecord{
+					From:       fromKey,
+					To:         toKey,
+					Weight:     edge.Weight,
+					Label:      edge.Label,
+					Attributes: edge.Attributes,
+					AddedAt:    &addedAt,
+					AddedBy:    sibling.Replica,
+					Observed:   sibling.Observed,
+				})
+			}
+			if weight, exists := g.weights[fromKey][toKey]; exists {
+				er.Counter, err = weight.Marshal()
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to serialize weight of edge [from = %q, to = %q]", fromKey, toKey)
+				}
+			}
+			export.Edges = append(export.Edges, er)
+		}
+	}
+
+	data, err = json.Marshal(export)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize namespace %q", ns)
+	}
+
+	return data, nil
+}
+
+// ImportNamespace merges the data produced by `ExportNamespace` into the graph.
+//
+// `ns` must match the namespace the data was exported for, otherwise `ErrNamespaceMismatch` is returned.
+// Every key in the data is remapped using `keyPrefixRemap`: if a key starts with
+// one of the map keys, this prefix is replaced with the corresponding map value.
+// When several prefixes match the longest one is used.
+//
+// The imported records keep their original timestamps and are merged using the same rules as `Merge`.
+func (g Graph) ImportNamespace(ns string, data []byte, keyPrefixRemap map[string]string) error {
+	var export namespaceExport
+	err := json.Unmarshal(data, &export)
+	if err != nil {
+		return errors.Wrapf(err, "failed to deserialize namespace %q", ns)
+	}
+
+	if export.Namespace != ns {
+		return errors.Wrapf(ErrNamespaceMismatch, "expected namespace %q, got %q", ns, export.Namespace)
+	}
+
+	remap := func(key string) string {
+		var longest string
+		matched := false
+		for from := range keyPrefixRemap {
+			if strings.HasPrefix(key, from) && (!matched || len(from) > len(longest)) {
+				longest = from
+				matched = true
+			}
+		}
+		if !matched {
+			return key
+		}
+		return keyPrefixRemap[longest] + strings.TrimPrefix(key, longest)
+	}
+
+	imported := NewGraph(g.replica)
+
+	for _, vr := range export.Vertices {
+		key := remap(vr.Key)
+		record := elementRecord{
+			addedAt:   vr.AddedAt,
+			addedBy:   vr.AddedBy,
+			removedAt: vr.RemovedAt,
+			removedBy: vr.RemovedBy,
+			observed:  vr.Observed,
+		}
+		for _, sibling := range vr.Siblings {
+			if sibling.AddedAt == nil {
+				continue
+			}
+			record.siblings = append(record.siblings, addRecord{
+				Element:   imported.compressVertex(Vertex{Key: key, Value: sibling.Value}),
+				Timestamp: *sibling.AddedAt,
+				Replica:   sibling.AddedBy,
+				Observed:  sibling.Observed,
+			})
+		}
+		imported.vertices.restore(imported.compressVertex(Vertex{Key: key, Value: vr.Value}), record)
+	}
+
+	for _, er := range export.Edges {
+		fromKey, toKey := remap(er.From), remap(er.To)
+		edge := Edge{To: toKey, Weight: er.Weight, Label: er.Label, Attributes: er.Attributes}
+		record := elementRecord{
+			addedAt:   er.AddedAt,
+			addedBy:   er.AddedBy,
+			removedAt: er.RemovedAt,
+			removedBy: er.RemovedBy,
+			observed:  er.Observed,
+		}
+		for _, sibling := range er.Siblings {
+			if sibling.AddedAt == nil {
+				continue
+			}
+			record.siblings = append(record.siblings, addRecord{
+				Element:   Edge{To: toKey, Weight: sibling.Weight, Label: sibling.Label, Attributes: sibling.Attributes},
+				Timestamp: *sibling.AddedAt,
+				Replica:   sibling.AddedBy,
+				Observed:  sibling.Observed,
+			})
+		}
+		imported.getAdjacent(fromKey).restore(edge, record)
+
+		if len(er.Counter) != 0 {
+			err = imported.getWeight(fromKey, toKey).Unmarshal(er.Counter)
+			if err != nil {
+				return errors.Wrapf(err, "failed to deserialize weight of edge [from = %q, to = %q]", er.From, er.To)
+			}
+		}
+	}
+
+	g.Merge(imported)
+
+	return nil
+}
+
+// elementRecord is a state of a single key in an LWW Element Set
+type elementRecord struct {
+	// element is the added element, nil if it was never added
+	element Element
+	// addedAt is when the element was added, nil if it was never added
+	addedAt *time.Time
+	// addedBy is the ID of the replica that added the element
+	addedBy string
+	// removedAt is when the element was removed, nil if it was never removed
+	removedAt *time.Time
+	// removedBy is the ID of the replica that removed the element
+	removedBy string
+	// observed is the replicas and timestamps of the additions the writer had seen (see `addRecord`)
+	observed map[string]time.Time
+	// siblings are the additions concurrent with the addition (see `crdt.Replica.MultiValue`)
+	siblings []addRecord
+}
+
+// records returns the state of all keys in the set starting with the given prefix,
+// including removed ones.
+func (s Set) records(prefix string) map[string]elementRecord {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	records := make(map[string]elementRecord)
+	for key, added := range s.additions {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		addedAt := added.Timestamp
+		records[key] = elementRecord{
+			element:  added.Element,
+			addedAt:  &addedAt,
+			addedBy:  added.Replica,
+			observed: added.Observed,
+			siblings: s.siblings[key],
+		}
+	}
+
+	for key, removal := range s.removals {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		removedAt := removal.Timestamp
+		record := records[key]
+		record.removedAt = &removedAt
+		record.removedBy = removal.Replica
+		records[key] = record
+	}
+
+	return records
+}
+
+// restore sets the state of the element key in the set to the timestamps and the siblings of the given record,
+// the element of the record is ignored.
+func (s Set) restore(e Element, record elementRecord) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if record.addedAt != nil {
+		s.additions[e.GetKey()] = addRecord{
+			Element:   e,
+			Timestamp: *record.addedAt,
+			Replica:   record.addedBy,
+			Observed:  record.observed,
+		}
+	}
+	if len(record.siblings) != 0 {
+		s.siblings[e.GetKey()] = record.siblings
+	}
+	if record.removedAt != nil {
+		s.removals[e.GetKey()] = removeRecord{
+			Timestamp: *record.removedAt,
+			Replica:   record.removedBy,
+		}
+	}
+}
+
+// sortedRecordKeys returns the keys of the given records in the ascending order
+func sortedRecordKeys(records map[string]elementRecord) []string {
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
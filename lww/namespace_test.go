@@ -0,0 +1,130 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespace(t *testing.T) {
+	p1 := Vertex{Key: "prod/vertex1", Value: "value1"}
+	p2 := Vertex{Key: "prod/vertex2", Value: "value2"}
+	p3 := Vertex{Key: "prod/vertex3", Value: "value3"}
+	o1 := Vertex{Key: "other/vertex1", Value: "value1"}
+
+	source := NewGraph(testReplica)
+	for _, v := range []Vertex{p1, p2, p3, o1} {
+		require.NoError(t, source.AddVertex(v))
+	}
+	require.NoError(t, source.AddEdge(p1.Key, p2.Key))
+	require.NoError(t, source.AddEdge(p2.Key, p3.Key))
+	require.NoError(t, source.AddEdge(o1.Key, p1.Key))
+	require.NoError(t, source.RemoveVertex(p3.Key))
+
+	data, err := source.ExportNamespace("prod/")
+	require.NoError(t, err)
+
+	t.Run("imports vertices and edges of the namespace with remapped keys", func(t *testing.T) {
+		target := NewGraph(testReplica)
+		err := target.ImportNamespace("prod/", data, map[string]string{"prod/": "staging/"})
+		require.NoError(t, err)
+
+		expected := []VertexWithEdges{
+			{
+				Vertex:       Vertex{Key: "staging/vertex1", Value: "value1"},
+				AdjacentKeys: []string{"staging/vertex2"},
+			},
+			{
+				Vertex:       Vertex{Key: "staging/vertex2", Value: "value2"},
+				AdjacentKeys: []string{"staging/vertex3"},
+			},
+		}
+
+		list, err := target.List()
+		require.NoError(t, err)
+		require.Equal(t, expected, list)
+	})
+
+	t.Run("preserves CRDT metadata for subsequent merges", func(t *testing.T) {
+		v := Vertex{Key: "ns/vertex", Value: "value"}
+
+		// Time ->
+		// A--AddVertex(v)---------------------------------ImportNamespace--|=> A = {}
+		// B-------------AddVertex(v),RemoveVertex(v)--ExportNamespace------|
+		// C------------------------------------------------AddVertex(v)----|=> A,C = {v} after merge
+		A := NewGraph(testReplica)
+		require.NoError(t, A.AddVertex(v))
+
+		B := NewGraph(testReplica)
+		require.NoError(t, B.AddVertex(v))
+		require.NoError(t, B.RemoveVertex(v.Key))
+		data, err := B.ExportNamespace("ns/")
+		require.NoError(t, err)
+
+		require.NoError(t, A.ImportNamespace("ns/", data, nil))
+		_, err = A.Lookup(v.Key)
+		require.ErrorIs(t, err, ErrVertexNotFound, "the imported removal must win over the older addition")
+
+		C := NewGraph(testReplica)
+		require.NoError(t, C.AddVertex(v))
+		A.Merge(C)
+
+		found, err := A.Lookup(v.Key)
+		require.NoError(t, err, "the newer addition must win over the imported removal")
+		require.Equal(t, v, found)
+	})
+
+	t.Run("preserves edge weights and concurrent values", func(t *testing.T) {
+		base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+		replica := func(id string, offset time.Duration) crdt.Replica {
+			return crdt.Replica{ID: id, MultiValue: true, Clock: clock.Func(func() time.Time { return base.Add(offset) })}
+		}
+		a := NewGraph(replica("A", 0))
+		b := NewGraph(replica("B", time.Second))
+		require.NoError(t, a.AddVertex(Vertex{Key: "ns/v1", Value: "from A"}))
+		require.NoError(t, a.AddVertex(Vertex{Key: "ns/v2"}))
+		require.NoError(t, a.AddEdge("ns/v1", "ns/v2"))
+		require.NoError(t, a.AddEdgeWeight("ns/v1", "ns/v2", 3))
+		require.NoError(t, b.AddVertex(Vertex{Key: "ns/v1", Value: "from B"}))
+		a.Merge(b)
+
+		data, err := a.ExportNamespace("ns/")
+		require.NoError(t, err)
+		target := NewGraph(replica("C", 0))
+		require.NoError(t, target.ImportNamespace("ns/", data, map[string]string{"ns/": "copy/"}))
+
+		weight, err := target.EdgeWeight("copy/v1", "copy/v2")
+		require.NoError(t, err)
+		require.Equal(t, int64(3), weight)
+
+		versions, err := target.LookupVersions("copy/v1")
+		require.NoError(t, err)
+		require.Len(t, versions, 2)
+		require.Equal(t, "from B", versions[0].Value)
+		require.Equal(t, "from A", versions[1].Value)
+		require.Equal(t, "copy/v1", versions[1].Key)
+	})
+
+	t.Run("returns ErrNamespaceMismatch for data of another namespace", func(t *testing.T) {
+		target := NewGraph(testReplica)
+		err := target.ImportNamespace("other/", data, nil)
+		require.ErrorIs(t, err, ErrNamespaceMismatch)
+	})
+
+	t.Run("uses the longest matching prefix for remapping", func(t *testing.T) {
+		target := NewGraph(testReplica)
+		err := target.ImportNamespace("prod/", data, map[string]string{
+			"prod/":        "staging/",
+			"prod/vertex1": "staging/renamed",
+		})
+		require.NoError(t, err)
+
+		_, err = target.Lookup("staging/renamed")
+		require.NoError(t, err)
+		_, err = target.Lookup("staging/vertex2")
+		require.NoError(t, err)
+	})
+}
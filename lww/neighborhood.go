@@ -0,0 +1,168 @@
+package lww
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNegativeDepth occurs when a traversal is limited by a negative depth
+	ErrNegativeDepth = errors.New("negative depth")
+	// ErrInvalidCursor occurs when a page is requested with a cursor that was not returned by the graph
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// NeighborhoodPage is a page of a neighborhood, see `Graph.NeighborhoodPage`
+type NeighborhoodPage struct {
+	// Vertices are the vertices of the page in the order of `Graph.Neighborhood`
+	Vertices []VertexWithEdges
+	// Hops are the numbers of hops from the expanded vertex to the vertices of the page in the same order
+	Hops []int
+	// NextCursor is the cursor of the next page, empty if it's the last page
+	NextCursor string
+}
+
+// Neighborhood returns the vertex with the given key and all the vertices reachable from it
+// following at most `depth` directed edges, along with the keys of their existing adjacent vertices.
+// It's the "expand node" operation of graph UIs and it's much cheaper than `FindConnected` on large graphs
+// because the traversal stops after `depth` hops. A depth of zero returns the vertex alone.
+//
+// The result is deterministic: it's ordered by the number of hops from the vertex
+// and then by key, the adjacent keys are sorted. The adjacent keys of the vertices at the last hop
+// may lead outside of the neighborhood, so a UI can tell which vertices can be expanded further.
+// Use `NeighborhoodPage` for large neighborhoods.
+//
+// Returns an error with `ErrVertexNotFound` cause if the vertex does not exist.
+// Returns an error with `ErrNegativeDepth` cause if the depth is negative.
+func (g Graph) Neighborhood(key string, depth int) (neighborhood []VertexWithEdges, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	err = g.walkNeighborhood(key, depth, func(hop int, vwe VertexWithEdges) bool {
+		neighborhood = append(neighborhood, vwe)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return neighborhood, nil
+}
+
+// NeighborhoodPage returns at most `limit` vertices of the neighborhood (see `Neighborhood`) following
+// the given cursor, so a UI can expand a vertex page by page. An empty cursor requests the first page,
+// the cursor of the next page is returned with the page. A non-positive limit returns the rest of the neighborhood.
+//
+// The cursor is a position in the order of `Neighborhood` (the number of hops and the key), so the pages remain
+// consistent when the graph changes between the requests: the next page continues after the last returned vertex
+// and never repeats it.
+//
+// Returns an error with `ErrVertexNotFound` cause if the vertex does not exist.
+// Returns an error with `ErrNegativeDepth` cause if the depth is negative.
+// Returns an error with `ErrInvalidCursor` cause if the cursor is malformed.
+func (g Graph) NeighborhoodPage(key string, depth int, cursor string, limit int) (page NeighborhoodPage, err error) {
+	g.checkUsage()
+
+	afterHop, afterKey := -1, ""
+	if cursor != "" {
+		afterHop, afterKey, err = decodeNeighborhoodCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+	}
+
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	err = g.walkNeighborhood(key, depth, func(hop int, vwe VertexWithEdges) bool {
+		if hop < afterHop || (hop == afterHop && vwe.Key <= afterKey) {
+			return true
+		}
+		if limit > 0 && len(page.Vertices) == limit {
+			last := len(page.Vertices) - 1
+			page.NextCursor = encodeNeighborhoodCursor(page.Hops[last], page.Vertices[last].Key)
+			return false
+		}
+		page.Vertices = append(page.Vertices, vwe)
+		page.Hops = append(page.Hops, hop)
+		return true
+	})
+	if err != nil {
+		return NeighborhoodPage{}, err
+	}
+	return page, nil
+}
+
+// walkNeighborhood calls `visit` for every vertex of the neighborhood in the order of `Neighborhood`
+// until it returns `false`. Must be called under the read lock.
+func (g Graph) walkNeighborhood(key string, depth int, visit func(hop int, vwe VertexWithEdges) bool) error {
+	if depth < 0 {
+		return errors.Wrapf(ErrNegativeDepth, "depth %d", depth)
+	}
+	start, err := g.Lookup(key)
+	if err != nil {
+		return err
+	}
+
+	visited := map[string]nothing{start.Key: {}}
+	level := []Vertex{start}
+
+	for hop := 0; len(level) != 0; hop++ {
+		var next []Vertex
+		for _, vertex := range level {
+			adjacent, err := g.sortedAdjacent(vertex.Key)
+			if err != nil {
+				return err
+			}
+
+			vwe := VertexWithEdges{
+				Vertex:       vertex,
+				AdjacentKeys: make([]string, 0, len(adjacent)),
+			}
+			for _, a := range adjacent {
+				vwe.AdjacentKeys = append(vwe.AdjacentKeys, a.Key)
+				if _, isVisited := visited[a.Key]; isVisited || hop == depth {
+					continue
+				}
+				visited[a.Key] = nothing{}
+				next = append(next, a)
+			}
+			if !visit(hop, vwe) {
+				return nil
+			}
+		}
+
+		sort.Slice(next, func(i, j int) bool {
+			return next[i].Key < next[j].Key
+		})
+		level = next
+	}
+
+	return nil
+}
+
+// encodeNeighborhoodCursor returns an opaque cursor of the position after the vertex at the given hop
+func encodeNeighborhoodCursor(hop int, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(hop) + ":" + key))
+}
+
+// decodeNeighborhoodCursor returns the position encoded by `encodeNeighborhoodCursor`
+func decodeNeighborhoodCursor(cursor string) (hop int, key string, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", errors.Wrapf(ErrInvalidCursor, "%q", cursor)
+	}
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 {
+		return 0, "", errors.Wrapf(ErrInvalidCursor, "%q", cursor)
+	}
+	hop, err = strconv.Atoi(parts[0])
+	if err != nil || hop < 0 {
+		return 0, "", errors.Wrapf(ErrInvalidCursor, "%q", cursor)
+	}
+	return hop, parts[1], nil
+}
@@ -0,0 +1,121 @@
+package lww
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeighborhood(t *testing.T) {
+	// v1 -> v2 -> v4 -> v5
+	//   \-> v3 -/ \-> v1
+	newGraph := func(t *testing.T) Graph {
+		g := NewGraph(crdt.NewReplica("A"))
+		for i := 1; i <= 5; i++ {
+			require.NoError(t, g.AddVertex(Vertex{Key: fmt.Sprintf("v%d", i)}))
+		}
+		for _, edge := range [][2]string{{"v1", "v3"}, {"v1", "v2"}, {"v2", "v4"}, {"v3", "v4"}, {"v4", "v5"}, {"v4", "v1"}} {
+			require.NoError(t, g.AddEdge(edge[0], edge[1]))
+		}
+		return g
+	}
+
+	t.Run("returns vertices within the depth ordered by hops", func(t *testing.T) {
+		g := newGraph(t)
+
+		neighborhood, err := g.Neighborhood("v1", 0)
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: Vertex{Key: "v1"}, AdjacentKeys: []string{"v2", "v3"}},
+		}, neighborhood)
+
+		neighborhood, err = g.Neighborhood("v1", 2)
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: Vertex{Key: "v1"}, AdjacentKeys: []string{"v2", "v3"}},
+			{Vertex: Vertex{Key: "v2"}, AdjacentKeys: []string{"v4"}},
+			{Vertex: Vertex{Key: "v3"}, AdjacentKeys: []string{"v4"}},
+			{Vertex: Vertex{Key: "v4"}, AdjacentKeys: []string{"v1", "v5"}},
+		}, neighborhood, "edges of the last hop may lead outside")
+
+		neighborhood, err = g.Neighborhood("v1", 100)
+		require.NoError(t, err)
+		require.Len(t, neighborhood, 5)
+		require.Equal(t, "v5", neighborhood[4].Key)
+	})
+
+	t.Run("skips removed vertices", func(t *testing.T) {
+		g := newGraph(t)
+		require.NoError(t, g.RemoveVertex("v2"))
+
+		neighborhood, err := g.Neighborhood("v1", 1)
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: Vertex{Key: "v1"}, AdjacentKeys: []string{"v3"}},
+			{Vertex: Vertex{Key: "v3"}, AdjacentKeys: []string{"v4"}},
+		}, neighborhood)
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		g := newGraph(t)
+		expected, err := g.Neighborhood("v1", 100)
+		require.NoError(t, err)
+
+		var (
+			pages  []NeighborhoodPage
+			cursor string
+		)
+		for {
+			page, err := g.NeighborhoodPage("v1", 100, cursor, 2)
+			require.NoError(t, err)
+			pages = append(pages, page)
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		require.Len(t, pages, 3)
+		var actual []VertexWithEdges
+		for _, page := range pages {
+			actual = append(actual, page.Vertices...)
+		}
+		require.Equal(t, expected, actual)
+		require.Equal(t, []int{1, 2}, pages[1].Hops)
+
+		all, err := g.NeighborhoodPage("v1", 100, "", 0)
+		require.NoError(t, err)
+		require.Equal(t, expected, all.Vertices)
+		require.Empty(t, all.NextCursor)
+	})
+
+	t.Run("pages continue after the cursor when the graph changes", func(t *testing.T) {
+		g := newGraph(t)
+		first, err := g.NeighborhoodPage("v1", 1, "", 2)
+		require.NoError(t, err)
+		require.Equal(t, "v2", first.Vertices[1].Key)
+
+		require.NoError(t, g.AddVertex(Vertex{Key: "v0"}))
+		require.NoError(t, g.AddEdge("v1", "v0"))
+		require.NoError(t, g.RemoveVertex("v2"))
+
+		second, err := g.NeighborhoodPage("v1", 1, first.NextCursor, 2)
+		require.NoError(t, err)
+		require.Len(t, second.Vertices, 1)
+		require.Equal(t, "v3", second.Vertices[0].Key)
+		require.Empty(t, second.NextCursor)
+	})
+
+	t.Run("fails on invalid arguments", func(t *testing.T) {
+		g := newGraph(t)
+		_, err := g.Neighborhood("v1", -1)
+		require.ErrorIs(t, err, ErrNegativeDepth)
+		_, err = g.Neighborhood("v0", 1)
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		_, err = g.NeighborhoodPage("v1", 1, "invalid", 1)
+		require.ErrorIs(t, err, ErrInvalidCursor)
+		_, err = g.NeighborhoodPage("v1", -1, "", 1)
+		require.ErrorIs(t, err, ErrNegativeDepth)
+	})
+}
@@ -0,0 +1,86 @@
+package lww
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserver(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	// replica returns a replica recording its mutations to `mutations`
+	replica := func(id string, offset time.Duration, mutations *[]crdt.Mutation) crdt.Replica {
+		return crdt.Replica{
+			ID:    id,
+			Clock: clock.Func(func() time.Time { return base.Add(offset) }),
+			Observer: crdt.ObserverFunc(func(m crdt.Mutation) {
+				*mutations = append(*mutations, m)
+			}),
+		}
+	}
+
+	t.Run("set reports local and merged mutations", func(t *testing.T) {
+		var localMutations, remoteMutations []crdt.Mutation
+		local := NewSet(replica("A", 0, &localMutations))
+		remote := NewSet(replica("B", time.Second, &remoteMutations))
+
+		local.Add(IDElement("e1"))
+		local.Remove("e1")
+		remote.Add(IDElement("e1"))
+		remote.Add(IDElement("e2"))
+
+		require.Equal(t, []crdt.Mutation{
+			{Kind: SetKind, Key: "e1", Replica: "A", Timestamp: base, Source: crdt.SourceLocal},
+			{Kind: SetKind, Key: "e1", Removal: true, Replica: "A", Timestamp: base, Source: crdt.SourceLocal},
+		}, localMutations)
+
+		localMutations = nil
+		local.Merge(remote)
+		sortMutations(localMutations)
+		require.Equal(t, []crdt.Mutation{
+			{Kind: SetKind, Key: "e1", Replica: "B", Timestamp: base.Add(time.Second), Source: crdt.SourceMerge},
+			{Kind: SetKind, Key: "e2", Replica: "B", Timestamp: base.Add(time.Second), Source: crdt.SourceMerge},
+		}, localMutations)
+
+		localMutations = nil
+		local.Merge(remote)
+		require.Empty(t, localMutations, "merging the same state again changes nothing")
+	})
+
+	t.Run("graph reports vertex and edge mutations", func(t *testing.T) {
+		var localMutations, remoteMutations []crdt.Mutation
+		local := NewGraph(replica("A", 0, &localMutations))
+		remote := NewGraph(replica("B", time.Second, &remoteMutations))
+
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v1"}))
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, remote.AddEdge("v1", "v2"))
+		require.Equal(t, []crdt.Mutation{
+			{Kind: GraphKind, Key: "v1", Replica: "B", Timestamp: base.Add(time.Second), Source: crdt.SourceLocal},
+			{Kind: GraphKind, Key: "v2", Replica: "B", Timestamp: base.Add(time.Second), Source: crdt.SourceLocal},
+			{Kind: GraphKind, Key: "v1", AdjacentKey: "v2", Replica: "B", Timestamp: base.Add(time.Second), Source: crdt.SourceLocal},
+		}, remoteMutations)
+
+		local.Merge(remote)
+		sortMutations(localMutations)
+		require.Equal(t, []crdt.Mutation{
+			{Kind: GraphKind, Key: "v1", Replica: "B", Timestamp: base.Add(time.Second), Source: crdt.SourceMerge},
+			{Kind: GraphKind, Key: "v1", AdjacentKey: "v2", Replica: "B", Timestamp: base.Add(time.Second), Source: crdt.SourceMerge},
+			{Kind: GraphKind, Key: "v2", Replica: "B", Timestamp: base.Add(time.Second), Source: crdt.SourceMerge},
+		}, localMutations)
+	})
+}
+
+// sortMutations sorts the mutations by their keys, so merged mutations can be compared
+func sortMutations(list []crdt.Mutation) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Key != list[j].Key {
+			return list[i].Key < list[j].Key
+		}
+		return list[i].AdjacentKey < list[j].AdjacentKey
+	})
+}
@@ -0,0 +1,130 @@
+package lww
+
+import (
+	"sort"
+)
+
+// FindPredecessors returns the vertices that have an edge to the vertex with the given key sorted by their keys.
+// Unlike `Transpose` it does not scan the graph, the edges are indexed by the vertex they point to.
+// Edges starting from removed vertices are not included.
+// Returns an error with `ErrVertexNotfound` cause if the vertex does not exist.
+func (g Graph) FindPredecessors(key string) ([]Vertex, error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	_, err := g.Lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fromKeys := g.incomingKeys(g.replica.NormalizeKey(key))
+	predecessors := make([]Vertex, 0, len(fromKeys))
+	for fromKey := range fromKeys {
+		v, err := g.Lookup(fromKey)
+		if err != nil {
+			continue
+		}
+		predecessors = append(predecessors, v)
+	}
+	sort.Slice(predecessors, func(i, j int) bool {
+		return predecessors[i].Key < predecessors[j].Key
+	})
+
+	return predecessors, nil
+}
+
+// InDegree returns the number of vertices that have an edge to the vertex with the given key,
+// see `FindPredecessors`.
+// Returns an error with `ErrVertexNotfound` cause if the vertex does not exist.
+func (g Graph) InDegree(key string) (int, error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	_, err := g.Lookup(key)
+	if err != nil {
+		return 0, err
+	}
+
+	degree := 0
+	for fromKey := range g.incomingKeys(g.replica.NormalizeKey(key)) {
+		if _, err := g.Lookup(fromKey); err == nil {
+			degree++
+		}
+	}
+	return degree, nil
+}
+
+// incomingKeys returns the keys of the vertices with a live edge to the vertex with the normalized key.
+// While the index is not built (see `UnmarshalLive`) the edges are scanned. Must be called under the lock.
+func (g Graph) incomingKeys(key string) map[string]nothing {
+	if !*g.unindexed {
+		return g.incoming[key]
+	}
+	fromKeys := make(map[string]nothing)
+	for fromKey, adjacent := range g.edges {
+		if _, err := adjacent.Lookup(key); err == nil {
+			fromKeys[fromKey] = nothing{}
+		}
+	}
+	return fromKeys
+}
+
+// indexEdge updates the index of incoming edges with the current state of the edge, the keys must be normalized.
+// Must be called under the write lock after every change of the edge.
+func (g Graph) indexEdge(fromKey, toKey string) {
+	live := false
+	if adjacent, exists := g.edges[fromKey]; exists {
+		_, err := adjacent.Lookup(toKey)
+		live = err == nil
+	}
+
+	if live {
+		if g.incoming[toKey] == nil {
+			g.incoming[toKey] = make(map[string]nothing)
+		}
+		g.incoming[toKey][fromKey] = nothing{}
+		return
+	}
+
+	delete(g.incoming[toKey], fromKey)
+	if len(g.incoming[toKey]) == 0 {
+		delete(g.incoming, toKey)
+	}
+}
+
+// indexAdjacent updates the index of incoming edges with the current state of the edges
+// from the vertex with the normalized `fromKey` to all the keys known by the `changed` set.
+// Must be called under the write lock.
+func (g Graph) indexAdjacent(fromKey string, changed Set) {
+	changed.mutex.RLock()
+	keys := make([]string, 0, len(changed.additions)+len(changed.removals))
+	for toKey := range changed.additions {
+		keys = append(keys, toKey)
+	}
+	for toKey := range changed.removals {
+		keys = append(keys, toKey)
+	}
+	changed.mutex.RUnlock()
+
+	for _, toKey := range keys {
+		g.indexEdge(fromKey, g.replica.NormalizeKey(toKey))
+	}
+}
+
+// reindex rebuilds the index of incoming edges from scratch, must be called under the write lock
+func (g Graph) reindex() {
+	for toKey := range g.incoming {
+		delete(g.incoming, toKey)
+	}
+	for fromKey, adjacent := range g.edges {
+		for _, element := range adjacent.List() {
+			toKey := element.GetKey()
+			if g.incoming[toKey] == nil {
+				g.incoming[toKey] = make(map[string]nothing)
+			}
+			g.incoming[toKey][fromKey] = nothing{}
+		}
+	}
+}
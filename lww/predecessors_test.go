@@ -0,0 +1,111 @@
+package lww
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPredecessors(t *testing.T) {
+	v1 := Vertex{Key: "vertex1", Value: "value1"}
+	v2 := Vertex{Key: "vertex2", Value: "value2"}
+	v3 := Vertex{Key: "vertex3", Value: "value3"}
+
+	newGraph := func(t *testing.T, r crdt.Replica) Graph {
+		g := NewGraph(r)
+		for _, v := range []Vertex{v1, v2, v3} {
+			require.NoError(t, g.AddVertex(v))
+		}
+		return g
+	}
+	// requireIndexed compares the index with a full scan of the graph
+	requireIndexed := func(t *testing.T, g Graph) {
+		transposed := g.Transpose()
+		list, err := g.List()
+		require.NoError(t, err)
+		for _, v := range list {
+			expected, err := transposed.Adjacent(v.Key)
+			require.NoError(t, err)
+			predecessors, err := g.FindPredecessors(v.Key)
+			require.NoError(t, err)
+			require.Equal(t, expected, predecessors, v.Key)
+			degree, err := g.InDegree(v.Key)
+			require.NoError(t, err)
+			require.Equal(t, len(expected), degree, v.Key)
+		}
+	}
+
+	t.Run("finds the vertices pointing to a vertex", func(t *testing.T) {
+		g := newGraph(t, testReplica)
+		require.NoError(t, g.AddEdge(v2.Key, v1.Key))
+		require.NoError(t, g.AddWeightedEdge(v3.Key, Edge{To: v1.Key, Weight: 2}))
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+
+		predecessors, err := g.FindPredecessors(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v2, v3}, predecessors)
+
+		degree, err := g.InDegree(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, 2, degree)
+
+		require.NoError(t, g.RemoveEdge(v2.Key, v1.Key))
+		predecessors, err = g.FindPredecessors(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v3}, predecessors)
+
+		require.NoError(t, g.RemoveVertex(v3.Key))
+		degree, err = g.InDegree(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, 0, degree, "edges from removed vertices are not counted")
+
+		_, err = g.FindPredecessors("non-existing")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		_, err = g.InDegree("non-existing")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("the index is merged with the edges", func(t *testing.T) {
+		a := newGraph(t, crdt.NewReplica("A"))
+		b := NewGraph(crdt.NewReplica("B"))
+		b.Merge(a)
+
+		require.NoError(t, a.AddEdge(v1.Key, v3.Key))
+		require.NoError(t, a.AddEdge(v2.Key, v3.Key))
+		require.NoError(t, b.AddEdge(v3.Key, v1.Key))
+		replicateGraphs(a, b)
+		requireIndexed(t, a)
+		requireIndexed(t, b)
+
+		require.NoError(t, b.RemoveEdge(v1.Key, v3.Key))
+		require.NoError(t, a.MergeContext(context.Background(), b, MergeConfig{}))
+		predecessors, err := a.FindPredecessors(v3.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v2}, predecessors)
+		requireIndexed(t, a)
+	})
+
+	t.Run("the index is rebuilt from serialized states", func(t *testing.T) {
+		g := newGraph(t, testReplica)
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		require.NoError(t, g.AddEdge(v3.Key, v2.Key))
+
+		data, err := g.Marshal()
+		require.NoError(t, err)
+		restored := newGraph(t, testReplica)
+		require.NoError(t, restored.AddEdge(v2.Key, v1.Key))
+		require.NoError(t, restored.Unmarshal(data))
+		requireIndexed(t, restored)
+
+		requireIndexed(t, g.clone())
+		requireIndexed(t, g.Subset([]KeyRange{{From: 0, To: merkleLeaves}}))
+
+		exported, err := g.ExportNamespace("vertex")
+		require.NoError(t, err)
+		imported := NewGraph(testReplica)
+		require.NoError(t, imported.ImportNamespace("vertex", exported, nil))
+		requireIndexed(t, imported)
+	})
+}
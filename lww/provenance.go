@@ -0,0 +1,89 @@
+package lww
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Write describes the operation that decided the current state of a key
+type Write struct {
+	// Replica is the ID of the replica that performed the operation,
+	// empty for operations restored from a state serialized before replica IDs were recorded
+	Replica string
+	// Timestamp is when the operation happened
+	Timestamp time.Time
+	// Removal is `true` if the operation is a removal, `false` if it's an addition
+	Removal bool
+}
+
+// LastWrite returns the operation that decided the current state of the element with the given key:
+// the addition if the element is in the set, the removal otherwise.
+// It answers "who last wrote this element", which helps with auditing and debugging convergence issues.
+// Returns an error with `ErrElementNotFound` cause if the key was never added or removed.
+func (s Set) LastWrite(key string) (Write, error) {
+	s.checkUsage()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	key = s.replica.NormalizeKey(key)
+	added, isAdded := s.additions[key]
+	removal, isRemoved := s.removals[key]
+
+	switch {
+	case isAdded && !s.removed(key, added):
+		return Write{Replica: added.Replica, Timestamp: added.Timestamp}, nil
+	case isRemoved:
+		return Write{Replica: removal.Replica, Timestamp: removal.Timestamp, Removal: true}, nil
+	default:
+		return Write{}, errors.Wrapf(ErrElementNotFound, "no operations for element [key = %q]", key)
+	}
+}
+
+// Additions returns the current addition of every key sorted by keys, including the elements removed later,
+// so the state can be converted to other CRDTs (e.g. `orset.FromLWW`). Use `Lookup` for checking if an element
+// is still in the set. The values overwritten by concurrent writes (see `LookupVersions`) are not included.
+func (s Set) Additions() []VersionedElement {
+	s.checkUsage()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	additions := make([]VersionedElement, 0, len(s.additions))
+	for _, record := range s.additions {
+		additions = append(additions, record.versioned())
+	}
+	sort.Slice(additions, func(i, j int) bool {
+		return additions[i].Element.GetKey() < additions[j].Element.GetKey()
+	})
+	return additions
+}
+
+// LastVertexWrite returns the operation that decided the current state of the vertex with the given key,
+// see `Set.LastWrite`. Returns an error with `ErrVertexNotFound` cause if the key was never added or removed.
+func (g Graph) LastVertexWrite(key string) (Write, error) {
+	g.checkUsage()
+
+	write, err := g.vertices.LastWrite(key)
+	if err != nil {
+		return Write{}, errors.Wrapf(ErrVertexNotFound, "no operations for vertex [key = %q]", key)
+	}
+	return write, nil
+}
+
+// LastEdgeWrite returns the operation that decided the current state of the edge between the given vertices,
+// see `Set.LastWrite`. Returns an error with `ErrEdgeNotFound` cause if the edge was never added or removed.
+func (g Graph) LastEdgeWrite(fromKey, toKey string) (Write, error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	edges, exists := g.edges[g.replica.NormalizeKey(fromKey)]
+	if exists {
+		write, err := edges.LastWrite(toKey)
+		if err == nil {
+			return write, nil
+		}
+	}
+	return Write{}, errors.Wrapf(ErrEdgeNotFound, "no operations for edge [from = %q, to = %q]", fromKey, toKey)
+}
@@ -0,0 +1,249 @@
+package lww
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	fixed := clock.Func(func() time.Time { return now })
+	replicaA := crdt.Replica{ID: "A", Clock: fixed}
+	replicaB := crdt.Replica{ID: "B", Clock: fixed}
+
+	t.Run("colliding timestamps are resolved by the greater replica ID", func(t *testing.T) {
+		a := NewSetWithDecoder(replicaA, DecodeVertex)
+		b := NewSetWithDecoder(replicaB, DecodeVertex)
+		a.Add(Vertex{Key: "v1", Value: "a"})
+		b.Add(Vertex{Key: "v1", Value: "b"})
+
+		replicateSets(a, b)
+
+		for _, s := range []Set{a, b} {
+			found, err := s.Lookup("v1")
+			require.NoError(t, err)
+			require.Equal(t, Vertex{Key: "v1", Value: "b"}, found)
+		}
+	})
+
+	t.Run("LastWrite returns who decided the state of an element", func(t *testing.T) {
+		a := NewSet(replicaA)
+		b := NewSet(crdt.Replica{ID: "B", Clock: clock.Func(func() time.Time { return now.Add(time.Second) })})
+
+		_, err := a.LastWrite("key")
+		require.ErrorIs(t, err, ErrElementNotFound)
+
+		a.Add(IDElement("key"))
+		write, err := a.LastWrite("key")
+		require.NoError(t, err)
+		require.Equal(t, Write{Replica: "A", Timestamp: now}, write)
+
+		b.Merge(a)
+		b.Remove("key")
+		a.Merge(b)
+		write, err = a.LastWrite("key")
+		require.NoError(t, err)
+		require.Equal(t, Write{Replica: "B", Timestamp: now.Add(time.Second), Removal: true}, write)
+	})
+
+	t.Run("Additions returns the current additions including removed elements", func(t *testing.T) {
+		a := NewSet(replicaA)
+		b := NewSet(crdt.Replica{ID: "B", Clock: clock.Func(func() time.Time { return now.Add(time.Second) })})
+		a.Add(IDElement("key2"))
+		a.Add(IDElement("key1"))
+		b.Merge(a)
+		b.Remove("key1")
+		b.Remove("never-added")
+
+		require.Equal(t, []VersionedElement{
+			{Element: IDElement("key1"), Timestamp: now, Replica: "A"},
+			{Element: IDElement("key2"), Timestamp: now, Replica: "A"},
+		}, b.Additions())
+		require.Empty(t, NewSet(replicaA).Additions())
+	})
+
+	t.Run("replica IDs survive serialization", func(t *testing.T) {
+		tick := now
+		g := NewGraph(crdt.Replica{ID: "A", Clock: clock.Func(func() time.Time {
+			tick = tick.Add(time.Second)
+			return tick
+		})})
+		require.NoError(t, g.AddVertex(Vertex{Key: "v1"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, g.AddEdge("v1", "v2"))
+		require.NoError(t, g.RemoveVertex("v2"))
+
+		data, err := g.Marshal()
+		require.NoError(t, err)
+		restored := NewGraph(replicaB)
+		require.NoError(t, restored.Unmarshal(data))
+
+		write, err := restored.LastVertexWrite("v1")
+		require.NoError(t, err)
+		require.Equal(t, "A", write.Replica)
+		require.False(t, write.Removal)
+
+		write, err = restored.LastVertexWrite("v2")
+		require.NoError(t, err)
+		require.Equal(t, "A", write.Replica)
+		require.True(t, write.Removal)
+
+		write, err = restored.LastEdgeWrite("v1", "v2")
+		require.NoError(t, err)
+		require.Equal(t, Write{Replica: "A", Timestamp: now.Add(3 * time.Second)}, write)
+
+		_, err = restored.LastVertexWrite("v3")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		_, err = restored.LastEdgeWrite("v2", "v1")
+		require.ErrorIs(t, err, ErrEdgeNotFound)
+	})
+}
+
+func TestConflictJournal(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	replica := func(id string, offset time.Duration, journal crdt.ConflictJournal) crdt.Replica {
+		return crdt.Replica{
+			ID:      id,
+			Clock:   clock.Func(func() time.Time { return base.Add(offset) }),
+			Journal: journal,
+		}
+	}
+
+	t.Run("merges record overwritten local operations", func(t *testing.T) {
+		journal := crdt.NewJournal(crdt.JournalConfig{})
+		a := NewGraph(replica("A", 0, journal))
+		b := NewGraph(replica("B", time.Second, nil))
+
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "a"}))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v2", Value: "a"}))
+		require.NoError(t, a.AddEdge("v1", "v2"))
+		require.NoError(t, b.AddVertex(Vertex{Key: "v1", Value: "b"}))
+		require.NoError(t, b.AddVertex(Vertex{Key: "v2", Value: "b"}))
+		require.NoError(t, b.AddEdge("v1", "v2"))
+
+		a.Merge(b)
+		a.Merge(b)
+
+		lost := crdt.ConflictOp{Replica: "A", Timestamp: base}
+		won := crdt.ConflictOp{Replica: "B", Timestamp: base.Add(time.Second)}
+		conflicts := journal.Conflicts(time.Time{}, time.Time{})
+		sort.Slice(conflicts, func(i, j int) bool {
+			return conflicts[i].Key+conflicts[i].AdjacentKey < conflicts[j].Key+conflicts[j].AdjacentKey
+		})
+		require.Equal(t, []crdt.Conflict{
+			{Kind: GraphKind, Key: "v1", Winner: won, Loser: lost, MergedAt: base},
+			{Kind: GraphKind, Key: "v1", AdjacentKey: "v2", Winner: won, Loser: lost, MergedAt: base},
+			{Kind: GraphKind, Key: "v2", Winner: won, Loser: lost, MergedAt: base},
+		}, conflicts, "merging the same state again records nothing")
+
+		// the remote losing operations are not recorded, the remote replica records them
+		b.Merge(a)
+		require.Len(t, journal.Conflicts(time.Time{}, time.Time{}), 3)
+	})
+
+	t.Run("set merges record overwritten removals", func(t *testing.T) {
+		journal := crdt.NewJournal(crdt.JournalConfig{})
+		a := NewSet(replica("A", 0, journal))
+		b := NewSet(replica("B", 0, nil))
+		a.Remove("key")
+		b.Remove("key")
+
+		a.Merge(b)
+		require.Equal(t, []crdt.Conflict{{
+			Kind:     SetKind,
+			Key:      "key",
+			Winner:   crdt.ConflictOp{Replica: "B", Timestamp: base, Removal: true},
+			Loser:    crdt.ConflictOp{Replica: "A", Timestamp: base, Removal: true},
+			MergedAt: base,
+		}}, journal.Conflicts(time.Time{}, time.Time{}))
+	})
+}
+
+// mergeLogger collects the structured merge records
+type mergeLogger struct {
+	merges    []crdt.MergeSummary
+	conflicts []crdt.Conflict
+	remoteWon []bool
+}
+
+func (l *mergeLogger) Printf(format string, v ...interface{}) {}
+
+func (l *mergeLogger) LogMerge(s crdt.MergeSummary) {
+	s.Duration = 0
+	l.merges = append(l.merges, s)
+}
+
+func (l *mergeLogger) LogConflict(c crdt.Conflict, remoteWon bool) {
+	l.conflicts = append(l.conflicts, c)
+	l.remoteWon = append(l.remoteWon, remoteWon)
+}
+
+func TestMergeLogger(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	replica := func(id string, offset time.Duration, logger crdt.Logger) crdt.Replica {
+		return crdt.Replica{
+			ID:     id,
+			Clock:  clock.Func(func() time.Time { return base.Add(offset) }),
+			Logger: logger,
+		}
+	}
+
+	t.Run("logs set merges and decisions in both directions", func(t *testing.T) {
+		logger := &mergeLogger{}
+		a := NewSet(replica("A", time.Second, logger))
+		b := NewSet(replica("B", 0, nil))
+		a.Add(IDElement("kept"))
+		b.Add(IDElement("kept"))
+		b.Add(IDElement("new"))
+		b.Remove("removed")
+
+		a.Merge(b)
+		require.Equal(t, []crdt.MergeSummary{{
+			Kind:      SetKind,
+			Replica:   "A",
+			Records:   3,
+			Applied:   2,
+			LocalWins: 1,
+		}}, logger.merges)
+		require.Equal(t, []crdt.Conflict{{
+			Kind:     SetKind,
+			Key:      "kept",
+			Winner:   crdt.ConflictOp{Replica: "A", Timestamp: base.Add(time.Second)},
+			Loser:    crdt.ConflictOp{Replica: "B", Timestamp: base},
+			MergedAt: base.Add(time.Second),
+		}}, logger.conflicts)
+		require.Equal(t, []bool{false}, logger.remoteWon)
+
+		// merging the same state again changes nothing, the local operation keeps winning
+		a.Merge(b)
+		require.Equal(t, crdt.MergeSummary{Kind: SetKind, Replica: "A", Records: 3, LocalWins: 1}, logger.merges[1])
+		require.Equal(t, []bool{false, false}, logger.remoteWon)
+	})
+
+	t.Run("logs a summary of the whole graph merge", func(t *testing.T) {
+		logger := &mergeLogger{}
+		a := NewGraph(replica("A", 0, logger))
+		b := NewGraph(replica("B", time.Second, nil))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "a"}))
+		require.NoError(t, b.AddVertex(Vertex{Key: "v1", Value: "b"}))
+		require.NoError(t, b.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, b.AddEdge("v1", "v2"))
+
+		a.Merge(b)
+		require.Equal(t, []crdt.MergeSummary{{
+			Kind:       GraphKind,
+			Replica:    "A",
+			Records:    3,
+			Applied:    3,
+			RemoteWins: 1,
+		}}, logger.merges)
+		require.Equal(t, []bool{true}, logger.remoteWon)
+		require.Equal(t, "v1", logger.conflicts[0].Key)
+		require.Equal(t, crdt.ConflictOp{Replica: "B", Timestamp: base.Add(time.Second)}, logger.conflicts[0].Winner)
+	})
+}
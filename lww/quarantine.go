@@ -0,0 +1,112 @@
+package lww
+
+import (
+	"sort"
+)
+
+// QuarantinedVertex is a vertex value from another replica rejected by the replica validator
+// (see `crdt.Replica.Validator`), it's kept aside instead of being merged into the graph.
+type QuarantinedVertex struct {
+	// VersionedVertex is the rejected vertex along with the addition that wrote it
+	VersionedVertex
+	// Reason is why the value was rejected
+	Reason string
+}
+
+// Quarantined returns the latest rejected value of every vertex sorted by the vertex keys,
+// so malformed payloads of old clients can be inspected and fixed at the boundary.
+// The quarantine is local to the replica, it's never serialized or merged.
+func (g Graph) Quarantined() []QuarantinedVertex {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	list := make([]QuarantinedVertex, 0, len(g.quarantine))
+	for _, q := range g.quarantine {
+		list = append(list, q)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// ClearQuarantine removes all the quarantined values, e.g. after they were inspected
+func (g Graph) ClearQuarantine() {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for key := range g.quarantine {
+		delete(g.quarantine, key)
+	}
+}
+
+// quarantineInvalid returns the `remote` set of vertices without the additions rejected by the replica validator,
+// the rejected ones are put into the quarantine and recorded in `changes`. Removals are always kept.
+// Additions the graph already has are not validated again. Must be called under the write lock.
+func (g Graph) quarantineInvalid(remote Set, changes *changes) Set {
+	if g.replica.Validator == nil {
+		return remote
+	}
+
+	valid := remote.clone()
+	g.vertices.mutex.RLock()
+	defer g.vertices.mutex.RUnlock()
+
+	for key, record := range valid.additions {
+		if !g.acceptVertex(record, changes) {
+			delete(valid.additions, key)
+			delete(valid.siblings, key)
+			continue
+		}
+
+		siblings := valid.siblings[key][:0]
+		for _, sibling := range valid.siblings[key] {
+			if g.acceptVertex(sibling, changes) {
+				siblings = append(siblings, sibling)
+			}
+		}
+		if len(siblings) == 0 {
+			delete(valid.siblings, key)
+		} else {
+			valid.siblings[key] = siblings
+		}
+	}
+
+	return valid
+}
+
+// acceptVertex returns `true` if the vertex addition from another replica can be merged,
+// a rejected one is put into the quarantine and recorded in `changes`. Must be called under the write lock
+// of the graph and the read lock of the vertex set.
+func (g Graph) acceptVertex(record addRecord, changes *changes) bool {
+	vertex, isVertex := toVertex(record.Element)
+	if !isVertex {
+		return true
+	}
+
+	// the quarantine is keyed like the vertices, so spellings of the same key replace each other
+	vertex.Key = g.replica.NormalizeKey(vertex.Key)
+	local, exists := g.vertices.additions[vertex.Key]
+	if exists && local.sameWrite(record) {
+		return true
+	}
+
+	err := g.replica.ValidateValue(vertex.Key, vertex.Value)
+	if err == nil {
+		return true
+	}
+
+	quarantined := QuarantinedVertex{
+		VersionedVertex: VersionedVertex{Vertex: vertex, Timestamp: record.Timestamp, Replica: record.Replica},
+		Reason:          err.Error(),
+	}
+	if previous, exists := g.quarantine[vertex.Key]; !exists || previous.Timestamp.Before(record.Timestamp) {
+		g.quarantine[vertex.Key] = quarantined
+	}
+	changes.reject(vertex, record, quarantined.Reason)
+	g.replica.Logger.Printf("quarantined vertex %q from replica %q: %s", vertex.Key, record.Replica, err)
+	g.replica.Metrics.Count("lww.graph.quarantine", 1)
+	return false
+}
@@ -0,0 +1,110 @@
+package lww
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantine(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	tick := base
+	ticking := clock.Func(func() time.Time {
+		tick = tick.Add(time.Millisecond)
+		return tick
+	})
+	noDigits := crdt.ValidatorFunc(func(key, value string) error {
+		if strings.ContainsAny(value, "0123456789") {
+			return errors.New("digits are not allowed")
+		}
+		return nil
+	})
+	strict := func(id string) Graph {
+		return NewGraph(crdt.Replica{ID: id, Clock: ticking, Validator: noDigits})
+	}
+	loose := func(id string) Graph {
+		return NewGraph(crdt.Replica{ID: id, Clock: ticking})
+	}
+
+	t.Run("rejects invalid local writes", func(t *testing.T) {
+		g := strict("A")
+		require.ErrorIs(t, g.AddVertex(Vertex{Key: "v1", Value: "1"}), crdt.ErrInvalidValue)
+		require.NoError(t, g.AddVertex(Vertex{Key: "v1", Value: "one"}))
+		require.ErrorIs(t, g.UpdateVertex(Vertex{Key: "v1", Value: "2"}), crdt.ErrInvalidValue)
+		require.ErrorIs(t, g.UpsertVertex(Vertex{Key: "v2", Value: "2"}), crdt.ErrInvalidValue)
+		_, err := g.CompareAndAddVertex(Vertex{Key: "v3", Value: "3"}, Version{})
+		require.ErrorIs(t, err, crdt.ErrInvalidValue)
+
+		found, err := g.Lookup("v1")
+		require.NoError(t, err)
+		require.Equal(t, "one", found.Value)
+		_, err = g.Lookup("v2")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		require.Empty(t, g.Quarantined(), "local writes are not quarantined")
+	})
+
+	t.Run("quarantines invalid values on merge", func(t *testing.T) {
+		a, b := strict("A"), loose("B")
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "one"}))
+		require.NoError(t, a.AddVertex(Vertex{Key: "v2", Value: "two"}))
+		b.Merge(a)
+
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "v1", Value: "1"}))
+		require.NoError(t, b.AddVertex(Vertex{Key: "v3", Value: "3"}))
+		require.NoError(t, b.AddVertex(Vertex{Key: "v4", Value: "four"}))
+		require.NoError(t, b.RemoveVertex("v2"))
+		a.Merge(b)
+
+		list, err := a.List()
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: Vertex{Key: "v1", Value: "one"}, AdjacentKeys: []string{}},
+			{Vertex: Vertex{Key: "v4", Value: "four"}, AdjacentKeys: []string{}},
+		}, list, "removals are merged")
+
+		quarantined := a.Quarantined()
+		require.Len(t, quarantined, 2)
+		require.Equal(t, Vertex{Key: "v1", Value: "1"}, quarantined[0].Vertex)
+		require.Equal(t, "B", quarantined[0].Replica)
+		require.Contains(t, quarantined[0].Reason, "digits are not allowed")
+		require.Equal(t, Vertex{Key: "v3", Value: "3"}, quarantined[1].Vertex)
+
+		a.ClearQuarantine()
+		require.Empty(t, a.Quarantined())
+	})
+
+	t.Run("quarantines values by the normalized keys", func(t *testing.T) {
+		a := NewGraph(crdt.Replica{ID: "A", Clock: ticking, Validator: noDigits, KeyNormalizer: crdt.LowerCase})
+		b := loose("B")
+		require.NoError(t, b.AddVertex(Vertex{Key: "V1", Value: "1"}))
+		require.NoError(t, b.AddVertex(Vertex{Key: "v1", Value: "2"}))
+		a.Merge(b)
+
+		quarantined := a.Quarantined()
+		require.Len(t, quarantined, 1)
+		require.Equal(t, Vertex{Key: "v1", Value: "2"}, quarantined[0].Vertex)
+		_, err := a.Lookup("V1")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("does not validate values the graph already has", func(t *testing.T) {
+		a := loose("A")
+		require.NoError(t, a.AddVertex(Vertex{Key: "v1", Value: "1"}))
+		b := strict("B")
+
+		data, err := a.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, b.Unmarshal(data), "restoring the state is not a merge")
+		b.Merge(a)
+		require.Empty(t, b.Quarantined())
+
+		found, err := b.Lookup("v1")
+		require.NoError(t, err)
+		require.Equal(t, "1", found.Value)
+	})
+}
@@ -0,0 +1,583 @@
+package lww
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrQuotaExceeded occurs when a write would exceed the quota of its namespace
+	ErrQuotaExceeded = errors.New("namespace quota exceeded")
+)
+
+// Quota restricts the usage of a namespace: all the vertices with keys starting with the namespace prefix
+// and all the edges starting from them. Zero limits mean no limit.
+type Quota struct {
+	// Namespace is the key prefix of the namespace (tenant)
+	Namespace string
+	// MaxElements is the maximum number of live vertices and edges in the namespace
+	MaxElements int
+	// MaxBytes is the maximum size of the keys and values of live vertices and edges in the namespace
+	MaxBytes int64
+	// Thresholds are fractions of the limits (e.g. 0.8 and 1) emitting a `QuotaEvent` when the usage crosses them,
+	// `[]float64{1}` if empty
+	Thresholds []float64
+	// Reject makes local writes exceeding a limit fail with `ErrQuotaExceeded`,
+	// otherwise the quota is soft and only emits events
+	Reject bool
+}
+
+// Usage is the amount of live data in a namespace
+type Usage struct {
+	// Elements is the number of live vertices and edges
+	Elements int
+	// Bytes is the size of the keys and values of live vertices and edges
+	Bytes int64
+}
+
+// QuotaEvent is emitted when the usage of a namespace crosses one of the quota thresholds
+type QuotaEvent struct {
+	// Namespace is the namespace of the quota
+	Namespace string
+	// Usage is the usage of the namespace after the change
+	Usage Usage
+	// Threshold is the crossed threshold
+	Threshold float64
+	// Above is `true` when the usage reached the threshold, `false` when it dropped below it
+	Above bool
+}
+
+// QuotaConfig contains the settings of the namespace quotas
+type QuotaConfig struct {
+	// Quotas are the quotas of the namespaces, when namespaces are nested the longest one applies
+	Quotas []Quota
+	// OnEvent is called when a threshold is crossed, nil discards the events.
+	// It's called synchronously after the write or merge, outside of the locks.
+	OnEvent func(QuotaEvent)
+}
+
+// NewQuotaGraph wraps the graph tracking the usage of the configured namespaces, the current state is counted.
+// The wrapped graph must not be changed directly afterwards, otherwise the usage drifts until `Recount`.
+func NewQuotaGraph(g Graph, config QuotaConfig) QuotaGraph {
+	quotas := make(map[string]Quota, len(config.Quotas))
+	for _, q := range config.Quotas {
+		if len(q.Thresholds) == 0 {
+			q.Thresholds = []float64{1}
+		}
+		quotas[q.Namespace] = q
+	}
+
+	qg := QuotaGraph{
+		Graph:      g,
+		quotaMutex: &sync.Mutex{},
+		quotas:     quotas,
+		usage:      make(map[string]Usage, len(quotas)),
+		onEvent:    config.OnEvent,
+	}
+	qg.Recount()
+
+	return qg
+}
+
+// QuotaGraph is a graph tracking the live element counts and byte usage per namespace (tenant),
+// so hosted multi-tenant deployments can enforce fair usage on replicated state.
+// Use `NewQuotaGraph` in order to initialize it before use.
+//
+// Local writes exceeding a quota with `Reject` fail. Merges are never rejected, since that would break
+// convergence, so the usage can exceed the limits after merging and only events are emitted.
+// Keys outside of all the namespaces are not tracked.
+// Other methods changing the state (e.g. `MergeCRDT` or `Unmarshal`) are not tracked, call `Recount` after them.
+// The graph is thread-safe and can be used from several go routines.
+type QuotaGraph struct {
+	Graph
+
+	// quotaMutex makes checking the quota and writing atomic
+	quotaMutex *sync.Mutex
+	// quotas maps a namespace to its quota
+	quotas map[string]Quota
+	// usage maps a namespace to its current usage
+	usage map[string]Usage
+	// onEvent receives threshold events
+	onEvent func(QuotaEvent)
+}
+
+// Usage returns the current usage of the namespace.
+// Returns `false` if there is no quota for the namespace.
+func (g QuotaGraph) Usage(ns string) (Usage, bool) {
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	usage, exists := g.usage[ns]
+	if !exists {
+		_, exists = g.quotas[ns]
+	}
+	return usage, exists
+}
+
+// AddVertex adds the vertex like `Graph.AddVertex` does.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the write.
+func (g QuotaGraph) AddVertex(v Vertex) error {
+	var events []QuotaEvent
+	defer func() { g.emit(events) }()
+
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	v.Key = g.replica.NormalizeKey(v.Key)
+	ns, tracked := g.namespace(v.Key)
+	delta := Usage{Elements: 1, Bytes: vertexSize(v)}
+	// an existing vertex is reported by the graph rather than by the quota
+	if _, err := g.Lookup(v.Key); err == nil {
+		tracked = false
+	}
+	if tracked {
+		err := g.check(ns, delta)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := g.Graph.AddVertex(v)
+	if err != nil {
+		return err
+	}
+
+	if tracked {
+		events = g.change(ns, delta)
+	}
+	return nil
+}
+
+// UpdateVertex replaces the vertex value like `Graph.UpdateVertex` does, counting the change of its size.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the write.
+func (g QuotaGraph) UpdateVertex(v Vertex) error {
+	return g.putVertex(v, g.Graph.UpdateVertex)
+}
+
+// UpsertVertex adds or replaces the vertex like `Graph.UpsertVertex` does.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the write.
+func (g QuotaGraph) UpsertVertex(v Vertex) error {
+	return g.putVertex(v, g.Graph.UpsertVertex)
+}
+
+// putVertex checks the quota and counts the vertex added or replaced by the `put` function
+func (g QuotaGraph) putVertex(v Vertex, put func(Vertex) error) error {
+	var events []QuotaEvent
+	defer func() { g.emit(events) }()
+
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	v.Key = g.replica.NormalizeKey(v.Key)
+	ns, tracked := g.namespace(v.Key)
+	delta := Usage{Elements: 1, Bytes: vertexSize(v)}
+	if existing, err := g.Lookup(v.Key); err == nil {
+		delta = Usage{Bytes: vertexSize(v) - vertexSize(existing)}
+	}
+	if tracked {
+		err := g.check(ns, delta)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := put(v)
+	if err != nil {
+		return err
+	}
+
+	if tracked {
+		events = g.change(ns, delta)
+	}
+	return nil
+}
+
+// RemoveVertex removes the vertex like `Graph.RemoveVertex` does,
+// the edges starting from the vertex keep counting until they are removed.
+func (g QuotaGraph) RemoveVertex(key string) error {
+	var events []QuotaEvent
+	defer func() { g.emit(events) }()
+
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	v, err := g.Lookup(key)
+	if err != nil {
+		return err
+	}
+
+	err = g.Graph.RemoveVertex(key)
+	if err != nil {
+		return err
+	}
+
+	if ns, tracked := g.namespace(v.Key); tracked {
+		events = g.change(ns, Usage{Elements: -1, Bytes: -vertexSize(v)})
+	}
+	return nil
+}
+
+// AddEdge adds the edge like `Graph.AddEdge` does, the edge belongs to the namespace of `fromKey`.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the write.
+func (g QuotaGraph) AddEdge(fromKey, toKey string) error {
+	return g.addEdge(fromKey, toKey, g.Graph.AddEdge)
+}
+
+// AddWeightedEdge adds the edge like `Graph.AddWeightedEdge` does, the edge belongs to the namespace of `fromKey`.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the write.
+func (g QuotaGraph) AddWeightedEdge(fromKey string, edge Edge) error {
+	return g.addEdge(fromKey, edge.To, func(fromKey, toKey string) error {
+		edge.To = toKey
+		return g.Graph.AddWeightedEdge(fromKey, edge)
+	})
+}
+
+// addEdge checks the quota and counts the edge added by the `add` function
+func (g QuotaGraph) addEdge(fromKey, toKey string, add func(fromKey, toKey string) error) error {
+	var events []QuotaEvent
+	defer func() { g.emit(events) }()
+
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	fromKey, toKey = g.replica.NormalizeKey(fromKey), g.replica.NormalizeKey(toKey)
+	ns, tracked := g.namespace(fromKey)
+	tracked = tracked && !g.edgeExists(fromKey, toKey)
+	delta := Usage{Elements: 1, Bytes: edgeSize(fromKey, toKey)}
+	if tracked {
+		err := g.check(ns, delta)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := add(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+
+	if tracked {
+		events = g.change(ns, delta)
+	}
+	return nil
+}
+
+// AddEdgeAcyclic adds the edge like `Graph.AddEdgeAcyclic` does, the edge belongs to the namespace of `fromKey`.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the write.
+func (g QuotaGraph) AddEdgeAcyclic(fromKey, toKey string) error {
+	return g.addEdge(fromKey, toKey, g.Graph.AddEdgeAcyclic)
+}
+
+// CompareAndAddVertex adds or replaces the vertex like `Graph.CompareAndAddVertex` does, counting the change.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the write.
+func (g QuotaGraph) CompareAndAddVertex(v Vertex, observed Version) (record Record, err error) {
+	err = g.putVertex(v, func(v Vertex) error {
+		record, err = g.Graph.CompareAndAddVertex(v, observed)
+		return err
+	})
+	if errors.Is(err, ErrQuotaExceeded) {
+		record = g.ObserveVertex(v.Key)
+	}
+	return record, err
+}
+
+// CompareAndRemoveVertex removes the vertex like `Graph.CompareAndRemoveVertex` does, counting the change.
+func (g QuotaGraph) CompareAndRemoveVertex(key string, observed Version) (Record, error) {
+	var events []QuotaEvent
+	defer func() { g.emit(events) }()
+
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	v, lookupErr := g.Lookup(key)
+	record, err := g.Graph.CompareAndRemoveVertex(key, observed)
+	if err != nil {
+		return record, err
+	}
+
+	if ns, tracked := g.namespace(v.Key); tracked && lookupErr == nil {
+		events = g.change(ns, Usage{Elements: -1, Bytes: -vertexSize(v)})
+	}
+	return record, nil
+}
+
+// AddVertices adds the vertices like `Graph.AddVertices` does, counting the whole batch.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the batch, nothing is added then.
+func (g QuotaGraph) AddVertices(vertices []Vertex) error {
+	return g.Update(addVertices(vertices))
+}
+
+// AddEdges adds the edges like `Graph.AddEdges` does, counting the whole batch.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the batch, nothing is added then.
+func (g QuotaGraph) AddEdges(edges []EdgeSpec) error {
+	return g.Update(addEdges(edges))
+}
+
+// Update runs the transaction like `Graph.Update` does, counting the net effect of its changes.
+// Returns an error with `ErrQuotaExceeded` cause if the namespace quota rejects the changes, nothing is changed then.
+func (g QuotaGraph) Update(fn func(tx Tx) error) error {
+	var events []QuotaEvent
+	defer func() { g.emit(events) }()
+
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	var deltas map[string]Usage
+	err := g.Graph.Update(func(tx Tx) error {
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+
+		deltas = g.txUsage(tx)
+		namespaces := make([]string, 0, len(deltas))
+		for ns := range deltas {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Strings(namespaces)
+		for _, ns := range namespaces {
+			err = g.check(ns, deltas[ns])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for ns, delta := range deltas {
+		events = append(events, g.change(ns, delta)...)
+	}
+	return nil
+}
+
+// txUsage returns the usage changes of the namespaces made by the net effect of the transaction.
+// Must be called under the write lock of the graph.
+func (g QuotaGraph) txUsage(tx Tx) map[string]Usage {
+	deltas := make(map[string]Usage)
+	count := func(key string, delta Usage) {
+		ns, tracked := g.namespace(key)
+		if !tracked {
+			return
+		}
+		usage := deltas[ns]
+		usage.Elements += delta.Elements
+		usage.Bytes += delta.Bytes
+		deltas[ns] = usage
+	}
+
+	for key, staged := range tx.state.vertices {
+		existing, err := g.Lookup(key)
+		exists := err == nil
+		switch {
+		case staged != nil && exists:
+			count(key, Usage{Bytes: vertexSize(Vertex{Key: key, Value: staged.Value}) - vertexSize(existing)})
+		case staged != nil:
+			count(key, Usage{Elements: 1, Bytes: vertexSize(Vertex{Key: key, Value: staged.Value})})
+		case exists:
+			// the edges starting from the vertex keep counting like with `RemoveVertex`
+			count(key, Usage{Elements: -1, Bytes: -vertexSize(existing)})
+		}
+	}
+
+	for fromKey, staged := range tx.state.edges {
+		for toKey, edge := range staged {
+			exists := g.hasEdge(fromKey, toKey)
+			switch {
+			case edge != nil && !exists:
+				count(fromKey, Usage{Elements: 1, Bytes: edgeSize(fromKey, toKey)})
+			case edge == nil && exists:
+				count(fromKey, Usage{Elements: -1, Bytes: -edgeSize(fromKey, toKey)})
+			}
+		}
+	}
+
+	return deltas
+}
+
+// RemoveEdge removes the edge like `Graph.RemoveEdge` does
+func (g QuotaGraph) RemoveEdge(fromKey, toKey string) error {
+	var events []QuotaEvent
+	defer func() { g.emit(events) }()
+
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	fromKey, toKey = g.replica.NormalizeKey(fromKey), g.replica.NormalizeKey(toKey)
+	existed := g.edgeExists(fromKey, toKey)
+	err := g.Graph.RemoveEdge(fromKey, toKey)
+	if err != nil {
+		return err
+	}
+
+	if ns, tracked := g.namespace(fromKey); tracked && existed {
+		events = g.change(ns, Usage{Elements: -1, Bytes: -edgeSize(fromKey, toKey)})
+	}
+	return nil
+}
+
+// Merge merges the remote graph like `Graph.Merge` does and recounts the usage
+func (g QuotaGraph) Merge(remote Graph) {
+	g.Graph.Merge(remote)
+	g.Recount()
+}
+
+// Recount counts the usage of all the namespaces from the current state of the graph,
+// emitting events for the crossed thresholds.
+func (g QuotaGraph) Recount() {
+	var events []QuotaEvent
+	defer func() { g.emit(events) }()
+
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	counted := make(map[string]Usage, len(g.quotas))
+	count := func(key string, delta Usage) {
+		ns, tracked := g.namespace(key)
+		if !tracked {
+			return
+		}
+		usage := counted[ns]
+		usage.Elements += delta.Elements
+		usage.Bytes += delta.Bytes
+		counted[ns] = usage
+	}
+
+	g.mutex.RLock()
+	for _, element := range g.vertices.List() {
+		v, isVertex := toVertex(element)
+		if !isVertex {
+			continue
+		}
+		count(v.Key, Usage{Elements: 1, Bytes: vertexSize(v)})
+	}
+	for fromKey, adjacent := range g.edges {
+		for _, to := range adjacent.List() {
+			count(fromKey, Usage{Elements: 1, Bytes: edgeSize(fromKey, to.GetKey())})
+		}
+	}
+	g.mutex.RUnlock()
+
+	for ns := range g.quotas {
+		before := g.usage[ns]
+		g.usage[ns] = counted[ns]
+		events = append(events, g.crossed(ns, before, counted[ns])...)
+	}
+}
+
+// namespace returns the namespace of the key, the longest matching one when namespaces are nested.
+// Returns `false` if the key does not belong to any namespace with a quota.
+func (g QuotaGraph) namespace(key string) (ns string, tracked bool) {
+	key = g.replica.NormalizeKey(key)
+	for prefix := range g.quotas {
+		if strings.HasPrefix(key, prefix) && (!tracked || len(prefix) > len(ns)) {
+			ns = prefix
+			tracked = true
+		}
+	}
+	return ns, tracked
+}
+
+// check returns an error with `ErrQuotaExceeded` cause if the rejecting quota of the namespace
+// does not allow the usage to grow by `delta`. Must be called under the lock.
+func (g QuotaGraph) check(ns string, delta Usage) error {
+	q := g.quotas[ns]
+	if !q.Reject {
+		return nil
+	}
+	usage := g.usage[ns]
+	if q.MaxElements > 0 && usage.Elements+delta.Elements > q.MaxElements {
+		return errors.Wrapf(ErrQuotaExceeded, "namespace %q allows at most %d elements", ns, q.MaxElements)
+	}
+	if q.MaxBytes > 0 && usage.Bytes+delta.Bytes > q.MaxBytes {
+		return errors.Wrapf(ErrQuotaExceeded, "namespace %q allows at most %d bytes", ns, q.MaxBytes)
+	}
+	return nil
+}
+
+// change applies the delta to the usage of the namespace and returns the events for the crossed thresholds.
+// Must be called under the lock.
+func (g QuotaGraph) change(ns string, delta Usage) []QuotaEvent {
+	before := g.usage[ns]
+	after := Usage{
+		Elements: before.Elements + delta.Elements,
+		Bytes:    before.Bytes + delta.Bytes,
+	}
+	g.usage[ns] = after
+	return g.crossed(ns, before, after)
+}
+
+// crossed returns the events for the thresholds crossed by changing the usage from `before` to `after`
+func (g QuotaGraph) crossed(ns string, before, after Usage) (events []QuotaEvent) {
+	q := g.quotas[ns]
+	ratioBefore, ratioAfter := q.ratio(before), q.ratio(after)
+	for _, threshold := range q.Thresholds {
+		above := ratioAfter >= threshold
+		if (ratioBefore >= threshold) == above {
+			continue
+		}
+		events = append(events, QuotaEvent{
+			Namespace: ns,
+			Usage:     after,
+			Threshold: threshold,
+			Above:     above,
+		})
+	}
+	return events
+}
+
+// ratio returns the largest fraction of the limits the usage takes
+func (q Quota) ratio(usage Usage) float64 {
+	var ratio float64
+	if q.MaxElements > 0 {
+		ratio = float64(usage.Elements) / float64(q.MaxElements)
+	}
+	if q.MaxBytes > 0 {
+		if bytesRatio := float64(usage.Bytes) / float64(q.MaxBytes); bytesRatio > ratio {
+			ratio = bytesRatio
+		}
+	}
+	return ratio
+}
+
+// emit sends the events to the handler
+func (g QuotaGraph) emit(events []QuotaEvent) {
+	if g.onEvent == nil {
+		return
+	}
+	for _, e := range events {
+		g.onEvent(e)
+	}
+}
+
+// edgeExists returns `true` if the live edge exists regardless of the vertices
+func (g QuotaGraph) edgeExists(fromKey, toKey string) bool {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return g.hasEdge(fromKey, toKey)
+}
+
+// hasEdge returns `true` if the live edge exists regardless of the vertices, must be called under the graph lock
+func (g QuotaGraph) hasEdge(fromKey, toKey string) bool {
+	adjacent, exists := g.edges[g.replica.NormalizeKey(fromKey)]
+	if !exists {
+		return false
+	}
+	_, err := adjacent.Lookup(toKey)
+	return err == nil
+}
+
+// vertexSize returns the size of the vertex for the quota
+func vertexSize(v Vertex) int64 {
+	return int64(len(v.Key) + len(v.Value))
+}
+
+// edgeSize returns the size of the edge for the quota
+func edgeSize(fromKey, toKey string) int64 {
+	return int64(len(fromKey) + len(toKey))
+}
@@ -0,0 +1,167 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuota(t *testing.T) {
+	t.Run("tracks usage per namespace", func(t *testing.T) {
+		g := NewQuotaGraph(NewGraph(testReplica), QuotaConfig{
+			Quotas: []Quota{{Namespace: "a/"}, {Namespace: "a/b/"}},
+		})
+
+		require.NoError(t, g.AddVertex(Vertex{Key: "a/1", Value: "xy"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "a/b/1", Value: "z"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "c/1"}))
+		require.NoError(t, g.AddEdge("a/1", "a/b/1"))
+		require.NoError(t, g.AddEdge("a/1", "a/b/1"), "adding the same edge does not count twice")
+
+		usage, exists := g.Usage("a/")
+		require.True(t, exists)
+		require.Equal(t, Usage{Elements: 2, Bytes: 5 + 8}, usage)
+
+		usage, exists = g.Usage("a/b/")
+		require.True(t, exists)
+		require.Equal(t, Usage{Elements: 1, Bytes: 6}, usage, "the longest namespace applies")
+
+		_, exists = g.Usage("c/")
+		require.False(t, exists)
+
+		require.NoError(t, g.RemoveEdge("a/1", "a/b/1"))
+		require.NoError(t, g.RemoveVertex("a/1"))
+		usage, _ = g.Usage("a/")
+		require.Equal(t, Usage{}, usage)
+	})
+
+	t.Run("counts the size change of updated vertices", func(t *testing.T) {
+		g := NewQuotaGraph(NewGraph(testReplica), QuotaConfig{
+			Quotas: []Quota{{Namespace: "a/", MaxBytes: 10, Reject: true}},
+		})
+
+		require.NoError(t, g.UpsertVertex(Vertex{Key: "a/1", Value: "xy"}))
+		require.NoError(t, g.UpdateVertex(Vertex{Key: "a/1", Value: "xyz"}))
+		usage, _ := g.Usage("a/")
+		require.Equal(t, Usage{Elements: 1, Bytes: 6}, usage)
+
+		err := g.UpdateVertex(Vertex{Key: "a/1", Value: "too long value"})
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		require.NoError(t, g.UpsertVertex(Vertex{Key: "a/1"}))
+		usage, _ = g.Usage("a/")
+		require.Equal(t, Usage{Elements: 1, Bytes: 3}, usage)
+	})
+
+	t.Run("emits events when thresholds are crossed", func(t *testing.T) {
+		var events []QuotaEvent
+		g := NewQuotaGraph(NewGraph(testReplica), QuotaConfig{
+			Quotas: []Quota{{Namespace: "t/", MaxElements: 4, Thresholds: []float64{0.5, 1}}},
+			OnEvent: func(e QuotaEvent) {
+				events = append(events, e)
+			},
+		})
+
+		require.NoError(t, g.AddVertex(Vertex{Key: "t/1"}))
+		require.Empty(t, events)
+		require.NoError(t, g.AddVertex(Vertex{Key: "t/2"}))
+		require.NoError(t, g.AddEdge("t/1", "t/2"))
+		require.NoError(t, g.AddEdge("t/2", "t/1"))
+		require.NoError(t, g.AddVertex(Vertex{Key: "t/3"}), "soft quotas do not reject writes")
+		require.NoError(t, g.RemoveVertex("t/3"))
+		require.NoError(t, g.RemoveVertex("t/2"))
+
+		require.Equal(t, []QuotaEvent{
+			{Namespace: "t/", Usage: Usage{Elements: 2, Bytes: 6}, Threshold: 0.5, Above: true},
+			{Namespace: "t/", Usage: Usage{Elements: 4, Bytes: 18}, Threshold: 1, Above: true},
+			{Namespace: "t/", Usage: Usage{Elements: 3, Bytes: 15}, Threshold: 1, Above: false},
+		}, events)
+	})
+
+	t.Run("rejects local writes but not merges", func(t *testing.T) {
+		var events []QuotaEvent
+		g := NewQuotaGraph(NewGraph(testReplica), QuotaConfig{
+			Quotas: []Quota{{Namespace: "t/", MaxBytes: 10, Reject: true}},
+			OnEvent: func(e QuotaEvent) {
+				events = append(events, e)
+			},
+		})
+
+		require.NoError(t, g.AddVertex(Vertex{Key: "t/1", Value: "1234567"}))
+		err := g.AddVertex(Vertex{Key: "t/2"})
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		require.ErrorIs(t, g.AddVertex(Vertex{Key: "t/1"}), ErrVertexAlreadyExists)
+		require.NoError(t, g.AddVertex(Vertex{Key: "other"}), "keys outside namespaces are not restricted")
+
+		remote := NewGraph(testReplica)
+		require.NoError(t, remote.AddVertex(Vertex{Key: "t/3"}))
+		g.Merge(remote)
+
+		_, err = g.Lookup("t/3")
+		require.NoError(t, err)
+		usage, _ := g.Usage("t/")
+		require.Equal(t, Usage{Elements: 2, Bytes: 13}, usage)
+		require.Equal(t, []QuotaEvent{
+			{Namespace: "t/", Usage: Usage{Elements: 1, Bytes: 10}, Threshold: 1, Above: true},
+		}, events)
+	})
+
+	t.Run("rejects batches and transactions over the quota", func(t *testing.T) {
+		g := NewQuotaGraph(NewGraph(testReplica), QuotaConfig{
+			Quotas: []Quota{{Namespace: "t/", MaxElements: 3, Reject: true}},
+		})
+		require.NoError(t, g.AddVertex(Vertex{Key: "t/1"}))
+
+		err := g.AddVertices([]Vertex{{Key: "t/2"}, {Key: "t/3"}, {Key: "t/4"}})
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		_, err = g.Lookup("t/2")
+		require.ErrorIs(t, err, ErrVertexNotFound, "nothing of the rejected batch is added")
+
+		require.NoError(t, g.AddVertices([]Vertex{{Key: "t/2"}, {Key: "other"}}))
+		err = g.AddEdges([]EdgeSpec{{From: "t/1", Edge: Edge{To: "t/2"}}, {From: "t/2", Edge: Edge{To: "t/1"}}})
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		require.NoError(t, g.AddEdges([]EdgeSpec{{From: "other", Edge: Edge{To: "t/1"}}}))
+
+		// the net effect of a transaction is counted
+		require.NoError(t, g.Update(func(tx Tx) error {
+			err := tx.RemoveVertex("t/2")
+			if err != nil {
+				return err
+			}
+			err = tx.AddVertex(Vertex{Key: "t/3"})
+			if err != nil {
+				return err
+			}
+			return tx.AddEdge("t/1", "t/3")
+		}))
+		usage, _ := g.Usage("t/")
+		require.Equal(t, Usage{Elements: 3, Bytes: 12}, usage)
+
+		err = g.AddEdgeAcyclic("t/3", "t/1")
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+
+		_, err = g.CompareAndAddVertex(Vertex{Key: "t/4"}, Version{})
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		record, err := g.CompareAndRemoveVertex("t/3", g.ObserveVertex("t/3").Version)
+		require.NoError(t, err)
+		require.Nil(t, record.Element)
+		_, err = g.CompareAndAddVertex(Vertex{Key: "t/4"}, Version{})
+		require.NoError(t, err)
+
+		usage, _ = g.Usage("t/")
+		require.Equal(t, Usage{Elements: 3, Bytes: 12}, usage)
+		g.Recount()
+		recounted, _ := g.Usage("t/")
+		require.Equal(t, usage, recounted)
+	})
+
+	t.Run("counts the existing state", func(t *testing.T) {
+		inner := NewGraph(testReplica)
+		require.NoError(t, inner.AddVertex(Vertex{Key: "t/1"}))
+		require.NoError(t, inner.AddVertex(Vertex{Key: "t/2"}))
+		require.NoError(t, inner.AddEdge("t/1", "t/2"))
+
+		g := NewQuotaGraph(inner, QuotaConfig{Quotas: []Quota{{Namespace: "t/"}}})
+		usage, _ := g.Usage("t/")
+		require.Equal(t, Usage{Elements: 3, Bytes: 12}, usage)
+	})
+}
@@ -0,0 +1,94 @@
+package lww
+
+import (
+	"github.com/pkg/errors"
+)
+
+// AreConnected answers whether the first vertex of every pair is connected to the second one
+// in the sense of `FindConnected`: there is a directed path of at least one edge between them,
+// so a vertex is connected to itself only if it's on a cycle.
+// Pairs with a vertex that does not exist are not connected.
+//
+// All the questions are answered on the same state of the graph in one traversal:
+// pairs with the same first vertex share a breadth-first search, and a search reaching a vertex
+// which reachability is already known reuses it instead of traversing its edges again.
+// It suits authorization checks asking "can A reach B" many times per request.
+//
+// The result has the same order as `pairs`.
+func (g Graph) AreConnected(pairs [][2]string) (connected []bool, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	// maps a vertex key to the set of keys of all the vertices it's connected to
+	reachable := make(map[string]map[string]nothing)
+
+	connected = make([]bool, len(pairs))
+	for i, pair := range pairs {
+		from, err := g.Lookup(pair[0])
+		if errors.Is(err, ErrVertexNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		to, err := g.Lookup(pair[1])
+		if errors.Is(err, ErrVertexNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		keys, known := reachable[from.Key]
+		if !known {
+			keys, err = g.reach(from.Key, reachable)
+			if err != nil {
+				return nil, err
+			}
+		}
+		_, connected[i] = keys[to.Key]
+	}
+
+	return connected, nil
+}
+
+// reach returns the keys of all the vertices connected to the vertex with the given key
+// and stores them in `reachable`, must be called under the graph lock.
+func (g Graph) reach(key string, reachable map[string]map[string]nothing) (map[string]nothing, error) {
+	keys := make(map[string]nothing)
+	queue := []string{key}
+
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, element := range g.listAdjacent(current) {
+			vertex, err := g.Lookup(element.GetKey())
+			// some edges exist even for removed vertices
+			if errors.Is(err, ErrVertexNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if _, visited := keys[vertex.Key]; visited {
+				continue
+			}
+			keys[vertex.Key] = nothing{}
+
+			// the traversal from this vertex is already done
+			if known, isKnown := reachable[vertex.Key]; isKnown {
+				for k := range known {
+					keys[k] = nothing{}
+				}
+				continue
+			}
+			queue = append(queue, vertex.Key)
+		}
+	}
+
+	reachable[key] = keys
+	return keys, nil
+}
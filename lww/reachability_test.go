@@ -0,0 +1,77 @@
+package lww
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAreConnected(t *testing.T) {
+	v1 := Vertex{Key: "vertex1", Value: "value1"}
+	v2 := Vertex{Key: "vertex2", Value: "value2"}
+	v3 := Vertex{Key: "vertex3", Value: "value3"}
+	v4 := Vertex{Key: "vertex4", Value: "value4"}
+	v5 := Vertex{Key: "vertex5", Value: "value5"}
+
+	// v1-->v2-->v3<--v4
+	//      ^    |
+	//      +----+
+	// v5 (removed) --> v1
+	g := NewGraph(testReplica)
+	for _, v := range []Vertex{v1, v2, v3, v4, v5} {
+		require.NoError(t, g.AddVertex(v))
+	}
+	require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+	require.NoError(t, g.AddEdge(v2.Key, v3.Key))
+	require.NoError(t, g.AddEdge(v3.Key, v2.Key))
+	require.NoError(t, g.AddEdge(v4.Key, v3.Key))
+	require.NoError(t, g.AddEdge(v5.Key, v1.Key))
+	require.NoError(t, g.RemoveVertex(v5.Key))
+
+	t.Run("answers all the pairs in order", func(t *testing.T) {
+		connected, err := g.AreConnected([][2]string{
+			{v1.Key, v3.Key},
+			{v3.Key, v1.Key},
+			{v4.Key, v2.Key},
+			{v2.Key, v4.Key},
+			{v1.Key, v2.Key},
+			{v2.Key, v2.Key},
+			{v1.Key, v1.Key},
+			{v5.Key, v1.Key},
+			{v1.Key, "non-existing"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []bool{true, false, true, false, true, true, false, false, false}, connected)
+	})
+
+	t.Run("matches FindConnected", func(t *testing.T) {
+		vertices := []Vertex{v1, v2, v3, v4}
+		var pairs [][2]string
+		for _, from := range vertices {
+			for _, to := range vertices {
+				pairs = append(pairs, [2]string{from.Key, to.Key})
+			}
+		}
+
+		answers, err := g.AreConnected(pairs)
+		require.NoError(t, err)
+
+		for i, pair := range pairs {
+			found, err := g.FindConnected(pair[0])
+			require.NoError(t, err)
+
+			expected := false
+			for _, v := range found {
+				expected = expected || v.Key == pair[1]
+			}
+			require.Equal(t, expected, answers[i], fmt.Sprintf("%s -> %s", pair[0], pair[1]))
+		}
+	})
+
+	t.Run("returns an empty list for no pairs", func(t *testing.T) {
+		connected, err := g.AreConnected(nil)
+		require.NoError(t, err)
+		require.Empty(t, connected)
+	})
+}
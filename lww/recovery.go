@@ -0,0 +1,145 @@
+package lww
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+// UnmarshalLive restores the state serialized by `Marshal` in two phases, so a large graph can serve reads
+// before it's restored completely, e.g. while a persisted replica is being recovered.
+//
+// It replaces the state of the graph with the live vertices and edges and the edge weights and returns,
+// `restoreRest` restores the removed vertices and edges along with all the removal records
+// and builds the index of incoming edges. Until `restoreRest` is called, reads return the live state
+// and `FindPredecessors` scans the edges instead of using the index. Writes and merges must wait
+// for `restoreRest`, since they cannot see the removals yet. `restoreRest` must be called once.
+// The graph remains unchanged if any part of the live state cannot be decoded.
+func (g Graph) UnmarshalLive(data []byte) (restoreRest func() error, err error) {
+	g.checkUsage()
+
+	var state graphState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal graph")
+	}
+	err = state.expandEdgeGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	live, rest := state, graphState{Edges: make(map[string]setState, len(state.Edges))}
+	live.Vertices, rest.Vertices = splitLive(state.Vertices, g.replica.Bias)
+	live.Edges = make(map[string]setState, len(state.Edges))
+	for key, adjacentState := range state.Edges {
+		live.Edges[key], rest.Edges[key] = splitLive(adjacentState, g.replica.Bias)
+	}
+
+	err = g.restore(live, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return g.restoreRest(rest)
+	}, nil
+}
+
+// restoreRest merges the records left out by `UnmarshalLive` into the graph and builds the index of incoming edges.
+// The records are merged by the last-writer-wins rule without notifying anyone, so the writes made
+// after `UnmarshalLive` are kept if they are newer.
+func (g Graph) restoreRest(rest graphState) error {
+	vertices := NewSetWithDecoder(g.replica, g.vertices.decode)
+	err := vertices.restoreState(rest.Vertices)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal vertices")
+	}
+
+	edges := make(map[string]Set, len(rest.Edges))
+	for key, adjacentState := range rest.Edges {
+		adjacent := g.newAdjacent(key)
+		err = adjacent.restoreState(adjacentState)
+		if err != nil {
+			return errors.Wrapf(err, "failed to unmarshal edges of vertex [key = %q]", key)
+		}
+		edges[key] = adjacent
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.vertices.restoreRecords(vertices)
+	for key, adjacent := range edges {
+		if adjacent.empty() {
+			continue
+		}
+		g.getAdjacent(key).restoreRecords(adjacent)
+	}
+
+	g.reindex()
+	*g.unindexed = false
+	return nil
+}
+
+// splitLive splits the state of a set into the additions of the live elements
+// and the rest: the additions of the removed elements and all the removals
+func splitLive(state setState, bias crdt.Bias) (live, rest setState) {
+	live = setState{
+		Additions: make(map[string]addState, len(state.Additions)),
+		Removals:  make(map[string]time.Time),
+		Siblings:  make(map[string][]addState),
+	}
+	rest = setState{
+		Additions: make(map[string]addState),
+		Removals:  state.Removals,
+		RemovedBy: state.RemovedBy,
+		Siblings:  make(map[string][]addState),
+	}
+
+	for key, added := range state.Additions {
+		removedAt, removed := state.Removals[key]
+		if removed && (removedAt.After(added.Timestamp) || bias == crdt.BiasRemove && removedAt.Equal(added.Timestamp)) {
+			rest.Additions[key] = added
+			if siblings, exist := state.Siblings[key]; exist {
+				rest.Siblings[key] = siblings
+			}
+			continue
+		}
+		live.Additions[key] = added
+		if siblings, exist := state.Siblings[key]; exist {
+			live.Siblings[key] = siblings
+		}
+	}
+
+	return live, rest
+}
+
+// restoreRecords merges the records of `rest` by the last-writer-wins rule without notifying the observer
+// or recording conflicts, it's used for restoring a state in parts
+func (s Set) restoreRecords(rest Set) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, record := range rest.additions {
+		local, added := s.additions[key]
+		if added && !newer(record.Timestamp, record.Replica, local.Timestamp, local.Replica) {
+			continue
+		}
+		s.additions[key] = record
+		if siblings, exist := rest.siblings[key]; exist {
+			s.siblings[key] = siblings
+		} else {
+			delete(s.siblings, key)
+		}
+	}
+
+	for key, removal := range rest.removals {
+		local, removed := s.removals[key]
+		if removed && !newer(removal.Timestamp, removal.Replica, local.Timestamp, local.Replica) {
+			continue
+		}
+		s.removals[key] = removal
+	}
+}
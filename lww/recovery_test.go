@@ -0,0 +1,89 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalLive(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	newReplica := func(id string, now *time.Time) crdt.Replica {
+		return crdt.Replica{ID: id, Clock: clock.Func(func() time.Time {
+			*now = now.Add(time.Second)
+			return *now
+		})}
+	}
+
+	now := base
+	original := NewGraph(newReplica("A", &now))
+	for _, key := range []string{"v1", "v2", "v3", "removed"} {
+		require.NoError(t, original.AddVertex(Vertex{Key: key, Value: "value of " + key}))
+	}
+	require.NoError(t, original.AddEdge("v1", "v2"))
+	require.NoError(t, original.AddEdge("v3", "v2"))
+	require.NoError(t, original.AddEdge("removed", "v2"))
+	require.NoError(t, original.AddEdgeWeight("v1", "v2", 3))
+	require.NoError(t, original.RemoveEdge("v3", "v2"))
+	require.NoError(t, original.RemoveVertex("removed"))
+	data, err := original.Marshal()
+	require.NoError(t, err)
+
+	t.Run("restores the live state first and the rest later", func(t *testing.T) {
+		g := NewGraph(crdt.NewReplica("B"))
+		restoreRest, err := g.UnmarshalLive(data)
+		require.NoError(t, err)
+
+		list, err := g.List()
+		require.NoError(t, err)
+		expected, err := original.List()
+		require.NoError(t, err)
+		require.ElementsMatch(t, expected, list)
+		require.Empty(t, g.vertices.removals, "removals are restored later")
+
+		predecessors, err := g.FindPredecessors("v2")
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{{Key: "v1", Value: "value of v1"}}, predecessors, "the edges are scanned")
+		weight, err := g.EdgeWeight("v1", "v2")
+		require.NoError(t, err)
+		require.Equal(t, int64(3), weight)
+
+		require.NoError(t, restoreRest())
+		restored, err := g.Marshal()
+		require.NoError(t, err)
+		require.JSONEq(t, string(data), string(restored))
+		require.False(t, *g.unindexed)
+		predecessors, err = g.FindPredecessors("v2")
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{{Key: "v1", Value: "value of v1"}}, predecessors)
+	})
+
+	t.Run("keeps the newer writes made before the rest is restored", func(t *testing.T) {
+		later := now
+		g := NewGraph(newReplica("B", &later))
+		restoreRest, err := g.UnmarshalLive(data)
+		require.NoError(t, err)
+
+		require.NoError(t, g.AddVertex(Vertex{Key: "removed", Value: "re-added"}))
+		require.NoError(t, restoreRest())
+
+		found, err := g.Lookup("removed")
+		require.NoError(t, err)
+		require.Equal(t, "re-added", found.Value)
+		predecessors, err := g.FindPredecessors("v2")
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{
+			{Key: "removed", Value: "re-added"},
+			{Key: "v1", Value: "value of v1"},
+		}, predecessors, "the edge of the re-added vertex is back")
+	})
+
+	t.Run("returns an error for a broken state", func(t *testing.T) {
+		g := NewGraph(crdt.NewReplica("B"))
+		_, err := g.UnmarshalLive([]byte("{"))
+		require.Error(t, err)
+	})
+}
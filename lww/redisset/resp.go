@@ -0,0 +1,248 @@
+package redisset
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrRedis occurs when Redis replies with an error
+	ErrRedis = errors.New("redis error")
+	// ErrProtocol occurs when a Redis reply cannot be parsed
+	ErrProtocol = errors.New("redis protocol error")
+)
+
+// Client runs the Redis commands used by the set.
+// `RESPClient` implements it, a client of another Redis library can be wrapped instead.
+type Client interface {
+	// SAdd adds the member to the set stored at the key
+	SAdd(ctx context.Context, key, member string) error
+	// SMembers returns all the members of the set stored at the key
+	SMembers(ctx context.Context, key string) ([]string, error)
+	// HSetNX sets the field of the hash stored at the key only if the field does not exist
+	HSetNX(ctx context.Context, key, field, value string) error
+	// HGetAll returns all the fields of the hash stored at the key
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	// HDel deletes the fields from the hash stored at the key
+	HDel(ctx context.Context, key string, fields ...string) error
+}
+
+// Dial connects to the Redis server at the given address (e.g. `localhost:6379`)
+// and returns a client speaking the Redis serialization protocol (RESP).
+// Call `Close` when the client is not used anymore.
+func Dial(ctx context.Context, addr string) (RESPClient, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return RESPClient{}, errors.Wrapf(err, "failed to connect to redis at %q", addr)
+	}
+	return NewRESPClient(conn), nil
+}
+
+// NewRESPClient creates a client sending commands over the given connection.
+func NewRESPClient(conn net.Conn) RESPClient {
+	return RESPClient{
+		mutex:  &sync.Mutex{},
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// RESPClient is a minimal Redis client implementing the `Client` interface.
+// Use `Dial` or `NewRESPClient` in order to initialize it before use.
+// The client is thread-safe, commands are sent one at a time over a single connection.
+// After a network error the connection state is unknown, close the client and dial again.
+type RESPClient struct {
+	// mutex serializes commands on the connection
+	mutex *sync.Mutex
+
+	// conn is the connection to the server
+	conn net.Conn
+	// reader buffers the replies
+	reader *bufio.Reader
+}
+
+// Close closes the connection
+func (c RESPClient) Close() error {
+	return c.conn.Close()
+}
+
+// SAdd implements the `Client` interface
+func (c RESPClient) SAdd(ctx context.Context, key, member string) error {
+	_, err := c.do(ctx, "SADD", key, member)
+	return err
+}
+
+// SMembers implements the `Client` interface
+func (c RESPClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	reply, err := c.do(ctx, "SMEMBERS", key)
+	if err != nil {
+		return nil, err
+	}
+	return stringsReply(reply)
+}
+
+// HSetNX implements the `Client` interface
+func (c RESPClient) HSetNX(ctx context.Context, key, field, value string) error {
+	_, err := c.do(ctx, "HSETNX", key, field, value)
+	return err
+}
+
+// HGetAll implements the `Client` interface
+func (c RESPClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	reply, err := c.do(ctx, "HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+	list, err := stringsReply(reply)
+	if err != nil {
+		return nil, err
+	}
+	if len(list)%2 != 0 {
+		return nil, errors.Wrap(ErrProtocol, "odd number of hash fields and values")
+	}
+
+	hash := make(map[string]string, len(list)/2)
+	for i := 0; i < len(list); i += 2 {
+		hash[list[i]] = list[i+1]
+	}
+	return hash, nil
+}
+
+// HDel implements the `Client` interface
+func (c RESPClient) HDel(ctx context.Context, key string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	_, err := c.do(ctx, "HDEL", append([]string{key}, fields...)...)
+	return err
+}
+
+// do sends the command and reads the reply, the context deadline is applied to the connection
+func (c RESPClient) do(ctx context.Context, command string, args ...string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	err = c.conn.SetDeadline(deadline)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set the redis connection deadline")
+	}
+	defer func() {
+		_ = c.conn.SetDeadline(time.Time{})
+	}()
+
+	_, err = c.conn.Write(encodeCommand(append([]string{command}, args...)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to send redis command %s", command)
+	}
+
+	reply, err := readReply(c.reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to run redis command %s", command)
+	}
+	return reply, nil
+}
+
+// encodeCommand encodes the command as a RESP array of bulk strings
+func encodeCommand(args []string) []byte {
+	buf := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		buf = append(buf, fmt.Sprintf("$%d\r\n", len(arg))...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// readReply reads a single RESP value: a string, an integer, nil or a slice of values.
+// Error replies are returned as errors with `ErrRedis` cause.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.Wrapf(ErrProtocol, "invalid reply line %q", line)
+	}
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return value, nil
+	case '-':
+		return nil, errors.Wrap(ErrRedis, value)
+	case ':':
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(ErrProtocol, "invalid integer %q", value)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrapf(ErrProtocol, "invalid bulk string size %q", value)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrapf(ErrProtocol, "invalid array size %q", value)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		list := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			item, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	default:
+		return nil, errors.Wrapf(ErrProtocol, "unknown reply type %q", kind)
+	}
+}
+
+// stringsReply converts an array reply of strings
+func stringsReply(reply interface{}) ([]string, error) {
+	if reply == nil {
+		return nil, nil
+	}
+	list, isList := reply.([]interface{})
+	if !isList {
+		return nil, errors.Wrapf(ErrProtocol, "expected an array, got %T", reply)
+	}
+
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		s, isString := item.(string)
+		if !isString {
+			return nil, errors.Wrapf(ErrProtocol, "expected a string, got %T", item)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
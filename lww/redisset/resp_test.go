@@ -0,0 +1,182 @@
+package redisset
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is an in-process server implementing the Redis commands used by the set
+type fakeRedis struct {
+	mutex    sync.Mutex
+	listener net.Listener
+	sets     map[string]map[string]bool
+	hashes   map[string]map[string]string
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &fakeRedis{
+		listener: listener,
+		sets:     make(map[string]map[string]bool),
+		hashes:   make(map[string]map[string]string),
+	}
+	go server.serve()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	return server
+}
+
+func (s *fakeRedis) dial(t *testing.T) RESPClient {
+	client, err := Dial(context.Background(), s.listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		command, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		args, err := stringsReply(command)
+		if err != nil || len(args) == 0 {
+			return
+		}
+		_, err = conn.Write([]byte(s.run(args)))
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) run(args []string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "SADD":
+		if s.sets[args[1]] == nil {
+			s.sets[args[1]] = make(map[string]bool)
+		}
+		s.sets[args[1]][args[2]] = true
+		return ":1\r\n"
+	case "SMEMBERS":
+		var members []string
+		for member := range s.sets[args[1]] {
+			members = append(members, member)
+		}
+		return array(members)
+	case "HSETNX":
+		if s.hashes[args[1]] == nil {
+			s.hashes[args[1]] = make(map[string]string)
+		}
+		if _, exists := s.hashes[args[1]][args[2]]; exists {
+			return ":0\r\n"
+		}
+		s.hashes[args[1]][args[2]] = args[3]
+		return ":1\r\n"
+	case "HGETALL":
+		var fields []string
+		for field := range s.hashes[args[1]] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		var list []string
+		for _, field := range fields {
+			list = append(list, field, s.hashes[args[1]][field])
+		}
+		return array(list)
+	case "HDEL":
+		for _, field := range args[2:] {
+			delete(s.hashes[args[1]], field)
+		}
+		return fmt.Sprintf(":%d\r\n", len(args)-2)
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func array(list []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(list))
+	for _, item := range list {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(item), item)
+	}
+	return b.String()
+}
+
+func TestRESPClient(t *testing.T) {
+	server := startFakeRedis(t)
+	client := server.dial(t)
+	ctx := context.Background()
+
+	t.Run("runs set and hash commands", func(t *testing.T) {
+		require.NoError(t, client.SAdd(ctx, "set", "a"))
+		require.NoError(t, client.SAdd(ctx, "set", "b"))
+		members, err := client.SMembers(ctx, "set")
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"a", "b"}, members)
+
+		require.NoError(t, client.HSetNX(ctx, "hash", "f1", "v1"))
+		require.NoError(t, client.HSetNX(ctx, "hash", "f1", "ignored"))
+		require.NoError(t, client.HSetNX(ctx, "hash", "f2", ""))
+		hash, err := client.HGetAll(ctx, "hash")
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"f1": "v1", "f2": ""}, hash)
+
+		require.NoError(t, client.HDel(ctx, "hash", "f1"))
+		hash, err = client.HGetAll(ctx, "hash")
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"f2": ""}, hash)
+	})
+
+	t.Run("returns ErrRedis for error replies", func(t *testing.T) {
+		_, err := client.do(ctx, "UNKNOWN")
+		require.ErrorIs(t, err, ErrRedis)
+
+		members, err := client.SMembers(ctx, "set")
+		require.NoError(t, err, "the connection must remain usable")
+		require.Len(t, members, 2)
+	})
+
+	t.Run("returns ErrProtocol for malformed replies", func(t *testing.T) {
+		_, err := readReply(bufio.NewReader(strings.NewReader("?what\r\n")))
+		require.ErrorIs(t, err, ErrProtocol)
+		_, err = readReply(bufio.NewReader(strings.NewReader("$abc\r\n")))
+		require.ErrorIs(t, err, ErrProtocol)
+	})
+
+	t.Run("returns the context error", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := client.SMembers(canceled, "set")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,362 @@
+// Package redisset implements a Last-Writer-Wins element set stored in Redis, so several processes
+// on one machine (or a fleet) can share a single replica.
+//
+// It has the same semantics and operations as `lww.Set`, but every operation takes a context
+// and returns the Redis errors. The state can be merged with `lww.Set` replicas in both directions
+// since `Marshal` produces the format of `lww.Set.Marshal`.
+//
+// Every operation is stored as a separate field of a Redis hash per element key with the timestamp
+// and the replica ID as the field name `{nanoseconds}:{replica}`, so concurrent writers never overwrite
+// each other and no scripting is needed. The latest operation wins on reading in the same order as
+// in `lww.Set`: the later timestamp wins, the greater replica ID wins when timestamps collide.
+// Older fields are deleted after every write.
+// For the set named `tags` the following Redis keys are used:
+//
+//	tags:keys          - a set of all the element keys
+//	tags:add:{key}     - a hash of addition timestamps and replicas to JSON elements
+//	tags:rem:{key}     - a hash of removal timestamps and replicas
+package redisset
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+// fieldSeparator separates the timestamp and the replica ID in the hash field names
+const fieldSeparator = ":"
+
+// NewSet creates a set stored in Redis under the given name.
+// The set can decode only `lww.IDElement` elements, use `NewSetWithDecoder` for other element types.
+// `r` defines the clock used for timestamping operations and the bias for resolving colliding timestamps.
+func NewSet(r crdt.Replica, client Client, name string) Set {
+	return NewSetWithDecoder(r, client, name, lww.DecodeIDElement)
+}
+
+// NewSetWithDecoder creates a set stored in Redis under the given name.
+// `decode` is used for deserializing elements.
+func NewSetWithDecoder(r crdt.Replica, client Client, name string, decode lww.ElementDecoder) Set {
+	return Set{
+		replica: r.WithDefaults(),
+		client:  client,
+		name:    name,
+		decode:  decode,
+	}
+}
+
+// Set is a Last-Writer-Wins element set stored in Redis.
+// Use `NewSet` in order to initialize it before use.
+// The set is thread-safe and can be used from several go routines and processes
+// as long as the client is thread-safe.
+type Set struct {
+	// replica is the identity and the policies of the replica the set belongs to
+	replica crdt.Replica
+	// client runs Redis commands
+	client Client
+	// name is the prefix of all the Redis keys of the set
+	name string
+	// decode is used for deserializing elements
+	decode lww.ElementDecoder
+}
+
+// state is the serialized format of `lww.Set`
+type state struct {
+	// Additions maps an element key to its addition record
+	Additions map[string]addition `json:"additions"`
+	// Removals maps an element key to the time it was removed
+	Removals map[string]time.Time `json:"removals"`
+	// RemovedBy maps an element key to the ID of the replica that removed it
+	RemovedBy map[string]string `json:"removedBy,omitempty"`
+}
+
+// addition is the serialized format of an addition record of `lww.Set`
+type addition struct {
+	// Element is the JSON representation of the element
+	Element json.RawMessage `json:"element"`
+	// Timestamp is when the element was added
+	Timestamp time.Time `json:"timestamp"`
+	// Replica is the ID of the replica that added the element
+	Replica string `json:"replica,omitempty"`
+}
+
+// record is the latest operation stored in a hash
+type record struct {
+	// found is `false` if there is no operation
+	found bool
+	// timestamp is when the operation happened
+	timestamp time.Time
+	// replica is the ID of the replica that made the operation
+	replica string
+	// value is the value of the operation, a JSON element for additions
+	value string
+}
+
+// Add adds the given element to the set.
+// It replaces an existing element if the element key collides.
+func (s Set) Add(ctx context.Context, e lww.Element) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal element [key = %q]", e.GetKey())
+	}
+
+	key := s.replica.NormalizeKey(e.GetKey())
+	err = s.write(ctx, key, s.additionsKey(key), s.replica.Clock.Now(), s.replica.ID, string(value))
+	if err != nil {
+		return err
+	}
+	s.replica.Metrics.Count("redisset.add", 1)
+
+	return nil
+}
+
+// Remove removes an element with the given key from the set.
+// This operation succeeds even if the element does not exist in the set.
+func (s Set) Remove(ctx context.Context, key string) error {
+	key = s.replica.NormalizeKey(key)
+	err := s.write(ctx, key, s.removalsKey(key), s.replica.Clock.Now(), s.replica.ID, "")
+	if err != nil {
+		return err
+	}
+	s.replica.Metrics.Count("redisset.remove", 1)
+
+	return nil
+}
+
+// Lookup checks if an element with the given key exists in the set.
+// Returns the found element and no error if the element exists.
+// Returns an error with `lww.ErrElementNotFound` cause if it does not exist.
+func (s Set) Lookup(ctx context.Context, key string) (lww.Element, error) {
+	key = s.replica.NormalizeKey(key)
+	added, removed, err := s.read(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !added.found || s.removed(added, removed) {
+		return nil, errors.Wrapf(lww.ErrElementNotFound, "failed to find element [key = %q]", key)
+	}
+
+	element, err := s.decode([]byte(added.value))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal element [key = %q]", key)
+	}
+
+	return element, nil
+}
+
+// List returns a list of the actual elements of the set sorted by their keys.
+// Every element is read with a separate request, it's not an atomic snapshot of the set.
+func (s Set) List(ctx context.Context) ([]lww.Element, error) {
+	keys, err := s.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// it's always at list an empty list, not nil
+	list := []lww.Element{}
+	for _, key := range keys {
+		element, err := s.Lookup(ctx, key)
+		if errors.Is(err, lww.ErrElementNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, element)
+	}
+
+	return list, nil
+}
+
+// Merge takes an `lww.Set` as a `remote` and merges its state into the set.
+func (s Set) Merge(ctx context.Context, remote lww.Set) error {
+	data, err := remote.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the remote set")
+	}
+	return s.MergeState(ctx, data)
+}
+
+// MergeState merges the serialized state of an `lww.Set` or another Redis set (see `Marshal`) into the set.
+func (s Set) MergeState(ctx context.Context, data []byte) error {
+	var remote state
+	err := json.Unmarshal(data, &remote)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal the remote set")
+	}
+
+	for key, added := range remote.Additions {
+		key = s.replica.NormalizeKey(key)
+		err = s.write(ctx, key, s.additionsKey(key), added.Timestamp, added.Replica, string(added.Element))
+		if err != nil {
+			return err
+		}
+	}
+
+	for key, removedAt := range remote.Removals {
+		removedBy := remote.RemovedBy[key]
+		key = s.replica.NormalizeKey(key)
+		err = s.write(ctx, key, s.removalsKey(key), removedAt, removedBy, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	s.replica.Metrics.Count("redisset.merge", 1)
+
+	return nil
+}
+
+// Marshal serializes the state of the set in the format of `lww.Set.Marshal`,
+// so it can be merged into an `lww.Set` replica.
+func (s Set) Marshal(ctx context.Context) ([]byte, error) {
+	keys, err := s.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := state{
+		Additions: make(map[string]addition, len(keys)),
+		Removals:  make(map[string]time.Time),
+		RemovedBy: make(map[string]string),
+	}
+	for _, key := range keys {
+		added, removed, err := s.read(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if added.found {
+			result.Additions[key] = addition{
+				Element:   json.RawMessage(added.value),
+				Timestamp: added.timestamp,
+				Replica:   added.replica,
+			}
+		}
+		if removed.found {
+			result.Removals[key] = removed.timestamp
+			if removed.replica != "" {
+				result.RemovedBy[key] = removed.replica
+			}
+		}
+	}
+
+	return json.Marshal(result)
+}
+
+// keys returns all the element keys of the set sorted
+func (s Set) keys(ctx context.Context) ([]string, error) {
+	keys, err := s.client.SMembers(ctx, s.name+":keys")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the keys of set %q", s.name)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// read returns the latest addition and removal of the element key
+func (s Set) read(ctx context.Context, key string) (added, removed record, err error) {
+	added, _, err = s.latest(ctx, s.additionsKey(key))
+	if err != nil {
+		return added, removed, err
+	}
+	removed, _, err = s.latest(ctx, s.removalsKey(key))
+	return added, removed, err
+}
+
+// write stores the operation in the hash unless the same operation exists,
+// then deletes the older operations
+func (s Set) write(ctx context.Context, key, hashKey string, timestamp time.Time, replica, value string) error {
+	err := s.client.SAdd(ctx, s.name+":keys", key)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store the key %q of set %q", key, s.name)
+	}
+
+	// operations with colliding timestamps have different fields, `latest` picks the winner
+	field := strconv.FormatInt(timestamp.UnixNano(), 10) + fieldSeparator + replica
+	err = s.client.HSetNX(ctx, hashKey, field, value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store an operation of key %q of set %q", key, s.name)
+	}
+
+	_, older, err := s.latest(ctx, hashKey)
+	if err != nil {
+		return err
+	}
+	err = s.client.HDel(ctx, hashKey, older...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete older operations of key %q of set %q", key, s.name)
+	}
+
+	return nil
+}
+
+// latest returns the latest operation stored in the hash and the fields of the older ones
+func (s Set) latest(ctx context.Context, hashKey string) (latest record, older []string, err error) {
+	hash, err := s.client.HGetAll(ctx, hashKey)
+	if err != nil {
+		return latest, nil, errors.Wrapf(err, "failed to read %q", hashKey)
+	}
+
+	var latestField string
+	for field, value := range hash {
+		// fields written before the replica IDs were stored have only the timestamp
+		nanosField, replica := field, ""
+		if idx := strings.Index(field, fieldSeparator); idx != -1 {
+			nanosField, replica = field[:idx], field[idx+len(fieldSeparator):]
+		}
+		nanos, err := strconv.ParseInt(nanosField, 10, 64)
+		if err != nil {
+			return latest, nil, errors.Wrapf(ErrProtocol, "invalid timestamp %q in %q", field, hashKey)
+		}
+		timestamp := time.Unix(0, nanos).UTC()
+		if latest.found && !newer(timestamp, replica, latest.timestamp, latest.replica) {
+			older = append(older, field)
+			continue
+		}
+		if latest.found {
+			older = append(older, latestField)
+		}
+		latest = record{found: true, timestamp: timestamp, replica: replica, value: value}
+		latestField = field
+	}
+
+	return latest, older, nil
+}
+
+// newer returns `true` if the operation at `t` by `replica` wins over the operation at `other` by `otherReplica`.
+// It's the same order `lww.Set` uses: the later timestamp wins, the greater replica ID wins when timestamps collide.
+func newer(t time.Time, replica string, other time.Time, otherReplica string) bool {
+	if t.Equal(other) {
+		return replica > otherReplica
+	}
+	return t.After(other)
+}
+
+// removed returns `true` if the addition is overridden by the removal.
+// When the removal and the addition have the same timestamp, the replica bias decides.
+func (s Set) removed(added, removed record) bool {
+	if !removed.found {
+		return false
+	}
+	if s.replica.Bias == crdt.BiasRemove {
+		return !removed.timestamp.Before(added.timestamp)
+	}
+	return removed.timestamp.After(added.timestamp)
+}
+
+// additionsKey returns the Redis key of the additions hash of the element key
+func (s Set) additionsKey(key string) string {
+	return s.name + ":add:" + key
+}
+
+// removalsKey returns the Redis key of the removals hash of the element key
+func (s Set) removalsKey(key string) string {
+	return s.name + ":rem:" + key
+}
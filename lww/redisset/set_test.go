@@ -0,0 +1,140 @@
+package redisset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet(t *testing.T) {
+	ctx := context.Background()
+	server := startFakeRedis(t)
+
+	now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	r := crdt.NewReplica("redis")
+	r.Clock = clock.Func(func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	})
+
+	t.Run("adds, removes and lists elements", func(t *testing.T) {
+		s := NewSet(r, server.dial(t), "basic")
+		require.NoError(t, s.Add(ctx, lww.IDElement("b")))
+		require.NoError(t, s.Add(ctx, lww.IDElement("a")))
+		require.NoError(t, s.Add(ctx, lww.IDElement("c")))
+		require.NoError(t, s.Remove(ctx, "c"))
+
+		found, err := s.Lookup(ctx, "a")
+		require.NoError(t, err)
+		require.Equal(t, lww.IDElement("a"), found)
+
+		_, err = s.Lookup(ctx, "c")
+		require.ErrorIs(t, err, lww.ErrElementNotFound)
+
+		list, err := s.List(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []lww.Element{lww.IDElement("a"), lww.IDElement("b")}, list)
+
+		require.NoError(t, s.Add(ctx, lww.IDElement("c")))
+		_, err = s.Lookup(ctx, "c")
+		require.NoError(t, err, "the later addition must win")
+	})
+
+	t.Run("processes share the replica", func(t *testing.T) {
+		first := NewSetWithDecoder(r, server.dial(t), "shared", lww.DecodeVertex)
+		second := NewSetWithDecoder(r, server.dial(t), "shared", lww.DecodeVertex)
+
+		v := lww.Vertex{Key: "vertex", Value: "value"}
+		require.NoError(t, first.Add(ctx, v))
+
+		found, err := second.Lookup(ctx, v.Key)
+		require.NoError(t, err)
+		require.Equal(t, v, found)
+	})
+
+	t.Run("keeps only the latest operation of a key", func(t *testing.T) {
+		s := NewSet(r, server.dial(t), "compact")
+		for i := 0; i < 3; i++ {
+			require.NoError(t, s.Add(ctx, lww.IDElement("a")))
+		}
+		hash, err := server.dial(t).HGetAll(ctx, "compact:add:a")
+		require.NoError(t, err)
+		require.Len(t, hash, 1)
+	})
+
+	t.Run("merges with lww.Set replicas in both directions", func(t *testing.T) {
+		s := NewSet(r, server.dial(t), "merged")
+		require.NoError(t, s.Add(ctx, lww.IDElement("redis")))
+		require.NoError(t, s.Add(ctx, lww.IDElement("shared")))
+
+		memory := lww.NewSet(r)
+		memory.Add(lww.IDElement("memory"))
+		memory.Remove("shared")
+
+		require.NoError(t, s.Merge(ctx, memory))
+		data, err := s.Marshal(ctx)
+		require.NoError(t, err)
+		remote := lww.NewSet(crdt.NewReplica("remote"))
+		require.NoError(t, remote.Unmarshal(data))
+		memory.Merge(remote)
+
+		list, err := s.List(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []lww.Element{lww.IDElement("memory"), lww.IDElement("redis")}, list)
+		require.ElementsMatch(t, list, memory.List())
+	})
+
+	t.Run("resolves colliding timestamps by the replica ID like lww.Set", func(t *testing.T) {
+		at := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+		replica := func(id string) crdt.Replica {
+			r := crdt.NewReplica(id)
+			r.Clock = clock.Func(func() time.Time { return at })
+			return r
+		}
+		fromA := lww.Vertex{Key: "vertex", Value: "from A"}
+		fromB := lww.Vertex{Key: "vertex", Value: "from B"}
+
+		for _, name := range []string{"collision-ab", "collision-ba"} {
+			a := NewSetWithDecoder(replica("A"), server.dial(t), name, lww.DecodeVertex)
+			b := NewSetWithDecoder(replica("B"), server.dial(t), name, lww.DecodeVertex)
+			if name == "collision-ab" {
+				require.NoError(t, a.Add(ctx, fromA))
+				require.NoError(t, b.Add(ctx, fromB))
+			} else {
+				require.NoError(t, b.Add(ctx, fromB))
+				require.NoError(t, a.Add(ctx, fromA))
+			}
+
+			found, err := a.Lookup(ctx, fromA.Key)
+			require.NoError(t, err)
+			require.Equal(t, fromB, found, "the greater replica ID wins in %q", name)
+		}
+
+		s := NewSetWithDecoder(replica("B"), server.dial(t), "collision-ab", lww.DecodeVertex)
+		require.NoError(t, s.Remove(ctx, "removed"))
+		data, err := s.Marshal(ctx)
+		require.NoError(t, err)
+
+		memory := lww.NewSetWithDecoder(replica("A"), lww.DecodeVertex)
+		memory.Add(fromA)
+		remote := lww.NewSetWithDecoder(replica("remote"), lww.DecodeVertex)
+		require.NoError(t, remote.Unmarshal(data))
+		memory.Merge(remote)
+
+		found, err := memory.Lookup(fromA.Key)
+		require.NoError(t, err)
+		require.Equal(t, fromB, found)
+
+		memoryData, err := memory.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, s.MergeState(ctx, memoryData))
+		data, err = s.Marshal(ctx)
+		require.NoError(t, err)
+		require.Contains(t, string(data), `"removedBy":{"removed":"B"}`)
+	})
+}
@@ -0,0 +1,272 @@
+package lww
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+var (
+	// ErrRetentionPolicyNotFound occurs when no retention policy applies to a key prefix
+	ErrRetentionPolicyNotFound = errors.New("retention policy not found")
+)
+
+// RetentionPolicy defines how long the vertices and edges with keys starting with a prefix are kept,
+// e.g. sessions or telemetry data. An edge belongs to the prefix of the vertex it starts from.
+type RetentionPolicy struct {
+	// Prefix is the key prefix the policy applies to, it's the key of the policy.
+	// When prefixes are nested the longest one applies.
+	Prefix string `json:"prefix"`
+	// MaxAge is how long a vertex or an edge is kept after it was last written before it's removed, zero keeps it
+	MaxAge time.Duration `json:"maxAge,omitempty"`
+	// TombstoneAge is how long the record of a removal is kept before it's purged from the state, zero keeps it.
+	// It must be longer than the time it takes all the replicas to exchange their states:
+	// a replica that merges the purged element before it sees the removal brings the element back.
+	TombstoneAge time.Duration `json:"tombstoneAge,omitempty"`
+}
+
+// GetKey implements the `Element` interface
+func (p RetentionPolicy) GetKey() string {
+	return p.Prefix
+}
+
+// DecodeRetentionPolicy is an `ElementDecoder` of `RetentionPolicy`
+func DecodeRetentionPolicy(data []byte) (Element, error) {
+	var p RetentionPolicy
+	err := json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode retention policy")
+	}
+	return p, nil
+}
+
+// NewRetentionPolicies initializes the replicated set of retention policies and makes it ready for use
+func NewRetentionPolicies(r crdt.Replica) RetentionPolicies {
+	r = r.WithDefaults()
+	return RetentionPolicies{
+		replica: r,
+		set:     NewSetWithDecoder(r, DecodeRetentionPolicy),
+	}
+}
+
+// RetentionPolicies is a replicated set of retention policies by key prefix, so all the replicas
+// apply the same policies (see `Graph.ApplyRetention`) and ephemeral data cleans itself up everywhere.
+// Use `NewRetentionPolicies` in order to initialize it before use.
+// The policies are thread-safe and can be used from several go routines.
+type RetentionPolicies struct {
+	// replica is the key normalizer of the prefixes
+	replica crdt.Replica
+	// set stores the policies by prefix
+	set Set
+}
+
+// Set adds the policy or replaces the policy with the same prefix
+func (p RetentionPolicies) Set(policy RetentionPolicy) {
+	policy.Prefix = p.replica.NormalizeKey(policy.Prefix)
+	p.set.Add(policy)
+}
+
+// Remove removes the policy with the given prefix.
+// Returns an error with `ErrRetentionPolicyNotFound` cause if there is no such policy.
+func (p RetentionPolicies) Remove(prefix string) error {
+	prefix = p.replica.NormalizeKey(prefix)
+	if _, err := p.set.Lookup(prefix); err != nil {
+		return errors.Wrapf(ErrRetentionPolicyNotFound, "prefix %q", prefix)
+	}
+	p.set.Remove(prefix)
+	return nil
+}
+
+// List returns all the policies sorted by prefix
+func (p RetentionPolicies) List() []RetentionPolicy {
+	policies := []RetentionPolicy{}
+	for _, element := range p.set.List() {
+		policy, isPolicy := element.(RetentionPolicy)
+		if !isPolicy {
+			continue
+		}
+		policies = append(policies, policy)
+	}
+
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Prefix < policies[j].Prefix
+	})
+	return policies
+}
+
+// Lookup returns the policy applying to the vertex with the given key, the one with the longest matching prefix.
+// Returns an error with `ErrRetentionPolicyNotFound` cause if no policy applies to the key.
+func (p RetentionPolicies) Lookup(key string) (RetentionPolicy, error) {
+	policy, found := matchPolicy(p.List(), p.replica.NormalizeKey(key))
+	if !found {
+		return RetentionPolicy{}, errors.Wrapf(ErrRetentionPolicyNotFound, "key %q", key)
+	}
+	return policy, nil
+}
+
+// Merge merges the policies of another replica
+func (p RetentionPolicies) Merge(remote RetentionPolicies) {
+	p.set.Merge(remote.set)
+}
+
+// Marshal serializes the policies including the removed ones, which are needed for convergence
+func (p RetentionPolicies) Marshal() ([]byte, error) {
+	return p.set.Marshal()
+}
+
+// Unmarshal restores the policies serialized by `Marshal`
+func (p RetentionPolicies) Unmarshal(data []byte) error {
+	return p.set.Unmarshal(data)
+}
+
+// matchPolicy returns the policy with the longest prefix of the key
+func matchPolicy(policies []RetentionPolicy, key string) (matched RetentionPolicy, found bool) {
+	for _, policy := range policies {
+		if strings.HasPrefix(key, policy.Prefix) && (!found || len(policy.Prefix) > len(matched.Prefix)) {
+			matched, found = policy, true
+		}
+	}
+	return matched, found
+}
+
+// RetentionResult is the number of records changed by `Graph.ApplyRetention`
+type RetentionResult struct {
+	// Expired is the number of vertices and edges removed because of their age
+	Expired int
+	// Purged is the number of removed vertices and edges purged from the state
+	Purged int
+}
+
+// ApplyRetention removes the vertices and edges older than `MaxAge` of their policies
+// and purges the removals older than `TombstoneAge`, it's meant to be called periodically.
+//
+// An expired element is removed by this replica with the current timestamp like `RemoveVertex` does,
+// only if the addition that expired is still the latest one, so a newer write of the element
+// merged later wins over the removal and keeps it for another `MaxAge`.
+// Removing a vertex keeps its edges like `RemoveVertex` does, they expire according to their own age.
+//
+// Expired elements are reported to the subscribers and the replica observer as local removals,
+// purged ones are not reported since they are already removed.
+// Returns an error with `clock.ErrBackwards` cause if the replica clock rejects new operations.
+func (g Graph) ApplyRetention(policies RetentionPolicies) (result RetentionResult, err error) {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err = g.replica.CheckClock()
+	if err != nil {
+		return result, err
+	}
+
+	list := policies.List()
+	maxAge := func(key string) time.Duration {
+		policy, _ := matchPolicy(list, key)
+		return policy.MaxAge
+	}
+	tombstoneAge := func(key string) time.Duration {
+		policy, _ := matchPolicy(list, key)
+		return policy.TombstoneAge
+	}
+	now := g.replica.Clock.Now()
+
+	changes := g.trackChanges(false)
+	defer changes.publish()
+
+	result.Expired += g.vertices.expire(maxAge, now, g.replica.ID, changes.vertex)
+	result.Purged += g.vertices.purge(tombstoneAge, now)
+
+	for fromKey, adjacent := range g.edges {
+		fromKey := fromKey
+		age := maxAge(fromKey)
+		expired := adjacent.expire(func(string) time.Duration { return age }, now, g.replica.ID, func(toKey string) {
+			changes.edge(fromKey, toKey)
+		})
+		if expired != 0 {
+			g.indexAdjacent(fromKey, adjacent)
+		}
+		result.Expired += expired
+
+		ttl := tombstoneAge(fromKey)
+		result.Purged += adjacent.purge(func(string) time.Duration { return ttl }, now)
+		if adjacent.empty() {
+			delete(g.edges, fromKey)
+		}
+	}
+
+	g.replica.Metrics.Count("lww.retention.expired", int64(result.Expired))
+	g.replica.Metrics.Count("lww.retention.purged", int64(result.Purged))
+	return result, nil
+}
+
+// expire removes the live elements last written at least `maxAge(key)` ago, zero age keeps the element.
+// The removals are written at `now` on behalf of `replica`, only for the additions that are still
+// the latest ones when the set is locked for writing.
+// `before` is called with the key of every expired element before it's removed, the set is not locked at that time.
+// Returns the number of expired elements.
+func (s Set) expire(maxAge func(key string) time.Duration, now time.Time, replica string, before func(key string)) (expired int) {
+	expiring := make(map[string]addRecord)
+	s.mutex.RLock()
+	for key, record := range s.additions {
+		age := maxAge(key)
+		if age <= 0 || s.removed(key, record) {
+			continue
+		}
+		if record.Timestamp.Add(age).After(now) {
+			continue
+		}
+		expiring[key] = record
+	}
+	s.mutex.RUnlock()
+
+	for key := range expiring {
+		before(key)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, expiredRecord := range expiring {
+		// a newer addition could have been merged since the records were checked
+		record, added := s.additions[key]
+		if !added || !record.sameWrite(expiredRecord) || s.removed(key, record) {
+			continue
+		}
+		s.removals[key] = removeRecord{Timestamp: now, Replica: replica}
+		s.observeRemoval(key, crdt.SourceLocal)
+		expired++
+	}
+	return expired
+}
+
+// purge deletes the records of the elements removed at least `tombstoneAge(key)` ago,
+// zero age keeps the records. Returns the number of purged elements.
+func (s Set) purge(tombstoneAge func(key string) time.Duration, now time.Time) (purged int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, removal := range s.removals {
+		age := tombstoneAge(key)
+		if age <= 0 || removal.Timestamp.Add(age).After(now) {
+			continue
+		}
+		if record, added := s.additions[key]; added && !s.removed(key, record) {
+			continue
+		}
+
+		delete(s.additions, key)
+		delete(s.removals, key)
+		delete(s.siblings, key)
+		purged++
+	}
+	return purged
+}
+
+// empty returns `true` if the set has no records at all, including removals
+func (s Set) empty() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.additions) == 0 && len(s.removals) == 0
+}
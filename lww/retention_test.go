@@ -0,0 +1,170 @@
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetention(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	newReplica := func(id string, now *time.Time) crdt.Replica {
+		return crdt.Replica{
+			ID:    id,
+			Clock: clock.Func(func() time.Time { return *now }),
+		}
+	}
+
+	t.Run("replicates the policies", func(t *testing.T) {
+		now := base
+		a := NewRetentionPolicies(newReplica("A", &now))
+		b := NewRetentionPolicies(newReplica("B", &now))
+		a.Set(RetentionPolicy{Prefix: "session:", MaxAge: time.Hour})
+		a.Set(RetentionPolicy{Prefix: "session:admin:", MaxAge: time.Minute})
+
+		data, err := a.Marshal()
+		require.NoError(t, err)
+		restored := NewRetentionPolicies(newReplica("C", &now))
+		require.NoError(t, restored.Unmarshal(data))
+		b.Merge(restored)
+
+		policy, err := b.Lookup("session:admin:1")
+		require.NoError(t, err)
+		require.Equal(t, time.Minute, policy.MaxAge)
+		policy, err = b.Lookup("session:user:1")
+		require.NoError(t, err)
+		require.Equal(t, time.Hour, policy.MaxAge)
+		_, err = b.Lookup("user:1")
+		require.ErrorIs(t, err, ErrRetentionPolicyNotFound)
+
+		now = base.Add(time.Second)
+		require.NoError(t, b.Remove("session:admin:"))
+		require.Len(t, b.List(), 1)
+		require.ErrorIs(t, b.Remove("session:admin:"), ErrRetentionPolicyNotFound)
+	})
+
+	t.Run("removes expired vertices and edges on all replicas", func(t *testing.T) {
+		now := base
+		policies := NewRetentionPolicies(newReplica("A", &now))
+		policies.Set(RetentionPolicy{Prefix: "session:", MaxAge: time.Hour})
+
+		r := newReplica("A", &now)
+		r.Order = crdt.OrderSorted
+		a := NewGraph(r)
+		require.NoError(t, a.AddVertex(Vertex{Key: "user"}))
+		require.NoError(t, a.AddVertex(Vertex{Key: "session:1"}))
+		require.NoError(t, a.AddVertex(Vertex{Key: "session:2"}))
+		require.NoError(t, a.AddEdge("session:1", "user"))
+		require.NoError(t, a.AddEdge("user", "session:1"))
+		b := NewGraph(newReplica("B", &now))
+		b.Merge(a)
+
+		now = base.Add(30 * time.Minute)
+		require.NoError(t, a.UpdateVertex(Vertex{Key: "session:2", Value: "renewed"}))
+		b.Merge(a)
+
+		now = base.Add(time.Hour)
+		requireRetention(t, RetentionResult{Expired: 2}, a, policies)
+		requireRetention(t, RetentionResult{Expired: 2}, b, policies)
+		requireRetention(t, RetentionResult{}, a, policies)
+
+		list, err := a.List()
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: Vertex{Key: "session:2", Value: "renewed"}, AdjacentKeys: []string{}},
+			{Vertex: Vertex{Key: "user"}, AdjacentKeys: []string{"session:1"}},
+		}, list)
+
+		// the removals are written by each replica at the time it applied the policies
+		record := a.vertices.removals["session:1"]
+		require.Equal(t, removeRecord{Timestamp: now, Replica: "A"}, record)
+		replicateGraphs(a, b)
+		equal, err := a.StateEquals(b)
+		require.NoError(t, err)
+		require.True(t, equal)
+	})
+
+	t.Run("a newer write merged after the expiry brings the element back", func(t *testing.T) {
+		now := base
+		policies := NewRetentionPolicies(newReplica("A", &now))
+		policies.Set(RetentionPolicy{Prefix: "session:", MaxAge: time.Hour})
+
+		a := NewGraph(newReplica("A", &now))
+		require.NoError(t, a.AddVertex(Vertex{Key: "session:1", Value: "initial"}))
+		b := NewGraph(newReplica("B", &now))
+		b.Merge(a)
+
+		now = base.Add(time.Hour)
+		requireRetention(t, RetentionResult{Expired: 1}, a, policies)
+		_, err := a.Lookup("session:1")
+		require.ErrorIs(t, err, ErrVertexNotFound)
+
+		now = base.Add(time.Hour + time.Second)
+		require.NoError(t, b.UpdateVertex(Vertex{Key: "session:1", Value: "renewed"}))
+		a.Merge(b)
+		b.Merge(a)
+
+		for _, g := range []Graph{a, b} {
+			v, err := g.Lookup("session:1")
+			require.NoError(t, err)
+			require.Equal(t, "renewed", v.Value)
+		}
+		requireRetention(t, RetentionResult{}, a, policies)
+	})
+
+	t.Run("returns ErrBackwards when the clock went backwards", func(t *testing.T) {
+		now := base
+		policies := NewRetentionPolicies(newReplica("A", &now))
+		policies.Set(RetentionPolicy{Prefix: "session:", MaxAge: time.Hour})
+
+		g := NewGraph(crdt.Replica{
+			ID:    "A",
+			Clock: clock.NewMonotonic(clock.Func(func() time.Time { return now }), clock.MonotonicReject),
+		})
+		require.NoError(t, g.AddVertex(Vertex{Key: "session:1"}))
+
+		now = base.Add(-time.Hour)
+		_, err := g.ApplyRetention(policies)
+		require.ErrorIs(t, err, clock.ErrBackwards)
+		_, err = g.Lookup("session:1")
+		require.NoError(t, err)
+	})
+
+	t.Run("purges old tombstones", func(t *testing.T) {
+		now := base
+		policies := NewRetentionPolicies(newReplica("A", &now))
+		policies.Set(RetentionPolicy{Prefix: "tmp:", TombstoneAge: time.Hour})
+
+		g := NewGraph(newReplica("A", &now))
+		require.NoError(t, g.AddVertex(Vertex{Key: "tmp:1"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "tmp:2"}))
+		require.NoError(t, g.AddVertex(Vertex{Key: "kept"}))
+		require.NoError(t, g.AddEdge("tmp:1", "kept"))
+		now = base.Add(time.Second)
+		require.NoError(t, g.RemoveEdge("tmp:1", "kept"))
+		require.NoError(t, g.RemoveVertex("tmp:1"))
+		require.NoError(t, g.RemoveVertex("kept"))
+
+		now = base.Add(time.Minute)
+		requireRetention(t, RetentionResult{}, g, policies)
+
+		now = base.Add(time.Hour + time.Second)
+		requireRetention(t, RetentionResult{Purged: 2}, g, policies)
+		require.Equal(t, 2, len(g.vertices.additions))
+		require.NotContains(t, g.edges, "tmp:1")
+
+		_, err := g.Lookup("tmp:2")
+		require.NoError(t, err)
+	})
+}
+
+// requireRetention asserts the result of applying the retention policies to the graph
+func requireRetention(t *testing.T, expected RetentionResult, g Graph, policies RetentionPolicies) {
+	t.Helper()
+	result, err := g.ApplyRetention(policies)
+	require.NoError(t, err)
+	require.Equal(t, expected, result)
+}
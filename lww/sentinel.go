@@ -0,0 +1,56 @@
+package lww
+
+import (
+	"github.com/rdner/crdt/internal/sentinel"
+)
+
+// checkUsage panics in the sentinel mode (the `crdtdebug` build tag) if the set is misused
+func (s Set) checkUsage() {
+	if !sentinel.Enabled {
+		return
+	}
+
+	sentinel.Assert(s.mutex != nil && s.additions != nil && s.removals != nil,
+		"lww.Set is not initialized, use lww.NewSet or lww.NewSetWithDecoder")
+	sentinel.Assert(!sentinel.IsNil(s.replica.Clock),
+		"lww.Set of replica %q has a nil clock, set Replica.Clock or use crdt.NewReplica", s.replica.ID)
+	sentinel.CheckOwner(s.additions, s.mutex, "lww.Set")
+}
+
+// checkMerge panics in the sentinel mode (the `crdtdebug` build tag) if the set or the `remote` are misused
+func (s Set) checkMerge(remote Set) {
+	if !sentinel.Enabled {
+		return
+	}
+
+	s.checkUsage()
+	remote.checkUsage()
+	sentinel.Assert(s.mutex != remote.mutex,
+		"merging lww.Set of replica %q into itself, merge a replica of another process or a deserialized snapshot", s.replica.ID)
+}
+
+// checkUsage panics in the sentinel mode (the `crdtdebug` build tag) if the graph is misused
+func (g Graph) checkUsage() {
+	if !sentinel.Enabled {
+		return
+	}
+
+	sentinel.Assert(g.mutex != nil && g.edges != nil && g.weights != nil,
+		"lww.Graph is not initialized, use lww.NewGraph")
+	sentinel.Assert(!sentinel.IsNil(g.replica.Clock),
+		"lww.Graph of replica %q has a nil clock, set Replica.Clock or use crdt.NewReplica", g.replica.ID)
+	sentinel.CheckOwner(g.edges, g.mutex, "lww.Graph")
+	g.vertices.checkUsage()
+}
+
+// checkMerge panics in the sentinel mode (the `crdtdebug` build tag) if the graph or the `remote` are misused
+func (g Graph) checkMerge(remote Graph) {
+	if !sentinel.Enabled {
+		return
+	}
+
+	g.checkUsage()
+	remote.checkUsage()
+	sentinel.Assert(g.mutex != remote.mutex,
+		"merging lww.Graph of replica %q into itself, merge a replica of another process or a deserialized snapshot", g.replica.ID)
+}
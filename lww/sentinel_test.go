@@ -0,0 +1,53 @@
+//go:build crdtdebug
+// +build crdtdebug
+
+package lww
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSentinel(t *testing.T) {
+	t.Run("panics when merging a set into itself", func(t *testing.T) {
+		s := NewSet(testReplica)
+		require.PanicsWithValue(t,
+			`crdt: misuse detected: merging lww.Set of replica "test" into itself, merge a replica of another process or a deserialized snapshot`,
+			func() { s.Merge(s) },
+		)
+	})
+
+	t.Run("panics when merging a graph into itself", func(t *testing.T) {
+		g := NewGraph(testReplica)
+		require.Panics(t, func() { g.Merge(g) })
+	})
+
+	t.Run("panics when using a set that was not initialized", func(t *testing.T) {
+		require.PanicsWithValue(t,
+			"crdt: misuse detected: lww.Set is not initialized, use lww.NewSet or lww.NewSetWithDecoder",
+			func() { Set{}.Add(IDElement("element")) },
+		)
+		require.Panics(t, func() { _, _ = Graph{}.List() })
+	})
+
+	t.Run("panics when the clock is nil", func(t *testing.T) {
+		r := crdt.NewReplica("nil-clock")
+		r.Clock = clock.Func(nil)
+		s := NewSet(r)
+		require.Panics(t, func() { s.Add(IDElement("element")) })
+	})
+
+	t.Run("does not panic on correct usage", func(t *testing.T) {
+		A := NewGraph(testReplica)
+		B := NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, A.AddVertex(Vertex{Key: "vertex", Value: "value"}))
+		require.NotPanics(t, func() { B.Merge(A) })
+
+		s := NewSet(crdt.Replica{ID: "custom", Clock: clock.Func(time.Now)})
+		require.NotPanics(t, func() { s.Add(IDElement("element")) })
+	})
+}
@@ -0,0 +1,217 @@
+package lww
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNegativeWeight occurs when a weighted search meets an edge with a negative weight
+	ErrNegativeWeight = errors.New("negative edge weight")
+)
+
+// FindShortestPath returns a path with the fewest edges between a vertex with the key `fromKey`
+// and a vertex with the key `toKey` using breadth-first search.
+//
+// The result is deterministic: when several shortest paths exist,
+// the one visiting lexicographically smaller keys first is returned.
+// The path of a vertex to itself is the vertex alone.
+//
+// Returns an error with `ErrVertexNotFound` cause if one of the vertices does not exist.
+// Returns `nil` and `ErrPathNotFound` when the vertices are not connected.
+func (g Graph) FindShortestPath(fromKey, toKey string) (path []Vertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	start, err := g.Lookup(fromKey)
+	if err != nil {
+		return nil, err
+	}
+	end, err := g.Lookup(toKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// maps a visited vertex key to the vertex it was reached from
+	previous := map[string]Vertex{start.Key: start}
+	queue := []Vertex{start}
+
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if current.Key == end.Key {
+			return tracePath(previous, start, end), nil
+		}
+
+		adjacent, err := g.sortedAdjacent(current.Key)
+		if err != nil {
+			return nil, err
+		}
+		for _, vertex := range adjacent {
+			if _, visited := previous[vertex.Key]; visited {
+				continue
+			}
+			previous[vertex.Key] = current
+			queue = append(queue, vertex)
+		}
+	}
+
+	return nil, ErrPathNotFound
+}
+
+// FindWeightedShortestPath returns a path with the smallest total edge weight
+// between a vertex with the key `fromKey` and a vertex with the key `toKey` using Dijkstra's algorithm,
+// along with the total weight of the path. The weight of an edge is its total weight as `EdgeWeight` returns:
+// the sum of its `Edge.Weight` (see `AddWeightedEdge`) and its counter weight (see `AddEdgeWeight`).
+//
+// The result is deterministic: when several paths have the same total weight,
+// the path reaching vertices with lexicographically smaller keys first is returned.
+// The path of a vertex to itself is the vertex alone with zero weight.
+//
+// Returns an error with `ErrVertexNotFound` cause if one of the vertices does not exist.
+// Returns an error with `ErrNegativeWeight` cause if the search meets an edge with a negative weight.
+// Returns `nil` and `ErrPathNotFound` when the vertices are not connected.
+func (g Graph) FindWeightedShortestPath(fromKey, toKey string) (path []Vertex, weight int64, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	start, err := g.Lookup(fromKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	end, err := g.Lookup(toKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	distances := map[string]int64{start.Key: 0}
+	previous := map[string]Vertex{start.Key: start}
+	done := make(map[string]nothing)
+	queue := &distanceQueue{{vertex: start}}
+
+	for queue.Len() != 0 {
+		current, _ := heap.Pop(queue).(distanceItem)
+		if _, isDone := done[current.vertex.Key]; isDone {
+			// an outdated item of a vertex that was reached with a smaller distance
+			continue
+		}
+		done[current.vertex.Key] = nothing{}
+
+		if current.vertex.Key == end.Key {
+			return tracePath(previous, start, end), current.distance, nil
+		}
+
+		adjacent, err := g.sortedAdjacent(current.vertex.Key)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, vertex := range adjacent {
+			if _, isDone := done[vertex.Key]; isDone {
+				continue
+			}
+
+			edgeWeight := g.edgeWeight(current.vertex.Key, vertex.Key)
+			if edgeWeight < 0 {
+				return nil, 0, errors.Wrapf(ErrNegativeWeight, "edge [from = %q, to = %q] has weight %d",
+					current.vertex.Key, vertex.Key, edgeWeight)
+			}
+
+			distance := current.distance + edgeWeight
+			known, isKnown := distances[vertex.Key]
+			if isKnown && known <= distance {
+				continue
+			}
+			distances[vertex.Key] = distance
+			previous[vertex.Key] = current.vertex
+			heap.Push(queue, distanceItem{vertex: vertex, distance: distance})
+		}
+	}
+
+	return nil, 0, ErrPathNotFound
+}
+
+// sortedAdjacent returns the existing adjacent vertices of the vertex with the given key sorted by key,
+// must be called under the graph lock
+func (g Graph) sortedAdjacent(key string) ([]Vertex, error) {
+	elements := g.listAdjacent(key)
+	adjacent := make([]Vertex, 0, len(elements))
+	for _, element := range elements {
+		// some edges exist even for removed vertices
+		vertex, err := g.Lookup(element.GetKey())
+		if errors.Is(err, ErrVertexNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		adjacent = append(adjacent, vertex)
+	}
+
+	sort.Slice(adjacent, func(i, j int) bool {
+		return adjacent[i].Key < adjacent[j].Key
+	})
+	return adjacent, nil
+}
+
+// tracePath returns the path from `start` to `end` following the map of previous vertices backwards
+func tracePath(previous map[string]Vertex, start, end Vertex) []Vertex {
+	path := []Vertex{end}
+	for current := end; current.Key != start.Key; {
+		current = previous[current.Key]
+		path = append(path, current)
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// distanceItem is a vertex in the priority queue of Dijkstra's algorithm
+type distanceItem struct {
+	// vertex is the reached vertex
+	vertex Vertex
+	// distance is the total weight of the path to the vertex
+	distance int64
+}
+
+// distanceQueue is a priority queue of vertices ordered by the distance and then by the key.
+// It implements `heap.Interface`.
+type distanceQueue []distanceItem
+
+// Len implements the `sort.Interface` interface
+func (q distanceQueue) Len() int {
+	return len(q)
+}
+
+// Less implements the `sort.Interface` interface
+func (q distanceQueue) Less(i, j int) bool {
+	if q[i].distance != q[j].distance {
+		return q[i].distance < q[j].distance
+	}
+	return q[i].vertex.Key < q[j].vertex.Key
+}
+
+// Swap implements the `sort.Interface` interface
+func (q distanceQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+// Push implements the `heap.Interface` interface
+func (q *distanceQueue) Push(x interface{}) {
+	item, _ := x.(distanceItem)
+	*q = append(*q, item)
+}
+
+// Pop implements the `heap.Interface` interface
+func (q *distanceQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,114 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortestPath(t *testing.T) {
+	v1 := Vertex{Key: "vertex1", Value: "value1"}
+	v2 := Vertex{Key: "vertex2", Value: "value2"}
+	v3 := Vertex{Key: "vertex3", Value: "value3"}
+	v4 := Vertex{Key: "vertex4", Value: "value4"}
+	v5 := Vertex{Key: "vertex5", Value: "value5"}
+	v6 := Vertex{Key: "vertex6", Value: "value6"}
+
+	// v1-->v2-->v3-->v4
+	//  |         ^
+	//  +-->v5----+
+	//  |
+	//  +-->v6 (removed) -->v4
+	newGraph := func(t *testing.T) Graph {
+		g := NewGraph(testReplica)
+		for _, v := range []Vertex{v1, v2, v3, v4, v5, v6} {
+			require.NoError(t, g.AddVertex(v))
+		}
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		require.NoError(t, g.AddEdge(v2.Key, v3.Key))
+		require.NoError(t, g.AddEdge(v3.Key, v4.Key))
+		require.NoError(t, g.AddEdge(v1.Key, v5.Key))
+		require.NoError(t, g.AddEdge(v5.Key, v3.Key))
+		require.NoError(t, g.AddEdge(v1.Key, v6.Key))
+		require.NoError(t, g.AddEdge(v6.Key, v4.Key))
+		require.NoError(t, g.RemoveVertex(v6.Key))
+		return g
+	}
+
+	t.Run("FindShortestPath", func(t *testing.T) {
+		g := newGraph(t)
+
+		t.Run("returns the path with the fewest edges deterministically", func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				path, err := g.FindShortestPath(v1.Key, v4.Key)
+				require.NoError(t, err)
+				require.Equal(t, []Vertex{v1, v2, v3, v4}, path)
+			}
+		})
+
+		t.Run("returns the vertex alone for the path to itself", func(t *testing.T) {
+			path, err := g.FindShortestPath(v1.Key, v1.Key)
+			require.NoError(t, err)
+			require.Equal(t, []Vertex{v1}, path)
+		})
+
+		t.Run("returns an error when vertices are not connected", func(t *testing.T) {
+			_, err := g.FindShortestPath(v4.Key, v1.Key)
+			require.ErrorIs(t, err, ErrPathNotFound)
+		})
+
+		t.Run("returns an error for non-existing vertices", func(t *testing.T) {
+			_, err := g.FindShortestPath(v1.Key, v6.Key)
+			require.ErrorIs(t, err, ErrVertexNotFound)
+			_, err = g.FindShortestPath("non-existing", v1.Key)
+			require.ErrorIs(t, err, ErrVertexNotFound)
+		})
+	})
+
+	t.Run("FindWeightedShortestPath", func(t *testing.T) {
+		t.Run("returns the path with the smallest total weight", func(t *testing.T) {
+			g := newGraph(t)
+			require.NoError(t, g.AddEdgeWeight(v1.Key, v2.Key, 5))
+			require.NoError(t, g.AddEdgeWeight(v2.Key, v3.Key, 1))
+			require.NoError(t, g.AddEdgeWeight(v1.Key, v5.Key, 2))
+			require.NoError(t, g.AddEdgeWeight(v5.Key, v3.Key, 2))
+			require.NoError(t, g.AddEdgeWeight(v3.Key, v4.Key, 1))
+
+			path, weight, err := g.FindWeightedShortestPath(v1.Key, v4.Key)
+			require.NoError(t, err)
+			require.Equal(t, []Vertex{v1, v5, v3, v4}, path)
+			require.Equal(t, int64(5), weight)
+		})
+
+		t.Run("breaks ties deterministically", func(t *testing.T) {
+			g := newGraph(t)
+
+			for i := 0; i < 10; i++ {
+				path, weight, err := g.FindWeightedShortestPath(v1.Key, v4.Key)
+				require.NoError(t, err)
+				require.Equal(t, []Vertex{v1, v2, v3, v4}, path)
+				require.Equal(t, int64(0), weight)
+			}
+		})
+
+		t.Run("returns an error for negative weights", func(t *testing.T) {
+			g := newGraph(t)
+			require.NoError(t, g.AddEdgeWeight(v1.Key, v2.Key, -1))
+
+			_, _, err := g.FindWeightedShortestPath(v1.Key, v4.Key)
+			require.ErrorIs(t, err, ErrNegativeWeight)
+		})
+
+		t.Run("returns an error when vertices are not connected", func(t *testing.T) {
+			g := newGraph(t)
+
+			_, _, err := g.FindWeightedShortestPath(v4.Key, v1.Key)
+			require.ErrorIs(t, err, ErrPathNotFound)
+
+			path, weight, err := g.FindWeightedShortestPath(v4.Key, v4.Key)
+			require.NoError(t, err)
+			require.Equal(t, []Vertex{v4}, path)
+			require.Equal(t, int64(0), weight)
+		})
+	})
+}
@@ -0,0 +1,73 @@
+package lww
+
+// SetSize is the size of the set state
+type SetSize struct {
+	// Elements is the number of elements in the set
+	Elements int
+	// Tombstones is the number of removal records the set keeps in order to converge with other replicas
+	Tombstones int
+}
+
+// GraphSize is the size of the graph state
+type GraphSize struct {
+	// Vertices is the number of vertices in the graph
+	Vertices int
+	// Edges is the number of edges between the vertices of the graph, hanging edges are not counted
+	Edges int
+	// Tombstones is the number of removal records of vertices and edges the graph keeps
+	// in order to converge with other replicas
+	Tombstones int
+}
+
+// Size returns the number of elements and tombstones of the set, e.g. for monitoring
+func (s Set) Size() SetSize {
+	s.checkUsage()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.size(nil)
+}
+
+// size counts the elements and the tombstones of the set, only the elements `count` returns `true` for
+// are counted if it's not `nil`. Must be called under the lock.
+func (s Set) size(count func(key string) bool) SetSize {
+	size := SetSize{Tombstones: len(s.removals)}
+	for key, record := range s.additions {
+		if s.removed(key, record) {
+			continue
+		}
+		if count != nil && !count(key) {
+			continue
+		}
+		size.Elements++
+	}
+	return size
+}
+
+// Size returns the number of vertices, edges and tombstones of the graph, e.g. for monitoring
+func (g Graph) Size() GraphSize {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	vertices := g.vertices.Size()
+	size := GraphSize{
+		Vertices:   vertices.Elements,
+		Tombstones: vertices.Tombstones,
+	}
+	exists := func(key string) bool {
+		_, err := g.vertices.Lookup(key)
+		return err == nil
+	}
+	for fromKey, adjacent := range g.edges {
+		adjacent.mutex.RLock()
+		edges := adjacent.size(exists)
+		adjacent.mutex.RUnlock()
+
+		size.Tombstones += edges.Tombstones
+		if exists(fromKey) {
+			size.Edges += edges.Elements
+		}
+	}
+	return size
+}
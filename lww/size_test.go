@@ -0,0 +1,36 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSize(t *testing.T) {
+	t.Run("counts elements and tombstones of the set", func(t *testing.T) {
+		s := NewSet(crdt.NewReplica("A"))
+		require.Equal(t, SetSize{}, s.Size())
+
+		s.Add(IDElement("a"))
+		s.Add(IDElement("b"))
+		s.Remove("b")
+		s.Remove("c")
+		require.Equal(t, SetSize{Elements: 1, Tombstones: 2}, s.Size())
+	})
+
+	t.Run("counts vertices, edges and tombstones of the graph", func(t *testing.T) {
+		g := NewGraph(crdt.NewReplica("A"))
+		for _, key := range []string{"v1", "v2", "v3"} {
+			require.NoError(t, g.AddVertex(Vertex{Key: key}))
+		}
+		require.NoError(t, g.AddEdge("v1", "v2"))
+		require.NoError(t, g.AddEdge("v1", "v3"))
+		require.NoError(t, g.AddEdge("v2", "v3"))
+		require.NoError(t, g.RemoveEdge("v2", "v3"))
+		require.Equal(t, GraphSize{Vertices: 3, Edges: 2, Tombstones: 1}, g.Size())
+
+		require.NoError(t, g.RemoveVertex("v3"))
+		require.Equal(t, GraphSize{Vertices: 2, Edges: 1, Tombstones: 2}, g.Size(), "hanging edges are not counted")
+	})
+}
@@ -0,0 +1,118 @@
+package lww
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
+)
+
+// Snapshot writes a consistent point-in-time state of the graph to `w` in the format of `Marshal`.
+// The graph is locked only while its state is copied, so concurrent writers continue
+// while the snapshot is being encoded and written, e.g. to a backup file or a new replica.
+func (g Graph) Snapshot(w io.Writer) error {
+	g.checkUsage()
+	state, err := g.clone().state()
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(w).Encode(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to write graph snapshot")
+	}
+
+	return nil
+}
+
+// RestoreGraph reads a snapshot written by `Graph.Snapshot` (or the state produced by `Marshal`)
+// and returns a new graph of the given replica with this state.
+// The restore is atomic: the graph is returned only if the whole snapshot is read and decoded.
+func RestoreGraph(replica crdt.Replica, r io.Reader) (Graph, error) {
+	var state graphState
+	err := json.NewDecoder(r).Decode(&state)
+	if err != nil {
+		return Graph{}, errors.Wrap(err, "failed to read graph snapshot")
+	}
+
+	g := NewGraph(replica)
+	err = g.restoreState(state)
+	if err != nil {
+		return Graph{}, err
+	}
+
+	return g, nil
+}
+
+// clone returns a copy of the graph which does not share any mutable state with the graph
+func (g Graph) clone() Graph {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	c := Graph{
+		mutex:      &sync.RWMutex{},
+		replica:    g.replica,
+		vertices:   g.vertices.clone(),
+		edges:      make(map[string]Set, len(g.edges)),
+		weights:    make(map[string]map[string]counter.PN, len(g.weights)),
+		incoming:   make(map[string]map[string]nothing, len(g.incoming)),
+		unindexed:  new(bool),
+		quarantine: make(map[string]QuarantinedVertex),
+		feed:       crdt.NewFeed(g.replica),
+	}
+	*c.unindexed = *g.unindexed
+
+	for key, adjacent := range g.edges {
+		c.edges[key] = adjacent.clone()
+	}
+
+	for toKey, fromKeys := range g.incoming {
+		c.incoming[toKey] = make(map[string]nothing, len(fromKeys))
+		for fromKey := range fromKeys {
+			c.incoming[toKey][fromKey] = nothing{}
+		}
+	}
+
+	for fromKey, weights := range g.weights {
+		c.weights[fromKey] = make(map[string]counter.PN, len(weights))
+		for toKey, weight := range weights {
+			copied := counter.NewPN(g.replica)
+			copied.Merge(weight)
+			c.weights[fromKey][toKey] = copied
+		}
+	}
+
+	return c
+}
+
+// clone returns a copy of the set which does not share any mutable state with the set,
+// the elements are shared since they are never modified in place.
+func (s Set) clone() Set {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	c := Set{
+		mutex:     &sync.RWMutex{},
+		replica:   s.replica,
+		decode:    s.decode,
+		mutation:  s.mutation,
+		additions: make(map[string]addRecord, len(s.additions)),
+		removals:  make(map[string]removeRecord, len(s.removals)),
+		siblings:  make(map[string][]addRecord, len(s.siblings)),
+	}
+
+	for key, record := range s.additions {
+		c.additions[key] = record
+	}
+	for key, record := range s.removals {
+		c.removals[key] = record
+	}
+	for key, siblings := range s.siblings {
+		c.siblings[key] = append([]addRecord(nil), siblings...)
+	}
+
+	return c
+}
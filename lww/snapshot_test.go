@@ -0,0 +1,95 @@
+package lww
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	v1 := Vertex{Key: "vertex1", Value: "value1"}
+	v2 := Vertex{Key: "vertex2", Value: "value2"}
+	v3 := Vertex{Key: "vertex3", Value: "value3"}
+
+	g := NewGraph(testReplica)
+	for _, v := range []Vertex{v1, v2, v3} {
+		require.NoError(t, g.AddVertex(v))
+	}
+	require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+	require.NoError(t, g.AddEdgeWeight(v1.Key, v2.Key, 3))
+	require.NoError(t, g.RemoveVertex(v3.Key))
+
+	t.Run("restores the same state", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, g.Snapshot(&buf))
+
+		restored, err := RestoreGraph(testReplica, &buf)
+		require.NoError(t, err)
+
+		expected, err := g.Marshal()
+		require.NoError(t, err)
+		actual, err := restored.Marshal()
+		require.NoError(t, err)
+		require.JSONEq(t, string(expected), string(actual))
+
+		weight, err := restored.EdgeWeight(v1.Key, v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), weight)
+	})
+
+	t.Run("restores the state produced by Marshal", func(t *testing.T) {
+		data, err := g.Marshal()
+		require.NoError(t, err)
+
+		restored, err := RestoreGraph(testReplica, bytes.NewReader(data))
+		require.NoError(t, err)
+		_, err = restored.Lookup(v1.Key)
+		require.NoError(t, err)
+	})
+
+	t.Run("returns an error for a truncated snapshot", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, g.Snapshot(&buf))
+
+		_, err := RestoreGraph(testReplica, strings.NewReader(buf.String()[:buf.Len()/2]))
+		require.Error(t, err)
+	})
+
+	t.Run("produces a consistent state while writers continue", func(t *testing.T) {
+		source := NewGraph(testReplica)
+		require.NoError(t, source.AddVertex(v1))
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				v := Vertex{Key: fmt.Sprintf("vertex-%d", i)}
+				_ = source.AddVertex(v)
+				_ = source.AddEdge(v1.Key, v.Key)
+			}
+		}()
+
+		for i := 0; i < 10; i++ {
+			var buf bytes.Buffer
+			require.NoError(t, source.Snapshot(&buf))
+
+			restored, err := RestoreGraph(testReplica, &buf)
+			require.NoError(t, err)
+
+			connected, err := restored.FindConnected(v1.Key)
+			require.NoError(t, err)
+			list, err := restored.List()
+			require.NoError(t, err)
+			// every vertex except `v1` is added before its edge, the snapshot never contains
+			// an edge without the vertex and contains at most one vertex without the edge
+			require.LessOrEqual(t, len(list)-1-len(connected), 1)
+		}
+
+		wg.Wait()
+	})
+}
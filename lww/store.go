@@ -0,0 +1,291 @@
+package lww
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+var (
+	// ErrReferenceNotFound occurs when a cross-graph reference does not exist in the store
+	ErrReferenceNotFound = errors.New("reference not found")
+)
+
+// QualifiedKeySeparator separates the graph name from the vertex key in the string form of a `QualifiedKey`
+const QualifiedKeySeparator = "/"
+
+// QualifiedKey identifies a vertex of a named graph in a store
+type QualifiedKey struct {
+	// Graph is the name of the graph in the store
+	Graph string
+	// Key is the key of the vertex in the graph
+	Key string
+}
+
+// ParseQualifiedKey parses the `<graph>/<key>` form of a qualified key, the graph name must not contain `/`
+func ParseQualifiedKey(s string) (QualifiedKey, error) {
+	i := strings.Index(s, QualifiedKeySeparator)
+	if i <= 0 {
+		return QualifiedKey{}, errors.Errorf("%q is not a qualified key, expected <graph>%s<key>", s, QualifiedKeySeparator)
+	}
+	return QualifiedKey{Graph: s[:i], Key: s[i+len(QualifiedKeySeparator):]}, nil
+}
+
+// String returns the `<graph>/<key>` form of the qualified key
+func (k QualifiedKey) String() string {
+	return k.Graph + QualifiedKeySeparator + k.Key
+}
+
+// QualifiedVertex is a vertex of a named graph in a store
+type QualifiedVertex struct {
+	Vertex
+	// Graph is the name of the graph the vertex belongs to
+	Graph string
+}
+
+// Reference is a directional edge from a vertex of one graph in a store to a vertex of another graph
+type Reference struct {
+	From QualifiedKey
+	To   QualifiedKey
+}
+
+// GetKey implements the `Element` interface
+func (r Reference) GetKey() string {
+	return strings.Join([]string{r.From.Graph, r.From.Key, r.To.Graph, r.To.Key}, "\x00")
+}
+
+// NewStore initializes an empty store of named graphs using the replica for all of them
+func NewStore(r crdt.Replica) Store {
+	r = r.WithDefaults()
+	// the reference keys are composite, the vertex keys are normalized before they're joined
+	referenceReplica := r
+	referenceReplica.KeyNormalizer = nil
+	referenceReplica.Validator = nil
+	referenceReplica.MultiValue = false
+
+	return Store{
+		replica:    r,
+		mutex:      &sync.RWMutex{},
+		graphs:     make(map[string]Graph),
+		references: NewSet(referenceReplica),
+		permitted:  make(map[string]map[string]nothing),
+	}
+}
+
+// Store is a set of named graphs which can reference each other, so a large domain can be split
+// into several graphs (e.g. `users` and `documents`) without losing the ability to query across them.
+//
+// References between graphs are replicated as a last-writer-wins set next to the graphs,
+// which traversals are allowed to follow them is a local setting (see `Permit`).
+// Use `NewStore` in order to initialize it before use. The store is thread-safe.
+type Store struct {
+	replica crdt.Replica
+	// mutex is used for the thread-safety of the graphs map and the permissions
+	mutex *sync.RWMutex
+	// graphs maps the graph name to the graph
+	graphs map[string]Graph
+	// references is the set of `Reference` elements
+	references Set
+	// permitted maps a graph name to the names of the graphs traversals can continue in
+	permitted map[string]map[string]nothing
+}
+
+// Graph returns the graph with the given name, an empty graph is created if it does not exist yet
+func (s Store) Graph(name string) Graph {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	g, exists := s.graphs[name]
+	if !exists {
+		g = NewGraph(s.replica)
+		s.graphs[name] = g
+	}
+	return g
+}
+
+// Names returns the sorted names of all the graphs in the store
+func (s Store) Names() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	names := make([]string, 0, len(s.graphs))
+	for name := range s.graphs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Permit lets `FindConnected` follow references from the graph `from` to the graph `to`.
+// References within the same graph are not followed, use edges for them.
+func (s Store) Permit(from, to string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.permitted[from] == nil {
+		s.permitted[from] = make(map[string]nothing)
+	}
+	s.permitted[from][to] = nothing{}
+}
+
+// AddReference adds a directional reference from a vertex of one graph to a vertex of another graph.
+// Returns an error with `ErrVertexNotFound` cause if one of the vertices does not exist.
+func (s Store) AddReference(from, to QualifiedKey) error {
+	ref, err := s.lookupReference(from, to)
+	if err != nil {
+		return err
+	}
+	s.references.Add(ref)
+	return nil
+}
+
+// RemoveReference removes the reference from a vertex of one graph to a vertex of another graph.
+// Returns an error with `ErrReferenceNotFound` cause if the reference does not exist.
+func (s Store) RemoveReference(from, to QualifiedKey) error {
+	ref := s.normalizeReference(from, to)
+	if _, err := s.references.Lookup(ref.GetKey()); err != nil {
+		return errors.Wrapf(ErrReferenceNotFound, "reference [from = %q, to = %q]", from, to)
+	}
+	s.references.Remove(ref.GetKey())
+	return nil
+}
+
+// References returns all the references of the vertex to the vertices of other graphs,
+// including the references to removed vertices
+func (s Store) References(from QualifiedKey) []QualifiedKey {
+	from.Key = s.replica.NormalizeKey(from.Key)
+	return s.referenceIndex()[from]
+}
+
+// FindConnected returns all the vertices reachable from the start vertex following the edges
+// within the graphs and the references between graphs permitted by `Permit`.
+// The start vertex is not included. Removed vertices are skipped.
+// Returns an error with `ErrVertexNotFound` cause if the start vertex does not exist.
+func (s Store) FindConnected(start QualifiedKey) ([]QualifiedVertex, error) {
+	start.Key = s.replica.NormalizeKey(start.Key)
+	if _, err := s.lookup(start); err != nil {
+		return nil, err
+	}
+
+	index := s.referenceIndex()
+	s.mutex.RLock()
+	permitted := make(map[string]map[string]nothing, len(s.permitted))
+	for from, targets := range s.permitted {
+		permitted[from] = targets
+	}
+	s.mutex.RUnlock()
+
+	connected := []QualifiedVertex{}
+	visited := map[QualifiedKey]nothing{start: {}}
+	queue := []QualifiedKey{start}
+
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		// the vertices of the same graph first, then the references of all of them
+		found, err := s.Graph(current.Graph).FindConnected(current.Key)
+		if err != nil {
+			return nil, err
+		}
+		sources := []QualifiedKey{current}
+		for _, v := range found {
+			qk := QualifiedKey{Graph: current.Graph, Key: v.Key}
+			if _, isVisited := visited[qk]; isVisited {
+				continue
+			}
+			visited[qk] = nothing{}
+			connected = append(connected, QualifiedVertex{Vertex: v, Graph: current.Graph})
+			sources = append(sources, qk)
+		}
+
+		for _, source := range sources {
+			for _, target := range index[source] {
+				if _, isPermitted := permitted[source.Graph][target.Graph]; !isPermitted {
+					continue
+				}
+				if _, isVisited := visited[target]; isVisited {
+					continue
+				}
+				v, err := s.lookup(target)
+				if errors.Is(err, ErrVertexNotFound) {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				visited[target] = nothing{}
+				connected = append(connected, QualifiedVertex{Vertex: v, Graph: target.Graph})
+				queue = append(queue, target)
+			}
+		}
+	}
+
+	return connected, nil
+}
+
+// Merge merges the graphs of the `remote` store into the graphs with the same names
+// and the references of both stores. The permissions are not replicated.
+func (s Store) Merge(remote Store) {
+	remote.mutex.RLock()
+	graphs := make(map[string]Graph, len(remote.graphs))
+	for name, g := range remote.graphs {
+		graphs[name] = g
+	}
+	remote.mutex.RUnlock()
+
+	for name, g := range graphs {
+		s.Graph(name).Merge(g)
+	}
+	s.references.Merge(remote.references)
+}
+
+// lookup returns the vertex of the qualified key if the graph exists
+func (s Store) lookup(k QualifiedKey) (Vertex, error) {
+	s.mutex.RLock()
+	g, exists := s.graphs[k.Graph]
+	s.mutex.RUnlock()
+	if !exists {
+		return Vertex{}, errors.Wrapf(ErrVertexNotFound, "vertex [key = %q]", k)
+	}
+	return g.Lookup(k.Key)
+}
+
+// lookupReference returns the normalized reference if both its vertices exist
+func (s Store) lookupReference(from, to QualifiedKey) (Reference, error) {
+	if _, err := s.lookup(from); err != nil {
+		return Reference{}, err
+	}
+	if _, err := s.lookup(to); err != nil {
+		return Reference{}, err
+	}
+	return s.normalizeReference(from, to), nil
+}
+
+// normalizeReference returns the reference with normalized vertex keys
+func (s Store) normalizeReference(from, to QualifiedKey) Reference {
+	from.Key = s.replica.NormalizeKey(from.Key)
+	to.Key = s.replica.NormalizeKey(to.Key)
+	return Reference{From: from, To: to}
+}
+
+// referenceIndex maps every vertex with references to the vertices they point to, sorted by the string form
+func (s Store) referenceIndex() map[QualifiedKey][]QualifiedKey {
+	index := make(map[QualifiedKey][]QualifiedKey)
+	for _, e := range s.references.List() {
+		ref, isReference := e.(Reference)
+		if !isReference {
+			continue
+		}
+		index[ref.From] = append(index[ref.From], ref.To)
+	}
+	for _, targets := range index {
+		sort.Slice(targets, func(i, j int) bool {
+			return targets[i].String() < targets[j].String()
+		})
+	}
+	return index
+}
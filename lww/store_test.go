@@ -0,0 +1,97 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	newStore := func(t *testing.T, id string) Store {
+		s := NewStore(crdt.NewReplica(id))
+		users, docs := s.Graph("users"), s.Graph("docs")
+		require.NoError(t, users.AddVertex(Vertex{Key: "alice"}))
+		require.NoError(t, users.AddVertex(Vertex{Key: "team"}))
+		require.NoError(t, users.AddEdge("alice", "team"))
+		require.NoError(t, docs.AddVertex(Vertex{Key: "spec"}))
+		require.NoError(t, docs.AddVertex(Vertex{Key: "draft"}))
+		require.NoError(t, docs.AddEdge("spec", "draft"))
+		return s
+	}
+	keys := func(vertices []QualifiedVertex) []string {
+		list := make([]string, 0, len(vertices))
+		for _, v := range vertices {
+			list = append(list, QualifiedKey{Graph: v.Graph, Key: v.Key}.String())
+		}
+		return list
+	}
+
+	t.Run("follows only permitted references", func(t *testing.T) {
+		s := newStore(t, "A")
+		require.NoError(t, s.AddReference(QualifiedKey{"users", "team"}, QualifiedKey{"docs", "spec"}))
+
+		connected, err := s.FindConnected(QualifiedKey{"users", "alice"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"users/team"}, keys(connected))
+
+		s.Permit("users", "docs")
+		connected, err = s.FindConnected(QualifiedKey{"users", "alice"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"users/team", "docs/spec", "docs/draft"}, keys(connected))
+
+		connected, err = s.FindConnected(QualifiedKey{"docs", "spec"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"docs/draft"}, keys(connected), "references are directional")
+	})
+
+	t.Run("skips removed references and vertices", func(t *testing.T) {
+		s := newStore(t, "A")
+		s.Permit("users", "docs")
+		require.NoError(t, s.AddReference(QualifiedKey{"users", "alice"}, QualifiedKey{"docs", "draft"}))
+		require.NoError(t, s.Graph("docs").RemoveVertex("draft"))
+
+		connected, err := s.FindConnected(QualifiedKey{"users", "alice"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"users/team"}, keys(connected))
+		require.Equal(t, []QualifiedKey{{"docs", "draft"}}, s.References(QualifiedKey{"users", "alice"}))
+
+		require.NoError(t, s.RemoveReference(QualifiedKey{"users", "alice"}, QualifiedKey{"docs", "draft"}))
+		require.Empty(t, s.References(QualifiedKey{"users", "alice"}))
+		err = s.RemoveReference(QualifiedKey{"users", "alice"}, QualifiedKey{"docs", "draft"})
+		require.ErrorIs(t, err, ErrReferenceNotFound)
+	})
+
+	t.Run("returns an error for missing vertices", func(t *testing.T) {
+		s := newStore(t, "A")
+		err := s.AddReference(QualifiedKey{"users", "alice"}, QualifiedKey{"docs", "missing"})
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		err = s.AddReference(QualifiedKey{"users", "alice"}, QualifiedKey{"missing", "spec"})
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		_, err = s.FindConnected(QualifiedKey{"missing", "alice"})
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		require.Equal(t, []string{"docs", "users"}, s.Names())
+	})
+
+	t.Run("merges the graphs and the references", func(t *testing.T) {
+		a := newStore(t, "A")
+		b := NewStore(crdt.NewReplica("B"))
+		require.NoError(t, b.Graph("tags").AddVertex(Vertex{Key: "go"}))
+		b.Merge(a)
+		require.NoError(t, b.AddReference(QualifiedKey{"docs", "spec"}, QualifiedKey{"tags", "go"}))
+
+		a.Merge(b)
+		a.Permit("docs", "tags")
+		connected, err := a.FindConnected(QualifiedKey{"docs", "spec"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"docs/draft", "tags/go"}, keys(connected))
+	})
+
+	t.Run("parses qualified keys", func(t *testing.T) {
+		k, err := ParseQualifiedKey("users/alice/home")
+		require.NoError(t, err)
+		require.Equal(t, QualifiedKey{Graph: "users", Key: "alice/home"}, k)
+		_, err = ParseQualifiedKey("alice")
+		require.Error(t, err)
+	})
+}
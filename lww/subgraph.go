@@ -0,0 +1,67 @@
+package lww
+
+// Subgraph returns a new graph containing only the vertices matching the predicate and the edges between them
+// (the induced subgraph) along with their edge weights, so a part of a large graph can be queried or shipped
+// to another replica. The subgraph keeps the LWW metadata of the graph, so it can be merged into any replica.
+//
+// The predicate is called for every vertex including the removed ones with their last values,
+// so the removals of the matching vertices and edges are shipped too.
+// The predicate must not call the methods of the graph.
+func (g Graph) Subgraph(predicate func(Vertex) bool) Graph {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	subgraph := NewGraph(g.replica)
+
+	selected := make(map[string]nothing)
+	for key, record := range g.vertices.records("") {
+		vertex, isVertex := toVertex(record.element)
+		if !isVertex || !predicate(vertex) {
+			continue
+		}
+		selected[key] = nothing{}
+		subgraph.vertices.restoreRecord(key, record)
+	}
+
+	for fromKey, edges := range g.edges {
+		if _, isSelected := selected[fromKey]; !isSelected {
+			continue
+		}
+		for toKey, record := range edges.records("") {
+			if _, isSelected := selected[toKey]; !isSelected {
+				continue
+			}
+			subgraph.getAdjacent(fromKey).restoreRecord(toKey, record)
+		}
+	}
+
+	for fromKey, weights := range g.weights {
+		if _, isSelected := selected[fromKey]; !isSelected {
+			continue
+		}
+		for toKey, weight := range weights {
+			if _, isSelected := selected[toKey]; !isSelected {
+				continue
+			}
+			subgraph.getWeight(fromKey, toKey).Merge(weight)
+		}
+	}
+	subgraph.reindex()
+
+	return subgraph
+}
+
+// SubgraphOf returns the subgraph induced by the vertices with the given keys, see `Subgraph`.
+// Keys of vertices that do not exist are ignored.
+func (g Graph) SubgraphOf(keys []string) Graph {
+	selected := make(map[string]nothing, len(keys))
+	for _, key := range keys {
+		selected[g.replica.NormalizeKey(key)] = nothing{}
+	}
+
+	return g.Subgraph(func(v Vertex) bool {
+		_, isSelected := selected[v.Key]
+		return isSelected
+	})
+}
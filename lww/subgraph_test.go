@@ -0,0 +1,91 @@
+package lww
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubgraph(t *testing.T) {
+	admin := Vertex{Key: "user/admin", Value: "admin"}
+	alice := Vertex{Key: "user/alice", Value: "alice"}
+	bob := Vertex{Key: "user/bob", Value: "bob"}
+	doc := Vertex{Key: "doc/readme", Value: "readme"}
+
+	newGraph := func(t *testing.T) Graph {
+		g := NewGraph(crdt.NewReplica("A"))
+		for _, v := range []Vertex{admin, alice, bob, doc} {
+			require.NoError(t, g.AddVertex(v))
+		}
+		require.NoError(t, g.AddEdge(admin.Key, alice.Key))
+		require.NoError(t, g.AddEdge(alice.Key, bob.Key))
+		require.NoError(t, g.AddEdge(alice.Key, doc.Key))
+		require.NoError(t, g.AddEdge(doc.Key, admin.Key))
+		require.NoError(t, g.AddEdgeWeight(admin.Key, alice.Key, 5))
+		return g
+	}
+	users := func(v Vertex) bool {
+		return strings.HasPrefix(v.Key, "user/")
+	}
+
+	t.Run("contains matching vertices and the edges between them", func(t *testing.T) {
+		g := newGraph(t)
+		subgraph := g.Subgraph(users)
+
+		list, err := subgraph.List()
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: admin, AdjacentKeys: []string{alice.Key}},
+			{Vertex: alice, AdjacentKeys: []string{bob.Key}},
+			{Vertex: bob, AdjacentKeys: []string{}},
+		}, list)
+
+		weight, err := subgraph.EdgeWeight(admin.Key, alice.Key)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), weight)
+
+		predecessors, err := subgraph.FindPredecessors(alice.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{admin}, predecessors)
+
+		require.NoError(t, subgraph.AddVertex(Vertex{Key: "user/carol"}), "the subgraph is a regular graph")
+		_, err = g.Lookup("user/carol")
+		require.ErrorIs(t, err, ErrVertexNotFound, "the subgraph is independent")
+	})
+
+	t.Run("selects vertices by keys", func(t *testing.T) {
+		g := newGraph(t)
+		list, err := g.SubgraphOf([]string{alice.Key, doc.Key, "non-existing"}).List()
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: doc, AdjacentKeys: []string{}},
+			{Vertex: alice, AdjacentKeys: []string{doc.Key}},
+		}, list)
+	})
+
+	t.Run("merges into other replicas with removals", func(t *testing.T) {
+		g := newGraph(t)
+		other := NewGraph(crdt.NewReplica("B"))
+		other.Merge(g)
+
+		require.NoError(t, g.RemoveEdge(alice.Key, bob.Key))
+		require.NoError(t, g.RemoveVertex(admin.Key))
+		require.NoError(t, g.RemoveEdge(alice.Key, doc.Key))
+
+		other.Merge(g.Subgraph(users))
+		_, err := other.Lookup(admin.Key)
+		require.ErrorIs(t, err, ErrVertexNotFound)
+		list, err := other.List()
+		require.NoError(t, err)
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: doc, AdjacentKeys: []string{admin.Key}},
+			{Vertex: alice, AdjacentKeys: []string{doc.Key}},
+			{Vertex: bob, AdjacentKeys: []string{}},
+		}, list, "edges to other vertices are not shipped")
+
+		_, err = g.Subgraph(users).Lookup(admin.Key)
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+}
@@ -0,0 +1,199 @@
+package lww
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/rdner/crdt"
+)
+
+// SyncStatus tells if the local changes of a key are known to be replicated
+type SyncStatus int
+
+const (
+	// SyncConfirmed means there are no local changes of the key waiting for replication
+	SyncConfirmed SyncStatus = iota
+	// SyncPending means some local changes of the key are not confirmed as replicated yet
+	SyncPending
+)
+
+// String returns the name of the status
+func (s SyncStatus) String() string {
+	switch s {
+	case SyncConfirmed:
+		return "confirmed"
+	case SyncPending:
+		return "pending"
+	default:
+		return "unknown"
+	}
+}
+
+// SyncMark marks the local changes observed by a sync tracker up to a point, see `SyncTracker.Mark`
+type SyncMark uint64
+
+// PendingChange is a local change not confirmed as replicated yet
+type PendingChange struct {
+	// Key is the key of the element or the vertex, for edges it's the key of the vertex the edge starts from
+	Key string
+	// AdjacentKey is the key of the vertex the edge points to, empty for anything but edges
+	AdjacentKey string
+	// Removal is `true` if the change is a removal, `false` if it's an addition
+	Removal bool
+}
+
+// NewSyncTracker returns a tracker of the local changes of the replica.
+// Set it as the `Replica.Observer` of the tracked set or graph (or chain it using `crdt.Observers`).
+func NewSyncTracker(r crdt.Replica) SyncTracker {
+	return SyncTracker{
+		replica: r.WithDefaults(),
+		mutex:   &sync.Mutex{},
+		state: &syncState{
+			pending: make(map[PendingChange]SyncMark),
+		},
+	}
+}
+
+// SyncTracker tracks which local changes have been confirmed as replicated to a peer
+// and which are still pending, so collaborative UIs can render "syncing…" indicators per key.
+// Use `NewSyncTracker` in order to initialize it before use.
+//
+// Every local change observed by the tracker is pending until it's confirmed by one of:
+//   - `Acknowledge` with a mark taken before the state was sent to a peer that acknowledged merging it,
+//   - `ConfirmDigest` with the Merkle tree of a peer, the changes in the key ranges where the peer
+//     has the same state as the replica are confirmed,
+//   - a merged change of another replica overwriting it, the local change is lost and there is nothing to sync.
+//
+// The tracker is thread-safe and can be used from several go routines.
+type SyncTracker struct {
+	replica crdt.Replica
+	// mutex is used for the thread-safety of the state
+	mutex *sync.Mutex
+	// state is shared by all the copies of the tracker
+	state *syncState
+}
+
+// syncState contains the tracked changes
+type syncState struct {
+	// last is the mark of the last observed local change
+	last SyncMark
+	// pending maps every pending change to the mark of its last occurrence
+	pending map[PendingChange]SyncMark
+}
+
+// Observe implements the `crdt.Observer` interface
+func (t SyncTracker) Observe(m crdt.Mutation) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	change := PendingChange{Key: m.Key, AdjacentKey: m.AdjacentKey, Removal: m.Removal}
+	if m.Source != crdt.SourceLocal {
+		// the local change is overwritten by a newer one of another replica
+		delete(t.state.pending, change)
+		return
+	}
+	t.state.last++
+	t.state.pending[change] = t.state.last
+}
+
+// Status returns the sync status of the element or the vertex with the given key,
+// the changes of the edges starting from the vertex are included.
+func (t SyncTracker) Status(key string) SyncStatus {
+	key = t.replica.NormalizeKey(key)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for change := range t.state.pending {
+		if change.Key == key {
+			return SyncPending
+		}
+	}
+	return SyncConfirmed
+}
+
+// EdgeStatus returns the sync status of the edge between the vertices with the given keys
+func (t SyncTracker) EdgeStatus(fromKey, toKey string) SyncStatus {
+	fromKey, toKey = t.replica.NormalizeKey(fromKey), t.replica.NormalizeKey(toKey)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, removal := range []bool{false, true} {
+		if _, pending := t.state.pending[PendingChange{Key: fromKey, AdjacentKey: toKey, Removal: removal}]; pending {
+			return SyncPending
+		}
+	}
+	return SyncConfirmed
+}
+
+// Pending returns all the pending changes sorted by key
+func (t SyncTracker) Pending() []PendingChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	pending := make([]PendingChange, 0, len(t.state.pending))
+	for change := range t.state.pending {
+		pending = append(pending, change)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Key != pending[j].Key {
+			return pending[i].Key < pending[j].Key
+		}
+		if pending[i].AdjacentKey != pending[j].AdjacentKey {
+			return pending[i].AdjacentKey < pending[j].AdjacentKey
+		}
+		return !pending[i].Removal && pending[j].Removal
+	})
+	return pending
+}
+
+// Mark returns the mark of the local changes observed so far.
+// Take it right before serializing the state for a peer and pass it to `Acknowledge` when the peer
+// acknowledges merging the state.
+func (t SyncTracker) Mark() SyncMark {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.state.last
+}
+
+// Acknowledge confirms all the local changes observed up to the mark,
+// the changes repeated after the mark stay pending.
+func (t SyncTracker) Acknowledge(mark SyncMark) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for change, last := range t.state.pending {
+		if last <= mark {
+			delete(t.state.pending, change)
+		}
+	}
+}
+
+// ConfirmDigest compares the local Merkle tree returned by `digest` (`Set.Digest` or `Graph.Digest`
+// of the tracked CRDT) with the tree of a `remote` peer and confirms the local changes in the key ranges
+// where both trees are equal. The changes observed while the local tree is computed stay pending.
+func (t SyncTracker) ConfirmDigest(digest func() (MerkleTree, error), remote MerkleTree) error {
+	mark := t.Mark()
+
+	local, err := digest()
+	if err != nil {
+		return err
+	}
+	divergent, err := local.Diff(remote)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for change, last := range t.state.pending {
+		// edges belong to the bucket of the vertex they start from
+		if last <= mark && !inRanges(divergent, change.Key) {
+			delete(t.state.pending, change)
+		}
+	}
+	return nil
+}
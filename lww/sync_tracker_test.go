@@ -0,0 +1,110 @@
+package lww
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncTracker(t *testing.T) {
+	newReplicas := func() (local, remote Graph, tracker SyncTracker) {
+		now := time.Now()
+		tick := clock.Func(func() time.Time {
+			now = now.Add(time.Millisecond)
+			return now
+		})
+
+		r := crdt.NewReplica("A")
+		r.Clock = tick
+		r.KeyNormalizer = strings.ToLower
+		tracker = NewSyncTracker(r)
+		r.Observer = tracker
+
+		remoteReplica := crdt.NewReplica("B")
+		remoteReplica.Clock = tick
+		remoteReplica.KeyNormalizer = strings.ToLower
+		return NewGraph(r), NewGraph(remoteReplica), tracker
+	}
+
+	t.Run("tracks local changes as pending", func(t *testing.T) {
+		local, _, tracker := newReplicas()
+		require.NoError(t, local.AddVertex(Vertex{Key: "v1"}))
+		require.NoError(t, local.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, local.AddEdge("v1", "v2"))
+
+		require.Equal(t, SyncPending, tracker.Status("V1"))
+		require.Equal(t, SyncPending, tracker.Status("v2"))
+		require.Equal(t, SyncConfirmed, tracker.Status("v3"))
+		require.Equal(t, SyncPending, tracker.EdgeStatus("v1", "V2"))
+		require.Equal(t, SyncConfirmed, tracker.EdgeStatus("v2", "v1"))
+		require.Equal(t, []PendingChange{
+			{Key: "v1"},
+			{Key: "v1", AdjacentKey: "v2"},
+			{Key: "v2"},
+		}, tracker.Pending())
+	})
+
+	t.Run("confirms changes acknowledged by a peer", func(t *testing.T) {
+		local, remote, tracker := newReplicas()
+		require.NoError(t, local.AddVertex(Vertex{Key: "v1"}))
+		require.NoError(t, local.AddVertex(Vertex{Key: "v2"}))
+
+		mark := tracker.Mark()
+		remote.Merge(local)
+		// changed while the state was sent
+		require.NoError(t, local.UpdateVertex(Vertex{Key: "v2", Value: "updated"}))
+		tracker.Acknowledge(mark)
+
+		require.Equal(t, SyncConfirmed, tracker.Status("v1"))
+		require.Equal(t, SyncPending, tracker.Status("v2"))
+	})
+
+	t.Run("confirms changes in the ranges matching the digest of a peer", func(t *testing.T) {
+		local, remote, tracker := newReplicas()
+		require.NoError(t, local.AddVertex(Vertex{Key: "v1"}))
+		require.NoError(t, local.AddVertex(Vertex{Key: "v2"}))
+		require.NoError(t, local.AddEdge("v1", "v2"))
+		remote.Merge(local)
+		// not replicated yet
+		require.NoError(t, local.RemoveVertex("v2"))
+		require.NotEqual(t, keyBucket("v1"), keyBucket("v2"))
+
+		remoteTree, err := remote.Digest()
+		require.NoError(t, err)
+		require.NoError(t, tracker.ConfirmDigest(local.Digest, remoteTree))
+
+		require.Equal(t, SyncConfirmed, tracker.Status("v1"))
+		require.Equal(t, SyncConfirmed, tracker.EdgeStatus("v1", "v2"))
+		require.Equal(t, SyncPending, tracker.Status("v2"))
+		// the replicated addition shares the divergent bucket with the removal
+		require.Equal(t, []PendingChange{{Key: "v2"}, {Key: "v2", Removal: true}}, tracker.Pending())
+
+		remote.Merge(local)
+		remoteTree, err = remote.Digest()
+		require.NoError(t, err)
+		require.NoError(t, tracker.ConfirmDigest(local.Digest, remoteTree))
+		require.Empty(t, tracker.Pending())
+	})
+
+	t.Run("drops local changes overwritten by a merge", func(t *testing.T) {
+		local, remote, tracker := newReplicas()
+		require.NoError(t, local.AddVertex(Vertex{Key: "v1", Value: "local"}))
+		require.NoError(t, remote.AddVertex(Vertex{Key: "v1", Value: "remote"}))
+		local.Merge(remote)
+
+		require.Equal(t, SyncConfirmed, tracker.Status("v1"))
+	})
+
+	t.Run("fails with an invalid digest", func(t *testing.T) {
+		local, _, tracker := newReplicas()
+		require.NoError(t, local.AddVertex(Vertex{Key: "v1"}))
+
+		err := tracker.ConfirmDigest(local.Digest, MerkleTree{})
+		require.ErrorIs(t, err, ErrInvalidMerkleTree)
+		require.Equal(t, SyncPending, tracker.Status("v1"))
+	})
+}
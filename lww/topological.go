@@ -0,0 +1,261 @@
+package lww
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrCycleDetected occurs when an operation requires an acyclic graph but the graph has a cycle
+	ErrCycleDetected = errors.New("cycle detected")
+)
+
+// TopologicalSort returns all the vertices of the graph ordered so every vertex goes before
+// the vertices its edges point to, e.g. tasks before the tasks depending on them.
+//
+// The result is deterministic: among the vertices which can go next the one with the smallest key is taken.
+// Edges pointing to removed vertices are ignored.
+//
+// Returns an error with `ErrCycleDetected` cause if the graph has a cycle, including an edge of a vertex to itself.
+func (g Graph) TopologicalSort() (sorted []Vertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	vertices, err := g.sortedVertices()
+	if err != nil {
+		return nil, err
+	}
+
+	inDegree := make(map[string]int, len(vertices))
+	adjacency := make(map[string][]Vertex, len(vertices))
+	for _, vertex := range vertices {
+		adjacent, err := g.sortedAdjacent(vertex.Key)
+		if err != nil {
+			return nil, err
+		}
+		adjacency[vertex.Key] = adjacent
+		for _, to := range adjacent {
+			inDegree[to.Key]++
+		}
+	}
+
+	ready := &vertexQueue{}
+	for _, vertex := range vertices {
+		if inDegree[vertex.Key] == 0 {
+			heap.Push(ready, vertex)
+		}
+	}
+
+	sorted = make([]Vertex, 0, len(vertices))
+	for ready.Len() != 0 {
+		current, _ := heap.Pop(ready).(Vertex)
+		sorted = append(sorted, current)
+		for _, to := range adjacency[current.Key] {
+			inDegree[to.Key]--
+			if inDegree[to.Key] == 0 {
+				heap.Push(ready, to)
+			}
+		}
+	}
+
+	if len(sorted) == len(vertices) {
+		return sorted, nil
+	}
+
+	cycles, err := g.findCycles(true)
+	if err != nil {
+		return nil, err
+	}
+	return nil, errors.Wrapf(ErrCycleDetected, "failed to sort the graph topologically, cycle %s", formatCycle(cycles[0]))
+}
+
+// AddEdgeAcyclic adds a directional edge like `AddEdge` unless the edge closes a cycle,
+// e.g. a task depending on a task which already depends on it.
+// Returns an error with `ErrCycleDetected` cause if there is a path from `toKey` to `fromKey`
+// or both keys are the same.
+//
+// The check covers only the local state: edges added concurrently on other replicas
+// can still form a cycle after merging, use `FindCycles` for detecting them.
+func (g Graph) AddEdgeAcyclic(fromKey, toKey string) error {
+	g.checkUsage()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	err := g.replica.CheckClock()
+	if err != nil {
+		return err
+	}
+
+	if g.replica.NormalizeKey(fromKey) == g.replica.NormalizeKey(toKey) {
+		return errors.Wrapf(ErrCycleDetected, "edge of vertex [key = %q] to itself", fromKey)
+	}
+
+	path, err := g.findPathFrom(nil, toKey, fromKey, EdgeFilter{})
+	if err == nil {
+		return errors.Wrapf(ErrCycleDetected, "edge [from = %q, to = %q] closes the cycle %s", fromKey, toKey, formatCycle(path))
+	}
+	if !errors.Is(err, ErrPathNotFound) {
+		return err
+	}
+
+	return g.addEdge(fromKey, toKey)
+}
+
+// HasCycle returns `true` if the graph has a directed cycle, including an edge of a vertex to itself.
+// Edges pointing to removed vertices are ignored.
+func (g Graph) HasCycle() (bool, error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	cycles, err := g.findCycles(true)
+	if err != nil {
+		return false, err
+	}
+	return len(cycles) != 0, nil
+}
+
+// FindCycles returns directed cycles of the graph, every cycle is a list of vertices
+// where each vertex has an edge to the next one and the last vertex has an edge to the first one.
+//
+// The number of all the cycles of a graph can grow exponentially, so only the cycles closed by the back edges
+// of a depth-first search are returned: the result is empty only if the graph is acyclic
+// and removing the last edge of every returned cycle makes the graph acyclic.
+// The search visits the vertices in the order of their keys, so the result is deterministic.
+// Edges pointing to removed vertices are ignored.
+func (g Graph) FindCycles() (cycles [][]Vertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.findCycles(false)
+}
+
+// findCycles runs a depth-first search collecting the cycles closed by its back edges,
+// it stops after the first found cycle if `first` is `true`. Must be called under the graph lock.
+func (g Graph) findCycles(first bool) (cycles [][]Vertex, err error) {
+	vertices, err := g.sortedVertices()
+	if err != nil {
+		return nil, err
+	}
+
+	// maps a vertex key on the current search path to its position on the path
+	onPath := make(map[string]int)
+	visited := make(map[string]nothing, len(vertices))
+	path := []Vertex{}
+	cycles = [][]Vertex{}
+
+	var visit func(vertex Vertex) (stop bool, err error)
+	visit = func(vertex Vertex) (stop bool, err error) {
+		visited[vertex.Key] = nothing{}
+		onPath[vertex.Key] = len(path)
+		path = append(path, vertex)
+
+		adjacent, err := g.sortedAdjacent(vertex.Key)
+		if err != nil {
+			return false, err
+		}
+		for _, to := range adjacent {
+			if i, isOnPath := onPath[to.Key]; isOnPath {
+				cycle := make([]Vertex, len(path)-i)
+				copy(cycle, path[i:])
+				cycles = append(cycles, cycle)
+				if first {
+					return true, nil
+				}
+				continue
+			}
+			if _, isVisited := visited[to.Key]; isVisited {
+				continue
+			}
+			stop, err := visit(to)
+			if stop || err != nil {
+				return stop, err
+			}
+		}
+
+		delete(onPath, vertex.Key)
+		path = path[:len(path)-1]
+		return false, nil
+	}
+
+	for _, vertex := range vertices {
+		if _, isVisited := visited[vertex.Key]; isVisited {
+			continue
+		}
+		stop, err := visit(vertex)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			break
+		}
+	}
+
+	return cycles, nil
+}
+
+// sortedVertices returns all the vertices of the graph sorted by their keys, must be called under the graph lock
+func (g Graph) sortedVertices() ([]Vertex, error) {
+	elements := g.vertices.List()
+	vertices := make([]Vertex, 0, len(elements))
+	for _, element := range elements {
+		vertex, err := g.Lookup(element.GetKey())
+		if err != nil {
+			return nil, err
+		}
+		vertices = append(vertices, vertex)
+	}
+
+	sort.Slice(vertices, func(i, j int) bool {
+		return vertices[i].Key < vertices[j].Key
+	})
+	return vertices, nil
+}
+
+// formatCycle returns a human-readable representation of the cycle, e.g. `"a" -> "b" -> "a"`
+func formatCycle(cycle []Vertex) string {
+	keys := make([]string, 0, len(cycle)+1)
+	for _, vertex := range cycle {
+		keys = append(keys, `"`+vertex.Key+`"`)
+	}
+	keys = append(keys, `"`+cycle[0].Key+`"`)
+	return strings.Join(keys, " -> ")
+}
+
+// vertexQueue is a priority queue of vertices ordered by the key.
+// It implements `heap.Interface`.
+type vertexQueue []Vertex
+
+// Len implements the `sort.Interface` interface
+func (q vertexQueue) Len() int {
+	return len(q)
+}
+
+// Less implements the `sort.Interface` interface
+func (q vertexQueue) Less(i, j int) bool {
+	return q[i].Key < q[j].Key
+}
+
+// Swap implements the `sort.Interface` interface
+func (q vertexQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+// Push implements the `heap.Interface` interface
+func (q *vertexQueue) Push(x interface{}) {
+	vertex, _ := x.(Vertex)
+	*q = append(*q, vertex)
+}
+
+// Pop implements the `heap.Interface` interface
+func (q *vertexQueue) Pop() interface{} {
+	old := *q
+	vertex := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return vertex
+}
@@ -0,0 +1,131 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologicalSort(t *testing.T) {
+	newGraph := func(t *testing.T, keys []string, edges [][2]string) Graph {
+		g := NewGraph(testReplica)
+		for _, key := range keys {
+			require.NoError(t, g.AddVertex(Vertex{Key: key}))
+		}
+		for _, edge := range edges {
+			require.NoError(t, g.AddEdge(edge[0], edge[1]))
+		}
+		return g
+	}
+	keysOf := func(vertices []Vertex) []string {
+		keys := make([]string, 0, len(vertices))
+		for _, v := range vertices {
+			keys = append(keys, v.Key)
+		}
+		return keys
+	}
+
+	t.Run("sorts dependencies deterministically", func(t *testing.T) {
+		g := newGraph(t, []string{"deploy", "build", "test", "lint", "docs"}, [][2]string{
+			{"build", "test"},
+			{"lint", "test"},
+			{"test", "deploy"},
+			{"build", "deploy"},
+		})
+
+		sorted, err := g.TopologicalSort()
+		require.NoError(t, err)
+		require.Equal(t, []string{"build", "docs", "lint", "test", "deploy"}, keysOf(sorted))
+
+		hasCycle, err := g.HasCycle()
+		require.NoError(t, err)
+		require.False(t, hasCycle)
+		cycles, err := g.FindCycles()
+		require.NoError(t, err)
+		require.Empty(t, cycles)
+	})
+
+	t.Run("detects cycles", func(t *testing.T) {
+		g := newGraph(t, []string{"a", "b", "c", "d", "e"}, [][2]string{
+			{"a", "b"},
+			{"b", "c"},
+			{"c", "a"},
+			{"c", "d"},
+			{"e", "e"},
+		})
+
+		_, err := g.TopologicalSort()
+		require.ErrorIs(t, err, ErrCycleDetected)
+		require.Contains(t, err.Error(), `"a" -> "b" -> "c" -> "a"`)
+
+		hasCycle, err := g.HasCycle()
+		require.NoError(t, err)
+		require.True(t, hasCycle)
+
+		cycles, err := g.FindCycles()
+		require.NoError(t, err)
+		require.Len(t, cycles, 2)
+		require.Equal(t, []string{"a", "b", "c"}, keysOf(cycles[0]))
+		require.Equal(t, []string{"e"}, keysOf(cycles[1]), "an edge to itself is a cycle")
+	})
+
+	t.Run("removing the closing edges makes the graph acyclic", func(t *testing.T) {
+		g := newGraph(t, []string{"r", "x", "y"}, [][2]string{
+			{"r", "x"},
+			{"r", "y"},
+			{"x", "r"},
+			{"y", "x"},
+			{"y", "r"},
+		})
+
+		cycles, err := g.FindCycles()
+		require.NoError(t, err)
+		require.NotEmpty(t, cycles)
+		for _, cycle := range cycles {
+			require.NoError(t, g.RemoveEdge(cycle[len(cycle)-1].Key, cycle[0].Key))
+		}
+
+		_, err = g.TopologicalSort()
+		require.NoError(t, err)
+	})
+
+	t.Run("ignores removed vertices", func(t *testing.T) {
+		g := newGraph(t, []string{"a", "b", "c"}, [][2]string{
+			{"a", "b"},
+			{"b", "c"},
+			{"c", "a"},
+		})
+		require.NoError(t, g.RemoveVertex("c"))
+
+		sorted, err := g.TopologicalSort()
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, keysOf(sorted))
+		hasCycle, err := g.HasCycle()
+		require.NoError(t, err)
+		require.False(t, hasCycle)
+	})
+
+	t.Run("adds only edges keeping the graph acyclic", func(t *testing.T) {
+		g := newGraph(t, []string{"build", "test", "deploy"}, [][2]string{
+			{"build", "test"},
+			{"test", "deploy"},
+		})
+
+		err := g.AddEdgeAcyclic("deploy", "build")
+		require.ErrorIs(t, err, ErrCycleDetected)
+		require.Contains(t, err.Error(), `"build" -> "test" -> "deploy" -> "build"`)
+		require.ErrorIs(t, g.AddEdgeAcyclic("test", "test"), ErrCycleDetected)
+		require.ErrorIs(t, g.AddEdgeAcyclic("test", "missing"), ErrVertexNotFound)
+
+		require.NoError(t, g.AddEdgeAcyclic("build", "deploy"))
+		sorted, err := g.TopologicalSort()
+		require.NoError(t, err)
+		require.Equal(t, []string{"build", "test", "deploy"}, keysOf(sorted))
+	})
+
+	t.Run("sorts an empty graph", func(t *testing.T) {
+		sorted, err := NewGraph(testReplica).TopologicalSort()
+		require.NoError(t, err)
+		require.Empty(t, sorted)
+	})
+}
@@ -0,0 +1,188 @@
+package lww
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Transposed is a read-only point-in-time view of a graph with all the edges reversed:
+// the edge V1->V2 of the graph is the edge V2->V1 of the view.
+// It's produced by `Graph.Transpose` and it's not affected by later changes of the graph.
+// The view is immutable, so it's thread-safe and can be used from several go routines.
+type Transposed struct {
+	// vertices maps a key to the vertex, the vertex values are shared with the graph
+	vertices map[string]Vertex
+	// adjacency maps a vertex key to the sorted keys of the vertices that point to it in the graph
+	adjacency map[string][]string
+}
+
+// Transpose returns a view of the graph with all the edges reversed, enabling algorithms that need
+// reverse reachability (e.g. "which vertices depend on this one") without maintaining a second replicated graph.
+// Only the edges between existing vertices are included. Vertex values are not copied.
+func (g Graph) Transpose() Transposed {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	t := Transposed{
+		vertices:  make(map[string]Vertex),
+		adjacency: make(map[string][]string),
+	}
+
+	for _, element := range g.vertices.List() {
+		vertex, isVertex := toVertex(element)
+		if !isVertex {
+			continue
+		}
+		t.vertices[vertex.Key] = vertex
+	}
+
+	for fromKey := range t.vertices {
+		for _, to := range g.listAdjacent(fromKey) {
+			toKey := to.GetKey()
+			// some edges exist even for removed vertices
+			if _, exists := t.vertices[toKey]; !exists {
+				continue
+			}
+			t.adjacency[toKey] = append(t.adjacency[toKey], fromKey)
+		}
+	}
+	for key := range t.adjacency {
+		sort.Strings(t.adjacency[key])
+	}
+
+	return t
+}
+
+// Lookup returns the vertex with the given key.
+// Returns an error with `ErrVertexNotFound` cause if the vertex does not exist.
+func (t Transposed) Lookup(key string) (Vertex, error) {
+	vertex, exists := t.vertices[key]
+	if !exists {
+		return Vertex{}, errors.Wrapf(ErrVertexNotFound, "failed to find vertex [key = %q]", key)
+	}
+	return vertex, nil
+}
+
+// Adjacent returns the vertices adjacent to the vertex with the given key in the view,
+// which are the vertices that have an edge to it in the graph, sorted by their keys.
+// Returns an error with `ErrVertexNotFound` cause if the vertex does not exist.
+func (t Transposed) Adjacent(key string) ([]Vertex, error) {
+	_, err := t.Lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	adjacent := make([]Vertex, 0, len(t.adjacency[key]))
+	for _, adjacentKey := range t.adjacency[key] {
+		adjacent = append(adjacent, t.vertices[adjacentKey])
+	}
+	return adjacent, nil
+}
+
+// FindConnected returns the vertices connected to the vertex with the given key in the view,
+// which are the vertices the vertex is reachable from in the graph.
+// The order is breadth-first and deterministic.
+// Returns an error with `ErrVertexNotFound` cause if the vertex does not exist.
+func (t Transposed) FindConnected(key string) ([]Vertex, error) {
+	_, err := t.Lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// it's always at least an empty list
+	connected := []Vertex{}
+	visited := map[string]nothing{key: {}}
+	queue := []string{key}
+
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, adjacentKey := range t.adjacency[current] {
+			if _, toSkip := visited[adjacentKey]; toSkip {
+				continue
+			}
+			visited[adjacentKey] = nothing{}
+			connected = append(connected, t.vertices[adjacentKey])
+			queue = append(queue, adjacentKey)
+		}
+	}
+
+	return connected, nil
+}
+
+// FindPath returns the shortest path from the vertex with `fromKey` to the vertex with `toKey` in the view,
+// which is the reversed shortest path from `toKey` to `fromKey` in the graph.
+// Returns an error with `ErrVertexNotFound` cause if one of the vertices does not exist.
+// Returns an error with `ErrPathNotFound` cause when the vertices are not connected.
+func (t Transposed) FindPath(fromKey, toKey string) ([]Vertex, error) {
+	_, err := t.Lookup(fromKey)
+	if err != nil {
+		return nil, err
+	}
+	_, err = t.Lookup(toKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// breadth-first traversal remembering where every vertex was reached from
+	previous := make(map[string]string)
+	queue := []string{fromKey}
+
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, adjacentKey := range t.adjacency[current] {
+			// the start is visited unless the path is a loop back to it
+			if adjacentKey == fromKey && fromKey != toKey {
+				continue
+			}
+			if _, visited := previous[adjacentKey]; visited {
+				continue
+			}
+			previous[adjacentKey] = current
+			if adjacentKey == toKey {
+				return t.trace(fromKey, toKey, previous), nil
+			}
+			queue = append(queue, adjacentKey)
+		}
+	}
+
+	return nil, errors.Wrapf(ErrPathNotFound, "no path from %q to %q in the transposed graph", fromKey, toKey)
+}
+
+// trace restores the path found by `FindPath`
+func (t Transposed) trace(fromKey, toKey string, previous map[string]string) []Vertex {
+	path := []Vertex{t.vertices[toKey]}
+	for key := previous[toKey]; key != fromKey; key = previous[key] {
+		path = append(path, t.vertices[key])
+	}
+	path = append(path, t.vertices[fromKey])
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// List returns a comparable representation of the view in the same format as `Graph.List`.
+// This function produces deterministic results.
+func (t Transposed) List() []VertexWithEdges {
+	keys := make([]string, 0, len(t.vertices))
+	for key := range t.vertices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]VertexWithEdges, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, VertexWithEdges{
+			Vertex:       t.vertices[key],
+			AdjacentKeys: append([]string{}, t.adjacency[key]...),
+		})
+	}
+	return list
+}
@@ -0,0 +1,88 @@
+package lww
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranspose(t *testing.T) {
+	v1 := Vertex{Key: "vertex1", Value: "value1"}
+	v2 := Vertex{Key: "vertex2", Value: "value2"}
+	v3 := Vertex{Key: "vertex3", Value: "value3"}
+	v4 := Vertex{Key: "vertex4", Value: "value4"}
+	v5 := Vertex{Key: "vertex5", Value: "value5"}
+
+	// v1-->v2-->v3
+	//  |         ^
+	//  +---v4----+
+	// v5 (removed) --> v3
+	g := NewGraph(testReplica)
+	for _, v := range []Vertex{v1, v2, v3, v4, v5} {
+		require.NoError(t, g.AddVertex(v))
+	}
+	require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+	require.NoError(t, g.AddEdge(v2.Key, v3.Key))
+	require.NoError(t, g.AddEdge(v1.Key, v4.Key))
+	require.NoError(t, g.AddEdge(v4.Key, v3.Key))
+	require.NoError(t, g.AddEdge(v5.Key, v3.Key))
+	require.NoError(t, g.RemoveVertex(v5.Key))
+
+	transposed := g.Transpose()
+
+	t.Run("reverses all the edges", func(t *testing.T) {
+		require.Equal(t, []VertexWithEdges{
+			{Vertex: v1, AdjacentKeys: []string{}},
+			{Vertex: v2, AdjacentKeys: []string{v1.Key}},
+			{Vertex: v3, AdjacentKeys: []string{v2.Key, v4.Key}},
+			{Vertex: v4, AdjacentKeys: []string{v1.Key}},
+		}, transposed.List())
+
+		adjacent, err := transposed.Adjacent(v3.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v2, v4}, adjacent)
+	})
+
+	t.Run("finds reverse reachability", func(t *testing.T) {
+		connected, err := transposed.FindConnected(v3.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v2, v4, v1}, connected)
+
+		connected, err = transposed.FindConnected(v1.Key)
+		require.NoError(t, err)
+		require.Empty(t, connected)
+	})
+
+	t.Run("finds the shortest reversed path", func(t *testing.T) {
+		path, err := transposed.FindPath(v3.Key, v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v3, v2, v1}, path)
+
+		_, err = transposed.FindPath(v1.Key, v3.Key)
+		require.ErrorIs(t, err, ErrPathNotFound)
+
+		_, err = transposed.FindPath(v5.Key, v3.Key)
+		require.ErrorIs(t, err, ErrVertexNotFound)
+	})
+
+	t.Run("finds loops", func(t *testing.T) {
+		loop := NewGraph(testReplica)
+		require.NoError(t, loop.AddVertex(v1))
+		require.NoError(t, loop.AddVertex(v2))
+		require.NoError(t, loop.AddEdge(v1.Key, v2.Key))
+		require.NoError(t, loop.AddEdge(v2.Key, v1.Key))
+
+		path, err := loop.Transpose().FindPath(v1.Key, v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, []Vertex{v1, v2, v1}, path)
+	})
+
+	t.Run("is not affected by later changes", func(t *testing.T) {
+		view := g.Transpose()
+		require.NoError(t, g.AddEdge(v3.Key, v1.Key))
+
+		adjacent, err := view.Adjacent(v1.Key)
+		require.NoError(t, err)
+		require.Empty(t, adjacent)
+	})
+}
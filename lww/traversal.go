@@ -0,0 +1,148 @@
+package lww
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// traversalYieldInterval is the number of visited vertices between context checks of a traversal
+const traversalYieldInterval = 1000
+
+var (
+	// ErrLimitReached occurs when a traversal stops at one of its limits (see `TraversalLimits`)
+	ErrLimitReached = errors.New("traversal limit reached")
+)
+
+// TraversalLimits protect from traversals of pathological graphs, zero values are not limited
+type TraversalLimits struct {
+	// MaxDepth is the maximum number of edges between the start vertex and the found vertices
+	MaxDepth int
+	// MaxVisited is the maximum number of vertices whose edges the traversal follows
+	MaxVisited int
+	// MaxResults is the maximum number of found vertices
+	MaxResults int
+	// Deadline is the time the traversal stops at
+	Deadline time.Time
+}
+
+// FindConnectedContext works like `FindConnected` but stops when the context is done and returns the context error.
+//
+// Every few visited vertices the traversal checks the context and briefly releases the read lock of the graph,
+// so writers waiting for the lock are not blocked for the whole traversal.
+// Because of that, the result may reflect changes made to the graph during the traversal.
+func (g Graph) FindConnectedContext(ctx context.Context, key string) (connected []Vertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.findConnected(newTraversal(ctx, g, TraversalLimits{}), key, EdgeFilter{})
+}
+
+// FindConnectedLimited works like `FindConnected` but stops at the given limits.
+// When a limit is reached it returns the vertices found so far along with an error with `ErrLimitReached` cause,
+// so there may be more connected vertices than returned.
+//
+// Like `FindConnectedContext` the traversal periodically releases the read lock of the graph.
+func (g Graph) FindConnectedLimited(key string, limits TraversalLimits) (connected []Vertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.findConnected(newTraversal(context.Background(), g, limits), key, EdgeFilter{})
+}
+
+// FindPathContext works like `FindPath` but stops when the context is done and returns the context error.
+//
+// Like `FindConnectedContext` the traversal periodically releases the read lock of the graph,
+// so the path may reflect changes made to the graph during the traversal.
+func (g Graph) FindPathContext(ctx context.Context, fromKey, toKey string) (path []Vertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.findPathFrom(newTraversal(ctx, g, TraversalLimits{}), fromKey, toKey, EdgeFilter{})
+}
+
+// FindPathLimited works like `FindPath` but stops at the given limits, `MaxResults` is ignored.
+// Returns `ErrLimitReached` instead of `ErrPathNotFound` if a limit is reached before a path is found,
+// so the path might exist beyond the limits.
+//
+// Like `FindConnectedContext` the traversal periodically releases the read lock of the graph.
+func (g Graph) FindPathLimited(fromKey, toKey string, limits TraversalLimits) (path []Vertex, err error) {
+	g.checkUsage()
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.findPathFrom(newTraversal(context.Background(), g, limits), fromKey, toKey, EdgeFilter{})
+}
+
+// traversal checks the context and the limits of a long traversal and yields the read lock of the graph
+type traversal struct {
+	ctx     context.Context
+	g       Graph
+	limits  TraversalLimits
+	visited int
+	// limited is set when the traversal skips vertices beyond the depth limit
+	limited bool
+}
+
+// newTraversal returns a traversal of the graph checking the given context and limits
+func newTraversal(ctx context.Context, g Graph, limits TraversalLimits) *traversal {
+	return &traversal{ctx: ctx, g: g, limits: limits}
+}
+
+// step must be called before visiting each vertex under the read lock of the graph,
+// it returns an error if the traversal must stop. It's a no-op on a `nil` traversal.
+func (t *traversal) step() error {
+	if t == nil {
+		return nil
+	}
+
+	t.visited++
+	if t.limits.MaxVisited > 0 && t.visited > t.limits.MaxVisited {
+		return errors.Wrapf(ErrLimitReached, "visited %d vertices", t.limits.MaxVisited)
+	}
+	if !t.limits.Deadline.IsZero() && !time.Now().Before(t.limits.Deadline) {
+		return errors.Wrapf(ErrLimitReached, "deadline exceeded after %d vertices", t.visited-1)
+	}
+	if t.visited%traversalYieldInterval != 0 {
+		return nil
+	}
+	if err := t.ctx.Err(); err != nil {
+		return errors.Wrapf(err, "traversal stopped after %d vertices", t.visited)
+	}
+	// letting the pending writers in
+	t.g.mutex.RUnlock()
+	t.g.mutex.RLock()
+	return nil
+}
+
+// beyondDepth returns `true` if the vertex the given number of edges away from the start must be skipped.
+// It's always `false` on a `nil` traversal.
+func (t *traversal) beyondDepth(hops int) bool {
+	if t == nil || t.limits.MaxDepth <= 0 || hops <= t.limits.MaxDepth {
+		return false
+	}
+	t.limited = true
+	return true
+}
+
+// add must be called before adding a result to the given number of found results,
+// it returns an error if there are enough results. It's a no-op on a `nil` traversal.
+func (t *traversal) add(found int) error {
+	if t == nil || t.limits.MaxResults <= 0 || found < t.limits.MaxResults {
+		return nil
+	}
+	return errors.Wrapf(ErrLimitReached, "found %d vertices", found)
+}
+
+// complete returns an error if the traversal skipped any vertices because of the depth limit.
+// It's a no-op on a `nil` traversal.
+func (t *traversal) complete() error {
+	if t == nil || !t.limited {
+		return nil
+	}
+	return errors.Wrapf(ErrLimitReached, "vertices beyond depth %d are skipped", t.limits.MaxDepth)
+}
@@ -0,0 +1,122 @@
+package lww
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraversalContext(t *testing.T) {
+	// a chain of vertices longer than the yield interval
+	g := NewGraph(crdt.NewReplica("A"))
+	count := 2 * traversalYieldInterval
+	for i := 0; i < count; i++ {
+		require.NoError(t, g.AddVertex(Vertex{Key: fmt.Sprintf("v%d", i)}))
+		if i > 0 {
+			require.NoError(t, g.AddEdge(fmt.Sprintf("v%d", i-1), fmt.Sprintf("v%d", i)))
+		}
+	}
+	last := fmt.Sprintf("v%d", count-1)
+
+	t.Run("completes with a live context", func(t *testing.T) {
+		connected, err := g.FindConnectedContext(context.Background(), "v0")
+		require.NoError(t, err)
+		require.Len(t, connected, count-1)
+
+		path, err := g.FindPathContext(context.Background(), "v0", last)
+		require.NoError(t, err)
+		require.Len(t, path, count)
+
+		_, err = g.FindPathContext(context.Background(), last, "v0")
+		require.ErrorIs(t, err, ErrPathNotFound)
+	})
+
+	t.Run("stops when the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := g.FindConnectedContext(ctx, "v0")
+		require.ErrorIs(t, err, context.Canceled)
+
+		_, err = g.FindPathContext(ctx, "v0", last)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("short traversals are not interrupted", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		path, err := g.FindPathContext(ctx, "v0", "v2")
+		require.NoError(t, err)
+		require.Len(t, path, 3)
+	})
+}
+
+func TestTraversalLimits(t *testing.T) {
+	// v0->v1->v2->v3 and v0->v4
+	g := NewGraph(crdt.NewReplica("A"))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, g.AddVertex(Vertex{Key: fmt.Sprintf("v%d", i)}))
+	}
+	require.NoError(t, g.AddEdge("v0", "v1"))
+	require.NoError(t, g.AddEdge("v1", "v2"))
+	require.NoError(t, g.AddEdge("v2", "v3"))
+	require.NoError(t, g.AddEdge("v0", "v4"))
+
+	// keys returns the sorted keys of the vertices
+	keys := func(vertices []Vertex) []string {
+		sortVertices(vertices)
+		list := []string{}
+		for _, v := range vertices {
+			list = append(list, v.Key)
+		}
+		return list
+	}
+
+	t.Run("unlimited traversals find everything", func(t *testing.T) {
+		connected, err := g.FindConnectedLimited("v0", TraversalLimits{MaxDepth: 3, MaxResults: 4})
+		require.NoError(t, err)
+		require.Equal(t, []string{"v1", "v2", "v3", "v4"}, keys(connected))
+
+		path, err := g.FindPathLimited("v0", "v3", TraversalLimits{MaxDepth: 3})
+		require.NoError(t, err)
+		require.Equal(t, []string{"v0", "v1", "v2", "v3"}, keys(path))
+
+		_, err = g.FindPathLimited("v3", "v0", TraversalLimits{MaxDepth: 3})
+		require.ErrorIs(t, err, ErrPathNotFound)
+	})
+
+	t.Run("max depth", func(t *testing.T) {
+		connected, err := g.FindConnectedLimited("v0", TraversalLimits{MaxDepth: 1})
+		require.ErrorIs(t, err, ErrLimitReached)
+		require.Equal(t, []string{"v1", "v4"}, keys(connected))
+
+		_, err = g.FindPathLimited("v0", "v3", TraversalLimits{MaxDepth: 2})
+		require.ErrorIs(t, err, ErrLimitReached)
+	})
+
+	t.Run("max results", func(t *testing.T) {
+		connected, err := g.FindConnectedLimited("v0", TraversalLimits{MaxResults: 2})
+		require.ErrorIs(t, err, ErrLimitReached)
+		require.Len(t, connected, 2)
+	})
+
+	t.Run("max visited", func(t *testing.T) {
+		connected, err := g.FindConnectedLimited("v0", TraversalLimits{MaxVisited: 1})
+		require.ErrorIs(t, err, ErrLimitReached)
+		require.Equal(t, []string{"v1", "v4"}, keys(connected))
+
+		_, err = g.FindPathLimited("v0", "v3", TraversalLimits{MaxVisited: 2})
+		require.ErrorIs(t, err, ErrLimitReached)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		connected, err := g.FindConnectedLimited("v0", TraversalLimits{Deadline: time.Now().Add(-time.Second)})
+		require.ErrorIs(t, err, ErrLimitReached)
+		require.Empty(t, connected)
+	})
+}
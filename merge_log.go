@@ -0,0 +1,50 @@
+package crdt
+
+import (
+	"time"
+)
+
+// MergeSummary describes what a merge changed in the local state
+type MergeSummary struct {
+	// Kind is the kind of the merged CRDT
+	Kind Kind
+	// Replica is the ID of the local replica
+	Replica string
+	// Records is the number of processed remote records
+	Records int
+	// Applied is the number of remote records that changed the local state
+	Applied int
+	// RemoteWins is the number of last-writer-wins conflicts resolved in favor of the remote state
+	RemoteWins int
+	// LocalWins is the number of last-writer-wins conflicts resolved in favor of the local state
+	LocalWins int
+	// Duration is how long the merge took
+	Duration time.Duration
+	// Err is the reason the merge stopped before all the records were processed, e.g. a canceled context
+	Err error
+}
+
+// MergeLogger is an optional interface of `Logger` receiving structured records of merges,
+// so operators can find out why a value "disappeared" after replication.
+// Its methods are called under the lock of the merged CRDT and must not block.
+type MergeLogger interface {
+	// LogMerge records the summary of a finished merge
+	LogMerge(s MergeSummary)
+	// LogConflict records a last-writer-wins decision of a merge, `remoteWon` tells which side won:
+	// the remote operation overwrote the local one or the local operation was kept
+	LogConflict(c Conflict, remoteWon bool)
+}
+
+// LogMerge records the summary of a merge if the logger implements `MergeLogger`
+func LogMerge(l Logger, s MergeSummary) {
+	if merges, ok := l.(MergeLogger); ok {
+		merges.LogMerge(s)
+	}
+}
+
+// LogConflict records the decision of a merge if the logger implements `MergeLogger`
+func LogConflict(l Logger, c Conflict, remoteWon bool) {
+	if merges, ok := l.(MergeLogger); ok {
+		merges.LogConflict(c, remoteWon)
+	}
+}
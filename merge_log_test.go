@@ -0,0 +1,49 @@
+package crdt
+
+import (
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLogger implements `MergeLogger`
+type recordingLogger struct {
+	nopLogger
+	merges    []MergeSummary
+	conflicts []Conflict
+}
+
+func (l *recordingLogger) LogMerge(s MergeSummary) {
+	l.merges = append(l.merges, s)
+}
+
+func (l *recordingLogger) LogConflict(c Conflict, remoteWon bool) {
+	l.conflicts = append(l.conflicts, c)
+}
+
+func TestMergeLogger(t *testing.T) {
+	t.Run("passes the records to merge loggers", func(t *testing.T) {
+		l := &recordingLogger{}
+		LogMerge(l, MergeSummary{Kind: "test", Records: 1})
+		LogConflict(l, Conflict{Kind: "test", Key: "key"}, true)
+		require.Equal(t, []MergeSummary{{Kind: "test", Records: 1}}, l.merges)
+		require.Equal(t, []Conflict{{Kind: "test", Key: "key"}}, l.conflicts)
+	})
+
+	t.Run("ignores plain loggers", func(t *testing.T) {
+		l := log.New(&failingWriter{t: t}, "", 0)
+		LogMerge(l, MergeSummary{Kind: "test"})
+		LogConflict(l, Conflict{Kind: "test"}, false)
+	})
+}
+
+// failingWriter fails the test on any write
+type failingWriter struct {
+	t *testing.T
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.t.Fatalf("unexpected log message %q", p)
+	return len(p), nil
+}
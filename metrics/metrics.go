@@ -0,0 +1,270 @@
+// Package metrics exposes the health of CRDT replicas to Prometheus.
+//
+// A `Collector` is set as the `crdt.Replica.Metrics` of the replicas, so it receives the operation counters
+// (e.g. `lww.set.add`, `lww.set.remove`, `lww.graph.merge`) and the durations of merges.
+// The sizes of the watched sets and graphs (elements, vertices, edges and tombstones) are computed
+// when the metrics are scraped. The collector serves the metrics in the Prometheus text format:
+//
+//	collector := metrics.NewCollector("crdt")
+//	replica := crdt.NewReplica("A")
+//	replica.Metrics = collector
+//	g := lww.NewGraph(replica)
+//	collector.WatchGraph("graph", g)
+//	http.Handle("/metrics", collector)
+//
+// Counters are exposed as `<namespace>_<name>_total`, durations as `<namespace>_<name>_seconds` histograms,
+// the dots of the names are replaced by underscores, e.g. `crdt_lww_graph_merge_duration_seconds`.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rdner/crdt/lww"
+)
+
+// ContentType is the content type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds of the duration histogram buckets in seconds
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// NewCollector creates a collector of metrics named with the given namespace prefix, e.g. `crdt`
+func NewCollector(namespace string) Collector {
+	return Collector{
+		mutex:      &sync.Mutex{},
+		namespace:  namespace,
+		counters:   make(map[string]int64),
+		histograms: make(map[string]*histogram),
+		sets:       make(map[string]lww.Set),
+		graphs:     make(map[string]lww.Graph),
+	}
+}
+
+// Collector implements `crdt.Metrics` and `crdt.DurationMetrics` and serves the collected metrics
+// along with the sizes of the watched CRDTs to Prometheus.
+// Use `NewCollector` in order to initialize it before use.
+// The collector is thread-safe and can be used from several go routines.
+type Collector struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// namespace is the prefix of all the metric names
+	namespace string
+	// counters maps a counter name to its value
+	counters map[string]int64
+	// histograms maps a duration name to its histogram
+	histograms map[string]*histogram
+	// sets maps a name to the watched set
+	sets map[string]lww.Set
+	// graphs maps a name to the watched graph
+	graphs map[string]lww.Graph
+}
+
+// histogram counts observations in buckets
+type histogram struct {
+	// counts are the numbers of observations in every bucket of `DefaultBuckets` and the last `+Inf` bucket,
+	// they are not cumulative
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+// Count implements the `crdt.Metrics` interface
+func (c Collector) Count(name string, delta int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.counters[name] += delta
+}
+
+// ObserveDuration implements the `crdt.DurationMetrics` interface
+func (c Collector) ObserveDuration(name string, d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	h, exists := c.histograms[name]
+	if !exists {
+		h = &histogram{counts: make([]int64, len(DefaultBuckets)+1)}
+		c.histograms[name] = h
+	}
+
+	seconds := d.Seconds()
+	bucket := sort.SearchFloat64s(DefaultBuckets, seconds)
+	h.counts[bucket]++
+	h.sum += seconds
+	h.count++
+}
+
+// WatchSet exposes the size of the set under the given name
+func (c Collector) WatchSet(name string, s lww.Set) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.sets[name] = s
+}
+
+// WatchGraph exposes the size of the graph under the given name
+func (c Collector) WatchGraph(name string, g lww.Graph) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.graphs[name] = g
+}
+
+// ServeHTTP implements the `http.Handler` interface serving the metrics in the Prometheus text format
+func (c Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo writes all the metrics in the Prometheus text format, it implements the `io.WriterTo` interface
+func (c Collector) WriteTo(w io.Writer) (n int64, err error) {
+	c.mutex.Lock()
+	counters := make(map[string]int64, len(c.counters))
+	for name, value := range c.counters {
+		counters[name] = value
+	}
+	histograms := make(map[string]histogram, len(c.histograms))
+	for name, h := range c.histograms {
+		histograms[name] = histogram{counts: append([]int64(nil), h.counts...), sum: h.sum, count: h.count}
+	}
+	sets := make(map[string]lww.Set, len(c.sets))
+	for name, s := range c.sets {
+		sets[name] = s
+	}
+	graphs := make(map[string]lww.Graph, len(c.graphs))
+	for name, g := range c.graphs {
+		graphs[name] = g
+	}
+	c.mutex.Unlock()
+
+	counting := &countingWriter{w: w}
+	buf := bufio.NewWriter(counting)
+
+	for _, name := range sortedKeys(counters) {
+		metric := c.metricName(name) + "_total"
+		fmt.Fprintf(buf, "# HELP %s Number of %q operations.\n", metric, name)
+		fmt.Fprintf(buf, "# TYPE %s counter\n", metric)
+		fmt.Fprintf(buf, "%s %d\n", metric, counters[name])
+	}
+
+	histogramNames := make([]string, 0, len(histograms))
+	for name := range histograms {
+		histogramNames = append(histogramNames, name)
+	}
+	sort.Strings(histogramNames)
+	for _, name := range histogramNames {
+		h := histograms[name]
+		metric := c.metricName(name) + "_seconds"
+		fmt.Fprintf(buf, "# HELP %s Duration of %q operations.\n", metric, name)
+		fmt.Fprintf(buf, "# TYPE %s histogram\n", metric)
+		var cumulative int64
+		for i, bound := range DefaultBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(buf, "%s_bucket{le=%q} %d\n", metric, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(buf, "%s_bucket{le=\"+Inf\"} %d\n", metric, h.count)
+		fmt.Fprintf(buf, "%s_sum %s\n", metric, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(buf, "%s_count %d\n", metric, h.count)
+	}
+
+	setNames := make([]string, 0, len(sets))
+	for name := range sets {
+		setNames = append(setNames, name)
+	}
+	sort.Strings(setNames)
+	setSizes := make([]lww.SetSize, 0, len(setNames))
+	for _, name := range setNames {
+		setSizes = append(setSizes, sets[name].Size())
+	}
+	c.writeGauge(buf, "set_elements", "Number of elements in the set.", "set", setNames, func(i int) int {
+		return setSizes[i].Elements
+	})
+	c.writeGauge(buf, "set_tombstones", "Number of removal records kept by the set.", "set", setNames, func(i int) int {
+		return setSizes[i].Tombstones
+	})
+
+	graphNames := make([]string, 0, len(graphs))
+	for name := range graphs {
+		graphNames = append(graphNames, name)
+	}
+	sort.Strings(graphNames)
+	graphSizes := make([]lww.GraphSize, 0, len(graphNames))
+	for _, name := range graphNames {
+		graphSizes = append(graphSizes, graphs[name].Size())
+	}
+	c.writeGauge(buf, "graph_vertices", "Number of vertices in the graph.", "graph", graphNames, func(i int) int {
+		return graphSizes[i].Vertices
+	})
+	c.writeGauge(buf, "graph_edges", "Number of edges in the graph.", "graph", graphNames, func(i int) int {
+		return graphSizes[i].Edges
+	})
+	c.writeGauge(buf, "graph_tombstones", "Number of removal records kept by the graph.", "graph", graphNames, func(i int) int {
+		return graphSizes[i].Tombstones
+	})
+
+	err = buf.Flush()
+	return counting.n, err
+}
+
+// writeGauge writes a gauge with a value for every name labeled by `label`, nothing is written without names
+func (c Collector) writeGauge(w io.Writer, name, help, label string, names []string, value func(i int) int) {
+	if len(names) == 0 {
+		return
+	}
+	metric := c.metricName(name)
+	fmt.Fprintf(w, "# HELP %s %s\n", metric, help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", metric)
+	for i, labelValue := range names {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", metric, label, escapeLabel(labelValue), value(i))
+	}
+}
+
+// metricName returns the Prometheus name of the metric with the collector namespace
+func (c Collector) metricName(name string) string {
+	if c.namespace != "" {
+		name = c.namespace + "_" + name
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// escapeLabel escapes the label value for the Prometheus text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// sortedKeys returns the keys of the counters in the ascending order
+func sortedKeys(counters map[string]int64) []string {
+	keys := make([]string, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countingWriter counts the bytes written to `w`
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements the `io.Writer` interface
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector("crdt")
+	replica := crdt.NewReplica("A")
+	replica.Metrics = collector
+
+	s := lww.NewSet(replica)
+	s.Add(lww.IDElement("a"))
+	s.Add(lww.IDElement("b"))
+	s.Remove("b")
+	collector.WatchSet("ids", s)
+
+	g := lww.NewGraph(replica)
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v1"}))
+	require.NoError(t, g.AddVertex(lww.Vertex{Key: "v2"}))
+	require.NoError(t, g.AddEdge("v1", "v2"))
+	g.Merge(lww.NewGraph(crdt.NewReplica("B")))
+	collector.WatchGraph(`graph "main"`, g)
+
+	collector.ObserveDuration("test.duration", 20*time.Millisecond)
+	collector.ObserveDuration("test.duration", time.Minute)
+
+	recorder := httptest.NewRecorder()
+	collector.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, ContentType, recorder.Header().Get("Content-Type"))
+	body := recorder.Body.String()
+
+	for _, line := range []string{
+		"# TYPE crdt_lww_set_add_total counter",
+		"crdt_lww_set_remove_total 1",
+		"crdt_lww_graph_merge_total 1",
+		"# TYPE crdt_lww_graph_merge_duration_seconds histogram",
+		"crdt_lww_graph_merge_duration_seconds_count 1",
+		`crdt_test_duration_seconds_bucket{le="0.01"} 0`,
+		`crdt_test_duration_seconds_bucket{le="0.05"} 1`,
+		`crdt_test_duration_seconds_bucket{le="10"} 1`,
+		`crdt_test_duration_seconds_bucket{le="+Inf"} 2`,
+		"crdt_test_duration_seconds_sum 60.02",
+		`crdt_set_elements{set="ids"} 1`,
+		`crdt_set_tombstones{set="ids"} 1`,
+		`crdt_graph_vertices{graph="graph \"main\""} 2`,
+		`crdt_graph_edges{graph="graph \"main\""} 1`,
+		`crdt_graph_tombstones{graph="graph \"main\""} 0`,
+	} {
+		require.Contains(t, strings.Split(body, "\n"), line)
+	}
+
+	var out strings.Builder
+	n, err := collector.WriteTo(&out)
+	require.NoError(t, err)
+	require.Equal(t, int64(out.Len()), n)
+}
@@ -0,0 +1,83 @@
+package crdt
+
+import (
+	"time"
+)
+
+// Source is where a mutation comes from
+type Source int
+
+const (
+	// SourceLocal is a local operation of the replica
+	SourceLocal Source = iota
+	// SourceMerge is an operation of another replica applied by merging its state
+	SourceMerge
+)
+
+// String returns the name of the source
+func (s Source) String() string {
+	switch s {
+	case SourceLocal:
+		return "local"
+	case SourceMerge:
+		return "merge"
+	default:
+		return "unknown"
+	}
+}
+
+// Mutation is an operation applied to the state of a CRDT
+type Mutation struct {
+	// Kind is the kind of the mutated CRDT
+	Kind Kind
+	// Key is the key of the element, for graph edges it's the key of the vertex the edge starts from
+	Key string
+	// AdjacentKey is the key of the vertex the edge points to, empty for anything but graph edges
+	AdjacentKey string
+	// Removal is `true` if the operation is a removal, `false` if it's an addition
+	Removal bool
+	// Replica is the ID of the replica that performed the operation
+	Replica string
+	// Timestamp is when the operation happened
+	Timestamp time.Time
+	// Source tells if the operation is local or merged from another replica
+	Source Source
+}
+
+// Observer is notified about every mutation applied to the state of a CRDT, e.g. for audit logging,
+// metrics or cache invalidation. Merged operations are reported only when they overwrite the local state,
+// operations losing to newer local ones are not applied and not reported.
+type Observer interface {
+	// Observe is called under the lock of the mutated CRDT after the mutation is applied and must not block
+	// or call the methods of the CRDT
+	Observe(m Mutation)
+}
+
+// ObserverFunc is a function implementing the `Observer` interface
+type ObserverFunc func(m Mutation)
+
+// Observe implements the `Observer` interface
+func (f ObserverFunc) Observe(m Mutation) {
+	f(m)
+}
+
+// Observers returns an observer notifying all the given observers in order
+func Observers(observers ...Observer) Observer {
+	return multiObserver(observers)
+}
+
+// multiObserver notifies several observers in order
+type multiObserver []Observer
+
+// Observe implements the `Observer` interface
+func (o multiObserver) Observe(m Mutation) {
+	for _, observer := range o {
+		observer.Observe(m)
+	}
+}
+
+// nopObserver is an `Observer` that ignores all the mutations
+type nopObserver struct{}
+
+// Observe implements the `Observer` interface
+func (nopObserver) Observe(m Mutation) {}
@@ -0,0 +1,23 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObservers(t *testing.T) {
+	var first, second []Mutation
+	o := Observers(
+		ObserverFunc(func(m Mutation) { first = append(first, m) }),
+		ObserverFunc(func(m Mutation) { second = append(second, m) }),
+	)
+
+	m := Mutation{Kind: "test", Key: "k1", Replica: "A", Source: SourceMerge}
+	o.Observe(m)
+
+	require.Equal(t, []Mutation{m}, first)
+	require.Equal(t, []Mutation{m}, second)
+	require.Equal(t, "local", SourceLocal.String())
+	require.Equal(t, "merge", SourceMerge.String())
+}
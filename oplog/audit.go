@@ -0,0 +1,235 @@
+package oplog
+
+import (
+	"crypto/sha1" // nolint:gosec // used only for deriving name-based UUIDs
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// OpenLineageSchemaURL is the version of the OpenLineage run event schema produced by `WriteOpenLineage`
+	OpenLineageSchemaURL = "https://openlineage.io/spec/1-0-5/OpenLineage.json#/definitions/RunEvent"
+	// DefaultProducer is the producer of the exported events if `AuditConfig.Producer` is not set
+	DefaultProducer = "https://github.com/rdner/crdt"
+)
+
+// AuditConfig configures the export of operations into audit and lineage events
+type AuditConfig struct {
+	// Namespace of the exported entities, e.g. the name of the graph or the service, required for OpenLineage
+	Namespace string
+	// Producer is the URI of the application producing the events, `DefaultProducer` is used if it's empty
+	Producer string
+}
+
+// AuditEvent is a flat audit record of an operation for audit pipelines and SIEM systems
+type AuditEvent struct {
+	// ID uniquely identifies the event, it's derived from the replica and the sequence number of the operation,
+	// so exporting the same log again produces the same IDs and consumers can deduplicate the events
+	ID string `json:"id"`
+	// Time is when the operation happened
+	Time time.Time `json:"time"`
+	// Actor is the end user who made the change or the replica itself if the actor is not recorded
+	Actor string `json:"actor"`
+	// Replica is the ID of the replica that applied the operation
+	Replica string `json:"replica"`
+	// Action is the type of the operation
+	Action OpType `json:"action"`
+	// Namespace is the namespace of the entity
+	Namespace string `json:"namespace,omitempty"`
+	// Entity is the changed entity: the vertex key, `from->to` for edges or the merged replica ID for merges
+	Entity string `json:"entity"`
+	// Details are the operation parameters that are not part of the entity, e.g. the vertex value
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// AuditEvents maps the operations to audit events in the same order
+func AuditEvents(ops []Op, config AuditConfig) []AuditEvent {
+	events := make([]AuditEvent, 0, len(ops))
+	for _, op := range ops {
+		actor := op.Actor
+		if actor == "" {
+			actor = op.Replica
+		}
+		events = append(events, AuditEvent{
+			ID:        eventID(op),
+			Time:      op.Time,
+			Actor:     actor,
+			Replica:   op.Replica,
+			Action:    op.Type,
+			Namespace: config.Namespace,
+			Entity:    entity(op),
+			Details:   details(op),
+		})
+	}
+	return events
+}
+
+// WriteAudit writes the operations as audit events encoded as JSON lines
+func WriteAudit(w io.Writer, ops []Op, config AuditConfig) error {
+	encoder := json.NewEncoder(w)
+	for _, e := range AuditEvents(ops, config) {
+		err := encoder.Encode(e)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write the audit event %q", e.ID)
+		}
+	}
+	return nil
+}
+
+// OpenLineageEvent is a `COMPLETE` run event of the OpenLineage specification, see https://openlineage.io
+type OpenLineageEvent struct {
+	EventType string             `json:"eventType"`
+	EventTime time.Time          `json:"eventTime"`
+	Run       OpenLineageRun     `json:"run"`
+	Job       OpenLineageJob     `json:"job"`
+	Inputs    []OpenLineageEntry `json:"inputs"`
+	Outputs   []OpenLineageEntry `json:"outputs"`
+	Producer  string             `json:"producer"`
+	SchemaURL string             `json:"schemaURL"`
+}
+
+// OpenLineageRun is the run of an OpenLineage event, every operation is a separate run
+type OpenLineageRun struct {
+	// RunID is a UUID derived from the replica and the sequence number of the operation
+	RunID  string                 `json:"runId"`
+	Facets map[string]interface{} `json:"facets,omitempty"`
+}
+
+// OpenLineageJob is the job of an OpenLineage event, it's the operation type on the replica
+type OpenLineageJob struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// OpenLineageEntry is an input or output dataset of an OpenLineage event, it's the changed entity
+type OpenLineageEntry struct {
+	Namespace string                 `json:"namespace"`
+	Name      string                 `json:"name"`
+	Facets    map[string]interface{} `json:"facets,omitempty"`
+}
+
+// OpenLineageEvents maps the operations to OpenLineage run events in the same order.
+// The job of every event is named `<replica>.<operation type>`, the changed entity is its output,
+// merges have the merged replica as their input. The actor, the replica and the sequence number
+// are recorded in the custom `crdt` run facet.
+//
+// Returns an error if `config.Namespace` is not set, it's required by the specification.
+func OpenLineageEvents(ops []Op, config AuditConfig) ([]OpenLineageEvent, error) {
+	if config.Namespace == "" {
+		return nil, errors.New("the namespace is required for OpenLineage events")
+	}
+	producer := config.Producer
+	if producer == "" {
+		producer = DefaultProducer
+	}
+
+	events := make([]OpenLineageEvent, 0, len(ops))
+	for _, e := range AuditEvents(ops, config) {
+		facet := map[string]interface{}{
+			"_producer":  producer,
+			"_schemaURL": producer + "#/crdt",
+			"actor":      e.Actor,
+			"replica":    e.Replica,
+			"action":     string(e.Action),
+		}
+		for name, value := range e.Details {
+			facet[name] = value
+		}
+
+		event := OpenLineageEvent{
+			EventType: "COMPLETE",
+			EventTime: e.Time,
+			Run: OpenLineageRun{
+				RunID:  e.ID,
+				Facets: map[string]interface{}{"crdt": facet},
+			},
+			Job: OpenLineageJob{
+				Namespace: config.Namespace,
+				Name:      e.Replica + "." + string(e.Action),
+			},
+			Inputs:    []OpenLineageEntry{},
+			Outputs:   []OpenLineageEntry{},
+			Producer:  producer,
+			SchemaURL: OpenLineageSchemaURL,
+		}
+		if e.Action == Merge {
+			event.Inputs = append(event.Inputs, OpenLineageEntry{Namespace: config.Namespace, Name: e.Entity})
+			event.Outputs = append(event.Outputs, OpenLineageEntry{Namespace: config.Namespace, Name: e.Replica})
+		} else {
+			event.Outputs = append(event.Outputs, OpenLineageEntry{Namespace: config.Namespace, Name: e.Entity})
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// WriteOpenLineage writes the operations as OpenLineage run events encoded as JSON lines,
+// see `OpenLineageEvents`
+func WriteOpenLineage(w io.Writer, ops []Op, config AuditConfig) error {
+	events, err := OpenLineageEvents(ops, config)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for _, e := range events {
+		err = encoder.Encode(e)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write the OpenLineage event %q", e.Run.RunID)
+		}
+	}
+	return nil
+}
+
+// entity returns the entity changed by the operation
+func entity(op Op) string {
+	switch op.Type {
+	case AddEdge, RemoveEdge, AddEdgeWeight, AddWeightedEdge, UpdateEdgeWeight, UpdateEdgeAttributes, AddEdgeAcyclic:
+		return op.From + "->" + op.To
+	case AddVertices, AddEdges, Update:
+		entities := make([]string, 0, len(op.Batch))
+		for _, batchOp := range op.Batch {
+			entities = append(entities, entity(batchOp))
+		}
+		return strings.Join(entities, ",")
+	case Merge:
+		return op.Source
+	default:
+		return op.Key
+	}
+}
+
+// details returns the parameters of the operation that are not part of the entity
+func details(op Op) map[string]string {
+	switch op.Type {
+	case AddVertex, UpdateVertex, UpsertVertex, CompareAndAddVertex:
+		return map[string]string{"value": op.Value}
+	case AddWeightedEdge:
+		return map[string]string{"weight": strconv.FormatInt(op.Weight, 10), "label": op.Label}
+	case UpdateEdgeWeight:
+		return map[string]string{"weight": strconv.FormatInt(op.Weight, 10)}
+	case AddVertices, AddEdges, Update:
+		return map[string]string{"operations": strconv.Itoa(len(op.Batch))}
+	case AddEdgeWeight:
+		return map[string]string{"delta": strconv.FormatInt(op.Delta, 10)}
+	case Merge:
+		return map[string]string{"sourceSeq": strconv.Itoa(op.SourceSeq)}
+	default:
+		return nil
+	}
+}
+
+// eventID returns a name-based (version 5) UUID of the operation
+func eventID(op Op) string {
+	// nolint:gosec // the hash identifies the operation, it's not used for security
+	sum := sha1.Sum([]byte(op.Replica + "\x00" + strconv.Itoa(op.Seq)))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
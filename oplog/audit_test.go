@@ -0,0 +1,76 @@
+package oplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	at := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	ops := []Op{
+		{Replica: "A", Seq: 1, Time: at, Type: AddVertex, Actor: "alice", Key: "v1", Value: "a"},
+		{Replica: "A", Seq: 2, Time: at, Type: AddEdge, From: "v1", To: "v2"},
+		{Replica: "A", Seq: 3, Time: at, Type: Merge, Source: "B", SourceSeq: 7},
+	}
+
+	t.Run("maps operations to audit events", func(t *testing.T) {
+		events := AuditEvents(ops, AuditConfig{Namespace: "graph"})
+		require.Len(t, events, 3)
+
+		require.Equal(t, "alice", events[0].Actor)
+		require.Equal(t, "v1", events[0].Entity)
+		require.Equal(t, map[string]string{"value": "a"}, events[0].Details)
+		require.Equal(t, "A", events[1].Actor, "the replica is the actor if it's not recorded")
+		require.Equal(t, "v1->v2", events[1].Entity)
+		require.Equal(t, "B", events[2].Entity)
+		require.Equal(t, "graph", events[2].Namespace)
+
+		require.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, events[0].ID)
+		require.NotEqual(t, events[0].ID, events[1].ID)
+		require.Equal(t, events, AuditEvents(ops, AuditConfig{Namespace: "graph"}), "IDs are stable")
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteAudit(&buf, ops, AuditConfig{}))
+		require.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("\n")))
+	})
+
+	t.Run("maps batches to a single event of all their entities", func(t *testing.T) {
+		events := AuditEvents([]Op{{Replica: "A", Seq: 1, Time: at, Type: Update, Batch: []Op{
+			{Type: AddVertex, Key: "v1"},
+			{Type: AddWeightedEdge, From: "v1", To: "v2", Weight: 2},
+		}}}, AuditConfig{})
+		require.Len(t, events, 1)
+		require.Equal(t, "v1,v1->v2", events[0].Entity)
+		require.Equal(t, map[string]string{"operations": "2"}, events[0].Details)
+	})
+
+	t.Run("maps operations to OpenLineage events", func(t *testing.T) {
+		_, err := OpenLineageEvents(ops, AuditConfig{})
+		require.Error(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteOpenLineage(&buf, ops, AuditConfig{Namespace: "graph"}))
+
+		var events []OpenLineageEvent
+		decoder := json.NewDecoder(&buf)
+		for decoder.More() {
+			var e OpenLineageEvent
+			require.NoError(t, decoder.Decode(&e))
+			events = append(events, e)
+		}
+		require.Len(t, events, 3)
+
+		require.Equal(t, "COMPLETE", events[0].EventType)
+		require.Equal(t, OpenLineageJob{Namespace: "graph", Name: "A.addVertex"}, events[0].Job)
+		require.Equal(t, []OpenLineageEntry{{Namespace: "graph", Name: "v1"}}, events[0].Outputs)
+		require.Equal(t, "alice", events[0].Run.Facets["crdt"].(map[string]interface{})["actor"])
+		require.Equal(t, DefaultProducer, events[0].Producer)
+
+		require.Equal(t, []OpenLineageEntry{{Namespace: "graph", Name: "B"}}, events[2].Inputs)
+		require.Equal(t, []OpenLineageEntry{{Namespace: "graph", Name: "A"}}, events[2].Outputs)
+	})
+}
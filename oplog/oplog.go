@@ -0,0 +1,206 @@
+// Package oplog defines a log of graph operations recorded by replicas
+// and replays such logs deterministically for debugging divergence.
+//
+// Every replica records its own log, one JSON object per line, for example:
+//
+//	{"replica":"A","seq":1,"time":"2021-09-01T10:00:00Z","op":"addVertex","key":"v1","value":"a"}
+//	{"replica":"A","seq":2,"time":"2021-09-01T10:00:01Z","op":"addEdge","from":"v1","to":"v2"}
+//	{"replica":"A","seq":3,"time":"2021-09-01T10:00:02Z","op":"merge","source":"B","sourceSeq":7}
+//
+// `seq` numbers the operations of a replica starting from 1, `time` is the timestamp
+// the replica clock produced for the operation. The `merge` operation records that the replica
+// merged the state of the `source` replica right after the source applied its operation `sourceSeq`.
+// The optional `actor` is the end user who made the change on a replica shared by many users (see `crdt.WithActor`).
+//
+// Replaying the logs with the recorded timestamps into fresh replicas reproduces the recorded
+// states exactly, so bugs in custom element types or clock misconfiguration can be pinpointed
+// with `Bisect`.
+package oplog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/lww"
+)
+
+// OpType is a type of a recorded operation
+type OpType string
+
+const (
+	// AddVertex is `Graph.AddVertex` with `Key` and `Value`
+	AddVertex OpType = "addVertex"
+	// RemoveVertex is `Graph.RemoveVertex` with `Key`
+	RemoveVertex OpType = "removeVertex"
+	// AddEdge is `Graph.AddEdge` with `From` and `To`
+	AddEdge OpType = "addEdge"
+	// RemoveEdge is `Graph.RemoveEdge` with `From` and `To`
+	RemoveEdge OpType = "removeEdge"
+	// AddEdgeWeight is `Graph.AddEdgeWeight` with `From`, `To` and `Delta`
+	AddEdgeWeight OpType = "addEdgeWeight"
+	// UpdateVertex is `Graph.UpdateVertex` with `Key` and `Value`
+	UpdateVertex OpType = "updateVertex"
+	// UpsertVertex is `Graph.UpsertVertex` with `Key` and `Value`
+	UpsertVertex OpType = "upsertVertex"
+	// AddWeightedEdge is `Graph.AddWeightedEdge` with `From`, `To`, `Weight`, `Label` and `Attributes`
+	AddWeightedEdge OpType = "addWeightedEdge"
+	// UpdateEdgeWeight is `Graph.UpdateEdgeWeight` with `From`, `To` and `Weight`
+	UpdateEdgeWeight OpType = "updateEdgeWeight"
+	// UpdateEdgeAttributes is `Graph.UpdateEdgeAttributes` with `From`, `To` and `Attributes`
+	UpdateEdgeAttributes OpType = "updateEdgeAttributes"
+	// AddEdgeAcyclic is `Graph.AddEdgeAcyclic` with `From` and `To`
+	AddEdgeAcyclic OpType = "addEdgeAcyclic"
+	// CompareAndAddVertex is `Graph.CompareAndAddVertex` with `Key`, `Value` and `Observed`
+	CompareAndAddVertex OpType = "compareAndAddVertex"
+	// CompareAndRemoveVertex is `Graph.CompareAndRemoveVertex` with `Key` and `Observed`
+	CompareAndRemoveVertex OpType = "compareAndRemoveVertex"
+	// AddVertices is `Graph.AddVertices` with the `AddVertex` operations of the `Batch`
+	AddVertices OpType = "addVertices"
+	// AddEdges is `Graph.AddEdges` with the `AddWeightedEdge` operations of the `Batch`
+	AddEdges OpType = "addEdges"
+	// Update is a `Graph.Update` transaction with the `Batch` of operations made in the transaction:
+	// `AddVertex`, `UpdateVertex`, `RemoveVertex`, `AddEdge`, `AddWeightedEdge` and `RemoveEdge`
+	Update OpType = "update"
+	// Merge is `Graph.Merge` of the `Source` replica state after its operation `SourceSeq`
+	Merge OpType = "merge"
+)
+
+var (
+	// ErrInvalidLog occurs when a log cannot be replayed
+	ErrInvalidLog = errors.New("invalid operation log")
+)
+
+// Op is a single recorded operation
+type Op struct {
+	// Replica is the ID of the replica that applied the operation
+	Replica string `json:"replica"`
+	// Seq is the sequence number of the operation in the replica log starting from 1
+	Seq int `json:"seq"`
+	// Time is the timestamp the replica clock produced for the operation
+	Time time.Time `json:"time"`
+	// Type is the type of the operation
+	Type OpType `json:"op"`
+	// Actor is the identity of the end user who made the change, empty if it's the replica itself
+	Actor string `json:"actor,omitempty"`
+
+	// Key is the vertex key for vertex operations
+	Key string `json:"key,omitempty"`
+	// Value is the vertex value for the operations writing a vertex
+	Value string `json:"value,omitempty"`
+	// From is the key of the vertex the edge starts from for edge operations
+	From string `json:"from,omitempty"`
+	// To is the key of the vertex the edge points to for edge operations
+	To string `json:"to,omitempty"`
+	// Delta is the weight delta for `AddEdgeWeight`
+	Delta int64 `json:"delta,omitempty"`
+	// Weight is the edge weight for `AddWeightedEdge` and `UpdateEdgeWeight`
+	Weight int64 `json:"weight,omitempty"`
+	// Label is the edge label for `AddWeightedEdge`
+	Label string `json:"label,omitempty"`
+	// Attributes are the edge attributes for `AddWeightedEdge` and `UpdateEdgeAttributes`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Observed is the observed version of the vertex for the conditional operations
+	Observed *lww.Version `json:"observed,omitempty"`
+	// Batch contains the operations applied atomically by `AddVertices`, `AddEdges` and `Update`,
+	// only their types and parameters are set
+	Batch []Op `json:"batch,omitempty"`
+	// Source is the ID of the merged replica for `Merge`
+	Source string `json:"source,omitempty"`
+	// SourceSeq is the sequence number of the last operation of the merged replica for `Merge`
+	SourceSeq int `json:"sourceSeq,omitempty"`
+}
+
+// Read reads the log of operations encoded as JSON lines.
+// Empty lines are skipped.
+func Read(r io.Reader) (ops []Op, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var op Op
+		err = json.Unmarshal(scanner.Bytes(), &op)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidLog, "line %d: %s", line, err)
+		}
+		ops = append(ops, op)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read the log")
+	}
+
+	return ops, nil
+}
+
+// Schedule combines the logs of all the replicas into a single replay order.
+//
+// Operations of every replica keep their sequence order, operations of different replicas
+// are ordered by the recorded timestamps. A merge is scheduled only after the source replica
+// has applied the operation `SourceSeq`, even if the clocks of the replicas are skewed.
+//
+// Returns an error with `ErrInvalidLog` cause if the sequence numbers of a replica are not
+// consecutive or a merge refers to an operation which never happens before it.
+func Schedule(logs ...[]Op) (schedule []Op, err error) {
+	queues := make(map[string][]Op)
+	for _, log := range logs {
+		for _, op := range log {
+			queues[op.Replica] = append(queues[op.Replica], op)
+		}
+	}
+
+	replicas := make([]string, 0, len(queues))
+	total := 0
+	for replica, queue := range queues {
+		sort.SliceStable(queue, func(i, j int) bool {
+			return queue[i].Seq < queue[j].Seq
+		})
+		for i, op := range queue {
+			if op.Seq != i+1 {
+				return nil, errors.Wrapf(ErrInvalidLog, "replica %q: expected operation %d, got %d", replica, i+1, op.Seq)
+			}
+		}
+		replicas = append(replicas, replica)
+		total += len(queue)
+	}
+	sort.Strings(replicas)
+
+	applied := make(map[string]int, len(queues))
+	schedule = make([]Op, 0, total)
+
+	for len(schedule) < total {
+		next := ""
+		for _, replica := range replicas {
+			queue := queues[replica]
+			if len(queue) == 0 {
+				continue
+			}
+			head := queue[0]
+			if head.Type == Merge && applied[head.Source] < head.SourceSeq {
+				continue
+			}
+			if next == "" || head.Time.Before(queues[next][0].Time) {
+				next = replica
+			}
+		}
+
+		if next == "" {
+			return nil, errors.Wrapf(ErrInvalidLog, "merges wait for operations that never happen")
+		}
+
+		schedule = append(schedule, queues[next][0])
+		queues[next] = queues[next][1:]
+		applied[next]++
+	}
+
+	return schedule, nil
+}
@@ -0,0 +1,150 @@
+package oplog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpLog(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return base.Add(time.Duration(seconds) * time.Second)
+	}
+
+	logA := []Op{
+		{Replica: "A", Seq: 1, Time: at(0), Type: AddVertex, Key: "v1", Value: "a"},
+		{Replica: "A", Seq: 2, Time: at(2), Type: AddVertex, Key: "v2", Value: "b"},
+		{Replica: "A", Seq: 3, Time: at(3), Type: AddEdge, From: "v1", To: "v2"},
+		// B's clock is behind, the merge is recorded earlier than B's operations
+		{Replica: "A", Seq: 4, Time: at(4), Type: Merge, Source: "B", SourceSeq: 2},
+	}
+	logB := []Op{
+		{Replica: "B", Seq: 1, Time: at(1), Type: Merge, Source: "A", SourceSeq: 1},
+		{Replica: "B", Seq: 2, Time: at(5), Type: RemoveVertex, Key: "v1"},
+		{Replica: "B", Seq: 3, Time: at(6), Type: AddVertex, Key: "v3", Value: "c"},
+	}
+
+	t.Run("Read reads JSON lines", func(t *testing.T) {
+		ops, err := Read(strings.NewReader(`{"replica":"A","seq":1,"time":"2021-09-01T10:00:00Z","op":"addVertex","key":"v1","value":"a"}
+
+{"replica":"A","seq":2,"time":"2021-09-01T10:00:02Z","op":"addVertex","key":"v2","value":"b"}`))
+		require.NoError(t, err)
+		require.Equal(t, logA[:2], ops)
+
+		_, err = Read(strings.NewReader(`{"replica":`))
+		require.ErrorIs(t, err, ErrInvalidLog)
+	})
+
+	t.Run("Schedule orders by time but waits for merge sources", func(t *testing.T) {
+		schedule, err := Schedule(logB, logA)
+		require.NoError(t, err)
+
+		var order []string
+		for _, op := range schedule {
+			order = append(order, op.Replica+string(rune('0'+op.Seq)))
+		}
+		require.Equal(t, []string{"A1", "B1", "A2", "A3", "B2", "A4", "B3"}, order)
+	})
+
+	t.Run("Schedule returns ErrInvalidLog for broken logs", func(t *testing.T) {
+		_, err := Schedule([]Op{{Replica: "A", Seq: 2, Type: AddVertex}})
+		require.ErrorIs(t, err, ErrInvalidLog)
+
+		_, err = Schedule([]Op{{Replica: "A", Seq: 1, Type: Merge, Source: "B", SourceSeq: 1}})
+		require.ErrorIs(t, err, ErrInvalidLog)
+	})
+
+	t.Run("Replay reproduces the recorded states", func(t *testing.T) {
+		schedule, err := Schedule(logA, logB)
+		require.NoError(t, err)
+
+		replicas, err := Replay(schedule)
+		require.NoError(t, err)
+		require.Len(t, replicas, 2)
+
+		listA, err := replicas["A"].List()
+		require.NoError(t, err)
+		require.Equal(t, []lww.VertexWithEdges{
+			{Vertex: lww.Vertex{Key: "v2", Value: "b"}, AdjacentKeys: []string{}},
+		}, listA, "A merged B's removal of v1 but not the later addition of v3")
+
+		converged, _, _, err := Converges(replicas)
+		require.NoError(t, err)
+		require.True(t, converged)
+
+		index, err := Bisect(schedule)
+		require.NoError(t, err)
+		require.Equal(t, -1, index)
+	})
+
+	t.Run("replicas writing at exactly the same time converge", func(t *testing.T) {
+		// both replicas add the same vertex with different values at exactly the same time,
+		// the greater replica ID wins on every replica
+		schedule, err := Schedule(
+			[]Op{{Replica: "A", Seq: 1, Time: at(0), Type: AddVertex, Key: "v1", Value: "a"}},
+			[]Op{{Replica: "B", Seq: 1, Time: at(0), Type: AddVertex, Key: "v1", Value: "b"}},
+		)
+		require.NoError(t, err)
+
+		index, err := Bisect(schedule)
+		require.NoError(t, err)
+		require.Equal(t, -1, index)
+
+		replicas, err := Replay(schedule)
+		require.NoError(t, err)
+		converged, _, _, err := Converges(replicas)
+		require.NoError(t, err)
+		require.True(t, converged)
+	})
+
+	t.Run("Bisect finds the operation introducing divergence", func(t *testing.T) {
+		// A's clock goes back and A re-adds the removed vertex with the timestamp of its first addition,
+		// B has already merged the first addition, so the last-writer-wins merge keeps a different value on each replica
+		schedule, err := Schedule(
+			[]Op{
+				{Replica: "A", Seq: 1, Time: at(0), Type: AddVertex, Key: "v1", Value: "a"},
+				{Replica: "A", Seq: 2, Time: at(2), Type: RemoveVertex, Key: "v1"},
+				{Replica: "A", Seq: 3, Time: at(0), Type: AddVertex, Key: "v1", Value: "c"},
+			},
+			[]Op{
+				{Replica: "B", Seq: 1, Time: at(1), Type: Merge, Source: "A", SourceSeq: 1},
+			},
+		)
+		require.NoError(t, err)
+
+		index, err := Bisect(schedule)
+		require.NoError(t, err)
+		require.Equal(t, Op{Replica: "A", Seq: 3, Time: at(0), Type: AddVertex, Key: "v1", Value: "c"}, schedule[index])
+
+		replicas, err := Replay(schedule)
+		require.NoError(t, err)
+		converged, ids, states, err := Converges(replicas)
+		require.NoError(t, err)
+		require.False(t, converged)
+		require.Equal(t, []string{"A", "B"}, ids)
+		require.Len(t, states, 2)
+	})
+
+	t.Run("Apply applies operations and rejects merges", func(t *testing.T) {
+		g := lww.NewGraph(crdt.NewReplica("A"))
+		require.NoError(t, Apply(g, logA[0]))
+		require.NoError(t, Apply(g, logA[1]))
+		require.NoError(t, Apply(g, logA[2]))
+		require.ErrorIs(t, Apply(g, logA[0]), lww.ErrVertexAlreadyExists)
+		require.ErrorIs(t, Apply(g, logA[3]), ErrInvalidLog)
+
+		connected, err := g.FindConnected("v1")
+		require.NoError(t, err)
+		require.Equal(t, []lww.Vertex{{Key: "v2", Value: "b"}}, connected)
+	})
+
+	t.Run("Replay returns ErrInvalidLog for unknown operations", func(t *testing.T) {
+		_, err := Replay([]Op{{Replica: "A", Seq: 1, Type: "unknown"}})
+		require.ErrorIs(t, err, ErrInvalidLog)
+	})
+}
@@ -0,0 +1,305 @@
+package oplog
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/lww"
+)
+
+// snapshotKey identifies the state of a replica right after one of its operations
+type snapshotKey struct {
+	replica string
+	seq     int
+}
+
+// Replay applies the scheduled operations to fresh graphs, one per replica,
+// using the recorded timestamps instead of the system clock, so the result is deterministic.
+//
+// Operations that failed when recorded (e.g. adding an existing vertex) fail again
+// without changing the state, such errors are ignored.
+// Returns an error with `ErrInvalidLog` cause if an operation type is unknown.
+func Replay(schedule []Op) (replicas map[string]lww.Graph, err error) {
+	var now time.Time
+	replayClock := clock.Func(func() time.Time {
+		return now
+	})
+
+	needed := make(map[snapshotKey]bool)
+	for _, op := range schedule {
+		if op.Type == Merge {
+			needed[snapshotKey{replica: op.Source, seq: op.SourceSeq}] = true
+		}
+	}
+	snapshots := make(map[snapshotKey][]byte)
+
+	replicas = make(map[string]lww.Graph)
+	graph := func(id string) lww.Graph {
+		g, exists := replicas[id]
+		if !exists {
+			r := crdt.NewReplica(id)
+			r.Clock = replayClock
+			g = lww.NewGraph(r)
+			replicas[id] = g
+		}
+		return g
+	}
+
+	for _, op := range schedule {
+		now = op.Time
+		g := graph(op.Replica)
+
+		if op.Type == Merge {
+			remote := lww.NewGraph(crdt.NewReplica(op.Source))
+			state, exists := snapshots[snapshotKey{replica: op.Source, seq: op.SourceSeq}]
+			if exists {
+				err = remote.Unmarshal(state)
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to restore replica %q after operation %d", op.Source, op.SourceSeq)
+				}
+			}
+			g.Merge(remote)
+		} else {
+			err = Apply(g, op)
+			if errors.Is(err, ErrInvalidLog) {
+				return nil, err
+			}
+		}
+
+		key := snapshotKey{replica: op.Replica, seq: op.Seq}
+		if needed[key] {
+			snapshots[key], err = g.Marshal()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to snapshot replica %q after operation %d", op.Replica, op.Seq)
+			}
+		}
+	}
+
+	return replicas, nil
+}
+
+// Apply applies a single operation to the graph, the graph clock must produce
+// the recorded timestamp of the operation in order to reproduce the recorded state.
+// Returns the error of the graph operation or an error with `ErrInvalidLog` cause
+// if the operation is a `Merge` or its type is unknown.
+func Apply(g lww.Graph, op Op) error {
+	switch op.Type {
+	case AddVertex:
+		return g.AddVertex(lww.Vertex{Key: op.Key, Value: op.Value})
+	case RemoveVertex:
+		return g.RemoveVertex(op.Key)
+	case AddEdge:
+		return g.AddEdge(op.From, op.To)
+	case RemoveEdge:
+		return g.RemoveEdge(op.From, op.To)
+	case AddEdgeWeight:
+		return g.AddEdgeWeight(op.From, op.To, op.Delta)
+	case UpdateVertex:
+		return g.UpdateVertex(lww.Vertex{Key: op.Key, Value: op.Value})
+	case UpsertVertex:
+		return g.UpsertVertex(lww.Vertex{Key: op.Key, Value: op.Value})
+	case AddWeightedEdge:
+		return g.AddWeightedEdge(op.From, op.edge())
+	case UpdateEdgeWeight:
+		return g.UpdateEdgeWeight(op.From, op.To, op.Weight)
+	case UpdateEdgeAttributes:
+		return g.UpdateEdgeAttributes(op.From, op.To, op.Attributes)
+	case AddEdgeAcyclic:
+		return g.AddEdgeAcyclic(op.From, op.To)
+	case CompareAndAddVertex:
+		_, err := g.CompareAndAddVertex(lww.Vertex{Key: op.Key, Value: op.Value}, op.observed())
+		return err
+	case CompareAndRemoveVertex:
+		_, err := g.CompareAndRemoveVertex(op.Key, op.observed())
+		return err
+	case AddVertices:
+		vertices := make([]lww.Vertex, 0, len(op.Batch))
+		for _, batchOp := range op.Batch {
+			if batchOp.Type != AddVertex {
+				return errors.Wrapf(ErrInvalidLog, "replica %q operation %d has %q in the batch of vertices", op.Replica, op.Seq, batchOp.Type)
+			}
+			vertices = append(vertices, lww.Vertex{Key: batchOp.Key, Value: batchOp.Value})
+		}
+		return g.AddVertices(vertices)
+	case AddEdges:
+		edges := make([]lww.EdgeSpec, 0, len(op.Batch))
+		for _, batchOp := range op.Batch {
+			if batchOp.Type != AddWeightedEdge {
+				return errors.Wrapf(ErrInvalidLog, "replica %q operation %d has %q in the batch of edges", op.Replica, op.Seq, batchOp.Type)
+			}
+			edges = append(edges, lww.EdgeSpec{From: batchOp.From, Edge: batchOp.edge()})
+		}
+		return g.AddEdges(edges)
+	case Update:
+		return g.Update(func(tx lww.Tx) error {
+			for _, batchOp := range op.Batch {
+				err := ApplyTx(tx, batchOp)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case Merge:
+		return errors.Wrapf(ErrInvalidLog, "replica %q operation %d is a merge and cannot be applied without the source state", op.Replica, op.Seq)
+	default:
+		return errors.Wrapf(ErrInvalidLog, "replica %q operation %d has unknown type %q", op.Replica, op.Seq, op.Type)
+	}
+}
+
+// ApplyTx applies a single operation of an `Update` batch to the transaction.
+// Returns the error of the transaction operation or an error with `ErrInvalidLog` cause
+// if the operation cannot be made in a transaction.
+func ApplyTx(tx lww.Tx, op Op) error {
+	switch op.Type {
+	case AddVertex:
+		return tx.AddVertex(lww.Vertex{Key: op.Key, Value: op.Value})
+	case UpdateVertex:
+		return tx.UpdateVertex(lww.Vertex{Key: op.Key, Value: op.Value})
+	case RemoveVertex:
+		return tx.RemoveVertex(op.Key)
+	case AddEdge:
+		return tx.AddEdge(op.From, op.To)
+	case AddWeightedEdge:
+		return tx.AddWeightedEdge(op.From, op.edge())
+	case RemoveEdge:
+		return tx.RemoveEdge(op.From, op.To)
+	default:
+		return errors.Wrapf(ErrInvalidLog, "operation %q cannot be applied in a transaction", op.Type)
+	}
+}
+
+// edge returns the edge of `AddWeightedEdge`
+func (op Op) edge() lww.Edge {
+	return lww.Edge{To: op.To, Weight: op.Weight, Label: op.Label, Attributes: op.Attributes}
+}
+
+// observed returns the observed version of the conditional operations
+func (op Op) observed() lww.Version {
+	if op.Observed == nil {
+		return lww.Version{}
+	}
+	return *op.Observed
+}
+
+// Converges checks if the given replicas reach the same state after merging with each other.
+// The replicas are not modified, their copies are merged instead.
+// Returns the sorted IDs of the replicas and the states of their merged copies
+// (as `Graph.List` returns) when the copies diverge.
+func Converges(replicas map[string]lww.Graph) (converged bool, ids []string, states [][]lww.VertexWithEdges, err error) {
+	ids = make([]string, 0, len(replicas))
+	for id := range replicas {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	snapshots := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		state, err := replicas[id].Marshal()
+		if err != nil {
+			return false, nil, nil, errors.Wrapf(err, "failed to snapshot replica %q", id)
+		}
+		snapshots = append(snapshots, state)
+	}
+
+	merged := make([][]byte, 0, len(ids))
+	copies := make([]lww.Graph, 0, len(ids))
+	for i, id := range ids {
+		g, err := restore(id, snapshots[i])
+		if err != nil {
+			return false, nil, nil, err
+		}
+		for j := range ids {
+			if j == i {
+				continue
+			}
+			remote, err := restore(ids[j], snapshots[j])
+			if err != nil {
+				return false, nil, nil, err
+			}
+			g.Merge(remote)
+		}
+
+		state, err := g.Marshal()
+		if err != nil {
+			return false, nil, nil, errors.Wrapf(err, "failed to snapshot the merged replica %q", id)
+		}
+		merged = append(merged, state)
+		copies = append(copies, g)
+	}
+
+	converged = true
+	for i := 1; i < len(merged); i++ {
+		if !bytes.Equal(merged[0], merged[i]) {
+			converged = false
+			break
+		}
+	}
+	if converged {
+		return true, ids, nil, nil
+	}
+
+	states = make([][]lww.VertexWithEdges, 0, len(copies))
+	for i, g := range copies {
+		list, err := g.List()
+		if err != nil {
+			return false, nil, nil, errors.Wrapf(err, "failed to list the merged replica %q", ids[i])
+		}
+		states = append(states, list)
+	}
+
+	return false, ids, states, nil
+}
+
+// Bisect finds the operation after which the replicas stop converging.
+//
+// It returns the index `i` in the schedule such that the replicas converge after replaying
+// the first `i` operations and diverge after replaying the first `i+1` operations,
+// so the operation `schedule[i]` introduced the divergence.
+// Returns -1 if the replicas converge after replaying the whole schedule.
+func Bisect(schedule []Op) (index int, err error) {
+	converges := func(n int) (bool, error) {
+		replicas, err := Replay(schedule[:n])
+		if err != nil {
+			return false, err
+		}
+		converged, _, _, err := Converges(replicas)
+		return converged, err
+	}
+
+	converged, err := converges(len(schedule))
+	if err != nil || converged {
+		return -1, err
+	}
+
+	// invariant: the prefix of `lo` operations converges, the prefix of `hi` operations diverges
+	lo, hi := 0, len(schedule)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		converged, err := converges(mid)
+		if err != nil {
+			return -1, err
+		}
+		if converged {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo, nil
+}
+
+// restore creates a graph of the replica with the given ID from its serialized state
+func restore(id string, state []byte) (lww.Graph, error) {
+	g := lww.NewGraph(crdt.NewReplica(id))
+	err := g.Unmarshal(state)
+	if err != nil {
+		return g, errors.Wrapf(err, "failed to restore replica %q", id)
+	}
+	return g, nil
+}
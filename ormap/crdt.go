@@ -0,0 +1,126 @@
+package ormap
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+const (
+	// MapKind is the CRDT kind of the Observed-Remove map
+	MapKind crdt.Kind = "ormap.map"
+)
+
+var (
+	// ErrValueNotSerializable occurs when marshaling a map with a value that does not implement `crdt.CRDT`
+	ErrValueNotSerializable = errors.New("value does not implement crdt.CRDT")
+)
+
+// Register registers all the CRDT kinds of this package in the given registry.
+// All the CRDTs created by the registry belong to the given replica and have the given schema.
+func Register(r crdt.Registry, replica crdt.Replica, schema Schema) error {
+	return r.Register(MapKind, func() crdt.CRDT { return NewMap(replica, schema) })
+}
+
+// mapState is the serialized format of the map
+type mapState struct {
+	// Keys is the state of the observed-remove set of the present keys
+	Keys json.RawMessage `json:"keys"`
+	// Values maps a key to the state of its value including the removed keys
+	Values map[string]json.RawMessage `json:"values"`
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (m Map) Kind() crdt.Kind {
+	return MapKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (m Map) MergeCRDT(remote crdt.CRDT) error {
+	remoteMap, isMap := remote.(Map)
+	if !isMap {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", m.Kind(), remote.Kind())
+	}
+	return m.Merge(remoteMap)
+}
+
+// Marshal implements the `crdt.CRDT` interface.
+// Returns an error with `ErrValueNotSerializable` cause if one of the values does not implement `crdt.CRDT`,
+// all the value types of this package implement it.
+func (m Map) Marshal() ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys, err := m.keys.Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal map keys")
+	}
+
+	state := mapState{
+		Keys:   keys,
+		Values: make(map[string]json.RawMessage, len(m.values)),
+	}
+	for key, value := range m.values {
+		serializable, isCRDT := value.(crdt.CRDT)
+		if !isCRDT {
+			return nil, errors.Wrapf(ErrValueNotSerializable, "failed to marshal key %q of type %T", key, value)
+		}
+		state.Values[key], err = serializable.Marshal()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal key %q", key)
+		}
+	}
+
+	return json.Marshal(state)
+}
+
+// Unmarshal implements the `crdt.CRDT` interface.
+// The values are created using the schema of the map and restored with their own `Unmarshal`.
+// Returns an error with `ErrUnknownKey` cause if the state contains keys unknown to the schema.
+// The map remains unchanged on failure.
+func (m Map) Unmarshal(data []byte) error {
+	var state mapState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal map")
+	}
+
+	values := make(map[string]Value, len(state.Values))
+	for key, valueState := range state.Values {
+		value := m.schema(key)
+		if value == nil {
+			return errors.Wrapf(ErrUnknownKey, "failed to unmarshal key %q", key)
+		}
+		serializable, isCRDT := value.(crdt.CRDT)
+		if !isCRDT {
+			return errors.Wrapf(ErrValueNotSerializable, "failed to unmarshal key %q of type %T", key, value)
+		}
+		err = serializable.Unmarshal(valueState)
+		if err != nil {
+			return errors.Wrapf(err, "failed to unmarshal key %q", key)
+		}
+		values[key] = value
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := state.Keys
+	if len(keys) == 0 {
+		keys = json.RawMessage("{}")
+	}
+	err = m.keys.Unmarshal(keys)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal map keys")
+	}
+
+	for key := range m.values {
+		delete(m.values, key)
+	}
+	for key, value := range values {
+		m.values[key] = value
+	}
+
+	return nil
+}
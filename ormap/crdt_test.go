@@ -0,0 +1,77 @@
+package ormap
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRDT(t *testing.T) {
+	registry := crdt.NewRegistry()
+	require.NoError(t, Register(registry, crdt.NewReplica("C"), documentSchema("C")))
+	require.Equal(t, []crdt.Kind{MapKind}, registry.Kinds())
+
+	t.Run("survives a marshal/unmarshal round trip with nested values", func(t *testing.T) {
+		A := NewMap(crdt.NewReplica("A"), documentSchema("A"))
+		title, err := A.Put("title")
+		require.NoError(t, err)
+		title.(LWWRegister).Set("CRDTs")
+		tags, err := A.Put("tags")
+		require.NoError(t, err)
+		tags.(ORSet).Add(lww.IDElement("go"))
+		author, err := A.Put("author")
+		require.NoError(t, err)
+		name, err := author.(Map).Put("name")
+		require.NoError(t, err)
+		name.(MVRegister).Set("Denis")
+		_, err = A.Put("published")
+		require.NoError(t, err)
+		A.Remove("published")
+
+		data, err := crdt.Marshal(A)
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+
+		m := restored.(Map)
+		require.Equal(t, []string{"author", "tags", "title"}, m.Keys())
+
+		value, err := m.Get("title")
+		require.NoError(t, err)
+		titleValue, err := value.(LWWRegister).Get()
+		require.NoError(t, err)
+		require.Equal(t, "CRDTs", titleValue)
+
+		value, err = m.Get("tags")
+		require.NoError(t, err)
+		require.Equal(t, []lww.Element{lww.IDElement("go")}, value.(ORSet).List())
+
+		value, err = m.Get("author")
+		require.NoError(t, err)
+		value, err = value.(Map).Get("name")
+		require.NoError(t, err)
+		names, err := value.(MVRegister).Get()
+		require.NoError(t, err)
+		require.Len(t, names, 1)
+		require.Equal(t, "Denis", names[0].Value)
+	})
+
+	t.Run("returns ErrUnknownKey when the state has keys unknown to the schema", func(t *testing.T) {
+		A := NewMap(crdt.NewReplica("A"), documentSchema("A"))
+		_, err := A.Put("title")
+		require.NoError(t, err)
+		data, err := A.Marshal()
+		require.NoError(t, err)
+
+		B := NewMap(crdt.NewReplica("B"), func(key string) Value { return nil })
+		require.ErrorIs(t, B.Unmarshal(data), ErrUnknownKey)
+	})
+
+	t.Run("returns ErrKindMismatch when merging CRDTs of different kinds", func(t *testing.T) {
+		err := NewMap(crdt.NewReplica("A"), documentSchema("A")).MergeCRDT(counter.NewPN(crdt.NewReplica("A")))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+	})
+}
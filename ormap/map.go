@@ -0,0 +1,187 @@
+// Package ormap implements an Observed-Remove Map (OR-Map), a map CRDT where
+// each key maps to another CRDT value, for example a register, a set or another map.
+//
+// It's used for modelling documents and records: instead of storing a whole
+// document as a single value, every field is a separate CRDT that is merged on its own.
+package ormap
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/orset"
+)
+
+var (
+	// ErrKeyNotFound occurs when a key does not exist in the map
+	ErrKeyNotFound = errors.New("key not found in the map")
+	// ErrUnknownKey occurs when the schema of the map does not define a value for the key
+	ErrUnknownKey = errors.New("key is not defined by the map schema")
+	// ErrValueTypeMismatch occurs when merging values of different types
+	ErrValueTypeMismatch = errors.New("value type mismatch")
+)
+
+// Value is a CRDT that can be stored in the map
+type Value interface {
+	// MergeValue takes another value of the same type as a `remote` and merges its state into itself.
+	// Returns an error with `ErrValueTypeMismatch` cause if the `remote` value has a different type.
+	MergeValue(remote Value) error
+}
+
+// Schema returns a new empty value for the given key, the value is bound to the local replica.
+// It returns nil if the key is not allowed in the map.
+type Schema func(key string) Value
+
+// NewMap initializes the Observed-Remove map and makes it ready for use.
+// `schema` defines which keys are allowed in the map and what types of values they have,
+// the values should belong to the same replica `r`.
+func NewMap(r crdt.Replica, schema Schema) Map {
+	return Map{
+		mutex:  &sync.Mutex{},
+		schema: schema,
+		keys:   orset.NewSet(r),
+		values: make(map[string]Value),
+	}
+}
+
+// Map is an Observed-Remove map implementation.
+// Presence of keys follows the Add-Wins Observed-Remove semantics, values are merged recursively.
+// Use `NewMap` in order to initialize it before use.
+// The map is thread-safe and can be used from several go routines,
+// the values must be thread-safe on their own.
+type Map struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// schema creates values for new keys
+	schema Schema
+	// keys is an observed-remove set of the keys present in the map
+	keys orset.Set
+	// values contains values of all the keys ever put in the map including removed ones,
+	// so concurrent updates of a removed key are not lost.
+	values map[string]Value
+}
+
+// Put makes sure the key is present in the map and returns its value, so it can be updated.
+// If the key has been removed before, its previous value state is returned.
+// Returns `ErrUnknownKey` if the key is not defined by the schema.
+func (m Map) Put(key string) (Value, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	value, err := m.value(key)
+	if err != nil {
+		return nil, err
+	}
+
+	m.keys.Add(lww.IDElement(key))
+
+	return value, nil
+}
+
+// Get returns the value of the given key.
+// Returns `ErrKeyNotFound` if the key is not present in the map.
+func (m Map) Get(key string) (Value, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	_, err := m.keys.Lookup(key)
+	if err != nil {
+		return nil, errors.Wrapf(ErrKeyNotFound, "failed to find key %q", key)
+	}
+
+	return m.values[key], nil
+}
+
+// Remove removes the key from the map.
+// A concurrent `Put` of the same key on another replica wins over the removal.
+// This operation succeeds even if the key does not exist in the map.
+func (m Map) Remove(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.keys.Remove(key)
+}
+
+// Keys returns the sorted list of keys present in the map
+func (m Map) Keys() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	elements := m.keys.List()
+	keys := make([]string, 0, len(elements))
+	for _, e := range elements {
+		keys = append(keys, e.GetKey())
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Merge takes another map as a `remote` and merges its state into itself.
+// Merging two replicas takes the union of their keys and recursively merges the values of each key.
+// Returns an error with `ErrUnknownKey` cause if the remote map contains keys unknown to the schema,
+// in this case the map state remains unchanged.
+// Returns an error with `ErrValueTypeMismatch` cause if the values of the same key have different types,
+// in this case the values of other keys might be merged already.
+func (m Map) Merge(remote Map) error {
+	if m.mutex == remote.mutex {
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// validating the keys first, so the merge is not applied partially
+	for key := range remote.values {
+		if _, exists := m.values[key]; exists {
+			continue
+		}
+		if m.schema(key) == nil {
+			return errors.Wrapf(ErrUnknownKey, "failed to merge key %q", key)
+		}
+	}
+
+	for key, remoteValue := range remote.values {
+		localValue, err := m.value(key)
+		if err != nil {
+			return err
+		}
+		err = localValue.MergeValue(remoteValue)
+		if err != nil {
+			return errors.Wrapf(err, "failed to merge key %q", key)
+		}
+	}
+
+	m.keys.Merge(remote.keys)
+
+	return nil
+}
+
+// MergeValue implements the `Value` interface, so maps can be nested
+func (m Map) MergeValue(remote Value) error {
+	remoteMap, isMap := remote.(Map)
+	if !isMap {
+		return errors.Wrapf(ErrValueTypeMismatch, "expected %T, got %T", m, remote)
+	}
+	return m.Merge(remoteMap)
+}
+
+// value returns the value of the key creating it using the schema if needed.
+func (m Map) value(key string) (Value, error) {
+	value, exists := m.values[key]
+	if exists {
+		return value, nil
+	}
+
+	value = m.schema(key)
+	if value == nil {
+		return nil, errors.Wrapf(ErrUnknownKey, "failed to create value for key %q", key)
+	}
+	m.values[key] = value
+
+	return value, nil
+}
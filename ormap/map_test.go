@@ -0,0 +1,155 @@
+package ormap
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/flags"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/orset"
+	"github.com/rdner/crdt/register"
+	"github.com/stretchr/testify/require"
+)
+
+// documentSchema returns a schema of a document with a title, tags and a nested author record
+func documentSchema(replicaID string) Schema {
+	return func(key string) Value {
+		switch key {
+		case "title":
+			return LWWRegister{register.NewLWW(crdt.NewReplica(replicaID))}
+		case "published":
+			return EWFlag{flags.NewEW(crdt.NewReplica(replicaID))}
+		case "tags":
+			return ORSet{orset.NewSet(crdt.NewReplica(replicaID))}
+		case "author":
+			return NewMap(crdt.NewReplica(replicaID), func(key string) Value {
+				if key == "name" {
+					return MVRegister{register.NewMV(crdt.NewReplica(replicaID))}
+				}
+				return nil
+			})
+		default:
+			return nil
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	t.Run("merges values of each key recursively", func(t *testing.T) {
+		A := NewMap(crdt.NewReplica("A"), documentSchema("A"))
+		B := NewMap(crdt.NewReplica("B"), documentSchema("B"))
+
+		title, err := A.Put("title")
+		require.NoError(t, err)
+		title.(LWWRegister).Set("CRDTs")
+
+		tags, err := A.Put("tags")
+		require.NoError(t, err)
+		tags.(ORSet).Add(lww.IDElement("a"))
+
+		tags, err = B.Put("tags")
+		require.NoError(t, err)
+		tags.(ORSet).Add(lww.IDElement("b"))
+
+		author, err := B.Put("author")
+		require.NoError(t, err)
+		name, err := author.(Map).Put("name")
+		require.NoError(t, err)
+		name.(MVRegister).Set("Denis")
+
+		published, err := B.Put("published")
+		require.NoError(t, err)
+		published.(EWFlag).Enable()
+
+		require.NoError(t, A.Merge(B))
+		require.NoError(t, B.Merge(A))
+
+		for _, m := range []Map{A, B} {
+			require.Equal(t, []string{"author", "published", "tags", "title"}, m.Keys())
+
+			published, err := m.Get("published")
+			require.NoError(t, err)
+			require.True(t, published.(EWFlag).Value())
+
+			title, err := m.Get("title")
+			require.NoError(t, err)
+			value, err := title.(LWWRegister).Get()
+			require.NoError(t, err)
+			require.Equal(t, "CRDTs", value)
+
+			tags, err := m.Get("tags")
+			require.NoError(t, err)
+			require.Len(t, tags.(ORSet).List(), 2)
+
+			author, err := m.Get("author")
+			require.NoError(t, err)
+			name, err := author.(Map).Get("name")
+			require.NoError(t, err)
+			values, err := name.(MVRegister).Get()
+			require.NoError(t, err)
+			require.Len(t, values, 1)
+			require.Equal(t, "Denis", values[0].Value)
+		}
+	})
+
+	t.Run("concurrent put wins over removal", func(t *testing.T) {
+		// Time ->
+		// A--Put(title)-\--Remove(title)-----------\---|
+		// B--------------\-------------Put(title)---\--|=> A,B = {title}
+		A := NewMap(crdt.NewReplica("A"), documentSchema("A"))
+		B := NewMap(crdt.NewReplica("B"), documentSchema("B"))
+
+		_, err := A.Put("title")
+		require.NoError(t, err)
+		require.NoError(t, B.Merge(A))
+
+		A.Remove("title")
+		_, err = A.Get("title")
+		require.ErrorIs(t, err, ErrKeyNotFound)
+
+		_, err = B.Put("title")
+		require.NoError(t, err)
+
+		require.NoError(t, A.Merge(B))
+		require.NoError(t, B.Merge(A))
+
+		require.Equal(t, []string{"title"}, A.Keys())
+		require.Equal(t, []string{"title"}, B.Keys())
+	})
+
+	t.Run("returns ErrUnknownKey for keys not defined by the schema", func(t *testing.T) {
+		m := NewMap(crdt.NewReplica("A"), documentSchema("A"))
+
+		_, err := m.Put("unknown")
+		require.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("does not merge a map with unknown keys", func(t *testing.T) {
+		A := NewMap(crdt.NewReplica("A"), documentSchema("A"))
+		B := NewMap(crdt.NewReplica("B"), func(key string) Value {
+			return LWWRegister{register.NewLWW(crdt.NewReplica("B"))}
+		})
+
+		_, err := B.Put("title")
+		require.NoError(t, err)
+		_, err = B.Put("unknown")
+		require.NoError(t, err)
+
+		err = A.Merge(B)
+		require.ErrorIs(t, err, ErrUnknownKey)
+		require.Equal(t, []string{}, A.Keys())
+	})
+
+	t.Run("returns ErrValueTypeMismatch when values have different types", func(t *testing.T) {
+		A := NewMap(crdt.NewReplica("A"), documentSchema("A"))
+		B := NewMap(crdt.NewReplica("B"), func(key string) Value {
+			return ORSet{orset.NewSet(crdt.NewReplica("B"))}
+		})
+
+		_, err := B.Put("title")
+		require.NoError(t, err)
+
+		err = A.Merge(B)
+		require.ErrorIs(t, err, ErrValueTypeMismatch)
+	})
+}
@@ -0,0 +1,115 @@
+package ormap
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/counter"
+	"github.com/rdner/crdt/flags"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/orset"
+	"github.com/rdner/crdt/register"
+)
+
+// LWWRegister is a `register.LWW` that can be stored in the map
+type LWWRegister struct {
+	register.LWW
+}
+
+// MergeValue implements the `Value` interface
+func (r LWWRegister) MergeValue(remote Value) error {
+	remoteRegister, isRegister := remote.(LWWRegister)
+	if !isRegister {
+		return errors.Wrapf(ErrValueTypeMismatch, "expected %T, got %T", r, remote)
+	}
+	r.Merge(remoteRegister.LWW)
+	return nil
+}
+
+// MVRegister is a `register.MV` that can be stored in the map
+type MVRegister struct {
+	register.MV
+}
+
+// MergeValue implements the `Value` interface
+func (r MVRegister) MergeValue(remote Value) error {
+	remoteRegister, isRegister := remote.(MVRegister)
+	if !isRegister {
+		return errors.Wrapf(ErrValueTypeMismatch, "expected %T, got %T", r, remote)
+	}
+	r.Merge(remoteRegister.MV)
+	return nil
+}
+
+// ORSet is an `orset.Set` that can be stored in the map
+type ORSet struct {
+	orset.Set
+}
+
+// MergeValue implements the `Value` interface
+func (s ORSet) MergeValue(remote Value) error {
+	remoteSet, isSet := remote.(ORSet)
+	if !isSet {
+		return errors.Wrapf(ErrValueTypeMismatch, "expected %T, got %T", s, remote)
+	}
+	s.Merge(remoteSet.Set)
+	return nil
+}
+
+// LWWSet is a `lww.Set` that can be stored in the map
+type LWWSet struct {
+	lww.Set
+}
+
+// MergeValue implements the `Value` interface
+func (s LWWSet) MergeValue(remote Value) error {
+	remoteSet, isSet := remote.(LWWSet)
+	if !isSet {
+		return errors.Wrapf(ErrValueTypeMismatch, "expected %T, got %T", s, remote)
+	}
+	s.Merge(remoteSet.Set)
+	return nil
+}
+
+// EWFlag is a `flags.EW` that can be stored in the map
+type EWFlag struct {
+	flags.EW
+}
+
+// MergeValue implements the `Value` interface
+func (f EWFlag) MergeValue(remote Value) error {
+	remoteFlag, isFlag := remote.(EWFlag)
+	if !isFlag {
+		return errors.Wrapf(ErrValueTypeMismatch, "expected %T, got %T", f, remote)
+	}
+	f.Merge(remoteFlag.EW)
+	return nil
+}
+
+// DWFlag is a `flags.DW` that can be stored in the map
+type DWFlag struct {
+	flags.DW
+}
+
+// MergeValue implements the `Value` interface
+func (f DWFlag) MergeValue(remote Value) error {
+	remoteFlag, isFlag := remote.(DWFlag)
+	if !isFlag {
+		return errors.Wrapf(ErrValueTypeMismatch, "expected %T, got %T", f, remote)
+	}
+	f.Merge(remoteFlag.DW)
+	return nil
+}
+
+// PNCounter is a `counter.PN` that can be stored in the map
+type PNCounter struct {
+	counter.PN
+}
+
+// MergeValue implements the `Value` interface
+func (c PNCounter) MergeValue(remote Value) error {
+	remoteCounter, isCounter := remote.(PNCounter)
+	if !isCounter {
+		return errors.Wrapf(ErrValueTypeMismatch, "expected %T, got %T", c, remote)
+	}
+	c.Merge(remoteCounter.PN)
+	return nil
+}
@@ -0,0 +1,116 @@
+package orset
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+const (
+	// SetKind is the CRDT kind of the Add-Wins Observed-Remove set
+	SetKind crdt.Kind = "orset.set"
+)
+
+// Register registers all the CRDT kinds of this package in the given registry.
+// All the CRDTs created by the registry belong to the given replica.
+// Sets created by the registry can unmarshal only `lww.IDElement` elements.
+func Register(r crdt.Registry, replica crdt.Replica) error {
+	return r.Register(SetKind, func() crdt.CRDT { return NewSet(replica) })
+}
+
+// setState is the serialized format of the set
+type setState struct {
+	// Additions maps an element key to its addition tags and the JSON representations of the elements added with them
+	Additions map[string]map[string]json.RawMessage `json:"additions"`
+	// Removals is the list of all known removed tags
+	Removals []string `json:"removals"`
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (s Set) Kind() crdt.Kind {
+	return SetKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (s Set) MergeCRDT(remote crdt.CRDT) error {
+	remoteSet, isSet := remote.(Set)
+	if !isSet {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", s.Kind(), remote.Kind())
+	}
+	s.Merge(remoteSet)
+	return nil
+}
+
+// Marshal implements the `crdt.CRDT` interface
+func (s Set) Marshal() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := setState{
+		Additions: make(map[string]map[string]json.RawMessage, len(s.additions)),
+		Removals:  make([]string, 0, len(s.removals)),
+	}
+	for key, tags := range s.additions {
+		state.Additions[key] = make(map[string]json.RawMessage, len(tags))
+		for tag, e := range tags {
+			element, err := json.Marshal(e)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to marshal element [key = %q]", key)
+			}
+			state.Additions[key][tag] = element
+		}
+	}
+	for tag := range s.removals {
+		state.Removals = append(state.Removals, tag)
+	}
+	sort.Strings(state.Removals)
+
+	return json.Marshal(state)
+}
+
+// Unmarshal implements the `crdt.CRDT` interface.
+// The elements are deserialized using the decoder the set was initialized with,
+// the set remains unchanged if any of the elements cannot be decoded.
+func (s Set) Unmarshal(data []byte) error {
+	var state setState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal OR-Set")
+	}
+
+	additions := make(map[string]map[string]lww.Element, len(state.Additions))
+	for key, tags := range state.Additions {
+		if len(tags) == 0 {
+			continue
+		}
+		additions[key] = make(map[string]lww.Element, len(tags))
+		for tag, element := range tags {
+			additions[key][tag], err = s.decode(element)
+			if err != nil {
+				return errors.Wrapf(err, "failed to unmarshal element [key = %q]", key)
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key := range s.additions {
+		delete(s.additions, key)
+	}
+	for key, tags := range additions {
+		s.additions[key] = tags
+	}
+
+	for tag := range s.removals {
+		delete(s.removals, tag)
+	}
+	for _, tag := range state.Removals {
+		s.removals[tag] = nothing{}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package orset
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRDT(t *testing.T) {
+	registry := crdt.NewRegistry()
+	require.NoError(t, Register(registry, testReplica))
+	require.Equal(t, []crdt.Kind{SetKind}, registry.Kinds())
+
+	t.Run("survives a marshal/unmarshal round trip keeping the removed tags", func(t *testing.T) {
+		A := NewSet(testReplica)
+		A.Add(lww.IDElement("element1"))
+		A.Add(lww.IDElement("element2"))
+		B := NewSet(testReplica)
+		B.Merge(A)
+		A.Remove("element2")
+
+		data, err := crdt.Marshal(A)
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+
+		list := restored.(Set).List()
+		require.Equal(t, []lww.Element{lww.IDElement("element1")}, list)
+
+		// the removal is still applied to the replicas which have seen the addition
+		require.NoError(t, B.MergeCRDT(restored))
+		require.Equal(t, []lww.Element{lww.IDElement("element1")}, B.List())
+	})
+
+	t.Run("decodes elements with the given decoder", func(t *testing.T) {
+		A := NewSet(testReplica)
+		A.Add(lww.Vertex{Key: "vertex1", Value: "value1"})
+		data, err := A.Marshal()
+		require.NoError(t, err)
+
+		restored := NewSetWithDecoder(testReplica, lww.DecodeVertex)
+		require.NoError(t, restored.Unmarshal(data))
+		found, err := restored.Lookup("vertex1")
+		require.NoError(t, err)
+		require.Equal(t, lww.Vertex{Key: "vertex1", Value: "value1"}, found)
+	})
+
+	t.Run("returns ErrKindMismatch when merging CRDTs of different kinds", func(t *testing.T) {
+		err := NewSet(testReplica).MergeCRDT(counter.NewPN(testReplica))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+	})
+}
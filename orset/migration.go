@@ -0,0 +1,55 @@
+package orset
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+// FromLWW converts the state of the given LWW-Element-Set into an equivalent OR-Set belonging to the replica `r`,
+// so existing deployments can switch to the add-wins semantics without losing data.
+//
+// Every addition of the LWW set becomes an addition marked with a tag synthesized from the key,
+// the timestamp and the replica ID of the addition. Additions removed later are converted into removed tags.
+// Since the tags are deterministic, replicas converting the same addition produce the same tag
+// and a removal converted on one replica removes the element converted on another one after merging.
+// Removals of keys whose additions are unknown to the LWW set cannot be converted and are dropped,
+// so all the replicas should be converted from a converged state for the exactly equivalent result.
+func FromLWW(r crdt.Replica, s lww.Set) Set {
+	converted := NewSet(r)
+
+	for _, added := range s.Additions() {
+		key := added.Element.GetKey()
+		tag := migrationTag(key, added)
+
+		_, err := s.Lookup(key)
+		if err != nil {
+			converted.removals[tag] = nothing{}
+			continue
+		}
+		converted.additions[key] = map[string]lww.Element{
+			tag: added.Element,
+		}
+	}
+
+	return converted
+}
+
+// migrationTag synthesizes the addition tag for the given addition of an LWW-Element-Set,
+// it has the same format as the random tags.
+func migrationTag(key string, added lww.VersionedElement) string {
+	h := sha256.New()
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, uint64(added.Timestamp.UnixNano()))
+	for _, part := range [][]byte{[]byte(key), ts, []byte(added.Replica)} {
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(len(part)))
+		_, _ = h.Write(size)
+		_, _ = h.Write(part)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:tagSize])
+}
@@ -0,0 +1,94 @@
+package orset
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromLWW(t *testing.T) {
+	base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	ticking := func(id string) crdt.Replica {
+		tick := base
+		return crdt.Replica{ID: id, Clock: clock.Func(func() time.Time {
+			tick = tick.Add(time.Second)
+			return tick
+		})}
+	}
+	e1 := valueElement{key: "element1", value: "value1"}
+	e2 := valueElement{key: "element2", value: "value2"}
+	e3 := valueElement{key: "element3", value: "value3"}
+
+	t.Run("keeps the elements of the set", func(t *testing.T) {
+		s := lww.NewSet(ticking("A"))
+		s.Add(e1)
+		s.Add(e2)
+		s.Add(e3)
+		s.Remove(e2.key)
+		s.Add(valueElement{key: e3.key, value: "updated"})
+
+		converted := FromLWW(testReplica, s)
+		list := converted.List()
+		sortElements(list)
+		require.Equal(t, []lww.Element{e1, valueElement{key: e3.key, value: "updated"}}, list)
+		require.Len(t, converted.removals, 1, "the removed addition is a removed tag")
+	})
+
+	t.Run("replicas converting the same state converge", func(t *testing.T) {
+		a := lww.NewSet(ticking("A"))
+		b := lww.NewSet(ticking("B"))
+		a.Add(e1)
+		a.Add(e2)
+		b.Merge(a)
+
+		orA, orB := FromLWW(testReplica, a), FromLWW(testReplica, b)
+		replicateSets(orA, orB)
+		require.Equal(t, orA.additions, orB.additions)
+		require.Len(t, orA.additions[e1.key], 1, "the same addition has the same tag")
+
+		orB.Remove(e1.key)
+		orA.Merge(orB)
+		_, err := orA.Lookup(e1.key)
+		require.ErrorIs(t, err, ErrElementNotFound)
+	})
+
+	t.Run("removals converted on one replica apply to the others", func(t *testing.T) {
+		a := lww.NewSet(ticking("A"))
+		b := lww.NewSet(ticking("B"))
+		a.Add(e1)
+		b.Merge(a)
+		b.Add(e2)
+		b.Remove(e1.key)
+
+		// A did not receive the removal before the migration
+		orA, orB := FromLWW(testReplica, a), FromLWW(testReplica, b)
+		_, err := orA.Lookup(e1.key)
+		require.NoError(t, err)
+
+		replicateSets(orA, orB)
+		_, err = orA.Lookup(e1.key)
+		require.ErrorIs(t, err, ErrElementNotFound)
+	})
+
+	t.Run("concurrent additions after the migration win", func(t *testing.T) {
+		s := lww.NewSet(ticking("A"))
+		s.Add(e1)
+		orA, orB := FromLWW(testReplica, s), FromLWW(testReplica, s)
+
+		orA.Remove(e1.key)
+		orB.Add(valueElement{key: e1.key, value: "re-added"})
+		replicateSets(orA, orB)
+
+		found, err := orA.Lookup(e1.key)
+		require.NoError(t, err)
+		require.Equal(t, valueElement{key: e1.key, value: "re-added"}, found)
+	})
+
+	t.Run("converts an empty set", func(t *testing.T) {
+		require.Empty(t, FromLWW(testReplica, lww.NewSet(ticking("A"))).List())
+	})
+}
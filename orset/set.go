@@ -0,0 +1,201 @@
+// Package orset implements an Add-Wins Observed-Remove Set (OR-Set).
+//
+// Unlike the Last-Writer-Wins element set, the OR-Set does not rely on timestamps:
+// every addition is marked with a unique tag and a removal removes only the tags
+// observed by the replica at the moment of the removal. Therefore, an addition
+// concurrent to a removal always wins regardless of the clocks on the replicas.
+package orset
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+var (
+	// ErrElementNotFound occurs when an element with a given key does not exist in the set.
+	ErrElementNotFound = errors.New("element not found in the set")
+)
+
+// tagSize is the amount of random bytes in a single addition tag
+const tagSize = 16
+
+// nothing is a type with zero memory allocation.
+// It's used for marking removed tags in a efficient way.
+type nothing struct{}
+
+// NewSet initializes the Add-Wins Observed-Remove set and makes it ready for use.
+// The set does not depend on the replica clock, `r` provides the metrics of the set operations.
+// The set can unmarshal only `lww.IDElement` elements, use `NewSetWithDecoder` for other element types.
+func NewSet(r crdt.Replica) Set {
+	return NewSetWithDecoder(r, lww.DecodeIDElement)
+}
+
+// NewSetWithDecoder initializes the Add-Wins Observed-Remove set and makes it ready for use.
+// `decode` is used for deserializing elements in `Unmarshal`.
+func NewSetWithDecoder(r crdt.Replica, decode lww.ElementDecoder) Set {
+	return Set{
+		mutex:     &sync.Mutex{},
+		replica:   r.WithDefaults(),
+		decode:    decode,
+		additions: make(map[string]map[string]lww.Element),
+		removals:  make(map[string]nothing),
+	}
+}
+
+// Set is an Add-Wins Observed-Remove set implementation.
+// Use `NewSet` in order to initialize it before use.
+// The set is thread-safe and can be used from several go routines.
+type Set struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is the identity and the policies of the replica the set belongs to
+	replica crdt.Replica
+	// decode is used for deserializing elements
+	decode lww.ElementDecoder
+
+	// additions maps an element key to all its observed addition tags
+	// that have not been removed yet and the elements added with these tags.
+	additions map[string]map[string]lww.Element
+	// removals is a set of all known removed tags
+	removals map[string]nothing
+}
+
+// Add adds the given element to the set marking the addition with a new unique tag.
+// It replaces an existing element if the element key collides.
+func (s Set) Add(e lww.Element) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := e.GetKey()
+
+	// the previous additions of this key are observed and
+	// superseded by this one, so they can be removed.
+	for tag := range s.additions[key] {
+		s.removals[tag] = nothing{}
+	}
+
+	s.additions[key] = map[string]lww.Element{
+		newTag(): e,
+	}
+	s.replica.Metrics.Count("orset.add", 1)
+}
+
+// Remove removes an element with the given key from the set.
+// Only the additions observed by this replica are removed, so a concurrent
+// addition on another replica wins after merging.
+// This operation succeeds even if the element does not exist in the set.
+func (s Set) Remove(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for tag := range s.additions[key] {
+		s.removals[tag] = nothing{}
+	}
+	delete(s.additions, key)
+	s.replica.Metrics.Count("orset.remove", 1)
+}
+
+// Merge takes another OR-Set as a `remote` and merges its state into itself.
+// Merging two replicas takes the union of their tagged additions and removed tags.
+func (s Set) Merge(remote Set) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// computing the union of removed tags
+	for tag := range remote.removals {
+		s.removals[tag] = nothing{}
+	}
+
+	// computing the union of additions
+	for key, remoteTags := range remote.additions {
+		localTags, added := s.additions[key]
+		if !added {
+			localTags = make(map[string]lww.Element, len(remoteTags))
+			s.additions[key] = localTags
+		}
+		for tag, e := range remoteTags {
+			localTags[tag] = e
+		}
+	}
+
+	// dropping additions which have been removed by any of the replicas
+	for key, tags := range s.additions {
+		for tag := range tags {
+			if _, removed := s.removals[tag]; removed {
+				delete(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			delete(s.additions, key)
+		}
+	}
+
+	s.replica.Metrics.Count("orset.merge", 1)
+}
+
+// Lookup checks if an element with the given key exists in the set.
+// Returns the found element and no error if the element exists.
+// Returns nil and `ErrElementNotFound` if it does not exist.
+//
+// When the same key was concurrently added on several replicas, the element
+// with the greatest tag is returned, so all the replicas return the same element.
+func (s Set) Lookup(key string) (lww.Element, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, found := s.lookup(key)
+	if !found {
+		return nil, ErrElementNotFound
+	}
+
+	return e, nil
+}
+
+// List returns a list of the actual elements of the set.
+// Because of the internally used map the result order is not deterministic.
+func (s Set) List() (list []lww.Element) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// it's always at least an empty list, not nil
+	list = make([]lww.Element, 0, len(s.additions))
+
+	for key := range s.additions {
+		e, _ := s.lookup(key)
+		list = append(list, e)
+	}
+
+	return list
+}
+
+// lookup returns the element with the greatest tag among the additions of the given key
+func (s Set) lookup(key string) (e lww.Element, found bool) {
+	var maxTag string
+	for tag, tagged := range s.additions[key] {
+		if !found || tag > maxTag {
+			maxTag = tag
+			e = tagged
+			found = true
+		}
+	}
+
+	return e, found
+}
+
+// newTag generates a new universally unique addition tag
+func newTag() string {
+	tag := make([]byte, tagSize)
+	_, err := rand.Read(tag)
+	if err != nil {
+		// should never happen, the system's random source is broken
+		panic(errors.Wrap(err, "failed to generate a unique tag"))
+	}
+
+	return hex.EncodeToString(tag)
+}
@@ -0,0 +1,230 @@
+package orset
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+var testReplica = crdt.NewReplica("test")
+
+func sortElements(list []lww.Element) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].GetKey() < list[j].GetKey()
+	})
+}
+
+func replicateSets(sets ...Set) {
+	for _, to := range sets {
+		for _, from := range sets {
+			if from.mutex == to.mutex {
+				continue
+			}
+			to.Merge(from)
+		}
+	}
+}
+
+// valueElement is an element that carries a value in addition to its key
+type valueElement struct {
+	key   string
+	value string
+}
+
+func (e valueElement) GetKey() string {
+	return e.key
+}
+
+func TestSet(t *testing.T) {
+	t.Run("CRDT properties", func(t *testing.T) {
+		e1 := lww.IDElement("element1")
+		e2 := lww.IDElement("element2")
+		e3 := lww.IDElement("element3")
+
+		t.Run("Eventual convergence", func(t *testing.T) {
+			t.Run("all actors converge to the same state after replication", func(t *testing.T) {
+				// Time ->
+				// A--Add(e1)-------------------\---|
+				// B------Add(e2)----------------\--|=> A,B,C = {e1,e2,e3}
+				// C-----------Add(e1), Add(e3)---\-|
+
+				A := NewSet(testReplica)
+				B := NewSet(testReplica)
+				C := NewSet(testReplica)
+
+				A.Add(e1)
+
+				B.Add(e2)
+
+				C.Add(e1)
+				C.Add(e3)
+
+				replicateSets(A, B, C)
+
+				a := A.List()
+				b := B.List()
+				c := C.List()
+
+				sortElements(a)
+				sortElements(b)
+				sortElements(c)
+
+				require.Equal(t, []lww.Element{e1, e2, e3}, a)
+				require.Equal(t, a, b)
+				require.Equal(t, b, c)
+			})
+
+			t.Run("concurrently added values of the same key converge", func(t *testing.T) {
+				A := NewSet(testReplica)
+				B := NewSet(testReplica)
+
+				A.Add(valueElement{key: "key", value: "a"})
+				B.Add(valueElement{key: "key", value: "b"})
+
+				replicateSets(A, B)
+
+				a, err := A.Lookup("key")
+				require.NoError(t, err)
+				b, err := B.Lookup("key")
+				require.NoError(t, err)
+				require.Equal(t, a, b)
+			})
+		})
+
+		t.Run("Add-wins", func(t *testing.T) {
+			t.Run("concurrent addition wins over removal", func(t *testing.T) {
+				// Time ->
+				// A--Add(e1)-\--Remove(e1)-------\---|
+				// B-----------\----------Add(e1)--\--|=> A,B = {e1}
+
+				A := NewSet(testReplica)
+				B := NewSet(testReplica)
+
+				A.Add(e1)
+				replicateSets(A, B)
+
+				A.Remove(e1.GetKey())
+				B.Add(e1)
+
+				replicateSets(A, B)
+
+				found, err := A.Lookup(e1.GetKey())
+				require.NoError(t, err)
+				require.Equal(t, e1, found)
+
+				found, err = B.Lookup(e1.GetKey())
+				require.NoError(t, err)
+				require.Equal(t, e1, found)
+			})
+
+			t.Run("removal of an observed addition gets replicated", func(t *testing.T) {
+				// Time ->
+				// A--Add(e1)-\--Remove(e1)--\---|
+				// B-----------\--------------\--|=> A,B = {}
+
+				A := NewSet(testReplica)
+				B := NewSet(testReplica)
+
+				A.Add(e1)
+				replicateSets(A, B)
+
+				A.Remove(e1.GetKey())
+				replicateSets(A, B)
+
+				found, err := A.Lookup(e1.GetKey())
+				require.ErrorIs(t, err, ErrElementNotFound)
+				require.Nil(t, found)
+
+				found, err = B.Lookup(e1.GetKey())
+				require.ErrorIs(t, err, ErrElementNotFound)
+				require.Nil(t, found)
+
+				expected := []lww.Element{}
+				require.Equal(t, expected, A.List())
+				require.Equal(t, expected, B.List())
+			})
+
+			t.Run("removal does not affect unobserved additions", func(t *testing.T) {
+				// Time ->
+				// A--Remove(e1)-----\---|
+				// B--Add(e1)---------\--|=> A,B = {e1}
+
+				A := NewSet(testReplica)
+				B := NewSet(testReplica)
+
+				A.Remove(e1.GetKey())
+				B.Add(e1)
+
+				replicateSets(A, B)
+
+				found, err := A.Lookup(e1.GetKey())
+				require.NoError(t, err)
+				require.Equal(t, e1, found)
+			})
+		})
+	})
+
+	t.Run("Set operations", func(t *testing.T) {
+		key := "unique"
+		element := lww.IDElement(key)
+
+		t.Run("added element can be retrieved", func(t *testing.T) {
+			s := NewSet(testReplica)
+			s.Add(element)
+
+			retrieved, err := s.Lookup(key)
+			require.NoError(t, err)
+			require.Equal(t, element, retrieved)
+		})
+
+		t.Run("adding the same key replaces the element", func(t *testing.T) {
+			s := NewSet(testReplica)
+			s.Add(valueElement{key: key, value: "first"})
+			s.Add(valueElement{key: key, value: "second"})
+
+			retrieved, err := s.Lookup(key)
+			require.NoError(t, err)
+			require.Equal(t, valueElement{key: key, value: "second"}, retrieved)
+			require.Len(t, s.List(), 1)
+		})
+
+		t.Run("retrieving a non-existing element returns ErrElementNotFound", func(t *testing.T) {
+			s := NewSet(testReplica)
+
+			element, err := s.Lookup("non-existing")
+			require.ErrorIs(t, err, ErrElementNotFound)
+			require.Nil(t, element)
+		})
+
+		t.Run("removes an existing element", func(t *testing.T) {
+			s := NewSet(testReplica)
+			s.Add(element)
+			s.Remove(key)
+
+			element, err := s.Lookup(key)
+			require.ErrorIs(t, err, ErrElementNotFound)
+			require.Nil(t, element)
+		})
+
+		t.Run("re-adds a removed element", func(t *testing.T) {
+			s := NewSet(testReplica)
+			s.Add(element)
+			s.Remove(key)
+			s.Add(element)
+
+			retrieved, err := s.Lookup(key)
+			require.NoError(t, err)
+			require.Equal(t, element, retrieved)
+		})
+
+		t.Run("does not panic for non-existing element", func(t *testing.T) {
+			s := NewSet(testReplica)
+			require.NotPanics(t, func() {
+				s.Remove("non-existing")
+			})
+		})
+	})
+}
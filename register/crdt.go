@@ -0,0 +1,197 @@
+package register
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+)
+
+const (
+	// LWWKind is the CRDT kind of the Last-Writer-Wins register
+	LWWKind crdt.Kind = "register.lww"
+	// MVKind is the CRDT kind of the Multi-Value register
+	MVKind crdt.Kind = "register.mv"
+)
+
+// Register registers all the CRDT kinds of this package in the given registry.
+// All the CRDTs created by the registry belong to the given replica.
+func Register(r crdt.Registry, replica crdt.Replica) error {
+	err := r.Register(LWWKind, func() crdt.CRDT { return NewLWW(replica) })
+	if err != nil {
+		return err
+	}
+
+	return r.Register(MVKind, func() crdt.CRDT { return NewMV(replica) })
+}
+
+// valueState is the serialized format of a written value
+type valueState struct {
+	// Value is the JSON representation of the value
+	Value json.RawMessage `json:"value"`
+	// Timestamp is when the value was written
+	Timestamp time.Time `json:"timestamp"`
+	// Replica is the ID of the replica that wrote the value
+	Replica string `json:"replica"`
+	// Version is the version vector observed by the write, it's set only for `MV`
+	Version clock.VersionVector `json:"version,omitempty"`
+}
+
+// lwwRegisterState is the serialized format of the LWW register
+type lwwRegisterState struct {
+	// Value is the current value, nil if the register has never been set
+	Value *valueState `json:"value"`
+}
+
+// mvRegisterState is the serialized format of the MV register
+type mvRegisterState struct {
+	// Values are the concurrent values of the register
+	Values []valueState `json:"values"`
+}
+
+// marshalValue returns the serialized state of the written value
+func marshalValue(value interface{}, timestamp time.Time, replicaID string) (valueState, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return valueState{}, errors.Wrapf(err, "failed to marshal value written by replica %q", replicaID)
+	}
+	return valueState{Value: data, Timestamp: timestamp, Replica: replicaID}, nil
+}
+
+// unmarshalValue returns the value of the serialized state,
+// values are decoded into generic JSON values, e.g. numbers into `float64` and objects into `map[string]interface{}`.
+func unmarshalValue(state valueState) (value interface{}, err error) {
+	err = json.Unmarshal(state.Value, &value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal value written by replica %q", state.Replica)
+	}
+	return value, nil
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (r LWW) Kind() crdt.Kind {
+	return LWWKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (r LWW) MergeCRDT(remote crdt.CRDT) error {
+	remoteRegister, isRegister := remote.(LWW)
+	if !isRegister {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", r.Kind(), remote.Kind())
+	}
+	r.Merge(remoteRegister)
+	return nil
+}
+
+// Marshal implements the `crdt.CRDT` interface, the value must be serializable to JSON
+func (r LWW) Marshal() ([]byte, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var state lwwRegisterState
+	if !r.state.timestamp.IsZero() {
+		value, err := marshalValue(r.state.value, r.state.timestamp, r.state.replicaID)
+		if err != nil {
+			return nil, err
+		}
+		state.Value = &value
+	}
+
+	return json.Marshal(state)
+}
+
+// Unmarshal implements the `crdt.CRDT` interface.
+// The value is decoded into a generic JSON value, e.g. a number into `float64`.
+func (r LWW) Unmarshal(data []byte) error {
+	var state lwwRegisterState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal LWW register")
+	}
+
+	var restored lwwState
+	if state.Value != nil {
+		restored.value, err = unmarshalValue(*state.Value)
+		if err != nil {
+			return err
+		}
+		restored.timestamp, restored.replicaID = state.Value.Timestamp, state.Value.Replica
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	*r.state = restored
+
+	return nil
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (r MV) Kind() crdt.Kind {
+	return MVKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (r MV) MergeCRDT(remote crdt.CRDT) error {
+	remoteRegister, isRegister := remote.(MV)
+	if !isRegister {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", r.Kind(), remote.Kind())
+	}
+	r.Merge(remoteRegister)
+	return nil
+}
+
+// Marshal implements the `crdt.CRDT` interface, the values must be serializable to JSON
+func (r MV) Marshal() ([]byte, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	state := mvRegisterState{
+		Values: make([]valueState, 0, len(*r.entries)),
+	}
+	for _, e := range *r.entries {
+		value, err := marshalValue(e.Value.Value, e.WrittenAt, e.ReplicaID)
+		if err != nil {
+			return nil, err
+		}
+		value.Version = e.version
+		state.Values = append(state.Values, value)
+	}
+
+	return json.Marshal(state)
+}
+
+// Unmarshal implements the `crdt.CRDT` interface.
+// The values are decoded into generic JSON values, e.g. numbers into `float64`.
+func (r MV) Unmarshal(data []byte) error {
+	var state mvRegisterState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal MV register")
+	}
+
+	entries := make([]mvEntry, 0, len(state.Values))
+	for _, valueState := range state.Values {
+		value, err := unmarshalValue(valueState)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, mvEntry{
+			Value: Value{
+				Value:     value,
+				WrittenAt: valueState.Timestamp,
+				ReplicaID: valueState.Replica,
+			},
+			version: valueState.Version.Copy(),
+		})
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	*r.entries = entries
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package register
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRDT(t *testing.T) {
+	registry := crdt.NewRegistry()
+	require.NoError(t, Register(registry, crdt.NewReplica("C")))
+	require.Equal(t, []crdt.Kind{LWWKind, MVKind}, registry.Kinds())
+
+	t.Run("LWW register survives a marshal/unmarshal round trip", func(t *testing.T) {
+		now := time.Now()
+		A := NewLWW(crdt.Replica{ID: "A", Clock: fixedClock(now)})
+		A.Set("a")
+
+		data, err := crdt.Marshal(A)
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+
+		value, err := restored.(LWW).Get()
+		require.NoError(t, err)
+		require.Equal(t, "a", value)
+
+		// the restored write keeps its timestamp and replica
+		B := NewLWW(crdt.Replica{ID: "B", Clock: fixedClock(now)})
+		B.Set("b")
+		require.NoError(t, restored.MergeCRDT(B))
+		value, err = restored.(LWW).Get()
+		require.NoError(t, err)
+		require.Equal(t, "b", value)
+	})
+
+	t.Run("empty LWW register stays empty", func(t *testing.T) {
+		data, err := crdt.Marshal(NewLWW(crdt.NewReplica("A")))
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+
+		_, err = restored.(LWW).Get()
+		require.ErrorIs(t, err, ErrEmptyRegister)
+	})
+
+	t.Run("MV register survives a marshal/unmarshal round trip keeping concurrent values", func(t *testing.T) {
+		now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		A := NewMV(crdt.Replica{ID: "A", Clock: fixedClock(now)})
+		B := NewMV(crdt.Replica{ID: "B", Clock: fixedClock(now)})
+		A.Set("a")
+		B.Set(42)
+		A.Merge(B)
+
+		data, err := crdt.Marshal(A)
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+
+		values, err := restored.(MV).Get()
+		require.NoError(t, err)
+		require.Equal(t, []Value{
+			{Value: "a", WrittenAt: now, ReplicaID: "A"},
+			{Value: float64(42), WrittenAt: now, ReplicaID: "B"},
+		}, values)
+
+		// a write on the restored replica supersedes the restored values
+		restored.(MV).Set("c")
+		A.Merge(restored.(MV))
+		values, err = A.Get()
+		require.NoError(t, err)
+		require.Len(t, values, 1)
+		require.Equal(t, "c", values[0].Value)
+	})
+
+	t.Run("returns ErrKindMismatch when merging CRDTs of different kinds", func(t *testing.T) {
+		err := NewLWW(crdt.NewReplica("A")).MergeCRDT(NewMV(crdt.NewReplica("A")))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+
+		err = NewMV(crdt.NewReplica("A")).MergeCRDT(NewLWW(crdt.NewReplica("A")))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+	})
+}
@@ -0,0 +1,87 @@
+package register
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rdner/crdt"
+)
+
+// lwwState is a value written to a LWW register and the metadata of the write
+type lwwState struct {
+	// value is the written value
+	value interface{}
+	// timestamp is when the value was written
+	timestamp time.Time
+	// replicaID is the replica that wrote the value, it's used for resolving timestamp collisions
+	replicaID string
+}
+
+// wins returns `true` if the state wins over the `other` state
+func (s lwwState) wins(other lwwState) bool {
+	if s.timestamp.Equal(other.timestamp) {
+		return s.replicaID > other.replicaID
+	}
+	return s.timestamp.After(other.timestamp)
+}
+
+// NewLWW initializes the Last-Writer-Wins register and makes it ready for use.
+// The replica ID is used for resolving writes with colliding timestamps,
+// the replica clock is used for timestamping writes.
+func NewLWW(r crdt.Replica) LWW {
+	return LWW{
+		mutex:   &sync.Mutex{},
+		replica: r.WithDefaults(),
+		state:   &lwwState{},
+	}
+}
+
+// LWW is a Last-Writer-Wins state-based register implementation.
+// Use `NewLWW` in order to initialize it before use.
+// The register is thread-safe and can be used from several go routines.
+type LWW struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is the identity and the policies of the replica the register belongs to
+	replica crdt.Replica
+
+	// state is the current value of the register, the timestamp is zero if it has never been set
+	state *lwwState
+}
+
+// Set writes the given value to the register replacing the current value.
+func (r LWW) Set(value interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	*r.state = lwwState{
+		value:     value,
+		timestamp: r.replica.Clock.Now(),
+		replicaID: r.replica.ID,
+	}
+}
+
+// Get returns the current value of the register.
+// Returns `ErrEmptyRegister` if the register has never been set.
+func (r LWW) Get() (value interface{}, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.state.timestamp.IsZero() {
+		return nil, ErrEmptyRegister
+	}
+
+	return r.state.value, nil
+}
+
+// Merge takes another LWW register as a `remote` and merges its state into itself.
+// The value with the latest timestamp wins, when timestamps collide the greater replica ID wins.
+func (r LWW) Merge(remote LWW) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if remote.state.wins(*r.state) {
+		*r.state = *remote.state
+	}
+}
@@ -0,0 +1,75 @@
+package register
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLWW(t *testing.T) {
+	t.Run("returns ErrEmptyRegister when never set", func(t *testing.T) {
+		r := NewLWW(crdt.NewReplica("A"))
+
+		value, err := r.Get()
+		require.ErrorIs(t, err, ErrEmptyRegister)
+		require.Nil(t, value)
+	})
+
+	t.Run("returns the last set value", func(t *testing.T) {
+		r := NewLWW(crdt.NewReplica("A"))
+		r.Set("first")
+		r.Set("second")
+
+		value, err := r.Get()
+		require.NoError(t, err)
+		require.Equal(t, "second", value)
+	})
+
+	t.Run("the latest write wins after replication", func(t *testing.T) {
+		now := time.Now()
+		A := NewLWW(crdt.Replica{ID: "A", Clock: fixedClock(now.Add(time.Second))})
+		B := NewLWW(crdt.Replica{ID: "B", Clock: fixedClock(now)})
+
+		A.Set("a")
+		B.Set("b")
+
+		A.Merge(B)
+		B.Merge(A)
+
+		for _, r := range []LWW{A, B} {
+			value, err := r.Get()
+			require.NoError(t, err)
+			require.Equal(t, "a", value)
+		}
+	})
+
+	t.Run("greater replica ID wins when timestamps collide", func(t *testing.T) {
+		now := time.Now()
+		A := NewLWW(crdt.Replica{ID: "A", Clock: fixedClock(now)})
+		B := NewLWW(crdt.Replica{ID: "B", Clock: fixedClock(now)})
+
+		A.Set("a")
+		B.Set("b")
+
+		A.Merge(B)
+		B.Merge(A)
+
+		for _, r := range []LWW{A, B} {
+			value, err := r.Get()
+			require.NoError(t, err)
+			require.Equal(t, "b", value)
+		}
+	})
+
+	t.Run("merging an empty register does not change the value", func(t *testing.T) {
+		A := NewLWW(crdt.NewReplica("A"))
+		A.Set("a")
+		A.Merge(NewLWW(crdt.NewReplica("B")))
+
+		value, err := A.Get()
+		require.NoError(t, err)
+		require.Equal(t, "a", value)
+	})
+}
@@ -0,0 +1,138 @@
+package register
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+)
+
+// Value is a single value stored in a Multi-Value register
+type Value struct {
+	// Value is the written value
+	Value interface{}
+	// WrittenAt is when the value was written according to the clock of the writing replica
+	WrittenAt time.Time
+	// ReplicaID is the replica that wrote the value
+	ReplicaID string
+}
+
+// mvEntry is a value and the version vector of the write
+type mvEntry struct {
+	Value
+	// version is the version vector observed by the write
+	version clock.VersionVector
+}
+
+// NewMV initializes the Multi-Value register and makes it ready for use.
+// The replica ID is used for tracking causality of writes,
+// the replica clock is used for timestamping written values.
+func NewMV(r crdt.Replica) MV {
+	return MV{
+		mutex:   &sync.Mutex{},
+		replica: r.WithDefaults(),
+		entries: &[]mvEntry{},
+	}
+}
+
+// MV is a Multi-Value state-based register implementation.
+// Unlike `LWW` it does not drop concurrent writes, all the concurrent values
+// are kept until a subsequent write that observed them replaces them.
+// Causality of writes is tracked with version vectors, so the result does not depend on clocks,
+// the timestamps are only informational.
+// Use `NewMV` in order to initialize it before use.
+// The register is thread-safe and can be used from several go routines.
+type MV struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is the identity and the policies of the replica the register belongs to
+	replica crdt.Replica
+
+	// entries are concurrent values of the register
+	entries *[]mvEntry
+}
+
+// Set writes the given value to the register replacing all the values observed by this replica.
+func (r MV) Set(value interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	version := clock.VersionVector{}
+	for _, e := range *r.entries {
+		version = version.Merge(e.version)
+	}
+
+	*r.entries = []mvEntry{
+		{
+			Value: Value{
+				Value:     value,
+				WrittenAt: r.replica.Clock.Now(),
+				ReplicaID: r.replica.ID,
+			},
+			version: version.Increment(r.replica.ID),
+		},
+	}
+}
+
+// Get returns all the concurrent values of the register.
+// There is more than one value only if there were concurrent writes on different replicas.
+// The values are ordered by `WrittenAt` and then by `ReplicaID`.
+// Returns `ErrEmptyRegister` if the register has never been set.
+func (r MV) Get() (values []Value, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(*r.entries) == 0 {
+		return nil, ErrEmptyRegister
+	}
+
+	values = make([]Value, 0, len(*r.entries))
+	for _, e := range *r.entries {
+		values = append(values, e.Value)
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].WrittenAt.Equal(values[j].WrittenAt) {
+			return values[i].ReplicaID < values[j].ReplicaID
+		}
+		return values[i].WrittenAt.Before(values[j].WrittenAt)
+	})
+
+	return values, nil
+}
+
+// Merge takes another Multi-Value register as a `remote` and merges its state into itself.
+// Values which causally precede any other value are dropped, concurrent values are kept.
+func (r MV) Merge(remote MV) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	candidates := make([]mvEntry, 0, len(*r.entries)+len(*remote.entries))
+	candidates = append(candidates, *r.entries...)
+	candidates = append(candidates, *remote.entries...)
+
+	merged := make([]mvEntry, 0, len(candidates))
+
+	for i, candidate := range candidates {
+		keep := true
+		for j, other := range candidates {
+			if i == j {
+				continue
+			}
+			ordering := candidate.version.Compare(other.version)
+			// the same write known by both replicas is kept only once
+			if ordering == clock.Before || (ordering == clock.Equal && j < i) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			merged = append(merged, candidate)
+		}
+	}
+
+	*r.entries = merged
+}
@@ -0,0 +1,94 @@
+package register
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMV(t *testing.T) {
+	now := time.Now()
+
+	getValues := func(t *testing.T, r MV) []interface{} {
+		values, err := r.Get()
+		require.NoError(t, err)
+		result := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			result = append(result, v.Value)
+		}
+		return result
+	}
+
+	t.Run("returns ErrEmptyRegister when never set", func(t *testing.T) {
+		r := NewMV(crdt.NewReplica("A"))
+
+		values, err := r.Get()
+		require.ErrorIs(t, err, ErrEmptyRegister)
+		require.Nil(t, values)
+	})
+
+	t.Run("surfaces concurrent values", func(t *testing.T) {
+		// Time ->
+		// A--Set(a)--\---|
+		// B--Set(b)---\--|=> A,B = {a, b}
+		A := NewMV(crdt.Replica{ID: "A", Clock: fixedClock(now)})
+		B := NewMV(crdt.Replica{ID: "B", Clock: fixedClock(now.Add(time.Second))})
+
+		A.Set("a")
+		B.Set("b")
+
+		A.Merge(B)
+		B.Merge(A)
+
+		require.Equal(t, []interface{}{"a", "b"}, getValues(t, A))
+		require.Equal(t, []interface{}{"a", "b"}, getValues(t, B))
+	})
+
+	t.Run("a write replaces observed concurrent values", func(t *testing.T) {
+		// Time ->
+		// A--Set(a)--\----Set(c)--\---|
+		// B--Set(b)---\------------\--|=> A,B = {c}
+		A := NewMV(crdt.NewReplica("A"))
+		B := NewMV(crdt.NewReplica("B"))
+
+		A.Set("a")
+		B.Set("b")
+		A.Merge(B)
+		B.Merge(A)
+
+		A.Set("c")
+		A.Merge(B)
+		B.Merge(A)
+
+		require.Equal(t, []interface{}{"c"}, getValues(t, A))
+		require.Equal(t, []interface{}{"c"}, getValues(t, B))
+	})
+
+	t.Run("causally later write wins regardless of the clocks", func(t *testing.T) {
+		// B's clock is behind, but its write observed A's write
+		A := NewMV(crdt.Replica{ID: "A", Clock: fixedClock(now.Add(time.Hour))})
+		B := NewMV(crdt.Replica{ID: "B", Clock: fixedClock(now)})
+
+		A.Set("a")
+		B.Merge(A)
+		B.Set("b")
+		A.Merge(B)
+
+		require.Equal(t, []interface{}{"b"}, getValues(t, A))
+	})
+
+	t.Run("merging is idempotent", func(t *testing.T) {
+		A := NewMV(crdt.NewReplica("A"))
+		B := NewMV(crdt.NewReplica("B"))
+
+		A.Set("a")
+		B.Merge(A)
+		B.Merge(A)
+		A.Merge(B)
+
+		require.Equal(t, []interface{}{"a"}, getValues(t, A))
+		require.Equal(t, []interface{}{"a"}, getValues(t, B))
+	})
+}
@@ -0,0 +1,13 @@
+// Package register implements state-based register CRDTs holding a single arbitrary value:
+// * `LWW` - Last-Writer-Wins register, concurrent writes are resolved by timestamps
+// * `MV` - Multi-Value register, concurrent writes are all preserved and surfaced to the user
+package register
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrEmptyRegister occurs when reading a register that has never been set
+	ErrEmptyRegister = errors.New("register is empty")
+)
@@ -0,0 +1,14 @@
+package register
+
+import (
+	"time"
+
+	"github.com/rdner/crdt/clock"
+)
+
+// fixedClock returns a clock that always returns the given time
+func fixedClock(t time.Time) clock.Clock {
+	return clock.Func(func() time.Time {
+		return t
+	})
+}
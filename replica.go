@@ -0,0 +1,230 @@
+package crdt
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/clock"
+)
+
+var (
+	// ErrLimitExceeded occurs when an operation would exceed one of the replica limits
+	ErrLimitExceeded = errors.New("replica limit exceeded")
+	// ErrInvalidValue occurs when a value is rejected by the replica validator
+	ErrInvalidValue = errors.New("invalid value")
+)
+
+// Bias defines which operation wins when an addition and a removal of the same
+// element have exactly the same timestamp.
+type Bias int
+
+const (
+	// BiasAdd makes an addition win over a removal with the same timestamp
+	BiasAdd Bias = iota
+	// BiasRemove makes a removal win over an addition with the same timestamp
+	BiasRemove
+)
+
+// Order defines the iteration order of elements in lists and traversals (e.g. `lww.Set.List`,
+// `lww.Graph.FindConnected` and `lww.Graph.FindPath`).
+type Order int
+
+const (
+	// OrderNone iterates elements in no particular order which can differ between runs, it's the fastest
+	OrderNone Order = iota
+	// OrderSorted iterates elements sorted by key
+	OrderSorted
+	// OrderInsertion iterates elements in the order they were last added: by timestamp, then by replica ID
+	// and then by key, so it's the same on all the replicas that have the same state
+	OrderInsertion
+)
+
+// Limits restrict the amount of data a replica can hold.
+// Zero values mean no limit.
+type Limits struct {
+	// MaxElements is the maximum number of elements (e.g. vertices or list items)
+	// a single CRDT can hold, the limit is checked only by operations that can fail.
+	MaxElements int
+}
+
+// Compression configures transparent compression of large values.
+// The zero value disables compression.
+type Compression struct {
+	// Threshold is the size in bytes above which a value is compressed, zero disables compression.
+	// Values are compressed only if it makes them smaller.
+	Threshold int
+}
+
+// Validator checks values written to the replica, e.g. against a JSON schema (see the `schema` package)
+type Validator interface {
+	// Validate returns an error if the value stored under the given key is malformed
+	Validate(key, value string) error
+}
+
+// ValidatorFunc is a function implementing the `Validator` interface
+type ValidatorFunc func(key, value string) error
+
+// Validate implements the `Validator` interface
+func (f ValidatorFunc) Validate(key, value string) error {
+	return f(key, value)
+}
+
+// Logger is used by the CRDTs for reporting what happens with the replica state.
+// The standard `log.Logger` implements this interface.
+// Loggers can also implement `MergeLogger` for structured records of merges.
+type Logger interface {
+	// Printf logs a formatted message
+	Printf(format string, v ...interface{})
+}
+
+// Metrics is used by the CRDTs for counting operations
+type Metrics interface {
+	// Count adds `delta` to the counter with the given name
+	Count(name string, delta int64)
+}
+
+// DurationMetrics is an optional interface of `Metrics` receiving the durations of operations, e.g. merges
+type DurationMetrics interface {
+	// ObserveDuration records the duration of an operation with the given name
+	ObserveDuration(name string, d time.Duration)
+}
+
+// ObserveDuration records the duration of an operation if the metrics implement `DurationMetrics`
+func ObserveDuration(m Metrics, name string, d time.Duration) {
+	if durations, ok := m.(DurationMetrics); ok {
+		durations.ObserveDuration(name, d)
+	}
+}
+
+// nopLogger is a `Logger` that discards all the messages
+type nopLogger struct{}
+
+// Printf implements the `Logger` interface
+func (nopLogger) Printf(format string, v ...interface{}) {}
+
+// nopMetrics is a `Metrics` that discards all the counters
+type nopMetrics struct{}
+
+// Count implements the `Metrics` interface
+func (nopMetrics) Count(name string, delta int64) {}
+
+// Replica contains the identity and the policies of a replica.
+// The same value should be passed to all the CRDTs of a process,
+// so all of them share consistent identity and policies.
+type Replica struct {
+	// ID is a universally unique identifier of the replica (actor)
+	ID string
+	// Clock is used for timestamping operations, wrap it with `clock.NewMonotonic` so the timestamps
+	// of local operations never go backwards, operations that can fail check it with `CheckClock`.
+	// Every timestamp must be issued once: two writes of the same key by the replica at the same
+	// timestamp look like the same operation to the others and the replicas diverge.
+	// The default is the system clock wrapped with `clock.NewMonotonic`.
+	Clock clock.Clock
+	// Bias is used for resolving operations with colliding timestamps
+	Bias Bias
+	// Order is the iteration order of lists and traversals, the default is no particular order.
+	// Set it in order to get the same results across runs and replicas.
+	Order Order
+	// Limits restrict the amount of data the replica can hold
+	Limits Limits
+	// Logger receives messages about the replica state
+	Logger Logger
+	// Metrics receives operation counters
+	Metrics Metrics
+	// KeyNormalizer canonicalizes keys on every operation and merge, nil keeps keys as is.
+	// All the replicas must use the same normalizer in order to converge.
+	KeyNormalizer KeyNormalizer
+	// Journal receives the last-writer-wins decisions of merges (see `NewJournal`)
+	Journal ConflictJournal
+	// Observer is notified about every local and merged mutation, e.g. of `lww.Set` and `lww.Graph`
+	Observer Observer
+	// Validator checks values on local operations and on merge, nil accepts any value.
+	// Local operations with invalid values fail, invalid values from other replicas are quarantined
+	// (e.g. `lww.Graph.Quarantined`) instead of being merged.
+	Validator Validator
+	// Compression compresses large values in memory and in the serialized state, e.g. `lww.Graph` vertex values.
+	// Replicas read compressed values regardless of their own settings.
+	Compression Compression
+	// MultiValue makes last-writer-wins CRDTs keep the values overwritten by concurrent writes,
+	// so they can be read along with the winning value (e.g. `lww.Graph.LookupVersions`).
+	// All the replicas should enable it, a replica without it drops the concurrent values when merging.
+	MultiValue bool
+	// CompactEdges makes `lww.Graph` serialize its edges grouped by the source vertex with key prefix elision
+	// and integer timestamps, which makes the state and the sync payloads of dense graphs about half the size.
+	// Every replica reads both encodings, enable it only when all the replicas are upgraded to read it.
+	CompactEdges bool
+	// DualFormat makes CRDTs serialize the state in `FormatDual` unless the format is negotiated with a peer,
+	// so replicas of the previous and the next version read it during a rolling upgrade, see `Format`.
+	// It takes precedence over `CompactEdges`.
+	DualFormat bool
+	// MergeChunk is the number of remote records a merge applies before it briefly releases the lock,
+	// so local operations waiting for it are not starved by large merges (e.g. of `lww.Set` and `lww.Graph`).
+	// Reads and writes between the chunks observe a partially merged state. Zero applies a merge at once.
+	MergeChunk int
+}
+
+// NewReplica returns a replica with the given ID and the default policies:
+// the monotonic system clock, the addition bias, no limits, no logging, no metrics and no conflict journal.
+func NewReplica(id string) Replica {
+	return Replica{ID: id}.WithDefaults()
+}
+
+// WithDefaults returns a copy of the replica with the default values set for all the unset fields.
+func (r Replica) WithDefaults() Replica {
+	if r.Clock == nil {
+		r.Clock = clock.NewMonotonic(clock.System(), clock.MonotonicBump)
+	}
+	if r.Logger == nil {
+		r.Logger = nopLogger{}
+	}
+	if r.Metrics == nil {
+		r.Metrics = nopMetrics{}
+	}
+	if r.Journal == nil {
+		r.Journal = nopJournal{}
+	}
+	if r.Observer == nil {
+		r.Observer = nopObserver{}
+	}
+	return r
+}
+
+// NormalizeKey returns the canonical form of the key using the `KeyNormalizer` if it's set
+func (r Replica) NormalizeKey(key string) string {
+	if r.KeyNormalizer == nil {
+		return key
+	}
+	return r.KeyNormalizer(key)
+}
+
+// ValidateValue returns an error with `ErrInvalidValue` cause if the `Validator` rejects the value,
+// any value is valid if the validator is not set.
+func (r Replica) ValidateValue(key, value string) error {
+	if r.Validator == nil {
+		return nil
+	}
+	err := r.Validator.Validate(key, value)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidValue, "value of key %q: %s", key, err)
+	}
+	return nil
+}
+
+// CheckClock returns an error with `clock.ErrBackwards` cause if the clock rejects new operations,
+// e.g. `clock.Monotonic` with `clock.MonotonicReject` after the time went backwards.
+func (r Replica) CheckClock() error {
+	err := clock.Check(r.Clock)
+	if err != nil {
+		return errors.Wrapf(err, "replica %q", r.ID)
+	}
+	return nil
+}
+
+// CheckLimit returns an error with `ErrLimitExceeded` cause if adding
+// one more element to `count` existing ones would exceed `Limits.MaxElements`.
+func (r Replica) CheckLimit(count int) error {
+	if r.Limits.MaxElements > 0 && count >= r.Limits.MaxElements {
+		return errors.Wrapf(ErrLimitExceeded, "replica %q allows at most %d elements", r.ID, r.Limits.MaxElements)
+	}
+	return nil
+}
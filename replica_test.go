@@ -0,0 +1,75 @@
+package crdt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplica(t *testing.T) {
+	t.Run("fills the defaults for unset fields", func(t *testing.T) {
+		r := Replica{ID: "A"}.WithDefaults()
+
+		require.Equal(t, "A", r.ID)
+		require.NotNil(t, r.Clock)
+		require.NotNil(t, r.Logger)
+		require.NotNil(t, r.Metrics)
+		require.Equal(t, BiasAdd, r.Bias)
+		require.False(t, r.Clock.Now().IsZero())
+	})
+
+	t.Run("the default clock never issues the same timestamp twice", func(t *testing.T) {
+		r := NewReplica("A")
+		last := r.Clock.Now()
+		for i := 0; i < 1000; i++ {
+			now := r.Clock.Now()
+			require.True(t, now.After(last), "%s is not after %s", now, last)
+			last = now
+		}
+	})
+
+	t.Run("CheckLimit", func(t *testing.T) {
+		r := NewReplica("A")
+		require.NoError(t, r.CheckLimit(1000000), "no limit by default")
+
+		r.Limits.MaxElements = 2
+		require.NoError(t, r.CheckLimit(1))
+
+		err := r.CheckLimit(2)
+		require.ErrorIs(t, err, ErrLimitExceeded)
+	})
+
+	t.Run("CheckClock", func(t *testing.T) {
+		r := NewReplica("A")
+		require.NoError(t, r.CheckClock(), "the system clock is never rejected")
+
+		now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+		r.Clock = clock.NewMonotonic(clock.Func(func() time.Time { return now }), clock.MonotonicReject)
+		r.Clock.Now()
+		require.NoError(t, r.CheckClock())
+
+		now = now.Add(-time.Second)
+		err := r.CheckClock()
+		require.ErrorIs(t, err, clock.ErrBackwards)
+		require.Contains(t, err.Error(), `replica "A"`)
+	})
+
+	t.Run("ValidateValue", func(t *testing.T) {
+		r := NewReplica("A")
+		require.NoError(t, r.ValidateValue("key", "anything"), "no validation by default")
+
+		r.Validator = ValidatorFunc(func(key, value string) error {
+			if value == "" {
+				return errors.New("empty")
+			}
+			return nil
+		})
+		require.NoError(t, r.ValidateValue("key", "value"))
+		err := r.ValidateValue("key", "")
+		require.ErrorIs(t, err, ErrInvalidValue)
+		require.Contains(t, err.Error(), "empty")
+	})
+}
@@ -0,0 +1,324 @@
+// Package gossip implements gossip-based anti-entropy replication.
+//
+// Every round a `Gossiper` picks random peers and, for every replicated CRDT,
+// compares the digest of its local state with the peer's one.
+// When the digests differ the state is exchanged and merged on both sides,
+// so all the replicas eventually converge even if some rounds fail.
+//
+// The network is abstracted by the `Transport` interface, it can be implemented
+// on top of the `replication/httpsync` or `replication/grpc` clients.
+//
+// Operators can block a misbehaving peer at runtime with `Gossiper.BlockPeer`. If the gossiper quarantines
+// blocked peers (see `Gossiper.WithQuarantine`), their state is still received but kept aside instead of being merged,
+// `Gossiper.ReleasePeer` merges it later and `Gossiper.DiscardPeer` drops it.
+package gossip
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+const (
+	// DefaultFanOut is the number of peers contacted every round if not configured
+	DefaultFanOut = 1
+	// DefaultInterval is the interval between rounds if not configured
+	DefaultInterval = time.Second
+)
+
+var (
+	// ErrNoPeers occurs when a round is started without any peers configured
+	ErrNoPeers = errors.New("no peers to gossip with")
+	// ErrUnknownPeer occurs when a peer is not one of the current peers
+	ErrUnknownPeer = errors.New("unknown peer")
+)
+
+// Transport sends gossip requests to peers
+type Transport interface {
+	// Digest returns the digest of the state of the CRDT the `peer` replicates under the given name.
+	// It must be computed the same way as the `Digest` function does.
+	Digest(ctx context.Context, peer, name string) (string, error)
+	// Exchange sends the state of the `local` CRDT to the `peer` and merges the state returned by the peer,
+	// after the exchange both replicas must have the same state.
+	Exchange(ctx context.Context, peer, name string, local crdt.CRDT) error
+}
+
+// Config contains the settings of the gossip
+type Config struct {
+	// Peers is a list of peer addresses passed to the transport
+	Peers []string
+	// FanOut is the number of random peers contacted every round, `DefaultFanOut` if zero
+	FanOut int
+	// Interval is the interval between rounds, `DefaultInterval` if zero
+	Interval time.Duration
+	// Seed initializes the random peer selection, the current time is used if zero
+	Seed int64
+	// Selection is the strategy of picking peers every round, `RandomSelection` if zero
+	Selection Selection
+}
+
+// Selection is a strategy of picking peers for a gossip round
+type Selection int
+
+const (
+	// RandomSelection picks peers uniformly at random
+	RandomSelection Selection = iota
+	// LatencyAwareSelection prefers nearby peers (low round-trip time) that were recently divergent,
+	// it improves the convergence speed in geo-distributed deployments. Every peer still has a chance
+	// to be picked, so peers that became divergent or closer are discovered.
+	LatencyAwareSelection
+)
+
+// Digest returns a digest of the CRDT state, it's equal for replicas with the same state.
+func Digest(c crdt.CRDT) (string, error) {
+	state, err := crdt.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(state)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// NewGossiper creates a gossiper replicating CRDTs with peers using the given transport.
+// `r` is used for logging, metrics and measuring the round-trip time of peers.
+func NewGossiper(r crdt.Replica, transport Transport, cfg Config) Gossiper {
+	r = r.WithDefaults()
+	if cfg.FanOut <= 0 {
+		cfg.FanOut = DefaultFanOut
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+
+	// nolint:gosec // the peer selection does not need to be cryptographically secure
+	random := rand.New(rand.NewSource(cfg.Seed))
+
+	g := Gossiper{
+		mutex:      &sync.Mutex{},
+		replica:    r,
+		transport:  transport,
+		cfg:        cfg,
+		peers:      make(map[string]*PeerStats, len(cfg.Peers)),
+		random:     random,
+		objects:    make(map[string]crdt.CRDT),
+		quarantine: make(map[string]map[string]crdt.CRDT),
+	}
+	g.SetPeers(cfg.Peers)
+
+	return g
+}
+
+// Gossiper periodically replicates CRDTs with random peers.
+// Use `NewGossiper` in order to initialize it before use.
+// The gossiper is thread-safe and can be used from several go routines.
+type Gossiper struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is used for logging and metrics
+	replica crdt.Replica
+	// transport sends requests to peers
+	transport Transport
+	// cfg contains the gossip settings
+	cfg Config
+	// peers maps the current peers to their statistics
+	peers map[string]*PeerStats
+	// random is used for picking peers
+	random *rand.Rand
+	// objects maps a name to the replicated CRDT
+	objects map[string]crdt.CRDT
+	// registry creates the CRDTs keeping the state received from blocked peers, nil if they're not quarantined
+	registry *crdt.Registry
+	// quarantine maps a blocked peer to the CRDTs keeping its state by name
+	quarantine map[string]map[string]crdt.CRDT
+}
+
+// WithQuarantine returns a copy of the gossiper that keeps gossiping with blocked peers
+// but merges their state into the quarantine instead of the replicated CRDTs, nothing but the quarantined
+// state is sent back to them. `registry` creates the empty CRDTs of the quarantine,
+// all the kinds of the replicated CRDTs must be registered. The copy shares the peers,
+// the replicated CRDTs and the quarantine with the gossiper.
+func (g Gossiper) WithQuarantine(registry crdt.Registry) Gossiper {
+	g.registry = &registry
+	return g
+}
+
+// Replicate adds the CRDT to the gossip under the given name.
+// Peers must replicate the same CRDT under the same name.
+func (g Gossiper) Replicate(name string, c crdt.CRDT) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.objects[name] = c
+}
+
+// SetPeers replaces the list of peers, it takes effect in the next round.
+// Kept peers keep their statistics and remain blocked if they were blocked.
+func (g Gossiper) SetPeers(peers []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	keep := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		keep[peer] = true
+		_, exists := g.peers[peer]
+		if !exists {
+			g.peers[peer] = &PeerStats{}
+		}
+	}
+	// statistics of the remaining peers are kept
+	for peer := range g.peers {
+		if !keep[peer] {
+			delete(g.peers, peer)
+			delete(g.quarantine, peer)
+		}
+	}
+}
+
+// Run starts gossip rounds with the configured interval until the context is done.
+// Failed rounds are logged and don't stop the gossip. Returns the context error.
+func (g Gossiper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(g.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			err := g.Round(ctx)
+			if err != nil {
+				g.replica.Logger.Printf("gossip round of replica %q failed: %s", g.replica.ID, err)
+			}
+		}
+	}
+}
+
+// Round runs a single gossip round: picks `FanOut` random peers and replicates
+// every CRDT which digest differs from the peer's one. The state of blocked peers is quarantined,
+// see `WithQuarantine`.
+// A failure with one peer does not stop the round, the first error is returned after all the peers are contacted.
+func (g Gossiper) Round(ctx context.Context) error {
+	peers, objects, err := g.pick()
+	if err != nil {
+		return err
+	}
+	g.replica.Metrics.Count("gossip.round", 1)
+
+	var firstErr error
+	for _, peer := range peers {
+		for name, c := range objects {
+			err := g.sync(ctx, peer, name, c)
+			if err != nil {
+				g.replica.Metrics.Count("gossip.error", 1)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// pick returns random peers for the next round and a copy of the replicated CRDTs.
+// Blocked peers are picked only if their state is quarantined.
+func (g Gossiper) pick() (peers []string, objects map[string]crdt.CRDT, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	peers = make([]string, 0, len(g.peers))
+	for peer, stats := range g.peers {
+		if !stats.Blocked || g.registry != nil {
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) == 0 {
+		return nil, nil, ErrNoPeers
+	}
+	// sorting makes the selection deterministic for the same seed
+	sort.Strings(peers)
+	if g.cfg.Selection == LatencyAwareSelection {
+		g.weightedShuffle(peers)
+	} else {
+		g.random.Shuffle(len(peers), func(i, j int) {
+			peers[i], peers[j] = peers[j], peers[i]
+		})
+	}
+	if len(peers) > g.cfg.FanOut {
+		peers = peers[:g.cfg.FanOut]
+	}
+
+	objects = make(map[string]crdt.CRDT, len(g.objects))
+	for name, c := range g.objects {
+		objects[name] = c
+	}
+
+	return peers, objects, nil
+}
+
+// sync compares the digests of the local and the peer's state and exchanges the state if they differ,
+// the state of a blocked peer is received into its quarantine
+func (g Gossiper) sync(ctx context.Context, peer, name string, c crdt.CRDT) error {
+	local, err := Digest(c)
+	if err != nil {
+		return errors.Wrapf(err, "failed to compute the digest of %q", name)
+	}
+
+	started := g.replica.Clock.Now()
+	remote, err := g.transport.Digest(ctx, peer, name)
+	if err != nil {
+		g.observe(peer, 0, false, err)
+		return errors.Wrapf(err, "failed to get the digest of %q from peer %q", name, peer)
+	}
+	g.observe(peer, g.replica.Clock.Now().Sub(started), local != remote, nil)
+
+	if local == remote {
+		return nil
+	}
+
+	quarantine, blocked, err := g.quarantined(peer, name, c.Kind())
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return g.receive(ctx, peer, name, quarantine, remote)
+	}
+
+	err = g.transport.Exchange(ctx, peer, name, c)
+	if err != nil {
+		return errors.Wrapf(err, "failed to exchange %q with peer %q", name, peer)
+	}
+	g.replica.Metrics.Count("gossip.exchange", 1)
+
+	return nil
+}
+
+// receive merges the state of the blocked peer into its quarantine unless the quarantine has the same digest
+func (g Gossiper) receive(ctx context.Context, peer, name string, quarantine crdt.CRDT, remote string) error {
+	local, err := Digest(quarantine)
+	if err != nil {
+		return errors.Wrapf(err, "failed to compute the digest of quarantined %q", name)
+	}
+	if local == remote {
+		return nil
+	}
+
+	err = g.transport.Exchange(ctx, peer, name, quarantine)
+	if err != nil {
+		return errors.Wrapf(err, "failed to quarantine %q of blocked peer %q", name, peer)
+	}
+	g.replica.Metrics.Count("gossip.quarantine", 1)
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package gossip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryTransport delivers gossip requests to the objects of other replicas in the same process
+type memoryTransport struct {
+	// registry is used for copying the state between replicas
+	registry crdt.Registry
+	// peers maps a peer address to its replicated objects
+	peers map[string]map[string]crdt.CRDT
+	// exchanges counts the exchanges per peer
+	exchanges map[string]int
+	// failing contains the peers that fail every request
+	failing map[string]bool
+}
+
+var errPeerDown = errors.New("peer is down")
+
+func (t *memoryTransport) Digest(ctx context.Context, peer, name string) (string, error) {
+	if t.failing[peer] {
+		return "", errPeerDown
+	}
+	return Digest(t.peers[peer][name])
+}
+
+func (t *memoryTransport) Exchange(ctx context.Context, peer, name string, local crdt.CRDT) error {
+	if t.failing[peer] {
+		return errPeerDown
+	}
+	t.exchanges[peer]++
+
+	remote := t.peers[peer][name]
+	if err := mergeCopy(t.registry, remote, local); err != nil {
+		return err
+	}
+	return mergeCopy(t.registry, local, remote)
+}
+
+// mergeCopy merges a deserialized copy of `from` into `to`, so they don't share any state
+func mergeCopy(registry crdt.Registry, to, from crdt.CRDT) error {
+	data, err := crdt.Marshal(from)
+	if err != nil {
+		return err
+	}
+	c, err := registry.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	return to.MergeCRDT(c)
+}
+
+func TestGossiper(t *testing.T) {
+	names := []string{"A", "B", "C", "D"}
+
+	setup := func(t *testing.T) (*memoryTransport, map[string]Gossiper, map[string]counter.PN) {
+		registry := crdt.NewRegistry()
+		require.NoError(t, counter.Register(registry, crdt.NewReplica("registry")))
+
+		transport := &memoryTransport{
+			registry:  registry,
+			peers:     make(map[string]map[string]crdt.CRDT),
+			exchanges: make(map[string]int),
+			failing:   make(map[string]bool),
+		}
+		gossipers := make(map[string]Gossiper)
+		counters := make(map[string]counter.PN)
+
+		for i, name := range names {
+			replica := crdt.NewReplica(name)
+			pn := counter.NewPN(replica)
+			pn.Add(int64(i + 1))
+			counters[name] = pn
+			transport.peers[name] = map[string]crdt.CRDT{"counter": pn}
+
+			var peers []string
+			for _, peer := range names {
+				if peer != name {
+					peers = append(peers, peer)
+				}
+			}
+			g := NewGossiper(replica, transport, Config{Peers: peers, Seed: int64(i + 1)})
+			g.Replicate("counter", pn)
+			gossipers[name] = g
+		}
+
+		return transport, gossipers, counters
+	}
+
+	t.Run("replicas converge after several rounds", func(t *testing.T) {
+		_, gossipers, counters := setup(t)
+
+		for round := 0; round < 10; round++ {
+			for _, name := range names {
+				require.NoError(t, gossipers[name].Round(context.Background()))
+			}
+		}
+
+		for _, name := range names {
+			require.Equal(t, int64(1+2+3+4), counters[name].Value(), "replica %s", name)
+		}
+	})
+
+	t.Run("does not exchange the state when the digests are equal", func(t *testing.T) {
+		transport, gossipers, counters := setup(t)
+		for _, name := range names {
+			for _, other := range names {
+				counters[name].Merge(counters[other])
+			}
+		}
+
+		require.NoError(t, gossipers["A"].Round(context.Background()))
+		require.Empty(t, transport.exchanges)
+	})
+
+	t.Run("contacts FanOut peers per round", func(t *testing.T) {
+		transport, _, _ := setup(t)
+		replica := crdt.NewReplica("E")
+		g := NewGossiper(replica, transport, Config{Peers: names, FanOut: 3})
+		g.Replicate("counter", counter.NewPN(replica))
+
+		require.NoError(t, g.Round(context.Background()))
+		require.Len(t, transport.exchanges, 3)
+	})
+
+	t.Run("returns the first error but contacts the rest of peers", func(t *testing.T) {
+		transport, _, _ := setup(t)
+		transport.failing["A"] = true
+
+		replica := crdt.NewReplica("E")
+		g := NewGossiper(replica, transport, Config{Peers: names, FanOut: len(names)})
+		g.Replicate("counter", counter.NewPN(replica))
+
+		err := g.Round(context.Background())
+		require.ErrorIs(t, err, errPeerDown)
+		require.Len(t, transport.exchanges, 3)
+	})
+
+	t.Run("returns ErrNoPeers without peers", func(t *testing.T) {
+		transport, _, _ := setup(t)
+		g := NewGossiper(crdt.NewReplica("E"), transport, Config{})
+		require.ErrorIs(t, g.Round(context.Background()), ErrNoPeers)
+
+		g.SetPeers([]string{"A"})
+		require.NoError(t, g.Round(context.Background()))
+	})
+
+	t.Run("Run gossips until the context is done", func(t *testing.T) {
+		registry := crdt.NewRegistry()
+		require.NoError(t, lww.Register(registry, crdt.NewReplica("registry")))
+		v := lww.Vertex{Key: "vertex", Value: "value"}
+
+		A := lww.NewGraph(crdt.NewReplica("A"))
+		B := lww.NewGraph(crdt.NewReplica("B"))
+		require.NoError(t, B.AddVertex(v))
+
+		transport := &memoryTransport{
+			registry:  registry,
+			peers:     map[string]map[string]crdt.CRDT{"B": {"graph": B}},
+			exchanges: make(map[string]int),
+		}
+		g := NewGossiper(crdt.NewReplica("A"), transport, Config{Peers: []string{"B"}, Interval: time.Millisecond})
+		g.Replicate("graph", A)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, g.Run(ctx), context.DeadlineExceeded)
+
+		found, err := A.Lookup(v.Key)
+		require.NoError(t, err)
+		require.Equal(t, v, found)
+	})
+}
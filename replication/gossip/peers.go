@@ -0,0 +1,228 @@
+package gossip
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+const (
+	// statsSmoothing is the weight of the latest observation in the moving averages of the peer statistics
+	statsSmoothing = 0.3
+	// minUsefulness keeps peers that were never divergent recently in the selection
+	minUsefulness = 0.05
+)
+
+// PeerStats contains the statistics of a peer collected while gossiping
+type PeerStats struct {
+	// RTT is the moving average of the round-trip time of digest requests
+	RTT time.Duration
+	// Usefulness is the moving average of the share of digest requests that found divergent states,
+	// 1 means the peer always had changes to exchange, 0 means it was always in sync
+	Usefulness float64
+	// Failures is the number of consecutive failed requests
+	Failures int
+	// Observations is the number of successful digest requests
+	Observations int
+	// Blocked is `true` if the peer is blocked by `BlockPeer`
+	Blocked bool
+	// Quarantined is `true` if the state received from the blocked peer is kept in the quarantine,
+	// see `Gossiper.WithQuarantine`
+	Quarantined bool
+}
+
+// BlockPeer blocks the peer or unblocks it if `blocked` is `false`, e.g. when the peer misbehaves.
+// The state of a blocked peer is never merged: the peer is excluded from the gossip rounds
+// or its state is quarantined if the gossiper was created by `WithQuarantine`.
+// Unblocking the peer drops its quarantine, its state is merged by the next rounds anyway.
+// It takes effect in the next round. Returns `false` if the peer is not one of the current peers.
+func (g Gossiper) BlockPeer(peer string, blocked bool) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	stats, exists := g.peers[peer]
+	if !exists {
+		return false
+	}
+	stats.Blocked = blocked
+	if !blocked {
+		delete(g.quarantine, peer)
+	}
+	return true
+}
+
+// ReleasePeer merges the quarantined state of the blocked peer into the replicated CRDTs and unblocks the peer.
+// If merging fails, the peer remains blocked and the release can be retried.
+// Returns an error with `ErrUnknownPeer` cause if the peer is not one of the current peers.
+func (g Gossiper) ReleasePeer(peer string) error {
+	quarantine, objects, err := g.quarantineOf(peer)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(quarantine))
+	for name := range quarantine {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err = objects[name].MergeCRDT(quarantine[name])
+		if err != nil {
+			return errors.Wrapf(err, "failed to release %q of peer %q", name, peer)
+		}
+	}
+	g.replica.Metrics.Count("gossip.release", 1)
+
+	if !g.BlockPeer(peer, false) {
+		return errors.Wrapf(ErrUnknownPeer, "failed to release peer %q", peer)
+	}
+	return nil
+}
+
+// DiscardPeer drops the quarantined state of the blocked peer, the peer remains blocked,
+// so its state is quarantined again by the next rounds.
+// Returns `false` if the peer is not one of the current peers.
+func (g Gossiper) DiscardPeer(peer string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, exists := g.peers[peer]; !exists {
+		return false
+	}
+	delete(g.quarantine, peer)
+	return true
+}
+
+// PeerStats returns a copy of the statistics of the current peers
+func (g Gossiper) PeerStats() map[string]PeerStats {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	stats := make(map[string]PeerStats, len(g.peers))
+	for peer, s := range g.peers {
+		stats[peer] = *s
+		if len(g.quarantine[peer]) != 0 {
+			peerStats := stats[peer]
+			peerStats.Quarantined = true
+			stats[peer] = peerStats
+		}
+	}
+	return stats
+}
+
+// quarantined returns the CRDT keeping the state of the blocked peer received for the given name,
+// it's created on the first call. `blocked` is `false` if the peer is not blocked or not quarantined.
+func (g Gossiper) quarantined(peer, name string, kind crdt.Kind) (c crdt.CRDT, blocked bool, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	stats, exists := g.peers[peer]
+	if !exists || !stats.Blocked || g.registry == nil {
+		return nil, false, nil
+	}
+
+	c, exists = g.quarantine[peer][name]
+	if exists {
+		return c, true, nil
+	}
+	c, err = g.registry.New(kind)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to quarantine %q of peer %q", name, peer)
+	}
+	if g.quarantine[peer] == nil {
+		g.quarantine[peer] = make(map[string]crdt.CRDT)
+	}
+	g.quarantine[peer][name] = c
+	return c, true, nil
+}
+
+// quarantineOf returns a copy of the quarantine of the peer and the replicated CRDTs it's merged into
+func (g Gossiper) quarantineOf(peer string) (quarantine, objects map[string]crdt.CRDT, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, exists := g.peers[peer]; !exists {
+		return nil, nil, errors.Wrapf(ErrUnknownPeer, "failed to release peer %q", peer)
+	}
+	quarantine = make(map[string]crdt.CRDT, len(g.quarantine[peer]))
+	objects = make(map[string]crdt.CRDT, len(g.quarantine[peer]))
+	for name, c := range g.quarantine[peer] {
+		quarantine[name] = c
+		objects[name] = g.objects[name]
+	}
+	return quarantine, objects, nil
+}
+
+// observe updates the statistics of the peer with the result of a digest request
+func (g Gossiper) observe(peer string, rtt time.Duration, divergent bool, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	stats, exists := g.peers[peer]
+	if !exists {
+		// the peer was removed during the round
+		return
+	}
+
+	if err != nil {
+		stats.Failures++
+		return
+	}
+	stats.Failures = 0
+
+	usefulness := 0.0
+	if divergent {
+		usefulness = 1
+	}
+	if stats.Observations == 0 {
+		stats.RTT = rtt
+		stats.Usefulness = usefulness
+	} else {
+		stats.RTT = time.Duration(statsSmoothing*float64(rtt) + (1-statsSmoothing)*float64(stats.RTT))
+		stats.Usefulness = statsSmoothing*usefulness + (1-statsSmoothing)*stats.Usefulness
+	}
+	stats.Observations++
+}
+
+// weight returns the selection weight of a peer, higher for nearby and divergent peers.
+// `unknown` is returned for peers without observations, so they get explored.
+func (s PeerStats) weight(unknown float64) float64 {
+	if s.Observations == 0 {
+		return unknown
+	}
+
+	rtt := s.RTT.Seconds() * 1000
+	if rtt < 1 {
+		rtt = 1
+	}
+	weight := math.Max(s.Usefulness, minUsefulness) / rtt
+	// every consecutive failure halves the chance to be picked
+	return weight / math.Pow(2, float64(s.Failures))
+}
+
+// weightedShuffle orders the peers randomly so that peers with a higher weight tend to come first.
+// It's the weighted random sampling without replacement by Efraimidis and Spirakis:
+// every peer gets the key `u^(1/weight)` for a uniform random `u`, peers are sorted by the key.
+// Must be called under the lock.
+func (g Gossiper) weightedShuffle(peers []string) {
+	unknown := 0.0
+	for _, peer := range peers {
+		unknown = math.Max(unknown, g.peers[peer].weight(0))
+	}
+	if unknown == 0 {
+		unknown = 1
+	}
+
+	keys := make(map[string]float64, len(peers))
+	for _, peer := range peers {
+		keys[peer] = math.Pow(g.random.Float64(), 1/g.peers[peer].weight(unknown))
+	}
+
+	sort.SliceStable(peers, func(i, j int) bool {
+		return keys[peers[i]] > keys[peers[j]]
+	})
+}
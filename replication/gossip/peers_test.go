@@ -0,0 +1,228 @@
+package gossip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/counter"
+	"github.com/stretchr/testify/require"
+)
+
+// latencyTransport simulates peers with different round-trip times by advancing a fake clock
+type latencyTransport struct {
+	// now is the current time of the fake clock
+	now *time.Time
+	// latencies maps a peer to its round-trip time
+	latencies map[string]time.Duration
+	// divergent contains the peers which digest always differs
+	divergent map[string]bool
+	// failing contains the peers that fail every request
+	failing map[string]bool
+	// picked counts the digest requests per peer
+	picked map[string]int
+	// local is the replicated CRDT, peers that are not divergent return its digest
+	local crdt.CRDT
+}
+
+func (t *latencyTransport) Digest(ctx context.Context, peer, name string) (string, error) {
+	t.picked[peer]++
+	*t.now = t.now.Add(t.latencies[peer])
+	if t.failing[peer] {
+		return "", errPeerDown
+	}
+	if t.divergent[peer] {
+		return "divergent", nil
+	}
+	return Digest(t.local)
+}
+
+func (t *latencyTransport) Exchange(ctx context.Context, peer, name string, local crdt.CRDT) error {
+	return nil
+}
+
+func TestPeerSelection(t *testing.T) {
+	setup := func(selection Selection) (*latencyTransport, Gossiper) {
+		now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+		transport := &latencyTransport{
+			now: &now,
+			latencies: map[string]time.Duration{
+				"near-divergent": 5 * time.Millisecond,
+				"near-in-sync":   5 * time.Millisecond,
+				"far-divergent":  200 * time.Millisecond,
+			},
+			divergent: map[string]bool{"near-divergent": true, "far-divergent": true},
+			failing:   make(map[string]bool),
+			picked:    make(map[string]int),
+		}
+
+		r := crdt.NewReplica("local")
+		r.Clock = clock.Func(func() time.Time {
+			return *transport.now
+		})
+		g := NewGossiper(r, transport, Config{
+			Peers:     []string{"near-divergent", "near-in-sync", "far-divergent"},
+			Seed:      42,
+			Selection: selection,
+		})
+		transport.local = counter.NewPN(r)
+		g.Replicate("counter", transport.local)
+
+		return transport, g
+	}
+
+	t.Run("collects peer statistics", func(t *testing.T) {
+		transport, g := setup(RandomSelection)
+		g.SetPeers([]string{"near-divergent"})
+		require.NoError(t, g.Round(context.Background()))
+		require.NoError(t, g.Round(context.Background()))
+
+		stats := g.PeerStats()
+		require.Equal(t, PeerStats{
+			RTT:          5 * time.Millisecond,
+			Usefulness:   1,
+			Observations: 2,
+		}, stats["near-divergent"])
+
+		transport.failing["near-divergent"] = true
+		require.ErrorIs(t, g.Round(context.Background()), errPeerDown)
+		require.Equal(t, 1, g.PeerStats()["near-divergent"].Failures)
+
+		g.SetPeers([]string{"near-divergent", "far-divergent"})
+		require.Equal(t, 2, g.PeerStats()["near-divergent"].Observations, "statistics of kept peers must remain")
+	})
+
+	t.Run("skips blocked peers", func(t *testing.T) {
+		transport, g := setup(RandomSelection)
+		require.True(t, g.BlockPeer("near-divergent", true))
+		require.True(t, g.BlockPeer("far-divergent", true))
+		require.False(t, g.BlockPeer("unknown", true))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, g.Round(context.Background()))
+		}
+		require.Equal(t, map[string]int{"near-in-sync": 10}, transport.picked)
+		require.True(t, g.PeerStats()["near-divergent"].Blocked)
+
+		g.SetPeers([]string{"near-divergent", "near-in-sync"})
+		require.True(t, g.BlockPeer("near-in-sync", true))
+		require.ErrorIs(t, g.Round(context.Background()), ErrNoPeers, "all the peers are blocked")
+
+		require.True(t, g.BlockPeer("near-divergent", false))
+		require.NoError(t, g.Round(context.Background()))
+		require.Equal(t, 1, transport.picked["near-divergent"])
+	})
+
+	t.Run("prefers nearby divergent peers", func(t *testing.T) {
+		transport, g := setup(LatencyAwareSelection)
+		for i := 0; i < 300; i++ {
+			require.NoError(t, g.Round(context.Background()))
+		}
+
+		require.Greater(t, transport.picked["near-divergent"], 200)
+		require.Greater(t, transport.picked["near-divergent"], 5*transport.picked["near-in-sync"])
+		require.Greater(t, transport.picked["near-divergent"], 5*transport.picked["far-divergent"])
+		require.Greater(t, transport.picked["near-in-sync"], 0, "every peer must still have a chance")
+		require.Greater(t, transport.picked["far-divergent"], 0, "every peer must still have a chance")
+	})
+
+	t.Run("picks peers uniformly by default", func(t *testing.T) {
+		transport, g := setup(RandomSelection)
+		for i := 0; i < 300; i++ {
+			require.NoError(t, g.Round(context.Background()))
+		}
+
+		for _, picked := range transport.picked {
+			require.Greater(t, picked, 70)
+		}
+	})
+}
+
+func TestQuarantine(t *testing.T) {
+	setup := func(t *testing.T) (*memoryTransport, Gossiper, counter.PN, counter.PN) {
+		registry := crdt.NewRegistry()
+		require.NoError(t, counter.Register(registry, crdt.NewReplica("registry")))
+
+		A := counter.NewPN(crdt.NewReplica("A"))
+		A.Add(1)
+		B := counter.NewPN(crdt.NewReplica("B"))
+		B.Add(2)
+
+		transport := &memoryTransport{
+			registry:  registry,
+			peers:     map[string]map[string]crdt.CRDT{"B": {"counter": B}},
+			exchanges: make(map[string]int),
+			failing:   make(map[string]bool),
+		}
+		g := NewGossiper(crdt.NewReplica("A"), transport, Config{Peers: []string{"B"}}).WithQuarantine(registry)
+		g.Replicate("counter", A)
+		require.True(t, g.BlockPeer("B", true))
+
+		return transport, g, A, B
+	}
+
+	t.Run("keeps the state of blocked peers without merging it", func(t *testing.T) {
+		transport, g, A, B := setup(t)
+		require.NoError(t, g.Round(context.Background()))
+		require.Equal(t, int64(1), A.Value())
+		require.Equal(t, int64(2), B.Value(), "the local state must not be sent")
+		require.Equal(t, PeerStats{Blocked: true, Quarantined: true}, withoutObservations(g.PeerStats()["B"]))
+
+		require.NoError(t, g.Round(context.Background()))
+		require.Equal(t, 1, transport.exchanges["B"], "the quarantine has the state of the peer already")
+
+		B.Add(3)
+		require.NoError(t, g.Round(context.Background()))
+		require.Equal(t, 2, transport.exchanges["B"])
+		require.Equal(t, int64(1), A.Value())
+	})
+
+	t.Run("merges the quarantined state on release", func(t *testing.T) {
+		_, g, A, _ := setup(t)
+		require.NoError(t, g.Round(context.Background()))
+
+		require.NoError(t, g.ReleasePeer("B"))
+		require.Equal(t, int64(3), A.Value())
+		require.Equal(t, PeerStats{}, withoutObservations(g.PeerStats()["B"]))
+		require.ErrorIs(t, g.ReleasePeer("unknown"), ErrUnknownPeer)
+	})
+
+	t.Run("drops the quarantined state on discard and keeps the peer blocked", func(t *testing.T) {
+		_, g, A, _ := setup(t)
+		require.NoError(t, g.Round(context.Background()))
+
+		require.True(t, g.DiscardPeer("B"))
+		require.False(t, g.DiscardPeer("unknown"))
+		require.Equal(t, PeerStats{Blocked: true}, withoutObservations(g.PeerStats()["B"]))
+		require.NoError(t, g.ReleasePeer("B"))
+		require.Equal(t, int64(1), A.Value(), "the discarded state must not be merged")
+	})
+
+	t.Run("drops the quarantined state when the peer is unblocked or removed", func(t *testing.T) {
+		_, g, _, _ := setup(t)
+		require.NoError(t, g.Round(context.Background()))
+		require.True(t, g.BlockPeer("B", false))
+		require.False(t, g.PeerStats()["B"].Quarantined)
+
+		require.True(t, g.BlockPeer("B", true))
+		require.NoError(t, g.Round(context.Background()))
+		g.SetPeers([]string{"C"})
+		g.SetPeers([]string{"B"})
+		require.True(t, g.BlockPeer("B", true))
+		require.False(t, g.PeerStats()["B"].Quarantined)
+	})
+
+	t.Run("fails the round if the kind is not registered", func(t *testing.T) {
+		transport, _, _, _ := setup(t)
+		g := NewGossiper(crdt.NewReplica("A"), transport, Config{Peers: []string{"B"}}).WithQuarantine(crdt.NewRegistry())
+		g.Replicate("counter", counter.NewPN(crdt.NewReplica("A")))
+		require.True(t, g.BlockPeer("B", true))
+		require.ErrorIs(t, g.Round(context.Background()), crdt.ErrUnknownKind)
+	})
+}
+
+// withoutObservations returns the peer statistics without the statistics of requests
+func withoutObservations(stats PeerStats) PeerStats {
+	return PeerStats{Blocked: stats.Blocked, Quarantined: stats.Quarantined}
+}
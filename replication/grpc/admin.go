@@ -0,0 +1,536 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/replication/gossip"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// AdminServiceName is the full name of the gRPC admin service
+	AdminServiceName = "crdt.replication.AdminService"
+
+	// authorizationHeader is the metadata key carrying the admin token
+	authorizationHeader = "authorization"
+	// bearerPrefix precedes the admin token in the authorization header
+	bearerPrefix = "Bearer "
+)
+
+var (
+	// ErrNoToken occurs when the admin service is configured without a token
+	ErrNoToken = errors.New("admin token is required")
+)
+
+// PeerManager manages the replication peers of a live replica, `gossip.Gossiper` implements it
+type PeerManager interface {
+	// PeerStats returns the statistics of the current peers
+	PeerStats() map[string]gossip.PeerStats
+	// BlockPeer excludes the peer from the replication or includes it back,
+	// returns `false` if the peer is unknown
+	BlockPeer(peer string, blocked bool) bool
+	// ReleasePeer merges the quarantined state of the blocked peer and unblocks it,
+	// returns an error with `gossip.ErrUnknownPeer` cause if the peer is unknown
+	ReleasePeer(peer string) error
+	// DiscardPeer drops the quarantined state of the blocked peer keeping it blocked,
+	// returns `false` if the peer is unknown
+	DiscardPeer(peer string) bool
+}
+
+// ConflictSource returns the last-writer-wins decisions recorded between two moments, `crdt.Journal` implements it
+type ConflictSource interface {
+	// Conflicts returns the decisions made between `from` and `to`
+	Conflicts(from, to time.Time) []crdt.Conflict
+}
+
+// ManagedGraph is a graph of a live replica managed by the admin service
+type ManagedGraph struct {
+	// Graph is the managed graph
+	Graph lww.Graph
+	// Compact compacts the persisted state of the graph (e.g. `storage.Graph.Checkpoint`),
+	// nil if the graph is not persisted
+	Compact func() error
+	// Conflicts is the conflict journal of the graph replica used by `Explain`, nil if there is none
+	Conflicts ConflictSource
+}
+
+// AdminConfig contains the settings of the admin service
+type AdminConfig struct {
+	// Token authenticates operators, every call must carry it in the `authorization: Bearer <token>` metadata.
+	// It's required, use TLS in order to keep it secret on the wire.
+	Token string
+	// Peers manages the replication peers, nil makes the peer RPCs fail with `Unimplemented`
+	Peers PeerManager
+	// StatsPathSamples limits the number of vertices sampled for the average path length of `Stats`,
+	// see `lww.Graph.TopologyStats`
+	StatsPathSamples int
+}
+
+// PeerInfo describes a replication peer
+type PeerInfo struct {
+	// Peer is the address of the peer
+	Peer string `json:"peer"`
+	// Stats are the replication statistics of the peer
+	Stats gossip.PeerStats `json:"stats"`
+}
+
+// PeersResponse lists the replication peers sorted by address, used by `ListPeers`
+type PeersResponse struct {
+	Peers []PeerInfo `json:"peers"`
+}
+
+// BlockPeerRequest blocks or unblocks a replication peer, used by `BlockPeer`
+type BlockPeerRequest struct {
+	// Peer is the address of the peer
+	Peer string `json:"peer"`
+	// Blocked excludes the peer from the replication if `true`, includes it back otherwise
+	Blocked bool `json:"blocked"`
+}
+
+// ReleasePeerRequest releases or discards the quarantined state of a blocked replication peer, used by `ReleasePeer`
+type ReleasePeerRequest struct {
+	// Peer is the address of the peer
+	Peer string `json:"peer"`
+	// Discard drops the quarantined state keeping the peer blocked if `true`,
+	// merges the state and unblocks the peer otherwise
+	Discard bool `json:"discard"`
+}
+
+// SnapshotResponse carries a point-in-time snapshot of a graph (see `lww.Graph.Snapshot`), used by `Snapshot`
+type SnapshotResponse struct {
+	Snapshot []byte `json:"snapshot"`
+}
+
+// StatsResponse carries the statistics of a graph, used by `Stats`
+type StatsResponse struct {
+	// Topology contains the topology metrics of the graph
+	Topology lww.TopologyStats `json:"topology"`
+	// Actors breaks the state down by the replicas that wrote it
+	Actors []lww.ActorStats `json:"actors"`
+	// Quarantined is the number of quarantined vertex values
+	Quarantined int `json:"quarantined"`
+}
+
+// QuarantineRequest lists the quarantined vertex values of a graph, used by `Quarantine`
+type QuarantineRequest struct {
+	// Name is the name of the managed graph
+	Name string `json:"name"`
+	// Clear clears the quarantine after listing it
+	Clear bool `json:"clear"`
+}
+
+// QuarantineResponse lists the quarantined vertex values sorted by key, used by `Quarantine`
+type QuarantineResponse struct {
+	Vertices []lww.QuarantinedVertex `json:"vertices"`
+}
+
+// ExplainRequest asks why a vertex of a graph has its current state, used by `Explain`
+type ExplainRequest struct {
+	// Name is the name of the managed graph
+	Name string `json:"name"`
+	// Key is the key of the vertex
+	Key string `json:"key"`
+}
+
+// ExplainResponse explains the current state of a vertex, used by `Explain`
+type ExplainResponse struct {
+	// Exists is `true` if the vertex is in the graph
+	Exists bool `json:"exists"`
+	// LastWrite is the operation that decided the current state, nil if the key was never written
+	LastWrite *lww.Write `json:"lastWrite,omitempty"`
+	// Versions are the current value and the values of concurrent writes (see `crdt.Replica.MultiValue`)
+	Versions []lww.VersionedVertex `json:"versions,omitempty"`
+	// Quarantined is the latest value of the vertex rejected by the replica validator
+	Quarantined *lww.QuarantinedVertex `json:"quarantined,omitempty"`
+	// Conflicts are the recorded last-writer-wins decisions about the vertex and the edges starting from it
+	Conflicts []crdt.Conflict `json:"conflicts,omitempty"`
+}
+
+// NewAdminServer initializes the admin service and makes it ready for use.
+// Returns `ErrNoToken` if the config has no token.
+func NewAdminServer(config AdminConfig) (AdminServer, error) {
+	if config.Token == "" {
+		return AdminServer{}, ErrNoToken
+	}
+	registerCodec()
+
+	return AdminServer{
+		mutex:  &sync.RWMutex{},
+		config: config,
+		graphs: make(map[string]ManagedGraph),
+	}, nil
+}
+
+// AdminServer is the server side of the administrative service, so operators can manage live replicas
+// without redeploying or attaching a debugger:
+// * `Compact` - compacts the persisted state of a graph
+// * `Snapshot` - returns a point-in-time snapshot of a graph
+// * `ListPeers` and `BlockPeer` - inspect and block replication peers
+// * `ReleasePeer` - releases or discards the quarantined state of a blocked peer
+// * `Stats` - returns the topology and the actor statistics of a graph
+// * `Quarantine` - lists and clears the quarantined vertex values of a graph
+// * `Explain` - explains the current state of a vertex
+//
+// Every call must be authenticated with the configured token, see `AdminConfig.Token`.
+// Use `NewAdminServer` in order to initialize it before use.
+// The server is thread-safe and can be used from several go routines.
+type AdminServer struct {
+	// mutex is used for the thread-safety
+	mutex *sync.RWMutex
+
+	// config contains the admin settings
+	config AdminConfig
+	// graphs maps a name to the managed graph
+	graphs map[string]ManagedGraph
+}
+
+// Manage makes the graph manageable under the given name
+func (s AdminServer) Manage(name string, g ManagedGraph) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.graphs[name] = g
+}
+
+// Register registers the admin service in the given gRPC server
+func (s AdminServer) Register(gs *grpc.Server) {
+	gs.RegisterService(&adminServiceDesc, s)
+}
+
+// Compact compacts the persisted state of the managed graph
+func (s AdminServer) Compact(ctx context.Context, req *NameRequest) (*Empty, error) {
+	g, err := s.lookup(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if g.Compact == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "graph %q is not persisted", req.Name)
+	}
+
+	err = g.Compact()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &Empty{}, nil
+}
+
+// Snapshot returns a point-in-time snapshot of the managed graph
+func (s AdminServer) Snapshot(ctx context.Context, req *NameRequest) (*SnapshotResponse, error) {
+	g, err := s.lookup(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = g.Graph.Snapshot(buf)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &SnapshotResponse{Snapshot: buf.Bytes()}, nil
+}
+
+// ListPeers returns the replication peers with their statistics
+func (s AdminServer) ListPeers(ctx context.Context, req *Empty) (*PeersResponse, error) {
+	if s.config.Peers == nil {
+		return nil, status.Error(codes.Unimplemented, "peer management is not configured")
+	}
+
+	resp := &PeersResponse{Peers: []PeerInfo{}}
+	for peer, stats := range s.config.Peers.PeerStats() {
+		resp.Peers = append(resp.Peers, PeerInfo{Peer: peer, Stats: stats})
+	}
+	sort.Slice(resp.Peers, func(i, j int) bool {
+		return resp.Peers[i].Peer < resp.Peers[j].Peer
+	})
+	return resp, nil
+}
+
+// BlockPeer excludes the peer from the replication or includes it back
+func (s AdminServer) BlockPeer(ctx context.Context, req *BlockPeerRequest) (*Empty, error) {
+	if s.config.Peers == nil {
+		return nil, status.Error(codes.Unimplemented, "peer management is not configured")
+	}
+	if !s.config.Peers.BlockPeer(req.Peer, req.Blocked) {
+		return nil, status.Errorf(codes.NotFound, "unknown peer %q", req.Peer)
+	}
+	return &Empty{}, nil
+}
+
+// ReleasePeer merges the quarantined state of the blocked peer and unblocks it
+// or drops the quarantined state if `Discard` is set
+func (s AdminServer) ReleasePeer(ctx context.Context, req *ReleasePeerRequest) (*Empty, error) {
+	if s.config.Peers == nil {
+		return nil, status.Error(codes.Unimplemented, "peer management is not configured")
+	}
+
+	if req.Discard {
+		if !s.config.Peers.DiscardPeer(req.Peer) {
+			return nil, status.Errorf(codes.NotFound, "unknown peer %q", req.Peer)
+		}
+		return &Empty{}, nil
+	}
+
+	err := s.config.Peers.ReleasePeer(req.Peer)
+	if errors.Is(err, gossip.ErrUnknownPeer) {
+		return nil, status.Errorf(codes.NotFound, "unknown peer %q", req.Peer)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &Empty{}, nil
+}
+
+// Stats returns the statistics of the managed graph
+func (s AdminServer) Stats(ctx context.Context, req *NameRequest) (*StatsResponse, error) {
+	g, err := s.lookup(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	topology, err := g.Graph.TopologyStats(ctx, s.config.StatsPathSamples)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &StatsResponse{
+		Topology:    topology,
+		Actors:      g.Graph.ActorStats(),
+		Quarantined: len(g.Graph.Quarantined()),
+	}, nil
+}
+
+// Quarantine lists the quarantined vertex values of the managed graph and clears them if requested
+func (s AdminServer) Quarantine(ctx context.Context, req *QuarantineRequest) (*QuarantineResponse, error) {
+	g, err := s.lookup(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &QuarantineResponse{Vertices: g.Graph.Quarantined()}
+	if req.Clear {
+		g.Graph.ClearQuarantine()
+	}
+	return resp, nil
+}
+
+// Explain explains the current state of a vertex of the managed graph
+func (s AdminServer) Explain(ctx context.Context, req *ExplainRequest) (*ExplainResponse, error) {
+	g, err := s.lookup(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ExplainResponse{}
+	_, err = g.Graph.Lookup(req.Key)
+	resp.Exists = err == nil
+
+	write, err := g.Graph.LastVertexWrite(req.Key)
+	if err == nil {
+		resp.LastWrite = &write
+	}
+	resp.Versions, _ = g.Graph.LookupVersions(req.Key)
+
+	for _, q := range g.Graph.Quarantined() {
+		if q.Key == req.Key {
+			q := q
+			resp.Quarantined = &q
+		}
+	}
+
+	if g.Conflicts != nil {
+		for _, c := range g.Conflicts.Conflicts(time.Time{}, time.Now()) {
+			if c.Key == req.Key {
+				resp.Conflicts = append(resp.Conflicts, c)
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// lookup returns the graph managed under the given name
+func (s AdminServer) lookup(name string) (ManagedGraph, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	g, exists := s.graphs[name]
+	if !exists {
+		return ManagedGraph{}, status.Error(codes.NotFound, errors.Wrapf(ErrUnknownName, "%q", name).Error())
+	}
+	return g, nil
+}
+
+// authorize checks the admin token carried by the context of the call
+func (s AdminServer) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(authorizationHeader) {
+		token := strings.TrimPrefix(value, bearerPrefix)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid admin token")
+}
+
+// NewAdminClient creates a client of the admin service using the given connection,
+// every call is authenticated with the given token.
+func NewAdminClient(conn grpc.ClientConnInterface, token string) AdminClient {
+	return AdminClient{
+		conn:  conn,
+		token: token,
+	}
+}
+
+// AdminClient is the client side of the admin service, see `AdminServer` for the description of the calls.
+// The client is thread-safe and can be used from several go routines.
+type AdminClient struct {
+	// conn is the connection to the server
+	conn grpc.ClientConnInterface
+	// token authenticates the calls
+	token string
+}
+
+// Compact compacts the persisted state of the graph managed under the given name
+func (c AdminClient) Compact(ctx context.Context, name string) error {
+	return c.invoke(ctx, "Compact", &NameRequest{Name: name}, &Empty{})
+}
+
+// Snapshot returns a point-in-time snapshot of the graph managed under the given name,
+// use `lww.RestoreGraph` in order to restore it
+func (c AdminClient) Snapshot(ctx context.Context, name string) ([]byte, error) {
+	var resp SnapshotResponse
+	err := c.invoke(ctx, "Snapshot", &NameRequest{Name: name}, &resp)
+	return resp.Snapshot, err
+}
+
+// ListPeers returns the replication peers with their statistics sorted by address
+func (c AdminClient) ListPeers(ctx context.Context) ([]PeerInfo, error) {
+	var resp PeersResponse
+	err := c.invoke(ctx, "ListPeers", &Empty{}, &resp)
+	return resp.Peers, err
+}
+
+// BlockPeer excludes the peer from the replication or includes it back if `blocked` is `false`
+func (c AdminClient) BlockPeer(ctx context.Context, peer string, blocked bool) error {
+	return c.invoke(ctx, "BlockPeer", &BlockPeerRequest{Peer: peer, Blocked: blocked}, &Empty{})
+}
+
+// ReleasePeer merges the quarantined state of the blocked peer and unblocks it,
+// or drops the quarantined state keeping the peer blocked if `discard` is `true`
+func (c AdminClient) ReleasePeer(ctx context.Context, peer string, discard bool) error {
+	return c.invoke(ctx, "ReleasePeer", &ReleasePeerRequest{Peer: peer, Discard: discard}, &Empty{})
+}
+
+// Stats returns the statistics of the graph managed under the given name
+func (c AdminClient) Stats(ctx context.Context, name string) (StatsResponse, error) {
+	var resp StatsResponse
+	err := c.invoke(ctx, "Stats", &NameRequest{Name: name}, &resp)
+	return resp, err
+}
+
+// Quarantine lists the quarantined vertex values of the graph managed under the given name
+// and clears them if `clear` is `true`
+func (c AdminClient) Quarantine(ctx context.Context, name string, clear bool) ([]lww.QuarantinedVertex, error) {
+	var resp QuarantineResponse
+	err := c.invoke(ctx, "Quarantine", &QuarantineRequest{Name: name, Clear: clear}, &resp)
+	return resp.Vertices, err
+}
+
+// Explain explains the current state of the vertex with the given key of the graph managed under the given name
+func (c AdminClient) Explain(ctx context.Context, name, key string) (ExplainResponse, error) {
+	var resp ExplainResponse
+	err := c.invoke(ctx, "Explain", &ExplainRequest{Name: name, Key: key}, &resp)
+	return resp, err
+}
+
+// invoke calls the method of the admin service with the token
+func (c AdminClient) invoke(ctx context.Context, method string, req, resp interface{}) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, authorizationHeader, bearerPrefix+c.token)
+	err := c.conn.Invoke(ctx, "/"+AdminServiceName+"/"+method, req, resp, callOptions()...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to call %s", method)
+	}
+	return nil
+}
+
+// adminMethod describes a method of the admin service, every call is authorized before it's handled
+func adminMethod(
+	name string,
+	newRequest func() interface{},
+	call func(s AdminServer, ctx context.Context, req interface{}) (interface{}, error),
+) grpc.MethodDesc {
+	fullMethod := "/" + AdminServiceName + "/" + name
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newRequest()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				s := srv.(AdminServer)
+				if err := s.authorize(ctx); err != nil {
+					return nil, err
+				}
+				return call(s, ctx, req)
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, handler)
+		},
+	}
+}
+
+// adminServiceDesc describes the admin service for the gRPC server
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName: AdminServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		adminMethod("Compact", func() interface{} { return &NameRequest{} },
+			func(s AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.Compact(ctx, req.(*NameRequest))
+			}),
+		adminMethod("Snapshot", func() interface{} { return &NameRequest{} },
+			func(s AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.Snapshot(ctx, req.(*NameRequest))
+			}),
+		adminMethod("ListPeers", func() interface{} { return &Empty{} },
+			func(s AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.ListPeers(ctx, req.(*Empty))
+			}),
+		adminMethod("BlockPeer", func() interface{} { return &BlockPeerRequest{} },
+			func(s AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.BlockPeer(ctx, req.(*BlockPeerRequest))
+			}),
+		adminMethod("ReleasePeer", func() interface{} { return &ReleasePeerRequest{} },
+			func(s AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.ReleasePeer(ctx, req.(*ReleasePeerRequest))
+			}),
+		adminMethod("Stats", func() interface{} { return &NameRequest{} },
+			func(s AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.Stats(ctx, req.(*NameRequest))
+			}),
+		adminMethod("Quarantine", func() interface{} { return &QuarantineRequest{} },
+			func(s AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.Quarantine(ctx, req.(*QuarantineRequest))
+			}),
+		adminMethod("Explain", func() interface{} { return &ExplainRequest{} },
+			func(s AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.Explain(ctx, req.(*ExplainRequest))
+			}),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "crdt/replication/admin.proto",
+}
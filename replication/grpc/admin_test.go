@@ -0,0 +1,196 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/replication/gossip"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type testPeers map[string]gossip.PeerStats
+
+func (p testPeers) PeerStats() map[string]gossip.PeerStats {
+	return p
+}
+
+func (p testPeers) BlockPeer(peer string, blocked bool) bool {
+	stats, exists := p[peer]
+	if !exists {
+		return false
+	}
+	stats.Blocked = blocked
+	p[peer] = stats
+	return true
+}
+
+func (p testPeers) ReleasePeer(peer string) error {
+	if !p.BlockPeer(peer, false) {
+		return errors.Wrapf(gossip.ErrUnknownPeer, "failed to release peer %q", peer)
+	}
+	return nil
+}
+
+func (p testPeers) DiscardPeer(peer string) bool {
+	stats, exists := p[peer]
+	if !exists {
+		return false
+	}
+	stats.Quarantined = false
+	p[peer] = stats
+	return true
+}
+
+func TestAdminService(t *testing.T) {
+	_, err := NewAdminServer(AdminConfig{})
+	require.ErrorIs(t, err, ErrNoToken)
+
+	replica := crdt.NewReplica("server")
+	replica.Validator = crdt.ValidatorFunc(func(key, value string) error {
+		if value == "invalid" {
+			return crdt.ErrInvalidValue
+		}
+		return nil
+	})
+	graph := lww.NewGraph(replica)
+	require.NoError(t, graph.AddVertex(lww.Vertex{Key: "v1", Value: "value1"}))
+	require.NoError(t, graph.AddVertex(lww.Vertex{Key: "v2", Value: "value2"}))
+	require.NoError(t, graph.AddEdge("v1", "v2"))
+
+	remote := lww.NewGraph(crdt.NewReplica("remote"))
+	require.NoError(t, remote.AddVertex(lww.Vertex{Key: "v3", Value: "invalid"}))
+	graph.Merge(remote)
+
+	compacted := 0
+	peers := testPeers{"peer1": {}, "peer2": {}}
+	server, err := NewAdminServer(AdminConfig{Token: "secret", Peers: peers})
+	require.NoError(t, err)
+	server.Manage("graph", ManagedGraph{
+		Graph: graph,
+		Compact: func() error {
+			compacted++
+			return nil
+		},
+	})
+	server.Manage("memory", ManagedGraph{Graph: lww.NewGraph(replica)})
+
+	listener := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer()
+	server.Register(gs)
+	go func() {
+		_ = gs.Serve(listener)
+	}()
+	defer gs.Stop()
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := NewAdminClient(conn, "secret")
+	ctx := context.Background()
+
+	requireCode := func(t *testing.T, code codes.Code, err error) {
+		require.Error(t, err)
+		require.Equal(t, code, status.Code(errors.Cause(err)))
+	}
+
+	t.Run("rejects calls without the token", func(t *testing.T) {
+		err := NewAdminClient(conn, "wrong").Compact(ctx, "graph")
+		requireCode(t, codes.Unauthenticated, err)
+		require.Zero(t, compacted)
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		require.NoError(t, client.Compact(ctx, "graph"))
+		require.Equal(t, 1, compacted)
+		requireCode(t, codes.FailedPrecondition, client.Compact(ctx, "memory"))
+		requireCode(t, codes.NotFound, client.Compact(ctx, "unknown"))
+	})
+
+	t.Run("Snapshot", func(t *testing.T) {
+		snapshot, err := client.Snapshot(ctx, "graph")
+		require.NoError(t, err)
+		restored, err := lww.RestoreGraph(crdt.NewReplica("restored"), bytes.NewReader(snapshot))
+		require.NoError(t, err)
+		expected, err := graph.List()
+		require.NoError(t, err)
+		actual, err := restored.List()
+		require.NoError(t, err)
+		require.ElementsMatch(t, expected, actual)
+	})
+
+	t.Run("ListPeers and BlockPeer", func(t *testing.T) {
+		require.NoError(t, client.BlockPeer(ctx, "peer2", true))
+		requireCode(t, codes.NotFound, client.BlockPeer(ctx, "peer3", true))
+
+		list, err := client.ListPeers(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []PeerInfo{
+			{Peer: "peer1"},
+			{Peer: "peer2", Stats: gossip.PeerStats{Blocked: true}},
+		}, list)
+	})
+
+	t.Run("ReleasePeer", func(t *testing.T) {
+		peers["peer1"] = gossip.PeerStats{Blocked: true, Quarantined: true}
+		require.NoError(t, client.ReleasePeer(ctx, "peer1", true))
+		require.Equal(t, gossip.PeerStats{Blocked: true}, peers["peer1"], "the peer must remain blocked")
+
+		require.NoError(t, client.ReleasePeer(ctx, "peer1", false))
+		require.Equal(t, gossip.PeerStats{}, peers["peer1"])
+
+		requireCode(t, codes.NotFound, client.ReleasePeer(ctx, "peer3", false))
+		requireCode(t, codes.NotFound, client.ReleasePeer(ctx, "peer3", true))
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		stats, err := client.Stats(ctx, "graph")
+		require.NoError(t, err)
+		require.Equal(t, 2, stats.Topology.Vertices)
+		require.Equal(t, 1, stats.Topology.Edges)
+		require.Equal(t, 1, stats.Quarantined)
+		require.NotEmpty(t, stats.Actors)
+	})
+
+	t.Run("Explain", func(t *testing.T) {
+		explained, err := client.Explain(ctx, "graph", "v2")
+		require.NoError(t, err)
+		require.True(t, explained.Exists)
+		require.NotNil(t, explained.LastWrite)
+		require.Nil(t, explained.Quarantined)
+
+		explained, err = client.Explain(ctx, "graph", "v3")
+		require.NoError(t, err)
+		require.False(t, explained.Exists, "invalid values are not merged")
+		require.Nil(t, explained.LastWrite)
+		require.NotNil(t, explained.Quarantined)
+		require.Equal(t, "invalid", explained.Quarantined.Value)
+	})
+
+	t.Run("Quarantine", func(t *testing.T) {
+		quarantined, err := client.Quarantine(ctx, "graph", true)
+		require.NoError(t, err)
+		require.Len(t, quarantined, 1)
+		require.Equal(t, "v3", quarantined[0].Key)
+
+		quarantined, err = client.Quarantine(ctx, "graph", false)
+		require.NoError(t, err)
+		require.Empty(t, quarantined)
+	})
+}
@@ -0,0 +1,42 @@
+package grpc
+
+import (
+	"encoding/json"
+	"sync"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// codecName is the content-subtype of the replication messages
+const codecName = "crdt-json"
+
+// registerCodecOnce makes sure the codec is registered only once
+var registerCodecOnce sync.Once
+
+// registerCodec registers the JSON codec used by the sync service,
+// so the gRPC server can decode requests with the `crdt-json` content-subtype.
+// It must be called before the server starts serving requests.
+func registerCodec() {
+	registerCodecOnce.Do(func() {
+		encoding.RegisterCodec(jsonCodec{})
+	})
+}
+
+// jsonCodec encodes the replication messages as JSON.
+// The serialized CRDT state is JSON already, so there is no need for protobuf here.
+type jsonCodec struct{}
+
+// Marshal implements the `encoding.Codec` interface
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements the `encoding.Codec` interface
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name implements the `encoding.Codec` interface
+func (jsonCodec) Name() string {
+	return codecName
+}
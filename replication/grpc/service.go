@@ -0,0 +1,352 @@
+// Package grpc implements a gRPC replication service for exchanging the state
+// of CRDTs between processes, so users don't need to write their own wire protocol.
+//
+// The service `crdt.replication.SyncService` has three RPCs:
+// * `Push` - the client sends its state, the server merges it
+// * `Pull` - the server sends its state, the client merges it
+// * `Exchange` - the client sends its state, the server merges it and sends back the merged state
+//
+// A server can serve several CRDTs, each one is identified by a name.
+// The CRDT state is serialized with `crdt.Marshal` and deserialized using a `crdt.Registry`,
+// so any CRDT kind registered on both sides can be replicated.
+//
+// Clients and servers advertise the state formats they read (`crdt.SupportedFormats`) in requests and responses
+// and send the newest format both sides read, so mixed-version fleets can be upgraded without downtime.
+// The state is sent in the format chosen by the replica settings until the formats of the peer are known
+// (e.g. the peer runs an older version), see `crdt.Format`.
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ServiceName is the full name of the gRPC sync service
+	ServiceName = "crdt.replication.SyncService"
+
+	pushMethod     = "/" + ServiceName + "/Push"
+	pullMethod     = "/" + ServiceName + "/Pull"
+	exchangeMethod = "/" + ServiceName + "/Exchange"
+)
+
+var (
+	// ErrUnknownName occurs when a CRDT with the requested name is not served by the server
+	ErrUnknownName = errors.New("unknown CRDT name")
+)
+
+// StateRequest is a request carrying the state of a CRDT, used by `Push` and `Exchange`
+type StateRequest struct {
+	// Name is the name of the CRDT on the server
+	Name string `json:"name"`
+	// State is the CRDT state serialized by `crdt.Marshal`
+	State json.RawMessage `json:"state"`
+	// Formats are the state formats the client reads, empty for clients of older versions
+	Formats []crdt.Format `json:"formats,omitempty"`
+}
+
+// NameRequest is a request of the CRDT state by its name, used by `Pull`
+type NameRequest struct {
+	// Name is the name of the CRDT on the server
+	Name string `json:"name"`
+	// Formats are the state formats the client reads, empty for clients of older versions
+	Formats []crdt.Format `json:"formats,omitempty"`
+}
+
+// StateResponse is a response carrying the state of a CRDT, used by `Pull` and `Exchange`
+type StateResponse struct {
+	// State is the CRDT state serialized by `crdt.Marshal`
+	State json.RawMessage `json:"state"`
+	// Formats are the state formats the server reads, empty for servers of older versions
+	Formats []crdt.Format `json:"formats,omitempty"`
+}
+
+// Empty is a response without any data, used by `Push`
+type Empty struct{}
+
+// NewServer initializes the sync service and makes it ready for use.
+// `registry` is used for deserializing the received state.
+func NewServer(registry crdt.Registry) Server {
+	registerCodec()
+
+	return Server{
+		mutex:    &sync.RWMutex{},
+		registry: registry,
+		objects:  make(map[string]crdt.CRDT),
+	}
+}
+
+// Server is the server side of the sync service.
+// Use `NewServer` in order to initialize it before use.
+// The server is thread-safe and can be used from several go routines.
+type Server struct {
+	// mutex is used for the thread-safety
+	mutex *sync.RWMutex
+
+	// registry is used for deserializing the received state
+	registry crdt.Registry
+	// objects maps a name to the served CRDT
+	objects map[string]crdt.CRDT
+}
+
+// Serve makes the given CRDT available for replication under the given name.
+// The CRDT is updated in place when the state is pushed by the clients.
+func (s Server) Serve(name string, c crdt.CRDT) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.objects[name] = c
+}
+
+// Register registers the sync service in the given gRPC server
+func (s Server) Register(gs *grpc.Server) {
+	gs.RegisterService(&serviceDesc, s)
+}
+
+// Push merges the received state into the served CRDT
+func (s Server) Push(ctx context.Context, req *StateRequest) (*Empty, error) {
+	err := s.merge(req)
+	if err != nil {
+		return nil, err
+	}
+	return &Empty{}, nil
+}
+
+// Pull returns the state of the served CRDT
+func (s Server) Pull(ctx context.Context, req *NameRequest) (*StateResponse, error) {
+	c, err := s.lookup(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return marshalResponse(c, req.Formats)
+}
+
+// Exchange merges the received state into the served CRDT and returns the merged state
+func (s Server) Exchange(ctx context.Context, req *StateRequest) (*StateResponse, error) {
+	err := s.merge(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.lookup(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return marshalResponse(c, req.Formats)
+}
+
+// lookup returns the CRDT served under the given name
+func (s Server) lookup(name string) (crdt.CRDT, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	c, exists := s.objects[name]
+	if !exists {
+		return nil, status.Error(codes.NotFound, errors.Wrapf(ErrUnknownName, "%q", name).Error())
+	}
+	return c, nil
+}
+
+// merge deserializes the state from the request and merges it into the served CRDT
+func (s Server) merge(req *StateRequest) error {
+	c, err := s.lookup(req.Name)
+	if err != nil {
+		return err
+	}
+
+	remote, err := s.registry.Unmarshal(req.State)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = c.MergeCRDT(remote)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return nil
+}
+
+// marshalResponse serializes the state of the CRDT into a response in the newest format the client reads
+func marshalResponse(c crdt.CRDT, clientFormats []crdt.Format) (*StateResponse, error) {
+	state, err := crdt.MarshalFormat(c, crdt.NegotiateFormat(crdt.SupportedFormats, clientFormats))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &StateResponse{State: state, Formats: crdt.SupportedFormats}, nil
+}
+
+// NewClient creates a client of the sync service using the given connection.
+// `registry` is used for deserializing the received state.
+func NewClient(conn grpc.ClientConnInterface, registry crdt.Registry) Client {
+	return Client{
+		conn:     conn,
+		registry: registry,
+		peer:     &peerFormats{mutex: &sync.RWMutex{}},
+	}
+}
+
+// Client is the client side of the sync service.
+// The client is thread-safe and can be used from several go routines.
+type Client struct {
+	// conn is the connection to the server
+	conn grpc.ClientConnInterface
+	// registry is used for deserializing the received state
+	registry crdt.Registry
+	// peer contains the state formats the server reads
+	peer *peerFormats
+}
+
+// peerFormats contains the state formats a peer reads, learned from its responses
+type peerFormats struct {
+	// mutex is used for the thread-safety
+	mutex *sync.RWMutex
+	// formats are the formats the peer reads, nil until they are known
+	formats []crdt.Format
+}
+
+// Push sends the state of the `local` CRDT to the server, so the server merges it
+// into the CRDT served under the given name.
+func (c Client) Push(ctx context.Context, name string, local crdt.CRDT) error {
+	req, err := c.stateRequest(name, local)
+	if err != nil {
+		return err
+	}
+
+	err = c.conn.Invoke(ctx, pushMethod, req, &Empty{}, callOptions()...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to push %q", name)
+	}
+
+	return nil
+}
+
+// Pull fetches the state of the CRDT served under the given name and merges it into the `local` CRDT.
+func (c Client) Pull(ctx context.Context, name string, local crdt.CRDT) error {
+	var resp StateResponse
+	req := &NameRequest{Name: name, Formats: crdt.SupportedFormats}
+	err := c.conn.Invoke(ctx, pullMethod, req, &resp, callOptions()...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to pull %q", name)
+	}
+
+	return c.merge(local, &resp)
+}
+
+// Exchange sends the state of the `local` CRDT to the server and merges the state
+// returned by the server, after the exchange both replicas have the same state.
+func (c Client) Exchange(ctx context.Context, name string, local crdt.CRDT) error {
+	req, err := c.stateRequest(name, local)
+	if err != nil {
+		return err
+	}
+
+	var resp StateResponse
+	err = c.conn.Invoke(ctx, exchangeMethod, req, &resp, callOptions()...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to exchange %q", name)
+	}
+
+	return c.merge(local, &resp)
+}
+
+// ServerFormats returns the state formats the server reads, nil until the client receives a response
+// from the server or if the server runs an older version not advertising them
+func (c Client) ServerFormats() []crdt.Format {
+	c.peer.mutex.RLock()
+	defer c.peer.mutex.RUnlock()
+
+	return c.peer.formats
+}
+
+// stateRequest serializes the state of the `local` CRDT into a request in the newest format the server reads
+func (c Client) stateRequest(name string, local crdt.CRDT) (*StateRequest, error) {
+	state, err := crdt.MarshalFormat(local, crdt.NegotiateFormat(crdt.SupportedFormats, c.ServerFormats()))
+	if err != nil {
+		return nil, err
+	}
+	return &StateRequest{Name: name, State: state, Formats: crdt.SupportedFormats}, nil
+}
+
+// merge deserializes the received state, merges it into the `local` CRDT and remembers the server formats
+func (c Client) merge(local crdt.CRDT, resp *StateResponse) error {
+	c.peer.mutex.Lock()
+	c.peer.formats = resp.Formats
+	c.peer.mutex.Unlock()
+
+	remote, err := c.registry.Unmarshal(resp.State)
+	if err != nil {
+		return err
+	}
+	return local.MergeCRDT(remote)
+}
+
+// callOptions returns the options required for every call of the sync service
+func callOptions() []grpc.CallOption {
+	return []grpc.CallOption{grpc.ForceCodec(jsonCodec{})}
+}
+
+// serviceDesc describes the sync service for the gRPC server
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Push",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &StateRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(Server).Push(ctx, req.(*StateRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: pushMethod}, handler)
+			},
+		},
+		{
+			MethodName: "Pull",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &NameRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(Server).Pull(ctx, req.(*NameRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: pullMethod}, handler)
+			},
+		},
+		{
+			MethodName: "Exchange",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &StateRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(Server).Exchange(ctx, req.(*StateRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: exchangeMethod}, handler)
+			},
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "crdt/replication/sync.proto",
+}
@@ -0,0 +1,206 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestSyncService(t *testing.T) {
+	serverReplica := crdt.NewReplica("server")
+	clientReplica := crdt.NewReplica("client")
+
+	newRegistry := func(replica crdt.Replica) crdt.Registry {
+		registry := crdt.NewRegistry()
+		require.NoError(t, lww.Register(registry, replica))
+		require.NoError(t, counter.Register(registry, replica))
+		return registry
+	}
+
+	serverGraph := lww.NewGraph(serverReplica)
+	serverCounter := counter.NewPN(serverReplica)
+
+	server := NewServer(newRegistry(serverReplica))
+	server.Serve("graph", serverGraph)
+	server.Serve("counter", serverCounter)
+
+	listener := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer()
+	server.Register(gs)
+	go func() {
+		_ = gs.Serve(listener)
+	}()
+	defer gs.Stop()
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := NewClient(conn, newRegistry(clientReplica))
+	ctx := context.Background()
+
+	v1 := lww.Vertex{Key: "vertex1", Value: "value1"}
+	v2 := lww.Vertex{Key: "vertex2", Value: "value2"}
+
+	t.Run("Push merges the client state on the server", func(t *testing.T) {
+		local := lww.NewGraph(clientReplica)
+		require.NoError(t, local.AddVertex(v1))
+
+		require.NoError(t, client.Push(ctx, "graph", local))
+
+		found, err := serverGraph.Lookup(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, v1, found)
+	})
+
+	t.Run("Pull merges the server state on the client", func(t *testing.T) {
+		serverCounter.Add(5)
+
+		local := counter.NewPN(clientReplica)
+		local.Add(2)
+		require.NoError(t, client.Pull(ctx, "counter", local))
+		require.Equal(t, int64(7), local.Value())
+		require.Equal(t, int64(5), serverCounter.Value(), "pulling must not change the server")
+	})
+
+	t.Run("Exchange converges both sides", func(t *testing.T) {
+		require.NoError(t, serverGraph.AddVertex(v2))
+
+		local := lww.NewGraph(clientReplica)
+		require.NoError(t, local.AddVertex(v1))
+		require.NoError(t, local.AddEdge(v1.Key, v1.Key))
+
+		require.NoError(t, client.Exchange(ctx, "graph", local))
+
+		localList, err := local.List()
+		require.NoError(t, err)
+		serverList, err := serverGraph.List()
+		require.NoError(t, err)
+		require.Equal(t, serverList, localList)
+		require.Len(t, localList, 2)
+	})
+
+	t.Run("returns NotFound for unknown names", func(t *testing.T) {
+		err := client.Pull(ctx, "unknown", lww.NewGraph(clientReplica))
+		require.Error(t, err)
+		require.Equal(t, codes.NotFound, status.Code(errors.Cause(err)))
+	})
+
+	t.Run("returns InvalidArgument for a state of another kind", func(t *testing.T) {
+		err := client.Push(ctx, "counter", lww.NewGraph(clientReplica))
+		require.Error(t, err)
+		require.Equal(t, codes.InvalidArgument, status.Code(errors.Cause(err)))
+	})
+}
+
+func TestFormatNegotiation(t *testing.T) {
+	serverReplica := crdt.NewReplica("server")
+	clientReplica := crdt.NewReplica("client")
+	clientReplica.DualFormat = true
+
+	registry := crdt.NewRegistry()
+	require.NoError(t, lww.Register(registry, serverReplica))
+
+	serverGraph := lww.NewGraph(serverReplica)
+	require.NoError(t, serverGraph.AddVertex(lww.Vertex{Key: "v1"}))
+	require.NoError(t, serverGraph.AddEdge("v1", "v1"))
+	server := NewServer(registry)
+	server.Serve("graph", serverGraph)
+
+	// encoding returns which edge encodings the serialized graph state contains
+	encoding := func(t *testing.T, data []byte) (edges, edgeGroups bool) {
+		var e struct {
+			State struct {
+				Edges      json.RawMessage `json:"edges"`
+				EdgeGroups json.RawMessage `json:"edgeGroups"`
+			} `json:"state"`
+		}
+		require.NoError(t, json.Unmarshal(data, &e))
+		return e.State.Edges != nil && string(e.State.Edges) != "null", e.State.EdgeGroups != nil
+	}
+
+	var pushed [][]byte
+	listener := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if r, isState := req.(*StateRequest); isState {
+				pushed = append(pushed, r.State)
+			}
+			return handler(ctx, req)
+		},
+	))
+	server.Register(gs)
+	go func() {
+		_ = gs.Serve(listener)
+	}()
+	defer gs.Stop()
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := NewClient(conn, registry)
+	ctx := context.Background()
+	local := lww.NewGraph(clientReplica)
+	require.NoError(t, local.AddVertex(lww.Vertex{Key: "v2"}))
+	require.NoError(t, local.AddEdge("v2", "v2"))
+
+	t.Run("sends both formats until the server formats are known", func(t *testing.T) {
+		require.Nil(t, client.ServerFormats())
+		require.NoError(t, client.Push(ctx, "graph", local))
+		edges, edgeGroups := encoding(t, pushed[0])
+		require.True(t, edges)
+		require.True(t, edgeGroups)
+	})
+
+	t.Run("sends the newest common format after the negotiation", func(t *testing.T) {
+		require.NoError(t, client.Pull(ctx, "graph", local))
+		require.Equal(t, crdt.SupportedFormats, client.ServerFormats())
+		require.NoError(t, client.Push(ctx, "graph", local))
+		edges, edgeGroups := encoding(t, pushed[1])
+		require.False(t, edges)
+		require.True(t, edgeGroups)
+
+		_, err := serverGraph.GetEdge("v2", "v2")
+		require.NoError(t, err)
+	})
+
+	t.Run("responds to clients of older versions in the server format", func(t *testing.T) {
+		resp, err := server.Pull(ctx, &NameRequest{Name: "graph"})
+		require.NoError(t, err)
+		edges, edgeGroups := encoding(t, resp.State)
+		require.True(t, edges)
+		require.False(t, edgeGroups)
+
+		resp, err = server.Pull(ctx, &NameRequest{Name: "graph", Formats: crdt.SupportedFormats})
+		require.NoError(t, err)
+		edges, edgeGroups = encoding(t, resp.State)
+		require.False(t, edges)
+		require.True(t, edgeGroups)
+	})
+}
@@ -0,0 +1,236 @@
+// Package httpsync implements CRDT replication over plain HTTP, so the sync can be wired
+// into existing HTTP services without any additional protocol.
+//
+// The `Handler` serves CRDTs by name under its mount point:
+// * `GET /{name}` - returns the state of the CRDT
+// * `POST /{name}` - merges the state from the request body and returns the merged state
+// * `PUT /{name}` - merges the state from the request body and returns no content
+// * `GET /{name}/vertices/{key}` - returns a vertex of a `Querier` like `lww.Graph`
+// * `GET /{name}/vertices/{key}/connected` - returns the vertices connected to a vertex of a `Querier`
+//
+// All `GET` requests support conditional requests: the response has the `ETag` header
+// with the Merkle root or the hash of the CRDT state and `304 Not Modified` is returned when the `If-None-Match`
+// header contains the current tag, so clients can poll cheaply when nothing changed.
+//
+// The CRDT state is serialized with `crdt.Marshal` and deserialized using a `crdt.Registry`.
+// State-based CRDTs converge by merging their full state, so the full state is used as a delta.
+package httpsync
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+const (
+	// ContentType is the content type of the serialized CRDT state
+	ContentType = "application/json"
+
+	// maxBodySize limits the size of the state accepted by the handler
+	maxBodySize = 64 << 20
+)
+
+var (
+	// ErrUnexpectedStatus occurs when a peer responds with an unexpected HTTP status
+	ErrUnexpectedStatus = errors.New("unexpected response status")
+)
+
+// NewHandler creates an HTTP handler serving CRDTs for replication.
+// `registry` is used for deserializing the received state.
+func NewHandler(registry crdt.Registry) Handler {
+	return Handler{
+		mutex:    &sync.RWMutex{},
+		registry: registry,
+		objects:  make(map[string]crdt.CRDT),
+	}
+}
+
+// Handler is an `http.Handler` serving the state of CRDTs and merging the state sent by peers.
+// Use `NewHandler` in order to initialize it before use.
+// Mount it with `http.StripPrefix` if it does not serve the root path.
+type Handler struct {
+	// mutex is used for the thread-safety
+	mutex *sync.RWMutex
+
+	// registry is used for deserializing the received state
+	registry crdt.Registry
+	// objects maps a name to the served CRDT
+	objects map[string]crdt.CRDT
+}
+
+// Serve makes the given CRDT available for replication under the given name.
+// The CRDT is updated in place when the state is pushed by peers.
+func (h Handler) Serve(name string, c crdt.CRDT) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.objects[name] = c
+}
+
+// ServeHTTP implements the `http.Handler` interface
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+
+	h.mutex.RLock()
+	c, exists := h.objects[name]
+	h.mutex.RUnlock()
+
+	if !exists {
+		h.serveQuery(w, r, name)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if notModified(w, r, c) {
+			return
+		}
+		writeState(w, c)
+
+	case http.MethodPost, http.MethodPut:
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		remote, err := h.registry.Unmarshal(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = c.MergeCRDT(remote)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeState(w, c)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeState serializes the CRDT state into the response
+func writeState(w http.ResponseWriter, c crdt.CRDT) {
+	state, err := crdt.Marshal(c)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = w.Write(state)
+}
+
+// NewClient creates a client for the peer serving the `Handler` at `baseURL`.
+// `httpClient` is used for sending requests, `http.DefaultClient` is used when it's nil.
+// `registry` is used for deserializing the received state.
+func NewClient(baseURL string, httpClient *http.Client, registry crdt.Registry) Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+		registry:   registry,
+	}
+}
+
+// Client fetches the state of CRDTs from a peer and merges it into the local ones.
+// The client is thread-safe and can be used from several go routines.
+type Client struct {
+	// baseURL is the URL the peer's handler is mounted at
+	baseURL string
+	// httpClient is used for sending requests
+	httpClient *http.Client
+	// registry is used for deserializing the received state
+	registry crdt.Registry
+}
+
+// Push sends the state of the `local` CRDT to the peer, so the peer merges it
+// into the CRDT served under the given name.
+func (c Client) Push(ctx context.Context, name string, local crdt.CRDT) error {
+	_, err := c.send(ctx, http.MethodPut, name, local, http.StatusNoContent)
+	return err
+}
+
+// Pull fetches the state of the CRDT served under the given name and merges it into the `local` CRDT.
+func (c Client) Pull(ctx context.Context, name string, local crdt.CRDT) error {
+	state, err := c.send(ctx, http.MethodGet, name, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return c.merge(local, state)
+}
+
+// Exchange sends the state of the `local` CRDT to the peer and merges the state
+// returned by the peer, after the exchange both replicas have the same state.
+func (c Client) Exchange(ctx context.Context, name string, local crdt.CRDT) error {
+	state, err := c.send(ctx, http.MethodPost, name, local, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return c.merge(local, state)
+}
+
+// send sends a request with the state of `local` (if not nil) and returns the response body
+func (c Client) send(ctx context.Context, method, name string, local crdt.CRDT, expectedStatus int) ([]byte, error) {
+	var body []byte
+	if local != nil {
+		state, err := crdt.Marshal(local)
+		if err != nil {
+			return nil, err
+		}
+		body = state
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/"+url.PathEscape(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create a request for %q", name)
+	}
+	if local != nil {
+		req.Header.Set("Content-Type", ContentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to sync %q", name)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the response for %q", name)
+	}
+
+	if resp.StatusCode != expectedStatus {
+		return nil, errors.Wrapf(ErrUnexpectedStatus, "%s %q: %d %s", method, name, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	return respBody, nil
+}
+
+// merge deserializes the received state and merges it into the `local` CRDT
+func (c Client) merge(local crdt.CRDT, state []byte) error {
+	remote, err := c.registry.Unmarshal(state)
+	if err != nil {
+		return err
+	}
+	return local.MergeCRDT(remote)
+}
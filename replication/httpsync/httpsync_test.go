@@ -0,0 +1,102 @@
+package httpsync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSync(t *testing.T) {
+	serverReplica := crdt.NewReplica("server")
+	clientReplica := crdt.NewReplica("client")
+
+	newRegistry := func(replica crdt.Replica) crdt.Registry {
+		registry := crdt.NewRegistry()
+		require.NoError(t, lww.Register(registry, replica))
+		require.NoError(t, counter.Register(registry, replica))
+		return registry
+	}
+
+	serverGraph := lww.NewGraph(serverReplica)
+	serverCounter := counter.NewPN(serverReplica)
+
+	handler := NewHandler(newRegistry(serverReplica))
+	handler.Serve("graph", serverGraph)
+	handler.Serve("counter", serverCounter)
+
+	mux := http.NewServeMux()
+	mux.Handle("/sync/", http.StripPrefix("/sync", handler))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL+"/sync/", server.Client(), newRegistry(clientReplica))
+	ctx := context.Background()
+
+	v1 := lww.Vertex{Key: "vertex1", Value: "value1"}
+	v2 := lww.Vertex{Key: "vertex2", Value: "value2"}
+
+	t.Run("Push merges the client state on the server", func(t *testing.T) {
+		local := lww.NewGraph(clientReplica)
+		require.NoError(t, local.AddVertex(v1))
+
+		require.NoError(t, client.Push(ctx, "graph", local))
+
+		found, err := serverGraph.Lookup(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, v1, found)
+	})
+
+	t.Run("Pull merges the server state on the client", func(t *testing.T) {
+		serverCounter.Add(5)
+
+		local := counter.NewPN(clientReplica)
+		local.Add(2)
+		require.NoError(t, client.Pull(ctx, "counter", local))
+		require.Equal(t, int64(7), local.Value())
+		require.Equal(t, int64(5), serverCounter.Value(), "pulling must not change the server")
+	})
+
+	t.Run("Exchange converges both sides", func(t *testing.T) {
+		require.NoError(t, serverGraph.AddVertex(v2))
+
+		local := lww.NewGraph(clientReplica)
+		require.NoError(t, local.AddVertex(v1))
+
+		require.NoError(t, client.Exchange(ctx, "graph", local))
+
+		localList, err := local.List()
+		require.NoError(t, err)
+		serverList, err := serverGraph.List()
+		require.NoError(t, err)
+		require.Equal(t, serverList, localList)
+		require.Len(t, localList, 2)
+	})
+
+	t.Run("returns ErrUnexpectedStatus for unknown names", func(t *testing.T) {
+		err := client.Pull(ctx, "unknown", lww.NewGraph(clientReplica))
+		require.ErrorIs(t, err, ErrUnexpectedStatus)
+		require.Contains(t, err.Error(), "404")
+	})
+
+	t.Run("returns ErrUnexpectedStatus for a state of another kind", func(t *testing.T) {
+		err := client.Push(ctx, "counter", lww.NewGraph(clientReplica))
+		require.ErrorIs(t, err, ErrUnexpectedStatus)
+		require.Contains(t, err.Error(), "400")
+	})
+
+	t.Run("rejects unsupported methods", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/sync/graph", strings.NewReader(""))
+		require.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
@@ -0,0 +1,149 @@
+package httpsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+const (
+	// verticesPath separates the CRDT name and the vertex key in query paths
+	verticesPath = "/vertices/"
+	// connectedSuffix is the suffix of the path for querying connected vertices
+	connectedSuffix = "/connected"
+)
+
+// Querier is a CRDT serving the vertex queries, e.g. `lww.Graph` or any of its wrappers
+// like `lww.QuotaGraph`, `lww.LeasedGraph` and `storage.Graph`.
+type Querier interface {
+	crdt.CRDT
+	// Lookup returns the vertex with the given key
+	Lookup(key string) (lww.Vertex, error)
+	// FindConnected returns the vertices connected to the vertex with the given key
+	FindConnected(key string) ([]lww.Vertex, error)
+}
+
+// Digester is a CRDT producing a Merkle tree of its state, e.g. `lww.Graph` or `lww.Set`.
+// The root of the tree is used as the entity tag instead of hashing the serialized state.
+type Digester interface {
+	// Digest returns the Merkle tree over all the records of the CRDT
+	Digest() (lww.MerkleTree, error)
+}
+
+// serveQuery serves the read-only vertex queries of a graph.
+// `path` is `{name}/vertices/{key}` or `{name}/vertices/{key}/connected`.
+func (h Handler) serveQuery(w http.ResponseWriter, r *http.Request, path string) {
+	idx := strings.Index(path, verticesPath)
+	if idx == -1 {
+		http.Error(w, "unknown CRDT name", http.StatusNotFound)
+		return
+	}
+	name, key := path[:idx], path[idx+len(verticesPath):]
+
+	h.mutex.RLock()
+	c, exists := h.objects[name]
+	h.mutex.RUnlock()
+
+	if !exists {
+		http.Error(w, "unknown CRDT name", http.StatusNotFound)
+		return
+	}
+
+	g, isQuerier := c.(Querier)
+	if !isQuerier {
+		http.Error(w, "CRDT is not a graph", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if notModified(w, r, g) {
+		return
+	}
+
+	var (
+		result interface{}
+		err    error
+	)
+	if strings.HasSuffix(key, connectedSuffix) {
+		var connected []lww.Vertex
+		connected, err = g.FindConnected(strings.TrimSuffix(key, connectedSuffix))
+		sort.Slice(connected, func(i, j int) bool {
+			return connected[i].Key < connected[j].Key
+		})
+		result = connected
+	} else {
+		result, err = g.Lookup(key)
+	}
+
+	if errors.Is(err, lww.ErrVertexNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = w.Write(data)
+}
+
+// notModified sets the `ETag` header to the entity tag of the CRDT state and writes
+// `304 Not Modified` if the request's `If-None-Match` header matches it.
+// Returns `true` if the response was written.
+func notModified(w http.ResponseWriter, r *http.Request, c crdt.CRDT) bool {
+	tag, err := ETag(c)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	w.Header().Set("ETag", tag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == tag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// ETag returns the entity tag of the CRDT state, it changes every time the state changes.
+// The tag is the Merkle root if the CRDT implements `Digester`, so large graphs and sets
+// are not serialized on every request, otherwise it's the hash of the serialized state.
+func ETag(c crdt.CRDT) (string, error) {
+	if d, isDigester := c.(Digester); isDigester {
+		tree, err := d.Digest()
+		if err != nil {
+			return "", err
+		}
+		return `"` + tree.Root() + `"`, nil
+	}
+
+	state, err := crdt.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(state)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`, nil
+}
@@ -0,0 +1,121 @@
+package httpsync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	replica := crdt.NewReplica("server")
+	v1 := lww.Vertex{Key: "task/1", Value: "value1"}
+	v2 := lww.Vertex{Key: "task/2", Value: "value2"}
+	v3 := lww.Vertex{Key: "task/3", Value: "value3"}
+
+	g := lww.NewGraph(replica)
+	for _, v := range []lww.Vertex{v1, v2, v3} {
+		require.NoError(t, g.AddVertex(v))
+	}
+	require.NoError(t, g.AddEdge(v1.Key, v3.Key))
+	require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+
+	handler := NewHandler(crdt.NewRegistry())
+	handler.Serve("graph", g)
+	handler.Serve("counter", counter.NewPN(replica))
+	handler.Serve("quota", lww.NewQuotaGraph(g, lww.QuotaConfig{}))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(t *testing.T, path, etag string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, body
+	}
+
+	t.Run("returns a vertex", func(t *testing.T) {
+		resp, body := get(t, "/graph/vertices/task/1", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var found lww.Vertex
+		require.NoError(t, json.Unmarshal(body, &found))
+		require.Equal(t, v1, found)
+	})
+
+	t.Run("returns connected vertices", func(t *testing.T) {
+		resp, body := get(t, "/graph/vertices/task/1/connected", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var connected []lww.Vertex
+		require.NoError(t, json.Unmarshal(body, &connected))
+		require.Equal(t, []lww.Vertex{v2, v3}, connected)
+	})
+
+	t.Run("serves the graph wrappers", func(t *testing.T) {
+		resp, body := get(t, "/quota/vertices/task/1", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var found lww.Vertex
+		require.NoError(t, json.Unmarshal(body, &found))
+		require.Equal(t, v1, found)
+	})
+
+	t.Run("uses the Merkle root as the tag of graphs", func(t *testing.T) {
+		resp, _ := get(t, "/graph", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		tree, err := g.Digest()
+		require.NoError(t, err)
+		require.Equal(t, `"`+tree.Root()+`"`, resp.Header.Get("ETag"))
+	})
+
+	t.Run("returns 404 for unknown vertices and non-graph CRDTs", func(t *testing.T) {
+		resp, _ := get(t, "/graph/vertices/unknown", "")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, _ = get(t, "/counter/vertices/task/1", "")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, _ = get(t, "/unknown/vertices/task/1", "")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("supports conditional requests until the state changes", func(t *testing.T) {
+		resp, _ := get(t, "/graph", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		resp, body := get(t, "/graph", etag)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+		require.Empty(t, body)
+
+		resp, _ = get(t, "/graph/vertices/task/1", etag)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		require.NoError(t, g.RemoveEdge(v1.Key, v3.Key))
+
+		resp, body = get(t, "/graph/vertices/task/1/connected", etag)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NotEqual(t, etag, resp.Header.Get("ETag"))
+
+		var connected []lww.Vertex
+		require.NoError(t, json.Unmarshal(body, &connected))
+		require.Equal(t, []lww.Vertex{v2}, connected)
+	})
+}
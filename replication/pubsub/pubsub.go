@@ -0,0 +1,331 @@
+// Package pubsub replicates CRDTs over a publish-subscribe topic,
+// enabling decentralized peer-to-peer replication without a central sync server.
+//
+// The package does not depend on a particular pubsub implementation, the `Topic` interface
+// can be implemented on top of go-libp2p-pubsub with a few lines:
+//
+//	type libp2pTopic struct {
+//		topic *pubsub.Topic
+//		sub   *pubsub.Subscription
+//	}
+//
+//	func (t libp2pTopic) Publish(ctx context.Context, data []byte) error {
+//		return t.topic.Publish(ctx, data)
+//	}
+//
+//	func (t libp2pTopic) Next(ctx context.Context) ([]byte, error) {
+//		msg, err := t.sub.Next(ctx)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return msg.Data, nil
+//	}
+//
+// The CRDTs are state-based, so after every local operation the state is published instead of the operation itself.
+// Merging the state is idempotent, commutative and associative, so lost, duplicated or reordered messages,
+// which are common for gossip-based pubsub, don't break the convergence.
+//
+// Pubsub implementations limit the message size (1MB in go-libp2p-pubsub), so publishing the full state
+// does not scale. If a CRDT implements `crdt.DeltaCRDT` (e.g. `lww.Set` and `lww.Graph`) and its locally
+// changed keys are collected by the `Broadcaster.Observer`, only the records of the changed keys are published,
+// split into several messages when they don't fit into one. Changes that are not reported to observers
+// (e.g. the edge weight counters of `lww.Graph`) are published with the full state when no observed key changed.
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+var (
+	// ErrUnknownName occurs when publishing a CRDT that is not served by the broadcaster
+	ErrUnknownName = errors.New("unknown CRDT name")
+	// ErrMessageTooLarge occurs when the state or the record of a single key does not fit into a message
+	ErrMessageTooLarge = errors.New("message is too large")
+)
+
+// MaxMessageSize is the default maximum size of a published message, it's the default limit of go-libp2p-pubsub
+const MaxMessageSize = 1 << 20
+
+// Topic is a pubsub topic all the replicas are subscribed to
+type Topic interface {
+	// Publish sends the data to all the subscribers of the topic
+	Publish(ctx context.Context, data []byte) error
+	// Next blocks until the next message is received or the context is done.
+	// Messages published by this replica may be received too.
+	Next(ctx context.Context) ([]byte, error)
+}
+
+// message is a single message published to the topic
+type message struct {
+	// Origin is the ID of the replica that published the message
+	Origin string `json:"origin"`
+	// Name is the name of the CRDT
+	Name string `json:"name"`
+	// State is the CRDT state serialized by `crdt.Marshal`
+	State json.RawMessage `json:"state"`
+}
+
+// NewBroadcaster creates a broadcaster replicating CRDTs over the given topic.
+// `r` identifies the replica and is used for logging and metrics,
+// `registry` is used for deserializing the received state.
+func NewBroadcaster(r crdt.Replica, registry crdt.Registry, topic Topic) Broadcaster {
+	return Broadcaster{
+		mutex:    &sync.Mutex{},
+		replica:  r.WithDefaults(),
+		registry: registry,
+		topic:    topic,
+		maxSize:  MaxMessageSize,
+		objects:  make(map[string]crdt.CRDT),
+		changed:  make(map[string]map[string]struct{}),
+	}
+}
+
+// Broadcaster publishes the state of CRDTs to a topic and merges the state published by other replicas.
+// Use `NewBroadcaster` in order to initialize it before use.
+// The broadcaster is thread-safe and can be used from several go routines.
+type Broadcaster struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica identifies the replica and is used for logging and metrics
+	replica crdt.Replica
+	// registry is used for deserializing the received state
+	registry crdt.Registry
+	// topic is the topic all the replicas are subscribed to
+	topic Topic
+	// maxSize is the maximum size of a published message
+	maxSize int
+	// objects maps a name to the replicated CRDT
+	objects map[string]crdt.CRDT
+	// changed maps the name of a CRDT observed by `Observer` to the keys changed locally since the last publishing
+	changed map[string]map[string]struct{}
+}
+
+// WithMaxMessageSize returns a copy of the broadcaster publishing messages of at most `size` bytes,
+// it must not exceed the limit of the topic. The copy shares the served CRDTs with the broadcaster.
+func (b Broadcaster) WithMaxMessageSize(size int) Broadcaster {
+	b.maxSize = size
+	return b
+}
+
+// Observer returns an observer collecting the keys of the CRDT with the given name changed by local operations,
+// set it as the `crdt.Replica.Observer` of the CRDT (or chain it using `crdt.Observers`).
+// If the CRDT implements `crdt.DeltaCRDT` (e.g. `lww.Set` and `lww.Graph`) the broadcaster publishes only
+// the records of the changed keys instead of the full state.
+func (b Broadcaster) Observer(name string) crdt.Observer {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.changed[name] == nil {
+		b.changed[name] = make(map[string]struct{})
+	}
+
+	return crdt.ObserverFunc(func(m crdt.Mutation) {
+		if m.Source != crdt.SourceLocal {
+			// merged changes are published by their origin
+			return
+		}
+		// called under the lock of the CRDT, the broadcaster never holds its lock while calling the CRDT
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		b.changed[name][m.Key] = struct{}{}
+	})
+}
+
+// Serve adds the CRDT to the replication under the given name.
+// Other replicas must replicate the same CRDT under the same name.
+func (b Broadcaster) Serve(name string, c crdt.CRDT) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.objects[name] = c
+}
+
+// Publish publishes the changes of the CRDT with the given name to the topic:
+// the records of the locally changed keys or the full state (see the package documentation).
+// It must be called after updating the CRDT locally.
+// Returns an error with `ErrMessageTooLarge` cause if the full state or the record of a single key
+// does not fit into a message, the changed keys are published again by the next call then.
+func (b Broadcaster) Publish(ctx context.Context, name string) error {
+	c, err := b.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	deltaCRDT, keys := b.changedKeys(name, c)
+	if len(keys) != 0 {
+		err = b.publishDelta(ctx, name, deltaCRDT, keys)
+		if err != nil {
+			b.restoreKeys(name, keys)
+		}
+		return err
+	}
+
+	return b.publish(ctx, name, c)
+}
+
+// publishDelta publishes the records of the given keys splitting them into as many messages as needed
+func (b Broadcaster) publishDelta(ctx context.Context, name string, c crdt.DeltaCRDT, keys []string) error {
+	data, err := b.encode(name, c.DeltaCRDT(keys))
+	if err != nil {
+		return err
+	}
+	if len(data) <= b.maxSize {
+		return b.send(ctx, name, data)
+	}
+	if len(keys) == 1 {
+		return errors.Wrapf(ErrMessageTooLarge, "the record of key %q of %q has %d bytes, the limit is %d", keys[0], name, len(data), b.maxSize)
+	}
+
+	half := len(keys) / 2
+	err = b.publishDelta(ctx, name, c, keys[:half])
+	if err != nil {
+		return err
+	}
+	return b.publishDelta(ctx, name, c, keys[half:])
+}
+
+// publish publishes the full state of the CRDT
+func (b Broadcaster) publish(ctx context.Context, name string, c crdt.CRDT) error {
+	data, err := b.encode(name, c)
+	if err != nil {
+		return err
+	}
+	if len(data) > b.maxSize {
+		return errors.Wrapf(ErrMessageTooLarge, "the state of %q has %d bytes, the limit is %d", name, len(data), b.maxSize)
+	}
+	return b.send(ctx, name, data)
+}
+
+// encode serializes the message with the state of the CRDT
+func (b Broadcaster) encode(name string, c crdt.CRDT) ([]byte, error) {
+	state, err := crdt.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(message{Origin: b.replica.ID, Name: name, State: state})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize %q", name)
+	}
+	return data, nil
+}
+
+// send publishes the serialized message to the topic
+func (b Broadcaster) send(ctx context.Context, name string, data []byte) error {
+	err := b.topic.Publish(ctx, data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to publish %q", name)
+	}
+	b.replica.Metrics.Count("pubsub.publish", 1)
+
+	return nil
+}
+
+// changedKeys returns the sorted keys changed locally since the last call and resets them.
+// Returns no keys if the CRDT does not support deltas or its changes are not observed.
+func (b Broadcaster) changedKeys(name string, c crdt.CRDT) (crdt.DeltaCRDT, []string) {
+	deltaCRDT, supported := c.(crdt.DeltaCRDT)
+	if !supported {
+		return nil, nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	changed := b.changed[name]
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	b.changed[name] = make(map[string]struct{})
+
+	keys := make([]string, 0, len(changed))
+	for key := range changed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return deltaCRDT, keys
+}
+
+// restoreKeys marks the keys as changed again, so they're published by the next call
+func (b Broadcaster) restoreKeys(name string, keys []string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, key := range keys {
+		b.changed[name][key] = struct{}{}
+	}
+}
+
+// Run receives the messages from the topic and merges them into the served CRDTs
+// until the context is done or the topic fails. Returns the context error or the topic error.
+// Invalid messages and messages about unknown CRDTs are logged and skipped.
+func (b Broadcaster) Run(ctx context.Context) error {
+	for {
+		data, err := b.topic.Next(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to receive a message")
+		}
+
+		err = b.merge(data)
+		if err != nil {
+			b.replica.Logger.Printf("pubsub replica %q failed to merge a message: %s", b.replica.ID, err)
+			b.replica.Metrics.Count("pubsub.error", 1)
+		}
+	}
+}
+
+// merge deserializes the message and merges its state into the served CRDT
+func (b Broadcaster) merge(data []byte) error {
+	var msg message
+	err := json.Unmarshal(data, &msg)
+	if err != nil {
+		return errors.Wrap(err, "failed to deserialize the message")
+	}
+
+	if msg.Origin == b.replica.ID {
+		// own messages contain nothing new
+		return nil
+	}
+
+	c, err := b.lookup(msg.Name)
+	if err != nil {
+		return err
+	}
+
+	remote, err := b.registry.Unmarshal(msg.State)
+	if err != nil {
+		return err
+	}
+
+	err = c.MergeCRDT(remote)
+	if err != nil {
+		return err
+	}
+	b.replica.Metrics.Count("pubsub.merge", 1)
+
+	return nil
+}
+
+// lookup returns the CRDT served under the given name
+func (b Broadcaster) lookup(name string) (crdt.CRDT, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	c, exists := b.objects[name]
+	if !exists {
+		return nil, errors.Wrapf(ErrUnknownName, "%q", name)
+	}
+	return c, nil
+}
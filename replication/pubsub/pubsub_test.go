@@ -0,0 +1,186 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBus delivers every published message to all the subscribed topics
+type memoryBus struct {
+	mutex  sync.Mutex
+	topics []*memoryTopic
+}
+
+func (bus *memoryBus) subscribe() *memoryTopic {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	topic := &memoryTopic{bus: bus, messages: make(chan []byte, 100)}
+	bus.topics = append(bus.topics, topic)
+	return topic
+}
+
+// memoryTopic is a subscription to the memory bus
+type memoryTopic struct {
+	bus      *memoryBus
+	messages chan []byte
+}
+
+func (t *memoryTopic) Publish(ctx context.Context, data []byte) error {
+	t.bus.mutex.Lock()
+	defer t.bus.mutex.Unlock()
+
+	for _, topic := range t.bus.topics {
+		topic.messages <- data
+	}
+	return nil
+}
+
+func (t *memoryTopic) Next(ctx context.Context) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case data := <-t.messages:
+		return data, nil
+	}
+}
+
+func TestBroadcaster(t *testing.T) {
+	v1 := lww.Vertex{Key: "vertex1", Value: "value1"}
+	v2 := lww.Vertex{Key: "vertex2", Value: "value2"}
+
+	bus := &memoryBus{}
+	newBroadcaster := func(t *testing.T, id string) (Broadcaster, lww.Graph) {
+		replica := crdt.NewReplica(id)
+		registry := crdt.NewRegistry()
+		require.NoError(t, lww.Register(registry, replica))
+
+		b := NewBroadcaster(replica, registry, bus.subscribe())
+		replica.Observer = b.Observer("graph")
+		g := lww.NewGraph(replica)
+		b.Serve("graph", g)
+		return b, g
+	}
+
+	A, graphA := newBroadcaster(t, "A")
+	B, graphB := newBroadcaster(t, "B")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for _, b := range []Broadcaster{A, B} {
+		go func(b Broadcaster) {
+			errs <- b.Run(ctx)
+		}(b)
+	}
+	defer func() {
+		cancel()
+		require.ErrorIs(t, <-errs, context.Canceled)
+		require.ErrorIs(t, <-errs, context.Canceled)
+	}()
+
+	hasVertex := func(g lww.Graph, v lww.Vertex) func() bool {
+		return func() bool {
+			found, err := g.Lookup(v.Key)
+			return err == nil && found == v
+		}
+	}
+
+	t.Run("published updates are merged by other replicas", func(t *testing.T) {
+		require.NoError(t, graphA.AddVertex(v1))
+		require.NoError(t, A.Publish(ctx, "graph"))
+		require.Eventually(t, hasVertex(graphB, v1), time.Second, time.Millisecond)
+
+		require.NoError(t, graphB.AddVertex(v2))
+		require.NoError(t, graphB.AddEdge(v2.Key, v1.Key))
+		require.NoError(t, B.Publish(ctx, "graph"))
+		require.Eventually(t, hasVertex(graphA, v2), time.Second, time.Millisecond)
+
+		path, err := graphA.FindPath(v2.Key, v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, []lww.Vertex{v2, v1}, path)
+	})
+
+	t.Run("skips invalid messages", func(t *testing.T) {
+		require.NoError(t, bus.subscribe().Publish(ctx, []byte("invalid")))
+		require.NoError(t, bus.subscribe().Publish(ctx, []byte(`{"origin":"C","name":"unknown","state":{}}`)))
+
+		require.NoError(t, graphA.RemoveVertex(v2.Key))
+		require.NoError(t, A.Publish(ctx, "graph"))
+		require.Eventually(t, func() bool {
+			_, err := graphB.Lookup(v2.Key)
+			return err != nil
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("splits the changes into messages within the size limit", func(t *testing.T) {
+		const limit = 512
+		chunkBus := &memoryBus{}
+		reader := chunkBus.subscribe()
+
+		replica := crdt.NewReplica("D")
+		registry := crdt.NewRegistry()
+		require.NoError(t, lww.Register(registry, replica))
+		D := NewBroadcaster(replica, registry, chunkBus.subscribe()).WithMaxMessageSize(limit)
+		replica.Observer = D.Observer("graph")
+		graphD := lww.NewGraph(replica)
+		D.Serve("graph", graphD)
+
+		for i := 0; i < 20; i++ {
+			require.NoError(t, graphD.AddVertex(lww.Vertex{Key: fmt.Sprintf("vertex%02d", i), Value: "value"}))
+		}
+		require.NoError(t, D.Publish(ctx, "graph"))
+
+		merged := lww.NewGraph(crdt.NewReplica("E"))
+		messages := 0
+		for len(reader.messages) > 0 {
+			data := <-reader.messages
+			require.LessOrEqual(t, len(data), limit)
+			messages++
+
+			var msg message
+			require.NoError(t, json.Unmarshal(data, &msg))
+			remote, err := registry.Unmarshal(msg.State)
+			require.NoError(t, err)
+			require.NoError(t, merged.MergeCRDT(remote))
+		}
+		require.Greater(t, messages, 1)
+
+		list, err := merged.List()
+		require.NoError(t, err)
+		require.Len(t, list, 20)
+
+		require.NoError(t, graphD.UpdateVertex(lww.Vertex{Key: "vertex00", Value: "updated"}))
+		require.NoError(t, D.Publish(ctx, "graph"))
+		require.Len(t, reader.messages, 1, "only the changed key is published")
+	})
+
+	t.Run("returns ErrMessageTooLarge when a record does not fit", func(t *testing.T) {
+		large := lww.Vertex{Key: "large", Value: strings.Repeat("value", 100)}
+		replica := crdt.NewReplica("F")
+		registry := crdt.NewRegistry()
+		F := NewBroadcaster(replica, registry, (&memoryBus{}).subscribe()).WithMaxMessageSize(256)
+		replica.Observer = F.Observer("graph")
+		graphF := lww.NewGraph(replica)
+		F.Serve("graph", graphF)
+
+		require.NoError(t, graphF.AddVertex(large))
+		require.ErrorIs(t, F.Publish(ctx, "graph"), ErrMessageTooLarge)
+		require.ErrorIs(t, F.Publish(ctx, "graph"), ErrMessageTooLarge, "the key is published again")
+
+		F.Serve("unobserved", graphF)
+		require.ErrorIs(t, F.Publish(ctx, "unobserved"), ErrMessageTooLarge)
+	})
+
+	t.Run("returns ErrUnknownName when publishing unknown CRDTs", func(t *testing.T) {
+		require.ErrorIs(t, A.Publish(ctx, "unknown"), ErrUnknownName)
+	})
+}
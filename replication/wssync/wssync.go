@@ -0,0 +1,367 @@
+// Package wssync implements live replication of CRDTs over WebSocket connections.
+//
+// Unlike periodic batch merges a `Peer` keeps connections to other peers open
+// and streams the state of a CRDT as soon as it changes, so UIs built on top of
+// the replicated data see near-instant convergence.
+//
+// When a connection is established both sides send the state of all the served CRDTs.
+// Afterwards, a peer sends the changes of a CRDT to all its connections when:
+// * `Notify` is called after a local update
+// * merging the state received from a connection changed the local state
+//
+// The changes are deltas with only the changed records if the CRDT implements `crdt.DeltaCRDT`
+// (e.g. `lww.Set` and `lww.Graph`) and its changed keys are collected by the `Peer.Observer`,
+// otherwise the full state is sent. Changes that are not reported to observers (e.g. the edge weight
+// counters of `lww.Graph`) are sent with the full state by `Notify` when no observed key changed,
+// merged ones are relayed with the next change of the same key.
+//
+// Since the changes are relayed only when the state changes, the updates propagate through
+// a mesh of peers and stop once all of them converge.
+package wssync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"golang.org/x/net/websocket"
+)
+
+var (
+	// ErrUnknownName occurs when notifying about a CRDT that is not served by the peer
+	ErrUnknownName = errors.New("unknown CRDT name")
+)
+
+// message is a single message sent over a connection
+type message struct {
+	// Name is the name of the CRDT
+	Name string `json:"name"`
+	// State is the CRDT state serialized by `crdt.Marshal`
+	State json.RawMessage `json:"state"`
+}
+
+// NewPeer creates a peer replicating CRDTs over WebSocket connections.
+// `r` is used for logging and metrics, `registry` is used for deserializing the received state.
+func NewPeer(r crdt.Replica, registry crdt.Registry) Peer {
+	return Peer{
+		mutex:    &sync.Mutex{},
+		replica:  r.WithDefaults(),
+		registry: registry,
+		objects:  make(map[string]crdt.CRDT),
+		changed:  make(map[string]map[string]struct{}),
+		conns:    make(map[*websocket.Conn]*sync.Mutex),
+	}
+}
+
+// Peer streams the state of CRDTs to other peers and merges the state it receives.
+// Use `NewPeer` in order to initialize it before use.
+// The peer is thread-safe and can be used from several go routines.
+type Peer struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is used for logging and metrics
+	replica crdt.Replica
+	// registry is used for deserializing the received state
+	registry crdt.Registry
+	// objects maps a name to the replicated CRDT
+	objects map[string]crdt.CRDT
+	// changed maps the name of a CRDT observed by `Observer` to the keys changed since the last sent delta
+	changed map[string]map[string]struct{}
+	// conns maps an open connection to the mutex serializing writes to it
+	conns map[*websocket.Conn]*sync.Mutex
+}
+
+// Serve adds the CRDT to the replication under the given name.
+// Other peers must replicate the same CRDT under the same name.
+func (p Peer) Serve(name string, c crdt.CRDT) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.objects[name] = c
+}
+
+// Observer returns an observer collecting the keys of the CRDT with the given name changed by local operations
+// and merges, set it as the `crdt.Replica.Observer` of the CRDT (or chain it using `crdt.Observers`).
+// If the CRDT implements `crdt.DeltaCRDT` (e.g. `lww.Set` and `lww.Graph`) the peer sends only
+// the records of the changed keys instead of the full state.
+func (p Peer) Observer(name string) crdt.Observer {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.changed[name] == nil {
+		p.changed[name] = make(map[string]struct{})
+	}
+
+	return crdt.ObserverFunc(func(m crdt.Mutation) {
+		// called under the lock of the CRDT, the peer never holds its lock while calling the CRDT
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		p.changed[name][m.Key] = struct{}{}
+	})
+}
+
+// Handler returns the HTTP handler accepting WebSocket connections from other peers.
+// Clients must send the `Origin` header, `Connect` always does.
+func (p Peer) Handler() http.Handler {
+	return websocket.Handler(func(conn *websocket.Conn) {
+		err := p.serveConn(conn.Request().Context(), conn)
+		if err != nil {
+			p.replica.Logger.Printf("live-sync connection from %s closed: %s", conn.Request().RemoteAddr, err)
+		}
+	})
+}
+
+// Connect opens a WebSocket connection to the peer's `Handler` at the given URL (`ws://` or `wss://`)
+// and replicates over it until the context is done or the connection is closed.
+// `origin` is sent as the `Origin` header, e.g. `http://localhost/`.
+func (p Peer) Connect(ctx context.Context, url, origin string) error {
+	config, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		return errors.Wrapf(err, "invalid live-sync URL %q", url)
+	}
+
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %q", url)
+	}
+
+	return p.serveConn(ctx, conn)
+}
+
+// Notify sends the changes of the CRDT with the given name to all the connected peers:
+// the delta with the changed keys or the full state (see the package documentation).
+// It must be called after updating the CRDT locally.
+func (p Peer) Notify(name string) error {
+	p.mutex.Lock()
+	c, exists := p.objects[name]
+	p.mutex.Unlock()
+
+	if !exists {
+		return errors.Wrapf(ErrUnknownName, "%q", name)
+	}
+
+	delta, isDelta, err := p.delta(name, c)
+	if err != nil {
+		return err
+	}
+	if isDelta && delta != nil {
+		p.broadcast(*delta)
+		return nil
+	}
+
+	state, err := crdt.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	p.broadcast(message{Name: name, State: state})
+
+	return nil
+}
+
+// delta returns the message with the records of the keys changed since the last delta and resets them.
+// `isDelta` is `false` if the CRDT does not support deltas or its changes are not observed,
+// the message is nil if no observed keys changed.
+func (p Peer) delta(name string, c crdt.CRDT) (msg *message, isDelta bool, err error) {
+	deltaCRDT, supported := c.(crdt.DeltaCRDT)
+	if !supported {
+		return nil, false, nil
+	}
+
+	p.mutex.Lock()
+	changed, observed := p.changed[name]
+	if observed {
+		p.changed[name] = make(map[string]struct{})
+	}
+	p.mutex.Unlock()
+
+	if !observed {
+		return nil, false, nil
+	}
+	if len(changed) == 0 {
+		return nil, true, nil
+	}
+
+	keys := make([]string, 0, len(changed))
+	for key := range changed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	state, err := crdt.Marshal(deltaCRDT.DeltaCRDT(keys))
+	if err != nil {
+		return nil, true, err
+	}
+	p.replica.Metrics.Count("wssync.delta", 1)
+
+	return &message{Name: name, State: state}, true, nil
+}
+
+// serveConn sends the state of all the CRDTs to the connection and merges
+// the received state until the context is done or the connection is closed.
+func (p Peer) serveConn(ctx context.Context, conn *websocket.Conn) error {
+	writeMutex := &sync.Mutex{}
+
+	p.mutex.Lock()
+	p.conns[conn] = writeMutex
+	objects := make(map[string]crdt.CRDT, len(p.objects))
+	for name, c := range p.objects {
+		objects[name] = c
+	}
+	p.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	defer func() {
+		p.mutex.Lock()
+		delete(p.conns, conn)
+		p.mutex.Unlock()
+	}()
+
+	for name, c := range objects {
+		state, err := crdt.Marshal(c)
+		if err != nil {
+			return err
+		}
+		err = p.send(conn, writeMutex, message{Name: name, State: state})
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		var msg message
+		err := websocket.JSON.Receive(conn, &msg)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to receive a message")
+		}
+
+		err = p.merge(msg)
+		if err != nil {
+			// a single invalid message should not break the replication of other CRDTs
+			p.replica.Logger.Printf("live-sync failed to merge %q: %s", msg.Name, err)
+			p.replica.Metrics.Count("wssync.error", 1)
+		}
+	}
+}
+
+// merge merges the received state into the local CRDT and relays
+// the changes to all the connections if the local state changed
+func (p Peer) merge(msg message) error {
+	p.mutex.Lock()
+	c, exists := p.objects[msg.Name]
+	p.mutex.Unlock()
+
+	if !exists {
+		return errors.Wrapf(ErrUnknownName, "%q", msg.Name)
+	}
+
+	remote, err := p.registry.Unmarshal(msg.State)
+	if err != nil {
+		return err
+	}
+
+	if _, supported := c.(crdt.DeltaCRDT); supported && p.observed(msg.Name) {
+		return p.mergeDelta(msg.Name, c, remote)
+	}
+
+	before, err := crdt.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	err = c.MergeCRDT(remote)
+	if err != nil {
+		return err
+	}
+	p.replica.Metrics.Count("wssync.merge", 1)
+
+	after, err := crdt.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(before, after) {
+		p.broadcast(message{Name: msg.Name, State: after})
+	}
+
+	return nil
+}
+
+// mergeDelta merges the received state into the local CRDT supporting deltas and relays
+// the delta of the keys changed by the merge (and by local operations not notified yet)
+func (p Peer) mergeDelta(name string, c crdt.CRDT, remote crdt.CRDT) error {
+	err := c.MergeCRDT(remote)
+	if err != nil {
+		return err
+	}
+	p.replica.Metrics.Count("wssync.merge", 1)
+
+	delta, _, err := p.delta(name, c)
+	if err != nil {
+		return err
+	}
+	if delta != nil {
+		p.broadcast(*delta)
+	}
+
+	return nil
+}
+
+// observed returns `true` if the changed keys of the CRDT with the given name are collected by `Observer`
+func (p Peer) observed(name string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	_, observed := p.changed[name]
+	return observed
+}
+
+// broadcast sends the message to all the open connections.
+// Failed connections are closed, so their read loops stop.
+func (p Peer) broadcast(msg message) {
+	p.mutex.Lock()
+	conns := make(map[*websocket.Conn]*sync.Mutex, len(p.conns))
+	for conn, writeMutex := range p.conns {
+		conns[conn] = writeMutex
+	}
+	p.mutex.Unlock()
+
+	for conn, writeMutex := range conns {
+		err := p.send(conn, writeMutex, msg)
+		if err != nil {
+			p.replica.Logger.Printf("live-sync %s", err)
+			_ = conn.Close()
+		}
+	}
+}
+
+// send sends the message to the connection, `writeMutex` serializes concurrent writes
+func (p Peer) send(conn *websocket.Conn, writeMutex *sync.Mutex, msg message) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	err := websocket.JSON.Send(conn, msg)
+	if err != nil {
+		return errors.Wrapf(err, "failed to send %q", msg.Name)
+	}
+	p.replica.Metrics.Count("wssync.send", 1)
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package wssync
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestPeer(t *testing.T) {
+	v1 := lww.Vertex{Key: "vertex1", Value: "value1"}
+	v2 := lww.Vertex{Key: "vertex2", Value: "value2"}
+	v3 := lww.Vertex{Key: "vertex3", Value: "value3"}
+
+	registry := crdt.NewRegistry()
+	require.NoError(t, lww.Register(registry, crdt.NewReplica("registry")))
+
+	newPeer := func(t *testing.T, id string, observed bool) (Peer, lww.Graph) {
+		replica := crdt.NewReplica(id)
+		p := NewPeer(replica, registry)
+		if observed {
+			replica.Observer = p.Observer("graph")
+		}
+
+		g := lww.NewGraph(replica)
+		p.Serve("graph", g)
+		return p, g
+	}
+
+	hasVertex := func(g lww.Graph, v lww.Vertex) func() bool {
+		return func() bool {
+			found, err := g.Lookup(v.Key)
+			return err == nil && found == v
+		}
+	}
+
+	// A <-> B <-> C, A and B send deltas, C sends the full state
+	A, graphA := newPeer(t, "A", true)
+	B, graphB := newPeer(t, "B", true)
+	C, graphC := newPeer(t, "C", false)
+
+	require.NoError(t, graphB.AddVertex(v1))
+
+	server := httptest.NewServer(B.Handler())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for _, p := range []Peer{A, C} {
+		go func(p Peer) {
+			errs <- p.Connect(ctx, url, "http://localhost/")
+		}(p)
+	}
+	defer func() {
+		cancel()
+		require.ErrorIs(t, <-errs, context.Canceled)
+		require.ErrorIs(t, <-errs, context.Canceled)
+	}()
+
+	t.Run("sends the state when connected", func(t *testing.T) {
+		require.Eventually(t, hasVertex(graphA, v1), time.Second, time.Millisecond)
+		require.Eventually(t, hasVertex(graphC, v1), time.Second, time.Millisecond)
+	})
+
+	t.Run("streams local updates to all peers through the mesh", func(t *testing.T) {
+		require.NoError(t, graphA.AddVertex(v2))
+		require.NoError(t, A.Notify("graph"))
+
+		require.Eventually(t, hasVertex(graphB, v2), time.Second, time.Millisecond)
+		require.Eventually(t, hasVertex(graphC, v2), time.Second, time.Millisecond, "must be relayed by B")
+
+		require.NoError(t, graphC.AddVertex(v3))
+		require.NoError(t, graphC.AddEdge(v3.Key, v1.Key))
+		require.NoError(t, C.Notify("graph"))
+
+		require.Eventually(t, func() bool {
+			listA, errA := graphA.List()
+			listB, errB := graphB.List()
+			listC, errC := graphC.List()
+			return errA == nil && errB == nil && errC == nil &&
+				len(listA) == 3 &&
+				reflect.DeepEqual(listA, listB) && reflect.DeepEqual(listB, listC)
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("relays only the changed records", func(t *testing.T) {
+		conn, err := websocket.Dial(url, "", "http://localhost/")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var msg message
+		require.NoError(t, websocket.JSON.Receive(conn, &msg), "the full state on connect")
+
+		v4 := lww.Vertex{Key: "vertex4", Value: "value4"}
+		require.NoError(t, graphA.AddVertex(v4))
+		require.NoError(t, A.Notify("graph"))
+
+		require.NoError(t, websocket.JSON.Receive(conn, &msg))
+		require.Equal(t, "graph", msg.Name)
+		delta, err := registry.Unmarshal(msg.State)
+		require.NoError(t, err)
+		list, err := delta.(lww.Graph).List()
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		require.Equal(t, v4, list[0].Vertex)
+
+		require.Eventually(t, hasVertex(graphC, v4), time.Second, time.Millisecond)
+	})
+
+	t.Run("returns ErrUnknownName when notifying about unknown CRDTs", func(t *testing.T) {
+		require.ErrorIs(t, A.Notify("unknown"), ErrUnknownName)
+	})
+}
@@ -0,0 +1,527 @@
+// Package schema validates JSON values against JSON Schema documents,
+// so replicas treating the graph as a typed datastore reject malformed vertex values (see `crdt.Replica.Validator`).
+//
+// A subset of JSON Schema (draft 7) is supported, unknown keywords are ignored:
+// * `type` (a type name or a list of them: `null`, `boolean`, `object`, `array`, `number`, `integer`, `string`),
+// * `enum` and `const`,
+// * `properties`, `required` and `additionalProperties` (a boolean or a schema),
+// * `items` (a single schema for all the items), `minItems` and `maxItems`,
+// * `minimum`, `maximum`, `exclusiveMinimum` and `exclusiveMaximum` (numbers),
+// * `minLength`, `maxLength` (in characters) and `pattern` (Go regular expression syntax),
+// * `allOf`, `anyOf`, `oneOf` and `not`,
+// * boolean schemas `true` and `false`.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidSchema occurs when a schema document cannot be compiled
+	ErrInvalidSchema = errors.New("invalid schema")
+	// ErrViolation occurs when a value does not conform to the schema
+	ErrViolation = errors.New("schema violation")
+)
+
+// Schema is a compiled JSON schema, use `Compile` in order to create it.
+// It's immutable and can be used from several go routines.
+type Schema struct {
+	root *node
+}
+
+// node is a compiled (sub)schema
+type node struct {
+	// always is set for boolean schemas and makes all the other fields ignored
+	always *bool
+
+	types []string
+	enum  []interface{}
+	// constant is the value of `const` if `hasConst` is set
+	constant interface{}
+	hasConst bool
+
+	properties           map[string]*node
+	required             []string
+	additionalProperties *node
+
+	items    *node
+	minItems *int
+	maxItems *int
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+}
+
+// Compile parses and compiles the JSON schema document.
+// Returns an error with `ErrInvalidSchema` cause if the document is not a valid schema.
+func Compile(document []byte) (Schema, error) {
+	var parsed interface{}
+	err := json.Unmarshal(document, &parsed)
+	if err != nil {
+		return Schema{}, errors.Wrapf(ErrInvalidSchema, "failed to parse the schema: %s", err)
+	}
+
+	root, err := compile(parsed, "$")
+	if err != nil {
+		return Schema{}, err
+	}
+	return Schema{root: root}, nil
+}
+
+// MustCompile is like `Compile` but panics if the schema is invalid,
+// it simplifies initialization of schemas defined in the code.
+func MustCompile(document string) Schema {
+	s, err := Compile([]byte(document))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Validate implements the `crdt.Validator` interface, the value must be a JSON document conforming to the schema.
+// Returns an error with `ErrViolation` cause listing all the violations with their JSON paths.
+func (s Schema) Validate(key, value string) error {
+	var parsed interface{}
+	err := json.Unmarshal([]byte(value), &parsed)
+	if err != nil {
+		return errors.Wrapf(ErrViolation, "value is not a JSON document: %s", err)
+	}
+
+	violations := s.root.validate(parsed, "$", nil)
+	if len(violations) != 0 {
+		return errors.Wrap(ErrViolation, strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// Prefixes maps key prefixes to the schemas of the values stored under the keys with these prefixes,
+// e.g. `user/` and `order/` for graphs storing several types of vertices.
+// It implements the `crdt.Validator` interface, the longest matching prefix wins
+// and values of keys without a matching prefix are not validated.
+type Prefixes map[string]Schema
+
+// Validate implements the `crdt.Validator` interface
+func (p Prefixes) Validate(key, value string) error {
+	longest, matched := "", false
+	for prefix := range p {
+		if strings.HasPrefix(key, prefix) && (!matched || len(prefix) > len(longest)) {
+			longest, matched = prefix, true
+		}
+	}
+	if !matched {
+		return nil
+	}
+	return p[longest].Validate(key, value)
+}
+
+// compile compiles the parsed schema located at the given path of the document
+func compile(parsed interface{}, path string) (*node, error) {
+	if always, isBool := parsed.(bool); isBool {
+		return &node{always: &always}, nil
+	}
+	object, isObject := parsed.(map[string]interface{})
+	if !isObject {
+		return nil, errors.Wrapf(ErrInvalidSchema, "%s: a schema must be an object or a boolean", path)
+	}
+
+	n := &node{}
+	c := compiler{object: object, path: path}
+
+	n.types = c.types("type")
+	n.enum = c.array("enum")
+	n.constant, n.hasConst = object["const"]
+	n.properties = c.schemaMap("properties")
+	n.required = c.strings("required")
+	n.additionalProperties = c.schema("additionalProperties")
+	n.items = c.schema("items")
+	n.minItems = c.integer("minItems")
+	n.maxItems = c.integer("maxItems")
+	n.minimum = c.number("minimum")
+	n.maximum = c.number("maximum")
+	n.exclusiveMinimum = c.number("exclusiveMinimum")
+	n.exclusiveMaximum = c.number("exclusiveMaximum")
+	n.minLength = c.integer("minLength")
+	n.maxLength = c.integer("maxLength")
+	n.pattern = c.pattern("pattern")
+	n.allOf = c.schemaList("allOf")
+	n.anyOf = c.schemaList("anyOf")
+	n.oneOf = c.schemaList("oneOf")
+	n.not = c.schema("not")
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	return n, nil
+}
+
+// compiler reads the keywords of a schema object keeping the first error
+type compiler struct {
+	object map[string]interface{}
+	path   string
+	err    error
+}
+
+func (c *compiler) fail(keyword, format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = errors.Wrapf(ErrInvalidSchema, "%s.%s: %s", c.path, keyword, fmt.Sprintf(format, args...))
+	}
+}
+
+func (c *compiler) types(keyword string) []string {
+	value, exists := c.object[keyword]
+	if !exists {
+		return nil
+	}
+
+	var names []string
+	switch v := value.(type) {
+	case string:
+		names = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			name, isString := item.(string)
+			if !isString {
+				c.fail(keyword, "must be a string or a list of strings")
+				return nil
+			}
+			names = append(names, name)
+		}
+	default:
+		c.fail(keyword, "must be a string or a list of strings")
+		return nil
+	}
+
+	for _, name := range names {
+		switch name {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			c.fail(keyword, "unknown type %q", name)
+			return nil
+		}
+	}
+	return names
+}
+
+func (c *compiler) array(keyword string) []interface{} {
+	value, exists := c.object[keyword]
+	if !exists {
+		return nil
+	}
+	list, isList := value.([]interface{})
+	if !isList {
+		c.fail(keyword, "must be a list")
+		return nil
+	}
+	return list
+}
+
+func (c *compiler) strings(keyword string) []string {
+	list := c.array(keyword)
+	names := make([]string, 0, len(list))
+	for _, item := range list {
+		name, isString := item.(string)
+		if !isString {
+			c.fail(keyword, "must be a list of strings")
+			return nil
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func (c *compiler) number(keyword string) *float64 {
+	value, exists := c.object[keyword]
+	if !exists {
+		return nil
+	}
+	number, isNumber := value.(float64)
+	if !isNumber {
+		c.fail(keyword, "must be a number")
+		return nil
+	}
+	return &number
+}
+
+func (c *compiler) integer(keyword string) *int {
+	number := c.number(keyword)
+	if number == nil {
+		return nil
+	}
+	if *number < 0 || *number != math.Trunc(*number) {
+		c.fail(keyword, "must be a non-negative integer")
+		return nil
+	}
+	integer := int(*number)
+	return &integer
+}
+
+func (c *compiler) pattern(keyword string) *regexp.Regexp {
+	value, exists := c.object[keyword]
+	if !exists {
+		return nil
+	}
+	expr, isString := value.(string)
+	if !isString {
+		c.fail(keyword, "must be a string")
+		return nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		c.fail(keyword, "invalid regular expression: %s", err)
+		return nil
+	}
+	return re
+}
+
+func (c *compiler) schema(keyword string) *node {
+	value, exists := c.object[keyword]
+	if !exists || c.err != nil {
+		return nil
+	}
+	n, err := compile(value, c.path+"."+keyword)
+	if err != nil {
+		c.err = err
+		return nil
+	}
+	return n
+}
+
+func (c *compiler) schemaList(keyword string) []*node {
+	list := c.array(keyword)
+	nodes := make([]*node, 0, len(list))
+	for i, item := range list {
+		if c.err != nil {
+			return nil
+		}
+		n, err := compile(item, fmt.Sprintf("%s.%s[%d]", c.path, keyword, i))
+		if err != nil {
+			c.err = err
+			return nil
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func (c *compiler) schemaMap(keyword string) map[string]*node {
+	value, exists := c.object[keyword]
+	if !exists {
+		return nil
+	}
+	object, isObject := value.(map[string]interface{})
+	if !isObject {
+		c.fail(keyword, "must be an object")
+		return nil
+	}
+	nodes := make(map[string]*node, len(object))
+	for name, item := range object {
+		if c.err != nil {
+			return nil
+		}
+		n, err := compile(item, c.path+"."+keyword+"."+name)
+		if err != nil {
+			c.err = err
+			return nil
+		}
+		nodes[name] = n
+	}
+	return nodes
+}
+
+// validate appends the violations of the value located at the given path to `violations`
+func (n *node) validate(value interface{}, path string, violations []string) []string {
+	if n.always != nil {
+		if !*n.always {
+			violations = append(violations, path+": no value is allowed")
+		}
+		return violations
+	}
+
+	if len(n.types) != 0 && !matchesType(n.types, value) {
+		return append(violations, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(n.types, " or "), typeOf(value)))
+	}
+	if n.enum != nil && !containsValue(n.enum, value) {
+		violations = append(violations, path+": value is not one of the allowed values")
+	}
+	if n.hasConst && !reflect.DeepEqual(n.constant, value) {
+		violations = append(violations, path+": value is not the allowed constant")
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		violations = n.validateObject(v, path, violations)
+	case []interface{}:
+		violations = n.validateArray(v, path, violations)
+	case float64:
+		violations = n.validateNumber(v, path, violations)
+	case string:
+		violations = n.validateString(v, path, violations)
+	}
+
+	for _, sub := range n.allOf {
+		violations = sub.validate(value, path, violations)
+	}
+	if len(n.anyOf) != 0 {
+		matched := 0
+		for _, sub := range n.anyOf {
+			if len(sub.validate(value, path, nil)) == 0 {
+				matched++
+				break
+			}
+		}
+		if matched == 0 {
+			violations = append(violations, path+": value matches none of anyOf")
+		}
+	}
+	if len(n.oneOf) != 0 {
+		matched := 0
+		for _, sub := range n.oneOf {
+			if len(sub.validate(value, path, nil)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			violations = append(violations, fmt.Sprintf("%s: value matches %d of oneOf instead of exactly one", path, matched))
+		}
+	}
+	if n.not != nil && len(n.not.validate(value, path, nil)) == 0 {
+		violations = append(violations, path+": value must not match the schema of not")
+	}
+
+	return violations
+}
+
+func (n *node) validateObject(object map[string]interface{}, path string, violations []string) []string {
+	for _, name := range n.required {
+		if _, exists := object[name]; !exists {
+			violations = append(violations, fmt.Sprintf("%s: missing required property %q", path, name))
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := path + "." + name
+		if property, defined := n.properties[name]; defined {
+			violations = property.validate(object[name], propertyPath, violations)
+			continue
+		}
+		if n.additionalProperties != nil {
+			violations = n.additionalProperties.validate(object[name], propertyPath, violations)
+		}
+	}
+	return violations
+}
+
+func (n *node) validateArray(array []interface{}, path string, violations []string) []string {
+	if n.minItems != nil && len(array) < *n.minItems {
+		violations = append(violations, fmt.Sprintf("%s: expected at least %d items, got %d", path, *n.minItems, len(array)))
+	}
+	if n.maxItems != nil && len(array) > *n.maxItems {
+		violations = append(violations, fmt.Sprintf("%s: expected at most %d items, got %d", path, *n.maxItems, len(array)))
+	}
+	if n.items != nil {
+		for i, item := range array {
+			violations = n.items.validate(item, fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+	}
+	return violations
+}
+
+func (n *node) validateNumber(number float64, path string, violations []string) []string {
+	if n.minimum != nil && number < *n.minimum {
+		violations = append(violations, fmt.Sprintf("%s: %v is less than the minimum %v", path, number, *n.minimum))
+	}
+	if n.maximum != nil && number > *n.maximum {
+		violations = append(violations, fmt.Sprintf("%s: %v is greater than the maximum %v", path, number, *n.maximum))
+	}
+	if n.exclusiveMinimum != nil && number <= *n.exclusiveMinimum {
+		violations = append(violations, fmt.Sprintf("%s: %v is not greater than %v", path, number, *n.exclusiveMinimum))
+	}
+	if n.exclusiveMaximum != nil && number >= *n.exclusiveMaximum {
+		violations = append(violations, fmt.Sprintf("%s: %v is not less than %v", path, number, *n.exclusiveMaximum))
+	}
+	return violations
+}
+
+func (n *node) validateString(s string, path string, violations []string) []string {
+	length := utf8.RuneCountInString(s)
+	if n.minLength != nil && length < *n.minLength {
+		message := fmt.Sprintf("expected at least %d characters, got %d", *n.minLength, length)
+		violations = append(violations, path+": "+message)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		message := fmt.Sprintf("expected at most %d characters, got %d", *n.maxLength, length)
+		violations = append(violations, path+": "+message)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(s) {
+		violations = append(violations, fmt.Sprintf("%s: %q does not match the pattern %q", path, s, n.pattern))
+	}
+	return violations
+}
+
+// matchesType returns `true` if the value is of one of the given types
+func matchesType(types []string, value interface{}) bool {
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON schema type of the parsed value, integral numbers are integers
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// containsValue returns `true` if the list has a value deeply equal to the given one
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+var _ crdt.Validator = Schema{}
+var _ crdt.Validator = Prefixes{}
+
+func TestCompile(t *testing.T) {
+	t.Run("fails on invalid documents", func(t *testing.T) {
+		cases := map[string]string{
+			"not JSON":         `{`,
+			"not an object":    `42`,
+			"unknown type":     `{"type": "date"}`,
+			"invalid type":     `{"type": 1}`,
+			"negative length":  `{"minLength": -1}`,
+			"invalid pattern":  `{"pattern": "("}`,
+			"invalid property": `{"properties": {"name": "string"}}`,
+			"invalid list":     `{"anyOf": {"type": "string"}}`,
+		}
+		for name, document := range cases {
+			_, err := Compile([]byte(document))
+			require.ErrorIs(t, err, ErrInvalidSchema, name)
+		}
+	})
+
+	t.Run("ignores unknown keywords", func(t *testing.T) {
+		s, err := Compile([]byte(`{"$schema": "http://json-schema.org/draft-07/schema#", "format": "email"}`))
+		require.NoError(t, err)
+		require.NoError(t, s.Validate("key", `"not an email"`))
+	})
+
+	t.Run("MustCompile panics on invalid documents", func(t *testing.T) {
+		require.Panics(t, func() {
+			MustCompile(`{"type": "date"}`)
+		})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	user := MustCompile(`{
+		"type": "object",
+		"required": ["name", "age"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 5},
+			"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+			"role": {"enum": ["admin", "user"]},
+			"tags": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}, "maxItems": 2}
+		},
+		"additionalProperties": false
+	}`)
+
+	t.Run("accepts conforming values", func(t *testing.T) {
+		require.NoError(t, user.Validate("user/1", `{"name": "Ёлка", "age": 30}`))
+		require.NoError(t, user.Validate("user/2", `{"name": "bob", "age": 0, "role": "admin", "tags": ["a", "b"]}`))
+	})
+
+	t.Run("rejects violations with their paths", func(t *testing.T) {
+		cases := map[string]struct {
+			value   string
+			message string
+		}{
+			"not JSON":           {`name`, "value is not a JSON document"},
+			"wrong type":         {`[]`, "$: expected object, got array"},
+			"missing property":   {`{"name": "bob"}`, `$: missing required property "age"`},
+			"not an integer":     {`{"name": "bob", "age": 1.5}`, "$.age: expected integer, got number"},
+			"too small":          {`{"name": "bob", "age": -1}`, "$.age: -1 is less than the minimum 0"},
+			"too large":          {`{"name": "bob", "age": 150}`, "$.age: 150 is not less than 150"},
+			"too short":          {`{"name": "", "age": 1}`, "$.name: expected at least 1 characters, got 0"},
+			"too long":           {`{"name": "robert", "age": 1}`, "$.name: expected at most 5 characters, got 6"},
+			"not allowed value":  {`{"name": "bob", "age": 1, "role": "root"}`, "$.role: value is not one of the allowed"},
+			"pattern mismatch":   {`{"name": "bob", "age": 1, "tags": ["A"]}`, `$.tags[0]: "A" does not match the pattern`},
+			"too many items":     {`{"name": "bob", "age": 1, "tags": ["a", "b", "c"]}`, "$.tags: expected at most 2 items"},
+			"unknown property":   {`{"name": "bob", "age": 1, "email": ""}`, "$.email: no value is allowed"},
+			"several violations": {`{"name": 1}`, `$: missing required property "age"; $.name: expected string`},
+		}
+		for name, c := range cases {
+			err := user.Validate("user/1", c.value)
+			require.ErrorIs(t, err, ErrViolation, name)
+			require.Contains(t, err.Error(), c.message, name)
+		}
+	})
+
+	t.Run("supports combinators and constants", func(t *testing.T) {
+		s := MustCompile(`{
+			"anyOf": [{"type": "null"}, {"const": {"status": "done"}}],
+			"not": {"type": "boolean"}
+		}`)
+		require.NoError(t, s.Validate("key", `null`))
+		require.NoError(t, s.Validate("key", `{"status": "done"}`))
+		require.ErrorIs(t, s.Validate("key", `{"status": "todo"}`), ErrViolation)
+
+		s = MustCompile(`{"oneOf": [{"type": "number"}, {"type": "integer"}], "allOf": [{"maximum": 10}]}`)
+		require.NoError(t, s.Validate("key", `1.5`))
+		require.ErrorIs(t, s.Validate("key", `1`), ErrViolation, "matches both")
+		require.ErrorIs(t, s.Validate("key", `10.5`), ErrViolation)
+	})
+}
+
+func TestPrefixes(t *testing.T) {
+	validator := Prefixes{
+		"user/":       MustCompile(`{"type": "object"}`),
+		"user/admin/": MustCompile(`{"type": "object", "required": ["permissions"]}`),
+		"count/":      MustCompile(`{"type": "integer"}`),
+	}
+
+	require.NoError(t, validator.Validate("user/1", `{}`))
+	require.ErrorIs(t, validator.Validate("user/admin/1", `{}`), ErrViolation, "the longest prefix wins")
+	require.NoError(t, validator.Validate("user/admin/1", `{"permissions": []}`))
+	require.ErrorIs(t, validator.Validate("count/visits", `"1"`), ErrViolation)
+	require.NoError(t, validator.Validate("other", `not JSON`), "keys without a schema are not validated")
+}
@@ -0,0 +1,125 @@
+package sequence
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+const (
+	// RGAKind is the CRDT kind of the Replicated Growable Array
+	RGAKind crdt.Kind = "sequence.rga"
+)
+
+// Register registers all the CRDT kinds of this package in the given registry.
+// All the CRDTs created by the registry belong to the given replica.
+func Register(r crdt.Registry, replica crdt.Replica) error {
+	return r.Register(RGAKind, func() crdt.CRDT { return NewRGA(replica) })
+}
+
+// rgaState is the serialized format of the list
+type rgaState struct {
+	// Counter is the greatest Lamport timestamp observed by the replica
+	Counter uint64 `json:"counter"`
+	// Nodes are all the inserted items including removed ones ordered by their IDs
+	Nodes []nodeState `json:"nodes"`
+}
+
+// nodeState is the serialized format of an inserted item
+type nodeState struct {
+	// ID is the position identifier of the item
+	ID ID `json:"id"`
+	// Parent is the ID of the item this item was inserted after
+	Parent ID `json:"parent"`
+	// Value is the JSON representation of the item value
+	Value json.RawMessage `json:"value"`
+	// Removed is `true` if the item has been removed
+	Removed bool `json:"removed,omitempty"`
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (l RGA) Kind() crdt.Kind {
+	return RGAKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (l RGA) MergeCRDT(remote crdt.CRDT) error {
+	remoteList, isList := remote.(RGA)
+	if !isList {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", l.Kind(), remote.Kind())
+	}
+	l.Merge(remoteList)
+	return nil
+}
+
+// Marshal implements the `crdt.CRDT` interface, the item values must be serializable to JSON
+func (l RGA) Marshal() ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	state := rgaState{
+		Counter: *l.counter,
+		Nodes:   make([]nodeState, 0, len(l.nodes)),
+	}
+	for id, n := range l.nodes {
+		value, err := json.Marshal(n.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal item [counter = %d, replica = %q]", id.Counter, id.ReplicaID)
+		}
+		state.Nodes = append(state.Nodes, nodeState{
+			ID:      id,
+			Parent:  n.parent,
+			Value:   value,
+			Removed: n.removed,
+		})
+	}
+	sort.Slice(state.Nodes, func(i, j int) bool {
+		return state.Nodes[i].ID.Less(state.Nodes[j].ID)
+	})
+
+	return json.Marshal(state)
+}
+
+// Unmarshal implements the `crdt.CRDT` interface.
+// The item values are decoded into generic JSON values, e.g. numbers into `float64`.
+func (l RGA) Unmarshal(data []byte) error {
+	var state rgaState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal RGA")
+	}
+
+	// the Lamport clock must be ahead of all the restored insertions
+	counter := state.Counter
+	nodes := make(map[ID]*node, len(state.Nodes))
+	for _, ns := range state.Nodes {
+		if ns.ID.Counter > counter {
+			counter = ns.ID.Counter
+		}
+		var value interface{}
+		err = json.Unmarshal(ns.Value, &value)
+		if err != nil {
+			return errors.Wrapf(err, "failed to unmarshal item [counter = %d, replica = %q]", ns.ID.Counter, ns.ID.ReplicaID)
+		}
+		nodes[ns.ID] = &node{
+			Item:    Item{ID: ns.ID, Value: value},
+			parent:  ns.Parent,
+			removed: ns.Removed,
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for id := range l.nodes {
+		delete(l.nodes, id)
+	}
+	for id, n := range nodes {
+		l.nodes[id] = n
+	}
+	*l.counter = counter
+
+	return nil
+}
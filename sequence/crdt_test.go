@@ -0,0 +1,43 @@
+package sequence
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/counter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRDT(t *testing.T) {
+	registry := crdt.NewRegistry()
+	require.NoError(t, Register(registry, crdt.NewReplica("B")))
+	require.Equal(t, []crdt.Kind{RGAKind}, registry.Kinds())
+
+	t.Run("survives a marshal/unmarshal round trip keeping the removed items", func(t *testing.T) {
+		A := NewRGA(crdt.NewReplica("A"))
+		insertAll(t, A, 0, "a", "b", "c")
+		C := NewRGA(crdt.NewReplica("C"))
+		C.Merge(A)
+		require.NoError(t, A.Remove(1))
+
+		data, err := crdt.Marshal(A)
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"a", "c"}, values(t, restored.(RGA)))
+
+		// the removal is applied to the replicas which have seen the item
+		require.NoError(t, C.MergeCRDT(restored))
+		require.Equal(t, []interface{}{"a", "c"}, values(t, C))
+
+		// new items of the restored replica do not collide with the restored ones
+		insertAll(t, restored.(RGA), 2, "d")
+		A.Merge(restored.(RGA))
+		require.Equal(t, []interface{}{"a", "c", "d"}, values(t, A))
+	})
+
+	t.Run("returns ErrKindMismatch when merging CRDTs of different kinds", func(t *testing.T) {
+		err := NewRGA(crdt.NewReplica("A")).MergeCRDT(counter.NewPN(crdt.NewReplica("A")))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+	})
+}
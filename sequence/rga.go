@@ -0,0 +1,232 @@
+// Package sequence implements an ordered list CRDT based on the
+// Replicated Growable Array (RGA) algorithm.
+//
+// Every inserted item gets a stable position identifier, which does not change
+// when other items are inserted or removed, so concurrent edits of the same list
+// on different replicas converge to the same order. It enables collaborative list
+// and text editing which cannot be expressed with unordered sets.
+package sequence
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+)
+
+var (
+	// ErrIndexOutOfRange occurs when accessing a position that does not exist in the list
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+// ID is a stable position identifier of an item in the list.
+// It consists of a Lamport timestamp and the ID of the replica that inserted the item.
+type ID struct {
+	// Counter is the Lamport timestamp of the insertion
+	Counter uint64
+	// ReplicaID is the replica that inserted the item
+	ReplicaID string
+}
+
+// Less returns `true` if the ID is ordered before the `other` ID
+func (id ID) Less(other ID) bool {
+	if id.Counter == other.Counter {
+		return id.ReplicaID < other.ReplicaID
+	}
+	return id.Counter < other.Counter
+}
+
+// Item is a single item of the list with its position identifier
+type Item struct {
+	// ID is the stable position identifier of the item
+	ID ID
+	// Value is the value stored in the item
+	Value interface{}
+}
+
+// node is an inserted item and its position in the list
+type node struct {
+	Item
+	// parent is the ID of the item this item was inserted after,
+	// the zero ID means the item was inserted at the beginning of the list.
+	parent ID
+	// removed is `true` if the item has been removed (tombstone)
+	removed bool
+}
+
+// NewRGA initializes the Replicated Growable Array and makes it ready for use.
+// The replica ID is used in position identifiers of inserted items,
+// `Limits.MaxElements` of the replica limits the number of items in the list.
+func NewRGA(r crdt.Replica) RGA {
+	return RGA{
+		mutex:   &sync.Mutex{},
+		replica: r.WithDefaults(),
+		counter: new(uint64),
+		nodes:   make(map[ID]*node),
+	}
+}
+
+// RGA is a Replicated Growable Array state-based ordered list implementation.
+// Use `NewRGA` in order to initialize it before use.
+// The list is thread-safe and can be used from several go routines.
+//
+// The items form a tree where every item is a child of the item it was inserted after.
+// The list order is the pre-order traversal of this tree where children are ordered
+// by their IDs in the descending order, so the latest insertion at the same position goes first.
+// Removed items stay in the tree as tombstones to keep positions of their children.
+type RGA struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is the identity and the policies of the replica the list belongs to
+	replica crdt.Replica
+	// counter is the greatest Lamport timestamp observed by the replica
+	counter *uint64
+
+	// nodes contains all the inserted items including removed ones
+	nodes map[ID]*node
+}
+
+// InsertAt inserts the value at the given index, so the index of the inserted item equals `index`.
+// The index can be equal to the list length in order to append the item.
+// Returns the position identifier of the inserted item.
+// Returns `ErrIndexOutOfRange` if the index is negative or greater than the list length.
+// Returns an error with `crdt.ErrLimitExceeded` cause if the list is full.
+func (l RGA) InsertAt(index int, value interface{}) (id ID, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	visible := l.visible()
+	if index < 0 || index > len(visible) {
+		return id, errors.Wrapf(ErrIndexOutOfRange, "failed to insert at %d, length %d", index, len(visible))
+	}
+
+	err = l.replica.CheckLimit(len(visible))
+	if err != nil {
+		return id, err
+	}
+
+	var parent ID
+	if index > 0 {
+		parent = visible[index-1].ID
+	}
+
+	*l.counter++
+	id = ID{
+		Counter:   *l.counter,
+		ReplicaID: l.replica.ID,
+	}
+
+	l.nodes[id] = &node{
+		Item: Item{
+			ID:    id,
+			Value: value,
+		},
+		parent: parent,
+	}
+
+	return id, nil
+}
+
+// Remove removes the item at the given index.
+// Returns `ErrIndexOutOfRange` if there is no item at the given index.
+func (l RGA) Remove(index int) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	visible := l.visible()
+	if index < 0 || index >= len(visible) {
+		return errors.Wrapf(ErrIndexOutOfRange, "failed to remove at %d, length %d", index, len(visible))
+	}
+
+	l.nodes[visible[index].ID].removed = true
+
+	return nil
+}
+
+// Len returns the number of items in the list
+func (l RGA) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return len(l.visible())
+}
+
+// Slice returns the items in the range of indices [`from`, `to`).
+// Returns `ErrIndexOutOfRange` if the range is not within the list bounds.
+func (l RGA) Slice(from, to int) (items []Item, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	visible := l.visible()
+	if from < 0 || to > len(visible) || from > to {
+		return nil, errors.Wrapf(ErrIndexOutOfRange, "failed to slice [%d:%d], length %d", from, to, len(visible))
+	}
+
+	items = make([]Item, 0, to-from)
+	for _, n := range visible[from:to] {
+		items = append(items, n.Item)
+	}
+
+	return items, nil
+}
+
+// Merge takes another RGA as a `remote` and merges its state into itself.
+// Merging two replicas takes the union of their items and tombstones.
+func (l RGA) Merge(remote RGA) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for id, remoteNode := range remote.nodes {
+		localNode, exists := l.nodes[id]
+		if !exists {
+			copied := *remoteNode
+			l.nodes[id] = &copied
+			continue
+		}
+		localNode.removed = localNode.removed || remoteNode.removed
+	}
+
+	// the Lamport clock must be ahead of all the observed insertions
+	if *remote.counter > *l.counter {
+		*l.counter = *remote.counter
+	}
+}
+
+// visible returns all the items which have not been removed in the list order
+func (l RGA) visible() []*node {
+	children := make(map[ID][]*node, len(l.nodes))
+	for _, n := range l.nodes {
+		children[n.parent] = append(children[n.parent], n)
+	}
+	for _, siblings := range children {
+		sort.Slice(siblings, func(i, j int) bool {
+			return siblings[j].ID.Less(siblings[i].ID)
+		})
+	}
+
+	visible := make([]*node, 0, len(l.nodes))
+
+	// iterative pre-order traversal starting from the children of the root
+	var stack []*node
+	push := func(parent ID) {
+		siblings := children[parent]
+		for i := len(siblings) - 1; i >= 0; i-- {
+			stack = append(stack, siblings[i])
+		}
+	}
+	push(ID{})
+
+	for len(stack) != 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !current.removed {
+			visible = append(visible, current)
+		}
+		push(current.ID)
+	}
+
+	return visible
+}
@@ -0,0 +1,147 @@
+package sequence
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+func values(t *testing.T, l RGA) []interface{} {
+	items, err := l.Slice(0, l.Len())
+	require.NoError(t, err)
+
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.Value)
+	}
+	return result
+}
+
+func insertAll(t *testing.T, l RGA, index int, vals ...interface{}) {
+	for i, v := range vals {
+		_, err := l.InsertAt(index+i, v)
+		require.NoError(t, err)
+	}
+}
+
+func TestRGA(t *testing.T) {
+	t.Run("List operations", func(t *testing.T) {
+		t.Run("inserts items at the given positions", func(t *testing.T) {
+			l := NewRGA(crdt.NewReplica("A"))
+			insertAll(t, l, 0, "a", "c")
+			insertAll(t, l, 1, "b")
+			insertAll(t, l, 0, "start")
+			insertAll(t, l, 4, "end")
+
+			require.Equal(t, []interface{}{"start", "a", "b", "c", "end"}, values(t, l))
+		})
+
+		t.Run("removes items at the given positions", func(t *testing.T) {
+			l := NewRGA(crdt.NewReplica("A"))
+			insertAll(t, l, 0, "a", "b", "c")
+
+			require.NoError(t, l.Remove(1))
+			require.Equal(t, []interface{}{"a", "c"}, values(t, l))
+
+			// inserting after a position next to a tombstone
+			insertAll(t, l, 1, "d")
+			require.Equal(t, []interface{}{"a", "d", "c"}, values(t, l))
+		})
+
+		t.Run("position identifiers are stable", func(t *testing.T) {
+			l := NewRGA(crdt.NewReplica("A"))
+			id, err := l.InsertAt(0, "a")
+			require.NoError(t, err)
+			insertAll(t, l, 0, "b", "c")
+
+			items, err := l.Slice(2, 3)
+			require.NoError(t, err)
+			require.Equal(t, []Item{{ID: id, Value: "a"}}, items)
+		})
+
+		t.Run("returns ErrLimitExceeded when the list is full", func(t *testing.T) {
+			r := crdt.NewReplica("A")
+			r.Limits.MaxElements = 2
+			l := NewRGA(r)
+			insertAll(t, l, 0, "a", "b")
+
+			_, err := l.InsertAt(0, "c")
+			require.ErrorIs(t, err, crdt.ErrLimitExceeded)
+		})
+
+		t.Run("returns ErrIndexOutOfRange for invalid positions", func(t *testing.T) {
+			l := NewRGA(crdt.NewReplica("A"))
+
+			_, err := l.InsertAt(1, "a")
+			require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+			_, err = l.InsertAt(-1, "a")
+			require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+			err = l.Remove(0)
+			require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+			_, err = l.Slice(0, 1)
+			require.ErrorIs(t, err, ErrIndexOutOfRange)
+		})
+	})
+
+	t.Run("CRDT properties", func(t *testing.T) {
+		t.Run("concurrent insertions at the same position converge", func(t *testing.T) {
+			// Time ->
+			// A--Insert(a,b)-\--InsertAt(1, x)--\---|
+			// B---------------\-InsertAt(1, y)---\--|=> A,B = {a,?,?,b}
+			A := NewRGA(crdt.NewReplica("A"))
+			B := NewRGA(crdt.NewReplica("B"))
+
+			insertAll(t, A, 0, "a", "b")
+			B.Merge(A)
+
+			insertAll(t, A, 1, "x1", "x2")
+			insertAll(t, B, 1, "y1", "y2")
+
+			A.Merge(B)
+			B.Merge(A)
+
+			require.Equal(t, values(t, A), values(t, B))
+			require.Len(t, values(t, A), 6)
+			require.Equal(t, "a", values(t, A)[0])
+			require.Equal(t, "b", values(t, A)[5])
+
+			// insertions of a single replica are not interleaved
+			require.Contains(t, [][]interface{}{
+				{"a", "x1", "x2", "y1", "y2", "b"},
+				{"a", "y1", "y2", "x1", "x2", "b"},
+			}, values(t, A))
+		})
+
+		t.Run("concurrent removal and insertion converge", func(t *testing.T) {
+			A := NewRGA(crdt.NewReplica("A"))
+			B := NewRGA(crdt.NewReplica("B"))
+
+			insertAll(t, A, 0, "a", "b", "c")
+			B.Merge(A)
+
+			require.NoError(t, A.Remove(1))
+			insertAll(t, B, 2, "d")
+
+			A.Merge(B)
+			B.Merge(A)
+
+			require.Equal(t, []interface{}{"a", "d", "c"}, values(t, A))
+			require.Equal(t, values(t, A), values(t, B))
+		})
+
+		t.Run("insertion after merge goes to the requested position", func(t *testing.T) {
+			A := NewRGA(crdt.NewReplica("A"))
+			B := NewRGA(crdt.NewReplica("B"))
+
+			insertAll(t, B, 0, "b1", "b2", "b3")
+			A.Merge(B)
+			insertAll(t, A, 1, "a")
+
+			require.Equal(t, []interface{}{"b1", "a", "b2", "b3"}, values(t, A))
+		})
+	})
+}
@@ -0,0 +1,183 @@
+package sets
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+const (
+	// GSetKind is the CRDT kind of the grow-only set
+	GSetKind crdt.Kind = "sets.gset"
+	// TwoPhaseSetKind is the CRDT kind of the two-phase set
+	TwoPhaseSetKind crdt.Kind = "sets.twophase"
+)
+
+// Register registers all the CRDT kinds of this package in the given registry.
+// All the CRDTs created by the registry belong to the given replica.
+// Sets created by the registry can unmarshal only `lww.IDElement` elements.
+func Register(r crdt.Registry, replica crdt.Replica) error {
+	err := r.Register(GSetKind, func() crdt.CRDT { return NewGSet(replica) })
+	if err != nil {
+		return err
+	}
+
+	return r.Register(TwoPhaseSetKind, func() crdt.CRDT { return NewTwoPhaseSet(replica) })
+}
+
+// gsetState is the serialized format of the grow-only set
+type gsetState struct {
+	// Elements maps an element key to the JSON representation of the element
+	Elements map[string]json.RawMessage `json:"elements"`
+}
+
+// twoPhaseState is the serialized format of the two-phase set
+type twoPhaseState struct {
+	// Additions is the state of the grow-only set of additions
+	Additions gsetState `json:"additions"`
+	// Removals is the list of all removed keys
+	Removals []string `json:"removals"`
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (s GSet) Kind() crdt.Kind {
+	return GSetKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (s GSet) MergeCRDT(remote crdt.CRDT) error {
+	remoteSet, isSet := remote.(GSet)
+	if !isSet {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", s.Kind(), remote.Kind())
+	}
+	s.Merge(remoteSet)
+	return nil
+}
+
+// Marshal implements the `crdt.CRDT` interface
+func (s GSet) Marshal() ([]byte, error) {
+	state, err := s.state()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(state)
+}
+
+// Unmarshal implements the `crdt.CRDT` interface.
+// The elements are deserialized using the decoder the set was initialized with.
+func (s GSet) Unmarshal(data []byte) error {
+	var state gsetState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal grow-only set")
+	}
+	return s.restoreState(state)
+}
+
+// state returns the serializable state of the set
+func (s GSet) state() (state gsetState, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state.Elements = make(map[string]json.RawMessage, len(s.elements))
+	for key, e := range s.elements {
+		state.Elements[key], err = json.Marshal(e)
+		if err != nil {
+			return state, errors.Wrapf(err, "failed to marshal element [key = %q]", key)
+		}
+	}
+
+	return state, nil
+}
+
+// restoreState replaces the state of the set with the given one.
+// The set remains unchanged if any of the elements cannot be decoded.
+func (s GSet) restoreState(state gsetState) (err error) {
+	elements := make(map[string]lww.Element, len(state.Elements))
+	for key, element := range state.Elements {
+		elements[key], err = s.decode(element)
+		if err != nil {
+			return errors.Wrapf(err, "failed to unmarshal element [key = %q]", key)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key := range s.elements {
+		delete(s.elements, key)
+	}
+	for key, e := range elements {
+		s.elements[key] = e
+	}
+
+	return nil
+}
+
+// Kind implements the `crdt.CRDT` interface
+func (s TwoPhaseSet) Kind() crdt.Kind {
+	return TwoPhaseSetKind
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface
+func (s TwoPhaseSet) MergeCRDT(remote crdt.CRDT) error {
+	remoteSet, isSet := remote.(TwoPhaseSet)
+	if !isSet {
+		return errors.Wrapf(crdt.ErrKindMismatch, "expected %q, got %q", s.Kind(), remote.Kind())
+	}
+	s.Merge(remoteSet)
+	return nil
+}
+
+// Marshal implements the `crdt.CRDT` interface
+func (s TwoPhaseSet) Marshal() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	additions, err := s.additions.state()
+	if err != nil {
+		return nil, err
+	}
+
+	state := twoPhaseState{
+		Additions: additions,
+		Removals:  make([]string, 0, len(s.removals)),
+	}
+	for key := range s.removals {
+		state.Removals = append(state.Removals, key)
+	}
+	sort.Strings(state.Removals)
+
+	return json.Marshal(state)
+}
+
+// Unmarshal implements the `crdt.CRDT` interface.
+// The elements are deserialized using the decoder the set was initialized with,
+// the set remains unchanged if any of the elements cannot be decoded.
+func (s TwoPhaseSet) Unmarshal(data []byte) error {
+	var state twoPhaseState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal two-phase set")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err = s.additions.restoreState(state.Additions)
+	if err != nil {
+		return err
+	}
+
+	for key := range s.removals {
+		delete(s.removals, key)
+	}
+	for _, key := range state.Removals {
+		s.removals[key] = nothing{}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package sets
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRDT(t *testing.T) {
+	registry := crdt.NewRegistry()
+	require.NoError(t, Register(registry, testReplica))
+	require.Equal(t, []crdt.Kind{GSetKind, TwoPhaseSetKind}, registry.Kinds())
+
+	e1 := lww.IDElement("element1")
+	e2 := lww.IDElement("element2")
+
+	t.Run("grow-only set survives a marshal/unmarshal round trip", func(t *testing.T) {
+		s := NewGSet(testReplica)
+		s.Add(e1)
+		s.Add(e2)
+
+		data, err := crdt.Marshal(s)
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+
+		list := restored.(GSet).List()
+		sortElements(list)
+		require.Equal(t, []lww.Element{e1, e2}, list)
+	})
+
+	t.Run("two-phase set survives a marshal/unmarshal round trip keeping the removals", func(t *testing.T) {
+		s := NewTwoPhaseSet(testReplica)
+		require.NoError(t, s.Add(e1))
+		require.NoError(t, s.Add(e2))
+		require.NoError(t, s.Remove(e2.GetKey()))
+
+		data, err := crdt.Marshal(s)
+		require.NoError(t, err)
+		restored, err := registry.Unmarshal(data)
+		require.NoError(t, err)
+
+		require.Equal(t, []lww.Element{e1}, restored.(TwoPhaseSet).List())
+		require.ErrorIs(t, restored.(TwoPhaseSet).Add(e2), ErrElementRemoved)
+	})
+
+	t.Run("decodes elements with the given decoder", func(t *testing.T) {
+		v := lww.Vertex{Key: "vertex1", Value: "value1"}
+		s := NewTwoPhaseSet(testReplica)
+		require.NoError(t, s.Add(v))
+		data, err := s.Marshal()
+		require.NoError(t, err)
+
+		restored := NewTwoPhaseSetWithDecoder(testReplica, lww.DecodeVertex)
+		require.NoError(t, restored.Unmarshal(data))
+		found, err := restored.Lookup(v.Key)
+		require.NoError(t, err)
+		require.Equal(t, v, found)
+	})
+
+	t.Run("returns ErrKindMismatch when merging CRDTs of different kinds", func(t *testing.T) {
+		err := NewGSet(testReplica).MergeCRDT(NewTwoPhaseSet(testReplica))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+
+		err = NewTwoPhaseSet(testReplica).MergeCRDT(NewGSet(testReplica))
+		require.ErrorIs(t, err, crdt.ErrKindMismatch)
+	})
+}
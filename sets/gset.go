@@ -0,0 +1,154 @@
+package sets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+// NewGSet initializes the grow-only set and makes it ready for use.
+// The set does not depend on the replica clock, `r` provides the metrics of the set operations.
+// The set can unmarshal only `lww.IDElement` elements, use `NewGSetWithDecoder` for other element types.
+func NewGSet(r crdt.Replica) GSet {
+	return NewGSetWithDecoder(r, lww.DecodeIDElement)
+}
+
+// NewGSetWithDecoder initializes the grow-only set and makes it ready for use.
+// `decode` is used for deserializing elements in `Unmarshal`.
+func NewGSetWithDecoder(r crdt.Replica, decode lww.ElementDecoder) GSet {
+	return GSet{
+		mutex:    &sync.Mutex{},
+		replica:  r.WithDefaults(),
+		decode:   decode,
+		elements: make(map[string]lww.Element),
+	}
+}
+
+// GSet is a grow-only set implementation, elements cannot be removed from it.
+// Use `NewGSet` in order to initialize it before use.
+// The set is thread-safe and can be used from several go routines.
+type GSet struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is the identity and the policies of the replica the set belongs to
+	replica crdt.Replica
+	// decode is used for deserializing elements
+	decode lww.ElementDecoder
+
+	// elements is a set of all the added elements
+	elements map[string]lww.Element
+}
+
+// Add adds the given element to the set.
+// The greatest element wins if the element key collides (see `greater`),
+// so all the replicas keep the same element regardless of the order of additions and merges.
+func (s GSet) Add(e lww.Element) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.add(e)
+	s.replica.Metrics.Count("sets.gset.add", 1)
+}
+
+// Merge takes another grow-only set as a `remote` and merges its state into itself.
+// Merging two replicas takes the union of their elements, merging the set into itself does nothing.
+func (s GSet) Merge(remote GSet) {
+	if s.mutex == remote.mutex {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range remote.elements {
+		s.add(e)
+	}
+	s.replica.Metrics.Count("sets.gset.merge", 1)
+}
+
+// Lookup checks if an element with the given key exists in the set.
+// Returns the found element and no error if the element exists.
+// Returns nil and `ErrElementNotFound` if it does not exist.
+func (s GSet) Lookup(key string) (lww.Element, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, added := s.elements[s.replica.NormalizeKey(key)]
+	if !added {
+		return nil, ErrElementNotFound
+	}
+
+	return e, nil
+}
+
+// List returns a list of the actual elements of the set.
+// Because of the internally used map the result order is not deterministic.
+func (s GSet) List() (list []lww.Element) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// it's always at least an empty list, not nil
+	list = make([]lww.Element, 0, len(s.elements))
+	for _, e := range s.elements {
+		list = append(list, e)
+	}
+
+	return list
+}
+
+// len returns the number of elements in the set
+func (s GSet) len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.elements)
+}
+
+// add adds the element unless an element with the same key which is not less is already in the set.
+// The key is normalized using the replica key normalizer.
+func (s GSet) add(e lww.Element) {
+	key, e := normalize(s.replica, e)
+	if existing, added := s.elements[key]; added && !greater(e, existing) {
+		return
+	}
+	s.elements[key] = e
+}
+
+// normalize returns the canonical key of the element using the replica key normalizer.
+// The key of the element itself is replaced too if it's `lww.IDElement` or `lww.Vertex`.
+func normalize(r crdt.Replica, e lww.Element) (string, lww.Element) {
+	key := r.NormalizeKey(e.GetKey())
+	if key == e.GetKey() {
+		return key, e
+	}
+
+	switch element := e.(type) {
+	case lww.IDElement:
+		return key, lww.IDElement(key)
+	case lww.Vertex:
+		element.Key = key
+		return key, element
+	default:
+		return key, e
+	}
+}
+
+// greater returns `true` if the element `e` is greater than `other` by comparing their JSON representations,
+// it's the deterministic winner of elements with colliding keys.
+func greater(e, other lww.Element) bool {
+	return bytes.Compare(encode(e), encode(other)) > 0
+}
+
+// encode returns the JSON representation of the element or its Go representation if it cannot be encoded
+func encode(e lww.Element) []byte {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return []byte(fmt.Sprintf("%#v", e))
+	}
+	return data
+}
@@ -0,0 +1,100 @@
+package sets
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGSet(t *testing.T) {
+	e1 := lww.IDElement("element1")
+	e2 := lww.IDElement("element2")
+	e3 := lww.IDElement("element3")
+
+	t.Run("all actors converge to the same state after replication", func(t *testing.T) {
+		// Time ->
+		// A--Add(e1)-------------------\---|
+		// B------Add(e2)----------------\--|=> A,B,C = {e1,e2,e3}
+		// C-----------Add(e1), Add(e3)---\-|
+		A := NewGSet(testReplica)
+		B := NewGSet(testReplica)
+		C := NewGSet(testReplica)
+
+		A.Add(e1)
+		B.Add(e2)
+		C.Add(e1)
+		C.Add(e3)
+
+		for _, to := range []GSet{A, B, C} {
+			for _, from := range []GSet{A, B, C} {
+				to.Merge(from)
+			}
+		}
+
+		expected := []lww.Element{e1, e2, e3}
+		for _, s := range []GSet{A, B, C} {
+			list := s.List()
+			sortElements(list)
+			require.Equal(t, expected, list)
+		}
+	})
+
+	t.Run("actors adding different elements with the same key converge", func(t *testing.T) {
+		A := NewGSet(testReplica)
+		B := NewGSet(testReplica)
+
+		A.Add(lww.Vertex{Key: "key", Value: "a"})
+		B.Add(lww.Vertex{Key: "key", Value: "b"})
+
+		A.Merge(B)
+		B.Merge(A)
+
+		for _, s := range []GSet{A, B} {
+			found, err := s.Lookup("key")
+			require.NoError(t, err)
+			require.Equal(t, lww.Vertex{Key: "key", Value: "b"}, found)
+		}
+	})
+
+	t.Run("merging the set into itself does not change it", func(t *testing.T) {
+		s := NewGSet(testReplica)
+		s.Add(e1)
+		s.Merge(s)
+		require.Equal(t, []lww.Element{e1}, s.List())
+	})
+
+	t.Run("normalizes the keys", func(t *testing.T) {
+		r := testReplica
+		r.KeyNormalizer = crdt.LowerCase
+		A := NewGSet(r)
+		B := NewGSet(testReplica)
+		A.Add(lww.IDElement("Element1"))
+		B.Add(lww.IDElement("ELEMENT1"))
+		A.Merge(B)
+
+		found, err := A.Lookup("eLeMeNt1")
+		require.NoError(t, err)
+		require.Equal(t, e1, found)
+		require.Equal(t, []lww.Element{e1}, A.List())
+	})
+
+	t.Run("added element can be retrieved", func(t *testing.T) {
+		s := NewGSet(testReplica)
+		s.Add(e1)
+
+		found, err := s.Lookup(e1.GetKey())
+		require.NoError(t, err)
+		require.Equal(t, e1, found)
+	})
+
+	t.Run("retrieving a non-existing element returns ErrElementNotFound", func(t *testing.T) {
+		s := NewGSet(testReplica)
+
+		found, err := s.Lookup("non-existing")
+		require.ErrorIs(t, err, ErrElementNotFound)
+		require.Nil(t, found)
+		require.Equal(t, []lww.Element{}, s.List())
+	})
+}
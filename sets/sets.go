@@ -0,0 +1,22 @@
+// Package sets implements simple state-based set CRDTs:
+// * `GSet` - grow-only set, elements can be added but never removed
+// * `TwoPhaseSet` - two-phase set, elements can be removed but never re-added after removal
+//
+// Both sets have the same shape as the other sets in this module,
+// so they can be used interchangeably depending on the semantics required by the domain.
+package sets
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrElementNotFound occurs when an element with a given key does not exist in the set.
+	ErrElementNotFound = errors.New("element not found in the set")
+	// ErrElementRemoved occurs when trying to add an element which has been removed from a two-phase set.
+	ErrElementRemoved = errors.New("element has been removed from the set and cannot be re-added")
+)
+
+// nothing is a type with zero memory allocation.
+// It's used for marking removed keys in a efficient way.
+type nothing struct{}
@@ -0,0 +1,16 @@
+package sets
+
+import (
+	"sort"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+var testReplica = crdt.NewReplica("test")
+
+func sortElements(list []lww.Element) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].GetKey() < list[j].GetKey()
+	})
+}
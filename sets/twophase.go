@@ -0,0 +1,148 @@
+package sets
+
+import (
+	"sync"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+// NewTwoPhaseSet initializes the two-phase set and makes it ready for use.
+// The set does not depend on the replica clock, `r` provides the limits and the metrics of the set operations.
+// The set can unmarshal only `lww.IDElement` elements, use `NewTwoPhaseSetWithDecoder` for other element types.
+func NewTwoPhaseSet(r crdt.Replica) TwoPhaseSet {
+	return NewTwoPhaseSetWithDecoder(r, lww.DecodeIDElement)
+}
+
+// NewTwoPhaseSetWithDecoder initializes the two-phase set and makes it ready for use.
+// `decode` is used for deserializing elements in `Unmarshal`.
+func NewTwoPhaseSetWithDecoder(r crdt.Replica, decode lww.ElementDecoder) TwoPhaseSet {
+	r = r.WithDefaults()
+	return TwoPhaseSet{
+		mutex:   &sync.Mutex{},
+		replica: r,
+		// the operations are counted by the two-phase set itself
+		additions: NewGSetWithDecoder(crdt.Replica{ID: r.ID, KeyNormalizer: r.KeyNormalizer}, decode),
+		removals:  make(map[string]nothing),
+	}
+}
+
+// TwoPhaseSet is a two-phase set implementation, it's composed of a grow-only set
+// of additions and a grow-only set of removals (tombstones).
+// Once an element is removed, it cannot be added to the set again.
+// Use `NewTwoPhaseSet` in order to initialize it before use.
+// The set is thread-safe and can be used from several go routines.
+type TwoPhaseSet struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// replica is the identity and the policies of the replica the set belongs to
+	replica crdt.Replica
+
+	// additions is a grow-only set of all added elements
+	additions GSet
+	// removals is a grow-only set of all removed keys
+	removals map[string]nothing
+}
+
+// Add adds the given element to the set, the greatest element wins if the element key collides (see `GSet.Add`).
+// Returns `ErrElementRemoved` if an element with the same key has been removed before.
+// Returns an error with `crdt.ErrLimitExceeded` cause if adding a new key would exceed the replica limits.
+func (s TwoPhaseSet) Add(e lww.Element) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := s.replica.NormalizeKey(e.GetKey())
+	if _, removed := s.removals[key]; removed {
+		return ErrElementRemoved
+	}
+
+	if _, err := s.additions.Lookup(key); err != nil {
+		err = s.replica.CheckLimit(s.additions.len() - len(s.removals))
+		if err != nil {
+			return err
+		}
+	}
+
+	s.additions.Add(e)
+	s.replica.Metrics.Count("sets.twophase.add", 1)
+
+	return nil
+}
+
+// Remove removes an element with the given key from the set.
+// The removal is permanent, the element with the same key cannot be re-added.
+// Returns `ErrElementNotFound` if the element does not exist in the set,
+// removing an element which has not been added would make it impossible to add it later.
+func (s TwoPhaseSet) Remove(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key = s.replica.NormalizeKey(key)
+	_, err := s.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	s.removals[key] = nothing{}
+	s.replica.Metrics.Count("sets.twophase.remove", 1)
+
+	return nil
+}
+
+// Merge takes another two-phase set as a `remote` and merges its state into itself.
+// Merging two replicas takes the union of their add-sets and remove-sets,
+// merging the set into itself does nothing.
+func (s TwoPhaseSet) Merge(remote TwoPhaseSet) {
+	if s.mutex == remote.mutex {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.additions.Merge(remote.additions)
+
+	for key := range remote.removals {
+		s.removals[s.replica.NormalizeKey(key)] = nothing{}
+	}
+	s.replica.Metrics.Count("sets.twophase.merge", 1)
+}
+
+// Lookup checks if an element with the given key exists in the set.
+// Returns the found element and no error if the element exists.
+// Returns nil and `ErrElementNotFound` if it does not exist or it has been removed.
+func (s TwoPhaseSet) Lookup(key string) (lww.Element, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.lookup(key)
+}
+
+// List returns a list of the actual elements of the set.
+// Because of the internally used map the result order is not deterministic.
+func (s TwoPhaseSet) List() (list []lww.Element) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// it's always at least an empty list, not nil
+	list = []lww.Element{}
+	for _, e := range s.additions.List() {
+		if _, removed := s.removals[s.replica.NormalizeKey(e.GetKey())]; removed {
+			continue
+		}
+		list = append(list, e)
+	}
+
+	return list
+}
+
+// lookup returns the element with the given key if it was added and not removed
+func (s TwoPhaseSet) lookup(key string) (lww.Element, error) {
+	key = s.replica.NormalizeKey(key)
+	if _, removed := s.removals[key]; removed {
+		return nil, ErrElementNotFound
+	}
+
+	return s.additions.Lookup(key)
+}
@@ -0,0 +1,120 @@
+package sets
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoPhaseSet(t *testing.T) {
+	e1 := lww.IDElement("element1")
+	e2 := lww.IDElement("element2")
+
+	t.Run("removal gets replicated and wins over a concurrent addition", func(t *testing.T) {
+		// Time ->
+		// A--Add(e1)-\--Remove(e1)------------\---|
+		// B-----------\-----------Add(e2)------\--|=> A,B = {e2}
+		A := NewTwoPhaseSet(testReplica)
+		B := NewTwoPhaseSet(testReplica)
+
+		require.NoError(t, A.Add(e1))
+		B.Merge(A)
+
+		require.NoError(t, A.Remove(e1.GetKey()))
+		require.NoError(t, B.Add(e2))
+
+		A.Merge(B)
+		B.Merge(A)
+
+		for _, s := range []TwoPhaseSet{A, B} {
+			found, err := s.Lookup(e1.GetKey())
+			require.ErrorIs(t, err, ErrElementNotFound)
+			require.Nil(t, found)
+			require.Equal(t, []lww.Element{e2}, s.List())
+		}
+	})
+
+	t.Run("actors adding different elements with the same key converge", func(t *testing.T) {
+		A := NewTwoPhaseSet(testReplica)
+		B := NewTwoPhaseSet(testReplica)
+
+		require.NoError(t, B.Add(lww.Vertex{Key: "key", Value: "b"}))
+		require.NoError(t, A.Add(lww.Vertex{Key: "key", Value: "a"}))
+
+		A.Merge(B)
+		B.Merge(A)
+
+		for _, s := range []TwoPhaseSet{A, B} {
+			found, err := s.Lookup("key")
+			require.NoError(t, err)
+			require.Equal(t, lww.Vertex{Key: "key", Value: "b"}, found)
+		}
+	})
+
+	t.Run("merging the set into itself does not change it", func(t *testing.T) {
+		s := NewTwoPhaseSet(testReplica)
+		require.NoError(t, s.Add(e1))
+		require.NoError(t, s.Add(e2))
+		require.NoError(t, s.Remove(e2.GetKey()))
+		s.Merge(s)
+		require.Equal(t, []lww.Element{e1}, s.List())
+	})
+
+	t.Run("normalizes the keys", func(t *testing.T) {
+		r := testReplica
+		r.KeyNormalizer = crdt.LowerCase
+		A := NewTwoPhaseSet(r)
+		B := NewTwoPhaseSet(testReplica)
+		require.NoError(t, A.Add(lww.IDElement("Element1")))
+		require.NoError(t, B.Add(lww.IDElement("ELEMENT2")))
+		require.NoError(t, B.Remove("ELEMENT2"))
+		A.Merge(B)
+
+		found, err := A.Lookup("eLeMeNt1")
+		require.NoError(t, err)
+		require.Equal(t, e1, found)
+		require.Equal(t, []lww.Element{e1}, A.List())
+
+		require.ErrorIs(t, A.Add(e2), ErrElementRemoved)
+		require.NoError(t, A.Remove("ELEMENT1"))
+		_, err = A.Lookup(e1.GetKey())
+		require.ErrorIs(t, err, ErrElementNotFound)
+	})
+
+	t.Run("removed element cannot be re-added", func(t *testing.T) {
+		s := NewTwoPhaseSet(testReplica)
+		require.NoError(t, s.Add(e1))
+		require.NoError(t, s.Remove(e1.GetKey()))
+
+		err := s.Add(e1)
+		require.ErrorIs(t, err, ErrElementRemoved)
+
+		_, err = s.Lookup(e1.GetKey())
+		require.ErrorIs(t, err, ErrElementNotFound)
+	})
+
+	t.Run("returns ErrLimitExceeded when the set is full", func(t *testing.T) {
+		r := testReplica
+		r.Limits.MaxElements = 1
+		s := NewTwoPhaseSet(r)
+		require.NoError(t, s.Add(e1))
+		require.NoError(t, s.Add(e1), "replacing an element does not add a new one")
+
+		err := s.Add(e2)
+		require.ErrorIs(t, err, crdt.ErrLimitExceeded)
+
+		require.NoError(t, s.Remove(e1.GetKey()))
+		require.NoError(t, s.Add(e2))
+	})
+
+	t.Run("returns ErrElementNotFound when removing a non-existing element", func(t *testing.T) {
+		s := NewTwoPhaseSet(testReplica)
+
+		err := s.Remove("non-existing")
+		require.ErrorIs(t, err, ErrElementNotFound)
+
+		require.NoError(t, s.Add(lww.IDElement("non-existing")), "failed removal must not leave a tombstone")
+	})
+}
@@ -0,0 +1,156 @@
+package crdt
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// NewSnapshotCache creates a cache of deserialized snapshots using the `registry` for deserializing them.
+// `budget` is the maximum total size in bytes of the serialized snapshots the cache keeps decoded,
+// the least recently used snapshots are evicted when the budget is exceeded.
+func NewSnapshotCache(registry Registry, budget int) SnapshotCache {
+	return SnapshotCache{
+		mutex:    &sync.Mutex{},
+		registry: registry,
+		budget:   budget,
+		state:    &cacheState{},
+		entries:  make(map[[sha256.Size]byte]*cacheEntry),
+	}
+}
+
+// CacheStats contains the counters of the cache usage
+type CacheStats struct {
+	// Hits is the number of snapshots returned from the cache
+	Hits int64
+	// Misses is the number of snapshots deserialized by the registry
+	Misses int64
+	// Evictions is the number of snapshots evicted from the cache
+	Evictions int64
+}
+
+// SnapshotCache keeps recently deserialized remote snapshots keyed by the digest of their serialized state,
+// so merging the same snapshot repeatedly (e.g. on retries) does not decode a large payload again.
+// Use `NewSnapshotCache` in order to initialize it before use.
+// The cache is thread-safe and can be used from several go routines.
+//
+// The returned CRDTs are shared between the callers, they must be used only as a `remote`
+// argument of merging and must never be modified.
+type SnapshotCache struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// registry is used for deserializing snapshots
+	registry Registry
+	// budget is the maximum total size of the cached snapshots
+	budget int
+	// state contains the mutable counters of the cache
+	state *cacheState
+	// entries maps a digest of the serialized snapshot to the cache entry
+	entries map[[sha256.Size]byte]*cacheEntry
+}
+
+// cacheState contains the mutable counters of the cache
+type cacheState struct {
+	// size is the current total size of the cached snapshots
+	size int
+	// tick is incremented on every access for tracking the least recently used entry
+	tick uint64
+	// stats contains the usage counters
+	stats CacheStats
+}
+
+// cacheEntry is a single deserialized snapshot in the cache
+type cacheEntry struct {
+	// size is the size of the serialized snapshot
+	size int
+	// usedAt is the tick of the last access
+	usedAt uint64
+	// crdt is the deserialized snapshot
+	crdt CRDT
+}
+
+// Unmarshal returns the CRDT serialized by `Marshal`, it's deserialized by the registry
+// only if the same snapshot is not in the cache already.
+// Snapshots larger than the budget are deserialized but never cached.
+func (c SnapshotCache) Unmarshal(data []byte) (CRDT, error) {
+	digest := sha256.Sum256(data)
+
+	c.mutex.Lock()
+	if entry, exists := c.entries[digest]; exists {
+		c.touch(entry)
+		c.state.stats.Hits++
+		c.mutex.Unlock()
+		return entry.crdt, nil
+	}
+	c.state.stats.Misses++
+	c.mutex.Unlock()
+
+	// decoding can take a while, so it's done without holding the lock
+	decoded, err := c.registry.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > c.budget {
+		return decoded, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, exists := c.entries[digest]; exists {
+		// decoded concurrently by another caller
+		c.touch(entry)
+		return entry.crdt, nil
+	}
+
+	entry := &cacheEntry{size: len(data), crdt: decoded}
+	c.touch(entry)
+	c.entries[digest] = entry
+	c.state.size += len(data)
+
+	for c.state.size > c.budget {
+		c.evictOldest()
+	}
+
+	return decoded, nil
+}
+
+// touch marks the entry as the most recently used one
+func (c SnapshotCache) touch(entry *cacheEntry) {
+	c.state.tick++
+	entry.usedAt = c.state.tick
+}
+
+// evictOldest removes the least recently used entry from the cache
+func (c SnapshotCache) evictOldest() {
+	var (
+		oldestDigest [sha256.Size]byte
+		oldest       *cacheEntry
+	)
+	for digest, entry := range c.entries {
+		if oldest == nil || entry.usedAt < oldest.usedAt {
+			oldestDigest, oldest = digest, entry
+		}
+	}
+
+	delete(c.entries, oldestDigest)
+	c.state.size -= oldest.size
+	c.state.stats.Evictions++
+}
+
+// Len returns the number of cached snapshots
+func (c SnapshotCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.entries)
+}
+
+// Stats returns the current usage counters of the cache
+func (c SnapshotCache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.state.stats
+}
@@ -0,0 +1,74 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotCache(t *testing.T) {
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(counterKind, newCounter))
+
+	snapshot := func(t *testing.T, value int) []byte {
+		c := newCounter().(counter)
+		*c.value = value
+		data, err := Marshal(c)
+		require.NoError(t, err)
+		return data
+	}
+
+	t.Run("decodes the same snapshot only once", func(t *testing.T) {
+		cache := NewSnapshotCache(registry, 1024)
+		data := snapshot(t, 42)
+
+		first, err := cache.Unmarshal(data)
+		require.NoError(t, err)
+		second, err := cache.Unmarshal(append([]byte(nil), data...))
+		require.NoError(t, err)
+
+		require.Equal(t, 42, *second.(counter).value)
+		require.True(t, first.(counter).value == second.(counter).value, "must return the cached instance")
+		require.Equal(t, CacheStats{Hits: 1, Misses: 1}, cache.Stats())
+	})
+
+	t.Run("evicts the least recently used snapshots over the budget", func(t *testing.T) {
+		s1, s2, s3 := snapshot(t, 1), snapshot(t, 2), snapshot(t, 3)
+		cache := NewSnapshotCache(registry, len(s1)+len(s2))
+
+		_, err := cache.Unmarshal(s1)
+		require.NoError(t, err)
+		_, err = cache.Unmarshal(s2)
+		require.NoError(t, err)
+		// makes s2 the least recently used
+		_, err = cache.Unmarshal(s1)
+		require.NoError(t, err)
+		_, err = cache.Unmarshal(s3)
+		require.NoError(t, err)
+		require.Equal(t, 2, cache.Len())
+
+		_, err = cache.Unmarshal(s1)
+		require.NoError(t, err)
+		_, err = cache.Unmarshal(s2)
+		require.NoError(t, err)
+		require.Equal(t, CacheStats{Hits: 2, Misses: 4, Evictions: 2}, cache.Stats())
+	})
+
+	t.Run("does not cache snapshots larger than the budget", func(t *testing.T) {
+		data := snapshot(t, 1)
+		cache := NewSnapshotCache(registry, len(data)-1)
+
+		c, err := cache.Unmarshal(data)
+		require.NoError(t, err)
+		require.Equal(t, 1, *c.(counter).value)
+		require.Equal(t, 0, cache.Len())
+	})
+
+	t.Run("returns deserialization errors without caching", func(t *testing.T) {
+		cache := NewSnapshotCache(NewRegistry(), 1024)
+
+		_, err := cache.Unmarshal(snapshot(t, 1))
+		require.ErrorIs(t, err, ErrUnknownKind)
+		require.Equal(t, 0, cache.Len())
+	})
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/oplog"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// opsBucket is the nested bucket containing the logged operations keyed by their sequence number
+	opsBucket = []byte("ops")
+	// snapshotKey is the key of the snapshot data
+	snapshotKey = []byte("snapshot")
+	// snapshotSeqKey is the key of the sequence number of the snapshot
+	snapshotSeqKey = []byte("snapshotSeq")
+	// journalKey is the key of the conflict journal saved with the snapshot
+	journalKey = []byte("journal")
+)
+
+// NewBoltBackend creates a backend storing the replica in a bucket with the given name.
+// Several replicas can share the same database using different bucket names.
+// The database is owned by the caller, it must stay open while the backend is used.
+func NewBoltBackend(db *bolt.DB, name string) BoltBackend {
+	return BoltBackend{
+		db:   db,
+		name: []byte(name),
+	}
+}
+
+// BoltBackend is a `Backend` storing a replica in a BoltDB bucket.
+// Use `NewBoltBackend` in order to initialize it before use.
+// The backend is thread-safe and can be used from several go routines.
+type BoltBackend struct {
+	// db is the database containing the bucket
+	db *bolt.DB
+	// name is the name of the bucket
+	name []byte
+}
+
+// Load implements the `Backend` interface
+func (b BoltBackend) Load() (snapshot Snapshot, ops []oplog.Op, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.name)
+		if bucket == nil {
+			return nil
+		}
+
+		data := bucket.Get(snapshotKey)
+		if data != nil {
+			// the value is valid only during the transaction
+			snapshot.Data = append([]byte{}, data...)
+		}
+		journal := bucket.Get(journalKey)
+		if journal != nil {
+			snapshot.Journal = append([]byte{}, journal...)
+		}
+		seq := bucket.Get(snapshotSeqKey)
+		if seq != nil {
+			if len(seq) != 8 {
+				return errors.Wrapf(ErrCorrupted, "invalid snapshot sequence number in bucket %q", b.name)
+			}
+			snapshot.Seq = int(binary.BigEndian.Uint64(seq))
+		}
+
+		log := bucket.Bucket(opsBucket)
+		if log == nil {
+			return nil
+		}
+		return log.ForEach(func(k, v []byte) error {
+			var op oplog.Op
+			err := json.Unmarshal(v, &op)
+			if err != nil {
+				return errors.Wrapf(ErrCorrupted, "invalid operation in bucket %q: %s", b.name, err)
+			}
+			ops = append(ops, op)
+			return nil
+		})
+	})
+	if err != nil {
+		return Snapshot{}, nil, err
+	}
+
+	return snapshot, ops, nil
+}
+
+// AppendOp implements the `Backend` interface
+func (b BoltBackend) AppendOp(op oplog.Op) error {
+	value, err := json.Marshal(op)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal operation %d", op.Seq)
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(b.name)
+		if err != nil {
+			return err
+		}
+		log, err := bucket.CreateBucketIfNotExists(opsBucket)
+		if err != nil {
+			return err
+		}
+		return log.Put(seqKey(op.Seq), value)
+	})
+}
+
+// SaveSnapshot implements the `Backend` interface
+func (b BoltBackend) SaveSnapshot(snapshot Snapshot) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(b.name)
+		if err != nil {
+			return err
+		}
+
+		err = bucket.Put(snapshotKey, snapshot.Data)
+		if err != nil {
+			return err
+		}
+		err = bucket.Put(snapshotSeqKey, seqKey(snapshot.Seq))
+		if err != nil {
+			return err
+		}
+		if snapshot.Journal != nil {
+			err = bucket.Put(journalKey, snapshot.Journal)
+		} else {
+			err = bucket.Delete(journalKey)
+		}
+		if err != nil {
+			return err
+		}
+
+		log := bucket.Bucket(opsBucket)
+		if log == nil {
+			return nil
+		}
+		// keys are big-endian, so the cursor iterates them in the sequence order,
+		// deleting with the cursor while iterating would skip keys
+		var included [][]byte
+		cursor := log.Cursor()
+		for k, _ := cursor.First(); k != nil && binary.BigEndian.Uint64(k) <= uint64(snapshot.Seq); k, _ = cursor.Next() {
+			included = append(included, append([]byte{}, k...))
+		}
+		for _, k := range included {
+			err = log.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// seqKey encodes the sequence number as a key that sorts in the sequence order
+func seqKey(seq int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(seq))
+	return key
+}
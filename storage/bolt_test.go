@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/oplog"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltBackend(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "replica.db")
+	open := func() *bolt.DB {
+		db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+		require.NoError(t, err)
+		return db
+	}
+
+	t.Run("returns nothing for an empty database", func(t *testing.T) {
+		db := open()
+		defer db.Close()
+
+		snapshot, ops, err := NewBoltBackend(db, "empty").Load()
+		require.NoError(t, err)
+		require.Equal(t, Snapshot{}, snapshot)
+		require.Empty(t, ops)
+	})
+
+	t.Run("keeps operations after the snapshot", func(t *testing.T) {
+		db := open()
+		defer db.Close()
+
+		backend := NewBoltBackend(db, "ops")
+		for seq := 1; seq <= 3; seq++ {
+			require.NoError(t, backend.AppendOp(oplog.Op{Replica: "test", Seq: seq, Type: oplog.AddVertex, Key: "v"}))
+		}
+		require.NoError(t, backend.SaveSnapshot(Snapshot{Data: []byte("state"), Seq: 2}))
+
+		snapshot, ops, err := backend.Load()
+		require.NoError(t, err)
+		require.Equal(t, Snapshot{Data: []byte("state"), Seq: 2}, snapshot)
+		require.Len(t, ops, 1)
+		require.Equal(t, 3, ops[0].Seq)
+
+		require.NoError(t, backend.SaveSnapshot(Snapshot{Data: []byte("state"), Seq: 3, Journal: []byte("[]")}))
+		snapshot, _, err = backend.Load()
+		require.NoError(t, err)
+		require.Equal(t, Snapshot{Data: []byte("state"), Seq: 3, Journal: []byte("[]")}, snapshot)
+
+		require.NoError(t, backend.SaveSnapshot(Snapshot{Data: []byte("state"), Seq: 3}))
+		snapshot, _, err = backend.Load()
+		require.NoError(t, err)
+		require.Nil(t, snapshot.Journal, "the journal of the previous snapshot must be deleted")
+	})
+
+	t.Run("the graph survives reopening the database", func(t *testing.T) {
+		v1 := lww.Vertex{Key: "vertex1", Value: "value1"}
+		v2 := lww.Vertex{Key: "vertex2", Value: "value2"}
+
+		db := open()
+		g, err := NewGraphFromStorage(testReplica(), NewBoltBackend(db, "graph"))
+		require.NoError(t, err)
+		require.NoError(t, g.AddVertex(ctx, v1))
+		require.NoError(t, g.Checkpoint())
+		require.NoError(t, g.AddVertex(ctx, v2))
+		require.NoError(t, g.AddEdge(ctx, v1.Key, v2.Key))
+		require.NoError(t, db.Close())
+
+		db = open()
+		defer db.Close()
+		recovered, err := NewGraphFromStorage(testReplica(), NewBoltBackend(db, "graph"))
+		require.NoError(t, err)
+
+		connected, err := recovered.FindConnected(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, []lww.Vertex{v2}, connected)
+	})
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidKeyring occurs when the keyring contains invalid keys
+	ErrInvalidKeyring = errors.New("invalid keyring")
+	// ErrUnknownKey occurs when the data is encrypted with a key missing in the keyring
+	ErrUnknownKey = errors.New("unknown encryption key")
+)
+
+// encryptedMagic starts every encrypted record, it's followed by the length of the key ID, the key ID,
+// the nonce and the sealed data
+var encryptedMagic = []byte("CRDTENC1")
+
+// maxKeyIDLength is the maximum length of a key ID, the length is stored in a single byte
+const maxKeyIDLength = 255
+
+// EncryptionKey is a named AEAD key used for encrypting data at rest
+type EncryptionKey struct {
+	// ID identifies the key, it's stored with every encrypted record, so the record can be decrypted
+	// after the key is rotated. At most 255 bytes.
+	ID string
+	// AEAD encrypts and authenticates the data, e.g. AES-GCM created by `cipher.NewGCM`
+	AEAD cipher.AEAD
+}
+
+// Keyring contains the keys for encrypting data at rest, the zero value disables encryption.
+//
+// Keys are rotated by putting the new key first and keeping the previous keys until
+// all the data encrypted with them is rewritten, e.g. until the next snapshot is saved.
+type Keyring struct {
+	// Keys are the known keys, the first key encrypts the new data and all of them decrypt
+	Keys []EncryptionKey
+}
+
+// validate returns an error with `ErrInvalidKeyring` cause if any of the keys is invalid
+func (k Keyring) validate() error {
+	ids := make(map[string]struct{}, len(k.Keys))
+	for i, key := range k.Keys {
+		switch {
+		case key.ID == "":
+			return errors.Wrapf(ErrInvalidKeyring, "key %d has no ID", i)
+		case len(key.ID) > maxKeyIDLength:
+			return errors.Wrapf(ErrInvalidKeyring, "ID of key %q is longer than %d bytes", key.ID, maxKeyIDLength)
+		case key.AEAD == nil:
+			return errors.Wrapf(ErrInvalidKeyring, "key %q has no AEAD", key.ID)
+		}
+		if _, exists := ids[key.ID]; exists {
+			return errors.Wrapf(ErrInvalidKeyring, "duplicate key %q", key.ID)
+		}
+		ids[key.ID] = struct{}{}
+	}
+	return nil
+}
+
+// enabled returns `true` if the data must be encrypted
+func (k Keyring) enabled() bool {
+	return len(k.Keys) != 0
+}
+
+// seal encrypts the data with the first key, `ad` is authenticated but not encrypted,
+// the same `ad` must be passed to `open`. The data is returned as is if encryption is disabled.
+func (k Keyring) seal(data, ad []byte) ([]byte, error) {
+	if !k.enabled() {
+		return data, nil
+	}
+
+	key := k.Keys[0]
+	nonce := make([]byte, key.AEAD.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate a nonce")
+	}
+
+	sealed := make([]byte, 0, len(encryptedMagic)+1+len(key.ID)+len(nonce)+len(data)+key.AEAD.Overhead())
+	sealed = append(sealed, encryptedMagic...)
+	sealed = append(sealed, byte(len(key.ID)))
+	sealed = append(sealed, key.ID...)
+	sealed = append(sealed, nonce...)
+	return key.AEAD.Seal(sealed, nonce, data, ad), nil
+}
+
+// open decrypts the data sealed by `seal` with any of the keys.
+// Returns an error with `ErrUnknownKey` cause if the key is not in the keyring
+// and with `ErrCorrupted` cause if the data is not encrypted or it was modified.
+// The data is returned as is if encryption is disabled.
+func (k Keyring) open(data, ad []byte) ([]byte, error) {
+	if !k.enabled() {
+		return data, nil
+	}
+
+	if !bytes.HasPrefix(data, encryptedMagic) || len(data) < len(encryptedMagic)+1 {
+		return nil, errors.Wrap(ErrCorrupted, "the data is not encrypted")
+	}
+	data = data[len(encryptedMagic):]
+	idLength := int(data[0])
+	if len(data) < 1+idLength {
+		return nil, errors.Wrap(ErrCorrupted, "the encrypted data is truncated")
+	}
+	id := string(data[1 : 1+idLength])
+	data = data[1+idLength:]
+
+	for _, key := range k.Keys {
+		if key.ID != id {
+			continue
+		}
+		if len(data) < key.AEAD.NonceSize() {
+			return nil, errors.Wrap(ErrCorrupted, "the encrypted data is truncated")
+		}
+		nonce, sealed := data[:key.AEAD.NonceSize()], data[key.AEAD.NonceSize():]
+		opened, err := key.AEAD.Open(nil, nonce, sealed, ad)
+		if err != nil {
+			return nil, errors.Wrapf(ErrCorrupted, "failed to decrypt the data with key %q: %s", id, err)
+		}
+		return opened, nil
+	}
+
+	return nil, errors.Wrapf(ErrUnknownKey, "the data is encrypted with key %q", id)
+}
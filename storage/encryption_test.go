@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/oplog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryption(t *testing.T) {
+	ctx := context.Background()
+	newKey := func(t *testing.T, id string, secret byte) EncryptionKey {
+		block, err := aes.NewCipher([]byte(strings.Repeat(string(secret), 32)))
+		require.NoError(t, err)
+		aead, err := cipher.NewGCM(block)
+		require.NoError(t, err)
+		return EncryptionKey{ID: id, AEAD: aead}
+	}
+	op := func(seq int) oplog.Op {
+		return oplog.Op{Replica: "test", Seq: seq, Type: oplog.AddVertex, Key: "v", Value: "secret value"}
+	}
+	requireNoPlaintext := func(t *testing.T, dir string) {
+		entries, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		require.NotEmpty(t, entries)
+		for _, entry := range entries {
+			data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+			require.NoError(t, err)
+			require.NotContains(t, string(data), "secret", entry.Name())
+		}
+	}
+
+	t.Run("encrypts operations, snapshots and journals", func(t *testing.T) {
+		dir := t.TempDir()
+		cfg := WALConfig{Encryption: Keyring{Keys: []EncryptionKey{newKey(t, "key1", 1)}}}
+		wal, err := OpenWAL(dir, cfg)
+		require.NoError(t, err)
+		defer wal.Close()
+
+		require.NoError(t, wal.AppendOp(op(1)))
+		require.NoError(t, wal.SaveSnapshot(Snapshot{Data: []byte("secret state"), Seq: 1, Journal: []byte("secret journal")}))
+		require.NoError(t, wal.AppendOp(op(2)))
+		requireNoPlaintext(t, dir)
+
+		snapshot, ops, err := wal.Load()
+		require.NoError(t, err)
+		require.Equal(t, Snapshot{Data: []byte("secret state"), Seq: 1, Journal: []byte("secret journal")}, snapshot)
+		require.Equal(t, []oplog.Op{op(2)}, ops)
+	})
+
+	t.Run("rotates keys on snapshot rewrite", func(t *testing.T) {
+		dir := t.TempDir()
+		key1, key2 := newKey(t, "key1", 1), newKey(t, "key2", 2)
+
+		wal, err := OpenWAL(dir, WALConfig{Encryption: Keyring{Keys: []EncryptionKey{key1}}})
+		require.NoError(t, err)
+		require.NoError(t, wal.SaveSnapshot(Snapshot{Data: []byte("state"), Seq: 1}))
+		require.NoError(t, wal.AppendOp(op(2)))
+		require.NoError(t, wal.Close())
+
+		// the new key is first, the old one still decrypts the existing data
+		wal, err = OpenWAL(dir, WALConfig{Encryption: Keyring{Keys: []EncryptionKey{key2, key1}}})
+		require.NoError(t, err)
+		snapshot, ops, err := wal.Load()
+		require.NoError(t, err)
+		require.Equal(t, []oplog.Op{op(2)}, ops)
+		require.NoError(t, wal.SaveSnapshot(Snapshot{Data: snapshot.Data, Seq: 2}))
+		require.NoError(t, wal.AppendOp(op(3)))
+		require.NoError(t, wal.Close())
+
+		// the old key is not needed after the snapshot
+		wal, err = OpenWAL(dir, WALConfig{Encryption: Keyring{Keys: []EncryptionKey{key2}}})
+		require.NoError(t, err)
+		defer wal.Close()
+		snapshot, ops, err = wal.Load()
+		require.NoError(t, err)
+		require.Equal(t, Snapshot{Data: []byte("state"), Seq: 2}, snapshot)
+		require.Equal(t, []oplog.Op{op(3)}, ops)
+	})
+
+	t.Run("fails without the key", func(t *testing.T) {
+		dir := t.TempDir()
+		wal, err := OpenWAL(dir, WALConfig{Encryption: Keyring{Keys: []EncryptionKey{newKey(t, "key1", 1)}}})
+		require.NoError(t, err)
+		require.NoError(t, wal.AppendOp(op(1)))
+		require.NoError(t, wal.AppendOp(op(2)))
+		require.NoError(t, wal.Close())
+
+		wal, err = OpenWAL(dir, WALConfig{Encryption: Keyring{Keys: []EncryptionKey{newKey(t, "key2", 2)}}})
+		require.NoError(t, err)
+		defer wal.Close()
+		_, _, err = wal.Load()
+		require.ErrorIs(t, err, ErrUnknownKey)
+
+		// the same ID with another secret
+		wal, err = OpenWAL(dir, WALConfig{Encryption: Keyring{Keys: []EncryptionKey{newKey(t, "key1", 2)}}})
+		require.NoError(t, err)
+		defer wal.Close()
+		_, _, err = wal.Load()
+		require.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("detects records moved between files and plaintext files", func(t *testing.T) {
+		dir := t.TempDir()
+		cfg := WALConfig{Encryption: Keyring{Keys: []EncryptionKey{newKey(t, "key1", 1)}}}
+		wal, err := OpenWAL(dir, cfg)
+		require.NoError(t, err)
+		require.NoError(t, wal.SaveSnapshot(Snapshot{Data: []byte("state"), Seq: 1}))
+		require.NoError(t, wal.Close())
+
+		require.NoError(t, os.Rename(
+			filepath.Join(dir, "snapshot-0000000000000001.snap"),
+			filepath.Join(dir, "snapshot-0000000000000002.snap"),
+		))
+		wal, err = OpenWAL(dir, cfg)
+		require.NoError(t, err)
+		defer wal.Close()
+		_, _, err = wal.Load()
+		require.ErrorIs(t, err, ErrCorrupted)
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "snapshot-0000000000000003.snap"), []byte("state"), 0600))
+		_, _, err = wal.Load()
+		require.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("ignores a partially written last operation", func(t *testing.T) {
+		dir := t.TempDir()
+		cfg := WALConfig{Encryption: Keyring{Keys: []EncryptionKey{newKey(t, "key1", 1)}}}
+		wal, err := OpenWAL(dir, cfg)
+		require.NoError(t, err)
+		require.NoError(t, wal.AppendOp(op(1)))
+		require.NoError(t, wal.AppendOp(op(2)))
+		require.NoError(t, wal.Close())
+
+		path := filepath.Join(dir, "wal-0000000000000001.log")
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(path, data[:len(data)-10], 0600))
+
+		wal, err = OpenWAL(dir, cfg)
+		require.NoError(t, err)
+		defer wal.Close()
+		_, ops, err := wal.Load()
+		require.NoError(t, err)
+		require.Equal(t, []oplog.Op{op(1)}, ops)
+	})
+
+	t.Run("validates the keyring", func(t *testing.T) {
+		key := newKey(t, "key", 1)
+		for _, keys := range [][]EncryptionKey{
+			{{ID: "", AEAD: key.AEAD}},
+			{{ID: "key"}},
+			{{ID: strings.Repeat("k", 256), AEAD: key.AEAD}},
+			{key, key},
+		} {
+			_, err := OpenWAL(t.TempDir(), WALConfig{Encryption: Keyring{Keys: keys}})
+			require.ErrorIs(t, err, ErrInvalidKeyring)
+		}
+	})
+
+	t.Run("the graph is recovered from the encrypted log", func(t *testing.T) {
+		dir := t.TempDir()
+		cfg := WALConfig{Encryption: Keyring{Keys: []EncryptionKey{newKey(t, "key1", 1)}}}
+		wal, err := OpenWAL(dir, cfg)
+		require.NoError(t, err)
+		g, err := NewGraphFromStorage(testReplica(), wal)
+		require.NoError(t, err)
+		require.NoError(t, g.AddVertex(ctx, lww.Vertex{Key: "v1", Value: "secret1"}))
+		require.NoError(t, g.Checkpoint())
+		require.NoError(t, g.AddVertex(ctx, lww.Vertex{Key: "v2", Value: "secret2"}))
+		require.NoError(t, wal.Close())
+		requireNoPlaintext(t, dir)
+
+		wal, err = OpenWAL(dir, cfg)
+		require.NoError(t, err)
+		defer wal.Close()
+		recovered, err := NewGraphFromStorage(testReplica(), wal)
+		require.NoError(t, err)
+		list, err := recovered.List()
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+	})
+}
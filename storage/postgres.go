@@ -0,0 +1,444 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/lww"
+)
+
+var (
+	// ErrInvalidTableName occurs when the table name prefix is not a valid SQL identifier
+	ErrInvalidTableName = errors.New("invalid table name prefix")
+
+	// identifier matches the allowed table name prefixes
+	identifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// NewPostgresAdapter creates an adapter storing a graph in the Postgres tables with the given name prefix,
+// for the prefix `graph` the tables are `graph_vertices` and `graph_edges`.
+// `db` must be opened with a Postgres driver (e.g. `github.com/lib/pq` or `github.com/jackc/pgx/v4/stdlib`).
+// Returns an error with `ErrInvalidTableName` cause if the prefix is not a valid SQL identifier.
+func NewPostgresAdapter(db *sql.DB, prefix string) (PostgresAdapter, error) {
+	if !identifier.MatchString(prefix) {
+		return PostgresAdapter{}, errors.Wrapf(ErrInvalidTableName, "%q", prefix)
+	}
+	return PostgresAdapter{
+		db:       db,
+		vertices: prefix + "_vertices",
+		edges:    prefix + "_edges",
+	}, nil
+}
+
+// PostgresAdapter maps the vertices and edges of a graph along with their LWW metadata onto Postgres tables,
+// so the state is durable and can be queried alongside application data, e.g.
+//
+//	SELECT key, value FROM graph_vertices WHERE added_at > COALESCE(removed_at, 0)
+//
+// Timestamps are stored as Unix nanoseconds in `BIGINT` columns, since `timestamptz` has only
+// microsecond precision and would change the order of operations.
+// The `added_by` and `removed_by` columns contain the IDs of the replicas that performed the operations.
+// The `element` column of an edge contains the edge serialized as JSON if it carries a weight, a label or attributes
+// (see `lww.Edge`), counter weights of edges are not stored.
+//
+// Saving a graph is a merge: every row is upserted keeping the latest addition and removal,
+// so several replicas can save into the same tables and the tables hold the merged state.
+// Use `NewPostgresAdapter` in order to initialize it before use.
+type PostgresAdapter struct {
+	// db is the database connection pool
+	db *sql.DB
+	// vertices is the name of the vertices table
+	vertices string
+	// edges is the name of the edges table
+	edges string
+}
+
+// row is the LWW metadata of a vertex or an edge, timestamps are Unix nanoseconds
+type row struct {
+	// AddedAt is the time of the last addition, nil if it was never added
+	AddedAt *int64
+	// AddedBy is the ID of the replica that added the vertex or the edge
+	AddedBy string
+	// RemovedAt is the time of the last removal, nil if it was never removed
+	RemovedAt *int64
+	// RemovedBy is the ID of the replica that removed the vertex or the edge
+	RemovedBy string
+}
+
+// vertexRow is a row of the vertices table
+type vertexRow struct {
+	row
+	// Key is the vertex key
+	Key string
+	// Value is the vertex value, nil if it was never added
+	Value *string
+}
+
+// edgeRow is a row of the edges table
+type edgeRow struct {
+	row
+	// From is the key of the vertex the edge starts from
+	From string
+	// To is the key of the vertex the edge points to
+	To string
+	// Element is the serialized `lww.Edge`, nil if it was never added or carries nothing but its key
+	Element *string
+}
+
+// graphRows is the serialized format of `lww.Graph` (see `lww.Graph.Marshal`)
+type graphRows struct {
+	Vertices   setRows            `json:"vertices"`
+	Edges      map[string]setRows `json:"edges"`
+	EdgeGroups json.RawMessage    `json:"edgeGroups,omitempty"`
+}
+
+// setRows is the serialized format of `lww.Set`
+type setRows struct {
+	Additions map[string]struct {
+		Element   json.RawMessage `json:"element"`
+		Timestamp time.Time       `json:"timestamp"`
+		Replica   string          `json:"replica,omitempty"`
+	} `json:"additions"`
+	Removals  map[string]time.Time `json:"removals"`
+	RemovedBy map[string]string    `json:"removedBy,omitempty"`
+}
+
+// CreateTables creates the tables if they don't exist
+func (a PostgresAdapter) CreateTables(ctx context.Context) error {
+	// nolint:gosec // the table names are validated identifiers
+	_, err := a.db.ExecContext(ctx, fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s (
+	key TEXT PRIMARY KEY,
+	value TEXT,
+	added_at BIGINT,
+	added_by TEXT NOT NULL DEFAULT '',
+	removed_at BIGINT,
+	removed_by TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS %[2]s (
+	from_key TEXT NOT NULL,
+	to_key TEXT NOT NULL,
+	added_at BIGINT,
+	added_by TEXT NOT NULL DEFAULT '',
+	removed_at BIGINT,
+	removed_by TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (from_key, to_key)
+);
+ALTER TABLE %[2]s ADD COLUMN IF NOT EXISTS element TEXT;`, a.vertices, a.edges))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create tables %s and %s", a.vertices, a.edges)
+	}
+	return nil
+}
+
+// Save merges the state of the graph into the tables in a single transaction.
+// Rows keep the latest addition (with its value) and the latest removal,
+// resolving colliding timestamps by the greater replica ID the same way `lww.Graph.Merge` does.
+func (a PostgresAdapter) Save(ctx context.Context, g lww.Graph) error {
+	data, err := g.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the graph")
+	}
+	vertices, edges, err := toRows(data)
+	if err != nil {
+		return err
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin a transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// nolint:gosec // the table name is a validated identifier
+	upsertVertex := fmt.Sprintf(`
+INSERT INTO %[1]s AS t (key, value, added_at, added_by, removed_at, removed_by) VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (key) DO UPDATE SET
+	value = CASE WHEN %[2]s THEN EXCLUDED.value ELSE t.value END,
+	added_at = CASE WHEN %[2]s THEN EXCLUDED.added_at ELSE t.added_at END,
+	added_by = CASE WHEN %[2]s THEN EXCLUDED.added_by ELSE t.added_by END,
+	removed_at = CASE WHEN %[3]s THEN EXCLUDED.removed_at ELSE t.removed_at END,
+	removed_by = CASE WHEN %[3]s THEN EXCLUDED.removed_by ELSE t.removed_by END`,
+		a.vertices, newerSQL("added_at", "added_by"), newerSQL("removed_at", "removed_by"))
+	for _, v := range vertices {
+		_, err = tx.ExecContext(ctx, upsertVertex, v.Key, v.Value, v.AddedAt, v.AddedBy, v.RemovedAt, v.RemovedBy)
+		if err != nil {
+			return errors.Wrapf(err, "failed to save vertex [key = %q]", v.Key)
+		}
+	}
+
+	// nolint:gosec // the table name is a validated identifier
+	upsertEdge := fmt.Sprintf(`
+INSERT INTO %[1]s AS t (from_key, to_key, added_at, added_by, removed_at, removed_by, element)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (from_key, to_key) DO UPDATE SET
+	element = CASE WHEN %[2]s THEN EXCLUDED.element ELSE t.element END,
+	added_at = CASE WHEN %[2]s THEN EXCLUDED.added_at ELSE t.added_at END,
+	added_by = CASE WHEN %[2]s THEN EXCLUDED.added_by ELSE t.added_by END,
+	removed_at = CASE WHEN %[3]s THEN EXCLUDED.removed_at ELSE t.removed_at END,
+	removed_by = CASE WHEN %[3]s THEN EXCLUDED.removed_by ELSE t.removed_by END`,
+		a.edges, newerSQL("added_at", "added_by"), newerSQL("removed_at", "removed_by"))
+	for _, e := range edges {
+		_, err = tx.ExecContext(ctx, upsertEdge, e.From, e.To, e.AddedAt, e.AddedBy, e.RemovedAt, e.RemovedBy, e.Element)
+		if err != nil {
+			return errors.Wrapf(err, "failed to save edge [from = %q, to = %q]", e.From, e.To)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "failed to commit the transaction")
+	}
+	return nil
+}
+
+// Load reads the tables and returns a graph of the given replica with the stored state
+func (a PostgresAdapter) Load(ctx context.Context, r crdt.Replica) (lww.Graph, error) {
+	var (
+		vertices []vertexRow
+		edges    []edgeRow
+	)
+
+	// nolint:gosec // the table name is a validated identifier
+	rows, err := a.db.QueryContext(ctx, fmt.Sprintf(`SELECT key, value, added_at, added_by, removed_at, removed_by FROM %s`, a.vertices))
+	if err != nil {
+		return lww.Graph{}, errors.Wrapf(err, "failed to query %s", a.vertices)
+	}
+	for rows.Next() {
+		var v vertexRow
+		err = rows.Scan(&v.Key, &v.Value, &v.AddedAt, &v.AddedBy, &v.RemovedAt, &v.RemovedBy)
+		if err != nil {
+			_ = rows.Close()
+			return lww.Graph{}, errors.Wrapf(err, "failed to read %s", a.vertices)
+		}
+		vertices = append(vertices, v)
+	}
+	err = closeRows(rows)
+	if err != nil {
+		return lww.Graph{}, errors.Wrapf(err, "failed to read %s", a.vertices)
+	}
+
+	// nolint:gosec // the table name is a validated identifier
+	rows, err = a.db.QueryContext(ctx, fmt.Sprintf(`SELECT from_key, to_key, added_at, added_by, removed_at, removed_by, element FROM %s`, a.edges))
+	if err != nil {
+		return lww.Graph{}, errors.Wrapf(err, "failed to query %s", a.edges)
+	}
+	for rows.Next() {
+		var e edgeRow
+		err = rows.Scan(&e.From, &e.To, &e.AddedAt, &e.AddedBy, &e.RemovedAt, &e.RemovedBy, &e.Element)
+		if err != nil {
+			_ = rows.Close()
+			return lww.Graph{}, errors.Wrapf(err, "failed to read %s", a.edges)
+		}
+		edges = append(edges, e)
+	}
+	err = closeRows(rows)
+	if err != nil {
+		return lww.Graph{}, errors.Wrapf(err, "failed to read %s", a.edges)
+	}
+
+	data, err := fromRows(vertices, edges)
+	if err != nil {
+		return lww.Graph{}, err
+	}
+
+	g := lww.NewGraph(r)
+	err = g.Unmarshal(data)
+	if err != nil {
+		return lww.Graph{}, errors.Wrap(err, "failed to restore the graph")
+	}
+	return g, nil
+}
+
+// newerSQL returns the SQL condition that is true when the inserted operation wins over the stored one:
+// the later timestamp wins, the greater replica ID wins when timestamps collide
+func newerSQL(at, by string) string {
+	return fmt.Sprintf(
+		"(t.%[1]s IS NULL OR EXCLUDED.%[1]s > t.%[1]s OR (EXCLUDED.%[1]s = t.%[1]s AND EXCLUDED.%[2]s > t.%[2]s))",
+		at, by,
+	)
+}
+
+// closeRows closes the rows and returns the iteration error if any
+func closeRows(rows *sql.Rows) error {
+	err := rows.Err()
+	closeErr := rows.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// toRows converts the serialized graph state into table rows
+func toRows(data []byte) (vertices []vertexRow, edges []edgeRow, err error) {
+	var state graphRows
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to unmarshal the graph")
+	}
+
+	// the compact encoding of edges (see `crdt.Replica.CompactEdges`) is expanded by a graph using the plain one
+	if len(state.EdgeGroups) != 0 {
+		plain := lww.NewGraph(crdt.NewReplica("postgres"))
+		err = plain.Unmarshal(data)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to unmarshal the graph")
+		}
+		data, err = plain.Marshal()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to marshal the graph")
+		}
+		return toRows(data)
+	}
+
+	byKey := make(map[string]*vertexRow)
+	vertex := func(key string) *vertexRow {
+		v, exists := byKey[key]
+		if !exists {
+			v = &vertexRow{Key: key}
+			byKey[key] = v
+		}
+		return v
+	}
+	for key, added := range state.Vertices.Additions {
+		var element lww.Vertex
+		err = json.Unmarshal(added.Element, &element)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to unmarshal vertex [key = %q]", key)
+		}
+		v := vertex(key)
+		v.Value = &element.Value
+		v.AddedAt = nanos(added.Timestamp)
+		v.AddedBy = added.Replica
+	}
+	for key, removedAt := range state.Vertices.Removals {
+		v := vertex(key)
+		v.RemovedAt = nanos(removedAt)
+		v.RemovedBy = state.Vertices.RemovedBy[key]
+	}
+	for _, v := range byKey {
+		vertices = append(vertices, *v)
+	}
+
+	for fromKey, adjacent := range state.Edges {
+		byTo := make(map[string]*edgeRow)
+		edge := func(toKey string) *edgeRow {
+			e, exists := byTo[toKey]
+			if !exists {
+				e = &edgeRow{From: fromKey, To: toKey}
+				byTo[toKey] = e
+			}
+			return e
+		}
+		for toKey, added := range adjacent.Additions {
+			e := edge(toKey)
+			e.AddedAt = nanos(added.Timestamp)
+			e.AddedBy = added.Replica
+			// plain edges are serialized as their key
+			if len(added.Element) != 0 && added.Element[0] != '"' {
+				element := string(added.Element)
+				e.Element = &element
+			}
+		}
+		for toKey, removedAt := range adjacent.Removals {
+			e := edge(toKey)
+			e.RemovedAt = nanos(removedAt)
+			e.RemovedBy = adjacent.RemovedBy[toKey]
+		}
+		for _, e := range byTo {
+			edges = append(edges, *e)
+		}
+	}
+
+	return vertices, edges, nil
+}
+
+// fromRows converts table rows into the serialized graph state
+func fromRows(vertices []vertexRow, edges []edgeRow) ([]byte, error) {
+	type addition struct {
+		Element   interface{} `json:"element"`
+		Timestamp time.Time   `json:"timestamp"`
+		Replica   string      `json:"replica,omitempty"`
+	}
+	type set struct {
+		Additions map[string]addition  `json:"additions"`
+		Removals  map[string]time.Time `json:"removals"`
+		RemovedBy map[string]string    `json:"removedBy,omitempty"`
+	}
+	newSet := func() *set {
+		return &set{
+			Additions: make(map[string]addition),
+			Removals:  make(map[string]time.Time),
+			RemovedBy: make(map[string]string),
+		}
+	}
+
+	state := struct {
+		Vertices *set            `json:"vertices"`
+		Edges    map[string]*set `json:"edges"`
+	}{
+		Vertices: newSet(),
+		Edges:    make(map[string]*set),
+	}
+
+	for _, v := range vertices {
+		if v.AddedAt != nil {
+			value := ""
+			if v.Value != nil {
+				value = *v.Value
+			}
+			state.Vertices.Additions[v.Key] = addition{
+				Element:   lww.Vertex{Key: v.Key, Value: value},
+				Timestamp: time.Unix(0, *v.AddedAt).UTC(),
+				Replica:   v.AddedBy,
+			}
+		}
+		if v.RemovedAt != nil {
+			state.Vertices.Removals[v.Key] = time.Unix(0, *v.RemovedAt).UTC()
+			if v.RemovedBy != "" {
+				state.Vertices.RemovedBy[v.Key] = v.RemovedBy
+			}
+		}
+	}
+
+	for _, e := range edges {
+		adjacent, exists := state.Edges[e.From]
+		if !exists {
+			adjacent = newSet()
+			state.Edges[e.From] = adjacent
+		}
+		if e.AddedAt != nil {
+			var element interface{} = lww.Edge{To: e.To}
+			if e.Element != nil {
+				element = json.RawMessage(*e.Element)
+			}
+			adjacent.Additions[e.To] = addition{
+				Element:   element,
+				Timestamp: time.Unix(0, *e.AddedAt).UTC(),
+				Replica:   e.AddedBy,
+			}
+		}
+		if e.RemovedAt != nil {
+			adjacent.Removals[e.To] = time.Unix(0, *e.RemovedAt).UTC()
+			if e.RemovedBy != "" {
+				adjacent.RemovedBy[e.To] = e.RemovedBy
+			}
+		}
+	}
+
+	return json.Marshal(state)
+}
+
+// nanos returns the timestamp as Unix nanoseconds
+func nanos(t time.Time) *int64 {
+	n := t.UnixNano()
+	return &n
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/rdner/crdt/lww"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresAdapter(t *testing.T) {
+	v1 := lww.Vertex{Key: "vertex1", Value: "value1"}
+	v2 := lww.Vertex{Key: "vertex2", Value: "value2"}
+	v3 := lww.Vertex{Key: "vertex3", Value: "value3"}
+
+	t.Run("rejects invalid table name prefixes", func(t *testing.T) {
+		_, err := NewPostgresAdapter(nil, "graph; DROP TABLE users")
+		require.ErrorIs(t, err, ErrInvalidTableName)
+
+		_, err = NewPostgresAdapter(nil, "1graph")
+		require.ErrorIs(t, err, ErrInvalidTableName)
+
+		_, err = NewPostgresAdapter(nil, "app_graph")
+		require.NoError(t, err)
+	})
+
+	t.Run("maps the graph state to rows and back", func(t *testing.T) {
+		g := lww.NewGraph(testReplica())
+		require.NoError(t, g.AddVertex(v1))
+		require.NoError(t, g.AddVertex(v2))
+		require.NoError(t, g.AddVertex(v3))
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		require.NoError(t, g.AddEdge(v1.Key, v3.Key))
+		require.NoError(t, g.AddWeightedEdge(v2.Key, lww.Edge{To: v1.Key, Weight: 3, Label: "parent"}))
+		require.NoError(t, g.RemoveEdge(v1.Key, v3.Key))
+		require.NoError(t, g.RemoveVertex(v3.Key))
+
+		data, err := g.Marshal()
+		require.NoError(t, err)
+
+		vertices, edges, err := toRows(data)
+		require.NoError(t, err)
+		require.Len(t, vertices, 3)
+		require.Len(t, edges, 3)
+		for _, e := range edges {
+			if e.From == v2.Key {
+				require.NotNil(t, e.Element)
+				require.JSONEq(t, `{"to":"vertex1","weight":3,"label":"parent"}`, *e.Element)
+			} else {
+				require.Nil(t, e.Element, "plain edges carry nothing but their keys")
+			}
+		}
+
+		for _, v := range vertices {
+			require.NotNil(t, v.AddedAt)
+			require.NotNil(t, v.Value)
+			if v.Key == v3.Key {
+				require.NotNil(t, v.RemovedAt)
+				require.Greater(t, *v.RemovedAt, *v.AddedAt)
+			} else {
+				require.Nil(t, v.RemovedAt)
+			}
+		}
+
+		restored, err := fromRows(vertices, edges)
+		require.NoError(t, err)
+
+		loaded := lww.NewGraph(testReplica())
+		require.NoError(t, loaded.Unmarshal(restored))
+
+		expected, err := g.List()
+		require.NoError(t, err)
+		actual, err := loaded.List()
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+		require.JSONEq(t, string(data), string(restored), "timestamps must be preserved with nanosecond precision")
+	})
+
+	t.Run("maps the compact encoding of edges", func(t *testing.T) {
+		r := testReplica()
+		r.CompactEdges = true
+		g := lww.NewGraph(r)
+		require.NoError(t, g.AddVertex(v1))
+		require.NoError(t, g.AddVertex(v2))
+		require.NoError(t, g.AddEdge(v1.Key, v2.Key))
+		require.NoError(t, g.AddWeightedEdge(v2.Key, lww.Edge{To: v1.Key, Weight: 3}))
+
+		data, err := g.Marshal()
+		require.NoError(t, err)
+		vertices, edges, err := toRows(data)
+		require.NoError(t, err)
+		require.Len(t, vertices, 2)
+		require.Len(t, edges, 2)
+
+		restored, err := fromRows(vertices, edges)
+		require.NoError(t, err)
+		loaded := lww.NewGraph(testReplica())
+		require.NoError(t, loaded.Unmarshal(restored))
+		expected, err := g.List()
+		require.NoError(t, err)
+		actual, err := loaded.List()
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	})
+
+	t.Run("restores removals without additions", func(t *testing.T) {
+		removedAt := int64(1630490400000000000)
+		vertices := []vertexRow{{Key: v1.Key, row: row{RemovedAt: &removedAt}}}
+
+		restored, err := fromRows(vertices, nil)
+		require.NoError(t, err)
+
+		g := lww.NewGraph(testReplica())
+		require.NoError(t, g.Unmarshal(restored))
+
+		remote := lww.NewGraph(testReplica())
+		require.NoError(t, remote.AddVertex(v1))
+		g.Merge(remote)
+
+		list, err := g.List()
+		require.NoError(t, err)
+		require.Len(t, list, 1, "the later addition wins")
+	})
+}
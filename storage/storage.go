@@ -0,0 +1,660 @@
+// Package storage persists replicas, so they survive process restarts.
+//
+// A `Backend` keeps the last snapshot of the state and the log of operations
+// applied after the snapshot. `NewGraphFromStorage` recovers an `lww.Graph` by restoring
+// the snapshot and replaying the logged operations with their recorded timestamps,
+// the returned `Graph` logs every subsequent operation before applying it.
+// Operations are attributed to the actor taken from their context (see `crdt.WithActor`),
+// so servers sharing one replica between many users record who made each change.
+//
+// `NewBoltBackend` implements the backend on top of a BoltDB file,
+// `OpenWAL` implements it as a write-ahead log in a directory of append-only files,
+// optionally encrypted at rest with a `Keyring`.
+package storage
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/oplog"
+)
+
+var (
+	// ErrCorrupted occurs when the stored data cannot be read
+	ErrCorrupted = errors.New("corrupted storage")
+)
+
+// Snapshot is a serialized state of a replica
+type Snapshot struct {
+	// Data is the state produced by the CRDT's `Marshal`, nil if no snapshot was saved yet
+	Data []byte
+	// Seq is the sequence number of the last operation included in the state
+	Seq int
+	// Journal is the state of the conflict journal at the time of the snapshot, nil if it's not persisted
+	Journal []byte
+}
+
+// PersistentJournal is a conflict journal that can be saved alongside snapshots, `crdt.Journal` implements it.
+// When the replica journal implements this interface, `Graph` saves it with every snapshot
+// and restores it on recovery.
+type PersistentJournal interface {
+	crdt.ConflictJournal
+	// Marshal serializes the journal
+	Marshal() ([]byte, error)
+	// Unmarshal replaces the journal state with the serialized one
+	Unmarshal(data []byte) error
+}
+
+// Backend stores the state of a single replica
+type Backend interface {
+	// Load returns the last saved snapshot and the operations appended after it ordered by `Seq`.
+	Load() (snapshot Snapshot, ops []oplog.Op, err error)
+	// AppendOp durably appends the operation to the log.
+	AppendOp(op oplog.Op) error
+	// SaveSnapshot durably replaces the snapshot and discards the logged operations included in it.
+	SaveSnapshot(snapshot Snapshot) error
+}
+
+// CheckpointTrigger is implemented by backends deciding when the logged operations should be compacted
+// into a new snapshot, e.g. when the log exceeds a size or an age threshold, `WAL` implements it.
+// `Graph` checks it after every logged operation and saves a snapshot when it's due.
+type CheckpointTrigger interface {
+	// CheckpointDue returns `true` if a new snapshot should be saved
+	CheckpointDue() bool
+}
+
+// NewGraphFromStorage recovers the graph from the backend and makes it ready for use.
+// The state is restored from the last snapshot, then the logged operations are replayed
+// with their recorded timestamps. An empty backend produces an empty graph.
+// Returns an error with `ErrCorrupted` cause if the stored state cannot be restored.
+func NewGraphFromStorage(r crdt.Replica, backend Backend) (Graph, error) {
+	g, err := NewGraphFromStorageAsync(r, backend)
+	if err != nil {
+		return Graph{}, err
+	}
+	err = g.Wait()
+	if err != nil {
+		return Graph{}, err
+	}
+	return g, nil
+}
+
+// NewGraphFromStorageAsync starts recovering the graph from the backend like `NewGraphFromStorage`
+// and returns as soon as the live vertices and edges of the last snapshot are restored,
+// so services can serve reads of a large graph earlier (see `lww.Graph.UnmarshalLive`).
+// The removals are restored, the index of incoming edges is built and the logged operations
+// are replayed in the background, `Ready` is closed when it's done.
+// Until then reads return the live state of the snapshot, writes wait for the recovery to finish
+// and return its error if it fails, use `Wait` to get the error.
+// Returns an error with `ErrCorrupted` cause if the live state of the snapshot cannot be restored.
+func NewGraphFromStorageAsync(r crdt.Replica, backend Backend) (Graph, error) {
+	r = r.WithDefaults()
+	state := &graphState{ready: make(chan struct{})}
+	local := r
+	local.Clock = clock.Func(func() time.Time {
+		return state.now
+	})
+
+	g := Graph{
+		Graph:   lww.NewGraph(local),
+		mutex:   &sync.Mutex{},
+		replica: r,
+		backend: backend,
+		state:   state,
+	}
+
+	snapshot, ops, err := backend.Load()
+	if err != nil {
+		return Graph{}, errors.Wrapf(err, "failed to load replica %q", r.ID)
+	}
+
+	restoreRest := func() error { return nil }
+	if snapshot.Data != nil {
+		restoreRest, err = g.Graph.UnmarshalLive(snapshot.Data)
+		if err != nil {
+			return Graph{}, errors.Wrapf(ErrCorrupted, "failed to restore the snapshot of replica %q: %s", r.ID, err)
+		}
+	}
+	if journal, isPersistent := r.Journal.(PersistentJournal); isPersistent && snapshot.Journal != nil {
+		err = journal.Unmarshal(snapshot.Journal)
+		if err != nil {
+			return Graph{}, errors.Wrapf(ErrCorrupted, "failed to restore the conflict journal of replica %q: %s", r.ID, err)
+		}
+	}
+	state.seq = snapshot.Seq
+
+	// the writes wait for the recovery holding the lock
+	g.mutex.Lock()
+	go func() {
+		defer close(state.ready)
+		defer g.mutex.Unlock()
+		state.err = g.recover(restoreRest, ops)
+	}()
+
+	return g, nil
+}
+
+// recover restores the rest of the snapshot and replays the logged operations, must be called under the lock
+func (g Graph) recover(restoreRest func() error, ops []oplog.Op) error {
+	err := restoreRest()
+	if err != nil {
+		return errors.Wrapf(ErrCorrupted, "failed to restore the snapshot of replica %q: %s", g.replica.ID, err)
+	}
+
+	for _, op := range ops {
+		if op.Seq <= g.state.seq {
+			continue
+		}
+		g.state.now = op.Time
+		// operations that failed when applied fail again without changing the state
+		err = oplog.Apply(g.Graph, op)
+		if errors.Is(err, oplog.ErrInvalidLog) {
+			return errors.Wrapf(ErrCorrupted, "failed to replay operation %d of replica %q: %s", op.Seq, g.replica.ID, err)
+		}
+		g.state.seq = op.Seq
+	}
+
+	g.replica.Logger.Printf("replica %q recovered a graph at operation %d with %d replayed operations",
+		g.replica.ID, g.state.seq, len(ops))
+	return nil
+}
+
+// Ready returns a channel which is closed when the graph is recovered completely, see `NewGraphFromStorageAsync`
+func (g Graph) Ready() <-chan struct{} {
+	return g.state.ready
+}
+
+// Wait waits until the graph is recovered completely and returns the error of the recovery if it failed,
+// see `NewGraphFromStorageAsync`
+func (g Graph) Wait() error {
+	<-g.state.ready
+	return g.state.err
+}
+
+// Graph is an `lww.Graph` that persists every change to a `Backend`.
+// Use `NewGraphFromStorage` or `NewGraphFromStorageAsync` in order to initialize it before use.
+// The graph is thread-safe and can be used from several go routines.
+//
+// All the methods changing the embedded graph are shadowed by methods persisting the change.
+// Operations are appended to the log before they are applied (write-ahead), if appending fails
+// the operation returns an error without changing the state. Operations that fail
+// (e.g. adding an existing vertex) are logged too, they fail again on recovery.
+// Batches and transactions are logged as single operations, so they are replayed atomically.
+// Merges, imports, retention and eviction are persisted as a new snapshot since they cannot be logged
+// as single operations, so large merges never grow the log.
+// The replica conflict journal is saved with every snapshot if it implements `PersistentJournal`.
+// If the backend implements `CheckpointTrigger` (e.g. `WAL`) a snapshot is saved automatically
+// after the operation that makes it due, otherwise call `Checkpoint` periodically in order to compact the log.
+type Graph struct {
+	// Graph is the in-memory state, the embedded read methods can be used directly.
+	// Changing the embedded graph directly bypasses the storage.
+	lww.Graph
+
+	// mutex serializes changes, so every change is timestamped and logged in order
+	mutex *sync.Mutex
+
+	// replica is the identity and the policies of the replica the graph belongs to
+	replica crdt.Replica
+	// backend stores the state
+	backend Backend
+	// state contains the current sequence number and timestamp
+	state *graphState
+}
+
+// graphState contains the mutable state of the persistent graph
+type graphState struct {
+	// seq is the sequence number of the last applied operation
+	seq int
+	// now is the timestamp the graph clock returns for the current operation
+	now time.Time
+	// ready is closed when the recovery is finished
+	ready chan struct{}
+	// err is the error of the recovery, it's set before `ready` is closed
+	err error
+}
+
+// AddVertex adds the given vertex to the graph and logs the operation.
+// See `lww.Graph.AddVertex` for details.
+func (g Graph) AddVertex(ctx context.Context, v lww.Vertex) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.AddVertex, Key: v.Key, Value: v.Value})
+}
+
+// RemoveVertex removes the vertex from the graph and logs the operation.
+// See `lww.Graph.RemoveVertex` for details.
+func (g Graph) RemoveVertex(ctx context.Context, key string) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.RemoveVertex, Key: key})
+}
+
+// AddEdge adds the edge to the graph and logs the operation.
+// See `lww.Graph.AddEdge` for details.
+func (g Graph) AddEdge(ctx context.Context, fromKey, toKey string) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.AddEdge, From: fromKey, To: toKey})
+}
+
+// RemoveEdge removes the edge from the graph and logs the operation.
+// See `lww.Graph.RemoveEdge` for details.
+func (g Graph) RemoveEdge(ctx context.Context, fromKey, toKey string) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.RemoveEdge, From: fromKey, To: toKey})
+}
+
+// AddEdgeWeight adds `delta` to the edge weight and logs the operation.
+// See `lww.Graph.AddEdgeWeight` for details.
+func (g Graph) AddEdgeWeight(ctx context.Context, fromKey, toKey string, delta int64) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.AddEdgeWeight, From: fromKey, To: toKey, Delta: delta})
+}
+
+// UpdateVertex replaces the vertex value and logs the operation.
+// See `lww.Graph.UpdateVertex` for details.
+func (g Graph) UpdateVertex(ctx context.Context, v lww.Vertex) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.UpdateVertex, Key: v.Key, Value: v.Value})
+}
+
+// UpsertVertex adds or replaces the vertex and logs the operation.
+// See `lww.Graph.UpsertVertex` for details.
+func (g Graph) UpsertVertex(ctx context.Context, v lww.Vertex) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.UpsertVertex, Key: v.Key, Value: v.Value})
+}
+
+// AddWeightedEdge adds the edge with its weight, label and attributes to the graph and logs the operation.
+// See `lww.Graph.AddWeightedEdge` for details.
+func (g Graph) AddWeightedEdge(ctx context.Context, fromKey string, edge lww.Edge) error {
+	return g.apply(ctx, edgeOp(fromKey, edge))
+}
+
+// UpdateEdgeWeight sets the edge weight and logs the operation.
+// See `lww.Graph.UpdateEdgeWeight` for details.
+func (g Graph) UpdateEdgeWeight(ctx context.Context, fromKey, toKey string, weight int64) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.UpdateEdgeWeight, From: fromKey, To: toKey, Weight: weight})
+}
+
+// UpdateEdgeAttributes sets the edge attributes and logs the operation.
+// See `lww.Graph.UpdateEdgeAttributes` for details.
+func (g Graph) UpdateEdgeAttributes(ctx context.Context, fromKey, toKey string, attributes map[string]string) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.UpdateEdgeAttributes, From: fromKey, To: toKey, Attributes: attributes})
+}
+
+// AddEdgeAcyclic adds the edge unless it closes a cycle and logs the operation.
+// See `lww.Graph.AddEdgeAcyclic` for details.
+func (g Graph) AddEdgeAcyclic(ctx context.Context, fromKey, toKey string) error {
+	return g.apply(ctx, oplog.Op{Type: oplog.AddEdgeAcyclic, From: fromKey, To: toKey})
+}
+
+// CompareAndAddVertex adds or replaces the vertex if the `observed` version is still current and logs the operation.
+// See `lww.Graph.CompareAndAddVertex` for details.
+func (g Graph) CompareAndAddVertex(ctx context.Context, v lww.Vertex, observed lww.Version) (record lww.Record, err error) {
+	op := oplog.Op{Type: oplog.CompareAndAddVertex, Key: v.Key, Value: v.Value, Observed: &observed}
+	err = g.log(ctx, op, func() error {
+		record, err = g.Graph.CompareAndAddVertex(v, observed)
+		return err
+	})
+	return record, err
+}
+
+// CompareAndRemoveVertex removes the vertex if the `observed` version is still current and logs the operation.
+// See `lww.Graph.CompareAndRemoveVertex` for details.
+func (g Graph) CompareAndRemoveVertex(ctx context.Context, key string, observed lww.Version) (record lww.Record, err error) {
+	op := oplog.Op{Type: oplog.CompareAndRemoveVertex, Key: key, Observed: &observed}
+	err = g.log(ctx, op, func() error {
+		record, err = g.Graph.CompareAndRemoveVertex(key, observed)
+		return err
+	})
+	return record, err
+}
+
+// AddVertices adds the batch of vertices and logs it as a single operation.
+// See `lww.Graph.AddVertices` for details.
+func (g Graph) AddVertices(ctx context.Context, vertices []lww.Vertex) error {
+	op := oplog.Op{Type: oplog.AddVertices, Batch: make([]oplog.Op, 0, len(vertices))}
+	for _, v := range vertices {
+		op.Batch = append(op.Batch, oplog.Op{Type: oplog.AddVertex, Key: v.Key, Value: v.Value})
+	}
+	return g.apply(ctx, op)
+}
+
+// AddEdges adds the batch of edges and logs it as a single operation.
+// See `lww.Graph.AddEdges` for details.
+func (g Graph) AddEdges(ctx context.Context, edges []lww.EdgeSpec) error {
+	op := oplog.Op{Type: oplog.AddEdges, Batch: make([]oplog.Op, 0, len(edges))}
+	for _, spec := range edges {
+		op.Batch = append(op.Batch, edgeOp(spec.From, spec.Edge))
+	}
+	return g.apply(ctx, op)
+}
+
+// Update runs `fn` with a transaction like `lww.Graph.Update` does. The operations made in the transaction
+// are logged as a single operation after `fn` returns and before they are applied,
+// the operations that failed are not logged. If `fn` or logging fails nothing is changed.
+func (g Graph) Update(ctx context.Context, fn func(tx Tx) error) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.state.err != nil {
+		return g.state.err
+	}
+
+	g.state.now = g.replica.Clock.Now()
+	err := g.Graph.Update(func(lwwTx lww.Tx) error {
+		tx := Tx{tx: lwwTx, ops: &[]oplog.Op{}}
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+		if len(*tx.ops) == 0 {
+			return nil
+		}
+		return g.appendOp(ctx, oplog.Op{Type: oplog.Update, Batch: *tx.ops})
+	})
+	g.checkpointIfDue()
+	return err
+}
+
+// Tx is a transaction of the persistent graph, see `Graph.Update`.
+// It records the successful operations, so they can be logged and replayed.
+// It's valid only until `fn` passed to `Graph.Update` returns and must not be used from other go routines.
+type Tx struct {
+	// tx is the transaction of the in-memory graph
+	tx lww.Tx
+	// ops are the recorded operations
+	ops *[]oplog.Op
+}
+
+// Lookup returns the vertex including the changes made in the transaction, see `lww.Tx.Lookup`
+func (tx Tx) Lookup(key string) (lww.Vertex, error) {
+	return tx.tx.Lookup(key)
+}
+
+// AddVertex adds the vertex in the transaction, see `lww.Tx.AddVertex`
+func (tx Tx) AddVertex(v lww.Vertex) error {
+	return tx.apply(oplog.Op{Type: oplog.AddVertex, Key: v.Key, Value: v.Value})
+}
+
+// UpdateVertex replaces the vertex value in the transaction, see `lww.Tx.UpdateVertex`
+func (tx Tx) UpdateVertex(v lww.Vertex) error {
+	return tx.apply(oplog.Op{Type: oplog.UpdateVertex, Key: v.Key, Value: v.Value})
+}
+
+// RemoveVertex removes the vertex in the transaction, see `lww.Tx.RemoveVertex`
+func (tx Tx) RemoveVertex(key string) error {
+	return tx.apply(oplog.Op{Type: oplog.RemoveVertex, Key: key})
+}
+
+// AddEdge adds the edge in the transaction, see `lww.Tx.AddEdge`
+func (tx Tx) AddEdge(fromKey, toKey string) error {
+	return tx.apply(oplog.Op{Type: oplog.AddEdge, From: fromKey, To: toKey})
+}
+
+// AddWeightedEdge adds the edge with its weight, label and attributes in the transaction,
+// see `lww.Tx.AddWeightedEdge`
+func (tx Tx) AddWeightedEdge(fromKey string, edge lww.Edge) error {
+	return tx.apply(edgeOp(fromKey, edge))
+}
+
+// RemoveEdge removes the edge in the transaction, see `lww.Tx.RemoveEdge`
+func (tx Tx) RemoveEdge(fromKey, toKey string) error {
+	return tx.apply(oplog.Op{Type: oplog.RemoveEdge, From: fromKey, To: toKey})
+}
+
+// apply applies the operation to the transaction and records it if it succeeds
+func (tx Tx) apply(op oplog.Op) error {
+	err := oplog.ApplyTx(tx.tx, op)
+	if err != nil {
+		return err
+	}
+	*tx.ops = append(*tx.ops, op)
+	return nil
+}
+
+// Merge merges the `remote` graph and saves a snapshot of the result.
+// See `lww.Graph.Merge` for details.
+func (g Graph) Merge(remote lww.Graph) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.state.err != nil {
+		return g.state.err
+	}
+
+	g.Graph.Merge(remote)
+	return g.checkpoint()
+}
+
+// MergeCRDT implements the `crdt.CRDT` interface, it saves a snapshot of the result.
+func (g Graph) MergeCRDT(remote crdt.CRDT) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.state.err != nil {
+		return g.state.err
+	}
+
+	err := g.Graph.MergeCRDT(remote)
+	if err != nil {
+		return err
+	}
+	return g.checkpoint()
+}
+
+// Unmarshal implements the `crdt.CRDT` interface, it saves a snapshot of the result.
+func (g Graph) Unmarshal(data []byte) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.state.err != nil {
+		return g.state.err
+	}
+
+	err := g.Graph.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	return g.checkpoint()
+}
+
+// ImportNamespace imports the namespace and saves a snapshot of the result.
+// See `lww.Graph.ImportNamespace` for details.
+func (g Graph) ImportNamespace(ns string, data []byte, keyPrefixRemap map[string]string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.state.err != nil {
+		return g.state.err
+	}
+
+	err := g.Graph.ImportNamespace(ns, data, keyPrefixRemap)
+	if err != nil {
+		return err
+	}
+	return g.checkpoint()
+}
+
+// MergeAll merges the `remotes` and saves a snapshot of the result.
+// See `lww.Graph.MergeAll` for details.
+func (g Graph) MergeAll(remotes ...lww.Graph) error {
+	return g.snapshotAfter(func() error {
+		g.Graph.MergeAll(remotes...)
+		return nil
+	})
+}
+
+// MergeWithReport merges the `remote` graph and saves a snapshot of the result.
+// See `lww.Graph.MergeWithReport` for details.
+func (g Graph) MergeWithReport(remote lww.Graph) (report lww.MergeReport, err error) {
+	err = g.snapshotAfter(func() error {
+		report = g.Graph.MergeWithReport(remote)
+		return nil
+	})
+	return report, err
+}
+
+// MergeContext merges the `remote` graph in chunks and saves a snapshot of the result,
+// the chunks merged before the merge is cancelled are saved too.
+// See `lww.Graph.MergeContext` for details.
+func (g Graph) MergeContext(ctx context.Context, remote lww.Graph, config lww.MergeConfig) error {
+	return g.snapshotAfter(func() error {
+		return g.Graph.MergeContext(ctx, remote, config)
+	})
+}
+
+// ImportGraphML imports the GraphML document and saves a snapshot of the result.
+// See `lww.Graph.ImportGraphML` for details.
+func (g Graph) ImportGraphML(r io.Reader) error {
+	return g.snapshotAfter(func() error {
+		return g.Graph.ImportGraphML(r)
+	})
+}
+
+// ImportJGF imports the JSON Graph Format document and saves a snapshot of the result.
+// See `lww.Graph.ImportJGF` for details.
+func (g Graph) ImportJGF(r io.Reader) error {
+	return g.snapshotAfter(func() error {
+		return g.Graph.ImportJGF(r)
+	})
+}
+
+// ApplyRetention applies the retention policies and saves a snapshot of the result.
+// See `lww.Graph.ApplyRetention` for details.
+func (g Graph) ApplyRetention(policies lww.RetentionPolicies) (result lww.RetentionResult, err error) {
+	err = g.snapshotAfter(func() error {
+		result, err = g.Graph.ApplyRetention(policies)
+		return err
+	})
+	return result, err
+}
+
+// Evict evicts cold vertices and saves a snapshot of the result, since dropped vertices change the state.
+// See `lww.Graph.Evict` for details.
+func (g Graph) Evict(budget lww.MemoryBudget) (result lww.EvictionResult, err error) {
+	err = g.snapshotAfter(func() error {
+		result, err = g.Graph.Evict(budget)
+		return err
+	})
+	return result, err
+}
+
+// Checkpoint saves a snapshot of the current state, so the logged operations can be discarded
+// and the recovery does not need to replay them.
+func (g Graph) Checkpoint() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.state.err != nil {
+		return g.state.err
+	}
+
+	return g.checkpoint()
+}
+
+// checkpoint saves a snapshot of the current state, must be called under the lock
+func (g Graph) checkpoint() error {
+	data, err := g.Graph.Marshal()
+	if err != nil {
+		return errors.Wrapf(err, "failed to snapshot replica %q", g.replica.ID)
+	}
+
+	snapshot := Snapshot{Data: data, Seq: g.state.seq}
+	if journal, isPersistent := g.replica.Journal.(PersistentJournal); isPersistent {
+		snapshot.Journal, err = journal.Marshal()
+		if err != nil {
+			return errors.Wrapf(err, "failed to snapshot the conflict journal of replica %q", g.replica.ID)
+		}
+	}
+
+	err = g.backend.SaveSnapshot(snapshot)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save the snapshot of replica %q at operation %d", g.replica.ID, g.state.seq)
+	}
+
+	return nil
+}
+
+// snapshotAfter runs `fn` changing the graph with the current timestamp and saves a snapshot of the result,
+// it's used for the changes that cannot be logged as operations. The snapshot is saved even if `fn` fails,
+// since it can fail after changing a part of the state (e.g. a cancelled merge).
+func (g Graph) snapshotAfter(fn func() error) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.state.err != nil {
+		return g.state.err
+	}
+
+	g.state.now = g.replica.Clock.Now()
+	err := fn()
+	checkpointErr := g.checkpoint()
+	if err != nil {
+		return err
+	}
+	return checkpointErr
+}
+
+// apply logs the operation attributed to the actor from the context with the current timestamp
+// and applies it to the graph after it's logged
+func (g Graph) apply(ctx context.Context, op oplog.Op) error {
+	return g.log(ctx, op, func() error {
+		return oplog.Apply(g.Graph, op)
+	})
+}
+
+// log logs the operation attributed to the actor from the context with the current timestamp
+// and runs `fn` applying it to the graph after it's logged
+func (g Graph) log(ctx context.Context, op oplog.Op, fn func() error) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.state.err != nil {
+		return g.state.err
+	}
+
+	g.state.now = g.replica.Clock.Now()
+	err := g.appendOp(ctx, op)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	g.checkpointIfDue()
+	return err
+}
+
+// checkpointIfDue saves a snapshot if the backend implements `CheckpointTrigger` and the snapshot is due,
+// must be called under the lock. The operation is already logged, so a failed snapshot is only logged
+// and retried after the next operation.
+func (g Graph) checkpointIfDue() {
+	trigger, isTrigger := g.backend.(CheckpointTrigger)
+	if !isTrigger || !trigger.CheckpointDue() {
+		return
+	}
+	err := g.checkpoint()
+	if err != nil {
+		g.replica.Logger.Printf("replica %q failed to save a due snapshot: %s", g.replica.ID, err)
+		g.replica.Metrics.Count("storage.checkpoint.failed", 1)
+		return
+	}
+	g.replica.Metrics.Count("storage.checkpoint.auto", 1)
+}
+
+// appendOp appends the operation with the current timestamp to the log, must be called under the lock
+func (g Graph) appendOp(ctx context.Context, op oplog.Op) error {
+	op.Replica = g.replica.ID
+	op.Actor, _ = crdt.ActorFromContext(ctx)
+	op.Seq = g.state.seq + 1
+	op.Time = g.state.now
+
+	err := g.backend.AppendOp(op)
+	if err != nil {
+		return errors.Wrapf(err, "failed to log operation %d of replica %q", op.Seq, g.replica.ID)
+	}
+	g.state.seq = op.Seq
+
+	return nil
+}
+
+// edgeOp returns the `AddWeightedEdge` operation of the edge
+func edgeOp(fromKey string, edge lww.Edge) oplog.Op {
+	return oplog.Op{
+		Type:       oplog.AddWeightedEdge,
+		From:       fromKey,
+		To:         edge.To,
+		Weight:     edge.Weight,
+		Label:      edge.Label,
+		Attributes: edge.Attributes,
+	}
+}
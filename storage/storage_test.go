@@ -0,0 +1,350 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt"
+	"github.com/rdner/crdt/clock"
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/oplog"
+	"github.com/stretchr/testify/require"
+)
+
+var errFailed = errors.New("failed")
+
+// memoryBackend is a `Backend` keeping the state in memory for tests
+type memoryBackend struct {
+	mutex    *sync.Mutex
+	snapshot *Snapshot
+	ops      *[]oplog.Op
+	fail     *bool
+}
+
+func newMemoryBackend() memoryBackend {
+	return memoryBackend{
+		mutex:    &sync.Mutex{},
+		snapshot: &Snapshot{},
+		ops:      &[]oplog.Op{},
+		fail:     new(bool),
+	}
+}
+
+func (b memoryBackend) Load() (Snapshot, []oplog.Op, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return *b.snapshot, append([]oplog.Op{}, *b.ops...), nil
+}
+
+func (b memoryBackend) AppendOp(op oplog.Op) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if *b.fail {
+		return errFailed
+	}
+	*b.ops = append(*b.ops, op)
+	return nil
+}
+
+func (b memoryBackend) SaveSnapshot(snapshot Snapshot) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if *b.fail {
+		return errFailed
+	}
+	*b.snapshot = snapshot
+	var ops []oplog.Op
+	for _, op := range *b.ops {
+		if op.Seq > snapshot.Seq {
+			ops = append(ops, op)
+		}
+	}
+	*b.ops = ops
+	return nil
+}
+
+func testReplica() crdt.Replica {
+	now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	r := crdt.NewReplica("test")
+	r.Clock = clock.Func(func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	})
+	return r
+}
+
+func TestGraph(t *testing.T) {
+	ctx := context.Background()
+	v1 := lww.Vertex{Key: "vertex1", Value: "value1"}
+	v2 := lww.Vertex{Key: "vertex2", Value: "value2"}
+	v3 := lww.Vertex{Key: "vertex3", Value: "value3"}
+
+	t.Run("recovers the state from logged operations", func(t *testing.T) {
+		backend := newMemoryBackend()
+		g, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+
+		require.NoError(t, g.AddVertex(ctx, v1))
+		require.NoError(t, g.AddVertex(ctx, v2))
+		require.NoError(t, g.AddEdge(ctx, v1.Key, v2.Key))
+		require.NoError(t, g.AddEdgeWeight(ctx, v1.Key, v2.Key, 5))
+		require.ErrorIs(t, g.AddVertex(ctx, v1), lww.ErrVertexAlreadyExists)
+		require.Len(t, *backend.ops, 5, "failed operations are logged too")
+
+		recovered, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+
+		expected, err := g.Marshal()
+		require.NoError(t, err)
+		actual, err := recovered.Marshal()
+		require.NoError(t, err)
+		require.JSONEq(t, string(expected), string(actual), "timestamps must be restored as recorded")
+
+		require.NoError(t, recovered.AddVertex(ctx, v3))
+		require.Equal(t, 6, (*backend.ops)[5].Seq)
+	})
+
+	t.Run("serves reads of the live snapshot state before the recovery is finished", func(t *testing.T) {
+		backend := newMemoryBackend()
+		g, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+		require.NoError(t, g.AddVertex(ctx, v1))
+		require.NoError(t, g.AddVertex(ctx, v2))
+		require.NoError(t, g.AddVertex(ctx, v3))
+		require.NoError(t, g.AddEdge(ctx, v2.Key, v1.Key))
+		require.NoError(t, g.RemoveVertex(ctx, v3.Key))
+		require.NoError(t, g.Checkpoint())
+		require.NoError(t, g.AddEdge(ctx, v1.Key, v2.Key))
+
+		// the replayed operations are reported to the observer, so the recovery can be paused
+		release := make(chan struct{})
+		r := testReplica()
+		r.Observer = crdt.ObserverFunc(func(crdt.Mutation) {
+			<-release
+		})
+		recovering, err := NewGraphFromStorageAsync(r, backend)
+		require.NoError(t, err)
+
+		select {
+		case <-recovering.Ready():
+			require.FailNow(t, "the recovery is not finished yet")
+		default:
+		}
+		found, err := recovering.Lookup(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, v1, found)
+		_, err = recovering.Lookup(v3.Key)
+		require.ErrorIs(t, err, lww.ErrVertexNotFound)
+		predecessors, err := recovering.FindPredecessors(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, []lww.Vertex{v2}, predecessors, "the edges are scanned before the index is built")
+
+		close(release)
+		require.NoError(t, recovering.Wait())
+		<-recovering.Ready()
+
+		expected, err := g.Marshal()
+		require.NoError(t, err)
+		actual, err := recovering.Marshal()
+		require.NoError(t, err)
+		require.JSONEq(t, string(expected), string(actual))
+		predecessors, err = recovering.FindPredecessors(v2.Key)
+		require.NoError(t, err)
+		require.Equal(t, []lww.Vertex{v1}, predecessors)
+		require.NoError(t, recovering.AddVertex(ctx, v3))
+	})
+
+	t.Run("writes return the error of a failed recovery", func(t *testing.T) {
+		backend := newMemoryBackend()
+		*backend.ops = []oplog.Op{{Seq: 1, Type: "unknown"}}
+
+		recovering, err := NewGraphFromStorageAsync(testReplica(), backend)
+		require.NoError(t, err)
+		require.ErrorIs(t, recovering.Wait(), ErrCorrupted)
+		require.ErrorIs(t, recovering.AddVertex(ctx, v1), ErrCorrupted)
+
+		_, err = NewGraphFromStorage(testReplica(), backend)
+		require.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("recovers all the graph writes, batches and transactions", func(t *testing.T) {
+		backend := newMemoryBackend()
+		g, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+
+		require.NoError(t, g.AddVertices(ctx, []lww.Vertex{v1, v2}))
+		require.NoError(t, g.UpdateVertex(ctx, lww.Vertex{Key: v1.Key, Value: "updated"}))
+		require.NoError(t, g.UpsertVertex(ctx, v3))
+		require.NoError(t, g.AddEdges(ctx, []lww.EdgeSpec{{From: v1.Key, Edge: lww.Edge{To: v2.Key}}}))
+		require.NoError(t, g.AddWeightedEdge(ctx, v2.Key, lww.Edge{To: v3.Key, Weight: 3, Label: "next"}))
+		require.NoError(t, g.UpdateEdgeWeight(ctx, v1.Key, v2.Key, 7))
+		require.NoError(t, g.UpdateEdgeAttributes(ctx, v1.Key, v2.Key, map[string]string{"color": "red"}))
+		require.ErrorIs(t, g.AddEdgeAcyclic(ctx, v3.Key, v1.Key), lww.ErrCycleDetected)
+		require.NoError(t, g.AddEdgeAcyclic(ctx, v1.Key, v3.Key))
+
+		observed := g.ObserveVertex(v3.Key).Version
+		record, err := g.CompareAndAddVertex(ctx, lww.Vertex{Key: v3.Key, Value: "compared"}, observed)
+		require.NoError(t, err)
+		require.Equal(t, lww.Vertex{Key: v3.Key, Value: "compared"}, record.Element)
+		_, err = g.CompareAndRemoveVertex(ctx, v3.Key, observed)
+		require.ErrorIs(t, err, lww.ErrVersionConflict)
+
+		require.NoError(t, g.Update(ctx, func(tx Tx) error {
+			require.ErrorIs(t, tx.AddVertex(v1), lww.ErrVertexAlreadyExists, "failed operations are not logged")
+			err := tx.RemoveVertex(v2.Key)
+			if err != nil {
+				return err
+			}
+			return tx.AddWeightedEdge(v3.Key, lww.Edge{To: v1.Key, Label: "back"})
+		}))
+		require.ErrorIs(t, g.Update(ctx, func(tx Tx) error {
+			require.NoError(t, tx.RemoveVertex(v1.Key))
+			return errFailed
+		}), errFailed)
+
+		ops := *backend.ops
+		require.Len(t, ops, 12, "rolled back transactions are not logged")
+		require.Equal(t, oplog.Update, ops[11].Type)
+		require.Len(t, ops[11].Batch, 2)
+
+		recovered, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+
+		expected, err := g.Marshal()
+		require.NoError(t, err)
+		actual, err := recovered.Marshal()
+		require.NoError(t, err)
+		require.JSONEq(t, string(expected), string(actual))
+	})
+
+	t.Run("persists imports, retention and eviction as snapshots", func(t *testing.T) {
+		backend := newMemoryBackend()
+		g, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+		require.NoError(t, g.AddVertex(ctx, v1))
+
+		source := lww.NewGraph(crdt.NewReplica("source"))
+		require.NoError(t, source.AddVertex(v2))
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, source.ExportJGF(buf))
+		require.NoError(t, g.ImportJGF(buf))
+		require.Empty(t, *backend.ops)
+
+		remote := lww.NewGraph(crdt.NewReplica("remote"))
+		require.NoError(t, remote.AddVertex(v3))
+		report, err := g.MergeWithReport(remote)
+		require.NoError(t, err)
+		require.True(t, report.Empty())
+
+		recovered, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+		expected, err := g.Marshal()
+		require.NoError(t, err)
+		actual, err := recovered.Marshal()
+		require.NoError(t, err)
+		require.JSONEq(t, string(expected), string(actual))
+	})
+
+	t.Run("attributes operations to the actor from the context", func(t *testing.T) {
+		backend := newMemoryBackend()
+		g, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+
+		require.NoError(t, g.AddVertex(crdt.WithActor(ctx, "alice"), v1))
+		require.NoError(t, g.AddVertex(ctx, v2))
+
+		ops := *backend.ops
+		require.Equal(t, "alice", ops[0].Actor)
+		require.Equal(t, "test", ops[0].Replica)
+		require.Empty(t, ops[1].Actor)
+	})
+
+	t.Run("compacts the log on checkpoint", func(t *testing.T) {
+		backend := newMemoryBackend()
+		g, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+
+		require.NoError(t, g.AddVertex(ctx, v1))
+		require.NoError(t, g.AddVertex(ctx, v2))
+		require.NoError(t, g.Checkpoint())
+		require.Empty(t, *backend.ops)
+		require.Equal(t, 2, backend.snapshot.Seq)
+
+		require.NoError(t, g.RemoveVertex(ctx, v1.Key))
+		require.Len(t, *backend.ops, 1)
+
+		recovered, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+		list, err := recovered.List()
+		require.NoError(t, err)
+		require.Equal(t, []lww.VertexWithEdges{{Vertex: v2, AdjacentKeys: []string{}}}, list)
+	})
+
+	t.Run("persists merges as snapshots", func(t *testing.T) {
+		backend := newMemoryBackend()
+		g, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+		require.NoError(t, g.AddVertex(ctx, v1))
+
+		remote := lww.NewGraph(crdt.NewReplica("remote"))
+		require.NoError(t, remote.AddVertex(v2))
+		require.NoError(t, g.Merge(remote))
+		require.Empty(t, *backend.ops)
+
+		recovered, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+		_, err = recovered.Lookup(v2.Key)
+		require.NoError(t, err)
+	})
+
+	t.Run("persists the conflict journal with snapshots", func(t *testing.T) {
+		backend := newMemoryBackend()
+		r := testReplica()
+		r.Journal = crdt.NewJournal(crdt.JournalConfig{})
+		g, err := NewGraphFromStorage(r, backend)
+		require.NoError(t, err)
+		require.NoError(t, g.AddVertex(ctx, v1))
+
+		remote := lww.NewGraph(crdt.Replica{ID: "remote", Clock: clock.Func(func() time.Time {
+			return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		})})
+		require.NoError(t, remote.AddVertex(v1))
+		require.NoError(t, g.Merge(remote))
+		require.NotNil(t, backend.snapshot.Journal)
+
+		journal := crdt.NewJournal(crdt.JournalConfig{})
+		r.Journal = journal
+		_, err = NewGraphFromStorage(r, backend)
+		require.NoError(t, err)
+		conflicts := journal.Conflicts(time.Time{}, time.Time{})
+		require.Len(t, conflicts, 1)
+		require.Equal(t, v1.Key, conflicts[0].Key)
+		require.Equal(t, "remote", conflicts[0].Winner.Replica)
+		require.Equal(t, "test", conflicts[0].Loser.Replica)
+	})
+
+	t.Run("returns the backend error when logging fails", func(t *testing.T) {
+		backend := newMemoryBackend()
+		g, err := NewGraphFromStorage(testReplica(), backend)
+		require.NoError(t, err)
+
+		*backend.fail = true
+		require.ErrorIs(t, g.AddVertex(ctx, v1), errFailed)
+		require.ErrorIs(t, g.Checkpoint(), errFailed)
+
+		_, err = g.Lookup(v1.Key)
+		require.ErrorIs(t, err, lww.ErrVertexNotFound, "operations must not be applied when logging fails")
+	})
+
+	t.Run("returns ErrCorrupted for a broken snapshot", func(t *testing.T) {
+		backend := newMemoryBackend()
+		*backend.snapshot = Snapshot{Data: []byte("{"), Seq: 1}
+
+		_, err := NewGraphFromStorage(testReplica(), backend)
+		require.ErrorIs(t, err, ErrCorrupted)
+	})
+}
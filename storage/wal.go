@@ -0,0 +1,535 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rdner/crdt/oplog"
+)
+
+const (
+	// DefaultMaxSegmentSize is the size of a WAL segment file after which a new segment is started
+	DefaultMaxSegmentSize = 64 << 20
+
+	// segmentPrefix is the file name prefix of WAL segments
+	segmentPrefix = "wal-"
+	// segmentExt is the file extension of WAL segments
+	segmentExt = ".log"
+	// snapshotPrefix is the file name prefix of snapshots
+	snapshotPrefix = "snapshot-"
+	// snapshotExt is the file extension of snapshots
+	snapshotExt = ".snap"
+	// journalPrefix is the file name prefix of conflict journals saved with snapshots
+	journalPrefix = "journal-"
+	// journalExt is the file extension of conflict journals
+	journalExt = ".json"
+	// tempExt is the file extension of snapshots that are being written
+	tempExt = ".tmp"
+)
+
+// WALConfig contains the settings of the write-ahead log
+type WALConfig struct {
+	// MaxSegmentSize is the size in bytes after which the log is rotated to a new segment file,
+	// `DefaultMaxSegmentSize` if zero
+	MaxSegmentSize int64
+	// Encryption encrypts the operations, snapshots and conflict journals, the zero value disables encryption.
+	// Data encrypted with a previous key is rewritten with the current key by the next snapshot,
+	// after that the previous key can be removed from the keyring.
+	Encryption Keyring
+	// CheckpointSize is the size in bytes of the operations logged since the last snapshot after which
+	// a new snapshot is due (see `WAL.CheckpointDue`), zero disables the trigger.
+	// It bounds the number of operations replayed on recovery.
+	CheckpointSize int64
+	// CheckpointAge is how long after the first operation logged since the last snapshot a new snapshot is due,
+	// it's measured by the timestamps of the operations, zero disables the trigger.
+	// It bounds the recovery time of replicas writing rarely but steadily.
+	CheckpointAge time.Duration
+}
+
+// OpenWAL opens the write-ahead log stored in the directory, the directory is created if it does not exist.
+// Call `Close` when the log is not used anymore.
+// Returns an error with `ErrInvalidKeyring` cause if the encryption keyring is invalid.
+func OpenWAL(dir string, cfg WALConfig) (WAL, error) {
+	if cfg.MaxSegmentSize <= 0 {
+		cfg.MaxSegmentSize = DefaultMaxSegmentSize
+	}
+
+	err := cfg.Encryption.validate()
+	if err != nil {
+		return WAL{}, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return WAL{}, errors.Wrapf(err, "failed to create the WAL directory %q", dir)
+	}
+
+	return WAL{
+		mutex: &sync.Mutex{},
+		dir:   dir,
+		cfg:   cfg,
+		state: &walState{},
+	}, nil
+}
+
+// WAL is an append-only write-ahead log stored as a directory of segment files
+// with JSON lines of operations, and snapshot files checkpointing the state along with conflict journal files.
+// It implements the `Backend` interface.
+// Use `OpenWAL` in order to initialize it before use.
+// The log is thread-safe and can be used from several go routines.
+//
+// Every appended operation is synced to the disk before `AppendOp` returns, the directory is synced
+// after creating, renaming and deleting files, so new segments and snapshots survive a crash too.
+// Segments are rotated when they exceed `WALConfig.MaxSegmentSize` and on every snapshot,
+// segments containing only operations included in a snapshot are deleted.
+// A partially written last operation (e.g. after a crash) is ignored on `Load`.
+//
+// With `WALConfig.Encryption` every operation is encrypted separately and stored as a base64 line,
+// snapshots and conflict journals are encrypted as a whole. The name of the file is authenticated
+// along with the data, so encrypted records cannot be moved between files unnoticed.
+//
+// The log implements `CheckpointTrigger`: `Graph` saves a snapshot as soon as the operations logged
+// since the last snapshot exceed `WALConfig.CheckpointSize` or `WALConfig.CheckpointAge`,
+// so the recovery time stays bounded without calling `Graph.Checkpoint` on a fixed timer.
+type WAL struct {
+	// mutex is used for the thread-safety
+	mutex *sync.Mutex
+
+	// dir is the directory containing the files of the log
+	dir string
+	// cfg contains the settings
+	cfg WALConfig
+	// state contains the current segment
+	state *walState
+}
+
+// walState contains the mutable state of the write-ahead log
+type walState struct {
+	// file is the current segment, nil if the next operation starts a new segment
+	file *os.File
+	// name is the file name of the current segment
+	name string
+	// size is the size of the current segment
+	size int64
+	// lastSeq is the sequence number of the last appended operation
+	lastSeq int
+	// logged is the size of the operations logged since the last snapshot
+	logged int64
+	// firstLogged is the timestamp of the first operation logged since the last snapshot,
+	// zero if there are no such operations
+	firstLogged time.Time
+	// lastLogged is the timestamp of the last operation logged since the last snapshot
+	lastLogged time.Time
+}
+
+// segment is a WAL segment file
+type segment struct {
+	// path is the path to the file
+	path string
+	// firstSeq is the sequence number of the first operation in the segment
+	firstSeq int
+}
+
+// Load implements the `Backend` interface
+func (w WAL) Load() (snapshot Snapshot, ops []oplog.Op, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	snapshots, err := w.list(snapshotPrefix, snapshotExt)
+	if err != nil {
+		return Snapshot{}, nil, err
+	}
+	if len(snapshots) != 0 {
+		last := snapshots[len(snapshots)-1]
+		snapshot.Data, err = w.readFile(last.path)
+		if err != nil {
+			return Snapshot{}, nil, errors.Wrapf(err, "failed to read the snapshot %q", last.path)
+		}
+		snapshot.Seq = last.firstSeq
+
+		path := filepath.Join(w.dir, fileName(journalPrefix, snapshot.Seq, journalExt))
+		snapshot.Journal, err = w.readFile(path)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return Snapshot{}, nil, errors.Wrapf(err, "failed to read the conflict journal %q", path)
+		}
+	}
+	w.state.lastSeq = snapshot.Seq
+	w.state.logged = 0
+
+	segments, err := w.list(segmentPrefix, segmentExt)
+	if err != nil {
+		return Snapshot{}, nil, err
+	}
+	for i, s := range segments {
+		segmentOps, err := w.readSegment(s.path, i == len(segments)-1)
+		if err != nil {
+			return Snapshot{}, nil, err
+		}
+		for _, op := range segmentOps {
+			if op.Seq > w.state.lastSeq {
+				w.state.lastSeq = op.Seq
+			}
+			if op.Seq > snapshot.Seq {
+				ops = append(ops, op)
+			}
+		}
+		// the segments included in the snapshot are deleted, so the remaining ones are the log to replay
+		info, err := os.Stat(s.path)
+		if err != nil {
+			return Snapshot{}, nil, errors.Wrapf(err, "failed to read the WAL segment %q", s.path)
+		}
+		w.state.logged += info.Size()
+	}
+
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Seq < ops[j].Seq
+	})
+
+	w.state.firstLogged, w.state.lastLogged = time.Time{}, time.Time{}
+	if len(ops) != 0 {
+		w.state.firstLogged, w.state.lastLogged = ops[0].Time, ops[len(ops)-1].Time
+	}
+
+	return snapshot, ops, nil
+}
+
+// AppendOp implements the `Backend` interface
+func (w WAL) AppendOp(op oplog.Op) error {
+	line, err := json.Marshal(op)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal operation %d", op.Seq)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.state.file == nil {
+		name := fileName(segmentPrefix, op.Seq, segmentExt)
+		path := filepath.Join(w.dir, name)
+		// nolint:gosec // the path is built from the WAL directory
+		w.state.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create the WAL segment %q", path)
+		}
+		w.state.name = name
+		w.state.size = 0
+
+		// the new segment must survive a crash along with the operations synced to it
+		err = syncDir(w.dir)
+		if err != nil {
+			_ = w.rotate()
+			return err
+		}
+	}
+
+	if w.cfg.Encryption.enabled() {
+		sealed, err := w.cfg.Encryption.seal(line, []byte(w.state.name))
+		if err != nil {
+			return errors.Wrapf(err, "failed to encrypt operation %d", op.Seq)
+		}
+		line = []byte(base64.StdEncoding.EncodeToString(sealed))
+	}
+	line = append(line, '\n')
+
+	n, err := w.state.file.Write(line)
+	w.state.size += int64(n)
+	w.state.logged += int64(n)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write operation %d to the WAL", op.Seq)
+	}
+	err = w.state.file.Sync()
+	if err != nil {
+		return errors.Wrapf(err, "failed to sync operation %d to the WAL", op.Seq)
+	}
+	if op.Seq > w.state.lastSeq {
+		w.state.lastSeq = op.Seq
+	}
+	if w.state.firstLogged.IsZero() {
+		w.state.firstLogged = op.Time
+	}
+	w.state.lastLogged = op.Time
+
+	if w.state.size >= w.cfg.MaxSegmentSize {
+		return w.rotate()
+	}
+
+	return nil
+}
+
+// SaveSnapshot implements the `Backend` interface.
+// The snapshot is written to a temporary file which is atomically renamed,
+// so a crash never leaves a partially written snapshot.
+// The conflict journal is written the same way to a separate file before the snapshot.
+func (w WAL) SaveSnapshot(snapshot Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if snapshot.Journal != nil {
+		path := filepath.Join(w.dir, fileName(journalPrefix, snapshot.Seq, journalExt))
+		err := w.writeFile(path, snapshot.Journal)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write the conflict journal %q", path)
+		}
+	}
+
+	path := filepath.Join(w.dir, fileName(snapshotPrefix, snapshot.Seq, snapshotExt))
+	err := w.writeFile(path, snapshot.Data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write the snapshot %q", path)
+	}
+
+	// the operations after the snapshot start a new segment, so the current one can be deleted
+	err = w.rotate()
+	if err != nil {
+		return err
+	}
+
+	err = w.compact(snapshot.Seq)
+	if err != nil {
+		return err
+	}
+	w.state.logged = 0
+	w.state.firstLogged, w.state.lastLogged = time.Time{}, time.Time{}
+	return nil
+}
+
+// CheckpointDue implements the `CheckpointTrigger` interface.
+// Returns `true` if the operations logged since the last snapshot exceed `WALConfig.CheckpointSize`
+// or were logged over a period longer than `WALConfig.CheckpointAge`.
+func (w WAL) CheckpointDue() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.cfg.CheckpointSize > 0 && w.state.logged >= w.cfg.CheckpointSize {
+		return true
+	}
+	if w.cfg.CheckpointAge > 0 && !w.state.firstLogged.IsZero() {
+		return w.state.lastLogged.Sub(w.state.firstLogged) >= w.cfg.CheckpointAge
+	}
+	return false
+}
+
+// Close closes the current segment file
+func (w WAL) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.rotate()
+}
+
+// rotate closes the current segment, so the next operation starts a new one
+func (w WAL) rotate() error {
+	if w.state.file == nil {
+		return nil
+	}
+	err := w.state.file.Close()
+	w.state.file = nil
+	if err != nil {
+		return errors.Wrap(err, "failed to close the WAL segment")
+	}
+	return nil
+}
+
+// compact deletes the older snapshots with their journals and the closed segments containing only operations
+// included in the snapshot with the given sequence number
+func (w WAL) compact(seq int) error {
+	snapshots, err := w.list(snapshotPrefix, snapshotExt)
+	if err != nil {
+		return err
+	}
+	journals, err := w.list(journalPrefix, journalExt)
+	if err != nil {
+		return err
+	}
+	for _, s := range append(snapshots, journals...) {
+		if s.firstSeq < seq {
+			err = os.Remove(s.path)
+			if err != nil {
+				return errors.Wrapf(err, "failed to delete the snapshot %q", s.path)
+			}
+		}
+	}
+
+	segments, err := w.list(segmentPrefix, segmentExt)
+	if err != nil {
+		return err
+	}
+	for i, s := range segments {
+		included := w.state.lastSeq <= seq
+		if i+1 < len(segments) {
+			included = segments[i+1].firstSeq <= seq+1
+		}
+		if !included {
+			break
+		}
+		err = os.Remove(s.path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete the WAL segment %q", s.path)
+		}
+	}
+
+	return syncDir(w.dir)
+}
+
+// list returns the files with the given prefix and extension ordered by their sequence number
+func (w WAL) list(prefix, ext string) ([]segment, error) {
+	entries, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the WAL directory %q", w.dir)
+	}
+
+	var files []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if err != nil {
+			return nil, errors.Wrapf(ErrCorrupted, "unexpected file %q in the WAL directory", name)
+		}
+		files = append(files, segment{path: filepath.Join(w.dir, name), firstSeq: seq})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].firstSeq < files[j].firstSeq
+	})
+
+	return files, nil
+}
+
+// readFile reads the file decrypting it if encryption is enabled
+func (w WAL) readFile(path string) ([]byte, error) {
+	// nolint:gosec // the path is built from the WAL directory
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return w.cfg.Encryption.open(data, []byte(filepath.Base(path)))
+}
+
+// writeFile atomically writes the file encrypting it if encryption is enabled
+func (w WAL) writeFile(path string, data []byte) error {
+	data, err := w.cfg.Encryption.seal(data, []byte(filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// decodeOp decodes the operation from a line of the segment file with the given name
+func (w WAL) decodeOp(line []byte, name string) (op oplog.Op, err error) {
+	if w.cfg.Encryption.enabled() {
+		sealed, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil {
+			return op, errors.Wrap(ErrCorrupted, err.Error())
+		}
+		line, err = w.cfg.Encryption.open(sealed, []byte(name))
+		if err != nil {
+			return op, err
+		}
+	}
+	err = json.Unmarshal(line, &op)
+	return op, err
+}
+
+// readSegment reads the operations of the segment file.
+// A broken last line of the `last` segment is a partially written operation,
+// it's truncated, so the segment stays valid when new segments follow it.
+func (w WAL) readSegment(path string, last bool) (ops []oplog.Op, err error) {
+	// nolint:gosec // the path is built from the WAL directory
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the WAL segment %q", path)
+	}
+
+	complete := bytes.HasSuffix(data, []byte{'\n'})
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'})
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		op, err := w.decodeOp(line, filepath.Base(path))
+		if err == nil {
+			ops = append(ops, op)
+			continue
+		}
+		if last && !complete && i == len(lines)-1 {
+			err = os.Truncate(path, int64(len(data)-len(line)))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to truncate the partially written operation in the WAL segment %q", path)
+			}
+			break
+		}
+		if errors.Is(err, ErrUnknownKey) {
+			return nil, errors.Wrapf(err, "failed to decrypt line %d of the WAL segment %q", i+1, path)
+		}
+		return nil, errors.Wrapf(ErrCorrupted, "invalid operation on line %d of the WAL segment %q: %s", i+1, path, err)
+	}
+
+	return ops, nil
+}
+
+// fileName returns the name of a log file, the zero-padded sequence number keeps the files sorted
+func fileName(prefix string, seq int, ext string) string {
+	return fmt.Sprintf("%s%016d%s", prefix, seq, ext)
+}
+
+// writeFileAtomic writes the file to a temporary file and renames it,
+// so a crash never leaves a partially written file.
+// The directory is synced after the rename, so the file survives a crash once the function returns.
+func writeFileAtomic(path string, data []byte) error {
+	err := writeFileSync(path+tempExt, data)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path+tempExt, path)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// writeFileSync writes the file and syncs it to the disk
+func writeFileSync(path string, data []byte) error {
+	// nolint:gosec // the path is built from the WAL directory
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// syncDir syncs the directory, so created, renamed and deleted files survive a crash
+func syncDir(dir string) error {
+	// nolint:gosec // the path is the WAL directory
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open the WAL directory %q", dir)
+	}
+	err = d.Sync()
+	closeErr := d.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed to sync the WAL directory %q", dir)
+	}
+	return closeErr
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rdner/crdt/lww"
+	"github.com/rdner/crdt/oplog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWAL(t *testing.T) {
+	ctx := context.Background()
+	op := func(seq int) oplog.Op {
+		return oplog.Op{Replica: "test", Seq: seq, Type: oplog.AddVertex, Key: "v"}
+	}
+	files := func(t *testing.T, dir string) []string {
+		entries, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	t.Run("returns nothing for an empty directory", func(t *testing.T) {
+		wal, err := OpenWAL(filepath.Join(t.TempDir(), "wal"), WALConfig{})
+		require.NoError(t, err)
+		defer wal.Close()
+
+		snapshot, ops, err := wal.Load()
+		require.NoError(t, err)
+		require.Equal(t, Snapshot{}, snapshot)
+		require.Empty(t, ops)
+	})
+
+	t.Run("rotates segments and deletes the ones included in a snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		wal, err := OpenWAL(dir, WALConfig{MaxSegmentSize: 1})
+		require.NoError(t, err)
+		defer wal.Close()
+
+		for seq := 1; seq <= 3; seq++ {
+			require.NoError(t, wal.AppendOp(op(seq)))
+		}
+		require.Equal(t, []string{
+			"wal-0000000000000001.log",
+			"wal-0000000000000002.log",
+			"wal-0000000000000003.log",
+		}, files(t, dir))
+
+		require.NoError(t, wal.SaveSnapshot(Snapshot{Data: []byte("state"), Seq: 2}))
+		require.Equal(t, []string{
+			"snapshot-0000000000000002.snap",
+			"wal-0000000000000003.log",
+		}, files(t, dir))
+
+		snapshot, ops, err := wal.Load()
+		require.NoError(t, err)
+		require.Equal(t, Snapshot{Data: []byte("state"), Seq: 2}, snapshot)
+		require.Equal(t, []oplog.Op{op(3)}, ops)
+
+		require.NoError(t, wal.SaveSnapshot(Snapshot{Data: []byte("state"), Seq: 3, Journal: []byte("[]")}))
+		require.Equal(t, []string{"journal-0000000000000003.json", "snapshot-0000000000000003.snap"}, files(t, dir))
+
+		snapshot, _, err = wal.Load()
+		require.NoError(t, err)
+		require.Equal(t, Snapshot{Data: []byte("state"), Seq: 3, Journal: []byte("[]")}, snapshot)
+
+		require.NoError(t, wal.SaveSnapshot(Snapshot{Data: []byte("state"), Seq: 4}))
+		require.Equal(t, []string{"snapshot-0000000000000004.snap"}, files(t, dir))
+	})
+
+	t.Run("ignores a partially written last operation", func(t *testing.T) {
+		dir := t.TempDir()
+		wal, err := OpenWAL(dir, WALConfig{})
+		require.NoError(t, err)
+		require.NoError(t, wal.AppendOp(op(1)))
+		require.NoError(t, wal.Close())
+
+		path := filepath.Join(dir, "wal-0000000000000001.log")
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+		require.NoError(t, err)
+		_, err = file.WriteString(`{"replica":"test","seq":2,`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		wal, err = OpenWAL(dir, WALConfig{})
+		require.NoError(t, err)
+		defer wal.Close()
+
+		_, ops, err := wal.Load()
+		require.NoError(t, err)
+		require.Equal(t, []oplog.Op{op(1)}, ops)
+
+		require.NoError(t, wal.AppendOp(op(2)))
+		_, ops, err = wal.Load()
+		require.NoError(t, err, "the truncated segment must stay valid when followed by new segments")
+		require.Equal(t, []oplog.Op{op(1), op(2)}, ops)
+	})
+
+	t.Run("returns ErrCorrupted for a broken operation in the middle", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "wal-0000000000000001.log")
+		require.NoError(t, ioutil.WriteFile(path, []byte("{\n{}\n"), 0600))
+
+		wal, err := OpenWAL(dir, WALConfig{})
+		require.NoError(t, err)
+		defer wal.Close()
+
+		_, _, err = wal.Load()
+		require.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("a checkpoint is due when the log exceeds the size or the age threshold", func(t *testing.T) {
+		base := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+		timed := func(seq int, at time.Duration) oplog.Op {
+			o := op(seq)
+			o.Time = base.Add(at)
+			return o
+		}
+
+		dir := t.TempDir()
+		wal, err := OpenWAL(dir, WALConfig{CheckpointSize: 200, CheckpointAge: time.Hour})
+		require.NoError(t, err)
+		defer wal.Close()
+
+		require.False(t, wal.CheckpointDue())
+		require.NoError(t, wal.AppendOp(timed(1, 0)))
+		require.NoError(t, wal.AppendOp(timed(2, time.Minute)))
+		require.False(t, wal.CheckpointDue())
+		require.NoError(t, wal.AppendOp(timed(3, time.Hour)))
+		require.True(t, wal.CheckpointDue(), "the first operation is an hour old")
+
+		require.NoError(t, wal.SaveSnapshot(Snapshot{Data: []byte("state"), Seq: 3}))
+		require.False(t, wal.CheckpointDue())
+		for seq := 4; !wal.CheckpointDue(); seq++ {
+			require.NoError(t, wal.AppendOp(timed(seq, time.Hour)))
+			require.Less(t, seq, 10, "the size threshold is not reached")
+		}
+
+		// the log since the last snapshot is measured on load too
+		reopened, err := OpenWAL(dir, WALConfig{CheckpointSize: 200})
+		require.NoError(t, err)
+		defer reopened.Close()
+		_, _, err = reopened.Load()
+		require.NoError(t, err)
+		require.True(t, reopened.CheckpointDue())
+	})
+
+	t.Run("the graph saves snapshots when they are due", func(t *testing.T) {
+		dir := t.TempDir()
+		wal, err := OpenWAL(dir, WALConfig{CheckpointSize: 300})
+		require.NoError(t, err)
+		defer wal.Close()
+		g, err := NewGraphFromStorage(testReplica(), wal)
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, g.UpsertVertex(ctx, lww.Vertex{Key: "v", Value: strconv.Itoa(i)}))
+		}
+		snapshot, ops, err := wal.Load()
+		require.NoError(t, err)
+		require.NotNil(t, snapshot.Data)
+		require.Less(t, len(ops), 10, "the log is compacted")
+		require.False(t, wal.CheckpointDue())
+
+		recovered, err := NewGraphFromStorage(testReplica(), wal)
+		require.NoError(t, err)
+		v, err := recovered.Lookup("v")
+		require.NoError(t, err)
+		require.Equal(t, "9", v.Value)
+	})
+
+	t.Run("the graph is reconstructed after a crash", func(t *testing.T) {
+		v1 := lww.Vertex{Key: "vertex1", Value: "value1"}
+		v2 := lww.Vertex{Key: "vertex2", Value: "value2"}
+
+		dir := t.TempDir()
+		wal, err := OpenWAL(dir, WALConfig{})
+		require.NoError(t, err)
+		g, err := NewGraphFromStorage(testReplica(), wal)
+		require.NoError(t, err)
+		require.NoError(t, g.AddVertex(ctx, v1))
+		require.NoError(t, g.Checkpoint())
+		require.NoError(t, g.AddVertex(ctx, v2))
+		require.NoError(t, g.AddEdge(ctx, v1.Key, v2.Key))
+		// no `Close`, the process crashes
+
+		wal, err = OpenWAL(dir, WALConfig{})
+		require.NoError(t, err)
+		defer wal.Close()
+		recovered, err := NewGraphFromStorage(testReplica(), wal)
+		require.NoError(t, err)
+
+		connected, err := recovered.FindConnected(v1.Key)
+		require.NoError(t, err)
+		require.Equal(t, []lww.Vertex{v2}, connected)
+	})
+}